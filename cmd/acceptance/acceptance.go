@@ -0,0 +1,366 @@
+package acceptance
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/christianh814/gokp/cmd/clock"
+	log "github.com/sirupsen/logrus"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/yaml"
+)
+
+// Namespace is where the acceptance tests run, unless their manifests say otherwise
+var Namespace string = "gokp-acceptance"
+
+// ResultsFile is the name of the results of the last run, kept in the artifacts dir of the cluster
+var ResultsFile string = "acceptance-results.yaml"
+
+// Wait is how often Run checks on the Jobs, and how long it waits for all of them to finish
+var Wait clock.Waiter = clock.Waiter{Interval: 10 * time.Second, Timeout: 30 * time.Minute}
+
+// logLines is how many lines of the logs of a failed Job are kept in the results
+var logLines int64 = 50
+
+// fieldManager owns what the acceptance tests apply
+var fieldManager string = "gokp-acceptance"
+
+// JobResult is how one of the Jobs did
+type JobResult struct {
+	Name            string     `json:"name"`
+	Namespace       string     `json:"namespace"`
+	File            string     `json:"file"`
+	Passed          bool       `json:"passed"`
+	Reason          string     `json:"reason,omitempty"`
+	StartedAt       *time.Time `json:"startedAt,omitempty"`
+	FinishedAt      *time.Time `json:"finishedAt,omitempty"`
+	DurationSeconds float64    `json:"durationSeconds,omitempty"`
+
+	// Logs are the last lines of the logs of the last pod of a Job that failed
+	Logs string `json:"logs,omitempty"`
+}
+
+// Results are how the acceptance tests of the cluster did. They passed if every Job did
+type Results struct {
+	ClusterName string      `json:"clusterName"`
+	Dir         string      `json:"dir"`
+	RanAt       time.Time   `json:"ranAt"`
+	Passed      bool        `json:"passed"`
+	Jobs        []JobResult `json:"jobs"`
+}
+
+// Failed returns the Jobs that didn't pass
+func (r *Results) Failed() []JobResult {
+	failed := []JobResult{}
+	for _, j := range r.Jobs {
+		if !j.Passed {
+			failed = append(failed, j)
+		}
+	}
+	return failed
+}
+
+// Save writes the results into the given dir
+func (r *Results) Save(dir string) error {
+	b, err := yaml.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(dir+"/"+ResultsFile, b, 0644)
+}
+
+// Manifest is an object of one of the files of the acceptance tests
+type Manifest struct {
+	File   string
+	Object *unstructured.Unstructured
+}
+
+// Load reads the manifests of the acceptance tests from the .yaml and .yml files of the dir, in the order of their
+// names. The Jobs are the tests, anything else (like the ServiceAccounts and RBAC they need) is applied before them.
+// There has to be at least one Job
+func Load(dir string) ([]Manifest, error) {
+	files := []string{}
+	for _, ext := range []string{"*.yaml", "*.yml"} {
+		matches, err := filepath.Glob(filepath.Join(dir, ext))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	sort.Strings(files)
+
+	manifests := []Manifest{}
+	jobs := 0
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		decoder := utilyaml.NewYAMLOrJSONDecoder(f, 4096)
+		for {
+			obj := &unstructured.Unstructured{}
+			err = decoder.Decode(&obj.Object)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				f.Close()
+				return nil, errors.New("unable to read " + file + ": " + err.Error())
+			}
+			// Empty documents, like one after a trailing ---
+			if len(obj.Object) == 0 {
+				continue
+			}
+			if obj.GetKind() == "" || obj.GetName() == "" {
+				f.Close()
+				return nil, errors.New("an object in " + file + " has no kind or name")
+			}
+			if isJob(obj) {
+				jobs++
+			}
+			manifests = append(manifests, Manifest{File: filepath.Base(file), Object: obj})
+		}
+		f.Close()
+	}
+
+	if jobs == 0 {
+		return nil, errors.New("no Jobs found in " + dir + ", the acceptance tests are Jobs")
+	}
+
+	// If we're here, we should be okay
+	return manifests, nil
+}
+
+// Run runs the acceptance tests in the dir on the cluster of the kubeconfig, and waits for them to finish. A Job
+// passes once it completes, and fails if it fails or is still running when the Wait times out. Jobs of an earlier
+// run are replaced
+func Run(kubeconfig string, clusterName string, dir string) (*Results, error) {
+	manifests, err := Load(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// The namespace of the tests that don't have one of their own
+	_, err = clientset.CoreV1().Namespaces().Create(context.TODO(), &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: Namespace},
+	}, metav1.CreateOptions{})
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return nil, err
+	}
+
+	// What the Jobs need goes first, then the Jobs themselves
+	results := &Results{ClusterName: clusterName, Dir: dir, RanAt: time.Now(), Jobs: []JobResult{}}
+	for _, jobs := range []bool{false, true} {
+		for _, m := range manifests {
+			if isJob(m.Object) != jobs {
+				continue
+			}
+			if jobs {
+				if m.Object.GetNamespace() == "" {
+					m.Object.SetNamespace(Namespace)
+				}
+				err = replaceJob(clientset, m.Object.GetNamespace(), m.Object.GetName())
+				if err != nil {
+					return nil, err
+				}
+				results.Jobs = append(results.Jobs, JobResult{Name: m.Object.GetName(), Namespace: m.Object.GetNamespace(), File: m.File})
+			}
+			log.Info("Applying ", m.Object.GetKind(), " ", m.Object.GetName(), " from ", m.File)
+			err = apply(cfg, m.Object)
+			if err != nil {
+				return nil, errors.New("unable to apply " + m.Object.GetKind() + " " + m.Object.GetName() + " of " + m.File + ": " + err.Error())
+			}
+		}
+	}
+
+	// Wait for every Job to either complete or fail
+	log.Info("Waiting for ", len(results.Jobs), " acceptance tests to finish")
+	err = Wait.Until(func() (bool, error) {
+		done := true
+		for i := range results.Jobs {
+			r := &results.Jobs[i]
+			if r.FinishedAt != nil {
+				continue
+			}
+			job, err := clientset.BatchV1().Jobs(r.Namespace).Get(context.TODO(), r.Name, metav1.GetOptions{})
+			if err != nil {
+				return false, err
+			}
+			if !finished(job, r) {
+				done = false
+				continue
+			}
+			if r.Passed {
+				log.Info("Acceptance test ", r.Name, " passed")
+			} else {
+				log.Warn("Acceptance test ", r.Name, " failed: ", r.Reason)
+			}
+		}
+		return done, nil
+	})
+	if err != nil && err != clock.ErrTimeout {
+		return nil, err
+	}
+
+	// Whatever's still running by now has failed
+	for i := range results.Jobs {
+		r := &results.Jobs[i]
+		if r.FinishedAt == nil {
+			r.Reason = "still running after " + Wait.Timeout.String()
+			log.Warn("Acceptance test ", r.Name, " failed: ", r.Reason)
+		}
+		if !r.Passed {
+			r.Logs = jobLogs(clientset, r.Namespace, r.Name)
+		}
+	}
+	results.Passed = len(results.Failed()) == 0
+
+	// If we're here, we should be okay
+	return results, nil
+}
+
+// finished returns true if the Job completed or failed, filling in the result
+func finished(job *batchv1.Job, r *JobResult) bool {
+	for _, c := range job.Status.Conditions {
+		if c.Status != corev1.ConditionTrue || (c.Type != batchv1.JobComplete && c.Type != batchv1.JobFailed) {
+			continue
+		}
+		r.Passed = c.Type == batchv1.JobComplete
+		if !r.Passed {
+			r.Reason = c.Reason
+			if c.Message != "" {
+				r.Reason = r.Reason + ": " + c.Message
+			}
+		}
+		finishedAt := c.LastTransitionTime.Time
+		r.FinishedAt = &finishedAt
+		if job.Status.StartTime != nil {
+			startedAt := job.Status.StartTime.Time
+			r.StartedAt = &startedAt
+			r.DurationSeconds = finishedAt.Sub(startedAt).Round(time.Second).Seconds()
+		}
+		return true
+	}
+	return false
+}
+
+// replaceJob deletes the Job (and its pods) of an earlier run, if there is one, and waits for it to be gone. The
+// template of a Job can't be changed, and one that finished would never run again
+func replaceJob(clientset kubernetes.Interface, namespace string, name string) error {
+	propagation := metav1.DeletePropagationForeground
+	err := clientset.BatchV1().Jobs(namespace).Delete(context.TODO(), name, metav1.DeleteOptions{PropagationPolicy: &propagation})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Info("Replacing Job ", name, " of an earlier run")
+	err = Wait.Until(func() (bool, error) {
+		_, err := clientset.BatchV1().Jobs(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	})
+	if err == clock.ErrTimeout {
+		return errors.New("the Job " + namespace + "/" + name + " of an earlier run is still being deleted")
+	}
+	return err
+}
+
+// jobLogs returns the last lines of the logs of the last pod of the Job, or why they couldn't be had
+func jobLogs(clientset kubernetes.Interface, namespace string, name string) string {
+	pods, err := clientset.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{LabelSelector: "job-name=" + name})
+	if err != nil {
+		return "unable to list the pods of the Job: " + err.Error()
+	}
+	if len(pods.Items) == 0 {
+		return "the Job has no pods"
+	}
+	sort.Slice(pods.Items, func(i, j int) bool {
+		return pods.Items[i].CreationTimestamp.Before(&pods.Items[j].CreationTimestamp)
+	})
+	pod := pods.Items[len(pods.Items)-1]
+
+	b, err := clientset.CoreV1().Pods(namespace).GetLogs(pod.Name, &corev1.PodLogOptions{TailLines: &logLines}).DoRaw(context.TODO())
+	if err != nil {
+		return "unable to get the logs of pod " + pod.Name + ": " + err.Error()
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// apply applies the object server side, in the namespace of the tests if it's namespaced and has none
+func apply(cfg *rest.Config, obj *unstructured.Unstructured) error {
+	dc, err := discovery.NewDiscoveryClientForConfig(cfg)
+	if err != nil {
+		return err
+	}
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(dc))
+	dyn, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	gvk := obj.GroupVersionKind()
+	mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return err
+	}
+	var dr dynamic.ResourceInterface
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		if obj.GetNamespace() == "" {
+			obj.SetNamespace(Namespace)
+		}
+		dr = dyn.Resource(mapping.Resource).Namespace(obj.GetNamespace())
+	} else {
+		dr = dyn.Resource(mapping.Resource)
+	}
+
+	data, err := obj.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	force := true
+	_, err = dr.Patch(context.TODO(), obj.GetName(), types.ApplyPatchType, data, metav1.PatchOptions{
+		FieldManager: fieldManager,
+		Force:        &force,
+	})
+	return err
+}
+
+// isJob returns true if the object is a Job
+func isJob(obj *unstructured.Unstructured) bool {
+	return obj.GetKind() == "Job" && obj.GroupVersionKind().Group == "batch"
+}
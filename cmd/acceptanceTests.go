@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/christianh814/gokp/cmd/acceptance"
+	"github.com/christianh814/gokp/cmd/state"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// checkAcceptanceTestsFlag makes sure the acceptance tests can be read, before anything is created
+func checkAcceptanceTestsFlag(cmd *cobra.Command) error {
+	dir, _ := cmd.Flags().GetString("acceptance-tests")
+	if dir == "" {
+		return nil
+	}
+	_, err := acceptance.Load(dir)
+	return err
+}
+
+// runAcceptanceTests runs the acceptance tests of --acceptance-tests, if there are any, on the cluster that was just
+// created. The results are kept in the artifacts dir of the cluster, and the install fails if any of them did
+func runAcceptanceTests(cmd *cobra.Command, clusterName string) error {
+	dir, _ := cmd.Flags().GetString("acceptance-tests")
+	if dir == "" {
+		return nil
+	}
+	log.Info("Running the acceptance tests in ", dir)
+	return acceptanceTests(clusterName, state.ArtifactsDir(clusterName)+"/"+clusterName+".kubeconfig", dir)
+}
+
+// acceptanceTests runs the acceptance tests in the dir on the cluster of the kubeconfig, and saves the results in
+// the artifacts dir of the cluster. An error is returned if any of them failed
+func acceptanceTests(clusterName string, kubeconfig string, dir string) error {
+	results, err := acceptance.Run(kubeconfig, clusterName, dir)
+	if err != nil {
+		return err
+	}
+	err = results.Save(state.ArtifactsDir(clusterName))
+	if err != nil {
+		return err
+	}
+
+	resultsFile := state.ArtifactsDir(clusterName) + "/" + acceptance.ResultsFile
+	failed := results.Failed()
+	if len(failed) > 0 {
+		names := []string{}
+		for _, j := range failed {
+			names = append(names, j.Name)
+		}
+		return errors.New(strconv.Itoa(len(failed)) + " of " + strconv.Itoa(len(results.Jobs)) + " acceptance tests failed (" + strings.Join(names, ", ") + "), the results are in " + resultsFile)
+	}
+
+	log.Info("All ", len(results.Jobs), " acceptance tests passed, the results are in ", resultsFile)
+	return nil
+}
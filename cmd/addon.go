@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"github.com/christianh814/gokp/cmd/addons"
+	"github.com/christianh814/gokp/cmd/gitutils"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// addonCmd represents the addon command
+var addonCmd = &cobra.Command{
+	Use:   "addon",
+	Short: "Manages the add-ons of a cluster",
+	Long: `Manages the add-ons of a cluster through the add-on catalog (gokp-addons.yaml)
+in the GitOps repo. Every change updates the catalog, reconciles the repo
+content from it, and pushes the result. For example:
+
+gokp addon add --cluster-name=mycluster --name=metrics-server
+gokp addon add --cluster-name=mycluster --name=argo-rollouts
+gokp addon upgrade --cluster-name=mycluster --name=metrics-server --version=v0.6.2
+gokp addon remove --cluster-name=mycluster --name=metrics-server`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(addonCmd)
+}
+
+// updateAddOns loads the add-on catalog of the cluster and lets update change it. The repo is
+// then reconciled from the catalog and pushed out
+func updateAddOns(cmd *cobra.Command, clusterName string, msg string, update func(c *addons.Catalog) error) error {
+	// Find the local clone of the repo
+	repoDir, privateKeyFile, err := openClusterRepo(clusterName)
+	if err != nil {
+		return err
+	}
+	baseDir := gitutils.BaseDir(repoDir)
+
+	catalog, err := addons.LoadCatalog(baseDir)
+	if err != nil {
+		return err
+	}
+
+	err = update(catalog)
+	if err != nil {
+		return err
+	}
+
+	// Save the catalog and make the repo match it
+	err = catalog.Save(baseDir)
+	if err != nil {
+		return err
+	}
+	err = addons.Reconcile(baseDir, catalog)
+	if err != nil {
+		return err
+	}
+
+	// HTTPS remotes use the token, everything else uses the stored key
+	err = setRepoCredentials(cmd, repoDir)
+	if err != nil {
+		return err
+	}
+
+	_, err = commitAndPush(repoDir, privateKeyFile, clusterName, msg)
+	if err != nil {
+		return err
+	}
+
+	// If we're here, we should be okay
+	log.Info("Add-on catalog of ", clusterName, " reconciled")
+	return nil
+}
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"errors"
+
+	"github.com/christianh814/gokp/cmd/addons"
+	"github.com/christianh814/gokp/cmd/state"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// addonAddCmd represents the addon add command
+var addonAddCmd = &cobra.Command{
+	Use:   "add",
+	Short: "Adds an add-on to a cluster",
+	Long: `Adds an add-on to the add-on catalog of a cluster and pushes it out.
+Add-ons GOKP knows about only need a name, anything else needs a URL
+(which can use {{.Version}}). For example:
+
+gokp addon add --cluster-name=mycluster --name=metrics-server
+gokp addon add --cluster-name=mycluster --name=ingress-nginx
+gokp addon add --cluster-name=mycluster --name=myaddon --version=v1.0.0 \
+	--url=https://example.com/myaddon/{{.Version}}/install.yaml`,
+	Annotations: map[string]string{stateLockAnnotation: "true"},
+	Run: func(cmd *cobra.Command, args []string) {
+		// Grab flags
+		clusterName, _ := cmd.Flags().GetString("cluster-name")
+		name, _ := cmd.Flags().GetString("name")
+		version, _ := cmd.Flags().GetString("version")
+		url, _ := cmd.Flags().GetString("url")
+
+		err := updateAddOns(cmd, clusterName, "adding add-on "+name, func(c *addons.Catalog) error {
+			if c.Get(name) != nil {
+				return errors.New("add-on " + name + " is already installed, use upgrade instead")
+			}
+
+			// Start from what we know about the add-on (if anything)
+			a, ok := addons.Available[name]
+			if !ok && url == "" {
+				return errors.New("unknown add-on " + name + ", a --url is needed")
+			}
+			a.Name = name
+			if version != "" {
+				a.Version = version
+			}
+			if url != "" {
+				a.URL = url
+			}
+
+			// Add-ons reached through a Service are set up for the provider the cluster runs on
+			if st, err := state.Load(state.ArtifactsDir(clusterName)); err == nil {
+				a = addons.ForProvider(a, st.Provider)
+			}
+
+			c.Set(a)
+			return nil
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	addonCmd.AddCommand(addonAddCmd)
+
+	addonAddCmd.Flags().String("cluster-name", "", "Name of the gokp cluster.")
+	addonAddCmd.Flags().String("name", "", "Name of the add-on.")
+	addonAddCmd.Flags().String("version", "", "Version of the add-on (defaults to the one GOKP knows about).")
+	addonAddCmd.Flags().String("url", "", "URL of the add-on YAML or kustomization, can use {{.Version}}.")
+	addRepoAuthFlags(addonAddCmd)
+
+	addonAddCmd.MarkFlagRequired("cluster-name")
+	addonAddCmd.MarkFlagRequired("name")
+}
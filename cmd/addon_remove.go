@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"errors"
+
+	"github.com/christianh814/gokp/cmd/addons"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// addonRemoveCmd represents the addon remove command
+var addonRemoveCmd = &cobra.Command{
+	Use:   "remove",
+	Short: "Removes an add-on from a cluster",
+	Long: `Removes an add-on from the add-on catalog of a cluster, reconciles
+the repo from the catalog, and pushes it out. For example:
+
+gokp addon remove --cluster-name=mycluster --name=metrics-server`,
+	Annotations: map[string]string{stateLockAnnotation: "true"},
+	Run: func(cmd *cobra.Command, args []string) {
+		// Grab flags
+		clusterName, _ := cmd.Flags().GetString("cluster-name")
+		name, _ := cmd.Flags().GetString("name")
+
+		err := updateAddOns(cmd, clusterName, "removing add-on "+name, func(c *addons.Catalog) error {
+			if !c.Remove(name) {
+				return errors.New("add-on " + name + " is not installed")
+			}
+			return nil
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	addonCmd.AddCommand(addonRemoveCmd)
+
+	addonRemoveCmd.Flags().String("cluster-name", "", "Name of the gokp cluster.")
+	addonRemoveCmd.Flags().String("name", "", "Name of the add-on.")
+	addRepoAuthFlags(addonRemoveCmd)
+
+	addonRemoveCmd.MarkFlagRequired("cluster-name")
+	addonRemoveCmd.MarkFlagRequired("name")
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"errors"
+
+	"github.com/christianh814/gokp/cmd/addons"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// addonUpgradeCmd represents the addon upgrade command
+var addonUpgradeCmd = &cobra.Command{
+	Use:   "upgrade",
+	Short: "Upgrades an add-on of a cluster",
+	Long: `Sets the version of an add-on in the add-on catalog of a cluster,
+reconciles the repo from the catalog, and pushes it out. For example:
+
+gokp addon upgrade --cluster-name=mycluster --name=metrics-server --version=v0.6.2`,
+	Annotations: map[string]string{stateLockAnnotation: "true"},
+	Run: func(cmd *cobra.Command, args []string) {
+		// Grab flags
+		clusterName, _ := cmd.Flags().GetString("cluster-name")
+		name, _ := cmd.Flags().GetString("name")
+		version, _ := cmd.Flags().GetString("version")
+
+		err := updateAddOns(cmd, clusterName, "upgrading add-on "+name+" to "+version, func(c *addons.Catalog) error {
+			a := c.Get(name)
+			if a == nil {
+				return errors.New("add-on " + name + " is not installed")
+			}
+			a.Version = version
+			return nil
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	addonCmd.AddCommand(addonUpgradeCmd)
+
+	addonUpgradeCmd.Flags().String("cluster-name", "", "Name of the gokp cluster.")
+	addonUpgradeCmd.Flags().String("name", "", "Name of the add-on.")
+	addonUpgradeCmd.Flags().String("version", "", "Version to upgrade the add-on to.")
+	addRepoAuthFlags(addonUpgradeCmd)
+
+	addonUpgradeCmd.MarkFlagRequired("cluster-name")
+	addonUpgradeCmd.MarkFlagRequired("name")
+	addonUpgradeCmd.MarkFlagRequired("version")
+}
@@ -0,0 +1,357 @@
+package addons
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/christianh814/gokp/cmd/templates"
+	"github.com/christianh814/gokp/cmd/utils"
+	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/yaml"
+)
+
+// CatalogFile is the name of the add-on catalog that lives at the root of the GitOps repo
+var CatalogFile string = "gokp-addons.yaml"
+
+// addOnDirPrefix is what the dirs of add-ons under cluster/core start with, so we know which dirs we own
+var addOnDirPrefix string = "addon-"
+
+// AddOn is an add-on installed on the cluster. The URL can use {{.Version}} to point at a specific version.
+// Add-ons whose YAML doesn't set a namespace get the one given here, which is created along with it
+type AddOn struct {
+	Name      string           `json:"name"`
+	Version   string           `json:"version"`
+	URL       string           `json:"url"`
+	Namespace string           `json:"namespace,omitempty"`
+	Service   *ServiceSettings `json:"service,omitempty"`
+	Resources []Resources      `json:"resources,omitempty"`
+
+	// ServerSideApply has Argo CD apply the CRDs of the add-on server side, for CRDs too big for the annotation
+	// a client side apply keeps the last applied configuration in
+	ServerSideApply bool `json:"serverSideApply,omitempty"`
+}
+
+// ServiceSettings are the type and annotations of the Service an add-on is reached through, which depend on the
+// provider the cluster runs on. They're patched onto the Service the YAML of the add-on has
+type ServiceSettings struct {
+	Name        string            `json:"name"`
+	Namespace   string            `json:"namespace"`
+	Type        string            `json:"type,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// Resources are the requests and limits of a workload of an add-on, which are patched onto its YAML. Container is
+// the container of a Deployment (or the like) they're for, without it they're set on the spec itself, like the
+// Prometheus and Alertmanager resources of the Prometheus Operator have them
+type Resources struct {
+	APIVersion string            `json:"apiVersion"`
+	Kind       string            `json:"kind"`
+	Name       string            `json:"name"`
+	Namespace  string            `json:"namespace"`
+	Container  string            `json:"container,omitempty"`
+	Requests   map[string]string `json:"requests,omitempty"`
+	Limits     map[string]string `json:"limits,omitempty"`
+}
+
+// Catalog is the list of add-ons that should be installed on the cluster
+type Catalog struct {
+	AddOns []AddOn `json:"addons"`
+}
+
+// Available are the add-ons GOKP knows about, with their default version
+var Available = map[string]AddOn{
+	"metrics-server": {
+		Name:    "metrics-server",
+		Version: "v0.6.1",
+		URL:     "https://github.com/kubernetes-sigs/metrics-server/releases/download/{{.Version}}/components.yaml",
+	},
+	"cert-manager": {
+		Name:    "cert-manager",
+		Version: "v1.9.1",
+		URL:     "https://github.com/cert-manager/cert-manager/releases/download/{{.Version}}/cert-manager.yaml",
+	},
+	"argo-rollouts": {
+		Name:      "argo-rollouts",
+		Version:   "v1.3.1",
+		URL:       "https://github.com/argoproj/argo-rollouts/releases/download/{{.Version}}/install.yaml",
+		Namespace: "argo-rollouts",
+	},
+	"ingress-nginx": {
+		Name:    "ingress-nginx",
+		Version: "v1.3.1",
+		URL:     "https://raw.githubusercontent.com/kubernetes/ingress-nginx/controller-{{.Version}}/deploy/static/provider/cloud/deploy.yaml",
+		Service: &ServiceSettings{
+			Name:      "ingress-nginx-controller",
+			Namespace: "ingress-nginx",
+		},
+	},
+	"kube-prometheus": {
+		Name:    "kube-prometheus",
+		Version: "v0.11.0",
+		URL:     "https://github.com/prometheus-operator/kube-prometheus?ref={{.Version}}",
+		Resources: []Resources{
+			{
+				APIVersion: "monitoring.coreos.com/v1",
+				Kind:       "Prometheus",
+				Name:       "k8s",
+				Namespace:  "monitoring",
+				Requests:   map[string]string{"cpu": "200m", "memory": "1Gi"},
+				Limits:     map[string]string{"memory": "2Gi"},
+			},
+			{
+				APIVersion: "monitoring.coreos.com/v1",
+				Kind:       "Alertmanager",
+				Name:       "main",
+				Namespace:  "monitoring",
+				Requests:   map[string]string{"cpu": "10m", "memory": "64Mi"},
+				Limits:     map[string]string{"memory": "256Mi"},
+			},
+			{
+				APIVersion: "apps/v1",
+				Kind:       "Deployment",
+				Name:       "grafana",
+				Namespace:  "monitoring",
+				Container:  "grafana",
+				Requests:   map[string]string{"cpu": "100m", "memory": "128Mi"},
+				Limits:     map[string]string{"memory": "512Mi"},
+			},
+		},
+		ServerSideApply: true,
+	},
+	"sealed-secrets": {
+		Name:    "sealed-secrets",
+		Version: "v0.18.1",
+		URL:     "https://github.com/bitnami-labs/sealed-secrets/releases/download/{{.Version}}/controller.yaml",
+	},
+	"external-secrets": {
+		Name:            "external-secrets",
+		Version:         "v0.5.9",
+		URL:             "https://github.com/external-secrets/external-secrets/releases/download/{{.Version}}/external-secrets.yaml",
+		ServerSideApply: true,
+	},
+	"kyverno": {
+		Name:            "kyverno",
+		Version:         "v1.7.3",
+		URL:             "https://github.com/kyverno/kyverno/releases/download/{{.Version}}/install.yaml",
+		ServerSideApply: true,
+	},
+	"gatekeeper": {
+		Name:    "gatekeeper",
+		Version: "v3.9.0",
+		URL:     "https://raw.githubusercontent.com/open-policy-agent/gatekeeper/{{.Version}}/deploy/gatekeeper.yaml",
+	},
+}
+
+// LoadCatalog reads the catalog from the given dir. An empty catalog is returned if there isn't one yet
+func LoadCatalog(dir string) (*Catalog, error) {
+	c := &Catalog{AddOns: []AddOn{}}
+
+	b, err := ioutil.ReadFile(dir + "/" + CatalogFile)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = yaml.Unmarshal(b, c)
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Save writes the catalog into the given dir
+func (c *Catalog) Save(dir string) error {
+	b, err := yaml.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(dir+"/"+CatalogFile, b, 0644)
+}
+
+// Get returns the add-on with the given name, or nil if it's not in the catalog
+func (c *Catalog) Get(name string) *AddOn {
+	for i := range c.AddOns {
+		if c.AddOns[i].Name == name {
+			return &c.AddOns[i]
+		}
+	}
+	return nil
+}
+
+// Set adds the add-on to the catalog, replacing the one with the same name if it's there
+func (c *Catalog) Set(a AddOn) {
+	if existing := c.Get(a.Name); existing != nil {
+		*existing = a
+		return
+	}
+	c.AddOns = append(c.AddOns, a)
+}
+
+// Remove removes the add-on with the given name from the catalog. Returns false if it wasn't there
+func (c *Catalog) Remove(name string) bool {
+	for i := range c.AddOns {
+		if c.AddOns[i].Name == name {
+			c.AddOns = append(c.AddOns[:i], c.AddOns[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Reconcile makes the add-on dirs under the cluster/core dir of baseDir match the catalog.
+// Each add-on gets its own dir so the GitOps controller picks it up like any other core component
+func Reconcile(baseDir string, c *Catalog) error {
+	coreDir := baseDir + "/cluster/core"
+
+	// Write out every add-on in the catalog
+	wanted := map[string]bool{}
+	for _, a := range c.AddOns {
+		dir := coreDir + "/" + addOnDirPrefix + a.Name
+		wanted[addOnDirPrefix+a.Name] = true
+
+		url, err := renderURL(a)
+		if err != nil {
+			return err
+		}
+
+		os.MkdirAll(dir, 0755)
+		addOnVars := struct {
+			URL             string
+			Namespace       string
+			Patches         []string
+			ServerSideApply bool
+		}{
+			URL:             url,
+			Namespace:       a.Namespace,
+			Patches:         []string{},
+			ServerSideApply: a.ServerSideApply,
+		}
+		if a.Service != nil && (a.Service.Type != "" || len(a.Service.Annotations) > 0) {
+			addOnVars.Patches = append(addOnVars.Patches, "service.yaml")
+		}
+		if len(a.Resources) > 0 {
+			addOnVars.Patches = append(addOnVars.Patches, "resources.yaml")
+		}
+		_, err = utils.WriteTemplate(templates.AddOnKustomizeFile, dir+"/"+"kustomization.yaml", addOnVars)
+		if err != nil {
+			return err
+		}
+
+		// The namespace has to be in the repo too, nothing else creates it
+		os.Remove(dir + "/" + "namespace.yaml")
+		if a.Namespace != "" {
+			_, err = utils.WriteTemplate(templates.AddOnNamespaceFile, dir+"/"+"namespace.yaml", addOnVars)
+			if err != nil {
+				return err
+			}
+		}
+
+		// So is what the Service needs on the provider the cluster runs on
+		os.Remove(dir + "/" + "service.yaml")
+		if a.Service != nil && (a.Service.Type != "" || len(a.Service.Annotations) > 0) {
+			_, err = utils.WriteTemplate(templates.AddOnServicePatchFile, dir+"/"+"service.yaml", a.Service)
+			if err != nil {
+				return err
+			}
+		}
+
+		// And the requests and limits of its workloads
+		os.Remove(dir + "/" + "resources.yaml")
+		if len(a.Resources) > 0 {
+			_, err = utils.WriteTemplate(templates.AddOnResourcesPatchFile, dir+"/"+"resources.yaml", a.Resources)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// Remove the dirs of add-ons that are no longer in the catalog
+	dirs, err := ioutil.ReadDir(coreDir)
+	if err != nil {
+		return err
+	}
+	for _, d := range dirs {
+		if d.IsDir() && strings.HasPrefix(d.Name(), addOnDirPrefix) && !wanted[d.Name()] {
+			log.Info("Removing add-on: ", strings.TrimPrefix(d.Name(), addOnDirPrefix))
+			err = os.RemoveAll(coreDir + "/" + d.Name())
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// If we're here, we should be okay
+	return nil
+}
+
+// Enable adds the add-ons GOKP knows about with the given names to the catalog in baseDir (keeping the version
+// of any that are already there) and makes the repo match it. This is used when the cluster is installed
+func Enable(baseDir string, names ...string) error {
+	versions := map[string]string{}
+	for _, name := range names {
+		versions[name] = ""
+	}
+	return EnableVersions(baseDir, "", versions)
+}
+
+// EnableVersions is Enable with the version of each add-on given, the one GOKP knows about if it's empty. Add-ons
+// reached through a Service are set up for the provider the cluster runs on
+func EnableVersions(baseDir string, provider string, versions map[string]string) error {
+	c, err := LoadCatalog(baseDir)
+	if err != nil {
+		return err
+	}
+
+	names := []string{}
+	for name := range versions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		a, ok := Available[name]
+		if !ok {
+			return errors.New("unknown add-on " + name)
+		}
+		if versions[name] != "" {
+			a.Version = versions[name]
+		}
+		a = ForProvider(a, provider)
+		if c.Get(name) == nil {
+			log.Info("Adding add-on: ", name, " ", a.Version)
+			c.Set(a)
+		}
+	}
+
+	err = c.Save(baseDir)
+	if err != nil {
+		return err
+	}
+
+	// If we're here, we should be okay
+	return Reconcile(baseDir, c)
+}
+
+// renderURL returns the URL of the add-on with the version filled in
+func renderURL(a AddOn) (string, error) {
+	tmpl, err := template.New(a.Name).Funcs(utils.TemplateFuncs).Parse(a.URL)
+	if err != nil {
+		return "", fmt.Errorf("bad url for add-on %s: %w", a.Name, err)
+	}
+
+	var b bytes.Buffer
+	err = tmpl.Execute(&b, a)
+	if err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
@@ -0,0 +1,94 @@
+package addons
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/christianh814/gokp/cmd/export"
+	"github.com/christianh814/gokp/cmd/templates"
+	"github.com/christianh814/gokp/cmd/utils"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// AutoscalerVersion is the version of cluster-autoscaler that's installed, which goes with the minor version of
+// Kubernetes the cluster runs
+var AutoscalerVersion string = "v1.24.0"
+
+// autoscalerDir is the dir under cluster/core cluster-autoscaler is kept in
+var autoscalerDir string = "cluster-autoscaler"
+
+// AutoscalerMinAnnotation and AutoscalerMaxAnnotation are how cluster-autoscaler knows a MachineDeployment is a node
+// group it scales, and between what sizes
+var (
+	AutoscalerMinAnnotation string = "cluster.x-k8s.io/cluster-api-autoscaler-node-group-min-size"
+	AutoscalerMaxAnnotation string = "cluster.x-k8s.io/cluster-api-autoscaler-node-group-max-size"
+)
+
+// Autoscaler is a cluster-autoscaler, in Cluster API mode, that keeps every MachineDeployment of the cluster
+// between Min and Max workers
+type Autoscaler struct {
+	Min int64
+	Max int64
+}
+
+// Validate makes sure the sizes make sense. cluster-autoscaler can only scale a MachineDeployment up from zero if
+// its machine template says how big the machines are, which not every provider does, so there's always a worker
+func (a Autoscaler) Validate() error {
+	if a.Min < 1 {
+		return errors.New("invalid autoscaler minimum " + strconv.FormatInt(a.Min, 10) + ", node pools can't be scaled from zero so it should be at least 1")
+	}
+	if a.Max < a.Min {
+		return errors.New("invalid autoscaler maximum " + strconv.FormatInt(a.Max, 10) + ", it should be at least the minimum of " + strconv.FormatInt(a.Min, 10))
+	}
+	return nil
+}
+
+// WriteAutoscaler writes cluster-autoscaler under the cluster/core dir of baseDir, so the GitOps controller deploys
+// it, and has it scale the MachineDeployments of the cluster that were exported there. cluster-autoscaler runs on the
+// cluster itself, which is where the Cluster API objects of the cluster are once it manages itself
+func WriteAutoscaler(baseDir string, clusterName string, a Autoscaler) error {
+	err := a.Validate()
+	if err != nil {
+		return err
+	}
+
+	dir := baseDir + "/cluster/core/" + autoscalerDir
+	os.MkdirAll(dir, 0755)
+	autoscalerVars := struct {
+		Version     string
+		ClusterName string
+	}{
+		Version:     AutoscalerVersion,
+		ClusterName: clusterName,
+	}
+	_, err = utils.WriteTemplate(templates.ClusterAutoscaler, dir+"/"+"cluster-autoscaler.yaml", autoscalerVars)
+	if err != nil {
+		return err
+	}
+	_, err = utils.WriteTemplate(templates.ClusterAutoscalerKustomize, dir+"/"+"kustomization.yaml", autoscalerVars)
+	if err != nil {
+		return err
+	}
+
+	// Nothing's exported when the cluster isn't created, like on a dry run
+	mds, err := filepath.Glob(baseDir + "/cluster/core/*/machinedeployment-*.yaml")
+	if err != nil || len(mds) == 0 {
+		return err
+	}
+
+	// cluster-autoscaler sets the replicas from now on, the GitOps controller would only set them back
+	_, err = export.UpdateExported(baseDir, "MachineDeployment", func(obj *unstructured.Unstructured) (bool, error) {
+		annotations := obj.GetAnnotations()
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[AutoscalerMinAnnotation] = strconv.FormatInt(a.Min, 10)
+		annotations[AutoscalerMaxAnnotation] = strconv.FormatInt(a.Max, 10)
+		obj.SetAnnotations(annotations)
+		unstructured.RemoveNestedField(obj.Object, "spec", "replicas")
+		return true, nil
+	})
+	return err
+}
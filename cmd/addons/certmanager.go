@@ -0,0 +1,47 @@
+package addons
+
+import (
+	"errors"
+	"os"
+
+	"github.com/christianh814/gokp/cmd/templates"
+	"github.com/christianh814/gokp/cmd/utils"
+)
+
+// LetsEncryptServer is the ACME directory of Let's Encrypt, and LetsEncryptStagingServer the one to test against
+// without running into its rate limits
+var (
+	LetsEncryptServer        string = "https://acme-v02.api.letsencrypt.org/directory"
+	LetsEncryptStagingServer string = "https://acme-staging-v02.api.letsencrypt.org/directory"
+)
+
+// issuerDir is the dir under cluster/core the ClusterIssuer is kept in, outside the dir of the cert-manager add-on
+// so Reconcile leaves it alone
+var issuerDir string = "cert-manager-issuer"
+
+// ACMEIssuer is a cert-manager ClusterIssuer that gets certificates from an ACME server, like Let's Encrypt, with
+// the HTTP-01 challenge. The challenge is answered through an Ingress of IngressClass, or of the default class if
+// it's empty
+type ACMEIssuer struct {
+	Name         string
+	Email        string
+	Server       string
+	IngressClass string
+}
+
+// WriteACMEIssuer writes the ClusterIssuer under the cluster/core dir of baseDir, so the GitOps controller creates it
+// once cert-manager is up
+func WriteACMEIssuer(baseDir string, issuer ACMEIssuer) error {
+	if issuer.Name == "" || issuer.Email == "" || issuer.Server == "" {
+		return errors.New("an ACME ClusterIssuer needs a name, an email, and a server")
+	}
+
+	dir := baseDir + "/cluster/core/" + issuerDir
+	os.MkdirAll(dir, 0755)
+	_, err := utils.WriteTemplate(templates.ACMEClusterIssuer, dir+"/"+"clusterissuer.yaml", issuer)
+	if err != nil {
+		return err
+	}
+	_, err = utils.WriteTemplate(templates.ACMEClusterIssuerKustomize, dir+"/"+"kustomization.yaml", nil)
+	return err
+}
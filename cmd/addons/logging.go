@@ -0,0 +1,71 @@
+package addons
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"github.com/christianh814/gokp/cmd/templates"
+	"github.com/christianh814/gokp/cmd/utils"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// LokiVersion is the version of Loki and Promtail the logging stack runs
+var LokiVersion string = "2.6.1"
+
+// loggingDir is the dir under cluster/core the logging stack is kept in
+var loggingDir string = "logging"
+
+// Logging is a Loki that keeps the logs of every pod for Retention (whole days), on a volume of StorageSize, with
+// Promtail on every node sending them to it
+type Logging struct {
+	Retention   string
+	StorageSize string
+}
+
+// Validate makes sure Loki takes the retention and the storage size is a quantity
+func (l Logging) Validate() error {
+	retention, err := time.ParseDuration(l.Retention)
+	if err != nil {
+		return errors.New("invalid logging retention " + l.Retention + ", it should look like 168h")
+	}
+	if retention <= 0 || retention%(24*time.Hour) != 0 {
+		return errors.New("invalid logging retention " + l.Retention + ", Loki only keeps logs for whole days (multiples of 24h)")
+	}
+	_, err = resource.ParseQuantity(l.StorageSize)
+	if err != nil {
+		return errors.New("invalid logging storage size " + l.StorageSize + ", it should look like 10Gi")
+	}
+	return nil
+}
+
+// WriteLogging writes the logging stack under the cluster/core dir of baseDir, so the GitOps controller deploys it.
+// The volume of Loki comes from the default StorageClass of the cluster
+func WriteLogging(baseDir string, l Logging) error {
+	err := l.Validate()
+	if err != nil {
+		return err
+	}
+
+	dir := baseDir + "/cluster/core/" + loggingDir
+	os.MkdirAll(dir, 0755)
+	loggingVars := struct {
+		Version     string
+		Retention   string
+		StorageSize string
+	}{
+		Version:     LokiVersion,
+		Retention:   l.Retention,
+		StorageSize: l.StorageSize,
+	}
+	_, err = utils.WriteTemplate(templates.Loki, dir+"/"+"loki.yaml", loggingVars)
+	if err != nil {
+		return err
+	}
+	_, err = utils.WriteTemplate(templates.Promtail, dir+"/"+"promtail.yaml", loggingVars)
+	if err != nil {
+		return err
+	}
+	_, err = utils.WriteTemplate(templates.LoggingKustomize, dir+"/"+"kustomization.yaml", loggingVars)
+	return err
+}
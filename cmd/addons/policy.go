@@ -0,0 +1,89 @@
+package addons
+
+import (
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/christianh814/gokp/cmd/templates"
+	"github.com/christianh814/gokp/cmd/utils"
+)
+
+// PolicyEngines are the add-ons that can enforce the baseline policies
+var PolicyEngines = []string{"kyverno", "gatekeeper"}
+
+// policyDir is the dir under cluster/core the baseline policies are kept in, outside the dir of the policy engine
+// so Reconcile leaves it alone
+var policyDir string = "baseline-policies"
+
+// policyEngineNamespaces are the namespaces the policy engines run in
+var policyEngineNamespaces = map[string]string{
+	"kyverno":    "kyverno",
+	"gatekeeper": "gatekeeper-system",
+}
+
+// PolicyExemptNamespaces are the namespaces the baseline policies leave alone: the ones of Kubernetes itself, the
+// CNIs, the GitOps controllers, and the add-ons GOKP installs, which need privileges or don't set limits
+var PolicyExemptNamespaces = []string{
+	"kube-system",
+	"kube-public",
+	"kube-node-lease",
+	"kube-flannel",
+	"tigera-operator",
+	"calico-system",
+	"flux-system",
+	"argo-rollouts",
+	"cert-manager",
+	"ingress-nginx",
+	"monitoring",
+	"logging",
+}
+
+// BaselinePolicies is the small set of policies that go with the policy engine: no privileged containers, and CPU
+// and memory requests plus a memory limit on every container. Without Enforce they're only reported (audited)
+type BaselinePolicies struct {
+	Engine           string
+	Enforce          bool
+	ExemptNamespaces []string
+}
+
+// WriteBaselinePolicies writes the policies for the engine under the cluster/core dir of baseDir, so the GitOps
+// controller creates them once the engine is up. The namespaces of Argo CD and of the engine are exempt too
+func WriteBaselinePolicies(baseDir string, p BaselinePolicies) error {
+	engineNamespace, ok := policyEngineNamespaces[p.Engine]
+	if !ok {
+		return errors.New("unknown policy engine " + p.Engine + " (use " + strings.Join(PolicyEngines, " or ") + ")")
+	}
+	p.ExemptNamespaces = append(append([]string{}, p.ExemptNamespaces...), templates.ArgoCDNamespace, engineNamespace)
+
+	dir := baseDir + "/cluster/core/" + policyDir
+	os.RemoveAll(dir)
+	os.MkdirAll(dir, 0755)
+
+	files := map[string]string{"policies.yaml": templates.KyvernoBaselinePolicies}
+	if p.Engine == "gatekeeper" {
+		// The constraints are of the kinds the templates create
+		files = map[string]string{
+			"constrainttemplates.yaml": templates.GatekeeperBaselineTemplates,
+			"constraints.yaml":         templates.GatekeeperBaselineConstraints,
+		}
+	}
+	kustomizeVars := struct {
+		Files []string
+	}{
+		Files: []string{},
+	}
+	for _, name := range []string{"policies.yaml", "constrainttemplates.yaml", "constraints.yaml"} {
+		tpl, ok := files[name]
+		if !ok {
+			continue
+		}
+		_, err := utils.WriteTemplate(tpl, dir+"/"+name, p)
+		if err != nil {
+			return err
+		}
+		kustomizeVars.Files = append(kustomizeVars.Files, name)
+	}
+	_, err := utils.WriteTemplate(templates.BaselinePoliciesKustomize, dir+"/"+"kustomization.yaml", kustomizeVars)
+	return err
+}
@@ -0,0 +1,51 @@
+package addons
+
+// providerServices are the type and annotations the Service of an add-on gets on each provider. Providers that
+// don't come with load balancers get a NodePort, the ones that do get what their load balancers need
+var providerServices = map[string]ServiceSettings{
+	"aws": {
+		Type: "LoadBalancer",
+		Annotations: map[string]string{
+			"service.beta.kubernetes.io/aws-load-balancer-type":                              "nlb",
+			"service.beta.kubernetes.io/aws-load-balancer-backend-protocol":                  "tcp",
+			"service.beta.kubernetes.io/aws-load-balancer-cross-zone-load-balancing-enabled": "true",
+		},
+	},
+	"azure": {
+		Type: "LoadBalancer",
+		Annotations: map[string]string{
+			"service.beta.kubernetes.io/azure-load-balancer-health-probe-request-path": "/healthz",
+		},
+	},
+	"oci": {
+		Type: "LoadBalancer",
+		Annotations: map[string]string{
+			"oci.oraclecloud.com/load-balancer-type": "nlb",
+		},
+	},
+	"linode":      {Type: "LoadBalancer"},
+	"ibmcloud":    {Type: "LoadBalancer"},
+	"byoh":        {Type: "NodePort"},
+	"metal3":      {Type: "NodePort"},
+	"proxmox":     {Type: "NodePort"},
+	"kubevirt":    {Type: "NodePort"},
+	"development": {Type: "NodePort"},
+}
+
+// ForProvider returns the add-on with its Service set up for the provider. Add-ons without a Service, and providers
+// GOKP doesn't know about (like adopted clusters), are left as they are
+func ForProvider(a AddOn, provider string) AddOn {
+	settings, ok := providerServices[provider]
+	if a.Service == nil || !ok {
+		return a
+	}
+
+	service := *a.Service
+	service.Type = settings.Type
+	service.Annotations = map[string]string{}
+	for k, v := range settings.Annotations {
+		service.Annotations[k] = v
+	}
+	a.Service = &service
+	return a
+}
@@ -0,0 +1,330 @@
+package cmd
+
+import (
+	"os"
+	"time"
+
+	"github.com/christianh814/gokp/cmd/argo"
+	"github.com/christianh814/gokp/cmd/capi"
+	"github.com/christianh814/gokp/cmd/export"
+	"github.com/christianh814/gokp/cmd/flux"
+	"github.com/christianh814/gokp/cmd/gitutils"
+	"github.com/christianh814/gokp/cmd/kubeconfig"
+	"github.com/christianh814/gokp/cmd/state"
+	"github.com/christianh814/gokp/cmd/templates"
+	"github.com/christianh814/gokp/cmd/utils"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// adoptClusterCmd represents the adopt-cluster command
+var adoptClusterCmd = &cobra.Command{
+	Use:     "adopt-cluster",
+	Aliases: []string{"adoptCluster"},
+	Short:   "Makes a cluster built elsewhere a GOKP cluster",
+	Long: `Makes an existing cluster, that wasn't installed by GOKP, GitOps ready. No
+cluster is created: the GitOps repo is created, the YAML of the cluster is
+exported to it, and the GitOps controller is bootstrapped on the cluster the
+same way it is for clusters GOKP installs. The cluster isn't managed by CAPI,
+so commands that change its machines (like scale or delete-cluster) don't work
+on it. For example:
+
+gokp adopt-cluster --cluster-name=mycluster \
+--github-token=githubtoken \
+--kubeconfig=~/.kube/config \
+--context=mycluster-admin \
+--private-repo=true`,
+	Annotations: map[string]string{clusterNameAnnotation: "new"},
+	Run: func(cmd *cobra.Command, args []string) {
+		err := checkResultOutputFlag(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = checkCreateAddOnFlags(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// create home dir
+		err = os.MkdirAll(os.Getenv("HOME")+"/.gokp", 0775)
+		if err != nil {
+			log.Fatal(err)
+		}
+		// Create workdir and set variables based on that
+		WorkDir, _ = utils.CreateWorkDir()
+		// cleanup workdir at the end
+		defer os.RemoveAll(WorkDir)
+
+		// Credentials that weren't given as flags come from the secret store
+		err = loadSecretFlags(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// Record what gets applied to the cluster
+		capi.AuditDir = WorkDir + "/audit"
+
+		// Grab repo related flags
+		ghToken, _ := cmd.Flags().GetString("github-token")
+		clusterName, _ := cmd.Flags().GetString("cluster-name")
+		privateRepo, _ := cmd.Flags().GetBool("private-repo")
+
+		// Grab the flags of the cluster to adopt
+		srcKubeconfig, _ := cmd.Flags().GetString("kubeconfig")
+		contextName, _ := cmd.Flags().GetString("context")
+
+		// Set GitOps Controller
+		gitOpsController, err := gitOpsEngine(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// Labels are recorded in the state so the cluster can be selected later
+		clusterLabels, _ := cmd.Flags().GetStringToString("labels")
+		err = state.ValidateLabels(clusterLabels)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// Set the requests/limits and PriorityClasses of the bootstrap components
+		err = setBootstrapResources(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// Write an exec based kubeconfig if requested
+		execKubeconfig, _ := cmd.Flags().GetBool("exec-kubeconfig")
+
+		CapiCfg := WorkDir + "/" + clusterName + ".kubeconfig"
+		gokpartifacts := os.Getenv("HOME") + "/.gokp/" + clusterName
+
+		// Run PreReq Checks
+		_, err = utils.CheckPreReqs(gokpartifacts, gitOpsController)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// Make sure we have what we need for the git provider
+		err = checkGitProviderFlags(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// The GitOps controller is installed on the cluster, which may be one that matters
+		err = checkGuardrails(cmd, srcKubeconfig, contextName, "adopt it as "+clusterName)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// Keep a copy of the kubeconfig of the cluster, like the ones GOKP writes for the clusters it installs
+		err = kubeconfig.Extract(srcKubeconfig, contextName, CapiCfg)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// Make sure we can talk to the cluster before creating anything
+		kubernetesVersion, err := serverVersion(CapiCfg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Info("Adopting cluster running Kubernetes ", kubernetesVersion)
+
+		// Create the GitOps repo
+		gitopsrepo, err := createGitOpsRepo(cmd, &clusterName, &privateRepo, WorkDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// Create repo dir structure based on which gitops controller that was chosen
+		if gitOpsController == "argocd" {
+			// Create repo dir structure. Including Argo CD install YAMLs and base YAMLs. Push initial dir structure out
+			_, err = templates.CreateArgoRepoSkel(&clusterName, WorkDir, ghToken, gitopsrepo, &privateRepo)
+			if err != nil {
+				log.Fatal(err)
+			}
+		} else if gitOpsController == "fluxcd" {
+			// Create repo dir structure. Including Flux CD install YAMLs and base YAMLs. Push initial dir structure out
+			_, err = templates.CreateFluxRepoSkel(&clusterName, WorkDir, ghToken, gitopsrepo, &privateRepo)
+			if err != nil {
+				log.Fatal(err)
+			}
+		} else {
+			log.Fatal("unknown gitops controller")
+		}
+
+		// Export/Create Cluster YAML to the Repo, Make sure kustomize is used for the core components
+		log.Info("Exporting Cluster YAML")
+		_, err = export.ExportClusterYaml(CapiCfg, gitutils.BaseDir(WorkDir+"/"+clusterName), gitOpsController)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// Add the add-ons that were asked for, they're deployed from the repo like everything else
+		err = enableCreateAddOns(cmd, gitutils.BaseDir(WorkDir+"/"+clusterName))
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// Git push newly exported YAML to GitOps repo
+		privateKeyFile := WorkDir + "/" + clusterName + "_rsa"
+		_, err = commitAndPush(WorkDir+"/"+clusterName, privateKeyFile, clusterName, "exporting existing YAML")
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// Create the sealing key before Sealed Secrets is deployed, so secrets can be sealed right away
+		err = setupSealedSecrets(cmd, clusterName, CapiCfg)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// The credentials of the ClusterSecretStore never go into the repo either
+		err = setupExternalSecrets(cmd, CapiCfg)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// Neither do the credentials of a repo that's talked to over HTTPS
+		err = setupRepoCredentials(gitOpsController, gitopsrepo, CapiCfg)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// Deplopy the GitOps controller that was chosen
+		argocdPassword := ""
+		if gitOpsController == "argocd" {
+			// Install Argo CD on the cluster with applications/applicationsets
+			log.Info("Deploying Argo CD GitOps Controller")
+			_, err = argo.BootstrapArgoCD(&clusterName, WorkDir, CapiCfg)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			// Get the admin password of Argo CD (rotating it if asked to)
+			argocdPassword, err = argoCDAdminPassword(cmd, CapiCfg)
+			if err != nil {
+				log.Fatal(err)
+			}
+		} else if gitOpsController == "fluxcd" {
+			// Install Flux CD on the cluster with all it's components
+			log.Info("Deploying Flux CD GitOps Controller")
+			_, err = flux.BootstrapFluxCD(&clusterName, WorkDir, CapiCfg)
+			if err != nil {
+				log.Fatal(err)
+			}
+		} else {
+			log.Fatal("unknown gitops controller")
+		}
+
+		// Move components to ~/.gokp/<clustername> and remove stuff you don't need to know.
+		err = os.Rename(WorkDir, gokpartifacts)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		notNeeded := []string{
+			"argocd-install-output",
+			"fluxcd-install-output",
+			"argocd-install.yaml",
+			"flux-install.yaml",
+		}
+
+		for _, notNeededthing := range notNeeded {
+			err = os.RemoveAll(gokpartifacts + "/" + notNeededthing)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		// Save what we know about the cluster for later commands
+		err = state.Save(gokpartifacts, &state.ClusterState{
+			Name:              clusterName,
+			Provider:          "adopted",
+			Labels:            clusterLabels,
+			KubernetesVersion: kubernetesVersion,
+			GitOpsController:  gitOpsController,
+			ArgoCDVersion:     argoCDVersion(gitOpsController),
+			ArgoCDHA:          templates.ArgoCDHA,
+			ArgoCDNamespace:   argoCDNamespace(gitOpsController),
+			GitOpsRepo:        gitopsrepo,
+			RepoPath:          gitutils.RepoPath,
+			RemoteName:        gitutils.RemoteName,
+			Branch:            gitutils.Branch,
+			CreatedAt:         time.Now(),
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// Keep the deploy key and kubeconfig in the secret store too
+		err = saveClusterSecrets(clusterName)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// Set up a kubeconfig that gets short lived credentials from gokp instead of carrying the client certificate
+		if execKubeconfig {
+			log.Info("Writing exec based kubeconfig")
+			err = kubeconfig.EnableExecAuth(gokpartifacts + "/" + clusterName + ".kubeconfig")
+			if err != nil {
+				log.Fatal(err)
+			}
+			err = kubeconfig.WriteExecKubeconfig(gokpartifacts+"/"+clusterName+".kubeconfig", clusterName, gokpartifacts+"/"+clusterName+"-exec.kubeconfig")
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		// Give info
+		err = reportClusterCreated(cmd, clusterName, "adopted", argocdPassword)
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(adoptClusterCmd)
+
+	addResultOutputFlag(adoptClusterCmd)
+
+	// GitOps Controller Flag
+	addGitOpsEngineFlags(adoptClusterCmd)
+	addBootstrapResourceFlags(adoptClusterCmd)
+	addCreateAddOnFlags(adoptClusterCmd)
+	adoptClusterCmd.Flags().StringToString("labels", nil, "Labels to record for the cluster (key=value), for selecting it with list-clusters.")
+	adoptClusterCmd.Flags().BoolP("exec-kubeconfig", "", false, "Also write a kubeconfig that gets short lived credentials from gokp instead of using the client certificate.")
+
+	// Repo specific flags
+	addGitProviderFlags(adoptClusterCmd)
+	adoptClusterCmd.Flags().String("cluster-name", "", "Name to give the cluster in GOKP.")
+	adoptClusterCmd.Flags().BoolP("private-repo", "", true, "Create a private repo.")
+
+	// Cluster specific flags
+	adoptClusterCmd.Flags().String("kubeconfig", "", "Path to the Kubeconfig file of the cluster to adopt.")
+	addGuardrailFlags(adoptClusterCmd)
+	adoptClusterCmd.Flags().String("context", "", "The context of the Kubeconfig file to use (defaults to the current one).")
+
+	// require the following flags
+	adoptClusterCmd.MarkFlagRequired("cluster-name")
+	adoptClusterCmd.MarkFlagRequired("kubeconfig")
+}
+
+// serverVersion returns the Kubernetes version of the cluster of the kubeconfig
+func serverVersion(kubeconfig string) (string, error) {
+	cfg, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return "", err
+	}
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return "", err
+	}
+	v, err := clientset.Discovery().ServerVersion()
+	if err != nil {
+		return "", err
+	}
+	return v.GitVersion, nil
+}
@@ -3,21 +3,34 @@ package argo
 import (
 	"context"
 	"errors"
+	"io/ioutil"
+	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/christianh814/gokp/cmd/capi"
+	"github.com/christianh814/gokp/cmd/clock"
+	"github.com/christianh814/gokp/cmd/gitutils"
+	"github.com/christianh814/gokp/cmd/sops"
 	"github.com/christianh814/gokp/cmd/utils"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/yaml"
 )
 
+// SkipBootstrapApps installs only Argo CD, leaving out the Applications/ApplicationSets that point it at the repo.
+// They can be applied later with EnableApps
+var SkipBootstrapApps bool = false
+
 // BootstrapArgoCD installs ArgoCD on a given cluster with the provided Kustomize-ed dir
 func BootstrapArgoCD(clustername *string, workdir string, capicfg string) (bool, error) {
 	// Set the repoDir path where things should be cloned.
 	// check if it exists
 	repoDir := workdir + "/" + *clustername
-	overlay := repoDir + "/cluster/bootstrap/overlays/default"
+	overlay := gitutils.BaseDir(repoDir) + "/cluster/bootstrap/overlays/default"
 	if _, err := os.Stat(repoDir); os.IsNotExist(err) {
 		return false, err
 	}
@@ -42,35 +55,164 @@ func BootstrapArgoCD(clustername *string, workdir string, capicfg string) (bool,
 		return false, err
 	}
 
+	// Argo CD can't decrypt the secrets of the overlay that were encrypted with SOPS, so they're left out of the
+	// kustomization and we apply them decrypted ourselves
+	secretYamls, err := sops.DecryptDir(overlay, workdir, workdir+"/"+"sops-output")
+	if err != nil {
+		return false, err
+	}
+	defer os.RemoveAll(workdir + "/" + "sops-output")
+	argoInstallYamls = append(argoInstallYamls, secretYamls...)
+
+	// Leave the apps out if we were asked to
+	if SkipBootstrapApps {
+		argoInstallYamls, err = filterBootstrapApps(argoInstallYamls, false)
+		if err != nil {
+			return false, err
+		}
+	}
+
 	// Set up a connection to the K8S cluster and apply these bad boys
 	capiInstallConfig, err := clientcmd.BuildConfigFromFlags("", capicfg)
 	if err != nil {
 		return false, err
 	}
 
-	// Loop until all are applied. Set a counter so we don't loop endlessly. Keep track of errors
-	counter := 0
-	for runs := 15; counter <= runs; counter++ {
-		// break if we've tried 15 times (aka 30 seconds)
-		if counter > runs {
-			return false, errors.New("failed to apply argo manifests")
-		}
-		// set the error count
+	err = applyYamls(capiInstallConfig, argoInstallYamls)
+	if err != nil {
+		return false, err
+	}
+
+	if SkipBootstrapApps {
+		log.Info("Skipped the Argo CD bootstrap apps, run \"gokp argocd enable-apps --cluster-name=" + *clustername + "\" to apply them")
+	}
+
+	return true, nil
+}
+
+// EnableApps applies the Applications/ApplicationSets of the repo that were left out when Argo CD was installed
+// with SkipBootstrapApps
+func EnableApps(repoDir string, capicfg string) error {
+	overlay := gitutils.BaseDir(repoDir) + "/cluster/bootstrap/overlays/default"
+	if _, err := os.Stat(overlay); os.IsNotExist(err) {
+		return errors.New("unable to find the Argo CD overlay under " + overlay)
+	}
+
+	workdir, err := utils.CreateWorkDir()
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(workdir)
+
+	// Render the same YAML that Argo CD was installed with, but only keep the apps
+	argocdyaml := workdir + "/" + "argocd-install.yaml"
+	_, err = utils.RunKustomize(overlay, argocdyaml)
+	if err != nil {
+		return err
+	}
+	err = utils.SplitYamls(workdir+"/"+"argocd-install-output", argocdyaml, "---")
+	if err != nil {
+		return err
+	}
+	argoInstallYamls, err := filepath.Glob(workdir + "/" + "argocd-install-output" + "/" + "*.yaml")
+	if err != nil {
+		return err
+	}
+	appYamls, err := filterBootstrapApps(argoInstallYamls, true)
+	if err != nil {
+		return err
+	}
+
+	capiInstallConfig, err := clientcmd.BuildConfigFromFlags("", capicfg)
+	if err != nil {
+		return err
+	}
+
+	return applyYamls(capiInstallConfig, appYamls)
+}
+
+// CheckVersion makes sure the Argo CD release (and the HA manifests of it if asked for) exists upstream before we
+// try to install it
+func CheckVersion(version string, ha bool) error {
+	if version != "stable" && !strings.HasPrefix(version, "v") {
+		return errors.New("Argo CD version must be a release tag (e.g. v2.4.7) or stable, got: " + version)
+	}
+
+	manifest := "install.yaml"
+	if ha {
+		manifest = "ha/install.yaml"
+	}
+
+	r, err := http.Head("https://raw.githubusercontent.com/argoproj/argo-cd/" + version + "/manifests/" + manifest)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+
+	if r.StatusCode != http.StatusOK {
+		return errors.New("Argo CD version " + version + " was not found upstream")
+	}
+
+	// If we're here, we should be okay
+	return nil
+}
+
+// ApplyWait is how often applyYamls goes through the YAMLs again while some of them fail, and how long it keeps at it
+var ApplyWait clock.Waiter = clock.Waiter{Interval: 5 * time.Second, Timeout: 5 * time.Minute}
+
+// applyYamls applies the YAMLs to the cluster. The Argo CD CRDs need time to be established before the CRs
+// can be applied, so it goes through them until all are applied
+func applyYamls(cfg *rest.Config, yamls []string) error {
+	var lastErr error
+	err := ApplyWait.Until(func() (bool, error) {
+		// Keep track of errors
 		errcount := 0
-		// loop through the YAMLS counting the errors
-		for _, argoInstallYaml := range argoInstallYamls {
-			err = capi.DoSSA(context.TODO(), capiInstallConfig, argoInstallYaml)
+		for _, yamlFile := range yamls {
+			err := capi.DoSSA(context.TODO(), cfg, yamlFile)
 			if err != nil {
 				errcount++
+				lastErr = err
 			}
-			// sleep and wait to apply the next one
-			time.Sleep(2 * time.Second)
 		}
-		// If no errors were found, break out of the loop
-		if errcount == 0 {
-			break
+		return errcount == 0, nil
+	})
+	if err == clock.ErrTimeout {
+		return errors.New("failed to apply argo manifests: " + lastErr.Error())
+	}
+	return err
+}
+
+// filterBootstrapApps returns only the YAMLs that are (apps is true) or aren't (apps is false) the
+// Applications/ApplicationSets that point Argo CD at the repo
+func filterBootstrapApps(yamls []string, apps bool) ([]string, error) {
+	filtered := []string{}
+	for _, yamlFile := range yamls {
+		isApp, err := isBootstrapApp(yamlFile)
+		if err != nil {
+			return nil, err
+		}
+		if isApp == apps {
+			filtered = append(filtered, yamlFile)
 		}
 	}
+	return filtered, nil
+}
 
-	return true, nil
+// isBootstrapApp returns true if the YAML is an Argo CD Application or ApplicationSet
+func isBootstrapApp(yamlFile string) (bool, error) {
+	b, err := ioutil.ReadFile(yamlFile)
+	if err != nil {
+		return false, err
+	}
+
+	obj := struct {
+		APIVersion string `json:"apiVersion"`
+		Kind       string `json:"kind"`
+	}{}
+	err = yaml.Unmarshal(b, &obj)
+	if err != nil {
+		return false, err
+	}
+
+	return strings.HasPrefix(obj.APIVersion, "argoproj.io/") && (obj.Kind == "Application" || obj.Kind == "ApplicationSet"), nil
 }
@@ -0,0 +1,113 @@
+package argo
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/christianh814/gokp/cmd/clock"
+	"github.com/christianh814/gokp/cmd/templates"
+	"golang.org/x/crypto/bcrypt"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// initialAdminSecret is the secret Argo CD puts the generated admin password in the first time it starts
+var initialAdminSecret string = "argocd-initial-admin-secret"
+
+// PasswordWait is how often AdminPassword checks for the initial admin secret, and how long it waits for Argo CD to
+// create it
+var PasswordWait clock.Waiter = clock.Waiter{Interval: 10 * time.Second, Timeout: 5 * time.Minute}
+
+// AdminPassword returns the initial admin password of Argo CD, waiting for Argo CD to generate it if it hasn't yet
+func AdminPassword(capicfg string) (string, error) {
+	clientset, err := newClientset(capicfg)
+	if err != nil {
+		return "", err
+	}
+
+	// Check to see if it's there, if not then wait and check again
+	password := ""
+	err = PasswordWait.Until(func() (bool, error) {
+		secret, err := clientset.CoreV1().Secrets(templates.ArgoCDNamespace).Get(context.TODO(), initialAdminSecret, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		password = string(secret.Data["password"])
+		return true, nil
+	})
+	if err != clock.ErrTimeout {
+		return password, err
+	}
+
+	return "", errors.New("Argo CD did not create " + initialAdminSecret + " in namespace " + templates.ArgoCDNamespace + " (was the admin password already changed?)")
+}
+
+// SetAdminPassword changes the admin password of Argo CD and removes the initial admin secret, since the
+// password in it no longer works
+func SetAdminPassword(capicfg string, password string) error {
+	clientset, err := newClientset(capicfg)
+	if err != nil {
+		return err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	// Argo CD keeps the bcrypt hash of the password in argocd-secret
+	patch, err := json.Marshal(map[string]interface{}{
+		"stringData": map[string]string{
+			"admin.password":      string(hash),
+			"admin.passwordMtime": time.Now().UTC().Format(time.RFC3339),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = clientset.CoreV1().Secrets(templates.ArgoCDNamespace).Patch(context.TODO(), "argocd-secret", types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return err
+	}
+
+	err = clientset.CoreV1().Secrets(templates.ArgoCDNamespace).Delete(context.TODO(), initialAdminSecret, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+
+	// If we're here, we should be okay
+	return nil
+}
+
+// GeneratePassword returns a random password of the given length
+func GeneratePassword(length int) (string, error) {
+	const chars = "abcdefghijkmnopqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	password := make([]byte, length)
+	for i := range password {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(chars))))
+		if err != nil {
+			return "", err
+		}
+		password[i] = chars[n.Int64()]
+	}
+	return string(password), nil
+}
+
+// newClientset returns a clientset for the kubeconfig
+func newClientset(kubeconfig string) (*kubernetes.Clientset, error) {
+	restConfig, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	return kubernetes.NewForConfig(restConfig)
+}
@@ -0,0 +1,55 @@
+package argo
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// RepoSecretName is the name of the secret Argo CD reads the credentials of the GitOps repo from
+var RepoSecretName string = "cluster-repo"
+
+// CreateRepoSecret puts the credentials of a repo that's talked to over HTTPS on the cluster, in the namespace of Argo
+// CD, before it's deployed. They aren't kept in the repo like the ssh key is, anyone who can read the repo could push
+// to it with them
+func CreateRepoSecret(capicfg string, namespace string, repoURL string, username string, password string) error {
+	cfg, err := clientcmd.BuildConfigFromFlags("", capicfg)
+	if err != nil {
+		return err
+	}
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	_, err = clientset.CoreV1().Namespaces().Create(context.TODO(), &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: namespace},
+	}, metav1.CreateOptions{})
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      RepoSecretName,
+			Namespace: namespace,
+			Labels:    map[string]string{"argocd.argoproj.io/secret-type": "repository"},
+		},
+		Type: corev1.SecretTypeOpaque,
+		StringData: map[string]string{
+			"type":     "git",
+			"url":      repoURL,
+			"username": username,
+			"password": password,
+		},
+	}
+	_, err = clientset.CoreV1().Secrets(namespace).Create(context.TODO(), secret, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		_, err = clientset.CoreV1().Secrets(namespace).Update(context.TODO(), secret, metav1.UpdateOptions{})
+	}
+	return err
+}
@@ -0,0 +1,138 @@
+package argo
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/christianh814/gokp/cmd/templates"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+)
+
+// PortForward forwards localPort to the port of a running argocd-server pod that the https port of the
+// argocd-server Service goes to, the way kubectl port-forward svc/argocd-server does. ready is closed once it's
+// listening, and it runs until stop is closed
+func PortForward(capicfg string, localPort int, ready chan struct{}, stop chan struct{}) error {
+	restConfig, err := clientcmd.BuildConfigFromFlags("", capicfg)
+	if err != nil {
+		return err
+	}
+	clientset, err := newClientset(capicfg)
+	if err != nil {
+		return err
+	}
+
+	svc, err := clientset.CoreV1().Services(templates.ArgoCDNamespace).Get(context.TODO(), serverService, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	pods, err := clientset.CoreV1().Pods(templates.ArgoCDNamespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(svc.Spec.Selector).String(),
+	})
+	if err != nil {
+		return err
+	}
+	var pod *corev1.Pod
+	for i := range pods.Items {
+		if pods.Items[i].Status.Phase == corev1.PodRunning {
+			pod = &pods.Items[i]
+			break
+		}
+	}
+	if pod == nil {
+		return errors.New("there's no running " + serverService + " pod in namespace " + templates.ArgoCDNamespace)
+	}
+
+	podPort, err := serverPodPort(svc, pod)
+	if err != nil {
+		return err
+	}
+
+	transport, upgrader, err := spdy.RoundTripperFor(restConfig)
+	if err != nil {
+		return err
+	}
+	req := clientset.CoreV1().RESTClient().Post().Resource("pods").Namespace(pod.Namespace).Name(pod.Name).SubResource("portforward")
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, req.URL())
+
+	fw, err := portforward.NewOnAddresses(dialer, []string{"localhost"}, []string{strconv.Itoa(localPort) + ":" + strconv.Itoa(podPort)}, stop, ready, ioutil.Discard, os.Stderr)
+	if err != nil {
+		return err
+	}
+	return fw.ForwardPorts()
+}
+
+// serverPodPort returns the port of the pod the https port (or the first port) of the Service goes to
+func serverPodPort(svc *corev1.Service, pod *corev1.Pod) (int, error) {
+	if len(svc.Spec.Ports) == 0 {
+		return 0, errors.New("the " + serverService + " Service has no ports")
+	}
+	port := svc.Spec.Ports[0]
+	for _, p := range svc.Spec.Ports {
+		if p.Name == "https" || p.Port == 443 {
+			port = p
+		}
+	}
+
+	if port.TargetPort.IntValue() != 0 {
+		return port.TargetPort.IntValue(), nil
+	}
+	if port.TargetPort.String() == "" || port.TargetPort.String() == "0" {
+		return int(port.Port), nil
+	}
+	// The target port is named after a port of the container
+	for _, c := range pod.Spec.Containers {
+		for _, p := range c.Ports {
+			if p.Name == port.TargetPort.String() {
+				return int(p.ContainerPort), nil
+			}
+		}
+	}
+
+	return 0, errors.New("the " + serverService + " pod has no port named " + port.TargetPort.String())
+}
+
+// InitialAdminPassword returns the initial admin password of Argo CD, or nothing if it was changed, without
+// waiting for it like AdminPassword does
+func InitialAdminPassword(capicfg string) (string, error) {
+	clientset, err := newClientset(capicfg)
+	if err != nil {
+		return "", err
+	}
+
+	secret, err := clientset.CoreV1().Secrets(templates.ArgoCDNamespace).Get(context.TODO(), initialAdminSecret, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(secret.Data["password"]), nil
+}
+
+// SSOEnabled returns if Argo CD logs in with an OIDC provider or Dex, going by argocd-cm
+func SSOEnabled(capicfg string) (bool, error) {
+	clientset, err := newClientset(capicfg)
+	if err != nil {
+		return false, err
+	}
+
+	cm, err := clientset.CoreV1().ConfigMaps(templates.ArgoCDNamespace).Get(context.TODO(), "argocd-cm", metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(cm.Data["oidc.config"]) != "" || strings.TrimSpace(cm.Data["dex.config"]) != "", nil
+}
@@ -0,0 +1,47 @@
+package argo
+
+import (
+	"context"
+
+	"github.com/christianh814/gokp/cmd/templates"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// serverService is the Service of the Argo CD API server and UI
+var serverService string = "argocd-server"
+
+// ServerURL returns the URL the Argo CD UI is reached at from outside of the cluster, going by how it was exposed.
+// It's empty if Argo CD is only reachable with a port-forward, or if its LoadBalancer has no address yet
+func ServerURL(capicfg string) (string, error) {
+	expose := templates.ArgoCDExpose
+	if expose == nil {
+		return "", nil
+	}
+
+	// TLS is terminated at the Ingress controller, if it was given a certificate
+	if expose.Type == "ingress" {
+		if expose.TLSSecret != "" {
+			return "https://" + expose.Host, nil
+		}
+		return "http://" + expose.Host, nil
+	}
+
+	clientset, err := newClientset(capicfg)
+	if err != nil {
+		return "", err
+	}
+	svc, err := clientset.CoreV1().Services(templates.ArgoCDNamespace).Get(context.TODO(), serverService, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	for _, ingress := range svc.Status.LoadBalancer.Ingress {
+		if ingress.Hostname != "" {
+			return "https://" + ingress.Hostname, nil
+		}
+		if ingress.IP != "" {
+			return "https://" + ingress.IP, nil
+		}
+	}
+
+	return "", nil
+}
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"github.com/christianh814/gokp/cmd/argo"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// argocdCmd represents the argocd command
+var argocdCmd = &cobra.Command{
+	Use:   "argocd",
+	Short: "Manages Argo CD on a cluster",
+	Long: `Manages the Argo CD that was bootstrapped on a cluster created with gokp.
+For example:
+
+gokp argocd enable-apps --cluster-name=mycluster
+gokp argocd admin-password --cluster-name=mycluster
+gokp argocd ui --cluster-name=mycluster`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(argocdCmd)
+}
+
+// argoCDAdminPassword returns the admin password of the Argo CD on the cluster. If --rotate-argocd-password was
+// given, the generated password is replaced first
+func argoCDAdminPassword(cmd *cobra.Command, kubeconfig string) (string, error) {
+	rotate, _ := cmd.Flags().GetBool("rotate-argocd-password")
+	password, _ := cmd.Flags().GetString("argocd-password")
+	if !rotate {
+		return argo.AdminPassword(kubeconfig)
+	}
+
+	if password == "" {
+		var err error
+		password, err = argo.GeneratePassword(24)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	log.Info("Rotating the Argo CD admin password")
+	err := argo.SetAdminPassword(kubeconfig, password)
+	if err != nil {
+		return "", err
+	}
+
+	return password, nil
+}
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/christianh814/gokp/cmd/state"
+	"github.com/christianh814/gokp/cmd/templates"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// argocdAdminPasswordCmd represents the argocd admin-password command
+var argocdAdminPasswordCmd = &cobra.Command{
+	Use:   "admin-password",
+	Short: "Prints or rotates the Argo CD admin password",
+	Long: `Prints the admin password of the Argo CD on a cluster that was created with
+gokp to stdout, so it can be piped into other tools. With --rotate-argocd-password, the
+password is replaced with --argocd-password (or a random one) first. For example:
+
+gokp argocd admin-password --cluster-name=mycluster
+gokp argocd admin-password --cluster-name=mycluster --rotate-argocd-password`,
+	Run: func(cmd *cobra.Command, args []string) {
+		// Grab flags
+		clusterName, _ := cmd.Flags().GetString("cluster-name")
+		CapiCfg, _ := cmd.Flags().GetString("kubeconfig")
+
+		// Default to the kubeconfig that was saved at install time
+		gokpartifacts := state.ArtifactsDir(clusterName)
+		if CapiCfg == "" {
+			var err error
+			CapiCfg, err = clusterSecretFile(clusterName, clusterName+".kubeconfig")
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		// Argo CD may not be in the default namespace
+		st, err := state.Load(gokpartifacts)
+		if err == nil && st.ArgoCDNamespace != "" {
+			templates.ArgoCDNamespace = st.ArgoCDNamespace
+		} else if err != nil && !os.IsNotExist(err) {
+			log.Fatal(err)
+		}
+
+		password, err := argoCDAdminPassword(cmd, CapiCfg)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Println(password)
+	},
+}
+
+func init() {
+	argocdCmd.AddCommand(argocdAdminPasswordCmd)
+
+	argocdAdminPasswordCmd.Flags().String("cluster-name", "", "Name of the gokp cluster.")
+	argocdAdminPasswordCmd.Flags().String("kubeconfig", "", "Kubeconfig of the cluster (defaults to the one saved at install time).")
+	argocdAdminPasswordCmd.Flags().Bool("rotate-argocd-password", false, "Replace the admin password with --argocd-password (or a random one).")
+	argocdAdminPasswordCmd.Flags().String("argocd-password", "", "Admin password to set with --rotate-argocd-password.")
+
+	argocdAdminPasswordCmd.MarkFlagRequired("cluster-name")
+}
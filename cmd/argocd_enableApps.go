@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"github.com/christianh814/gokp/cmd/argo"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// argocdEnableAppsCmd represents the argocd enable-apps command
+var argocdEnableAppsCmd = &cobra.Command{
+	Use:   "enable-apps",
+	Short: "Applies the Argo CD bootstrap apps",
+	Long: `Applies the Applications/ApplicationSets that point Argo CD at the GitOps
+repo of a cluster that was created with --skip-argocd-bootstrap-apps. They're
+rendered from the local clone of the repo under ~/.gokp/<cluster>/<cluster>.
+For example:
+
+gokp argocd enable-apps --cluster-name=mycluster`,
+	Run: func(cmd *cobra.Command, args []string) {
+		// Grab flags
+		clusterName, _ := cmd.Flags().GetString("cluster-name")
+		CapiCfg, _ := cmd.Flags().GetString("kubeconfig")
+
+		// Default to the kubeconfig that was saved at install time
+		if CapiCfg == "" {
+			var err error
+			CapiCfg, err = clusterSecretFile(clusterName, clusterName+".kubeconfig")
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		// Find the local clone of the repo
+		repoDir, _, err := openClusterRepo(clusterName)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		log.Info("Applying the Argo CD bootstrap apps to ", clusterName)
+		err = argo.EnableApps(repoDir, CapiCfg)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		log.Info("Argo CD is now syncing the GitOps repo of ", clusterName)
+	},
+}
+
+func init() {
+	argocdCmd.AddCommand(argocdEnableAppsCmd)
+
+	argocdEnableAppsCmd.Flags().String("cluster-name", "", "Name of the gokp cluster.")
+	argocdEnableAppsCmd.Flags().String("kubeconfig", "", "Kubeconfig of the cluster (defaults to the one saved at install time).")
+
+	argocdEnableAppsCmd.MarkFlagRequired("cluster-name")
+}
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	"github.com/christianh814/gokp/cmd/argo"
+	"github.com/christianh814/gokp/cmd/state"
+	"github.com/christianh814/gokp/cmd/templates"
+	"github.com/christianh814/gokp/cmd/utils"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// argocdUICmd represents the argocd ui command
+var argocdUICmd = &cobra.Command{
+	Use:   "ui",
+	Short: "Opens the Argo CD UI through a port-forward",
+	Long: `Port-forwards the argocd-server Service of a cluster that was created with gokp
+to localhost, with the kubeconfig that was saved at install time, prints how to
+log in, and opens the UI in the browser. It runs until it's stopped with
+Ctrl-C. For example:
+
+gokp argocd ui --cluster-name=mycluster
+gokp argocd ui --cluster-name=mycluster --port=9090 --no-browser`,
+	Run: func(cmd *cobra.Command, args []string) {
+		// Grab flags
+		clusterName, _ := cmd.Flags().GetString("cluster-name")
+		CapiCfg, _ := cmd.Flags().GetString("kubeconfig")
+		port, _ := cmd.Flags().GetInt("port")
+		noBrowser, _ := cmd.Flags().GetBool("no-browser")
+
+		// Default to the kubeconfig that was saved at install time
+		if CapiCfg == "" {
+			var err error
+			CapiCfg, err = clusterSecretFile(clusterName, clusterName+".kubeconfig")
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		// Argo CD may not be in the default namespace, and isn't there with Flux CD
+		st, err := state.Load(state.ArtifactsDir(clusterName))
+		if err == nil && st.GitOpsController == "fluxcd" {
+			log.Fatal(errors.New(clusterName + " uses Flux CD, it has no Argo CD UI"))
+		}
+		if err == nil && st.ArgoCDNamespace != "" {
+			templates.ArgoCDNamespace = st.ArgoCDNamespace
+		} else if err != nil && !os.IsNotExist(err) {
+			log.Fatal(err)
+		}
+
+		// Stop forwarding on Ctrl-C
+		ready := make(chan struct{})
+		stop := make(chan struct{})
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-signals
+			close(stop)
+		}()
+
+		errs := make(chan error, 1)
+		go func() {
+			errs <- argo.PortForward(CapiCfg, port, ready, stop)
+		}()
+		select {
+		case <-ready:
+		case err := <-errs:
+			log.Fatal(err)
+		}
+
+		// Say how to log in
+		url := "https://localhost:" + strconv.Itoa(port)
+		sso, err := argo.SSOEnabled(CapiCfg)
+		if err != nil {
+			log.Warn("Unable to tell if Argo CD uses SSO: ", err)
+		}
+		password, err := argo.InitialAdminPassword(CapiCfg)
+		if err != nil {
+			log.Warn("Unable to read the Argo CD admin password: ", err)
+		}
+		fmt.Println("Argo CD UI: " + url + " (its certificate is self signed)")
+		if sso {
+			fmt.Println("Log in with SSO, the admin user may be disabled")
+		}
+		if password != "" {
+			fmt.Println("Username:   admin")
+			fmt.Println("Password:   " + password)
+		} else if !sso {
+			fmt.Println("The initial admin password was changed, set a new one with: gokp argocd admin-password --cluster-name=" + clusterName + " --rotate-argocd-password")
+		}
+		fmt.Println("Press Ctrl-C to stop")
+
+		if !noBrowser {
+			err = utils.OpenBrowser(url)
+			if err != nil {
+				log.Warn("Unable to open the browser, go to ", url, ": ", err)
+			}
+		}
+
+		err = <-errs
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	argocdCmd.AddCommand(argocdUICmd)
+
+	argocdUICmd.Flags().String("cluster-name", "", "Name of the gokp cluster.")
+	argocdUICmd.Flags().String("kubeconfig", "", "Kubeconfig of the cluster (defaults to the one saved at install time).")
+	argocdUICmd.Flags().Int("port", 8080, "Local port to forward to Argo CD.")
+	argocdUICmd.Flags().Bool("no-browser", false, "Don't open the browser, only print the URL.")
+
+	argocdUICmd.MarkFlagRequired("cluster-name")
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"github.com/christianh814/gokp/cmd/capi"
+	"github.com/christianh814/gokp/cmd/state"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// awsCmd represents the aws command
+var awsCmd = &cobra.Command{
+	Use:   "aws",
+	Short: "Manages the AWS resources gokp clusters share",
+	Long: `Manages the AWS resources gokp clusters share, like the CloudFormation stack
+with the IAM roles and instance profiles CAPA uses. For example:
+
+gokp aws cleanup-iam --aws-region=us-east-1`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(awsCmd)
+}
+
+// awsStackUsers returns the state of the clusters, other than the one named, that use the CloudFormation stack
+func awsStackUsers(stackID string, except string) ([]*state.ClusterState, error) {
+	states, err := state.List()
+	if err != nil {
+		return nil, err
+	}
+
+	users := []*state.ClusterState{}
+	for _, s := range states {
+		if s.Name != except && s.AWSStack != nil && s.AWSStack.ID == stackID {
+			users = append(users, s)
+		}
+	}
+	return users, nil
+}
+
+// releaseAWSStack deletes the CloudFormation stack the cluster created, unless other clusters still use it. It's
+// handed over to one of them then, so it's deleted along with the last one
+func releaseAWSStack(clusterName string, stack *state.AWSStack, accessKey string, secretKey string) error {
+	users, err := awsStackUsers(stack.ID, clusterName)
+	if err != nil {
+		return err
+	}
+	if len(users) > 0 {
+		log.Info("Keeping CloudFormation stack ", stack.Name, ", ", users[0].Name, " still uses it")
+		users[0].AWSStack.Created = true
+		return state.Save(state.ArtifactsDir(users[0].Name), users[0])
+	}
+
+	return capi.DeleteAWSBootstrapStack(stack, accessKey, secretKey)
+}
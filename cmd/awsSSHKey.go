@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"github.com/christianh814/gokp/cmd/capi"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// awsSSHKeySecret returns the name the private key of a key pair GOKP created is kept under in the secret store.
+// Key pairs are per region, and can be shared by clusters, so it's not kept with a cluster
+func awsSSHKeySecret(region string, keyName string) string {
+	return "aws-ssh-key-" + region + "-" + keyName + ".pem"
+}
+
+// ensureAWSSSHKey makes sure the key pair the instances of the cluster are given exists before anything is created,
+// creating it if --aws-create-ssh-key was given. The private key of a key pair that's created is put in the secret
+// store
+func ensureAWSSSHKey(cmd *cobra.Command, clusterName string, region string, accessKey string, secretKey string, keyName string) error {
+	create, _ := cmd.Flags().GetBool("aws-create-ssh-key")
+	privateKey, err := capi.EnsureAWSSSHKey(region, accessKey, secretKey, keyName, clusterName, create)
+	if err != nil || privateKey == "" {
+		return err
+	}
+
+	store, err := secretStore()
+	if err != nil {
+		return err
+	}
+	err = store.Set(awsSSHKeySecret(region, keyName), privateKey)
+	if err != nil {
+		return err
+	}
+	log.Info("The private key of SSH key ", keyName, " is kept in the secret store as ", awsSSHKeySecret(region, keyName))
+	return nil
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/christianh814/gokp/cmd/capi"
+	"github.com/christianh814/gokp/cmd/state"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// awsCleanupIAMCmd represents the aws cleanup-iam command
+var awsCleanupIAMCmd = &cobra.Command{
+	Use:   "cleanup-iam",
+	Short: "Deletes the CloudFormation stack with the IAM resources of CAPA",
+	Long: `Deletes the CloudFormation stack the IAM roles, instance profiles, and
+policies CAPA uses on AWS were created with. delete-cluster deletes it along
+with the last cluster that uses it, this is for when that didn't happen (like
+when the stack was there before the clusters were, or deleting it failed).
+
+The clusters that use the stack are recorded in their state, and the stack
+isn't deleted while any of them is there, unless --force is given. For example:
+
+gokp aws cleanup-iam --aws-region=us-east-1`,
+	Run: func(cmd *cobra.Command, args []string) {
+		// Credentials that weren't given as flags come from the secret store
+		err := loadSecretFlags(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// Grab flags
+		awsRegion, _ := cmd.Flags().GetString("aws-region")
+		awsAccessKey, _ := cmd.Flags().GetString("aws-access-key")
+		awsSecretKey, _ := cmd.Flags().GetString("aws-secret-key")
+		force, _ := cmd.Flags().GetBool("force")
+
+		stack, err := capi.DescribeAWSBootstrapStack(awsRegion, awsAccessKey, awsSecretKey)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// The clusters that use it would lose their IAM roles
+		users, err := awsStackUsers(stack.ID, "")
+		if err != nil {
+			log.Fatal(err)
+		}
+		names := []string{}
+		for _, u := range users {
+			names = append(names, u.Name)
+		}
+		if len(users) > 0 && !force {
+			log.Fatal(errors.New("CloudFormation stack " + stack.Name + " is used by " + strings.Join(names, ", ") + ", use --force to delete it anyway"))
+		}
+
+		err = capi.DeleteAWSBootstrapStack(stack, awsAccessKey, awsSecretKey)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// The stack is gone, so it's not theirs anymore
+		for _, u := range users {
+			u.AWSStack = nil
+			err = state.Save(state.ArtifactsDir(u.Name), u)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		log.Info("CloudFormation stack ", stack.Name, " successfully deleted")
+	},
+}
+
+func init() {
+	awsCmd.AddCommand(awsCleanupIAMCmd)
+
+	awsCleanupIAMCmd.Flags().String("aws-region", "us-east-1", "Region the CloudFormation stack is in.")
+	awsCleanupIAMCmd.Flags().String("aws-access-key", "", "Your AWS Access Key (defaults to the secret store, then the AWS credential chain).")
+	awsCleanupIAMCmd.Flags().String("aws-secret-key", "", "Your AWS Secret Key (defaults to the secret store, then the AWS credential chain).")
+	awsCleanupIAMCmd.Flags().Bool("force", false, "Delete the stack even if clusters still use it.")
+}
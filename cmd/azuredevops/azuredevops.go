@@ -0,0 +1,69 @@
+package azuredevops
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/christianh814/gokp/cmd/gitutils"
+	"github.com/christianh814/gokp/cmd/restapi"
+	log "github.com/sirupsen/logrus"
+)
+
+// ApiURL is the Azure DevOps Services endpoint
+var ApiURL string = "https://dev.azure.com"
+
+// apiVersion is the Azure DevOps REST API version we use
+var apiVersion string = "6.0"
+
+// azdoProject is the subset of the Azure DevOps project object that we care about
+type azdoProject struct {
+	ID string `json:"id"`
+}
+
+// azdoRepo is the subset of the Azure DevOps repository object that we care about
+type azdoRepo struct {
+	RemoteURL string `json:"remoteUrl"`
+	SSHURL    string `json:"sshUrl"`
+}
+
+// CreateRepo creates a repository in the given Azure DevOps organization and project.
+// Azure DevOps has no per-repo deploy keys, so both the push and the GitOps controller use the PAT over HTTPS
+func CreateRepo(name *string, pat string, organization string, project string, workdir string) (bool, string, error) {
+	log.Info("Creating Azure DevOps repo for: ", *name)
+
+	// Get the ID of the project the repo will be created in
+	p := &azdoProject{}
+	err := doRequest(http.MethodGet, ApiURL+"/"+organization+"/_apis/projects/"+url.PathEscape(project), pat, nil, p)
+	if err != nil {
+		return false, "", err
+	}
+
+	// create the repo in the project. Repos are always private to the project
+	r := map[string]interface{}{
+		"name":    *name,
+		"project": map[string]string{"id": p.ID},
+	}
+	repo := &azdoRepo{}
+	err = doRequest(http.MethodPost, ApiURL+"/"+organization+"/"+url.PathEscape(project)+"/_apis/git/repositories", pat, r, repo)
+	if err != nil {
+		return false, "", err
+	}
+
+	// Azure DevOps doesn't initialize the repo for us, so we create it locally and set the remote
+	repoUrl := repo.RemoteURL
+	localRepo := workdir + "/" + *name
+	gitutils.SetHTTPCredentials(repoUrl, organization, pat)
+	err = gitutils.InitRepo(repoUrl, localRepo)
+	if err != nil {
+		return false, "", err
+	}
+
+	log.Info("Successfully created new repo: ", repoUrl)
+	return true, repoUrl, nil
+}
+
+// doRequest sends the body as JSON to the Azure DevOps API and decodes the response into out (if not nil). PATs are
+// sent as the password with an empty username
+func doRequest(method string, reqUrl string, pat string, body interface{}, out interface{}) error {
+	return restapi.Do("azure devops", method, reqUrl+"?api-version="+apiVersion, restapi.BasicAuth("", pat), body, out)
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"errors"
+
+	"github.com/christianh814/gokp/cmd/velero"
+	"github.com/spf13/cobra"
+)
+
+// addBackupFlags adds the flags for backing the cluster up to S3 with Velero
+func addBackupFlags(c *cobra.Command) {
+	c.Flags().Bool("enable-backups", false, "Install Velero, deployed from the GitOps repo, to back the cluster up to the S3 bucket of --backup-bucket on a schedule.")
+	c.Flags().String("backup-bucket", "", "S3 bucket the backups are kept in, under the name of the cluster. It's created if it doesn't exist.")
+	c.Flags().String("backup-schedule", "0 3 * * *", "Cron expression of when the cluster is backed up.")
+	c.Flags().String("backup-ttl", "720h", "How long each backup is kept for.")
+}
+
+// clusterBackups returns the backups the flags ask for, in the region of the cluster, or nil if there are none
+func clusterBackups(cmd *cobra.Command, region string) (*velero.Backups, error) {
+	enabled, _ := cmd.Flags().GetBool("enable-backups")
+	b := &velero.Backups{Region: region}
+	b.Bucket, _ = cmd.Flags().GetString("backup-bucket")
+	b.Schedule, _ = cmd.Flags().GetString("backup-schedule")
+	b.TTL, _ = cmd.Flags().GetString("backup-ttl")
+	if !enabled {
+		if b.Bucket != "" || cmd.Flags().Changed("backup-schedule") || cmd.Flags().Changed("backup-ttl") {
+			return nil, errors.New("--backup-bucket, --backup-schedule, and --backup-ttl need --enable-backups")
+		}
+		return nil, nil
+	}
+	if b.Bucket == "" {
+		return nil, errors.New("--enable-backups needs the --backup-bucket the backups are kept in")
+	}
+	return b, b.Validate()
+}
+
+// setupBackupCredentials creates the IAM user Velero uses, allowed to use the bucket and take EBS snapshots only,
+// and puts its access key in a Secret on the cluster of the kubeconfig. The key isn't kept anywhere else
+func setupBackupCredentials(clusterName string, b velero.Backups, kubeconfig string, accessKey string, secretKey string) error {
+	keyID, secret, err := velero.CreateAWSCredentials(clusterName, b, accessKey, secretKey)
+	if err != nil {
+		return err
+	}
+	return velero.CreateSecret(kubeconfig, keyID, secret)
+}
+
+// backupBucket returns the bucket of the backups, empty if there are none
+func backupBucket(b *velero.Backups) string {
+	if b == nil {
+		return ""
+	}
+	return b.Bucket
+}
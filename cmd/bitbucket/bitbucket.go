@@ -0,0 +1,103 @@
+package bitbucket
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/christianh814/gokp/cmd/gitutils"
+	"github.com/christianh814/gokp/cmd/restapi"
+	log "github.com/sirupsen/logrus"
+)
+
+// ApiURL is the Bitbucket Cloud API endpoint
+var ApiURL string = "https://api.bitbucket.org/2.0"
+
+// bitbucketRepo is the subset of the Bitbucket repository object that we care about
+type bitbucketRepo struct {
+	Links struct {
+		Clone []struct {
+			Name string `json:"name"`
+			Href string `json:"href"`
+		} `json:"clone"`
+	} `json:"links"`
+}
+
+// CreateRepo creates a repository in the given Bitbucket Cloud workspace (and project if one is given).
+// Bitbucket deploy keys are read-only, so the key is only used by the GitOps controller and
+// we push with the username/app password over HTTPS
+func CreateRepo(name *string, username string, appPassword string, workspace string, project string, private *bool, workdir string) (bool, string, error) {
+	log.Info("Creating Bitbucket repo for: ", *name)
+
+	// display if a private repo was requested
+	if *private {
+		log.Info("Private repo requested")
+	}
+
+	// create the repo with the options passed
+	r := map[string]interface{}{
+		"scm":         "git",
+		"is_private":  *private,
+		"description": "GitOps repo Cluster " + *name,
+		"mainbranch":  map[string]string{"name": gitutils.Branch},
+	}
+	if project != "" {
+		r["project"] = map[string]string{"key": project}
+	}
+	repo := &bitbucketRepo{}
+	err := doRequest(http.MethodPost, ApiURL+"/repositories/"+workspace+"/"+*name, username, appPassword, r, repo)
+	if err != nil {
+		return false, "", err
+	}
+
+	// Get the remote URLs. We push over HTTPS and the GitOps controller pulls over SSH
+	var sshUrl, httpsUrl string
+	for _, link := range repo.Links.Clone {
+		switch link.Name {
+		case "ssh":
+			sshUrl = link.Href
+		case "https":
+			httpsUrl = link.Href
+		}
+	}
+	if sshUrl == "" || httpsUrl == "" {
+		return false, "", fmt.Errorf("unable to find the clone urls for %s/%s", workspace, *name)
+	}
+
+	// Create an SSHKeypair for the repo.
+	publicKeyBytes, err := gitutils.GenerateSSHKeypair(*name, workdir)
+	if err != nil {
+		return false, "", err
+	}
+
+	// upload public sshkey as a deploy key
+	err = uploadDeployKey(publicKeyBytes, workspace, *name, username, appPassword)
+	if err != nil {
+		return false, "", err
+	}
+
+	// Bitbucket doesn't initialize the repo for us, so we create it locally and set the remote
+	localRepo := workdir + "/" + *name
+	gitutils.SetHTTPCredentials(httpsUrl, username, appPassword)
+	err = gitutils.InitRepo(httpsUrl, localRepo)
+	if err != nil {
+		return false, "", err
+	}
+
+	log.Info("Successfully created new repo: ", sshUrl)
+	return true, sshUrl, nil
+}
+
+// uploadDeployKey uploads deploykey to Bitbucket
+func uploadDeployKey(publicKeyBytes []byte, workspace string, name string, username string, appPassword string) error {
+	key := map[string]string{
+		"label": "gokp-" + name,
+		"key":   string(publicKeyBytes),
+	}
+
+	return doRequest(http.MethodPost, ApiURL+"/repositories/"+workspace+"/"+name+"/deploy-keys", username, appPassword, key, nil)
+}
+
+// doRequest sends the body as JSON to the Bitbucket API and decodes the response into out (if not nil)
+func doRequest(method string, url string, username string, appPassword string, body interface{}, out interface{}) error {
+	return restapi.Do("bitbucket", method, url, restapi.BasicAuth(username, appPassword), body, out)
+}
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"errors"
+
+	"github.com/christianh814/gokp/cmd/cni"
+	"github.com/christianh814/gokp/cmd/templates"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// addBootstrapResourceFlags adds the flags for the requests/limits and PriorityClasses of the bootstrap components
+func addBootstrapResourceFlags(c *cobra.Command) {
+	c.Flags().String("bootstrap-cpu-request", "100m", "CPU request of the Argo CD workloads.")
+	c.Flags().String("bootstrap-memory-request", "128Mi", "Memory request of the Argo CD workloads.")
+	c.Flags().String("bootstrap-memory-limit", "1Gi", "Memory limit of the Argo CD workloads (empty for none).")
+	c.Flags().String("bootstrap-priority-class", "system-cluster-critical", "PriorityClass of the Argo CD workloads (empty for none).")
+	c.Flags().Bool("skip-bootstrap-resources", false, "Leave the requests/limits and PriorityClasses of Argo CD and the CNI as they are upstream.")
+}
+
+// setBootstrapResources sets the requests/limits and PriorityClasses of the bootstrap components from the flags
+func setBootstrapResources(cmd *cobra.Command) error {
+	skip, _ := cmd.Flags().GetBool("skip-bootstrap-resources")
+	if skip {
+		templates.BootstrapResources = nil
+		cni.PriorityClasses = false
+		return nil
+	}
+
+	rc := &templates.ResourceConfig{}
+	rc.CPURequest, _ = cmd.Flags().GetString("bootstrap-cpu-request")
+	rc.MemoryRequest, _ = cmd.Flags().GetString("bootstrap-memory-request")
+	rc.MemoryLimit, _ = cmd.Flags().GetString("bootstrap-memory-limit")
+	rc.PriorityClass, _ = cmd.Flags().GetString("bootstrap-priority-class")
+
+	// Catch typos now instead of when kustomize or the API server trips over them
+	for flag, q := range map[string]string{
+		"bootstrap-cpu-request":    rc.CPURequest,
+		"bootstrap-memory-request": rc.MemoryRequest,
+		"bootstrap-memory-limit":   rc.MemoryLimit,
+	} {
+		if q == "" && flag == "bootstrap-memory-limit" {
+			continue
+		}
+		if _, err := resource.ParseQuantity(q); err != nil {
+			return errors.New("invalid --" + flag + " " + q + ": " + err.Error())
+		}
+	}
+
+	templates.BootstrapResources = rc
+	return nil
+}
@@ -0,0 +1,200 @@
+package byoh
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"sigs.k8s.io/yaml"
+)
+
+// HostsFile is the name of the file, under the cluster's artifact dir, that the hosts of a BYOH cluster are kept in
+var HostsFile string = "byoh-hosts.yaml"
+
+// AgentURL is where the BYOH host agent is downloaded from on the hosts
+var AgentURL string = "https://github.com/vmware-tanzu/cluster-api-provider-bringyourownhost/releases/download/v0.3.0/byoh-hostagent-linux-amd64"
+
+// agentUnit is the systemd unit the host agent runs as
+var agentUnit string = `[Unit]
+Description=BYOH host agent
+After=network-online.target
+
+[Service]
+ExecStart=/usr/local/bin/byoh-hostagent --kubeconfig /etc/byoh/kubeconfig --namespace default
+Restart=always
+
+[Install]
+WantedBy=multi-user.target
+`
+
+// installScript installs the packages kubeadm needs along with the host agent, and (re)starts the agent with the
+// kubeconfig it's given on stdin
+var installScript string = `set -e
+sudo mkdir -p /etc/byoh
+sudo tee /etc/byoh/kubeconfig > /dev/null
+sudo chmod 600 /etc/byoh/kubeconfig
+if command -v apt-get > /dev/null; then
+  sudo apt-get update -q && sudo apt-get install -yq socat ebtables ethtool conntrack
+fi
+if [ ! -x /usr/local/bin/byoh-hostagent ]; then
+  sudo curl -sSfL -o /usr/local/bin/byoh-hostagent '{{URL}}'
+  sudo chmod 755 /usr/local/bin/byoh-hostagent
+fi
+printf '%s' '{{UNIT}}' | sudo tee /etc/systemd/system/byoh-hostagent.service > /dev/null
+sudo systemctl daemon-reload
+sudo systemctl enable byoh-hostagent
+sudo systemctl restart byoh-hostagent
+`
+
+// resetScript takes a host back to how it was before it was added to the cluster
+var resetScript string = `sudo systemctl disable --now byoh-hostagent
+sudo kubeadm reset -f
+sudo rm -rf /etc/byoh /etc/systemd/system/byoh-hostagent.service /usr/local/bin/byoh-hostagent /etc/cni/net.d
+sudo systemctl daemon-reload
+`
+
+// Hosts are the machines a BYOH cluster is installed on, and how to SSH into them
+type Hosts struct {
+	Addresses             []string `json:"addresses"`
+	User                  string   `json:"user"`
+	Port                  int      `json:"port"`
+	SSHKey                string   `json:"sshKey"`
+	InsecureIgnoreHostKey bool     `json:"insecureIgnoreHostKey,omitempty"`
+}
+
+// ControlPlaneCount returns how many of the hosts are used for the control plane. It's HA if there are enough
+// hosts left over for 3 workers
+func (h *Hosts) ControlPlaneCount() int64 {
+	if len(h.Addresses) >= 6 {
+		return 3
+	}
+	return 1
+}
+
+// Save writes the hosts into the artifact dir of the cluster
+func (h *Hosts) Save(dir string) error {
+	b, err := yaml.Marshal(h)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(dir+"/"+HostsFile, b, 0644)
+}
+
+// LoadHosts reads the hosts of a cluster from its artifact dir
+func LoadHosts(dir string) (*Hosts, error) {
+	b, err := ioutil.ReadFile(dir + "/" + HostsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &Hosts{}
+	err = yaml.Unmarshal(b, h)
+	if err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// InstallAgent installs the host agent on every host, registering them with the cluster of the kubeconfig. Hosts
+// that already have the agent are moved over to the cluster, which is how they follow the CAPI objects on a move
+func (h *Hosts) InstallAgent(kubeconfig string) error {
+	b, err := ioutil.ReadFile(kubeconfig)
+	if err != nil {
+		return err
+	}
+	script := bytes.ReplaceAll([]byte(installScript), []byte("{{URL}}"), []byte(AgentURL))
+	script = bytes.ReplaceAll(script, []byte("{{UNIT}}"), []byte(agentUnit))
+
+	for _, address := range h.Addresses {
+		log.Info("Installing the BYOH host agent on ", address)
+		err = h.run(address, string(script), b)
+		if err != nil {
+			return errors.New("unable to install the host agent on " + address + ": " + err.Error())
+		}
+	}
+
+	// If we're here, we should be okay
+	return nil
+}
+
+// Reset removes kubeadm and the host agent from every host. Hosts that can't be reached are skipped, so the rest
+// still get cleaned up
+func (h *Hosts) Reset() error {
+	failed := []string{}
+	for _, address := range h.Addresses {
+		log.Info("Resetting ", address)
+		err := h.run(address, resetScript, nil)
+		if err != nil {
+			log.Warn("Unable to reset ", address, ": ", err)
+			failed = append(failed, address)
+		}
+	}
+	if len(failed) > 0 {
+		return errors.New("unable to reset " + strconv.Itoa(len(failed)) + " of the hosts")
+	}
+
+	// If we're here, we should be okay
+	return nil
+}
+
+// run runs the script on the host over SSH, with stdin as its input
+func (h *Hosts) run(address string, script string, stdin []byte) error {
+	cfg, err := h.clientConfig()
+	if err != nil {
+		return err
+	}
+	client, err := ssh.Dial("tcp", net.JoinHostPort(address, strconv.Itoa(h.Port)), cfg)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	session.Stdin = bytes.NewReader(stdin)
+	out, err := session.CombinedOutput(script)
+	if err != nil {
+		return errors.New(err.Error() + ": " + string(out))
+	}
+	return nil
+}
+
+// clientConfig returns the SSH config for the hosts. Host keys are checked against ~/.ssh/known_hosts unless told
+// otherwise
+func (h *Hosts) clientConfig() (*ssh.ClientConfig, error) {
+	key, err := ioutil.ReadFile(h.SSHKey)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	hostKeyCallback := ssh.InsecureIgnoreHostKey()
+	if !h.InsecureIgnoreHostKey {
+		hostKeyCallback, err = knownhosts.New(os.Getenv("HOME") + "/.ssh/known_hosts")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &ssh.ClientConfig{
+		User:            h.User,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         30 * time.Second,
+	}, nil
+}
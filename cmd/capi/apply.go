@@ -0,0 +1,101 @@
+package capi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/christianh814/gokp/cmd/clock"
+	log "github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/rest"
+)
+
+// MaxApplySize is the biggest object (in bytes) the API server takes in a single request
+var MaxApplySize int = 3 * 1024 * 1024
+
+// applyRetries is how many times an apply that failed with a retriable error is tried again
+var applyRetries int = 5
+
+// CRDWait is how often an object is applied again while the CRD it's of, which was just created, isn't established
+// yet, and for how long
+var CRDWait clock.Waiter = clock.Waiter{Interval: 2 * time.Second, Timeout: 30 * time.Second}
+
+// lastAppliedAnnotation is where client side apply keeps a copy of the whole object. Big objects (like the CRDs of
+// Argo CD or Cilium) don't fit in an annotation, which is why we only ever use server side apply
+var lastAppliedAnnotation string = "kubectl.kubernetes.io/last-applied-configuration"
+
+// applyData returns the object as JSON to server side apply, without anything that would make it bigger than it
+// needs to be or that the API server rejects in an apply
+func applyData(obj *unstructured.Unstructured) ([]byte, error) {
+	obj = obj.DeepCopy()
+
+	annotations := obj.GetAnnotations()
+	if _, ok := annotations[lastAppliedAnnotation]; ok {
+		delete(annotations, lastAppliedAnnotation)
+		obj.SetAnnotations(annotations)
+	}
+	obj.SetManagedFields(nil)
+	obj.SetResourceVersion("")
+	obj.SetUID("")
+	unstructured.RemoveNestedField(obj.Object, "metadata", "creationTimestamp")
+	unstructured.RemoveNestedField(obj.Object, "status")
+
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) > MaxApplySize {
+		return nil, errors.New(obj.GetKind() + " " + obj.GetName() + " is " + strconv.Itoa(len(data)) + " bytes, which is more than the " + strconv.Itoa(MaxApplySize) + " bytes the API server takes")
+	}
+
+	return data, nil
+}
+
+// retryApply runs the apply until it works or fails with an error that won't go away by trying again. Objects of
+// a CRD that was just created are rejected (422) until the API server has loaded its schema, and big objects can
+// time out while the API server is busy. An object that's too big (413) stays too big, so that fails right away
+func retryApply(name string, apply func() error) error {
+	var err error
+	backoff := time.Second
+	for i := 0; i <= applyRetries; i++ {
+		err = apply()
+		if apierrors.IsRequestEntityTooLargeError(err) {
+			return errors.New(name + " is too big for the API server to take: " + err.Error())
+		}
+		if err == nil || !retriableApplyError(err) || i == applyRetries {
+			return err
+		}
+		log.Debug("Retrying apply of ", name, ": ", err)
+		clock.Sleep(backoff)
+		backoff *= 2
+	}
+	return err
+}
+
+// applyOnceEstablished applies the YAML file, trying again while the CRD of the object isn't established yet
+func applyOnceEstablished(cfg *rest.Config, yamlFile string) error {
+	var applyErr error
+	err := CRDWait.Until(func() (bool, error) {
+		applyErr = DoSSA(context.TODO(), cfg, yamlFile)
+		return applyErr == nil, nil
+	})
+	if err == clock.ErrTimeout {
+		return applyErr
+	}
+	return err
+}
+
+// retriableApplyError returns true if the apply may work if it's tried again
+func retriableApplyError(err error) bool {
+	return apierrors.IsInvalid(err) ||
+		apierrors.IsTooManyRequests(err) ||
+		apierrors.IsServerTimeout(err) ||
+		apierrors.IsTimeout(err) ||
+		apierrors.IsInternalError(err) ||
+		apierrors.IsServiceUnavailable(err)
+}
@@ -0,0 +1,317 @@
+package capi
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/christianh814/gokp/cmd/clock"
+	"github.com/christianh814/gokp/cmd/templates"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/yaml"
+)
+
+// fakeClock sleeps without waiting, and keeps how long it was asked to
+type fakeClock struct {
+	now   time.Time
+	slept []time.Duration
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Sleep(d time.Duration) {
+	c.slept = append(c.slept, d)
+	c.now = c.now.Add(d)
+}
+
+// testObject returns a ConfigMap like one read back from the API server, with what it adds to the objects it has
+func testObject() *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name":              "test",
+			"namespace":         "default",
+			"resourceVersion":   "1234",
+			"uid":               "0b9a4c1e-5d3b-4f0e-9d5a-2a8f1c3e7b6d",
+			"creationTimestamp": "2022-09-01T00:00:00Z",
+			"annotations": map[string]interface{}{
+				lastAppliedAnnotation: `{"apiVersion":"v1","kind":"ConfigMap"}`,
+				"gokp.io/keep":        "true",
+			},
+			"managedFields": []interface{}{
+				map[string]interface{}{"manager": "kubectl", "operation": "Apply"},
+			},
+		},
+		"data": map[string]interface{}{
+			"key": "value",
+		},
+		"status": map[string]interface{}{
+			"phase": "Active",
+		},
+	}}
+}
+
+func TestApplyData(t *testing.T) {
+	obj := testObject()
+	data, err := applyData(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	applied := &unstructured.Unstructured{}
+	err = json.Unmarshal(data, &applied.Object)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := applied.GetAnnotations()[lastAppliedAnnotation]; ok {
+		t.Errorf("the %s annotation wasn't stripped", lastAppliedAnnotation)
+	}
+	if applied.GetAnnotations()["gokp.io/keep"] != "true" {
+		t.Errorf("the other annotations weren't kept: %v", applied.GetAnnotations())
+	}
+	if applied.GetManagedFields() != nil {
+		t.Errorf("managedFields weren't stripped: %v", applied.GetManagedFields())
+	}
+	for _, f := range [][]string{
+		{"status"},
+		{"metadata", "resourceVersion"},
+		{"metadata", "uid"},
+		{"metadata", "creationTimestamp"},
+	} {
+		if _, ok, _ := unstructured.NestedFieldNoCopy(applied.Object, f...); ok {
+			t.Errorf("%s wasn't stripped", strings.Join(f, "."))
+		}
+	}
+	if v, _, _ := unstructured.NestedString(applied.Object, "data", "key"); v != "value" {
+		t.Errorf("data wasn't kept: %v", applied.Object["data"])
+	}
+
+	// The object that's given is left alone
+	if _, ok := obj.GetAnnotations()[lastAppliedAnnotation]; !ok || obj.GetManagedFields() == nil || obj.Object["status"] == nil {
+		t.Errorf("applyData changed the object it was given: %v", obj.Object)
+	}
+}
+
+func TestApplyDataSizeLimit(t *testing.T) {
+	defer func(max int) { MaxApplySize = max }(MaxApplySize)
+
+	tests := []struct {
+		name    string
+		size    int
+		max     int
+		wantErr string
+	}{
+		{name: "small", size: 10, max: 1024},
+		{name: "the last-applied annotation doesn't count", size: 2048, max: 1024},
+		{name: "too big", size: 2048, max: 1024, wantErr: "ConfigMap test is "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			MaxApplySize = tt.max
+			obj := testObject()
+			value := strings.Repeat("x", tt.size)
+			if tt.wantErr == "" {
+				obj.SetAnnotations(map[string]string{lastAppliedAnnotation: value})
+			} else {
+				unstructured.SetNestedField(obj.Object, value, "data", "key")
+			}
+
+			_, err := applyData(obj)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("applyData() failed: %s", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.HasPrefix(err.Error(), tt.wantErr)) {
+				t.Fatalf("applyData() got error %v, want one starting with %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestApplyDataLargeCRDs applies the CRDs of the Flux install that's embedded in the templates, the biggest ones we
+// ship, the way a client side apply would have left them on the cluster: with a copy of the whole CRD in the
+// last-applied annotation
+func TestApplyDataLargeCRDs(t *testing.T) {
+	crds := 0
+	for _, doc := range strings.Split(templates.FluxInstallFile, "\n---\n") {
+		obj := &unstructured.Unstructured{}
+		err := yaml.Unmarshal([]byte(doc), &obj.Object)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if obj.GetKind() != "CustomResourceDefinition" {
+			continue
+		}
+		crds++
+
+		t.Run(obj.GetName(), func(t *testing.T) {
+			want, err := applyData(obj)
+			if err != nil {
+				t.Fatalf("applyData() failed: %s", err)
+			}
+
+			lastApplied, err := json.Marshal(obj.Object)
+			if err != nil {
+				t.Fatal(err)
+			}
+			applied := obj.DeepCopy()
+			annotations := applied.GetAnnotations()
+			if annotations == nil {
+				annotations = map[string]string{}
+			}
+			annotations[lastAppliedAnnotation] = string(lastApplied)
+			applied.SetAnnotations(annotations)
+
+			got, err := applyData(applied)
+			if err != nil {
+				t.Fatalf("applyData() failed with the last-applied annotation: %s", err)
+			}
+			if string(got) != string(want) {
+				t.Fatalf("applyData() with the last-applied annotation got %d bytes, want the %d bytes of the CRD", len(got), len(want))
+			}
+			if len(got) > MaxApplySize {
+				t.Fatalf("%s is %d bytes, more than MaxApplySize", obj.GetName(), len(got))
+			}
+		})
+	}
+
+	// All of them, not none because the manifest couldn't be split up
+	if crds != 9 {
+		t.Fatalf("found %d CRDs in the Flux install, want 9", crds)
+	}
+}
+
+// TestApplyDataCRDOverAnnotationLimit applies the biggest embedded CRD with a last-applied annotation that takes it
+// over the limit of the API server. Without stripping it, it couldn't be applied at all
+func TestApplyDataCRDOverAnnotationLimit(t *testing.T) {
+	defer func(max int) { MaxApplySize = max }(MaxApplySize)
+
+	var biggest *unstructured.Unstructured
+	var biggestData []byte
+	for _, doc := range strings.Split(templates.FluxInstallFile, "\n---\n") {
+		obj := &unstructured.Unstructured{}
+		err := yaml.Unmarshal([]byte(doc), &obj.Object)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if obj.GetKind() != "CustomResourceDefinition" {
+			continue
+		}
+		data, err := json.Marshal(obj.Object)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) > len(biggestData) {
+			biggest, biggestData = obj, data
+		}
+	}
+	if biggest.GetName() != "kustomizations.kustomize.toolkit.fluxcd.io" {
+		t.Fatalf("the biggest CRD is %s, want kustomizations.kustomize.toolkit.fluxcd.io", biggest.GetName())
+	}
+
+	// The CRD fits, the CRD with a copy of itself doesn't
+	MaxApplySize = len(biggestData) + len(biggestData)/2
+	biggest.SetAnnotations(map[string]string{lastAppliedAnnotation: string(biggestData)})
+	annotated, err := json.Marshal(biggest.Object)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(annotated) <= MaxApplySize {
+		t.Fatalf("%s with its last-applied annotation is %d bytes, want more than %d", biggest.GetName(), len(annotated), MaxApplySize)
+	}
+	data, err := applyData(biggest)
+	if err != nil {
+		t.Fatalf("applyData() failed: %s", err)
+	}
+	if len(data) > MaxApplySize {
+		t.Fatalf("applyData() got %d bytes, more than the %d bytes it's limited to", len(data), MaxApplySize)
+	}
+}
+
+func TestRetriableApplyError(t *testing.T) {
+	gr := schema.GroupResource{Resource: "configmaps"}
+	gk := schema.GroupKind{Kind: "ConfigMap"}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "too large", err: apierrors.NewRequestEntityTooLargeError("limit is 3145728"), want: false},
+		{name: "invalid", err: apierrors.NewInvalid(gk, "test", field.ErrorList{}), want: true},
+		{name: "too many requests", err: apierrors.NewTooManyRequests("slow down", 1), want: true},
+		{name: "server timeout", err: apierrors.NewServerTimeout(gr, "patch", 1), want: true},
+		{name: "timeout", err: apierrors.NewTimeoutError("timed out", 1), want: true},
+		{name: "internal error", err: apierrors.NewInternalError(errors.New("etcd")), want: true},
+		{name: "service unavailable", err: apierrors.NewServiceUnavailable("starting"), want: true},
+		{name: "not found", err: apierrors.NewNotFound(gr, "test"), want: false},
+		{name: "forbidden", err: apierrors.NewForbidden(gr, "test", errors.New("rbac")), want: false},
+		{name: "conflict", err: apierrors.NewConflict(gr, "test", errors.New("field manager")), want: false},
+		{name: "bad request", err: apierrors.NewBadRequest("bad"), want: false},
+		{name: "not an API error", err: errors.New("connection refused"), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retriableApplyError(tt.err); got != tt.want {
+				t.Fatalf("retriableApplyError(%v) got %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryApply(t *testing.T) {
+	defer func(c clock.Clock) { clock.Default = c }(clock.Default)
+
+	tests := []struct {
+		name          string
+		errs          []error
+		wantCalls     int
+		wantErr       bool
+		wantErrPrefix string
+	}{
+		{name: "works", errs: []error{nil}, wantCalls: 1},
+		{name: "works once retried", errs: []error{apierrors.NewServiceUnavailable("starting"), nil}, wantCalls: 2},
+		{name: "not retriable", errs: []error{apierrors.NewNotFound(schema.GroupResource{}, "test")}, wantCalls: 1, wantErr: true},
+		{name: "gives up", errs: []error{apierrors.NewServiceUnavailable("starting")}, wantCalls: applyRetries + 1, wantErr: true},
+		{name: "too large", errs: []error{apierrors.NewRequestEntityTooLargeError("limit is 3145728")}, wantCalls: 1, wantErr: true, wantErrPrefix: "ConfigMap test is too big for the API server to take: "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &fakeClock{}
+			clock.Default = c
+
+			calls := 0
+			err := retryApply("ConfigMap test", func() error {
+				err := tt.errs[len(tt.errs)-1]
+				if calls < len(tt.errs) {
+					err = tt.errs[calls]
+				}
+				calls++
+				return err
+			})
+			if calls != tt.wantCalls {
+				t.Errorf("applied %d times, want %d", calls, tt.wantCalls)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("retryApply() got error %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErrPrefix != "" && (err == nil || !strings.HasPrefix(err.Error(), tt.wantErrPrefix)) {
+				t.Errorf("retryApply() got error %v, want one starting with %q", err, tt.wantErrPrefix)
+			}
+			if len(c.slept) != tt.wantCalls-1 {
+				t.Errorf("slept %v, want once between each apply", c.slept)
+			}
+		})
+	}
+}
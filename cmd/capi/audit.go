@@ -0,0 +1,141 @@
+package capi
+
+import (
+	"os"
+	"sync"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// AuditDir is where the diffs of everything DoSSA applies are recorded. Nothing is recorded if empty
+var AuditDir string = ""
+
+// AuditFile is the file (in AuditDir) the diffs are appended to
+var AuditFile string = "applied-manifests.diff"
+
+// auditLock makes sure diffs of applies that happen at the same time don't get mixed up
+var auditLock sync.Mutex
+
+// recordDiff appends the diff between the object before and after it was applied to the audit file.
+// The before object is nil if the object was created
+func recordDiff(before *unstructured.Unstructured, after *unstructured.Unstructured) error {
+	before, after = maskSecrets(before, after)
+	beforeYaml, err := auditYaml(before)
+	if err != nil {
+		return err
+	}
+	afterYaml, err := auditYaml(after)
+	if err != nil {
+		return err
+	}
+
+	// Like "kubectl diff", the file names tell you what the object is
+	name := after.GetKind() + "/" + after.GetName()
+	if after.GetNamespace() != "" {
+		name = after.GetKind() + "/" + after.GetNamespace() + "/" + after.GetName()
+	}
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(beforeYaml),
+		B:        difflib.SplitLines(afterYaml),
+		FromFile: "live/" + name,
+		ToFile:   "applied/" + name,
+		Context:  3,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Nothing changed, nothing to record
+	if diff == "" {
+		return nil
+	}
+
+	auditLock.Lock()
+	defer auditLock.Unlock()
+	err = os.MkdirAll(AuditDir, 0700)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(AuditDir+"/"+AuditFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// An install that's resumed may have an audit file from before it was kept private
+	err = f.Chmod(0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.WriteString(diff)
+	return err
+}
+
+// auditYaml returns the object as YAML without the fields that only add noise to a diff
+func auditYaml(obj *unstructured.Unstructured) (string, error) {
+	if obj == nil {
+		return "", nil
+	}
+
+	o := obj.DeepCopy()
+	unstructured.RemoveNestedField(o.Object, "metadata", "managedFields")
+	unstructured.RemoveNestedField(o.Object, "metadata", "resourceVersion")
+	unstructured.RemoveNestedField(o.Object, "metadata", "generation")
+
+	b, err := yaml.Marshal(o.Object)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// maskSecrets returns copies of the objects with the values of a Secret masked, the way "kubectl diff" does it. A
+// value is "***" on both sides if it didn't change, and "*** (before)" and "*** (after)" if it did, so the diff still
+// shows what changed without the audit file holding the credentials of the repo or anything else
+func maskSecrets(before *unstructured.Unstructured, after *unstructured.Unstructured) (*unstructured.Unstructured, *unstructured.Unstructured) {
+	if after == nil || after.GetKind() != "Secret" || after.GroupVersionKind().Group != "" {
+		return before, after
+	}
+	after = after.DeepCopy()
+	if before != nil {
+		before = before.DeepCopy()
+	}
+
+	for _, field := range []string{"data", "stringData"} {
+		afterValues, _, _ := unstructured.NestedMap(after.Object, field)
+		beforeValues := map[string]interface{}{}
+		if before != nil {
+			beforeValues, _, _ = unstructured.NestedMap(before.Object, field)
+		}
+
+		for k, v := range afterValues {
+			b, ok := beforeValues[k]
+			if ok && b != v {
+				beforeValues[k] = "*** (before)"
+				afterValues[k] = "*** (after)"
+				continue
+			}
+			if ok {
+				beforeValues[k] = "***"
+			}
+			afterValues[k] = "***"
+		}
+		for k := range beforeValues {
+			if _, ok := afterValues[k]; !ok {
+				beforeValues[k] = "***"
+			}
+		}
+
+		if len(afterValues) > 0 {
+			unstructured.SetNestedMap(after.Object, afterValues, field)
+		}
+		if before != nil && len(beforeValues) > 0 {
+			unstructured.SetNestedMap(before.Object, beforeValues, field)
+		}
+	}
+
+	return before, after
+}
@@ -0,0 +1,143 @@
+package capi
+
+import (
+	"errors"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/outposts"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// AWSPlacement is where the nodes of an AWS cluster go. If nil, CAPA creates a VPC of its own and spreads the
+// nodes over the zones of the region
+var AWSPlacement *AWSPlacementConfig
+
+// AWSPlacementConfig puts the cluster in an existing VPC and the worker nodes in a subnet of their own, like one
+// in a Local Zone or on an Outpost
+type AWSPlacementConfig struct {
+	// VPCID and Subnets are the existing VPC and the (regular) subnets of it for the control plane and load balancer
+	VPCID   string
+	Subnets []string
+	// NodeSubnet is where the worker nodes go. NodeZone is filled in from it if empty
+	NodeSubnet string
+	NodeZone   string
+	// NodeOutpostARN is filled in if NodeSubnet is on an Outpost
+	NodeOutpostARN string
+}
+
+// ValidateAWSPlacement makes sure the worker subnet is in the VPC and zone given, that the zone can be used, and
+// that the worker instance type is offered there. NodeZone and NodeOutpostARN are filled in from the subnet
+func ValidateAWSPlacement(p *AWSPlacementConfig, region string, accessKey string, secretKey string, instanceType string) error {
+	sess, err := newAWSSession(region, accessKey, secretKey)
+	if err != nil {
+		return err
+	}
+	svc := ec2.New(sess)
+
+	// Find out where the worker subnet is
+	subnets, err := svc.DescribeSubnets(&ec2.DescribeSubnetsInput{SubnetIds: aws.StringSlice([]string{p.NodeSubnet})})
+	if err != nil {
+		return err
+	}
+	if len(subnets.Subnets) == 0 {
+		return errors.New("subnet " + p.NodeSubnet + " not found in " + region)
+	}
+	subnet := subnets.Subnets[0]
+	if p.VPCID != "" && aws.StringValue(subnet.VpcId) != p.VPCID {
+		return errors.New("subnet " + p.NodeSubnet + " is not in VPC " + p.VPCID)
+	}
+	if p.NodeZone != "" && aws.StringValue(subnet.AvailabilityZone) != p.NodeZone {
+		return errors.New("subnet " + p.NodeSubnet + " is in " + aws.StringValue(subnet.AvailabilityZone) + ", not " + p.NodeZone)
+	}
+	p.NodeZone = aws.StringValue(subnet.AvailabilityZone)
+	p.NodeOutpostARN = aws.StringValue(subnet.OutpostArn)
+
+	// Outposts only run the instance types they were ordered with
+	if p.NodeOutpostARN != "" {
+		log.Info("Worker nodes go on Outpost ", p.NodeOutpostARN)
+		return checkOutpostInstanceType(sess, p.NodeOutpostARN, instanceType)
+	}
+
+	// Local Zones have to be opted in to before they can be used
+	zones, err := svc.DescribeAvailabilityZones(&ec2.DescribeAvailabilityZonesInput{
+		AllAvailabilityZones: aws.Bool(true),
+		ZoneNames:            aws.StringSlice([]string{p.NodeZone}),
+	})
+	if err != nil {
+		return err
+	}
+	for _, z := range zones.AvailabilityZones {
+		if aws.StringValue(z.OptInStatus) == ec2.AvailabilityZoneOptInStatusNotOptedIn {
+			return errors.New("zone " + p.NodeZone + " is not opted in to, opt in to its zone group " + aws.StringValue(z.GroupName) + " first")
+		}
+		log.Info("Worker nodes go in ", aws.StringValue(z.ZoneType), " ", p.NodeZone)
+	}
+
+	// Local Zones only offer some instance types
+	offerings, err := svc.DescribeInstanceTypeOfferings(&ec2.DescribeInstanceTypeOfferingsInput{
+		LocationType: aws.String(ec2.LocationTypeAvailabilityZone),
+		Filters: []*ec2.Filter{
+			{Name: aws.String("location"), Values: aws.StringSlice([]string{p.NodeZone})},
+			{Name: aws.String("instance-type"), Values: aws.StringSlice([]string{instanceType})},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if len(offerings.InstanceTypeOfferings) == 0 {
+		return errors.New("instance type " + instanceType + " is not offered in " + p.NodeZone)
+	}
+
+	// If we're here, we should be okay
+	return nil
+}
+
+// checkOutpostInstanceType makes sure the instance type is one the Outpost has capacity for
+func checkOutpostInstanceType(sess *session.Session, outpostARN string, instanceType string) error {
+	svc := outposts.New(sess)
+	input := &outposts.GetOutpostInstanceTypesInput{OutpostId: aws.String(outpostARN)}
+	for {
+		out, err := svc.GetOutpostInstanceTypes(input)
+		if err != nil {
+			return err
+		}
+		for _, t := range out.InstanceTypes {
+			if aws.StringValue(t.InstanceType) == instanceType {
+				return nil
+			}
+		}
+		if out.NextToken == nil {
+			break
+		}
+		input.NextToken = out.NextToken
+	}
+
+	return errors.New("instance type " + instanceType + " is not available on Outpost " + outpostARN)
+}
+
+// applyAWSPlacement changes the generated cluster YAML so the cluster goes in the VPC of the AWSPlacement and the
+// worker nodes in its subnet and zone
+func applyAWSPlacement(installClusterYaml string, clusterName string) error {
+	return patchInstallYaml(installClusterYaml, func(obj *unstructured.Unstructured) (bool, error) {
+		switch {
+		case obj.GetKind() == "AWSCluster" && AWSPlacement.VPCID != "":
+			subnets := []interface{}{}
+			for _, id := range AWSPlacement.Subnets {
+				subnets = append(subnets, map[string]interface{}{"id": id})
+			}
+			err := unstructured.SetNestedField(obj.Object, AWSPlacement.VPCID, "spec", "network", "vpc", "id")
+			if err != nil {
+				return false, err
+			}
+			return true, unstructured.SetNestedSlice(obj.Object, subnets, "spec", "network", "subnets")
+		case obj.GetKind() == "AWSMachineTemplate" && obj.GetName() == clusterName+"-md-0":
+			return true, unstructured.SetNestedField(obj.Object, AWSPlacement.NodeSubnet, "spec", "template", "spec", "subnet", "id")
+		case obj.GetKind() == "MachineDeployment" && obj.GetName() == clusterName+"-md-0":
+			return true, unstructured.SetNestedField(obj.Object, AWSPlacement.NodeZone, "spec", "template", "spec", "failureDomain")
+		}
+		return false, nil
+	})
+}
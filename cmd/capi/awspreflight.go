@@ -0,0 +1,104 @@
+package capi
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// newAWSSession returns a session for the region, with the credentials given or else the default credential chain
+func newAWSSession(region string, accessKey string, secretKey string) (*session.Session, error) {
+	cfg := &aws.Config{Region: aws.String(region)}
+	if accessKey != "" && secretKey != "" {
+		cfg.Credentials = credentials.NewStaticCredentials(accessKey, secretKey, "")
+	}
+	return session.NewSession(cfg)
+}
+
+// CheckAWSRegion makes sure the region exists and that the account is opted in to it
+func CheckAWSRegion(region string, accessKey string, secretKey string) error {
+	sess, err := newAWSSession(region, accessKey, secretKey)
+	if err != nil {
+		return err
+	}
+
+	regions, err := ec2.New(sess).DescribeRegions(&ec2.DescribeRegionsInput{
+		AllRegions:  aws.Bool(true),
+		RegionNames: aws.StringSlice([]string{region}),
+	})
+	if err != nil {
+		return err
+	}
+	if len(regions.Regions) == 0 {
+		return errors.New("region " + region + " doesn't exist")
+	}
+	if aws.StringValue(regions.Regions[0].OptInStatus) == "not-opted-in" {
+		return errors.New("region " + region + " is not opted in to, enable it on the account first")
+	}
+
+	// If we're here, we should be okay
+	return nil
+}
+
+// CheckAWSInstanceTypes makes sure the instance types are offered in the region
+func CheckAWSInstanceTypes(region string, accessKey string, secretKey string, instanceTypes []string) error {
+	sess, err := newAWSSession(region, accessKey, secretKey)
+	if err != nil {
+		return err
+	}
+
+	offered := map[string]bool{}
+	err = ec2.New(sess).DescribeInstanceTypeOfferingsPages(&ec2.DescribeInstanceTypeOfferingsInput{
+		LocationType: aws.String(ec2.LocationTypeRegion),
+		Filters: []*ec2.Filter{
+			{Name: aws.String("instance-type"), Values: aws.StringSlice(instanceTypes)},
+		},
+	}, func(out *ec2.DescribeInstanceTypeOfferingsOutput, last bool) bool {
+		for _, o := range out.InstanceTypeOfferings {
+			offered[aws.StringValue(o.InstanceType)] = true
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	missing := []string{}
+	for _, t := range instanceTypes {
+		if !offered[t] {
+			missing = append(missing, t)
+			offered[t] = true
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return errors.New("instance type(s) " + strings.Join(missing, ", ") + " not offered in " + region)
+	}
+
+	// If we're here, we should be okay
+	return nil
+}
+
+// CheckAWSSSHKey makes sure the key pair the instances are given exists in the region, unless it's going to be
+// created
+func CheckAWSSSHKey(region string, accessKey string, secretKey string, keyName string, create bool) error {
+	sess, err := newAWSSession(region, accessKey, secretKey)
+	if err != nil {
+		return err
+	}
+
+	_, err = ec2.New(sess).DescribeKeyPairs(&ec2.DescribeKeyPairsInput{KeyNames: aws.StringSlice([]string{keyName})})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "InvalidKeyPair.NotFound" {
+		if create {
+			return nil
+		}
+		return errors.New("SSH key " + keyName + " doesn't exist in " + region + ", use --aws-create-ssh-key to have it created")
+	}
+	return err
+}
@@ -0,0 +1,217 @@
+package capi
+
+import (
+	"errors"
+	"net"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// AWSSecurity is who can reach the machines of an AWS cluster. If nil, the defaults of CAPA are used: the API
+// server is open to anyone, and there's no bastion to reach the nodes over SSH from
+var AWSSecurity *AWSSecurityConfig
+
+// AWSSecurityConfig narrows down (or opens up) the security groups CAPA sets up, for when its defaults don't fit
+// the policy of the company
+type AWSSecurityConfig struct {
+	// APIServerCIDRs are the only ones the API server load balancer lets in. GOKP creates the security group of the
+	// load balancer with them, in the VPC of the AWSPlacement, and APIServerSecurityGroup is filled in with it
+	APIServerCIDRs         []string
+	APIServerSecurityGroup string
+	// SSHCIDRs turns on the bastion host and lets them in to it over SSH, the nodes are reached from there
+	SSHCIDRs []string
+	// SecurityGroups are existing security groups attached to every machine, and LoadBalancerSecurityGroups the
+	// ones attached to the API server load balancer. They have to be in the VPC of the AWSPlacement
+	SecurityGroups             []string
+	LoadBalancerSecurityGroups []string
+}
+
+// apiServerPort is the port the API server load balancer listens on
+var apiServerPort int64 = 6443
+
+// ValidateAWSSecurity makes sure the CIDRs are CIDRs and the security groups given are in the VPC. Only the CIDRs
+// are checked if region is ""
+func ValidateAWSSecurity(s *AWSSecurityConfig, vpcID string, region string, accessKey string, secretKey string) error {
+	for _, cidr := range append(append([]string{}, s.APIServerCIDRs...), s.SSHCIDRs...) {
+		_, _, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return errors.New("invalid CIDR " + cidr + ", it should look like 203.0.113.0/24")
+		}
+	}
+
+	// The security group of the load balancer goes in the VPC, CAPA won't use one with a VPC it creates
+	groups := append(append([]string{}, s.SecurityGroups...), s.LoadBalancerSecurityGroups...)
+	if vpcID == "" && (len(s.APIServerCIDRs) > 0 || len(groups) > 0) {
+		return errors.New("allowing CIDRs to the API server and attaching security groups needs an existing VPC (--aws-vpc-id)")
+	}
+	if region == "" || len(groups) == 0 {
+		return nil
+	}
+
+	sess, err := newAWSSession(region, accessKey, secretKey)
+	if err != nil {
+		return err
+	}
+	out, err := ec2.New(sess).DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{GroupIds: aws.StringSlice(groups)})
+	if err != nil {
+		return err
+	}
+	for _, sg := range out.SecurityGroups {
+		if aws.StringValue(sg.VpcId) != vpcID {
+			return errors.New("security group " + aws.StringValue(sg.GroupId) + " is not in VPC " + vpcID)
+		}
+	}
+
+	// If we're here, we should be okay
+	return nil
+}
+
+// EnsureAWSAPIServerSecurityGroup creates the security group of the API server load balancer of the cluster in the
+// VPC, letting in the APIServerCIDRs and the NAT gateways of the VPC (the nodes reach the API server through them).
+// One that's already there is reused, so this can be run again
+func EnsureAWSAPIServerSecurityGroup(s *AWSSecurityConfig, vpcID string, clusterName string, region string, accessKey string, secretKey string) error {
+	sess, err := newAWSSession(region, accessKey, secretKey)
+	if err != nil {
+		return err
+	}
+	svc := ec2.New(sess)
+	name := AWSAPIServerSecurityGroupName(clusterName)
+
+	existing, err := svc.DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{
+		Filters: []*ec2.Filter{
+			{Name: aws.String("vpc-id"), Values: aws.StringSlice([]string{vpcID})},
+			{Name: aws.String("group-name"), Values: aws.StringSlice([]string{name})},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if len(existing.SecurityGroups) > 0 {
+		s.APIServerSecurityGroup = aws.StringValue(existing.SecurityGroups[0].GroupId)
+	} else {
+		log.Info("Creating security group ", name, " for the API server")
+		created, err := svc.CreateSecurityGroup(&ec2.CreateSecurityGroupInput{
+			GroupName:   aws.String(name),
+			Description: aws.String("API server load balancer of " + clusterName + ", created by GOKP"),
+			VpcId:       aws.String(vpcID),
+			TagSpecifications: []*ec2.TagSpecification{{
+				ResourceType: aws.String(ec2.ResourceTypeSecurityGroup),
+				Tags: []*ec2.Tag{
+					{Key: aws.String(awsManagedTag), Value: aws.String("true")},
+					{Key: aws.String(awsClusterTag + clusterName), Value: aws.String("owned")},
+				},
+			}},
+		})
+		if err != nil {
+			return err
+		}
+		s.APIServerSecurityGroup = aws.StringValue(created.GroupId)
+	}
+
+	// The nodes come from the addresses of the NAT gateways
+	cidrs := append([]string{}, s.APIServerCIDRs...)
+	gateways, err := svc.DescribeNatGateways(&ec2.DescribeNatGatewaysInput{
+		Filter: []*ec2.Filter{
+			{Name: aws.String("vpc-id"), Values: aws.StringSlice([]string{vpcID})},
+			{Name: aws.String("state"), Values: aws.StringSlice([]string{ec2.NatGatewayStateAvailable})},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	for _, g := range gateways.NatGateways {
+		for _, a := range g.NatGatewayAddresses {
+			if a.PublicIp != nil {
+				cidrs = append(cidrs, aws.StringValue(a.PublicIp)+"/32")
+			}
+		}
+	}
+
+	for _, cidr := range cidrs {
+		_, err = svc.AuthorizeSecurityGroupIngress(&ec2.AuthorizeSecurityGroupIngressInput{
+			GroupId: aws.String(s.APIServerSecurityGroup),
+			IpPermissions: []*ec2.IpPermission{{
+				IpProtocol: aws.String("tcp"),
+				FromPort:   aws.Int64(apiServerPort),
+				ToPort:     aws.Int64(apiServerPort),
+				IpRanges:   []*ec2.IpRange{{CidrIp: aws.String(cidr), Description: aws.String("Kubernetes API")}},
+			}},
+		})
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "InvalidPermission.Duplicate" {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteAWSAPIServerSecurityGroup deletes the security group EnsureAWSAPIServerSecurityGroup created, once the load
+// balancer using it is gone. It's not an error if it's already gone
+func DeleteAWSAPIServerSecurityGroup(region string, accessKey string, secretKey string, groupID string) error {
+	sess, err := newAWSSession(region, accessKey, secretKey)
+	if err != nil {
+		return err
+	}
+
+	log.Info("Deleting security group ", groupID)
+	_, err = ec2.New(sess).DeleteSecurityGroup(&ec2.DeleteSecurityGroupInput{GroupId: aws.String(groupID)})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "InvalidGroup.NotFound" {
+		return nil
+	}
+	return err
+}
+
+// AWSAPIServerSecurityGroupName returns the name of the security group of the API server load balancer GOKP creates
+func AWSAPIServerSecurityGroupName(clusterName string) string {
+	return "gokp-" + clusterName + "-apiserver-lb"
+}
+
+// applyAWSSecurity changes the generated cluster YAML so the load balancer and the machines get the security
+// groups of the AWSSecurity, and turns on the bastion if SSH is let in
+func applyAWSSecurity(installClusterYaml string) error {
+	return patchInstallYaml(installClusterYaml, func(obj *unstructured.Unstructured) (bool, error) {
+		switch obj.GetKind() {
+		case "AWSCluster":
+			if AWSSecurity.APIServerSecurityGroup != "" {
+				err := unstructured.SetNestedStringMap(obj.Object, map[string]string{"apiserver-lb": AWSSecurity.APIServerSecurityGroup}, "spec", "network", "securityGroupOverrides")
+				if err != nil {
+					return false, err
+				}
+			}
+			if len(AWSSecurity.LoadBalancerSecurityGroups) > 0 {
+				err := unstructured.SetNestedStringSlice(obj.Object, AWSSecurity.LoadBalancerSecurityGroups, "spec", "controlPlaneLoadBalancer", "additionalSecurityGroups")
+				if err != nil {
+					return false, err
+				}
+			}
+			if len(AWSSecurity.SSHCIDRs) > 0 {
+				err := unstructured.SetNestedField(obj.Object, true, "spec", "bastion", "enabled")
+				if err != nil {
+					return false, err
+				}
+				err = unstructured.SetNestedStringSlice(obj.Object, AWSSecurity.SSHCIDRs, "spec", "bastion", "allowedCIDRBlocks")
+				if err != nil {
+					return false, err
+				}
+			}
+			return true, nil
+		case "AWSMachineTemplate":
+			if len(AWSSecurity.SecurityGroups) == 0 {
+				return false, nil
+			}
+			groups := []interface{}{}
+			for _, id := range AWSSecurity.SecurityGroups {
+				groups = append(groups, map[string]interface{}{"id": id})
+			}
+			return true, unstructured.SetNestedSlice(obj.Object, groups, "spec", "template", "spec", "additionalSecurityGroups")
+		}
+		return false, nil
+	})
+}
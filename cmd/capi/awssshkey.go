@@ -0,0 +1,116 @@
+package capi
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	log "github.com/sirupsen/logrus"
+)
+
+// awsManagedTag is put on the key pairs and security groups GOKP creates, and awsClusterTag (followed by the name of
+// the cluster) on every one a cluster uses. A key pair GOKP created is deleted along with the last cluster using it
+var (
+	awsManagedTag string = "gokp-managed"
+	awsClusterTag string = "gokp-cluster/"
+)
+
+// EnsureAWSSSHKey makes sure the key pair the instances of the cluster are given exists in the region, and tags it
+// with the cluster. If it doesn't exist it's created when create is set, and its private key is returned (AWS
+// doesn't keep it, so it's the only time it can be had). Otherwise "" is returned
+func EnsureAWSSSHKey(region string, accessKey string, secretKey string, keyName string, clusterName string, create bool) (string, error) {
+	sess, err := newAWSSession(region, accessKey, secretKey)
+	if err != nil {
+		return "", err
+	}
+	svc := ec2.New(sess)
+
+	out, err := svc.DescribeKeyPairs(&ec2.DescribeKeyPairsInput{KeyNames: aws.StringSlice([]string{keyName})})
+	if err == nil {
+		key := out.KeyPairs[0]
+		if !hasTag(key.Tags, awsClusterTag+clusterName) {
+			log.Info("Reusing SSH key ", keyName)
+			_, err = svc.CreateTags(&ec2.CreateTagsInput{
+				Resources: []*string{key.KeyPairId},
+				Tags:      []*ec2.Tag{{Key: aws.String(awsClusterTag + clusterName), Value: aws.String("shared")}},
+			})
+		}
+		return "", err
+	}
+	if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != "InvalidKeyPair.NotFound" {
+		return "", err
+	}
+	if !create {
+		return "", errors.New("SSH key " + keyName + " doesn't exist in " + region + ", use --aws-create-ssh-key to have it created")
+	}
+
+	log.Info("Creating SSH key ", keyName)
+	created, err := svc.CreateKeyPair(&ec2.CreateKeyPairInput{
+		KeyName: aws.String(keyName),
+		TagSpecifications: []*ec2.TagSpecification{{
+			ResourceType: aws.String(ec2.ResourceTypeKeyPair),
+			Tags: []*ec2.Tag{
+				{Key: aws.String(awsManagedTag), Value: aws.String("true")},
+				{Key: aws.String(awsClusterTag + clusterName), Value: aws.String("owned")},
+			},
+		}},
+	})
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(created.KeyMaterial), nil
+}
+
+// ReleaseAWSSSHKey removes the tag of the cluster from the key pair, and deletes it if GOKP created it and no other
+// cluster uses it. It's not an error if it's already gone
+func ReleaseAWSSSHKey(region string, accessKey string, secretKey string, keyName string, clusterName string) error {
+	sess, err := newAWSSession(region, accessKey, secretKey)
+	if err != nil {
+		return err
+	}
+	svc := ec2.New(sess)
+
+	out, err := svc.DescribeKeyPairs(&ec2.DescribeKeyPairsInput{KeyNames: aws.StringSlice([]string{keyName})})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "InvalidKeyPair.NotFound" {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	key := out.KeyPairs[0]
+
+	_, err = svc.DeleteTags(&ec2.DeleteTagsInput{
+		Resources: []*string{key.KeyPairId},
+		Tags:      []*ec2.Tag{{Key: aws.String(awsClusterTag + clusterName)}},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Keep it while other clusters use it, and keep the ones GOKP didn't create
+	for _, t := range key.Tags {
+		k := aws.StringValue(t.Key)
+		if strings.HasPrefix(k, awsClusterTag) && k != awsClusterTag+clusterName {
+			return nil
+		}
+	}
+	if !hasTag(key.Tags, awsManagedTag) {
+		return nil
+	}
+
+	log.Info("Deleting SSH key ", keyName)
+	_, err = svc.DeleteKeyPair(&ec2.DeleteKeyPairInput{KeyPairId: key.KeyPairId})
+	return err
+}
+
+// hasTag returns true if one of the tags has the key
+func hasTag(tags []*ec2.Tag, key string) bool {
+	for _, t := range tags {
+		if aws.StringValue(t.Key) == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,124 @@
+package capi
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	cfn "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/christianh814/gokp/cmd/clock"
+	"github.com/christianh814/gokp/cmd/state"
+	log "github.com/sirupsen/logrus"
+)
+
+// StackWait is how often DeleteAWSBootstrapStack checks on the CloudFormation stack, and how long it waits for it to
+// be deleted
+var StackWait clock.Waiter = clock.Waiter{Interval: 10 * time.Second, Timeout: 30 * time.Minute}
+
+// AWSBootstrapStackExists returns true if the CloudFormation stack CreateAwsK8sInstance creates is already there.
+// The default credential chain is used if no keys are given
+func AWSBootstrapStackExists(region string, accessKey string, secretKey string) (bool, error) {
+	svc, err := newCloudFormation(region, accessKey, secretKey)
+	if err != nil {
+		return false, err
+	}
+	_, err = svc.DescribeStacks(&cfn.DescribeStacksInput{StackName: aws.String(AWSBootstrapStackName())})
+	if isStackNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// DescribeAWSBootstrapStack returns the CloudFormation stack CreateAwsK8sInstance creates, with the IAM resources in
+// it and its outputs
+func DescribeAWSBootstrapStack(region string, accessKey string, secretKey string) (*state.AWSStack, error) {
+	svc, err := newCloudFormation(region, accessKey, secretKey)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := svc.DescribeStacks(&cfn.DescribeStacksInput{StackName: aws.String(AWSBootstrapStackName())})
+	if err != nil {
+		return nil, err
+	}
+	stack := out.Stacks[0]
+	s := &state.AWSStack{
+		Name:    aws.StringValue(stack.StackName),
+		ID:      aws.StringValue(stack.StackId),
+		Region:  region,
+		Outputs: map[string]string{},
+	}
+	for _, o := range stack.Outputs {
+		s.Outputs[aws.StringValue(o.OutputKey)] = aws.StringValue(o.OutputValue)
+	}
+
+	resources, err := svc.DescribeStackResources(&cfn.DescribeStackResourcesInput{StackName: stack.StackId})
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range resources.StackResources {
+		switch aws.StringValue(r.ResourceType) {
+		case "AWS::IAM::Role":
+			s.Roles = append(s.Roles, aws.StringValue(r.PhysicalResourceId))
+		case "AWS::IAM::InstanceProfile":
+			s.InstanceProfiles = append(s.InstanceProfiles, aws.StringValue(r.PhysicalResourceId))
+		case "AWS::IAM::ManagedPolicy":
+			s.Policies = append(s.Policies, aws.StringValue(r.PhysicalResourceId))
+		}
+	}
+
+	return s, nil
+}
+
+// DeleteAWSBootstrapStack deletes the CloudFormation stack, and with it the IAM resources CAPA uses, and waits for
+// it to be gone. The stack is deleted by its ID, so a stack that was created again since isn't touched
+func DeleteAWSBootstrapStack(s *state.AWSStack, accessKey string, secretKey string) error {
+	svc, err := newCloudFormation(s.Region, accessKey, secretKey)
+	if err != nil {
+		return err
+	}
+
+	log.Info("Deleting CloudFormation stack ", s.Name, " with roles ", strings.Join(s.Roles, ", "), " and instance profiles ", strings.Join(s.InstanceProfiles, ", "))
+	_, err = svc.DeleteStack(&cfn.DeleteStackInput{StackName: aws.String(s.ID)})
+	if err != nil {
+		return err
+	}
+
+	err = StackWait.Until(func() (bool, error) {
+		out, err := svc.DescribeStacks(&cfn.DescribeStacksInput{StackName: aws.String(s.ID)})
+		if isStackNotFound(err) {
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		switch aws.StringValue(out.Stacks[0].StackStatus) {
+		case cfn.StackStatusDeleteComplete:
+			return true, nil
+		case cfn.StackStatusDeleteFailed:
+			return false, errors.New("unable to delete CloudFormation stack " + s.Name + ": " + aws.StringValue(out.Stacks[0].StackStatusReason))
+		}
+		return false, nil
+	})
+	if err == clock.ErrTimeout {
+		return errors.New("CloudFormation stack " + s.Name + " took too long to be deleted")
+	}
+	return err
+}
+
+// isStackNotFound returns true if the error is CloudFormation saying there's no such stack
+func isStackNotFound(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == "ValidationError" && strings.Contains(aerr.Message(), "does not exist")
+}
+
+// newCloudFormation returns a CloudFormation client for the region
+func newCloudFormation(region string, accessKey string, secretKey string) (*cfn.CloudFormation, error) {
+	sess, err := newAWSSession(region, accessKey, secretKey)
+	if err != nil {
+		return nil, err
+	}
+	return cfn.New(sess), nil
+}
@@ -0,0 +1,266 @@
+package capi
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/christianh814/gokp/cmd/byoh"
+	"github.com/christianh814/gokp/cmd/clock"
+	"github.com/christianh814/gokp/cmd/utils"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	capiclient "sigs.k8s.io/cluster-api/cmd/clusterctl/client"
+)
+
+// byoHostGVR is the resource the host agent registers a host as
+var byoHostGVR = schema.GroupVersionResource{Group: "infrastructure.cluster.x-k8s.io", Version: "v1beta1", Resource: "byohosts"}
+
+// CreateBYOHK8sInstance creates a K8S cluster on existing hosts with the BYOH provider. The host agent is installed
+// on every host over SSH, so they register with the Kind instance
+func CreateBYOHK8sInstance(kindkconfig string, clusterName *string, workdir string, byohvars map[string]string, capicfg string, hosts *byoh.Hosts) (bool, error) {
+	// Export the BYOH settings as Env vars, they're what the template is filled in with
+	for k := range byohvars {
+		os.Setenv(k, byohvars[k])
+	}
+
+	// init BYOH provider into the Kind instance
+	log.Info("Initializing BYOH provider")
+	c, err := capiclient.New("")
+	if err != nil {
+		return false, err
+	}
+
+	_, err = c.Init(capiclient.InitOptions{
+		Kubeconfig:              capiclient.Kubeconfig{Path: kindkconfig},
+		InfrastructureProviders: []string{"byoh"},
+		LogUsageInstructions:    false,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	//	use clientcmd to apply the configuration
+	clusterInstallConfig, err := clientcmd.BuildConfigFromFlags("", kindkconfig)
+	if err != nil {
+		return false, err
+	}
+
+	// The hosts are machines the moment the agent registers them
+	err = hosts.InstallAgent(kindkconfig)
+	if err != nil {
+		return false, err
+	}
+	err = waitForByoHosts(clusterInstallConfig, len(hosts.Addresses))
+	if err != nil {
+		return false, err
+	}
+
+	//	Set up options to write out the install YAML. Every host is used
+	cpMachineCount := hosts.ControlPlaneCount()
+	workerMachineCount := int64(len(hosts.Addresses)) - cpMachineCount
+	cto := capiclient.GetClusterTemplateOptions{
+		Kubeconfig:               capiclient.Kubeconfig{Path: kindkconfig},
+		ClusterName:              *clusterName,
+		ControlPlaneMachineCount: &cpMachineCount,
+		WorkerMachineCount:       &workerMachineCount,
+		KubernetesVersion:        KubernetesVersion,
+		TargetNamespace:          "default",
+	}
+
+	//	Load up the config with the options
+	installYaml, err := c.GetClusterTemplate(cto)
+	if err != nil {
+		return false, err
+	}
+
+	// Write the install file out
+	installClusterYaml := workdir + "/" + "install-cluster.yaml"
+	err = utils.WriteYamlOutput(installYaml, installClusterYaml)
+	if err != nil {
+		return false, err
+	}
+
+	// Replace the workers the way that was asked for
+	if RolloutStrategy != nil {
+		err = applyRolloutStrategy(installClusterYaml)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Turn on the feature gates that were asked for
+	if len(FeatureGates) > 0 {
+		err = applyFeatureGates(installClusterYaml)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Reach the nodes through konnectivity if asked for
+	if Konnectivity {
+		err = applyKonnectivity(installClusterYaml)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Encrypt secrets at rest if asked for
+	if EncryptSecrets {
+		err = applyEncryption(installClusterYaml)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Install the CAPI Helm add-on provider if we're using it for the CNI
+	if HelmAddons {
+		err = InstallHelmAddonProvider(kindkconfig, workdir)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Apply the YAML to the KIND instance so that the cluster gets installed on the hosts
+	log.Info("Preflight complete, installing cluster")
+
+	// Create clientset to check the status
+	clientset, err := kubernetes.NewForConfig(clusterInstallConfig)
+	if err != nil {
+		return false, err
+	}
+
+	// Wait for it to roll out
+	err = waitForController(clientset, "byoh-system", "byoh-controller-manager", "CAPI Controller")
+	if err != nil {
+		return false, err
+	}
+
+	//	Split the one yaml CAPI gives you into individual files
+	err = utils.SplitYamls(workdir+"/"+"capi-install-yamls-output", installClusterYaml, "---")
+	if err != nil {
+		return false, err
+	}
+
+	//	get a list of those files
+	yamlFiles, err := filepath.Glob(workdir + "/" + "capi-install-yamls-output" + "/" + "*.yaml")
+	if err != nil {
+		return false, err
+	}
+
+	for _, yamlFile := range yamlFiles {
+		err = DoSSA(context.TODO(), clusterInstallConfig, yamlFile)
+		if err != nil {
+			log.Warn("Unable to read YAML: ", err)
+		}
+	}
+
+	//	First, wait for the infra to appear
+	_, err = waitForAWSInfra(clusterInstallConfig, *clusterName)
+	if err != nil {
+		return false, err
+	}
+
+	//	Then, wait for the CP to appear
+	_, err = waitForCP(clusterInstallConfig, *clusterName, cpMachineCount > 1)
+	if err != nil {
+		return false, err
+	}
+
+	log.Info("Control Plane Nodes are Online, saving Kubeconfig")
+
+	// Write out CAPI kubeconfig and save it
+	clusterKubeconfig, err := c.GetKubeconfig(capiclient.GetKubeconfigOptions{
+		Kubeconfig:          capiclient.Kubeconfig{Path: kindkconfig},
+		WorkloadClusterName: *clusterName,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	clusterkcfg, err := os.Create(capicfg)
+	if err != nil {
+		return false, err
+	}
+	clusterkcfg.WriteString(clusterKubeconfig)
+	clusterkcfg.Close()
+
+	//Apply the CNI solution, waiting for it to roll out
+
+	// Set up the Capi CFG connection
+	capiInstallConfig, err := clientcmd.BuildConfigFromFlags("", capicfg)
+	if err != nil {
+		return false, err
+	}
+	if HelmAddons {
+		// Let CAAPH install the CNI from the management cluster
+		err = ApplyCNIHelmChartProxy(kindkconfig, *clusterName, workdir)
+		if err != nil {
+			return false, err
+		}
+		err = waitForCNI(capiInstallConfig, helmCNI)
+		if err != nil {
+			return false, err
+		}
+	} else {
+		err = installCNI(capiInstallConfig, workdir, CNI)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Run the konnectivity agents, now that the nodes have a network
+	if Konnectivity {
+		err = installKonnectivityAgent(capiInstallConfig, workdir)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Wait until Nodes are READY
+	log.Info("Waiting for worker nodes to come online")
+	_, err = waitForReadyNodes(capiInstallConfig)
+	if err != nil {
+		return false, err
+	}
+
+	// If we're here, that means everything turned out okay
+	log.Info("Successfully created BYOH Kubernetes Cluster")
+	return true, nil
+}
+
+// HostRegistrationWait is how often waitForByoHosts checks for the hosts, and how long they have to register
+var HostRegistrationWait clock.Waiter = clock.Waiter{Interval: 10 * time.Second, Timeout: 10 * time.Minute}
+
+// waitForByoHosts waits until the given number of hosts have registered
+func waitForByoHosts(cfg *rest.Config, count int) error {
+	log.Info("Waiting for ", count, " hosts to register")
+	dyn, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	registered := 0
+	err = HostRegistrationWait.Until(func() (bool, error) {
+		list, err := dyn.Resource(byoHostGVR).Namespace("default").List(context.TODO(), metav1.ListOptions{})
+		if err != nil {
+			// The CRD may not be established yet
+			return false, nil
+		}
+		registered = len(list.Items)
+		return registered >= count, nil
+	})
+	if err != clock.ErrTimeout {
+		return err
+	}
+
+	return errors.New("only " + strconv.Itoa(registered) + " of " + strconv.Itoa(count) + " hosts registered")
+}
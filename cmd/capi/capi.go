@@ -11,10 +11,10 @@ import (
 
 	"context"
 	"encoding/base64"
-	"encoding/json"
 
 	"github.com/aws/aws-sdk-go/aws/session"
 	cfn "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/christianh814/gokp/cmd/clock"
 	"github.com/christianh814/gokp/cmd/kind"
 	"github.com/christianh814/gokp/cmd/utils"
 	"github.com/rwtodd/Go.Sed/sed"
@@ -36,7 +36,6 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/runtime/serializer/yaml"
 	"k8s.io/apimachinery/pkg/types"
-	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/discovery/cached/memory"
 	"k8s.io/client-go/dynamic"
@@ -50,8 +49,6 @@ import (
 	infrav1 "sigs.k8s.io/cluster-api-provider-azure/api/v1beta1"
 )
 
-var CNIurl string = "https://docs.projectcalico.org/v3.21/manifests/calico.yaml"
-var azureCNIurl string = "https://raw.githubusercontent.com/kubernetes-sigs/cluster-api-provider-azure/main/templates/addons/calico.yaml"
 var decUnstructured = yaml.NewDecodingSerializer(unstructured.UnstructuredJSONScheme)
 
 var KubernetesVersion string = "v1.24.0"
@@ -118,24 +115,10 @@ func CreateAzureK8sInstance(kindkconfig string, clusterName *string, workdir str
 		return false, err
 	}
 
-	// Check to see if it's rolled out, if not then wait 20 seconds and check again. Stop after 15x
-	counter := 0
-	for runs := 15; counter <= runs; counter++ {
-		capaClient := clientset.AppsV1().Deployments("capz-system")
-		if counter > runs {
-			return false, errors.New("CAPI Controller took too long to roll out")
-		}
-		capaDeployment, err := capaClient.Get(context.TODO(), "capz-controller-manager", metav1.GetOptions{})
-		if err != nil {
-			return false, err
-		}
-
-		availableReplicas := capaDeployment.Status.AvailableReplicas
-		if availableReplicas > int32(0) {
-			time.Sleep(20 * time.Second)
-			break
-		}
-		time.Sleep(20 * time.Second)
+	// Wait for it to roll out
+	err = waitForController(clientset, "capz-system", "capz-controller-manager", "CAPI Controller")
+	if err != nil {
+		return false, err
 	}
 	log.Info("Creating azureidentity")
 	dynamic := dynamic.NewForConfigOrDie(clusterInstallConfig)
@@ -199,6 +182,9 @@ func CreateAzureK8sInstance(kindkconfig string, clusterName *string, workdir str
 		cpMachineCount = 1
 		workerMachineCount = 2
 	}
+	if WorkerMachineCount > 0 {
+		workerMachineCount = WorkerMachineCount
+	}
 	cto := capiclient.GetClusterTemplateOptions{
 		Kubeconfig:               capiclient.Kubeconfig{Path: kindkconfig},
 		ClusterName:              *clusterName,
@@ -222,6 +208,54 @@ func CreateAzureK8sInstance(kindkconfig string, clusterName *string, workdir str
 		return false, err
 	}
 
+	// Replace the workers the way that was asked for
+	if RolloutStrategy != nil {
+		err = applyRolloutStrategy(installClusterYaml)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Turn on the feature gates that were asked for
+	if len(FeatureGates) > 0 {
+		err = applyFeatureGates(installClusterYaml)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Reach the nodes through konnectivity if asked for
+	if Konnectivity {
+		err = applyKonnectivity(installClusterYaml)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Encrypt secrets at rest if asked for
+	if EncryptSecrets {
+		err = applyEncryption(installClusterYaml)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Give the machines the root volume that was asked for
+	if RootVolumeSize > 0 {
+		err = applyRootVolume(installClusterYaml)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Install the CAPI Helm add-on provider if we're using it for the CNI
+	if HelmAddons {
+		err = InstallHelmAddonProvider(kindkconfig, workdir)
+		if err != nil {
+			return false, err
+		}
+	}
+
 	// Apply the YAML to the KIND instance so that the cluster gets installed on AWS
 	log.Info("Preflight complete, installing cluster")
 	err = utils.SplitYamls(workdir+"/"+"capi-install-yamls-output", installClusterYaml, "---")
@@ -276,50 +310,45 @@ func CreateAzureK8sInstance(kindkconfig string, clusterName *string, workdir str
 	clusterkcfg.WriteString(clusterKubeconfig)
 	clusterkcfg.Close()
 
-	//Apply the CNI solution. For now we use Calico
-	//	TODO: This should be something that is an end user can choose
+	//Apply the CNI solution, waiting for it to roll out
 
 	// Set up the Capi CFG connection
 	capiInstallConfig, err := clientcmd.BuildConfigFromFlags("", capicfg)
 	if err != nil {
 		return false, err
 	}
-	//	Download the CNI YAML
-	cniYaml := workdir + "/" + "cni.yaml"
-	_, err = utils.DownloadFile(cniYaml, azureCNIurl)
-	if err != nil {
-		return false, err
-	}
-
-	//	Split the  CNI yaml into individual files
-	err = utils.SplitYamls(workdir+"/"+"cni-output", cniYaml, "---")
-	if err != nil {
-		return false, err
-	}
-
-	//	get a list of those files
-	cniyamlFiles, err := filepath.Glob(workdir + "/" + "cni-output" + "/" + "*.yaml")
-	if err != nil {
-		return false, err
+	if HelmAddons {
+		// Let CAAPH install the CNI from the management cluster
+		err = ApplyCNIHelmChartProxy(kindkconfig, *clusterName, workdir)
+		if err != nil {
+			return false, err
+		}
+		err = waitForCNI(capiInstallConfig, helmCNI)
+		if err != nil {
+			return false, err
+		}
+	} else {
+		cniName := CNI
+		if cniName == "calico" {
+			cniName = azureCNI
+		}
+		err = installCNI(capiInstallConfig, workdir, cniName)
+		if err != nil {
+			return false, err
+		}
 	}
 
-	for _, cniyamlFile := range cniyamlFiles {
-		err = DoSSA(context.TODO(), capiInstallConfig, cniyamlFile)
+	// Run the konnectivity agents, now that the nodes have a network
+	if Konnectivity {
+		err = installKonnectivityAgent(capiInstallConfig, workdir)
 		if err != nil {
-			if !strings.Contains(err.Error(), "is missing in") {
-				return false, err
-			}
-			//log.Warn("Unable to read YAML: ", err)
+			return false, err
 		}
 	}
 
 	// Wait until Nodes are READY
 	log.Info("Waiting for worker nodes to come online")
 
-	// HACK: We sleep to give time for the CNI to rollout
-	//	TODO: Wait until CNI Deployment is done
-	time.Sleep(time.Minute)
-
 	_, err = waitForReadyNodes(capiInstallConfig)
 	if err != nil {
 		return false, err
@@ -346,15 +375,14 @@ func CreateAwsK8sInstance(kindkconfig string, clusterName *string, workdir strin
 		os.Setenv(k, awscreds[k])
 	}
 
-	// Set up variables
-	var cpMachineCount int64
-	var workerMachineCount int64
-
 	// Boostrapping Cloud Formation stack on AWS only if needed
 	if !skipCloudFormation {
 
 		log.Info("Boostrapping Cloud Formation stack on AWS")
 		template := bootstrap.NewTemplate()
+
+		// The controller of the EBS CSI driver runs on the control plane, which has to be allowed to manage volumes
+		template.Spec.ControlPlane.EnableCSIPolicy = true
 		sess, err := session.NewSession()
 		if err != nil {
 			return false, err
@@ -412,17 +440,7 @@ func CreateAwsK8sInstance(kindkconfig string, clusterName *string, workdir strin
 	}
 
 	//	Set up options to write out the install YAML
-	//	TODO: Make Kubernetes version an option
-	if createHaCluster {
-		// If HA was requested we create it
-		cpMachineCount = 3
-		workerMachineCount = 3
-		//
-	} else {
-		// If HA was NOT requested we create a small cluster
-		cpMachineCount = 1
-		workerMachineCount = 2
-	}
+	cpMachineCount, workerMachineCount := AWSMachineCounts(createHaCluster)
 	cto := capiclient.GetClusterTemplateOptions{
 		Kubeconfig:               capiclient.Kubeconfig{Path: kindkconfig},
 		ClusterName:              *clusterName,
@@ -439,13 +457,21 @@ func CreateAwsK8sInstance(kindkconfig string, clusterName *string, workdir strin
 		return false, err
 	}
 
-	// Write the install file out
+	// Write the install file out, with the changes that were asked for
 	installClusterYaml := workdir + "/" + "install-cluster.yaml"
-	err = utils.WriteYamlOutput(installYaml, installClusterYaml)
+	err = writeAwsInstallYaml(installYaml, installClusterYaml, *clusterName)
 	if err != nil {
 		return false, err
 	}
 
+	// Install the CAPI Helm add-on provider if we're using it for the CNI
+	if HelmAddons {
+		err = InstallHelmAddonProvider(kindkconfig, workdir)
+		if err != nil {
+			return false, err
+		}
+	}
+
 	// Apply the YAML to the KIND instance so that the cluster gets installed on AWS
 	log.Info("Preflight complete, installing cluster")
 
@@ -466,24 +492,10 @@ func CreateAwsK8sInstance(kindkconfig string, clusterName *string, workdir strin
 		return false, err
 	}
 
-	// Check to see if it's rolled out, if not then wait 5 seconds and check again. Stop after 10x
-	counter := 0
-	for runs := 10; counter <= runs; counter++ {
-		capaClient := clientset.AppsV1().Deployments("capa-system")
-		if counter > runs {
-			return false, errors.New("CAPI Controller took too long to roll out")
-		}
-		capaDeployment, err := capaClient.Get(context.TODO(), "capa-controller-manager", metav1.GetOptions{})
-		if err != nil {
-			return false, err
-		}
-
-		availableReplicas := capaDeployment.Status.AvailableReplicas
-		if availableReplicas > int32(0) {
-			time.Sleep(5 * time.Second)
-			break
-		}
-		time.Sleep(5 * time.Second)
+	// Wait for it to roll out
+	err = waitForController(clientset, "capa-system", "capa-controller-manager", "CAPI Controller")
+	if err != nil {
+		return false, err
 	}
 
 	//	Apply the config now that the capa controller is rolled out
@@ -540,50 +552,41 @@ func CreateAwsK8sInstance(kindkconfig string, clusterName *string, workdir strin
 	clusterkcfg.WriteString(clusterKubeconfig)
 	clusterkcfg.Close()
 
-	//Apply the CNI solution. For now we use Calico
-	//	TODO: This should be something that is an end user can choose
+	//Apply the CNI solution, waiting for it to roll out
 
 	// Set up the Capi CFG connection
 	capiInstallConfig, err := clientcmd.BuildConfigFromFlags("", capicfg)
 	if err != nil {
 		return false, err
 	}
-	//	Download the CNI YAML
-	cniYaml := workdir + "/" + "cni.yaml"
-	_, err = utils.DownloadFile(cniYaml, CNIurl)
-	if err != nil {
-		return false, err
-	}
-
-	//	Split the  CNI yaml into individual files
-	err = utils.SplitYamls(workdir+"/"+"cni-output", cniYaml, "---")
-	if err != nil {
-		return false, err
-	}
-
-	//	get a list of those files
-	cniyamlFiles, err := filepath.Glob(workdir + "/" + "cni-output" + "/" + "*.yaml")
-	if err != nil {
-		return false, err
+	if HelmAddons {
+		// Let CAAPH install the CNI from the management cluster
+		err = ApplyCNIHelmChartProxy(kindkconfig, *clusterName, workdir)
+		if err != nil {
+			return false, err
+		}
+		err = waitForCNI(capiInstallConfig, helmCNI)
+		if err != nil {
+			return false, err
+		}
+	} else {
+		err = installCNI(capiInstallConfig, workdir, CNI)
+		if err != nil {
+			return false, err
+		}
 	}
 
-	for _, cniyamlFile := range cniyamlFiles {
-		err = DoSSA(context.TODO(), capiInstallConfig, cniyamlFile)
+	// Run the konnectivity agents, now that the nodes have a network
+	if Konnectivity {
+		err = installKonnectivityAgent(capiInstallConfig, workdir)
 		if err != nil {
-			if !strings.Contains(err.Error(), "is missing in") {
-				return false, err
-			}
-			//log.Warn("Unable to read YAML: ", err)
+			return false, err
 		}
 	}
 
 	// Wait until Nodes are READY
 	log.Info("Waiting for worker nodes to come online")
 
-	// HACK: We sleep to give time for the CNI to rollout
-	//	TODO: Wait until CNI Deployment is done
-	time.Sleep(time.Minute)
-
 	_, err = waitForReadyNodes(capiInstallConfig)
 	if err != nil {
 		return false, err
@@ -641,6 +644,9 @@ func CreateDevelK8sInstance(kindkconfig string, clusterName *string, workdir str
 		cpMachineCount = 1
 		workerMachineCount = 2
 	}
+	if WorkerMachineCount > 0 {
+		workerMachineCount = WorkerMachineCount
+	}
 	cto := capiclient.GetClusterTemplateOptions{
 		Kubeconfig:               capiclient.Kubeconfig{Path: kindkconfig},
 		ClusterName:              *clusterName,
@@ -665,6 +671,46 @@ func CreateDevelK8sInstance(kindkconfig string, clusterName *string, workdir str
 		return false, err
 	}
 
+	// Replace the workers the way that was asked for
+	if RolloutStrategy != nil {
+		err = applyRolloutStrategy(installClusterYaml)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Turn on the feature gates that were asked for
+	if len(FeatureGates) > 0 {
+		err = applyFeatureGates(installClusterYaml)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Reach the nodes through konnectivity if asked for
+	if Konnectivity {
+		err = applyKonnectivity(installClusterYaml)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Encrypt secrets at rest if asked for
+	if EncryptSecrets {
+		err = applyEncryption(installClusterYaml)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Install the CAPI Helm add-on provider if we're using it for the CNI
+	if HelmAddons {
+		err = InstallHelmAddonProvider(kindkconfig, workdir)
+		if err != nil {
+			return false, err
+		}
+	}
+
 	// Apply the YAML to the KIND instance so that the cluster gets installed on AWS
 	log.Info("Preflight complete, installing cluster")
 
@@ -685,24 +731,10 @@ func CreateDevelK8sInstance(kindkconfig string, clusterName *string, workdir str
 		return false, err
 	}
 
-	// Check to see if it's rolled out, if not then wait 5 seconds and check again. Stop after 10x
-	counter := 0
-	for runs := 10; counter <= runs; counter++ {
-		capaClient := clientset.AppsV1().Deployments("capd-system")
-		if counter > runs {
-			return false, errors.New("CAPI Controller took too long to roll out")
-		}
-		capdDeployment, err := capaClient.Get(context.TODO(), "capd-controller-manager", metav1.GetOptions{})
-		if err != nil {
-			return false, err
-		}
-
-		availableReplicas := capdDeployment.Status.AvailableReplicas
-		if availableReplicas > int32(0) {
-			time.Sleep(5 * time.Second)
-			break
-		}
-		time.Sleep(5 * time.Second)
+	// Wait for it to roll out
+	err = waitForController(clientset, "capd-system", "capd-controller-manager", "CAPI Controller")
+	if err != nil {
+		return false, err
 	}
 
 	//	Apply the config now that the capa controller is rolled out
@@ -781,50 +813,41 @@ func CreateDevelK8sInstance(kindkconfig string, clusterName *string, workdir str
 	clusterkcfg.WriteString(clusterKubeconfig)
 	clusterkcfg.Close()
 
-	//Apply the CNI solution. For now we use Calico
-	//	TODO: This should be something that is an end user can choose
+	//Apply the CNI solution, waiting for it to roll out
 
 	// Set up the Capi CFG connection
 	capiInstallConfig, err := clientcmd.BuildConfigFromFlags("", capicfg)
 	if err != nil {
 		return false, err
 	}
-	//	Download the CNI YAML
-	cniYaml := workdir + "/" + "cni.yaml"
-	_, err = utils.DownloadFile(cniYaml, CNIurl)
-	if err != nil {
-		return false, err
-	}
-
-	//	Split the  CNI yaml into individual files
-	err = utils.SplitYamls(workdir+"/"+"cni-output", cniYaml, "---")
-	if err != nil {
-		return false, err
-	}
-
-	//	get a list of those files
-	cniyamlFiles, err := filepath.Glob(workdir + "/" + "cni-output" + "/" + "*.yaml")
-	if err != nil {
-		return false, err
+	if HelmAddons {
+		// Let CAAPH install the CNI from the management cluster
+		err = ApplyCNIHelmChartProxy(kindkconfig, *clusterName, workdir)
+		if err != nil {
+			return false, err
+		}
+		err = waitForCNI(capiInstallConfig, helmCNI)
+		if err != nil {
+			return false, err
+		}
+	} else {
+		err = installCNI(capiInstallConfig, workdir, CNI)
+		if err != nil {
+			return false, err
+		}
 	}
 
-	for _, cniyamlFile := range cniyamlFiles {
-		err = DoSSA(context.TODO(), capiInstallConfig, cniyamlFile)
+	// Run the konnectivity agents, now that the nodes have a network
+	if Konnectivity {
+		err = installKonnectivityAgent(capiInstallConfig, workdir)
 		if err != nil {
-			if !strings.Contains(err.Error(), "is missing in") {
-				return false, err
-			}
-			//log.Warn("Unable to read YAML: ", err)
+			return false, err
 		}
 	}
 
 	// Wait until Nodes are READY
 	log.Info("Waiting for worker nodes to come online")
 
-	// HACK: We sleep to give time for the CNI to rollout
-	//	TODO: Wait until CNI Deployment is done
-	time.Sleep(time.Minute)
-
 	_, err = waitForReadyNodes(capiInstallConfig)
 	if err != nil {
 		return false, err
@@ -878,20 +901,44 @@ func DoSSA(ctx context.Context, cfg *rest.Config, yaml string) error {
 		dr = dyn.Resource(mapping.Resource)
 	}
 
-	// Create object into JSON
-	data, err := json.Marshal(obj)
+	// Create object into JSON, leaving out what doesn't belong in an apply
+	data, err := applyData(obj)
 	if err != nil {
 		return err
 	}
 
+	// Grab what is there now so we can record what the apply changed
+	var before *unstructured.Unstructured
+	if AuditDir != "" {
+		before, err = dr.Get(ctx, obj.GetName(), metav1.GetOptions{})
+		if err != nil {
+			before = nil
+		}
+	}
+
 	// Create or Update the obj with service side apply
 	//     types.ApplyPatchType indicates service side apply
 	//     FieldManager specifies the field owner ID.
-	_, err = dr.Patch(ctx, obj.GetName(), types.ApplyPatchType, data, metav1.PatchOptions{
-		FieldManager: "gokp-bootstrapper",
+	var after *unstructured.Unstructured
+	err = retryApply(obj.GetKind()+" "+obj.GetName(), func() error {
+		var err error
+		after, err = dr.Patch(ctx, obj.GetName(), types.ApplyPatchType, data, metav1.PatchOptions{
+			FieldManager: "gokp-bootstrapper",
+		})
+		return err
 	})
+	if err != nil {
+		return err
+	}
+
+	// Recording is best effort, it shouldn't stop the install
+	if AuditDir != "" {
+		if err := recordDiff(before, after); err != nil {
+			log.Warn("Unable to record diff: ", err)
+		}
+	}
 
-	return err
+	return nil
 }
 
 // waitForAWSInfra waits until the infrastructure is provisioned
@@ -912,22 +959,19 @@ func waitForAWSInfra(restConfig *rest.Config, clustername string) (bool, error)
 		return false, err
 	}
 
-	// wait up until 40 minutes
-	counter := 0
-	for runs := 20; counter <= runs; counter++ {
-		if counter > runs {
-			return false, errors.New("aws infra did not come up after 40 minutes")
-		}
-		// get the current status, wait for "Provisioned"
+	// wait for "Provisioned"
+	err = InfrastructureWait.Until(func() (bool, error) {
 		cluster := &clusterv1.Cluster{}
 		if err := c.Get(context.TODO(), client.ObjectKey{Namespace: "default", Name: clustername}, cluster); err != nil {
 			return false, err
 		}
-		if cluster.Status.Phase == "Provisioned" {
-			break
-		}
-		time.Sleep(time.Minute)
-
+		return cluster.Status.Phase == "Provisioned", nil
+	})
+	if err == clock.ErrTimeout {
+		return false, errors.New("aws infra did not come up after " + InfrastructureWait.Timeout.String())
+	}
+	if err != nil {
+		return false, err
 	}
 	return true, nil
 }
@@ -957,28 +1001,25 @@ func waitForCP(restConfig *rest.Config, clustername string, createHaCluster bool
 		return false, err
 	}
 
-	// wait up until 20 minutes
-	counter := 0
-	for runs := 20; counter <= runs; counter++ {
-		if counter > runs {
-			return false, errors.New("control-plane did not come up after 10 minutes")
-		}
-		// get the current status, wait for 3 CP nodes
-		kcp := &kcpv1.KubeadmControlPlane{}
-
+	// get the current status, wait for the CP nodes
+	err = ControlPlaneWait.Until(func() (bool, error) {
 		kcplist := &kcpv1.KubeadmControlPlaneList{}
 		c.List(context.TODO(), kcplist, client.InNamespace("default"), &client.ListOptions{LabelSelector: labels.SelectorFromSet(map[string]string{"cluster.x-k8s.io/cluster-name": clustername})})
-		cpname := kcplist.Items[0].Name
+		if len(kcplist.Items) == 0 {
+			return false, nil
+		}
 
-		if err := c.Get(context.TODO(), client.ObjectKey{Namespace: "default", Name: cpname}, kcp); err != nil {
+		kcp := &kcpv1.KubeadmControlPlane{}
+		if err := c.Get(context.TODO(), client.ObjectKey{Namespace: "default", Name: kcplist.Items[0].Name}, kcp); err != nil {
 			return false, err
 		}
-		if kcp.Status.Replicas == expectedCPReplicas {
-			break
-		}
-
-		time.Sleep(time.Minute)
-
+		return kcp.Status.Replicas == expectedCPReplicas, nil
+	})
+	if err == clock.ErrTimeout {
+		return false, errors.New("control-plane did not come up after " + ControlPlaneWait.Timeout.String())
+	}
+	if err != nil {
+		return false, err
 	}
 
 	return true, nil
@@ -992,49 +1033,26 @@ func waitForReadyNodes(cfg *rest.Config) (bool, error) {
 		return false, err
 	}
 
-	// Get All nodes
-	nodesClient, err := nodesClientSet.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+	// Wait until every node has the Ready condition
+	err = NodeWait.Until(func() (bool, error) {
+		nodesClient, err := nodesClientSet.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+		if err != nil {
+			return false, err
+		}
+		for _, node := range nodesClient.Items {
+			if !nodeReady(node) {
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+	if err == clock.ErrTimeout {
+		return false, errors.New("nodes took too long to come up")
+	}
 	if err != nil {
 		return false, err
 	}
 
-	// Let's range over all nodes and wait until they're ready
-	for _, node := range nodesClient.Items {
-		// We are going to range over the conditions
-		for _, i := range node.Status.Conditions {
-			// we only care about if the Kublet is ready
-			if i.Reason == "KubeletReady" {
-				// set a counter so we don't run forever
-				c := 0
-				for r := 100; c <= r; c++ {
-					// If we're here, we waited too long
-					if c > r {
-						return false, errors.New("nodes took too long to come up")
-					}
-					if i.Type == "Ready" {
-						break
-					}
-					//sleep for 10 seconds
-					time.Sleep(10 * time.Second)
-				}
-
-			}
-		}
-		// trying to wait until they're ready
-		// TODO: Currently doesn't do what I thin kit does. Save for later
-		/*
-			for _, t := range node.Spec.Taints {
-				counter := 0
-				for ok := true; ok; ok = (t.Key == "node.kubernetes.io/not-ready") {
-					if counter > 50 {
-						return false, errors.New("nodes still tainted with not ready")
-					}
-					time.Sleep(10 * time.Second)
-					counter++
-				}
-			}
-		*/
-	}
 	// Label workers as such - First select the non control-plane nodes
 	workers, err := nodesClientSet.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{
 		LabelSelector: `!node-role.kubernetes.io/control-plane`,
@@ -1223,6 +1241,103 @@ func MoveMgmtCluster(src string, dest string, capiImplementation string) (bool,
 			InfrastructureProviders: []string{"aws"},
 		})
 
+		if err != nil {
+			return false, err
+		}
+	} else if capiImplementation == "capoci" {
+		err = exportOCICredentials(srcclientset)
+		if err != nil {
+			return false, err
+		}
+		_, err = c.Init(capiclient.InitOptions{
+			Kubeconfig:              capiclient.Kubeconfig{Path: dest},
+			InfrastructureProviders: []string{"oci"},
+		})
+		if err != nil {
+			return false, err
+		}
+	} else if capiImplementation == "capibm" {
+		err = exportIBMCloudCredentials(srcclientset)
+		if err != nil {
+			return false, err
+		}
+		_, err = c.Init(capiclient.InitOptions{
+			Kubeconfig:              capiclient.Kubeconfig{Path: dest},
+			InfrastructureProviders: []string{"ibmcloud"},
+		})
+		if err != nil {
+			return false, err
+		}
+	} else if capiImplementation == "capl" {
+		err = exportLinodeCredentials(srcclientset)
+		if err == nil {
+			err = addUserProvider(LinodeProviderName, LinodeComponentsURL)
+		}
+		if err != nil {
+			return false, err
+		}
+		_, err = c.Init(capiclient.InitOptions{
+			Kubeconfig:              capiclient.Kubeconfig{Path: dest},
+			InfrastructureProviders: []string{LinodeProviderName},
+		})
+		if err != nil {
+			return false, err
+		}
+	} else if capiImplementation == "capmox" {
+		err = exportProxmoxCredentials(srcclientset)
+		if err == nil {
+			err = addUserProvider(ProxmoxProviderName, ProxmoxComponentsURL)
+		}
+		if err != nil {
+			return false, err
+		}
+		_, err = c.Init(capiclient.InitOptions{
+			Kubeconfig:              capiclient.Kubeconfig{Path: dest},
+			InfrastructureProviders: []string{ProxmoxProviderName},
+		})
+		if err != nil {
+			return false, err
+		}
+
+		// The IP pools need somewhere to go
+		ipamWorkdir, err := utils.CreateWorkDir()
+		if err != nil {
+			return false, err
+		}
+		defer os.RemoveAll(ipamWorkdir)
+		err = InstallIPAMProvider(dest, ipamWorkdir)
+		if err != nil {
+			return false, err
+		}
+	} else if capiImplementation == "capm3" {
+		err = exportMetal3IronicSettings(srcclientset)
+		if err != nil {
+			return false, err
+		}
+		_, err = c.Init(capiclient.InitOptions{
+			Kubeconfig:              capiclient.Kubeconfig{Path: dest},
+			InfrastructureProviders: []string{"metal3"},
+		})
+		if err != nil {
+			return false, err
+		}
+
+		// The hosts need somewhere to go
+		bmoWorkdir, err := utils.CreateWorkDir()
+		if err != nil {
+			return false, err
+		}
+		defer os.RemoveAll(bmoWorkdir)
+		err = InstallBMO(dest, bmoWorkdir)
+		if err != nil {
+			return false, err
+		}
+	} else if capiImplementation == "byoh" {
+		// The host agents are pointed at the new cluster once the hosts are moved
+		_, err = c.Init(capiclient.InitOptions{
+			Kubeconfig:              capiclient.Kubeconfig{Path: dest},
+			InfrastructureProviders: []string{"byoh"},
+		})
 		if err != nil {
 			return false, err
 		}
@@ -1232,24 +1347,10 @@ func MoveMgmtCluster(src string, dest string, capiImplementation string) (bool,
 			Kubeconfig:              capiclient.Kubeconfig{Path: dest},
 			InfrastructureProviders: []string{"azure"},
 		})
-		// Check to see if it's rolled out, if not then wait 20 seconds and check again. Stop after 15x
-		counter := 0
-		for runs := 15; counter <= runs; counter++ {
-			capzClient := destclientset.AppsV1().Deployments("capz-system")
-			if counter > runs {
-				return false, errors.New("CAPI Controller took too long to roll out")
-			}
-			capzDeployment, err := capzClient.Get(context.TODO(), "capz-controller-manager", metav1.GetOptions{})
-			if err != nil {
-				return false, err
-			}
-
-			availableReplicas := capzDeployment.Status.AvailableReplicas
-			if availableReplicas > int32(0) {
-				time.Sleep(20 * time.Second)
-				break
-			}
-			time.Sleep(20 * time.Second)
+		// Wait for it to roll out
+		err = waitForController(destclientset, "capz-system", "capz-controller-manager", "CAPI Controller")
+		if err != nil {
+			return false, err
 		}
 		if err != nil {
 			return false, err
@@ -1288,7 +1389,7 @@ func WaitForDeletion(dynclient client.Client, obj client.Object, retryInterval,
 	//kind := obj.GetObjectKind().GroupVersionKind().Kind
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
-	err := wait.Poll(retryInterval, timeout, func() (done bool, err error) {
+	err := clock.Waiter{Interval: retryInterval, Timeout: timeout}.Until(func() (done bool, err error) {
 		err = dynclient.Get(ctx, key, obj)
 		if apierrors.IsNotFound(err) {
 			return true, nil
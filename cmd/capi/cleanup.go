@@ -0,0 +1,79 @@
+package capi
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/clientcmd"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ClusterExists returns true if there's a cluster with the name on the management cluster of the kubeconfig
+func ClusterExists(cfg string, name string) (bool, error) {
+	restConfig, err := clientcmd.BuildConfigFromFlags("", cfg)
+	if err != nil {
+		return false, err
+	}
+	dyn, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return false, err
+	}
+
+	clusterGVR := schema.GroupVersionResource{Group: "cluster.x-k8s.io", Version: "v1beta1", Resource: "clusters"}
+	_, err = dyn.Resource(clusterGVR).Namespace("default").Get(context.TODO(), name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// DeletePartialCluster deletes the cluster from the management cluster of the kubeconfig, and waits for CAPI to
+// remove what it had created for it. Unlike DeleteCluster it doesn't wait for the infrastructure to come up first,
+// so it can be used on a cluster whose install failed. It's fine if the cluster was never created
+func DeletePartialCluster(cfg string, name string) error {
+	// We need to load the scheme since it's not part of the core API
+	scheme := runtime.NewScheme()
+	err := clusterv1.AddToScheme(scheme)
+	if err != nil {
+		return err
+	}
+
+	restConfig, err := clientcmd.BuildConfigFromFlags("", cfg)
+	if err != nil {
+		return err
+	}
+	c, err := client.New(restConfig, client.Options{
+		Scheme: scheme,
+	})
+	if err != nil {
+		return err
+	}
+
+	cluster := &clusterv1.Cluster{}
+	err = c.Get(context.TODO(), client.ObjectKey{Namespace: "default", Name: name}, cluster)
+	if apierrors.IsNotFound(err) {
+		log.Info("Cluster ", name, " was never created, there's nothing to delete")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Info("Deleting cluster: ", name)
+	if err = c.Delete(context.TODO(), cluster, &client.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+
+	return WaitForDeletion(c, cluster, 10*time.Second, time.Hour)
+}
@@ -0,0 +1,57 @@
+package capi
+
+import (
+	"context"
+	"strings"
+
+	"github.com/christianh814/gokp/cmd/cni"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// CNI is the name of the CNI installer used (see the cni package for what's available), or cni.None
+var CNI string = "calico"
+
+// azureCNI is the CNI installer used on Azure instead of Calico, which needs the VXLAN flavor of Calico
+var azureCNI string = "calico-azure"
+
+// installCNI applies the YAML of the named CNI to the cluster and waits for it to roll out. The YAML that's
+// applied is left in the workdir as cni.yaml
+func installCNI(cfg *rest.Config, workdir string, name string) error {
+	if name == cni.None {
+		log.Info("Not installing a CNI, the nodes are Ready once the one of the cluster template is")
+		return nil
+	}
+
+	installer, err := cni.Get(name)
+	if err != nil {
+		return err
+	}
+
+	cniyamlFiles, err := installer.Manifests(workdir)
+	if err != nil {
+		return err
+	}
+
+	for _, cniyamlFile := range cniyamlFiles {
+		err = DoSSA(context.TODO(), cfg, cniyamlFile)
+		if err != nil {
+			if !strings.Contains(err.Error(), "is missing in") {
+				return err
+			}
+			//log.Warn("Unable to read YAML: ", err)
+		}
+	}
+
+	return waitForCNI(cfg, installer)
+}
+
+// waitForCNI waits until the CNI has rolled out on the cluster
+func waitForCNI(cfg *rest.Config, installer cni.Installer) error {
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return err
+	}
+	return cni.WaitForReady(clientset, installer)
+}
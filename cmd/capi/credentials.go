@@ -0,0 +1,114 @@
+package capi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/christianh814/gokp/cmd/clock"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	creds "sigs.k8s.io/cluster-api-provider-aws/cmd/clusterawsadm/credentials"
+)
+
+// AWSCredentialsNamespace is where CAPA runs
+var AWSCredentialsNamespace string = "capa-system"
+
+// AWSCredentialsSecret is the secret CAPA keeps the credentials file it talks to AWS with in
+var AWSCredentialsSecret string = "capa-manager-bootstrap-credentials"
+
+// awsControllerName is the deployment of CAPA that uses the credentials
+var awsControllerName string = "capa-controller-manager"
+
+// ValidateAWSCredentials makes sure AWS takes the credentials, and returns the ARN they belong to
+func ValidateAWSCredentials(c creds.AWSCredentials) (string, error) {
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String(c.Region),
+		Credentials: credentials.NewStaticCredentials(c.AccessKeyID, c.SecretAccessKey, c.SessionToken),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	identity, err := sts.New(sess).GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", errors.New("AWS doesn't take the credentials: " + err.Error())
+	}
+	return aws.StringValue(identity.Arn), nil
+}
+
+// RotateAWSCredentials replaces the credentials of CAPA on the cluster of the kubeconfig, and restarts its
+// controller so they're used right away. It returns the credentials file that's now in the Secret
+func RotateAWSCredentials(kubeconfig string, c creds.AWSCredentials) ([]byte, error) {
+	profile, err := c.RenderAWSDefaultProfile()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := clientset.CoreV1().Secrets(AWSCredentialsNamespace).Get(context.TODO(), AWSCredentialsSecret, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+	secret.Data["credentials"] = []byte(profile)
+	log.Info("Updating secret ", AWSCredentialsNamespace, "/", AWSCredentialsSecret)
+	_, err = clientset.CoreV1().Secrets(AWSCredentialsNamespace).Update(context.TODO(), secret, metav1.UpdateOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	// The controller only reads the credentials when it starts
+	log.Info("Restarting ", awsControllerName)
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"annotations": map[string]string{
+						"kubectl.kubernetes.io/restartedAt": time.Now().Format(time.RFC3339),
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	_, err = clientset.AppsV1().Deployments(AWSCredentialsNamespace).Patch(context.TODO(), awsControllerName, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	// Wait for the restart to roll out
+	err = ControllerWait.Until(func() (bool, error) {
+		d, err := clientset.AppsV1().Deployments(AWSCredentialsNamespace).Get(context.TODO(), awsControllerName, metav1.GetOptions{})
+		return err == nil && d.Status.ObservedGeneration >= d.Generation && d.Spec.Replicas != nil &&
+			d.Status.UpdatedReplicas == *d.Spec.Replicas && d.Status.AvailableReplicas == *d.Spec.Replicas && d.Status.Replicas == *d.Spec.Replicas, nil
+	})
+	if err == nil {
+		return []byte(profile), nil
+	}
+	if err != clock.ErrTimeout {
+		return nil, err
+	}
+
+	return nil, errors.New(awsControllerName + " didn't restart with the new credentials")
+}
@@ -0,0 +1,71 @@
+package capi
+
+import (
+	"errors"
+	"os"
+
+	"github.com/christianh814/gokp/cmd/encryption"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// EncryptSecrets has the API server encrypt secrets at rest (in etcd) with a key that's kept in a Secret next to
+// the cluster, and never in the GitOps repo
+var EncryptSecrets bool = false
+
+// applyEncryption changes the generated cluster YAML so the control plane encrypts secrets at rest, and adds the
+// Secret with the encryption configuration to it
+func applyEncryption(installClusterYaml string) error {
+	// Find the cluster the Secret goes with
+	clusterName, namespace := "", "default"
+	err := patchInstallYaml(installClusterYaml, func(obj *unstructured.Unstructured) (bool, error) {
+		if obj.GetKind() == "Cluster" {
+			clusterName = obj.GetName()
+			if obj.GetNamespace() != "" {
+				namespace = obj.GetNamespace()
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		return err
+	}
+	if clusterName == "" {
+		return errors.New("no Cluster found in " + installClusterYaml)
+	}
+
+	key, err := encryption.NewKey()
+	if err != nil {
+		return err
+	}
+	secret, err := encryption.NewSecret(clusterName, namespace, []encryption.Key{key})
+	if err != nil {
+		return err
+	}
+
+	err = patchInstallYaml(installClusterYaml, func(obj *unstructured.Unstructured) (bool, error) {
+		if obj.GetKind() != "KubeadmControlPlane" {
+			return false, nil
+		}
+		return true, encryption.SetSecret(obj, secret.Name)
+	})
+	if err != nil {
+		return err
+	}
+
+	// The key is in the Secret, keep it to ourselves
+	b, err := yaml.Marshal(secret)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(installClusterYaml, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.WriteString("\n---\n" + string(b))
+	if err != nil {
+		return err
+	}
+	return os.Chmod(installClusterYaml, 0600)
+}
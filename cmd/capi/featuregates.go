@@ -0,0 +1,113 @@
+package capi
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// FeatureGates are the Kubernetes feature gates turned on (or off) on the API server, controller manager,
+// scheduler, and kubelets of a cluster. If empty, the defaults of the Kubernetes version are kept
+var FeatureGates map[string]bool
+
+// featureGatesArg is the flag of the Kubernetes components that takes the feature gates
+var featureGatesArg string = "feature-gates"
+
+// ParseFeatureGates returns the feature gates given as Name=true or Name=false
+func ParseFeatureGates(gates []string) (map[string]bool, error) {
+	fg := map[string]bool{}
+	for _, gate := range gates {
+		kv := strings.SplitN(gate, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return nil, errors.New("invalid feature gate " + gate + ", it should be Name=true or Name=false")
+		}
+		enabled, err := strconv.ParseBool(strings.TrimSpace(kv[1]))
+		if err != nil {
+			return nil, errors.New("invalid feature gate " + gate + ", it should be Name=true or Name=false")
+		}
+		fg[strings.TrimSpace(kv[0])] = enabled
+	}
+
+	// If we're here, we should be okay
+	return fg, nil
+}
+
+// FeatureGatesString returns the feature gates the way the Kubernetes components take them (e.g. A=true,B=false)
+func FeatureGatesString(fg map[string]bool) string {
+	names := []string{}
+	for name := range fg {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	gates := []string{}
+	for _, name := range names {
+		gates = append(gates, name+"="+strconv.FormatBool(fg[name]))
+	}
+	return strings.Join(gates, ",")
+}
+
+// applyFeatureGates changes the generated cluster YAML so the kubeadm configuration of the control plane and the
+// workers passes the FeatureGates to the Kubernetes components. Feature gates the cluster template sets already are
+// kept, unless they're given too
+func applyFeatureGates(installClusterYaml string) error {
+	return patchInstallYaml(installClusterYaml, func(obj *unstructured.Unstructured) (bool, error) {
+		var args [][]string
+		switch obj.GetKind() {
+		case "KubeadmControlPlane":
+			args = [][]string{
+				{"spec", "kubeadmConfigSpec", "clusterConfiguration", "apiServer", "extraArgs"},
+				{"spec", "kubeadmConfigSpec", "clusterConfiguration", "controllerManager", "extraArgs"},
+				{"spec", "kubeadmConfigSpec", "clusterConfiguration", "scheduler", "extraArgs"},
+				{"spec", "kubeadmConfigSpec", "initConfiguration", "nodeRegistration", "kubeletExtraArgs"},
+				{"spec", "kubeadmConfigSpec", "joinConfiguration", "nodeRegistration", "kubeletExtraArgs"},
+			}
+		case "KubeadmConfigTemplate":
+			args = [][]string{
+				{"spec", "template", "spec", "joinConfiguration", "nodeRegistration", "kubeletExtraArgs"},
+			}
+		default:
+			return false, nil
+		}
+
+		for _, fields := range args {
+			extraArgs, _, err := unstructured.NestedStringMap(obj.Object, fields...)
+			if err != nil {
+				return false, err
+			}
+			if extraArgs == nil {
+				extraArgs = map[string]string{}
+			}
+
+			fg, err := ParseFeatureGates(splitFeatureGates(extraArgs[featureGatesArg]))
+			if err != nil {
+				return false, errors.New(obj.GetKind() + " " + obj.GetName() + ": " + err.Error())
+			}
+			for name, enabled := range FeatureGates {
+				fg[name] = enabled
+			}
+			extraArgs[featureGatesArg] = FeatureGatesString(fg)
+
+			err = unstructured.SetNestedStringMap(obj.Object, extraArgs, fields...)
+			if err != nil {
+				return false, err
+			}
+		}
+
+		return true, nil
+	})
+}
+
+// splitFeatureGates returns the feature gates of a --feature-gates value, one per item
+func splitFeatureGates(v string) []string {
+	gates := []string{}
+	for _, gate := range strings.Split(v, ",") {
+		if strings.TrimSpace(gate) != "" {
+			gates = append(gates, gate)
+		}
+	}
+	return gates
+}
@@ -0,0 +1,126 @@
+package capi
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/christianh814/gokp/cmd/cni"
+	"github.com/christianh814/gokp/cmd/templates"
+	"github.com/christianh814/gokp/cmd/utils"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// HelmAddons installs the CAPI Helm add-on provider (CAAPH) and lets it install the CNI as a HelmChartProxy
+// instead of us applying the CNI YAML directly
+var HelmAddons bool = false
+
+// CAAPHurl is where the CAAPH components are installed from
+var CAAPHurl string = "https://github.com/kubernetes-sigs/cluster-api-addon-provider-helm/releases/download/v0.1.0-alpha.10/addon-components.yaml"
+
+// CalicoChartVersion is the version of the tigera-operator chart the HelmChartProxy installs
+var CalicoChartVersion string = "v3.24.1"
+
+// CNIHelmChartProxyFile is the name of the HelmChartProxy file written to the workdir
+var CNIHelmChartProxyFile string = "cni-helmchartproxy.yaml"
+
+// helmCNI is how we tell the CNI installed by the HelmChartProxy has rolled out. The tigera-operator runs
+// calico-node in calico-system instead of kube-system
+var helmCNI cni.Installer = &cni.ManifestInstaller{
+	CNIName:   "calico",
+	Namespace: "calico-system",
+	DaemonSet: "calico-node",
+}
+
+// InstallHelmAddonProvider installs CAAPH on the cluster of the given kubeconfig. It needs cert-manager,
+// which is there on any cluster that has had "clusterctl init" run against it
+func InstallHelmAddonProvider(kubeconfig string, workdir string) error {
+	log.Info("Installing the CAPI Helm add-on provider")
+	cfg, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	// Download the CAAPH YAML and split it into individual files
+	caaphYaml := workdir + "/" + "caaph-components.yaml"
+	_, err = utils.DownloadFile(caaphYaml, CAAPHurl)
+	if err != nil {
+		return err
+	}
+	err = utils.SplitYamls(workdir+"/"+"caaph-output", caaphYaml, "---")
+	if err != nil {
+		return err
+	}
+	yamlFiles, err := filepath.Glob(workdir + "/" + "caaph-output" + "/" + "*.yaml")
+	if err != nil {
+		return err
+	}
+
+	// The CRDs have to be established before the CRs can be applied, so we try a few times
+	for _, yamlFile := range yamlFiles {
+		err = applyOnceEstablished(cfg, yamlFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Wait for it to roll out
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return err
+	}
+	err = waitForController(clientset, "caaph-system", "caaph-controller-manager", "CAAPH Controller")
+	if err != nil {
+		return err
+	}
+
+	// If we're here, we should be okay
+	return nil
+}
+
+// ApplyCNIHelmChartProxy labels the cluster so it's selected by the CNI HelmChartProxy and applies it. The
+// HelmChartProxy is written to the workdir so it can be added to the GitOps repo
+func ApplyCNIHelmChartProxy(kubeconfig string, clusterName string, workdir string) error {
+	log.Info("Installing the CNI with the CAPI Helm add-on provider")
+	cfg, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	// Label the cluster so the HelmChartProxy picks it up
+	dyn, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		return err
+	}
+	clusterGVR := schema.GroupVersionResource{Group: "cluster.x-k8s.io", Version: "v1beta1", Resource: "clusters"}
+	patch := []byte(`{"metadata":{"labels":{"gokp.io/cni":"calico"}}}`)
+	_, err = dyn.Resource(clusterGVR).Namespace("default").Patch(context.TODO(), clusterName, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return err
+	}
+
+	// Write out the HelmChartProxy and apply it
+	chartVars := struct {
+		CalicoVersion string
+	}{
+		CalicoVersion: CalicoChartVersion,
+	}
+	hcpFile := workdir + "/" + CNIHelmChartProxyFile
+	_, err = utils.WriteTemplate(templates.CalicoHelmChartProxy, hcpFile, chartVars)
+	if err != nil {
+		return err
+	}
+
+	err = DoSSA(context.TODO(), cfg, hcpFile)
+	if err != nil {
+		return err
+	}
+
+	// If we're here, we should be okay
+	return nil
+}
@@ -0,0 +1,272 @@
+package capi
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/christianh814/gokp/cmd/utils"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	capiclient "sigs.k8s.io/cluster-api/cmd/clusterctl/client"
+)
+
+// ibmcloudNamespace is where CAPIBM runs
+var ibmcloudNamespace string = "capi-ibmcloud-system"
+
+// ibmcloudCredentialsSecret is the secret CAPIBM keeps the credentials file it was installed with in
+var ibmcloudCredentialsSecret string = "capibm-manager-bootstrap-credentials"
+
+// IBMCloudNodeProfile is the profile of the worker nodes. The cluster template uses the one in IBMVPC_PROFILE for
+// every node, so it's only needed if the workers should be different from the control plane
+var IBMCloudNodeProfile string
+
+// CreateIBMCloudK8sInstance creates a K8S cluster on IBM Cloud VPC (Gen2) with CAPIBM
+func CreateIBMCloudK8sInstance(kindkconfig string, clusterName *string, workdir string, ibmcreds map[string]string, capicfg string, createHaCluster bool) (bool, error) {
+	// Export IBM Cloud settings as Env vars, CAPIBM is installed with the API key from there
+	for k := range ibmcreds {
+		os.Setenv(k, ibmcreds[k])
+	}
+
+	// Set up variables
+	var cpMachineCount int64
+	var workerMachineCount int64
+
+	// init IBM Cloud provider into the Kind instance
+	log.Info("Initializing IBM Cloud provider")
+	c, err := capiclient.New("")
+	if err != nil {
+		return false, err
+	}
+
+	_, err = c.Init(capiclient.InitOptions{
+		Kubeconfig:              capiclient.Kubeconfig{Path: kindkconfig},
+		InfrastructureProviders: []string{"ibmcloud"},
+		LogUsageInstructions:    false,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	//	Set up options to write out the install YAML
+	if createHaCluster {
+		// If HA was requested we create it
+		cpMachineCount = 3
+		workerMachineCount = 3
+	} else {
+		// If HA was NOT requested we create a small cluster
+		cpMachineCount = 1
+		workerMachineCount = 2
+	}
+	if WorkerMachineCount > 0 {
+		workerMachineCount = WorkerMachineCount
+	}
+	cto := capiclient.GetClusterTemplateOptions{
+		Kubeconfig:               capiclient.Kubeconfig{Path: kindkconfig},
+		ClusterName:              *clusterName,
+		ControlPlaneMachineCount: &cpMachineCount,
+		WorkerMachineCount:       &workerMachineCount,
+		KubernetesVersion:        KubernetesVersion,
+		TargetNamespace:          "default",
+	}
+
+	//	Load up the config with the options
+	installYaml, err := c.GetClusterTemplate(cto)
+	if err != nil {
+		return false, err
+	}
+
+	// Write the install file out
+	installClusterYaml := workdir + "/" + "install-cluster.yaml"
+	err = utils.WriteYamlOutput(installYaml, installClusterYaml)
+	if err != nil {
+		return false, err
+	}
+
+	// Replace the workers the way that was asked for
+	if RolloutStrategy != nil {
+		err = applyRolloutStrategy(installClusterYaml)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Turn on the feature gates that were asked for
+	if len(FeatureGates) > 0 {
+		err = applyFeatureGates(installClusterYaml)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Reach the nodes through konnectivity if asked for
+	if Konnectivity {
+		err = applyKonnectivity(installClusterYaml)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Encrypt secrets at rest if asked for
+	if EncryptSecrets {
+		err = applyEncryption(installClusterYaml)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Give the workers their own profile
+	if IBMCloudNodeProfile != "" {
+		err = patchInstallYaml(installClusterYaml, func(obj *unstructured.Unstructured) (bool, error) {
+			if obj.GetKind() != "IBMVPCMachineTemplate" || obj.GetName() != *clusterName+"-md-0" {
+				return false, nil
+			}
+			return true, unstructured.SetNestedField(obj.Object, IBMCloudNodeProfile, "spec", "template", "spec", "profile")
+		})
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Install the CAPI Helm add-on provider if we're using it for the CNI
+	if HelmAddons {
+		err = InstallHelmAddonProvider(kindkconfig, workdir)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Apply the YAML to the KIND instance so that the cluster gets installed on IBM Cloud
+	log.Info("Preflight complete, installing cluster")
+
+	//	use clientcmd to apply the configuration
+	clusterInstallConfig, err := clientcmd.BuildConfigFromFlags("", kindkconfig)
+	if err != nil {
+		return false, err
+	}
+
+	// Create clientset to check the status
+	clientset, err := kubernetes.NewForConfig(clusterInstallConfig)
+	if err != nil {
+		return false, err
+	}
+
+	// Wait for it to roll out
+	err = waitForController(clientset, ibmcloudNamespace, "capi-ibmcloud-controller-manager", "CAPI Controller")
+	if err != nil {
+		return false, err
+	}
+
+	//	Split the one yaml CAPI gives you into individual files
+	err = utils.SplitYamls(workdir+"/"+"capi-install-yamls-output", installClusterYaml, "---")
+	if err != nil {
+		return false, err
+	}
+
+	//	get a list of those files
+	yamlFiles, err := filepath.Glob(workdir + "/" + "capi-install-yamls-output" + "/" + "*.yaml")
+	if err != nil {
+		return false, err
+	}
+
+	for _, yamlFile := range yamlFiles {
+		err = DoSSA(context.TODO(), clusterInstallConfig, yamlFile)
+		if err != nil {
+			log.Warn("Unable to read YAML: ", err)
+		}
+	}
+
+	//	First, wait for the infra to appear
+	_, err = waitForAWSInfra(clusterInstallConfig, *clusterName)
+	if err != nil {
+		return false, err
+	}
+
+	//	Then, wait for the CP to appear
+	_, err = waitForCP(clusterInstallConfig, *clusterName, createHaCluster)
+	if err != nil {
+		return false, err
+	}
+
+	log.Info("Control Plane Nodes are Online, saving Kubeconfig")
+
+	// Write out CAPI kubeconfig and save it
+	clusterKubeconfig, err := c.GetKubeconfig(capiclient.GetKubeconfigOptions{
+		Kubeconfig:          capiclient.Kubeconfig{Path: kindkconfig},
+		WorkloadClusterName: *clusterName,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	clusterkcfg, err := os.Create(capicfg)
+	if err != nil {
+		return false, err
+	}
+	clusterkcfg.WriteString(clusterKubeconfig)
+	clusterkcfg.Close()
+
+	//Apply the CNI solution, waiting for it to roll out
+
+	// Set up the Capi CFG connection
+	capiInstallConfig, err := clientcmd.BuildConfigFromFlags("", capicfg)
+	if err != nil {
+		return false, err
+	}
+	if HelmAddons {
+		// Let CAAPH install the CNI from the management cluster
+		err = ApplyCNIHelmChartProxy(kindkconfig, *clusterName, workdir)
+		if err != nil {
+			return false, err
+		}
+		err = waitForCNI(capiInstallConfig, helmCNI)
+		if err != nil {
+			return false, err
+		}
+	} else {
+		err = installCNI(capiInstallConfig, workdir, CNI)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Run the konnectivity agents, now that the nodes have a network
+	if Konnectivity {
+		err = installKonnectivityAgent(capiInstallConfig, workdir)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Wait until Nodes are READY
+	log.Info("Waiting for worker nodes to come online")
+	_, err = waitForReadyNodes(capiInstallConfig)
+	if err != nil {
+		return false, err
+	}
+
+	// If we're here, that means everything turned out okay
+	log.Info("Successfully created IBM Cloud Kubernetes Cluster")
+	return true, nil
+}
+
+// exportIBMCloudCredentials exports the API key CAPIBM needs to be installed on another cluster from the credentials
+// file it keeps in a secret on the cluster of the given clientset
+func exportIBMCloudCredentials(clientset *kubernetes.Clientset) error {
+	secret, err := clientset.CoreV1().Secrets(ibmcloudNamespace).Get(context.TODO(), ibmcloudCredentialsSecret, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	for _, line := range strings.Split(string(secret.Data["ibm-credentials.env"]), "\n") {
+		if strings.HasPrefix(line, "IBMCLOUD_APIKEY=") {
+			os.Setenv("IBMCLOUD_API_KEY", strings.TrimSpace(strings.TrimPrefix(line, "IBMCLOUD_APIKEY=")))
+			return nil
+		}
+	}
+	return errors.New("no API key found in " + ibmcloudCredentialsSecret)
+}
@@ -0,0 +1,48 @@
+package capi
+
+import (
+	"io/ioutil"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// patchInstallYaml lets patch change the objects of the generated cluster YAML. Only the documents it changed are
+// re-encoded, the rest are written back as they were
+func patchInstallYaml(installClusterYaml string, patch func(obj *unstructured.Unstructured) (bool, error)) error {
+	b, err := ioutil.ReadFile(installClusterYaml)
+	if err != nil {
+		return err
+	}
+
+	docs := []string{}
+	for _, doc := range strings.Split(string(b), "\n---") {
+		j, err := yaml.YAMLToJSON([]byte(doc))
+		if err != nil {
+			return err
+		}
+		obj := &unstructured.Unstructured{}
+		if string(j) == "null" || obj.UnmarshalJSON(j) != nil {
+			docs = append(docs, doc)
+			continue
+		}
+
+		changed, err := patch(obj)
+		if err != nil {
+			return err
+		}
+		if !changed {
+			docs = append(docs, doc)
+			continue
+		}
+
+		y, err := yaml.Marshal(obj.Object)
+		if err != nil {
+			return err
+		}
+		docs = append(docs, "\n"+string(y))
+	}
+
+	return ioutil.WriteFile(installClusterYaml, []byte(strings.Join(docs, "\n---")), 0644)
+}
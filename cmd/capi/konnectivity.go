@@ -0,0 +1,131 @@
+package capi
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strconv"
+
+	"github.com/christianh814/gokp/cmd/clock"
+	"github.com/christianh814/gokp/cmd/cni"
+	"github.com/christianh814/gokp/cmd/konnectivity"
+	"github.com/christianh814/gokp/cmd/utils"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// Konnectivity has the API server reach the nodes (for logs, exec, port-forward, and webhooks) through a
+// konnectivity server on the control plane, which agents on the nodes connect out to. This is for when the control
+// plane can't reach the nodes directly, like private clusters and nodes in another network
+var Konnectivity bool = false
+
+// KonnectivityServerHost is the host the agents connect to the konnectivity server on. If empty, it's the host of
+// the control plane endpoint
+var KonnectivityServerHost string = ""
+
+// applyKonnectivity changes the generated cluster YAML so the control plane runs the konnectivity server and the API
+// server uses it for the traffic to the cluster
+func applyKonnectivity(installClusterYaml string) error {
+	files, err := konnectivity.ControlPlaneFiles()
+	if err != nil {
+		return err
+	}
+
+	return patchInstallYaml(installClusterYaml, func(obj *unstructured.Unstructured) (bool, error) {
+		if obj.GetKind() != "KubeadmControlPlane" {
+			return false, nil
+		}
+
+		// Point the API server at the egress selector configuration, and give it the dir of the socket
+		extraArgs, _, err := unstructured.NestedStringMap(obj.Object, "spec", "kubeadmConfigSpec", "clusterConfiguration", "apiServer", "extraArgs")
+		if err != nil {
+			return false, err
+		}
+		if extraArgs == nil {
+			extraArgs = map[string]string{}
+		}
+		extraArgs["egress-selector-config-file"] = konnectivity.EgressSelectorConfigFile
+		err = unstructured.SetNestedStringMap(obj.Object, extraArgs, "spec", "kubeadmConfigSpec", "clusterConfiguration", "apiServer", "extraArgs")
+		if err != nil {
+			return false, err
+		}
+		err = appendToSlice(obj, []string{"spec", "kubeadmConfigSpec", "clusterConfiguration", "apiServer", "extraVolumes"}, map[string]interface{}{
+			"name":      "konnectivity-uds",
+			"hostPath":  konnectivity.Dir,
+			"mountPath": konnectivity.Dir,
+			"readOnly":  false,
+			"pathType":  "DirectoryOrCreate",
+		})
+		if err != nil {
+			return false, err
+		}
+
+		// Write out the server, and start it once kubeadm has set up the CA
+		for _, f := range files {
+			err = appendToSlice(obj, []string{"spec", "kubeadmConfigSpec", "files"}, map[string]interface{}{
+				"path":        f.Path,
+				"owner":       "root:root",
+				"permissions": f.Permissions,
+				"content":     f.Content,
+			})
+			if err != nil {
+				return false, err
+			}
+		}
+		err = appendToSlice(obj, []string{"spec", "kubeadmConfigSpec", "postKubeadmCommands"}, konnectivity.SetupCommand())
+		if err != nil {
+			return false, err
+		}
+
+		return true, nil
+	})
+}
+
+// appendToSlice adds the value to the end of the list at the fields of the object, creating it if it's not there
+func appendToSlice(obj *unstructured.Unstructured, fields []string, value interface{}) error {
+	list, _, err := unstructured.NestedSlice(obj.Object, fields...)
+	if err != nil {
+		return err
+	}
+	return unstructured.SetNestedSlice(obj.Object, append(list, value), fields...)
+}
+
+// installKonnectivityAgent applies the konnectivity agents to the cluster and waits for them to roll out. The YAML
+// that's applied is left in the workdir as konnectivity.AgentFile
+func installKonnectivityAgent(cfg *rest.Config, workdir string) error {
+	log.Info("Installing the konnectivity agents")
+	agentYaml, err := konnectivity.WriteAgentManifest(workdir, cfg.Host, KonnectivityServerHost)
+	if err != nil {
+		return err
+	}
+	err = utils.SplitYamls(workdir+"/"+"konnectivity-output", agentYaml, "---")
+	if err != nil {
+		return err
+	}
+	agentYamlFiles, err := filepath.Glob(workdir + "/" + "konnectivity-output" + "/" + "*.yaml")
+	if err != nil {
+		return err
+	}
+	for _, agentYamlFile := range agentYamlFiles {
+		err = DoSSA(context.TODO(), cfg, agentYamlFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Wait for the agents to roll out
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return err
+	}
+	log.Info("Waiting for the konnectivity agents to roll out")
+	err = cni.RolloutWait.Until(func() (bool, error) {
+		return cni.DaemonSetReady(clientset, "kube-system", "konnectivity-agent")
+	})
+	if err != clock.ErrTimeout {
+		return err
+	}
+	return errors.New("the konnectivity agents took too long to roll out, make sure the nodes can reach the control plane on port " + strconv.Itoa(konnectivity.AgentPort))
+}
@@ -0,0 +1,266 @@
+package capi
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/christianh814/gokp/cmd/utils"
+	log "github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	capiclient "sigs.k8s.io/cluster-api/cmd/clusterctl/client"
+)
+
+// kubevirtNamespace is where CAPK runs
+var kubevirtNamespace string = "capk-system"
+
+// KubeVirtControlPlaneServiceType is the type of the Service the API server of the cluster is exposed with on the
+// management cluster. It has to be reachable from where GOKP runs, so it's a LoadBalancer unless told otherwise
+var KubeVirtControlPlaneServiceType string = "LoadBalancer"
+
+// CreateKubeVirtK8sInstance creates a K8S cluster of KubeVirt VMs with CAPK. The cluster the VMs run on is the
+// management cluster, so CAPK is installed there (if it isn't already) and the CAPI objects are never moved
+func CreateKubeVirtK8sInstance(mgmtkconfig string, clusterName *string, workdir string, kubevirtvars map[string]string, capicfg string, createHaCluster bool) (bool, error) {
+	// Export the VM settings as Env vars, they're what the template is filled in with
+	for k := range kubevirtvars {
+		os.Setenv(k, kubevirtvars[k])
+	}
+
+	//	use clientcmd to apply the configuration
+	clusterInstallConfig, err := clientcmd.BuildConfigFromFlags("", mgmtkconfig)
+	if err != nil {
+		return false, err
+	}
+
+	// The VMs can only be created if KubeVirt is there
+	dyn, err := dynamic.NewForConfig(clusterInstallConfig)
+	if err != nil {
+		return false, err
+	}
+	_, err = dyn.Resource(crdGVR).Get(context.TODO(), "virtualmachines.kubevirt.io", metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return false, errors.New("KubeVirt isn't installed on the management cluster")
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// Create clientset to check the status
+	clientset, err := kubernetes.NewForConfig(clusterInstallConfig)
+	if err != nil {
+		return false, err
+	}
+
+	// init KubeVirt provider into the management cluster, unless another cluster put it there already
+	c, err := capiclient.New("")
+	if err != nil {
+		return false, err
+	}
+	_, err = clientset.AppsV1().Deployments(kubevirtNamespace).Get(context.TODO(), "capk-controller-manager", metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		log.Info("Initializing KubeVirt provider")
+		_, err = c.Init(capiclient.InitOptions{
+			Kubeconfig:              capiclient.Kubeconfig{Path: mgmtkconfig},
+			InfrastructureProviders: []string{"kubevirt"},
+			LogUsageInstructions:    false,
+		})
+	}
+	if err != nil {
+		return false, err
+	}
+
+	//	Set up options to write out the install YAML
+	var cpMachineCount int64
+	var workerMachineCount int64
+	if createHaCluster {
+		// If HA was requested we create it
+		cpMachineCount = 3
+		workerMachineCount = 3
+	} else {
+		// If HA was NOT requested we create a small cluster
+		cpMachineCount = 1
+		workerMachineCount = 2
+	}
+	if WorkerMachineCount > 0 {
+		workerMachineCount = WorkerMachineCount
+	}
+	cto := capiclient.GetClusterTemplateOptions{
+		Kubeconfig:               capiclient.Kubeconfig{Path: mgmtkconfig},
+		ClusterName:              *clusterName,
+		ControlPlaneMachineCount: &cpMachineCount,
+		WorkerMachineCount:       &workerMachineCount,
+		KubernetesVersion:        KubernetesVersion,
+		TargetNamespace:          "default",
+	}
+
+	//	Load up the config with the options
+	installYaml, err := c.GetClusterTemplate(cto)
+	if err != nil {
+		return false, err
+	}
+
+	// Write the install file out
+	installClusterYaml := workdir + "/" + "install-cluster.yaml"
+	err = utils.WriteYamlOutput(installYaml, installClusterYaml)
+	if err != nil {
+		return false, err
+	}
+
+	// Replace the workers the way that was asked for
+	if RolloutStrategy != nil {
+		err = applyRolloutStrategy(installClusterYaml)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Turn on the feature gates that were asked for
+	if len(FeatureGates) > 0 {
+		err = applyFeatureGates(installClusterYaml)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Reach the nodes through konnectivity if asked for
+	if Konnectivity {
+		err = applyKonnectivity(installClusterYaml)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Encrypt secrets at rest if asked for
+	if EncryptSecrets {
+		err = applyEncryption(installClusterYaml)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Expose the API server so it can be reached from outside of the management cluster
+	err = patchInstallYaml(installClusterYaml, func(obj *unstructured.Unstructured) (bool, error) {
+		if obj.GetKind() != "KubevirtCluster" {
+			return false, nil
+		}
+		return true, unstructured.SetNestedField(obj.Object, KubeVirtControlPlaneServiceType, "spec", "controlPlaneServiceTemplate", "spec", "type")
+	})
+	if err != nil {
+		return false, err
+	}
+
+	// Install the CAPI Helm add-on provider if we're using it for the CNI
+	if HelmAddons {
+		err = InstallHelmAddonProvider(mgmtkconfig, workdir)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Apply the YAML to the management cluster so that the VMs get created
+	log.Info("Preflight complete, installing cluster")
+
+	// Wait for it to roll out
+	err = waitForController(clientset, kubevirtNamespace, "capk-controller-manager", "CAPI Controller")
+	if err != nil {
+		return false, err
+	}
+
+	//	Split the one yaml CAPI gives you into individual files
+	err = utils.SplitYamls(workdir+"/"+"capi-install-yamls-output", installClusterYaml, "---")
+	if err != nil {
+		return false, err
+	}
+
+	//	get a list of those files
+	yamlFiles, err := filepath.Glob(workdir + "/" + "capi-install-yamls-output" + "/" + "*.yaml")
+	if err != nil {
+		return false, err
+	}
+
+	for _, yamlFile := range yamlFiles {
+		err = DoSSA(context.TODO(), clusterInstallConfig, yamlFile)
+		if err != nil {
+			log.Warn("Unable to read YAML: ", err)
+		}
+	}
+
+	//	First, wait for the infra to appear
+	_, err = waitForAWSInfra(clusterInstallConfig, *clusterName)
+	if err != nil {
+		return false, err
+	}
+
+	//	Then, wait for the CP to appear
+	_, err = waitForCP(clusterInstallConfig, *clusterName, createHaCluster)
+	if err != nil {
+		return false, err
+	}
+
+	log.Info("Control Plane Nodes are Online, saving Kubeconfig")
+
+	// Write out CAPI kubeconfig and save it
+	clusterKubeconfig, err := c.GetKubeconfig(capiclient.GetKubeconfigOptions{
+		Kubeconfig:          capiclient.Kubeconfig{Path: mgmtkconfig},
+		WorkloadClusterName: *clusterName,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	clusterkcfg, err := os.Create(capicfg)
+	if err != nil {
+		return false, err
+	}
+	clusterkcfg.WriteString(clusterKubeconfig)
+	clusterkcfg.Close()
+
+	//Apply the CNI solution, waiting for it to roll out
+
+	// Set up the Capi CFG connection
+	capiInstallConfig, err := clientcmd.BuildConfigFromFlags("", capicfg)
+	if err != nil {
+		return false, err
+	}
+	if HelmAddons {
+		// Let CAAPH install the CNI from the management cluster
+		err = ApplyCNIHelmChartProxy(mgmtkconfig, *clusterName, workdir)
+		if err != nil {
+			return false, err
+		}
+		err = waitForCNI(capiInstallConfig, helmCNI)
+		if err != nil {
+			return false, err
+		}
+	} else {
+		err = installCNI(capiInstallConfig, workdir, CNI)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Run the konnectivity agents, now that the nodes have a network
+	if Konnectivity {
+		err = installKonnectivityAgent(capiInstallConfig, workdir)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Wait until Nodes are READY
+	log.Info("Waiting for worker nodes to come online")
+	_, err = waitForReadyNodes(capiInstallConfig)
+	if err != nil {
+		return false, err
+	}
+
+	// If we're here, that means everything turned out okay
+	log.Info("Successfully created KubeVirt Kubernetes Cluster")
+	return true, nil
+}
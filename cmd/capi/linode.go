@@ -0,0 +1,262 @@
+package capi
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/christianh814/gokp/cmd/utils"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	capiclient "sigs.k8s.io/cluster-api/cmd/clusterctl/client"
+)
+
+// linodeNamespace is where CAPL runs
+var linodeNamespace string = "capl-system"
+
+// linodeCredentialsSecret is the secret CAPL keeps the API token it was installed with in
+var linodeCredentialsSecret string = "capl-manager-credentials"
+
+// LinodeProviderName is what CAPL is called in clusterctl
+var LinodeProviderName string = "linode-linode"
+
+// LinodeComponentsURL is where CAPL is installed from, the clusterctl we use doesn't know about it
+var LinodeComponentsURL string = "https://github.com/linode/cluster-api-provider-linode/releases/latest/infrastructure-components.yaml"
+
+// CreateLinodeK8sInstance creates a K8S cluster on Linode (Akamai) with CAPL
+func CreateLinodeK8sInstance(kindkconfig string, clusterName *string, workdir string, linodecreds map[string]string, capicfg string, createHaCluster bool) (bool, error) {
+	// Export Linode settings as Env vars, CAPL is installed with the token from there
+	for k := range linodecreds {
+		os.Setenv(k, linodecreds[k])
+	}
+	err := addUserProvider(LinodeProviderName, LinodeComponentsURL)
+	if err != nil {
+		return false, err
+	}
+
+	// Set up variables
+	var cpMachineCount int64
+	var workerMachineCount int64
+
+	// init Linode provider into the Kind instance
+	log.Info("Initializing Linode provider")
+	c, err := capiclient.New("")
+	if err != nil {
+		return false, err
+	}
+
+	_, err = c.Init(capiclient.InitOptions{
+		Kubeconfig:              capiclient.Kubeconfig{Path: kindkconfig},
+		InfrastructureProviders: []string{LinodeProviderName},
+		LogUsageInstructions:    false,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	//	Set up options to write out the install YAML
+	if createHaCluster {
+		// If HA was requested we create it
+		cpMachineCount = 3
+		workerMachineCount = 3
+	} else {
+		// If HA was NOT requested we create a small cluster
+		cpMachineCount = 1
+		workerMachineCount = 2
+	}
+	if WorkerMachineCount > 0 {
+		workerMachineCount = WorkerMachineCount
+	}
+	cto := capiclient.GetClusterTemplateOptions{
+		Kubeconfig:               capiclient.Kubeconfig{Path: kindkconfig},
+		ClusterName:              *clusterName,
+		ControlPlaneMachineCount: &cpMachineCount,
+		WorkerMachineCount:       &workerMachineCount,
+		KubernetesVersion:        KubernetesVersion,
+		TargetNamespace:          "default",
+	}
+
+	//	Load up the config with the options
+	installYaml, err := c.GetClusterTemplate(cto)
+	if err != nil {
+		return false, err
+	}
+
+	// Write the install file out
+	installClusterYaml := workdir + "/" + "install-cluster.yaml"
+	err = utils.WriteYamlOutput(installYaml, installClusterYaml)
+	if err != nil {
+		return false, err
+	}
+
+	// Replace the workers the way that was asked for
+	if RolloutStrategy != nil {
+		err = applyRolloutStrategy(installClusterYaml)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Turn on the feature gates that were asked for
+	if len(FeatureGates) > 0 {
+		err = applyFeatureGates(installClusterYaml)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Reach the nodes through konnectivity if asked for
+	if Konnectivity {
+		err = applyKonnectivity(installClusterYaml)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Encrypt secrets at rest if asked for
+	if EncryptSecrets {
+		err = applyEncryption(installClusterYaml)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Install the CAPI Helm add-on provider if we're using it for the CNI
+	if HelmAddons {
+		err = InstallHelmAddonProvider(kindkconfig, workdir)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Apply the YAML to the KIND instance so that the cluster gets installed on Linode
+	log.Info("Preflight complete, installing cluster")
+
+	//	use clientcmd to apply the configuration
+	clusterInstallConfig, err := clientcmd.BuildConfigFromFlags("", kindkconfig)
+	if err != nil {
+		return false, err
+	}
+
+	// Create clientset to check the status
+	clientset, err := kubernetes.NewForConfig(clusterInstallConfig)
+	if err != nil {
+		return false, err
+	}
+
+	// Wait for it to roll out
+	err = waitForController(clientset, linodeNamespace, "capl-controller-manager", "CAPI Controller")
+	if err != nil {
+		return false, err
+	}
+
+	//	Split the one yaml CAPI gives you into individual files
+	err = utils.SplitYamls(workdir+"/"+"capi-install-yamls-output", installClusterYaml, "---")
+	if err != nil {
+		return false, err
+	}
+
+	//	get a list of those files
+	yamlFiles, err := filepath.Glob(workdir + "/" + "capi-install-yamls-output" + "/" + "*.yaml")
+	if err != nil {
+		return false, err
+	}
+
+	for _, yamlFile := range yamlFiles {
+		err = DoSSA(context.TODO(), clusterInstallConfig, yamlFile)
+		if err != nil {
+			log.Warn("Unable to read YAML: ", err)
+		}
+	}
+
+	//	First, wait for the infra to appear
+	_, err = waitForAWSInfra(clusterInstallConfig, *clusterName)
+	if err != nil {
+		return false, err
+	}
+
+	//	Then, wait for the CP to appear
+	_, err = waitForCP(clusterInstallConfig, *clusterName, createHaCluster)
+	if err != nil {
+		return false, err
+	}
+
+	log.Info("Control Plane Nodes are Online, saving Kubeconfig")
+
+	// Write out CAPI kubeconfig and save it
+	clusterKubeconfig, err := c.GetKubeconfig(capiclient.GetKubeconfigOptions{
+		Kubeconfig:          capiclient.Kubeconfig{Path: kindkconfig},
+		WorkloadClusterName: *clusterName,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	clusterkcfg, err := os.Create(capicfg)
+	if err != nil {
+		return false, err
+	}
+	clusterkcfg.WriteString(clusterKubeconfig)
+	clusterkcfg.Close()
+
+	//Apply the CNI solution, waiting for it to roll out
+
+	// Set up the Capi CFG connection
+	capiInstallConfig, err := clientcmd.BuildConfigFromFlags("", capicfg)
+	if err != nil {
+		return false, err
+	}
+	if HelmAddons {
+		// Let CAAPH install the CNI from the management cluster
+		err = ApplyCNIHelmChartProxy(kindkconfig, *clusterName, workdir)
+		if err != nil {
+			return false, err
+		}
+		err = waitForCNI(capiInstallConfig, helmCNI)
+		if err != nil {
+			return false, err
+		}
+	} else {
+		err = installCNI(capiInstallConfig, workdir, CNI)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Run the konnectivity agents, now that the nodes have a network
+	if Konnectivity {
+		err = installKonnectivityAgent(capiInstallConfig, workdir)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Wait until Nodes are READY
+	log.Info("Waiting for worker nodes to come online")
+	_, err = waitForReadyNodes(capiInstallConfig)
+	if err != nil {
+		return false, err
+	}
+
+	// If we're here, that means everything turned out okay
+	log.Info("Successfully created Linode Kubernetes Cluster")
+	return true, nil
+}
+
+// exportLinodeCredentials exports the API token CAPL needs to be installed on another cluster from the secret it
+// keeps it in on the cluster of the given clientset
+func exportLinodeCredentials(clientset *kubernetes.Clientset) error {
+	secret, err := clientset.CoreV1().Secrets(linodeNamespace).Get(context.TODO(), linodeCredentialsSecret, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	token, ok := secret.Data["apiToken"]
+	if !ok {
+		return errors.New("no API token found in " + linodeCredentialsSecret)
+	}
+	os.Setenv("LINODE_TOKEN", string(token))
+	return nil
+}
@@ -0,0 +1,355 @@
+package capi
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/christianh814/gokp/cmd/metal3"
+	"github.com/christianh814/gokp/cmd/templates"
+	"github.com/christianh814/gokp/cmd/utils"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	capiclient "sigs.k8s.io/cluster-api/cmd/clusterctl/client"
+)
+
+// bmoNamespace is where the Bare Metal Operator runs
+var bmoNamespace string = "baremetal-operator-system"
+
+// BMOVersion is the version of the Bare Metal Operator that's installed along with CAPM3
+var BMOVersion string = "v0.1.2"
+
+// The Ironic the Bare Metal Operator provisions the hosts with, and the image it boots them into to do it. They're
+// read from the management cluster when the hosts are moved
+var (
+	Metal3IronicURL        string
+	Metal3DeployKernelURL  string
+	Metal3DeployRamdiskURL string
+)
+
+// CreateMetal3K8sInstance creates a K8S cluster on the bare metal hosts of the inventory with CAPM3
+func CreateMetal3K8sInstance(kindkconfig string, clusterName *string, workdir string, metal3vars map[string]string, capicfg string, inv *metal3.Inventory) (bool, error) {
+	// Export the image settings as Env vars, they're what the template is filled in with
+	for k := range metal3vars {
+		os.Setenv(k, metal3vars[k])
+	}
+
+	// init Metal3 provider into the Kind instance
+	log.Info("Initializing Metal3 provider")
+	c, err := capiclient.New("")
+	if err != nil {
+		return false, err
+	}
+
+	_, err = c.Init(capiclient.InitOptions{
+		Kubeconfig:              capiclient.Kubeconfig{Path: kindkconfig},
+		InfrastructureProviders: []string{"metal3"},
+		LogUsageInstructions:    false,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	// CAPM3 gets the hosts from the Bare Metal Operator
+	err = InstallBMO(kindkconfig, workdir)
+	if err != nil {
+		return false, err
+	}
+
+	//	Set up options to write out the install YAML. Every host of the inventory is used
+	cpMachineCount := inv.ControlPlaneCount()
+	workerMachineCount := int64(len(inv.Hosts)) - cpMachineCount
+	cto := capiclient.GetClusterTemplateOptions{
+		Kubeconfig:               capiclient.Kubeconfig{Path: kindkconfig},
+		ClusterName:              *clusterName,
+		ControlPlaneMachineCount: &cpMachineCount,
+		WorkerMachineCount:       &workerMachineCount,
+		KubernetesVersion:        KubernetesVersion,
+		TargetNamespace:          "default",
+	}
+
+	//	Load up the config with the options
+	installYaml, err := c.GetClusterTemplate(cto)
+	if err != nil {
+		return false, err
+	}
+
+	// Write the install file out
+	installClusterYaml := workdir + "/" + "install-cluster.yaml"
+	err = utils.WriteYamlOutput(installYaml, installClusterYaml)
+	if err != nil {
+		return false, err
+	}
+
+	// Replace the workers the way that was asked for
+	if RolloutStrategy != nil {
+		err = applyRolloutStrategy(installClusterYaml)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Turn on the feature gates that were asked for
+	if len(FeatureGates) > 0 {
+		err = applyFeatureGates(installClusterYaml)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Reach the nodes through konnectivity if asked for
+	if Konnectivity {
+		err = applyKonnectivity(installClusterYaml)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Encrypt secrets at rest if asked for
+	if EncryptSecrets {
+		err = applyEncryption(installClusterYaml)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Write the hosts out, they have to be there for CAPM3 to put the machines on
+	hostsYaml := workdir + "/" + "baremetalhosts.yaml"
+	err = inv.WriteHosts(hostsYaml, "default")
+	if err != nil {
+		return false, err
+	}
+
+	// Install the CAPI Helm add-on provider if we're using it for the CNI
+	if HelmAddons {
+		err = InstallHelmAddonProvider(kindkconfig, workdir)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Apply the YAML to the KIND instance so that the cluster gets installed on the hosts
+	log.Info("Preflight complete, installing cluster")
+
+	//	use clientcmd to apply the configuration
+	clusterInstallConfig, err := clientcmd.BuildConfigFromFlags("", kindkconfig)
+	if err != nil {
+		return false, err
+	}
+
+	// Create clientset to check the status
+	clientset, err := kubernetes.NewForConfig(clusterInstallConfig)
+	if err != nil {
+		return false, err
+	}
+
+	// Wait for it to roll out
+	err = waitForController(clientset, "capm3-system", "capm3-controller-manager", "CAPI Controller")
+	if err != nil {
+		return false, err
+	}
+
+	// Register the hosts first, so they're being inspected while the rest is applied
+	log.Info("Registering ", len(inv.Hosts), " bare metal hosts")
+	err = utils.SplitYamls(workdir+"/"+"baremetalhosts-output", hostsYaml, "---")
+	if err != nil {
+		return false, err
+	}
+	hostFiles, err := filepath.Glob(workdir + "/" + "baremetalhosts-output" + "/" + "*.yaml")
+	if err != nil {
+		return false, err
+	}
+	for _, hostFile := range hostFiles {
+		err = DoSSA(context.TODO(), clusterInstallConfig, hostFile)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	//	Split the one yaml CAPI gives you into individual files
+	err = utils.SplitYamls(workdir+"/"+"capi-install-yamls-output", installClusterYaml, "---")
+	if err != nil {
+		return false, err
+	}
+
+	//	get a list of those files
+	yamlFiles, err := filepath.Glob(workdir + "/" + "capi-install-yamls-output" + "/" + "*.yaml")
+	if err != nil {
+		return false, err
+	}
+
+	for _, yamlFile := range yamlFiles {
+		err = DoSSA(context.TODO(), clusterInstallConfig, yamlFile)
+		if err != nil {
+			log.Warn("Unable to read YAML: ", err)
+		}
+	}
+
+	//	First, wait for the infra to appear
+	_, err = waitForAWSInfra(clusterInstallConfig, *clusterName)
+	if err != nil {
+		return false, err
+	}
+
+	//	Then, wait for the CP to appear. Hosts are provisioned from scratch, so this takes a while
+	_, err = waitForCP(clusterInstallConfig, *clusterName, cpMachineCount > 1)
+	if err != nil {
+		return false, err
+	}
+
+	log.Info("Control Plane Nodes are Online, saving Kubeconfig")
+
+	// Write out CAPI kubeconfig and save it
+	clusterKubeconfig, err := c.GetKubeconfig(capiclient.GetKubeconfigOptions{
+		Kubeconfig:          capiclient.Kubeconfig{Path: kindkconfig},
+		WorkloadClusterName: *clusterName,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	clusterkcfg, err := os.Create(capicfg)
+	if err != nil {
+		return false, err
+	}
+	clusterkcfg.WriteString(clusterKubeconfig)
+	clusterkcfg.Close()
+
+	//Apply the CNI solution, waiting for it to roll out
+
+	// Set up the Capi CFG connection
+	capiInstallConfig, err := clientcmd.BuildConfigFromFlags("", capicfg)
+	if err != nil {
+		return false, err
+	}
+	if HelmAddons {
+		// Let CAAPH install the CNI from the management cluster
+		err = ApplyCNIHelmChartProxy(kindkconfig, *clusterName, workdir)
+		if err != nil {
+			return false, err
+		}
+		err = waitForCNI(capiInstallConfig, helmCNI)
+		if err != nil {
+			return false, err
+		}
+	} else {
+		err = installCNI(capiInstallConfig, workdir, CNI)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Run the konnectivity agents, now that the nodes have a network
+	if Konnectivity {
+		err = installKonnectivityAgent(capiInstallConfig, workdir)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Wait until Nodes are READY
+	log.Info("Waiting for worker nodes to come online")
+	_, err = waitForReadyNodes(capiInstallConfig)
+	if err != nil {
+		return false, err
+	}
+
+	// If we're here, that means everything turned out okay
+	log.Info("Successfully created Metal3 Kubernetes Cluster")
+	return true, nil
+}
+
+// InstallBMO installs the Bare Metal Operator on the cluster of the given kubeconfig, pointed at the Ironic of the
+// Metal3 vars. Its CRDs are labeled the way clusterctl labels the ones it installs, so the hosts are moved along
+// with the cluster
+func InstallBMO(kubeconfig string, workdir string) error {
+	log.Info("Installing the Bare Metal Operator")
+	cfg, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	// Render the BMO YAML with the Ironic settings and split it into individual files
+	kustomizeDir := workdir + "/" + "bmo-kustomize"
+	err = os.MkdirAll(kustomizeDir, 0755)
+	if err != nil {
+		return err
+	}
+	bmoVars := struct {
+		Version          string
+		IronicURL        string
+		DeployKernelURL  string
+		DeployRamdiskURL string
+	}{
+		Version:          BMOVersion,
+		IronicURL:        Metal3IronicURL,
+		DeployKernelURL:  Metal3DeployKernelURL,
+		DeployRamdiskURL: Metal3DeployRamdiskURL,
+	}
+	_, err = utils.WriteTemplate(templates.BMOKustomizeFile, kustomizeDir+"/"+"kustomization.yaml", bmoVars)
+	if err != nil {
+		return err
+	}
+	bmoYaml := workdir + "/" + "bmo-install.yaml"
+	_, err = utils.RunKustomize(kustomizeDir, bmoYaml)
+	if err != nil {
+		return err
+	}
+	err = utils.SplitYamls(workdir+"/"+"bmo-output", bmoYaml, "---")
+	if err != nil {
+		return err
+	}
+	yamlFiles, err := filepath.Glob(workdir + "/" + "bmo-output" + "/" + "*.yaml")
+	if err != nil {
+		return err
+	}
+
+	// The CRDs have to be established before the CRs can be applied, so we try a few times
+	for _, yamlFile := range yamlFiles {
+		err = applyOnceEstablished(cfg, yamlFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Label the CRDs so clusterctl move picks up the hosts
+	err = labelCRDsForMove(cfg, "metal3.io")
+	if err != nil {
+		return err
+	}
+
+	// Wait for it to roll out
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return err
+	}
+	err = waitForController(clientset, bmoNamespace, "baremetal-operator-controller-manager", "Bare Metal Operator")
+	if err != nil {
+		return err
+	}
+
+	// If we're here, we should be okay
+	return nil
+}
+
+// exportMetal3IronicSettings reads the Ironic settings the Bare Metal Operator was installed with on the cluster of
+// the given clientset, so it can be installed the same way on another cluster
+func exportMetal3IronicSettings(clientset *kubernetes.Clientset) error {
+	cms, err := clientset.CoreV1().ConfigMaps(bmoNamespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	for _, cm := range cms.Items {
+		if _, ok := cm.Data["IRONIC_ENDPOINT"]; !ok {
+			continue
+		}
+		Metal3IronicURL = cm.Data["IRONIC_ENDPOINT"]
+		Metal3DeployKernelURL = cm.Data["DEPLOY_KERNEL_URL"]
+		Metal3DeployRamdiskURL = cm.Data["DEPLOY_RAMDISK_URL"]
+		return nil
+	}
+	return errors.New("no Ironic settings found in " + bmoNamespace)
+}
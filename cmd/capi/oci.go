@@ -0,0 +1,264 @@
+package capi
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+
+	"github.com/christianh814/gokp/cmd/utils"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	capiclient "sigs.k8s.io/cluster-api/cmd/clusterctl/client"
+)
+
+// ociNamespace is where CAPOCI runs, it doesn't follow the <provider>-system convention
+var ociNamespace string = "cluster-api-provider-oci-system"
+
+// ociAuthSecret is the secret CAPOCI keeps the credentials it was installed with in
+var ociAuthSecret string = "capoci-auth-config"
+
+// ociB64Vars maps the settings CAPOCI is installed with to the keys of ociAuthSecret. CAPOCI wants them base64
+// encoded in <name>_B64 variables
+var ociB64Vars = map[string]string{
+	"OCI_TENANCY_ID":              "tenancy",
+	"OCI_USER_ID":                 "user",
+	"OCI_CREDENTIALS_FINGERPRINT": "fingerprint",
+	"OCI_REGION":                  "region",
+	"OCI_CREDENTIALS_KEY":         "key",
+	"OCI_CREDENTIALS_PASSPHRASE":  "passphrase",
+}
+
+// CreateOCIK8sInstance creates a K8S cluster on Oracle Cloud with CAPOCI
+func CreateOCIK8sInstance(kindkconfig string, clusterName *string, workdir string, ocicreds map[string]string, capicfg string, createHaCluster bool) (bool, error) {
+	// Export OCI settings as Env vars, along with the base64 encoded ones CAPOCI is installed with
+	for k := range ocicreds {
+		os.Setenv(k, ocicreds[k])
+		if _, ok := ociB64Vars[k]; ok {
+			os.Setenv(k+"_B64", base64.StdEncoding.EncodeToString([]byte(ocicreds[k])))
+		}
+	}
+
+	// Set up variables
+	var cpMachineCount int64
+	var workerMachineCount int64
+
+	// init OCI provider into the Kind instance
+	log.Info("Initializing OCI provider")
+	c, err := capiclient.New("")
+	if err != nil {
+		return false, err
+	}
+
+	_, err = c.Init(capiclient.InitOptions{
+		Kubeconfig:              capiclient.Kubeconfig{Path: kindkconfig},
+		InfrastructureProviders: []string{"oci"},
+		LogUsageInstructions:    false,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	//	Set up options to write out the install YAML
+	if createHaCluster {
+		// If HA was requested we create it
+		cpMachineCount = 3
+		workerMachineCount = 3
+	} else {
+		// If HA was NOT requested we create a small cluster
+		cpMachineCount = 1
+		workerMachineCount = 2
+	}
+	if WorkerMachineCount > 0 {
+		workerMachineCount = WorkerMachineCount
+	}
+	cto := capiclient.GetClusterTemplateOptions{
+		Kubeconfig:               capiclient.Kubeconfig{Path: kindkconfig},
+		ClusterName:              *clusterName,
+		ControlPlaneMachineCount: &cpMachineCount,
+		WorkerMachineCount:       &workerMachineCount,
+		KubernetesVersion:        KubernetesVersion,
+		TargetNamespace:          "default",
+	}
+
+	//	Load up the config with the options
+	installYaml, err := c.GetClusterTemplate(cto)
+	if err != nil {
+		return false, err
+	}
+
+	// Write the install file out
+	installClusterYaml := workdir + "/" + "install-cluster.yaml"
+	err = utils.WriteYamlOutput(installYaml, installClusterYaml)
+	if err != nil {
+		return false, err
+	}
+
+	// Replace the workers the way that was asked for
+	if RolloutStrategy != nil {
+		err = applyRolloutStrategy(installClusterYaml)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Turn on the feature gates that were asked for
+	if len(FeatureGates) > 0 {
+		err = applyFeatureGates(installClusterYaml)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Reach the nodes through konnectivity if asked for
+	if Konnectivity {
+		err = applyKonnectivity(installClusterYaml)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Encrypt secrets at rest if asked for
+	if EncryptSecrets {
+		err = applyEncryption(installClusterYaml)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Install the CAPI Helm add-on provider if we're using it for the CNI
+	if HelmAddons {
+		err = InstallHelmAddonProvider(kindkconfig, workdir)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Apply the YAML to the KIND instance so that the cluster gets installed on OCI
+	log.Info("Preflight complete, installing cluster")
+
+	//	use clientcmd to apply the configuration
+	clusterInstallConfig, err := clientcmd.BuildConfigFromFlags("", kindkconfig)
+	if err != nil {
+		return false, err
+	}
+
+	// Create clientset to check the status
+	clientset, err := kubernetes.NewForConfig(clusterInstallConfig)
+	if err != nil {
+		return false, err
+	}
+
+	// Wait for it to roll out
+	err = waitForController(clientset, ociNamespace, "capoci-controller-manager", "CAPI Controller")
+	if err != nil {
+		return false, err
+	}
+
+	//	Split the one yaml CAPI gives you into individual files
+	err = utils.SplitYamls(workdir+"/"+"capi-install-yamls-output", installClusterYaml, "---")
+	if err != nil {
+		return false, err
+	}
+
+	//	get a list of those files
+	yamlFiles, err := filepath.Glob(workdir + "/" + "capi-install-yamls-output" + "/" + "*.yaml")
+	if err != nil {
+		return false, err
+	}
+
+	for _, yamlFile := range yamlFiles {
+		err = DoSSA(context.TODO(), clusterInstallConfig, yamlFile)
+		if err != nil {
+			log.Warn("Unable to read YAML: ", err)
+		}
+	}
+
+	//	First, wait for the infra to appear
+	_, err = waitForAWSInfra(clusterInstallConfig, *clusterName)
+	if err != nil {
+		return false, err
+	}
+
+	//	Then, wait for the CP to appear
+	_, err = waitForCP(clusterInstallConfig, *clusterName, createHaCluster)
+	if err != nil {
+		return false, err
+	}
+
+	log.Info("Control Plane Nodes are Online, saving Kubeconfig")
+
+	// Write out CAPI kubeconfig and save it
+	clusterKubeconfig, err := c.GetKubeconfig(capiclient.GetKubeconfigOptions{
+		Kubeconfig:          capiclient.Kubeconfig{Path: kindkconfig},
+		WorkloadClusterName: *clusterName,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	clusterkcfg, err := os.Create(capicfg)
+	if err != nil {
+		return false, err
+	}
+	clusterkcfg.WriteString(clusterKubeconfig)
+	clusterkcfg.Close()
+
+	//Apply the CNI solution, waiting for it to roll out
+
+	// Set up the Capi CFG connection
+	capiInstallConfig, err := clientcmd.BuildConfigFromFlags("", capicfg)
+	if err != nil {
+		return false, err
+	}
+	if HelmAddons {
+		// Let CAAPH install the CNI from the management cluster
+		err = ApplyCNIHelmChartProxy(kindkconfig, *clusterName, workdir)
+		if err != nil {
+			return false, err
+		}
+		err = waitForCNI(capiInstallConfig, helmCNI)
+		if err != nil {
+			return false, err
+		}
+	} else {
+		err = installCNI(capiInstallConfig, workdir, CNI)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Run the konnectivity agents, now that the nodes have a network
+	if Konnectivity {
+		err = installKonnectivityAgent(capiInstallConfig, workdir)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Wait until Nodes are READY
+	log.Info("Waiting for worker nodes to come online")
+	_, err = waitForReadyNodes(capiInstallConfig)
+	if err != nil {
+		return false, err
+	}
+
+	// If we're here, that means everything turned out okay
+	log.Info("Successfully created OCI Kubernetes Cluster")
+	return true, nil
+}
+
+// exportOCICredentials exports the base64 encoded settings CAPOCI needs to be installed on another cluster from
+// the secret it keeps them in on the cluster of the given clientset
+func exportOCICredentials(clientset *kubernetes.Clientset) error {
+	secret, err := clientset.CoreV1().Secrets(ociNamespace).Get(context.TODO(), ociAuthSecret, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	for env, key := range ociB64Vars {
+		os.Setenv(env+"_B64", base64.StdEncoding.EncodeToString(secret.Data[key]))
+	}
+	return nil
+}
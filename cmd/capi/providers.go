@@ -0,0 +1,69 @@
+package capi
+
+import (
+	"context"
+
+	"github.com/spf13/viper"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+)
+
+// crdGVR is the CustomResourceDefinition resource
+var crdGVR = schema.GroupVersionResource{Group: "apiextensions.k8s.io", Version: "v1", Resource: "customresourcedefinitions"}
+
+// addUserProvider adds an infrastructure provider the clusterctl we use doesn't know about to the providers it reads
+// from its config, keeping any the user configured. clusterctl reads its config with the global viper
+func addUserProvider(name string, url string) error {
+	providers := []map[string]string{}
+	err := viper.UnmarshalKey("providers", &providers)
+	if err != nil {
+		return err
+	}
+	for _, p := range providers {
+		if p["name"] == name {
+			return nil
+		}
+	}
+	providers = append(providers, map[string]string{
+		"name": name,
+		"url":  url,
+		"type": "InfrastructureProvider",
+	})
+	viper.Set("providers", providers)
+	return nil
+}
+
+// labelCRDsForMove labels the CRDs of the group that weren't installed by clusterctl the way it labels the ones it
+// installs, so clusterctl move moves every object of them along with the cluster
+func labelCRDsForMove(cfg *rest.Config, group string) error {
+	dyn, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		return err
+	}
+	crds, err := dyn.Resource(crdGVR).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	patch := []byte(`{"metadata":{"labels":{"clusterctl.cluster.x-k8s.io":"","clusterctl.cluster.x-k8s.io/move":""}}}`)
+	for _, crd := range crds.Items {
+		crdGroup, _, _ := unstructured.NestedString(crd.Object, "spec", "group")
+		if crdGroup != group {
+			continue
+		}
+		if _, ok := crd.GetLabels()["clusterctl.cluster.x-k8s.io"]; ok {
+			continue
+		}
+		_, err = dyn.Resource(crdGVR).Patch(context.TODO(), crd.GetName(), types.MergePatchType, patch, metav1.PatchOptions{})
+		if err != nil {
+			return err
+		}
+	}
+
+	// If we're here, we should be okay
+	return nil
+}
@@ -0,0 +1,343 @@
+package capi
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/christianh814/gokp/cmd/utils"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	capiclient "sigs.k8s.io/cluster-api/cmd/clusterctl/client"
+)
+
+// proxmoxNamespace is where CAPMOX runs
+var proxmoxNamespace string = "capmox-system"
+
+// proxmoxCredentialsSecret is the secret CAPMOX keeps the API token it was installed with in
+var proxmoxCredentialsSecret string = "capmox-manager-credentials"
+
+// ProxmoxProviderName is what CAPMOX is called in clusterctl
+var ProxmoxProviderName string = "proxmox"
+
+// ProxmoxComponentsURL is where CAPMOX is installed from, the clusterctl we use doesn't know about it
+var ProxmoxComponentsURL string = "https://github.com/ionos-cloud/cluster-api-provider-proxmox/releases/latest/infrastructure-components.yaml"
+
+// IPAMComponentsURL is where the in-cluster IPAM provider, that CAPMOX gets the IPs of the nodes from, is installed
+// from. The clusterctl we use can't install IPAM providers, so it's applied like any other YAML
+var IPAMComponentsURL string = "https://github.com/kubernetes-sigs/cluster-api-ipam-provider-in-cluster/releases/latest/download/ipam-components.yaml"
+
+// ProxmoxStorage is the storage the disks of the VMs are cloned to. The storage of the template is used if empty
+var ProxmoxStorage string
+
+// CreateProxmoxK8sInstance creates a K8S cluster on Proxmox VE with CAPMOX
+func CreateProxmoxK8sInstance(kindkconfig string, clusterName *string, workdir string, proxmoxcreds map[string]string, capicfg string, createHaCluster bool) (bool, error) {
+	// Export Proxmox settings as Env vars, CAPMOX is installed with the token from there
+	for k := range proxmoxcreds {
+		os.Setenv(k, proxmoxcreds[k])
+	}
+	err := addUserProvider(ProxmoxProviderName, ProxmoxComponentsURL)
+	if err != nil {
+		return false, err
+	}
+
+	// Set up variables
+	var cpMachineCount int64
+	var workerMachineCount int64
+
+	// init Proxmox provider into the Kind instance
+	log.Info("Initializing Proxmox provider")
+	c, err := capiclient.New("")
+	if err != nil {
+		return false, err
+	}
+
+	_, err = c.Init(capiclient.InitOptions{
+		Kubeconfig:              capiclient.Kubeconfig{Path: kindkconfig},
+		InfrastructureProviders: []string{ProxmoxProviderName},
+		LogUsageInstructions:    false,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	// The IPs of the nodes come from the in-cluster IPAM provider
+	err = InstallIPAMProvider(kindkconfig, workdir)
+	if err != nil {
+		return false, err
+	}
+
+	//	Set up options to write out the install YAML
+	if createHaCluster {
+		// If HA was requested we create it
+		cpMachineCount = 3
+		workerMachineCount = 3
+	} else {
+		// If HA was NOT requested we create a small cluster
+		cpMachineCount = 1
+		workerMachineCount = 2
+	}
+	if WorkerMachineCount > 0 {
+		workerMachineCount = WorkerMachineCount
+	}
+	cto := capiclient.GetClusterTemplateOptions{
+		Kubeconfig:               capiclient.Kubeconfig{Path: kindkconfig},
+		ClusterName:              *clusterName,
+		ControlPlaneMachineCount: &cpMachineCount,
+		WorkerMachineCount:       &workerMachineCount,
+		KubernetesVersion:        KubernetesVersion,
+		TargetNamespace:          "default",
+	}
+
+	//	Load up the config with the options
+	installYaml, err := c.GetClusterTemplate(cto)
+	if err != nil {
+		return false, err
+	}
+
+	// Write the install file out
+	installClusterYaml := workdir + "/" + "install-cluster.yaml"
+	err = utils.WriteYamlOutput(installYaml, installClusterYaml)
+	if err != nil {
+		return false, err
+	}
+
+	// Replace the workers the way that was asked for
+	if RolloutStrategy != nil {
+		err = applyRolloutStrategy(installClusterYaml)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Turn on the feature gates that were asked for
+	if len(FeatureGates) > 0 {
+		err = applyFeatureGates(installClusterYaml)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Reach the nodes through konnectivity if asked for
+	if Konnectivity {
+		err = applyKonnectivity(installClusterYaml)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Encrypt secrets at rest if asked for
+	if EncryptSecrets {
+		err = applyEncryption(installClusterYaml)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Clone the disks of the VMs to the storage asked for
+	if ProxmoxStorage != "" {
+		err = patchInstallYaml(installClusterYaml, func(obj *unstructured.Unstructured) (bool, error) {
+			if obj.GetKind() != "ProxmoxMachineTemplate" {
+				return false, nil
+			}
+			return true, unstructured.SetNestedField(obj.Object, ProxmoxStorage, "spec", "template", "spec", "storage")
+		})
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Install the CAPI Helm add-on provider if we're using it for the CNI
+	if HelmAddons {
+		err = InstallHelmAddonProvider(kindkconfig, workdir)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Apply the YAML to the KIND instance so that the cluster gets installed on Proxmox
+	log.Info("Preflight complete, installing cluster")
+
+	//	use clientcmd to apply the configuration
+	clusterInstallConfig, err := clientcmd.BuildConfigFromFlags("", kindkconfig)
+	if err != nil {
+		return false, err
+	}
+
+	// Create clientset to check the status
+	clientset, err := kubernetes.NewForConfig(clusterInstallConfig)
+	if err != nil {
+		return false, err
+	}
+
+	// Wait for it to roll out
+	err = waitForController(clientset, proxmoxNamespace, "capmox-controller-manager", "CAPI Controller")
+	if err != nil {
+		return false, err
+	}
+
+	//	Split the one yaml CAPI gives you into individual files
+	err = utils.SplitYamls(workdir+"/"+"capi-install-yamls-output", installClusterYaml, "---")
+	if err != nil {
+		return false, err
+	}
+
+	//	get a list of those files
+	yamlFiles, err := filepath.Glob(workdir + "/" + "capi-install-yamls-output" + "/" + "*.yaml")
+	if err != nil {
+		return false, err
+	}
+
+	for _, yamlFile := range yamlFiles {
+		err = DoSSA(context.TODO(), clusterInstallConfig, yamlFile)
+		if err != nil {
+			log.Warn("Unable to read YAML: ", err)
+		}
+	}
+
+	//	First, wait for the infra to appear
+	_, err = waitForAWSInfra(clusterInstallConfig, *clusterName)
+	if err != nil {
+		return false, err
+	}
+
+	//	Then, wait for the CP to appear
+	_, err = waitForCP(clusterInstallConfig, *clusterName, createHaCluster)
+	if err != nil {
+		return false, err
+	}
+
+	log.Info("Control Plane Nodes are Online, saving Kubeconfig")
+
+	// Write out CAPI kubeconfig and save it
+	clusterKubeconfig, err := c.GetKubeconfig(capiclient.GetKubeconfigOptions{
+		Kubeconfig:          capiclient.Kubeconfig{Path: kindkconfig},
+		WorkloadClusterName: *clusterName,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	clusterkcfg, err := os.Create(capicfg)
+	if err != nil {
+		return false, err
+	}
+	clusterkcfg.WriteString(clusterKubeconfig)
+	clusterkcfg.Close()
+
+	//Apply the CNI solution, waiting for it to roll out
+
+	// Set up the Capi CFG connection
+	capiInstallConfig, err := clientcmd.BuildConfigFromFlags("", capicfg)
+	if err != nil {
+		return false, err
+	}
+	if HelmAddons {
+		// Let CAAPH install the CNI from the management cluster
+		err = ApplyCNIHelmChartProxy(kindkconfig, *clusterName, workdir)
+		if err != nil {
+			return false, err
+		}
+		err = waitForCNI(capiInstallConfig, helmCNI)
+		if err != nil {
+			return false, err
+		}
+	} else {
+		err = installCNI(capiInstallConfig, workdir, CNI)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Run the konnectivity agents, now that the nodes have a network
+	if Konnectivity {
+		err = installKonnectivityAgent(capiInstallConfig, workdir)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// Wait until Nodes are READY
+	log.Info("Waiting for worker nodes to come online")
+	_, err = waitForReadyNodes(capiInstallConfig)
+	if err != nil {
+		return false, err
+	}
+
+	// If we're here, that means everything turned out okay
+	log.Info("Successfully created Proxmox Kubernetes Cluster")
+	return true, nil
+}
+
+// InstallIPAMProvider installs the in-cluster IPAM provider on the cluster of the given kubeconfig. Its CRDs are
+// labeled the way clusterctl labels the ones it installs, so the IP pools are moved along with the cluster
+func InstallIPAMProvider(kubeconfig string, workdir string) error {
+	log.Info("Installing the in-cluster IPAM provider")
+	cfg, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	// Download the IPAM YAML and split it into individual files
+	ipamYaml := workdir + "/" + "ipam-components.yaml"
+	_, err = utils.DownloadFile(ipamYaml, IPAMComponentsURL)
+	if err != nil {
+		return err
+	}
+	err = utils.SplitYamls(workdir+"/"+"ipam-output", ipamYaml, "---")
+	if err != nil {
+		return err
+	}
+	yamlFiles, err := filepath.Glob(workdir + "/" + "ipam-output" + "/" + "*.yaml")
+	if err != nil {
+		return err
+	}
+
+	// The CRDs have to be established before the CRs can be applied, so we try a few times
+	for _, yamlFile := range yamlFiles {
+		err = applyOnceEstablished(cfg, yamlFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Label the CRDs so clusterctl move picks up the IP pools
+	err = labelCRDsForMove(cfg, "ipam.cluster.x-k8s.io")
+	if err != nil {
+		return err
+	}
+
+	// Wait for it to roll out
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return err
+	}
+	err = waitForController(clientset, "caip-in-cluster-system", "caip-in-cluster-controller-manager", "IPAM Controller")
+	if err != nil {
+		return err
+	}
+
+	// If we're here, we should be okay
+	return nil
+}
+
+// exportProxmoxCredentials exports the API token CAPMOX needs to be installed on another cluster from the secret
+// it keeps it in on the cluster of the given clientset
+func exportProxmoxCredentials(clientset *kubernetes.Clientset) error {
+	secret, err := clientset.CoreV1().Secrets(proxmoxNamespace).Get(context.TODO(), proxmoxCredentialsSecret, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	for env, key := range map[string]string{"PROXMOX_URL": "url", "PROXMOX_TOKEN": "token", "PROXMOX_SECRET": "secret"} {
+		value, ok := secret.Data[key]
+		if !ok {
+			return errors.New("no " + key + " found in " + proxmoxCredentialsSecret)
+		}
+		os.Setenv(env, string(value))
+	}
+	return nil
+}
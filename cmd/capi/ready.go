@@ -0,0 +1,152 @@
+package capi
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/christianh814/gokp/cmd/clock"
+	"github.com/christianh814/gokp/cmd/cni"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// ReadyWait is how often WaitForClusterReady checks on the cluster, and how long it waits for it before giving up
+var ReadyWait clock.Waiter = clock.Waiter{Interval: 10 * time.Second, Timeout: 20 * time.Minute}
+
+// ControllerWait is how often the controllers of the providers are checked on once they're installed, and how long
+// they have to roll out
+var ControllerWait clock.Waiter = clock.Waiter{Interval: 5 * time.Second, Timeout: 5 * time.Minute}
+
+// InfrastructureWait is how often the infrastructure of a cluster is checked on while it's provisioned, and how long
+// it has to be. ControlPlaneWait and NodeWait are the same for the control plane and the nodes coming up
+var (
+	InfrastructureWait clock.Waiter = clock.Waiter{Interval: time.Minute, Timeout: 40 * time.Minute}
+	ControlPlaneWait   clock.Waiter = clock.Waiter{Interval: time.Minute, Timeout: 20 * time.Minute}
+	NodeWait           clock.Waiter = clock.Waiter{Interval: 10 * time.Second, Timeout: 20 * time.Minute}
+)
+
+// WaitForClusterReady waits until every control plane and worker node is Ready and every DaemonSet (which
+// includes the CNI) has rolled out, logging what it's still waiting on as it goes. This is done before
+// anything is bootstrapped on the cluster, so a cluster that never comes up fails here and not mid-apply
+func WaitForClusterReady(kubeconfig string) error {
+	log.Info("Waiting for all nodes to be Ready and the CNI to roll out")
+	cfg, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return err
+	}
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	lastStatus := ""
+	err = ReadyWait.Until(func() (bool, error) {
+		ready, status, err := clusterReady(clientset)
+		if err != nil {
+			// The API server may be busy, keep trying
+			status = "unable to check the cluster: " + err.Error()
+		}
+		if ready {
+			log.Info("Cluster is ready: ", status)
+			return true, nil
+		}
+
+		// Only log when something changes so we don't flood the output
+		if status != lastStatus {
+			log.Info("Waiting on cluster: ", status)
+			lastStatus = status
+		}
+		return false, nil
+	})
+	if err == clock.ErrTimeout {
+		return errors.New("cluster did not become ready in " + ReadyWait.Timeout.String() + ": " + lastStatus)
+	}
+	return err
+}
+
+// clusterReady returns true if every node is Ready (with at least one worker) and every DaemonSet has rolled
+// out, along with a summary of where things are at
+func clusterReady(clientset kubernetes.Interface) (bool, string, error) {
+	nodes, err := clientset.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return false, "", err
+	}
+
+	readyCP, totalCP, readyWorkers, totalWorkers := 0, 0, 0, 0
+	notReady := []string{}
+	for _, node := range nodes.Items {
+		_, isCP := node.Labels["node-role.kubernetes.io/control-plane"]
+		if isCP {
+			totalCP++
+		} else {
+			totalWorkers++
+		}
+
+		if !nodeReady(node) {
+			notReady = append(notReady, node.Name)
+			continue
+		}
+		if isCP {
+			readyCP++
+		} else {
+			readyWorkers++
+		}
+	}
+
+	daemonSets, err := clientset.AppsV1().DaemonSets(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return false, "", err
+	}
+	notRolledOut := []string{}
+	for i := range daemonSets.Items {
+		if !cni.RolledOut(&daemonSets.Items[i]) {
+			notRolledOut = append(notRolledOut, daemonSets.Items[i].Namespace+"/"+daemonSets.Items[i].Name)
+		}
+	}
+
+	status := "control plane nodes " + strconv.Itoa(readyCP) + "/" + strconv.Itoa(totalCP) + " Ready, " +
+		"worker nodes " + strconv.Itoa(readyWorkers) + "/" + strconv.Itoa(totalWorkers) + " Ready"
+	if len(notReady) > 0 {
+		status += ", not Ready: " + strings.Join(notReady, ", ")
+	}
+	if len(notRolledOut) > 0 {
+		status += ", DaemonSets rolling out: " + strings.Join(notRolledOut, ", ")
+	}
+
+	ready := totalCP > 0 && totalWorkers > 0 && len(notReady) == 0 && len(notRolledOut) == 0
+	return ready, status, nil
+}
+
+// nodeReady returns true if the node has the Ready condition set
+func nodeReady(node corev1.Node) bool {
+	for _, c := range node.Status.Conditions {
+		if c.Type == corev1.NodeReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// waitForController waits until the Deployment of a controller (what it's called in the error) has a replica
+// available, and then a moment longer so its webhooks are served before anything is applied
+func waitForController(clientset kubernetes.Interface, namespace string, name string, what string) error {
+	err := ControllerWait.Until(func() (bool, error) {
+		d, err := clientset.AppsV1().Deployments(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		// It may not be created yet
+		return err == nil && d.Status.AvailableReplicas > 0, nil
+	})
+	if err == clock.ErrTimeout {
+		return errors.New(what + " took too long to roll out")
+	}
+	if err != nil {
+		return err
+	}
+	ControllerWait.Pause()
+	return nil
+}
@@ -0,0 +1,126 @@
+package capi
+
+import (
+	"os"
+
+	"github.com/christianh814/gokp/cmd/utils"
+	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/cluster-api-provider-aws/cmd/clusterawsadm/cloudformation/bootstrap"
+	clusterctlv1 "sigs.k8s.io/cluster-api/cmd/clusterctl/api/v1alpha3"
+	capiclient "sigs.k8s.io/cluster-api/cmd/clusterctl/client"
+)
+
+// RenderAwsK8sInstance writes the cluster YAML CreateAwsK8sInstance would apply to workdir/install-cluster.yaml,
+// without a management cluster or anything on AWS. The CAPA cluster template is still downloaded from its
+// release. It returns the version of CAPA the YAML is for
+func RenderAwsK8sInstance(clusterName *string, workdir string, awsvars map[string]string, createHaCluster bool) (string, error) {
+	// Export AWS settings as Env vars
+	for k := range awsvars {
+		os.Setenv(k, awsvars[k])
+	}
+
+	c, err := capiclient.New("")
+	if err != nil {
+		return "", err
+	}
+
+	// Without a management cluster to ask, the template comes from the version of CAPA clusterctl would install
+	components, err := c.GetProviderComponents("aws", clusterctlv1.InfrastructureProviderType, capiclient.ComponentsOptions{SkipTemplateProcess: true})
+	if err != nil {
+		return "", err
+	}
+	version := components.Version()
+
+	log.Info("Rendering the cluster YAML with CAPA ", version)
+	cpMachineCount, workerMachineCount := AWSMachineCounts(createHaCluster)
+	installYaml, err := c.GetClusterTemplate(capiclient.GetClusterTemplateOptions{
+		ClusterName:              *clusterName,
+		ControlPlaneMachineCount: &cpMachineCount,
+		WorkerMachineCount:       &workerMachineCount,
+		KubernetesVersion:        KubernetesVersion,
+		TargetNamespace:          "default",
+		ProviderRepositorySource: &capiclient.ProviderRepositorySourceOptions{InfrastructureProvider: "aws:" + version},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	err = writeAwsInstallYaml(installYaml, workdir+"/"+"install-cluster.yaml", *clusterName)
+	if err != nil {
+		return "", err
+	}
+
+	// If we're here, we should be okay
+	return version, nil
+}
+
+// AWSBootstrapStackName is the name of the CloudFormation stack CreateAwsK8sInstance creates
+func AWSBootstrapStackName() string {
+	return bootstrap.NewTemplate().Spec.StackName
+}
+
+// writeAwsInstallYaml writes out the cluster YAML of an AWS cluster, changed the way that was asked for
+func writeAwsInstallYaml(installYaml capiclient.Template, installClusterYaml string, clusterName string) error {
+	err := utils.WriteYamlOutput(installYaml, installClusterYaml)
+	if err != nil {
+		return err
+	}
+
+	// Replace the workers the way that was asked for
+	if RolloutStrategy != nil {
+		err = applyRolloutStrategy(installClusterYaml)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Turn on the feature gates that were asked for
+	if len(FeatureGates) > 0 {
+		err = applyFeatureGates(installClusterYaml)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Reach the nodes through konnectivity if asked for
+	if Konnectivity {
+		err = applyKonnectivity(installClusterYaml)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Encrypt secrets at rest if asked for
+	if EncryptSecrets {
+		err = applyEncryption(installClusterYaml)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Put the cluster in the VPC and the workers in the subnet that were given
+	if AWSPlacement != nil {
+		err = applyAWSPlacement(installClusterYaml, clusterName)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Let in who was asked for, and attach the security groups that were given
+	if AWSSecurity != nil {
+		err = applyAWSSecurity(installClusterYaml)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Give the machines the root volume that was asked for
+	if RootVolumeSize > 0 {
+		err = applyRootVolume(installClusterYaml)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
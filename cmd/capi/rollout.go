@@ -0,0 +1,97 @@
+package capi
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// RolloutStrategy is how the workers of a cluster are replaced, like during upgrades. If nil, the CAPI defaults
+// are kept
+var RolloutStrategy *RolloutStrategyConfig
+
+// RolloutStrategyConfig is the rolling update of the MachineDeployments of a cluster. MaxSurge and MaxUnavailable
+// are a number of machines or a percentage (e.g. 25%), and NodeDrainTimeout how long a node is drained for before
+// its machine is deleted anyway (e.g. 10m). Empty ones are left as they are
+type RolloutStrategyConfig struct {
+	MaxSurge         string
+	MaxUnavailable   string
+	NodeDrainTimeout string
+}
+
+// ValidateRolloutStrategy makes sure CAPI takes the rollout strategy
+func ValidateRolloutStrategy(s *RolloutStrategyConfig) error {
+	for _, v := range []string{s.MaxSurge, s.MaxUnavailable} {
+		if v == "" {
+			continue
+		}
+		if i := intstr.Parse(v); i.Type == intstr.String && !strings.HasSuffix(v, "%") {
+			return errors.New("invalid rollout value " + v + ", it should be a number or a percentage")
+		}
+	}
+
+	// Nothing would ever be replaced, max unavailable is 0 if it's not given
+	if isZero(s.MaxSurge) && (s.MaxUnavailable == "" || isZero(s.MaxUnavailable)) {
+		return errors.New("max surge and max unavailable can't both be 0")
+	}
+
+	if s.NodeDrainTimeout != "" {
+		_, err := time.ParseDuration(s.NodeDrainTimeout)
+		if err != nil {
+			return errors.New("invalid node drain timeout " + s.NodeDrainTimeout + ": " + err.Error())
+		}
+	}
+
+	// If we're here, we should be okay
+	return nil
+}
+
+// applyRolloutStrategy changes the generated cluster YAML so the MachineDeployments get the RolloutStrategy
+func applyRolloutStrategy(installClusterYaml string) error {
+	return patchInstallYaml(installClusterYaml, func(obj *unstructured.Unstructured) (bool, error) {
+		if obj.GetKind() != "MachineDeployment" {
+			return false, nil
+		}
+
+		if RolloutStrategy.MaxSurge != "" || RolloutStrategy.MaxUnavailable != "" {
+			err := unstructured.SetNestedField(obj.Object, "RollingUpdate", "spec", "strategy", "type")
+			if err != nil {
+				return false, err
+			}
+		}
+		for field, v := range map[string]string{"maxSurge": RolloutStrategy.MaxSurge, "maxUnavailable": RolloutStrategy.MaxUnavailable} {
+			if v == "" {
+				continue
+			}
+			err := unstructured.SetNestedField(obj.Object, intstrValue(v), "spec", "strategy", "rollingUpdate", field)
+			if err != nil {
+				return false, err
+			}
+		}
+		if RolloutStrategy.NodeDrainTimeout != "" {
+			err := unstructured.SetNestedField(obj.Object, RolloutStrategy.NodeDrainTimeout, "spec", "template", "spec", "nodeDrainTimeout")
+			if err != nil {
+				return false, err
+			}
+		}
+
+		return true, nil
+	})
+}
+
+// intstrValue returns the number or percentage the way it goes in the YAML
+func intstrValue(v string) interface{} {
+	i := intstr.Parse(v)
+	if i.Type == intstr.Int {
+		return int64(i.IntVal)
+	}
+	return i.StrVal
+}
+
+// isZero returns true if the number or percentage is 0
+func isZero(v string) bool {
+	return v == "0" || v == "0%"
+}
@@ -0,0 +1,46 @@
+package capi
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// WorkerMachineCount is how many workers a cluster is created with. If 0, it's 3 for HA clusters and 2 otherwise
+var WorkerMachineCount int64
+
+// AWSMachineCounts returns how many control plane machines and workers an AWS cluster is created with
+func AWSMachineCounts(createHaCluster bool) (int64, int64) {
+	var cpMachineCount int64 = 1
+	var workerMachineCount int64 = 2
+	if createHaCluster {
+		cpMachineCount = 3
+		workerMachineCount = 3
+	}
+	if WorkerMachineCount > 0 {
+		workerMachineCount = WorkerMachineCount
+	}
+	return cpMachineCount, workerMachineCount
+}
+
+// RootVolumeSize is the size in GB of the root volumes of the machines of AWS and Azure clusters, and RootVolumeType
+// the EBS volume type on AWS. The defaults of the provider are kept if they're not set
+var (
+	RootVolumeSize int64
+	RootVolumeType string
+)
+
+// applyRootVolume changes the generated cluster YAML so the machines get the root volume that was asked for
+func applyRootVolume(installClusterYaml string) error {
+	return patchInstallYaml(installClusterYaml, func(obj *unstructured.Unstructured) (bool, error) {
+		switch obj.GetKind() {
+		case "AWSMachineTemplate":
+			rootVolume := map[string]interface{}{"size": RootVolumeSize}
+			if RootVolumeType != "" {
+				rootVolume["type"] = RootVolumeType
+			}
+			return true, unstructured.SetNestedField(obj.Object, rootVolume, "spec", "template", "spec", "rootVolume")
+		case "AzureMachineTemplate":
+			return true, unstructured.SetNestedField(obj.Object, RootVolumeSize, "spec", "template", "spec", "osDisk", "diskSizeGB")
+		}
+		return false, nil
+	})
+}
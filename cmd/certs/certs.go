@@ -0,0 +1,182 @@
+package certs
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"time"
+
+	"github.com/christianh814/gokp/cmd/clock"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/clientcmd"
+	capiclient "sigs.k8s.io/cluster-api/cmd/clusterctl/client"
+)
+
+// RotationWait is how often WaitForRotation checks on the machines, and how long replacing the control plane
+// machines can take
+var RotationWait clock.Waiter = clock.Waiter{Interval: 30 * time.Second, Timeout: time.Hour}
+
+var kcpGVR = schema.GroupVersionResource{Group: "controlplane.cluster.x-k8s.io", Version: "v1beta1", Resource: "kubeadmcontrolplanes"}
+var machineGVR = schema.GroupVersionResource{Group: "cluster.x-k8s.io", Version: "v1beta1", Resource: "machines"}
+
+// Expiry returns when the client certificate of the current context of the kubeconfig expires
+func Expiry(kubeconfig string) (time.Time, error) {
+	cfg, err := clientcmd.LoadFromFile(kubeconfig)
+	if err != nil {
+		return time.Time{}, err
+	}
+	ctx, ok := cfg.Contexts[cfg.CurrentContext]
+	if !ok {
+		return time.Time{}, errors.New("no current context in " + kubeconfig)
+	}
+	authInfo, ok := cfg.AuthInfos[ctx.AuthInfo]
+	if !ok || len(authInfo.ClientCertificateData) == 0 {
+		return time.Time{}, errors.New("no client certificate in " + kubeconfig)
+	}
+
+	block, _ := pem.Decode(authInfo.ClientCertificateData)
+	if block == nil {
+		return time.Time{}, errors.New("unable to read the client certificate in " + kubeconfig)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return cert.NotAfter, nil
+}
+
+// Rotate has every KubeadmControlPlane of the cluster replace its machines, which comes with new certificates for
+// everything on them. It returns the KubeadmControlPlanes and the time they were asked to roll out after
+func Rotate(kubeconfig string, clusterName string) ([]*unstructured.Unstructured, time.Time, error) {
+	dyn, err := newDynamicClient(kubeconfig)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	kcps, err := dyn.Resource(kcpGVR).List(context.TODO(), metav1.ListOptions{LabelSelector: "cluster.x-k8s.io/cluster-name=" + clusterName})
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if len(kcps.Items) == 0 {
+		return nil, time.Time{}, errors.New("no KubeadmControlPlane found for " + clusterName)
+	}
+
+	// rolloutAfter only has seconds, and machines older than it get replaced
+	since := time.Now().Truncate(time.Second)
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"rolloutAfter": since.UTC().Format(time.RFC3339),
+		},
+	})
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	objs := []*unstructured.Unstructured{}
+	for i := range kcps.Items {
+		kcp := &kcps.Items[i]
+		log.Info("Rolling out KubeadmControlPlane ", kcp.GetNamespace(), "/", kcp.GetName())
+		_, err = dyn.Resource(kcpGVR).Namespace(kcp.GetNamespace()).Patch(context.TODO(), kcp.GetName(), types.MergePatchType, patch, metav1.PatchOptions{})
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		objs = append(objs, kcp)
+	}
+
+	return objs, since, nil
+}
+
+// WaitForRotation waits for every machine of the KubeadmControlPlanes to be replaced by one created after since,
+// and for all of them to be ready
+func WaitForRotation(kubeconfig string, objs []*unstructured.Unstructured, since time.Time) error {
+	dyn, err := newDynamicClient(kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	for _, obj := range objs {
+		log.Info("Waiting for the machines of KubeadmControlPlane ", obj.GetName(), " to be replaced")
+
+		err = RotationWait.Until(func() (bool, error) {
+			done, err := rotated(dyn, obj, since)
+			return err == nil && done, nil
+		})
+		if err == clock.ErrTimeout {
+			return errors.New("KubeadmControlPlane " + obj.GetName() + " took too long to replace its machines")
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// If we're here, we should be okay
+	return nil
+}
+
+// rotated returns true when the KubeadmControlPlane only has ready machines that were created after since
+func rotated(dyn dynamic.Interface, obj *unstructured.Unstructured, since time.Time) (bool, error) {
+	live, err := dyn.Resource(kcpGVR).Namespace(obj.GetNamespace()).Get(context.TODO(), obj.GetName(), metav1.GetOptions{})
+	if err != nil {
+		return false, err
+	}
+	observed, _, _ := unstructured.NestedInt64(live.Object, "status", "observedGeneration")
+	if observed < live.GetGeneration() {
+		return false, nil
+	}
+	wanted, _, _ := unstructured.NestedInt64(live.Object, "spec", "replicas")
+	replicas, _, _ := unstructured.NestedInt64(live.Object, "status", "replicas")
+	updated, _, _ := unstructured.NestedInt64(live.Object, "status", "updatedReplicas")
+	ready, _, _ := unstructured.NestedInt64(live.Object, "status", "readyReplicas")
+	if replicas != wanted || updated != wanted || ready != wanted {
+		return false, nil
+	}
+
+	// The status can be read before the controller saw rolloutAfter, so check the machines themselves
+	machines, err := dyn.Resource(machineGVR).Namespace(obj.GetNamespace()).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: "cluster.x-k8s.io/control-plane,cluster.x-k8s.io/cluster-name=" + obj.GetLabels()["cluster.x-k8s.io/cluster-name"],
+	})
+	if err != nil {
+		return false, err
+	}
+	if int64(len(machines.Items)) != wanted {
+		return false, nil
+	}
+	for _, m := range machines.Items {
+		if m.GetCreationTimestamp().Time.Before(since) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// Kubeconfig returns the admin kubeconfig CAPI keeps for the cluster in the namespace. It's renewed by CAPI ahead
+// of its client certificate expiring
+func Kubeconfig(kubeconfig string, clusterName string, namespace string) (string, error) {
+	c, err := capiclient.New("")
+	if err != nil {
+		return "", err
+	}
+	return c.GetKubeconfig(capiclient.GetKubeconfigOptions{
+		Kubeconfig:          capiclient.Kubeconfig{Path: kubeconfig},
+		WorkloadClusterName: clusterName,
+		Namespace:           namespace,
+	})
+}
+
+// newDynamicClient returns a dynamic client for the kubeconfig
+func newDynamicClient(kubeconfig string) (dynamic.Interface, error) {
+	cfg, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	return dynamic.NewForConfig(cfg)
+}
@@ -0,0 +1,89 @@
+package checkpoint
+
+import (
+	"io/ioutil"
+
+	"sigs.k8s.io/yaml"
+)
+
+// File is the name of the file, under the workdir of an install, that the phases done so far are kept in
+var File string = "gokp-checkpoint.yaml"
+
+// The phases of an install, in the order they're done. Not every provider has all of them
+const (
+	KindCreated        = "kind-created"
+	ClusterCreated     = "cluster-created"
+	RepoCreated        = "repo-created"
+	RepoPushed         = "repo-pushed"
+	GitOpsBootstrapped = "gitops-bootstrapped"
+	Pivoted            = "pivoted"
+)
+
+// Checkpoint is how far an install got, along with what the later phases need from the earlier ones
+type Checkpoint struct {
+	ClusterName string   `json:"clusterName"`
+	Provider    string   `json:"provider"`
+	Phases      []string `json:"phases,omitempty"`
+	GitOpsRepo  string   `json:"gitOpsRepo,omitempty"`
+	RepoPath    string   `json:"repoPath,omitempty"`
+	RemoteName  string   `json:"remoteName,omitempty"`
+	Branch      string   `json:"branch,omitempty"`
+
+	// AWSStackCreated is set if the install created the CloudFormation stack of CAPA, rather than it being there
+	AWSStackCreated bool `json:"awsStackCreated,omitempty"`
+
+	// AWSSecurityGroup is the security group of the API server load balancer the install made in AWSRegion, which is
+	// deleted if the install fails
+	AWSSecurityGroup string `json:"awsSecurityGroup,omitempty"`
+	AWSRegion        string `json:"awsRegion,omitempty"`
+
+	dir string
+}
+
+// New returns the checkpoint of an install that's just starting in dir
+func New(dir string, clusterName string, provider string) *Checkpoint {
+	return &Checkpoint{ClusterName: clusterName, Provider: provider, dir: dir}
+}
+
+// Load reads the checkpoint of the install in dir
+func Load(dir string) (*Checkpoint, error) {
+	b, err := ioutil.ReadFile(dir + "/" + File)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Checkpoint{dir: dir}
+	err = yaml.Unmarshal(b, c)
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Save writes the checkpoint into the dir of the install
+func (c *Checkpoint) Save() error {
+	b, err := yaml.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(c.dir+"/"+File, b, 0644)
+}
+
+// Done returns true if the phase was finished
+func (c *Checkpoint) Done(phase string) bool {
+	for _, p := range c.Phases {
+		if p == phase {
+			return true
+		}
+	}
+	return false
+}
+
+// Mark records that the phase was finished
+func (c *Checkpoint) Mark(phase string) error {
+	if !c.Done(phase) {
+		c.Phases = append(c.Phases, phase)
+	}
+	return c.Save()
+}
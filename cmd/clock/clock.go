@@ -0,0 +1,79 @@
+package clock
+
+import (
+	"errors"
+	"time"
+)
+
+// Clock tells the time and sleeps. Polling loops go through it instead of the time package, so they can be run
+// with a fake one that doesn't actually wait
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+}
+
+// Real is the clock of the time package
+type Real struct{}
+
+// Now returns the current time
+func (Real) Now() time.Time {
+	return time.Now()
+}
+
+// Sleep sleeps for d
+func (Real) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+// Default is the clock every polling loop uses, unless its Waiter was given another one
+var Default Clock = Real{}
+
+// Sleep sleeps for d on the Default clock
+func Sleep(d time.Duration) {
+	Default.Sleep(d)
+}
+
+// ErrTimeout is what Until returns when the condition wasn't met before the Timeout of the Waiter
+var ErrTimeout = errors.New("timed out")
+
+// Waiter checks a condition every Interval until it's met, giving up after Timeout. Every wait has one, so none of
+// them can hang forever
+type Waiter struct {
+	Interval time.Duration
+	Timeout  time.Duration
+	// Clock is the Default one if nil
+	Clock Clock
+}
+
+// Until checks the condition right away, and then every Interval, until it returns true or an error. ErrTimeout
+// is returned if it's still false once the Timeout has passed
+func (w Waiter) Until(condition func() (bool, error)) error {
+	c := w.Clock
+	if c == nil {
+		c = Default
+	}
+
+	deadline := c.Now().Add(w.Timeout)
+	for {
+		done, err := condition()
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+		if !c.Now().Add(w.Interval).Before(deadline) {
+			return ErrTimeout
+		}
+		c.Sleep(w.Interval)
+	}
+}
+
+// Pause sleeps for one Interval, for giving something a moment longer once it's there
+func (w Waiter) Pause() {
+	if w.Clock == nil {
+		Default.Sleep(w.Interval)
+		return
+	}
+	w.Clock.Sleep(w.Interval)
+}
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// clusterConfigKey is the section of the config file that holds the flags of create-cluster
+var clusterConfigKey string = "createCluster"
+
+// applyClusterConfig sets the flags of the command from the named profile, and then from the createCluster section of
+// the config file, except the ones given on the command line. Keys are flag names, and ${VAR} (or $VAR) in values is replaced by the
+// environment variable, with $$ for a $
+func applyClusterConfig(cmd *cobra.Command) error {
+	// A config file that was asked for has to be there, initConfig doesn't complain
+	if cfgFile != "" {
+		err := viper.ReadInConfig()
+		if err != nil {
+			return errors.New("unable to read " + cfgFile + ": " + err.Error())
+		}
+	}
+
+	// The named profile is more specific than the config file, so it goes first
+	err := applyNamedProfile(cmd)
+	if err != nil {
+		return err
+	}
+
+	settings := viper.GetStringMap(clusterConfigKey)
+	names := []string{}
+	for name := range settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		flag := cmd.Flags().Lookup(name)
+		if flag == nil {
+			return errors.New("unknown setting " + name + " under " + clusterConfigKey + ", it should be a flag of \"" + cmd.CommandPath() + "\"")
+		}
+		if cmd.Flags().Changed(name) {
+			continue
+		}
+
+		values, err := clusterConfigValues(settings[name])
+		if err != nil {
+			return errors.New("invalid setting " + name + " under " + clusterConfigKey + ": " + err.Error())
+		}
+		for _, value := range values {
+			err = cmd.Flags().Set(name, value)
+			if err != nil {
+				return errors.New("invalid setting " + name + " under " + clusterConfigKey + ": " + err.Error())
+			}
+		}
+	}
+
+	return nil
+}
+
+// clusterConfigValues returns what a setting sets its flag to, with the environment variables in it replaced.
+// Lists and maps set it once per item, which adds to flags that take more than one value
+func clusterConfigValues(setting interface{}) ([]string, error) {
+	values := []string{}
+	switch s := setting.(type) {
+	case []interface{}:
+		for _, v := range s {
+			values = append(values, fmt.Sprint(v))
+		}
+	case map[string]interface{}:
+		keys := []string{}
+		for k := range s {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			values = append(values, k+"="+fmt.Sprint(s[k]))
+		}
+	default:
+		values = append(values, fmt.Sprint(s))
+	}
+
+	for i, value := range values {
+		missing := []string{}
+		values[i] = os.Expand(value, func(name string) string {
+			if name == "$" {
+				return "$"
+			}
+			v, ok := os.LookupEnv(name)
+			if !ok {
+				missing = append(missing, name)
+			}
+			return v
+		})
+		if len(missing) > 0 {
+			return nil, errors.New("environment variable(s) " + strings.Join(missing, ", ") + " not set")
+		}
+	}
+
+	return values, nil
+}
@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/christianh814/gokp/cmd/state"
+	"github.com/spf13/cobra"
+)
+
+// clusterNameAnnotation says what --cluster-name is on a command and the commands under it. "new" is a cluster
+// that doesn't exist yet, so it's neither completed nor checked. "any" is completed but not checked, for commands
+// that clean up after a cluster that's gone
+var clusterNameAnnotation string = "gokp.io/cluster-name"
+
+// registerClusterNameCompletion completes --cluster-name with the clusters under ~/.gokp and in the shared state,
+// on every command under c that takes one for an existing cluster
+func registerClusterNameCompletion(c *cobra.Command) {
+	if c.Annotations[clusterNameAnnotation] == "new" {
+		return
+	}
+	if c.Flags().Lookup("cluster-name") != nil {
+		// A persistent flag is shared with the commands under it, and is only registered once
+		c.RegisterFlagCompletionFunc("cluster-name", completeClusterName)
+	}
+	for _, sub := range c.Commands() {
+		registerClusterNameCompletion(sub)
+	}
+}
+
+// completeClusterName returns the names of the clusters that start with what's been typed
+func completeClusterName(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	names, err := state.Names()
+	if err != nil {
+		cobra.CompErrorln(err.Error())
+		return nil, cobra.ShellCompDirectiveError
+	}
+
+	matches := []string{}
+	for _, name := range names {
+		if strings.HasPrefix(name, toComplete) {
+			matches = append(matches, name)
+		}
+	}
+	return matches, cobra.ShellCompDirectiveNoFileComp
+}
+
+// checkClusterName makes sure the cluster given with --cluster-name is under ~/.gokp or in the shared state, so a
+// typo doesn't get as far as a missing kubeconfig
+func checkClusterName(cmd *cobra.Command) error {
+	for c := cmd; c != nil; c = c.Parent() {
+		if c.Annotations[clusterNameAnnotation] != "" {
+			return nil
+		}
+	}
+	flag := cmd.Flags().Lookup("cluster-name")
+	if flag == nil || flag.Value.String() == "" {
+		return nil
+	}
+
+	clusterName := flag.Value.String()
+	ok, err := state.Exists(clusterName)
+	if err != nil {
+		return err
+	}
+	if ok {
+		return nil
+	}
+
+	where := state.BaseDir()
+	if state.Shared != nil {
+		where += " or in " + state.Shared.String()
+	}
+	names, err := state.Names()
+	if err != nil || len(names) == 0 {
+		return errors.New("unknown cluster " + clusterName + ", it isn't under " + where)
+	}
+	return errors.New("unknown cluster " + clusterName + ", it isn't under " + where + ". The clusters are: " + strings.Join(names, ", "))
+}
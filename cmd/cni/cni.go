@@ -0,0 +1,293 @@
+package cni
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/christianh814/gokp/cmd/clock"
+	"github.com/christianh814/gokp/cmd/templates"
+	"github.com/christianh814/gokp/cmd/utils"
+	log "github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Label is put on every object of the CNI that's applied, so the export of the cluster leaves them to the copy of
+// the manifest that's in the GitOps repo
+var Label string = "gokp.io/cni"
+
+// PodCIDR is the CIDR the pods of the cluster get their IPs from, which is the default of the CAPI cluster templates
+var PodCIDR string = "192.168.0.0/16"
+
+// VersionAnnotation is put on every object of the CNI that's applied, with the version of the CNI it came from
+var VersionAnnotation string = "gokp.io/cni-version"
+
+// Version is the version of the CNI that's installed. If empty, the Version of the installer is used
+var Version string = ""
+
+// None is the name to give to not install a CNI, for when the cluster template brings its own
+var None string = "none"
+
+// PriorityClasses makes sure the CNI runs with the system-node-critical (DaemonSets) and system-cluster-critical
+// (Deployments) PriorityClasses so it's not evicted under pressure. The CNIs ship with their own requests
+var PriorityClasses bool = true
+
+// Installer is a CNI that GOKP knows how to install on a cluster
+type Installer interface {
+	// Name is what the CNI is called (e.g. "calico")
+	Name() string
+	// Manifests writes out the YAML for the CNI under the workdir and returns the files, in the order they are applied
+	Manifests(workdir string) ([]string, error)
+	// Ready returns true once the CNI has rolled out on the cluster
+	Ready(clientset kubernetes.Interface) (bool, error)
+}
+
+// ManifestInstaller installs a CNI from a single (multi-document) YAML manifest
+type ManifestInstaller struct {
+	// CNIName is the name the installer is registered under
+	CNIName string
+	// URL is where the manifest is downloaded from. It can use {{.Version}} to point at a specific version
+	URL string
+	// Version is the version of the CNI that's installed if Version isn't set
+	Version string
+	// Values are replaced in the manifest before it's applied (the key is replaced with the value)
+	Values map[string]string
+	// PodCIDR is the CIDR of the pods in the manifest, if it has one, which is replaced with the PodCIDR of the cluster
+	PodCIDR string
+	// Namespace and DaemonSet are the DaemonSet that is rolled out to every node once the CNI is ready
+	Namespace string
+	DaemonSet string
+}
+
+// Name returns the name the installer is registered under
+func (m *ManifestInstaller) Name() string {
+	return m.CNIName
+}
+
+// Manifests downloads the manifest, fills in the values and splits it into individual files
+func (m *ManifestInstaller) Manifests(workdir string) ([]string, error) {
+	//	Download the CNI YAML of the version that's pinned
+	version := m.Version
+	if Version != "" {
+		version = Version
+	}
+	url, err := m.renderURL(version)
+	if err != nil {
+		return nil, err
+	}
+	cniYaml := workdir + "/" + "cni.yaml"
+	_, err = utils.DownloadFile(cniYaml, url)
+	if err != nil {
+		return nil, errors.New("unable to download " + m.CNIName + " " + version + ": " + err.Error())
+	}
+
+	// Fill in any values
+	values := map[string]string{}
+	for k, v := range m.Values {
+		values[k] = v
+	}
+	if m.PodCIDR != "" {
+		values[m.PodCIDR] = PodCIDR
+	}
+	if len(values) > 0 {
+		b, err := ioutil.ReadFile(cniYaml)
+		if err != nil {
+			return nil, err
+		}
+		err = ioutil.WriteFile(cniYaml, []byte(Render(string(b), values)), 0644)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Label it with its version, and make sure the CNI has a system critical PriorityClass
+	err = kustomizeManifest(workdir, cniYaml, m.CNIName, version)
+	if err != nil {
+		return nil, err
+	}
+
+	//	Split the  CNI yaml into individual files
+	err = utils.SplitYamls(workdir+"/"+"cni-output", cniYaml, "---")
+	if err != nil {
+		return nil, err
+	}
+
+	//	get a list of those files
+	return filepath.Glob(workdir + "/" + "cni-output" + "/" + "*.yaml")
+}
+
+// renderURL returns the URL of the manifest of the version
+func (m *ManifestInstaller) renderURL(version string) (string, error) {
+	tmpl, err := template.New(m.CNIName).Funcs(utils.TemplateFuncs).Parse(m.URL)
+	if err != nil {
+		return "", errors.New("bad url for CNI " + m.CNIName + ": " + err.Error())
+	}
+
+	var b bytes.Buffer
+	err = tmpl.Execute(&b, struct{ Version string }{Version: version})
+	if err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
+
+// Ready returns true once the CNI DaemonSet is running on every node it's scheduled on
+func (m *ManifestInstaller) Ready(clientset kubernetes.Interface) (bool, error) {
+	return DaemonSetReady(clientset, m.Namespace, m.DaemonSet)
+}
+
+// Installers are the CNIs that can be installed, by name
+var Installers = map[string]Installer{
+	"calico": &ManifestInstaller{
+		CNIName:   "calico",
+		URL:       "https://raw.githubusercontent.com/projectcalico/calico/{{.Version}}/manifests/calico.yaml",
+		Version:   "v3.24.1",
+		Namespace: "kube-system",
+		DaemonSet: "calico-node",
+	},
+	"calico-azure": &ManifestInstaller{
+		CNIName:   "calico-azure",
+		URL:       "https://raw.githubusercontent.com/kubernetes-sigs/cluster-api-provider-azure/{{.Version}}/templates/addons/calico.yaml",
+		Version:   "v1.5.3",
+		Namespace: "kube-system",
+		DaemonSet: "calico-node",
+	},
+	"cilium": &ManifestInstaller{
+		CNIName:   "cilium",
+		URL:       "https://raw.githubusercontent.com/cilium/cilium/{{.Version}}/install/kubernetes/quick-install.yaml",
+		Version:   "v1.11.20",
+		Namespace: "kube-system",
+		DaemonSet: "cilium",
+	},
+	"flannel": &ManifestInstaller{
+		CNIName:   "flannel",
+		URL:       "https://github.com/flannel-io/flannel/releases/download/{{.Version}}/kube-flannel.yml",
+		Version:   "v0.19.2",
+		PodCIDR:   "10.244.0.0/16",
+		Namespace: "kube-flannel",
+		DaemonSet: "kube-flannel-ds",
+	},
+}
+
+// Register adds an installer, replacing any installer already registered under the same name
+func Register(i Installer) {
+	Installers[i.Name()] = i
+}
+
+// Get returns the installer registered under the name given
+func Get(name string) (Installer, error) {
+	i, ok := Installers[name]
+	if !ok {
+		return nil, errors.New("unknown CNI " + name + ", valid CNIs are: " + strings.Join(Names(), ", "))
+	}
+	return i, nil
+}
+
+// Names returns the names of all the registered installers, sorted
+func Names() []string {
+	names := []string{}
+	for name := range Installers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Render returns the manifest with every key in values replaced by its value
+func Render(manifest string, values map[string]string) string {
+	// Replace longer keys first so a key that is a prefix of another doesn't clobber it
+	keys := []string{}
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return len(keys[i]) > len(keys[j]) })
+
+	for _, k := range keys {
+		manifest = strings.ReplaceAll(manifest, k, values[k])
+	}
+	return manifest
+}
+
+// kustomizeManifest runs the CNI YAML through kustomize to put the Label and the VersionAnnotation on its objects
+// and, with PriorityClasses, to set the PriorityClass of its workloads
+func kustomizeManifest(workdir string, cniYaml string, name string, version string) error {
+	kustomizeDir := workdir + "/" + "cni-kustomize"
+	err := os.MkdirAll(kustomizeDir, 0755)
+	if err != nil {
+		return err
+	}
+	err = utils.CopyFile(cniYaml, kustomizeDir+"/"+"cni.yaml")
+	if err != nil {
+		return err
+	}
+
+	vars := struct {
+		Label             string
+		Name              string
+		VersionAnnotation string
+		Version           string
+		PriorityClasses   bool
+	}{
+		Label:             Label,
+		Name:              name,
+		VersionAnnotation: VersionAnnotation,
+		Version:           version,
+		PriorityClasses:   PriorityClasses,
+	}
+	_, err = utils.WriteTemplate(templates.CNIKustomize, kustomizeDir+"/"+"kustomization.yaml", vars)
+	if err != nil {
+		return err
+	}
+
+	_, err = utils.RunKustomize(kustomizeDir, cniYaml)
+	return err
+}
+
+// DaemonSetReady returns true once the DaemonSet is scheduled and every pod of it is up to date and ready
+func DaemonSetReady(clientset kubernetes.Interface, namespace string, name string) (bool, error) {
+	ds, err := clientset.AppsV1().DaemonSets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		// It may not have been created yet
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return RolledOut(ds), nil
+}
+
+// RolledOut returns true if the DaemonSet is scheduled and every pod of it is up to date and ready
+func RolledOut(ds *appsv1.DaemonSet) bool {
+	s := ds.Status
+	if ds.Generation > s.ObservedGeneration || s.DesiredNumberScheduled == 0 {
+		return false
+	}
+	return s.UpdatedNumberScheduled == s.DesiredNumberScheduled && s.NumberReady == s.DesiredNumberScheduled
+}
+
+// RolloutWait is how often WaitForReady checks if the CNI has rolled out, and how long it waits for it
+var RolloutWait clock.Waiter = clock.Waiter{Interval: 10 * time.Second, Timeout: 5 * time.Minute}
+
+// WaitForReady waits until the CNI has rolled out
+func WaitForReady(clientset kubernetes.Interface, i Installer) error {
+	log.Info("Waiting for the ", i.Name(), " CNI to roll out")
+	err := RolloutWait.Until(func() (bool, error) {
+		return i.Ready(clientset)
+	})
+	if err != clock.ErrTimeout {
+		return err
+	}
+	return errors.New("CNI " + i.Name() + " took too long to roll out")
+}
@@ -0,0 +1,276 @@
+package cni
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// testManifest is what the fake download server hands out for every CNI, with the pod CIDR of flannel in it
+var testManifest string = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cni-config
+  namespace: kube-system
+data:
+  network: "10.244.0.0/16"
+---
+apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: cni-node
+  namespace: kube-system
+spec:
+  selector:
+    matchLabels:
+      app: cni-node
+  template:
+    metadata:
+      labels:
+        app: cni-node
+    spec:
+      containers:
+      - name: cni
+        image: cni:latest
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: cni-controller
+  namespace: kube-system
+spec:
+  selector:
+    matchLabels:
+      app: cni-controller
+  template:
+    metadata:
+      labels:
+        app: cni-controller
+    spec:
+      containers:
+      - name: controller
+        image: cni:latest
+`
+
+func TestGet(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr string
+	}{
+		{name: "calico"},
+		{name: "calico-azure"},
+		{name: "cilium"},
+		{name: "flannel"},
+		{name: "weave", wantErr: "unknown CNI weave, valid CNIs are: calico, calico-azure, cilium, flannel"},
+		{name: "", wantErr: "unknown CNI , valid CNIs are: "},
+		// None is handled by whoever installs the CNI, it's never an installer
+		{name: None, wantErr: "unknown CNI none, valid CNIs are: "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i, err := Get(tt.name)
+			if tt.wantErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+					t.Fatalf("Get(%q) got error %v, want one starting with %q", tt.name, err, tt.wantErr)
+				}
+				if i != nil {
+					t.Fatalf("Get(%q) got installer %v with an error", tt.name, i)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Get(%q) failed: %s", tt.name, err)
+			}
+			if i.Name() != tt.name {
+				t.Fatalf("Get(%q) got installer %q", tt.name, i.Name())
+			}
+		})
+	}
+}
+
+func TestInstallersReadinessTarget(t *testing.T) {
+	tests := []struct {
+		name      string
+		namespace string
+		daemonSet string
+	}{
+		{name: "calico", namespace: "kube-system", daemonSet: "calico-node"},
+		{name: "calico-azure", namespace: "kube-system", daemonSet: "calico-node"},
+		{name: "cilium", namespace: "kube-system", daemonSet: "cilium"},
+		{name: "flannel", namespace: "kube-flannel", daemonSet: "kube-flannel-ds"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i, err := Get(tt.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			m := i.(*ManifestInstaller)
+			if m.Namespace != tt.namespace || m.DaemonSet != tt.daemonSet {
+				t.Fatalf("%s waits for %s/%s, want %s/%s", tt.name, m.Namespace, m.DaemonSet, tt.namespace, tt.daemonSet)
+			}
+
+			// Not ready until the DaemonSet is there and rolled out
+			clientset := fake.NewSimpleClientset()
+			ready, err := i.Ready(clientset)
+			if err != nil || ready {
+				t.Fatalf("%s is ready (%v, %v) without its DaemonSet", tt.name, ready, err)
+			}
+			ds := &appsv1.DaemonSet{
+				ObjectMeta: metav1.ObjectMeta{Name: tt.daemonSet, Namespace: tt.namespace, Generation: 1},
+				Status: appsv1.DaemonSetStatus{
+					ObservedGeneration:     1,
+					DesiredNumberScheduled: 3,
+					UpdatedNumberScheduled: 3,
+					NumberReady:            3,
+				},
+			}
+			clientset = fake.NewSimpleClientset(ds)
+			ready, err = i.Ready(clientset)
+			if err != nil || !ready {
+				t.Fatalf("%s isn't ready (%v, %v) once %s/%s rolled out", tt.name, ready, err, tt.namespace, tt.daemonSet)
+			}
+		})
+	}
+}
+
+func TestRenderURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+		want    string
+	}{
+		{name: "calico", version: "v3.24.1", want: "https://raw.githubusercontent.com/projectcalico/calico/v3.24.1/manifests/calico.yaml"},
+		{name: "calico-azure", version: "v1.5.3", want: "https://raw.githubusercontent.com/kubernetes-sigs/cluster-api-provider-azure/v1.5.3/templates/addons/calico.yaml"},
+		{name: "cilium", version: "v1.12.0", want: "https://raw.githubusercontent.com/cilium/cilium/v1.12.0/install/kubernetes/quick-install.yaml"},
+		{name: "flannel", version: "v0.20.0", want: "https://github.com/flannel-io/flannel/releases/download/v0.20.0/kube-flannel.yml"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i, err := Get(tt.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := i.(*ManifestInstaller).renderURL(tt.version)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("renderURL(%q) got %q, want %q", tt.version, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestManifests(t *testing.T) {
+	requested := []string{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.Path)
+		w.Write([]byte(testManifest))
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		name        string
+		version     string
+		wantPath    string
+		wantVersion string
+		wantCIDR    string
+	}{
+		{name: "calico", wantPath: "/v3.24.1/cni.yaml", wantVersion: "v3.24.1", wantCIDR: "10.244.0.0/16"},
+		{name: "calico-azure", wantPath: "/v1.5.3/cni.yaml", wantVersion: "v1.5.3", wantCIDR: "10.244.0.0/16"},
+		{name: "cilium", wantPath: "/v1.11.20/cni.yaml", wantVersion: "v1.11.20", wantCIDR: "10.244.0.0/16"},
+		{name: "flannel", wantPath: "/v0.19.2/cni.yaml", wantVersion: "v0.19.2", wantCIDR: PodCIDR},
+		{name: "flannel", version: "v0.20.0", wantPath: "/v0.20.0/cni.yaml", wantVersion: "v0.20.0", wantCIDR: PodCIDR},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name+tt.version, func(t *testing.T) {
+			Version = tt.version
+			defer func() { Version = "" }()
+			requested = []string{}
+
+			i, err := Get(tt.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			m := *i.(*ManifestInstaller)
+			m.URL = ts.URL + "/{{.Version}}/cni.yaml"
+
+			files, err := m.Manifests(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(requested) != 1 || requested[0] != tt.wantPath {
+				t.Fatalf("downloaded %v, want %s", requested, tt.wantPath)
+			}
+
+			all := ""
+			for _, f := range files {
+				b, err := ioutil.ReadFile(f)
+				if err != nil {
+					t.Fatal(err)
+				}
+				all += string(b)
+			}
+			for _, want := range []string{
+				"name: cni-node",
+				"name: cni-controller",
+				Label + ": " + tt.name,
+				VersionAnnotation + ": " + tt.wantVersion,
+				"priorityClassName: system-node-critical",
+				"priorityClassName: system-cluster-critical",
+				"network: " + tt.wantCIDR,
+			} {
+				if !strings.Contains(all, want) {
+					t.Errorf("manifests of %s don't have %q:\n%s", tt.name, want, all)
+				}
+			}
+		})
+	}
+}
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+		values   map[string]string
+		want     string
+	}{
+		{
+			name:     "no values",
+			manifest: "cidr: 10.244.0.0/16",
+			want:     "cidr: 10.244.0.0/16",
+		},
+		{
+			name:     "replaces every match",
+			manifest: "a: VALUE\nb: VALUE",
+			values:   map[string]string{"VALUE": "x"},
+			want:     "a: x\nb: x",
+		},
+		{
+			name:     "longer keys first",
+			manifest: "a: VALUE\nb: VALUE_LONG",
+			values:   map[string]string{"VALUE": "x", "VALUE_LONG": "y"},
+			want:     "a: x\nb: y",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Render(tt.manifest, tt.values)
+			if got != tt.want {
+				t.Fatalf("Render() got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/christianh814/gokp/cmd/capi"
+	"github.com/christianh814/gokp/cmd/cni"
+	"github.com/christianh814/gokp/cmd/templates"
+	"github.com/christianh814/gokp/cmd/utils"
+	"github.com/spf13/cobra"
+)
+
+// addCNIFlag adds the flags for which CNI, and which version of it, is installed on the cluster
+func addCNIFlag(c *cobra.Command) {
+	c.Flags().String("cni", "calico", "CNI to install (calico, cilium, flannel, or none for the one of the cluster template).")
+	c.Flags().String("cni-version", "", "Version of the CNI to install (e.g. v3.24.1), the one GOKP was tested with by default.")
+}
+
+// setCNI sets the CNI that's installed, and its version, from the flags, making sure it's one we know how to install
+func setCNI(cmd *cobra.Command) error {
+	name, _ := cmd.Flags().GetString("cni")
+	version, _ := cmd.Flags().GetString("cni-version")
+	if name == cni.None && version != "" {
+		return errors.New("--cni-version can't be used with --cni=none")
+	}
+	if name != cni.None {
+		_, err := cni.Get(name)
+		if err != nil {
+			return err
+		}
+	}
+
+	// CAAPH installs the CNI from its HelmChartProxy, which is Calico
+	if capi.HelmAddons && name != "calico" {
+		return errors.New("--helm-addons only installs calico, it can't be used with --cni=" + name)
+	}
+
+	// Versions are tags, which start with a v
+	if version != "" && !strings.HasPrefix(version, "v") {
+		version = "v" + version
+	}
+	if capi.HelmAddons && version != "" {
+		capi.CalicoChartVersion = version
+	}
+
+	capi.CNI = name
+	cni.Version = version
+	return nil
+}
+
+// addCNIToRepo keeps the CNI manifest that was applied to the cluster under the cluster/core dir of baseDir, so
+// it's managed from the GitOps repo like the rest of the core components
+func addCNIToRepo(workdir string, baseDir string) error {
+	if capi.HelmAddons || capi.CNI == cni.None {
+		return nil
+	}
+
+	cniDir := baseDir + "/cluster/core/cni"
+	os.MkdirAll(cniDir, 0755)
+	err := utils.CopyFile(workdir+"/"+"cni.yaml", cniDir+"/"+"cni.yaml")
+	if err != nil {
+		return err
+	}
+	_, err = utils.WriteTemplate(templates.CNIRepoKustomize, cniDir+"/"+"kustomization.yaml", struct{}{})
+	return err
+}
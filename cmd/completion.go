@@ -12,6 +12,9 @@ var completionCmd = &cobra.Command{
 	Short: "Generates shell completion script.",
 	Long: `Generates shell completion script for your shell environment
 
+--cluster-name is completed with the clusters under ~/.gokp and, if it's
+set up, in the shared state, so clusters someone else created show up too.
+
 Example:
 
 	source <(gokp completion bash)
@@ -0,0 +1,222 @@
+package cmd
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/christianh814/gokp/cmd/addons"
+	"github.com/christianh814/gokp/cmd/externalsecrets"
+	"github.com/spf13/cobra"
+)
+
+// createAddOnFlags maps the flags that opt in to an add-on at install time to the add-on they enable
+var createAddOnFlags = map[string]string{
+	"enable-rollouts": "argo-rollouts",
+}
+
+// createAddOnVersionFlags maps the flags that opt in to an add-on at install time, optionally at a version (e.g.
+// --enable-cert-manager=v1.9.1), to the add-on they enable
+var createAddOnVersionFlags = map[string]string{
+	"enable-cert-manager":     "cert-manager",
+	"enable-ingress-nginx":    "ingress-nginx",
+	"enable-monitoring":       "kube-prometheus",
+	"enable-sealed-secrets":   "sealed-secrets",
+	"enable-external-secrets": "external-secrets",
+}
+
+// addCreateAddOnFlags adds the flags for the add-ons that can be installed along with the cluster
+func addCreateAddOnFlags(c *cobra.Command) {
+	c.Flags().Bool("enable-rollouts", false, "Install Argo Rollouts as an add-on, deployed from the GitOps repo.")
+	c.Flags().String("enable-cert-manager", "", "Install cert-manager as an add-on, deployed from the GitOps repo. A version can be given (e.g. --enable-cert-manager=v1.9.1).")
+	c.Flags().Lookup("enable-cert-manager").NoOptDefVal = addons.Available["cert-manager"].Version
+	c.Flags().String("enable-ingress-nginx", "", "Install ingress-nginx as an add-on, deployed from the GitOps repo with a Service set up for the provider. A version can be given (e.g. --enable-ingress-nginx=v1.3.1).")
+	c.Flags().Lookup("enable-ingress-nginx").NoOptDefVal = addons.Available["ingress-nginx"].Version
+	c.Flags().String("enable-monitoring", "", "Install Prometheus, Alertmanager, and Grafana (kube-prometheus) as an add-on, deployed from the GitOps repo. A version can be given (e.g. --enable-monitoring=v0.11.0).")
+	c.Flags().Lookup("enable-monitoring").NoOptDefVal = addons.Available["kube-prometheus"].Version
+	c.Flags().String("enable-sealed-secrets", "", "Install Sealed Secrets as an add-on, deployed from the GitOps repo, and keep the certificate to seal secrets with under ~/.gokp. A version can be given (e.g. --enable-sealed-secrets=v0.18.1).")
+	c.Flags().Lookup("enable-sealed-secrets").NoOptDefVal = addons.Available["sealed-secrets"].Version
+	c.Flags().String("enable-external-secrets", "", "Install the External Secrets Operator as an add-on, deployed from the GitOps repo. A version can be given (e.g. --enable-external-secrets=v0.5.9).")
+	c.Flags().Lookup("enable-external-secrets").NoOptDefVal = addons.Available["external-secrets"].Version
+	addExternalSecretsFlags(c)
+	c.Flags().String("policy-engine", "", "Install a policy engine ("+strings.Join(addons.PolicyEngines, " or ")+") as an add-on, with baseline policies that disallow privileged containers and require requests and limits.")
+	c.Flags().Bool("policy-enforce", false, "Block what breaks the baseline policies instead of only reporting it.")
+	c.Flags().StringSlice("policy-exempt-namespaces", []string{}, "More namespaces the baseline policies leave alone, on top of the ones of Kubernetes, the GitOps controller, and the add-ons.")
+	c.Flags().Bool("enable-logging", false, "Install Loki, with Promtail on every node, as a logging stack deployed from the GitOps repo.")
+	c.Flags().String("logging-retention", "168h", "How long Loki keeps logs for, in whole days (e.g. 720h for 30 days).")
+	c.Flags().String("logging-storage-size", "10Gi", "Size of the volume Loki keeps logs on, from the default StorageClass.")
+	c.Flags().Bool("enable-autoscaler", false, "Install cluster-autoscaler, deployed from the GitOps repo, to scale the workers between --workers-min and --workers-max.")
+	c.Flags().Int64("workers-min", 1, "The fewest workers the autoscaler scales each MachineDeployment down to.")
+	c.Flags().Int64("workers-max", 0, "The most workers the autoscaler scales each MachineDeployment up to.")
+	c.Flags().String("acme-email", "", "Email of the ACME account of a ClusterIssuer for cert-manager, which is only created if it's given.")
+	c.Flags().String("acme-server", addons.LetsEncryptServer, "ACME directory of the ClusterIssuer, Let's Encrypt by default (\"staging\" for its staging one).")
+	c.Flags().String("acme-issuer-name", "letsencrypt", "Name of the ClusterIssuer.")
+	c.Flags().String("acme-ingress-class", "", "IngressClass the HTTP-01 challenges of the ClusterIssuer are answered through (the default class if empty, nginx with --enable-ingress-nginx).")
+}
+
+// checkCreateAddOnFlags makes sure the add-on flags go together, before anything is created
+func checkCreateAddOnFlags(cmd *cobra.Command) error {
+	for flag := range createAddOnVersionFlags {
+		version, _ := cmd.Flags().GetString(flag)
+		if version != "" && !strings.HasPrefix(version, "v") {
+			return errors.New("invalid --" + flag + " " + version + ", the version should look like v1.2.3")
+		}
+	}
+
+	email, _ := cmd.Flags().GetString("acme-email")
+	certManager, _ := cmd.Flags().GetString("enable-cert-manager")
+	if email != "" && certManager == "" {
+		return errors.New("--acme-email needs --enable-cert-manager, the ClusterIssuer is a cert-manager resource")
+	}
+	if email == "" && (cmd.Flags().Changed("acme-server") || cmd.Flags().Changed("acme-issuer-name") || cmd.Flags().Changed("acme-ingress-class")) {
+		return errors.New("the ClusterIssuer is only created with --acme-email")
+	}
+
+	err := checkExternalSecretsFlags(cmd)
+	if err != nil {
+		return err
+	}
+
+	engine, _ := cmd.Flags().GetString("policy-engine")
+	if engine == "" && (cmd.Flags().Changed("policy-enforce") || cmd.Flags().Changed("policy-exempt-namespaces")) {
+		return errors.New("--policy-enforce and --policy-exempt-namespaces need --policy-engine")
+	}
+	if engine != "" && !isPolicyEngine(engine) {
+		return errors.New("unknown --policy-engine " + engine + " (use " + strings.Join(addons.PolicyEngines, " or ") + ")")
+	}
+
+	logging, _ := cmd.Flags().GetBool("enable-logging")
+	if !logging && (cmd.Flags().Changed("logging-retention") || cmd.Flags().Changed("logging-storage-size")) {
+		return errors.New("--logging-retention and --logging-storage-size need --enable-logging")
+	}
+	if logging {
+		err = loggingConfig(cmd).Validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	autoscaler, _ := cmd.Flags().GetBool("enable-autoscaler")
+	if !autoscaler && (cmd.Flags().Changed("workers-min") || cmd.Flags().Changed("workers-max")) {
+		return errors.New("--workers-min and --workers-max need --enable-autoscaler")
+	}
+	if autoscaler && !cmd.Flags().Changed("workers-max") {
+		return errors.New("--enable-autoscaler needs the --workers-max it can scale up to")
+	}
+	if autoscaler {
+		err = autoscalerConfig(cmd).Validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	// If we're here, we should be okay
+	return nil
+}
+
+// autoscalerConfig returns the sizes the flags have the autoscaler keep the workers between
+func autoscalerConfig(cmd *cobra.Command) addons.Autoscaler {
+	a := addons.Autoscaler{}
+	a.Min, _ = cmd.Flags().GetInt64("workers-min")
+	a.Max, _ = cmd.Flags().GetInt64("workers-max")
+	return a
+}
+
+// loggingConfig returns the logging stack the flags ask for
+func loggingConfig(cmd *cobra.Command) addons.Logging {
+	l := addons.Logging{}
+	l.Retention, _ = cmd.Flags().GetString("logging-retention")
+	l.StorageSize, _ = cmd.Flags().GetString("logging-storage-size")
+	return l
+}
+
+// isPolicyEngine returns if the add-on is one of the policy engines
+func isPolicyEngine(name string) bool {
+	for _, engine := range addons.PolicyEngines {
+		if engine == name {
+			return true
+		}
+	}
+	return false
+}
+
+// enableCreateAddOns adds the add-ons asked for by the flags to the add-on catalog of the repo in baseDir
+func enableCreateAddOns(cmd *cobra.Command, baseDir string) error {
+	versions := map[string]string{}
+	for flag, name := range createAddOnFlags {
+		if enabled, _ := cmd.Flags().GetBool(flag); enabled {
+			versions[name] = ""
+		}
+	}
+	for flag, name := range createAddOnVersionFlags {
+		if version, _ := cmd.Flags().GetString(flag); version != "" {
+			versions[name] = version
+		}
+	}
+	engine, _ := cmd.Flags().GetString("policy-engine")
+	if engine != "" {
+		versions[engine] = ""
+	}
+
+	// The logging stack is kept in the repo as it is, it's not in the catalog
+	if logging, _ := cmd.Flags().GetBool("enable-logging"); logging {
+		err := addons.WriteLogging(baseDir, loggingConfig(cmd))
+		if err != nil {
+			return err
+		}
+	}
+
+	// So is cluster-autoscaler, which also takes the replicas of the exported MachineDeployments over
+	if autoscaler, _ := cmd.Flags().GetBool("enable-autoscaler"); autoscaler {
+		clusterName, _ := cmd.Flags().GetString("cluster-name")
+		err := addons.WriteAutoscaler(baseDir, clusterName, autoscalerConfig(cmd))
+		if err != nil {
+			return err
+		}
+	}
+	if len(versions) == 0 {
+		return nil
+	}
+
+	// The create-cluster subcommands are named after the provider the cluster runs on
+	err := addons.EnableVersions(baseDir, cmd.Name(), versions)
+	if err != nil {
+		return err
+	}
+
+	// The ClusterSecretStore goes with the External Secrets Operator, so apps can have their secrets right away
+	if store := externalSecretsStore(cmd); store != nil {
+		err = externalsecrets.WriteStore(baseDir, *store)
+		if err != nil {
+			return err
+		}
+	}
+
+	// The baseline policies go with the policy engine, so what's deployed is checked from the start
+	if engine != "" {
+		policies := addons.BaselinePolicies{Engine: engine, ExemptNamespaces: addons.PolicyExemptNamespaces}
+		policies.Enforce, _ = cmd.Flags().GetBool("policy-enforce")
+		exempt, _ := cmd.Flags().GetStringSlice("policy-exempt-namespaces")
+		policies.ExemptNamespaces = append(append([]string{}, policies.ExemptNamespaces...), exempt...)
+		err = addons.WriteBaselinePolicies(baseDir, policies)
+		if err != nil {
+			return err
+		}
+	}
+
+	// The ClusterIssuer goes with cert-manager, so TLS certificates can be had as soon as the cluster is up
+	email, _ := cmd.Flags().GetString("acme-email")
+	if email == "" {
+		return nil
+	}
+	issuer := addons.ACMEIssuer{Email: email}
+	issuer.Name, _ = cmd.Flags().GetString("acme-issuer-name")
+	issuer.Server, _ = cmd.Flags().GetString("acme-server")
+	issuer.IngressClass, _ = cmd.Flags().GetString("acme-ingress-class")
+	if _, ok := versions["ingress-nginx"]; ok && issuer.IngressClass == "" {
+		issuer.IngressClass = "nginx"
+	}
+	if issuer.Server == "staging" {
+		issuer.Server = addons.LetsEncryptStagingServer
+	}
+	return addons.WriteACMEIssuer(baseDir, issuer)
+}
@@ -3,6 +3,7 @@ package cmd
 import (
 	"os"
 
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
@@ -15,8 +16,311 @@ var createClusterCmd = &cobra.Command{
 
 This is a PoC stage (proof of concept) and should NOT
 be used for production. There will be lots of breaking changes
-so beware. There be dragons here. PRE-PRE-ALPHA`,
+so beware. There be dragons here. PRE-PRE-ALPHA
+
+Cluster template variables can be set under "templateVariables" in the
+config file. Values can be read from AWS at render time:
+
+templateVariables:
+  POD_CIDR: ssm:/gokp/prod/pod-cidr
+  MY_DOMAIN: secretsmanager:gokp/prod#domain
+
+Functions for the naming conventions of an organization, like a prefix or
+a cost-center code, can be added under "templateFunctions" in the config
+file. They can be called from templateVariables (so the cluster template
+gets what they return), the URLs of add-ons, and every template GOKP writes
+the GitOps repo from.
+A function is a template itself, which can call the others, with the
+arguments it's called with as {{ .Arg }} (the first) and {{ .Args }}. Their
+names are lowercase:
+
+templateFunctions:
+  prefix: acme
+  costcenter: cc-1234
+  name: "{{ prefix }}-{{ .Arg }}"
+
+templateVariables:
+  AWS_SSH_KEY_NAME: '{{ name "ssh" }}'
+
+Credentials that aren't given as flags (--github-token, --aws-access-key,
+--aws-secret-key, ...) are read from the secret store under the name of the
+flag. The deploy key and kubeconfig of the cluster are also written to it.
+The secret store is set under "secretStore" in the config file (file, env,
+vault, aws-secrets-manager, or keychain) and defaults to files under ~/.gokp:
+
+secretStore:
+  type: vault
+  vaultAddress: https://vault.example.com
+  vaultMount: secret
+  vaultPath: gokp
+
+The state of the cluster, which commands like status, scale, and
+upgrade-cluster use, can be shared with a team by keeping it in S3 or Google
+Cloud Storage under "stateBackend" in the config file. Its kubeconfig and
+deploy key are kept there too, and its GitOps repo is cloned on any machine
+that needs it. Commands that change a cluster (like scale, upgrade-cluster, or
+delete-cluster) lock its state until they're done, with a DynamoDB table (with
+a LockID partition key) on S3 or a lock object on GCS, so nobody else changes
+it at the same time. A lock left behind by a gokp that was killed is released
+with "gokp state force-unlock". readOnly keeps the shared state from being
+changed, changes are then only saved under ~/.gokp. Clusters created before
+are copied over with "gokp state push":
+
+stateBackend:
+  type: s3
+  bucket: my-gokp-state
+  region: us-east-1
+  dynamoDBTable: gokp-locks
+
+stateBackend:
+  type: gcs
+  bucket: my-gokp-state
+  readOnly: true
+
+Every wait gives up after a while, so an install never hangs. The timeouts
+can be raised for slow infrastructure under "timeouts" in the config file,
+by the name of the wait (clusterReady, controllerRollout, infrastructure,
+controlPlane, nodes, crdEstablished, hostRegistration, cloudFormation,
+cniRollout, argoCDApply, argoCDPassword, fluxApply, upgradeRollout,
+certRotation, machineReplace, hibernate, and acceptanceTests):
+
+timeouts:
+  clusterReady: 40m
+  cloudFormation: 1h
+
+GOKP asks before it initializes CAPI on, adopts, or deletes from a cluster
+of a kubeconfig it's given (like the --management-kubeconfig of kubevirt)
+whose context, or the cluster the context points at, looks like production.
+Anything with prod in its name is protected, unless the patterns under
+"guardrails" in the config file say otherwise (* matches anything, and
+allowed patterns win). Without a terminal to ask on, --yes has to be given:
+
+guardrails:
+  protectedContexts:
+  - "*prod*"
+  - "arn:aws:eks:*:123456789012:cluster/*"
+  allowedContexts:
+  - prod-sandbox
+
+Calico is installed as the CNI of the cluster, --cni picks Cilium or Flannel
+instead, or none to leave it to the cluster template. The version GOKP was
+tested with is installed, --cni-version pins another one (on Azure, Calico
+comes from the Cluster API Provider Azure release of that version). The exact
+manifest is kept in the GitOps repo under cluster/core/cni, with the rest of
+the core components, so the CNI is upgraded by changing it there:
+
+gokp create-cluster aws --cluster-name=mycluster ... --cni=cilium --cni-version=v1.11.20
+
+Kubernetes feature gates, like alpha and beta features for a test cluster,
+are set on the API server, controller manager, scheduler, and kubelets with
+--feature-gates, or as a list under "createCluster" in the config file:
+
+createCluster:
+  feature-gates:
+  - EphemeralContainers=true
+  - CSIMigration=false
+
+When the control plane can't reach the nodes directly, like a private cluster
+or nodes in another network, --konnectivity has the API server reach them
+(for logs, exec, port-forward, and webhooks) through konnectivity agents on
+the nodes. The agents connect out to the control plane endpoint on port 8132,
+or to --konnectivity-server-host, and are kept in the GitOps repo under
+cluster/core/konnectivity:
+
+gokp create-cluster aws --cluster-name=mycluster ... --konnectivity
+
+--encrypt-secrets has the API server encrypt secrets at rest in etcd. The key
+is kept in a Secret next to the cluster, never in the GitOps repo, and is
+replaced with rotate-encryption-key:
+
+gokp create-cluster aws --cluster-name=mycluster ... --encrypt-secrets
+
+Add-ons are deployed from the GitOps repo with the rest of the cluster.
+--enable-cert-manager installs cert-manager (at the version given, if one
+is), and --acme-email adds a ClusterIssuer for Let's Encrypt (or the ACME
+server of --acme-server), so TLS certificates can be had right away.
+--enable-ingress-nginx installs ingress-nginx with its Service set up for
+the provider (a Network Load Balancer on AWS, a NodePort where there are no
+load balancers). --enable-monitoring installs Prometheus, Alertmanager, and
+Grafana (from kube-prometheus, in the monitoring namespace) with requests
+and limits that fit a small cluster. --enable-logging adds Loki, with
+Promtail sending it the logs of every pod, keeping them for
+--logging-retention on a volume of --logging-storage-size (the cluster
+needs a default StorageClass):
+
+gokp create-cluster aws --cluster-name=mycluster ... --enable-ingress-nginx \
+	--enable-cert-manager --acme-email=admin@example.com --enable-monitoring \
+	--enable-logging --logging-retention=720h --logging-storage-size=50Gi
+
+--enable-sealed-secrets installs the Sealed Secrets controller, with a
+sealing key GOKP creates on the cluster before it's deployed. Its
+certificate is kept as ~/.gokp/<clustername>/sealed-secrets.pem, so secrets
+can be sealed for the GitOps repo right away, and the key itself as
+sealed-secrets-key.yaml (along with the kubeconfig in the secret store and
+the shared state), to restore it with kubectl apply if the cluster is lost:
+
+kubeseal --cert ~/.gokp/mycluster/sealed-secrets.pem < secret.yaml > sealed.yaml
+
+--enable-external-secrets installs the External Secrets Operator, so the
+secrets of apps can be kept in AWS Secrets Manager or Vault instead of git.
+With --external-secrets-provider, a ClusterSecretStore named
+cluster-secret-store is created along with it. Only where the secrets are is
+in the GitOps repo, the credentials the operator reads them with are put in
+a Secret on the cluster (without AWS keys, it uses the IAM role of the
+nodes, and Vault can be logged in to with its Kubernetes auth method):
+
+gokp create-cluster aws --cluster-name=mycluster ... --enable-external-secrets \
+	--external-secrets-provider=vault --external-secrets-vault-server=https://vault.example.com:8200 \
+	--external-secrets-vault-role=mycluster
+
+--policy-engine installs Kyverno (kyverno) or Gatekeeper (gatekeeper) with a
+baseline set of policies under cluster/core/baseline-policies: no
+privileged containers, and CPU and memory requests and a memory limit on
+every container. They're only reported unless --policy-enforce is given,
+and leave the namespaces of Kubernetes, the CNI, the GitOps controller, and
+the add-ons alone, along with any in --policy-exempt-namespaces:
+
+gokp create-cluster aws --cluster-name=mycluster ... --policy-engine=kyverno \
+	--policy-enforce --policy-exempt-namespaces=legacy-apps
+
+--enable-autoscaler installs cluster-autoscaler, which runs on the cluster
+with its Cluster API objects and adds or removes workers as pods need them,
+keeping each MachineDeployment between --workers-min and --workers-max.
+The sizes are set as annotations on the MachineDeployments in the GitOps
+repo, and their replicas are left out of it so the autoscaler isn't undone:
+
+gokp create-cluster aws --cluster-name=mycluster ... --enable-autoscaler \
+	--workers-min=2 --workers-max=10
+
+--sops encrypts the secrets GOKP writes into the GitOps repo (the ssh key
+of the repo, and the SSO and notifications secrets of Argo CD) with SOPS
+instead of leaving them base64 encoded. The username and token of a repo
+that's talked to over HTTPS never go into it, they're put on the cluster
+before the GitOps controller is deployed. The age key they're
+encrypted for is generated as ~/.gokp/<clustername>/age.agekey (and kept in
+the secret store and the shared state), and a .sops.yaml is put at the root
+of the repo so more secrets can be encrypted the same way. Flux decrypts
+them itself with the key, which is given to it as the sops-age Secret. Argo
+CD can't decrypt them without a plugin, so they're left out of its
+kustomization and GOKP applies them decrypted when Argo CD is installed:
+
+sops --encrypt --in-place cluster/core/my-secret.yaml
+
+Every time GOKP pushes to the GitOps repo (installs, upgrades, node pools,
+add-ons, repo sync, and so on), it writes cluster-info.yaml at the root of
+the repo: the provider, region, and Kubernetes version of the cluster, its
+API server endpoint, its control plane and node pools, its GitOps
+controller, and its add-ons. It's read from the rest of the repo, so fleet
+dashboards can be built by indexing the GitOps repos of the clusters:
+
+name: mycluster
+provider: aws
+region: us-east-2
+kubernetesVersion: v1.24.3
+endpoints:
+  apiServer: https://mycluster-apiserver-123.us-east-2.elb.amazonaws.com:6443
+nodePools:
+- name: mycluster-md-0
+  replicas: 3
+  instanceType: m5.large
+
+If an install fails once the cluster is being created, the cluster and the
+temporary control plane are deleted so nothing is left running. To keep them
+instead, use --keep-on-failure. The progress of the install is then kept
+under ~/.gokp/.gokpinstall-<clustername>, so the same command can be run
+again with --resume to pick up where it stopped instead of starting over:
+
+gokp create-cluster aws --cluster-name=mycluster ... --keep-on-failure
+gokp create-cluster aws --cluster-name=mycluster ... --resume
+
+The flags can also be set under "createCluster" in the config file, so a
+cluster can be created from a file that's kept in version control. Flags
+given on the command line win, and ${VAR} is replaced by the environment
+variable (use $$ for a $):
+
+gokp create-cluster aws --config=mycluster.yaml
+
+createCluster:
+  cluster-name: mycluster
+  github-token: ${GITHUB_TOKEN}
+  aws-region: us-east-2
+  aws-ssh-key: default
+  private-repo: true
+
+Credentials and defaults can be kept under named profiles in ~/.gokp/config
+(which should only be readable by you), and picked with --config-profile or
+the GOKP_PROFILE environment variable. The default profile is used if there's
+one and none is picked. A profile sets flags like the createCluster section,
+and wins over it. It can hold the flags of more than one provider, and pick
+a sizing profile with its own profile setting:
+
+gokp create-cluster aws --cluster-name=mycluster --config-profile=prod
+
+prod:
+  github-token: ${GITHUB_TOKEN}
+  aws-access-key: AKIA...
+  aws-secret-key: ...
+  aws-region: us-east-1
+  azure-region: eastus
+  profile: production
+
+Platform teams can have clusters checked against their own acceptance
+criteria before they're handed over. --acceptance-tests runs the Jobs in the
+YAML files of a dir on the cluster once it's up (along with anything else in
+the files, like the RBAC they need, which is applied first), and the install
+only succeeds once every Job completes. The tests run after the GitOps
+controller was bootstrapped, so ones that need what it deploys should retry
+(with the backoffLimit of the Job, for example). The results, with the logs
+of the Jobs that failed, are kept as
+~/.gokp/<clustername>/acceptance-results.yaml. A failed test leaves the
+cluster up, and the tests can be run again with test-cluster:
+
+gokp create-cluster aws --cluster-name=mycluster ... --acceptance-tests=./acceptance
+
+With --output=json, what was created (the GitOps repo, the kubeconfig, the
+Argo CD URL and password, the artifact dir, and how long each phase took) is
+printed as JSON on stdout once the cluster is up, for CI pipelines. The logs
+still go to stderr:
+
+gokp create-cluster aws --cluster-name=mycluster ... -o json > mycluster.json
+
+To be asked for everything instead, with a summary to confirm at the end:
+
+gokp create-cluster --interactive`,
+	Annotations: map[string]string{clusterNameAnnotation: "new"},
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		// Only the providers have the flags the config file sets
+		if cmd.HasSubCommands() {
+			return
+		}
+		err := applyClusterConfig(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = checkResultOutputFlag(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = checkCreateAddOnFlags(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = checkAcceptanceTestsFlag(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
 	Run: func(cmd *cobra.Command, args []string) {
+		// Ask for everything instead
+		interactive, _ := cmd.Flags().GetBool("interactive")
+		if interactive {
+			err := runClusterWizard(cmd)
+			if err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+
 		// Show help if a subcommand isn't supplied
 		if len(args) == 0 {
 			cmd.Help()
@@ -38,4 +342,10 @@ so beware. There be dragons here. PRE-PRE-ALPHA`,
 
 func init() {
 	rootCmd.AddCommand(createClusterCmd)
+
+	createClusterCmd.Flags().Bool("interactive", false, "Ask for the provider, credentials, machine sizes, and repo options instead of taking flags.")
+	createClusterCmd.PersistentFlags().Bool("resume", false, "Pick up a failed install of the cluster where it stopped.")
+	createClusterCmd.PersistentFlags().Bool("keep-on-failure", false, "Don't delete the cluster and the temporary control plane if the install fails.")
+	createClusterCmd.PersistentFlags().String("acceptance-tests", "", "Dir of the YAML files of Jobs to run as acceptance tests once the cluster is up. The install fails if any of them do.")
+	addResultOutputFlag(createClusterCmd)
 }
@@ -0,0 +1,308 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/christianh814/gokp/cmd/addons"
+	"github.com/christianh814/gokp/cmd/capi"
+	"github.com/christianh814/gokp/cmd/ebscsi"
+	"github.com/christianh814/gokp/cmd/externaldns"
+	"github.com/christianh814/gokp/cmd/externalsecrets"
+	"github.com/christianh814/gokp/cmd/gitutils"
+	"github.com/christianh814/gokp/cmd/templates"
+	"github.com/christianh814/gokp/cmd/utils"
+	"github.com/christianh814/gokp/cmd/velero"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// dryRunWorkDir returns where a dry run of the install of the cluster renders everything
+func dryRunWorkDir(clusterName string) string {
+	return os.Getenv("HOME") + "/.gokp/.gokpdryrun-" + clusterName
+}
+
+// dryRunAwsCluster renders what create-cluster aws would create into a workdir that's kept, and prints a summary of
+// what would be created on AWS and GitHub. Nothing is created, and no credentials are needed
+func dryRunAwsCluster(cmd *cobra.Command, clusterName string) error {
+	workdir := dryRunWorkDir(clusterName)
+	err := os.RemoveAll(workdir)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(workdir, 0700)
+	if err != nil {
+		return err
+	}
+
+	// The settings are checked just like they are for a real install
+	haCluster, err := applySizingProfile(cmd, "aws")
+	if err != nil {
+		return err
+	}
+	privateRepo, _ := cmd.Flags().GetBool("private-repo")
+	gitOpsController, err := gitOpsEngine(cmd)
+	if err != nil {
+		return err
+	}
+	err = setBootstrapResources(cmd)
+	if err != nil {
+		return err
+	}
+	capi.RolloutStrategy, err = rolloutStrategyConfig(cmd)
+	if err != nil {
+		return err
+	}
+	capi.HelmAddons, _ = cmd.Flags().GetBool("helm-addons")
+	err = setCNI(cmd)
+	if err != nil {
+		return err
+	}
+	err = setFeatureGates(cmd)
+	if err != nil {
+		return err
+	}
+	err = setKonnectivity(cmd)
+	if err != nil {
+		return err
+	}
+	capi.EncryptSecrets, _ = cmd.Flags().GetBool("encrypt-secrets")
+	dnsZone, err := externalDNSZone(cmd)
+	if err != nil {
+		return err
+	}
+
+	awsRegion, _ := cmd.Flags().GetString("aws-region")
+	backups, err := clusterBackups(cmd, awsRegion)
+	if err != nil {
+		return err
+	}
+
+	awsSSHKey, _ := cmd.Flags().GetString("aws-ssh-key")
+	awsCPMachine, _ := cmd.Flags().GetString("aws-control-plane-machine")
+	awsWMachine, _ := cmd.Flags().GetString("aws-node-machine")
+	skipCloudFormation, _ := cmd.Flags().GetBool("skip-cloud-formation")
+	capi.RootVolumeSize, _ = cmd.Flags().GetInt64("aws-root-volume-size")
+	capi.RootVolumeType, _ = cmd.Flags().GetString("aws-root-volume-type")
+
+	_, err = utils.CheckPreReqs(os.Getenv("HOME")+"/.gokp/"+clusterName, gitOpsController)
+	if err != nil {
+		return err
+	}
+
+	// Looking up SSM and Secrets Manager references needs AWS, so they're left as they are
+	for k, v := range viper.GetStringMapString("templateVariables") {
+		os.Setenv(strings.ToUpper(k), v)
+	}
+
+	// The subnets aren't checked, that needs AWS too
+	capi.AWSPlacement, err = awsPlacementConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	// The security groups aren't checked either, and the one of the API server isn't created
+	capi.AWSSecurity, err = awsSecurityConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	// Render the cluster YAML
+	capaVersion, err := capi.RenderAwsK8sInstance(&clusterName, workdir, map[string]string{
+		"AWS_REGION":                     awsRegion,
+		"AWS_SSH_KEY_NAME":               awsSSHKey,
+		"AWS_CONTROL_PLANE_MACHINE_TYPE": awsCPMachine,
+		"AWS_NODE_MACHINE_TYPE":          awsWMachine,
+	}, haCluster)
+	if err != nil {
+		return err
+	}
+
+	// Render the GitOps repo, without creating or pushing it
+	gitopsrepo, repoName, err := dryRunGitOpsRepo(cmd, clusterName, workdir)
+	if err != nil {
+		return err
+	}
+	templates.SkipPush = true
+	ghToken, _ := cmd.Flags().GetString("github-token")
+	if gitOpsController == "argocd" {
+		_, err = templates.CreateArgoRepoSkel(&clusterName, workdir, ghToken, gitopsrepo, &privateRepo)
+	} else {
+		_, err = templates.CreateFluxRepoSkel(&clusterName, workdir, ghToken, gitopsrepo, &privateRepo)
+	}
+	if err != nil {
+		return err
+	}
+	err = ebscsi.WriteManifests(gitutils.BaseDir(workdir+"/"+clusterName), awsRegion)
+	if err != nil {
+		return err
+	}
+	err = enableCreateAddOns(cmd, gitutils.BaseDir(workdir+"/"+clusterName))
+	if err != nil {
+		return err
+	}
+	if dnsZone != "" {
+		err = externaldns.WriteManifests(gitutils.BaseDir(workdir+"/"+clusterName), clusterName, dnsZone)
+		if err != nil {
+			return err
+		}
+	}
+	if backups != nil {
+		err = velero.WriteManifests(gitutils.BaseDir(workdir+"/"+clusterName), clusterName, *backups)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Say what would be created
+	cpMachineCount, workerMachineCount := capi.AWSMachineCounts(haCluster)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintf(w, "Cluster:\t%s (Kubernetes %s, CAPA %s)\n", clusterName, capi.KubernetesVersion, capaVersion)
+	fmt.Fprintf(w, "AWS Region:\t%s\n", awsRegion)
+	if skipCloudFormation {
+		fmt.Fprintf(w, "CloudFormation Stack:\tnone (skipped)\n")
+	} else {
+		fmt.Fprintf(w, "CloudFormation Stack:\t%s (created or updated)\n", capi.AWSBootstrapStackName())
+	}
+	if capi.AWSPlacement != nil {
+		fmt.Fprintf(w, "VPC:\t%s (existing, subnets %s)\n", capi.AWSPlacement.VPCID, strings.Join(capi.AWSPlacement.Subnets, ", "))
+		fmt.Fprintf(w, "Worker Subnet:\t%s\n", capi.AWSPlacement.NodeSubnet)
+	} else {
+		fmt.Fprintf(w, "VPC:\tcreated by CAPA, with its subnets, gateways and load balancer\n")
+	}
+	if capi.AWSSecurity != nil && len(capi.AWSSecurity.APIServerCIDRs) > 0 {
+		fmt.Fprintf(w, "API Server:\tallowed from %s (security group %s created)\n", strings.Join(capi.AWSSecurity.APIServerCIDRs, ", "), capi.AWSAPIServerSecurityGroupName(clusterName))
+	} else {
+		fmt.Fprintf(w, "API Server:\tallowed from anywhere\n")
+	}
+	if capi.AWSSecurity != nil && len(capi.AWSSecurity.SSHCIDRs) > 0 {
+		fmt.Fprintf(w, "Bastion:\tSSH allowed from %s\n", strings.Join(capi.AWSSecurity.SSHCIDRs, ", "))
+	}
+	if capi.AWSSecurity != nil && len(capi.AWSSecurity.SecurityGroups)+len(capi.AWSSecurity.LoadBalancerSecurityGroups) > 0 {
+		fmt.Fprintf(w, "Security Groups:\t%s (machines), %s (load balancer)\n", strings.Join(capi.AWSSecurity.SecurityGroups, ", "), strings.Join(capi.AWSSecurity.LoadBalancerSecurityGroups, ", "))
+	}
+	fmt.Fprintf(w, "Control Plane:\t%d x %s\n", cpMachineCount, awsCPMachine)
+	fmt.Fprintf(w, "Workers:\t%d x %s\n", workerMachineCount, awsWMachine)
+	if capi.RootVolumeSize > 0 {
+		fmt.Fprintf(w, "Root Volumes:\t%dGB %s\n", capi.RootVolumeSize, capi.RootVolumeType)
+	}
+	if createSSHKey, _ := cmd.Flags().GetBool("aws-create-ssh-key"); createSSHKey {
+		fmt.Fprintf(w, "SSH Key:\t%s (created if it doesn't exist)\n", awsSSHKey)
+	} else {
+		fmt.Fprintf(w, "SSH Key:\t%s (must already exist)\n", awsSSHKey)
+	}
+	fmt.Fprintf(w, "Storage:\tEBS CSI driver %s, default StorageClass %s (encrypted gp3)\n", ebscsi.Version, ebscsi.StorageClassName)
+	if dnsZone != "" {
+		fmt.Fprintf(w, "External DNS:\t%s (IAM user %s)\n", dnsZone, externaldns.UserName(clusterName))
+	}
+	if backups != nil {
+		fmt.Fprintf(w, "Backups:\ts3://%s/%s at %q, kept %s (IAM user %s, bucket created if it doesn't exist)\n", backups.Bucket, clusterName, backups.Schedule, backups.TTL, velero.UserName(clusterName))
+	}
+	if store := externalSecretsStore(cmd); store != nil {
+		fmt.Fprintf(w, "Secret Store:\t%s (%s)\n", externalsecrets.StoreName, store.Provider)
+	}
+	if autoscaler, _ := cmd.Flags().GetBool("enable-autoscaler"); autoscaler {
+		a := autoscalerConfig(cmd)
+		fmt.Fprintf(w, "Autoscaler:\tcluster-autoscaler %s, %d to %d workers per MachineDeployment\n", addons.AutoscalerVersion, a.Min, a.Max)
+	}
+	if engine, _ := cmd.Flags().GetString("policy-engine"); engine != "" {
+		if enforce, _ := cmd.Flags().GetBool("policy-enforce"); enforce {
+			fmt.Fprintf(w, "Policy Engine:\t%s (baseline policies enforced)\n", engine)
+		} else {
+			fmt.Fprintf(w, "Policy Engine:\t%s (baseline policies audited)\n", engine)
+		}
+	}
+	fmt.Fprintf(w, "GitOps Repo:\t%s\n", repoName)
+	fmt.Fprintf(w, "Repo Remote:\t%s (branch %s, path /%s)\n", gitopsrepo, gitutils.Branch, gitutils.ClusterPath())
+	if gitOpsController == "argocd" {
+		fmt.Fprintf(w, "GitOps Controller:\tArgo CD %s in %s\n", templates.ArgoCDVersion, templates.ArgoCDNamespace)
+	} else {
+		fmt.Fprintf(w, "GitOps Controller:\tFlux CD\n")
+	}
+	fmt.Fprintf(w, "Rendered:\t%s\n", workdir)
+	err = w.Flush()
+	if err != nil {
+		return err
+	}
+
+	log.Info("Dry run complete, nothing was created. The cluster YAML is ", workdir, "/install-cluster.yaml and the GitOps repo is ", workdir, "/", clusterName)
+	return nil
+}
+
+// dryRunGitOpsRepo sets up the local dir of the GitOps repo the way createGitOpsRepo would, without creating
+// anything on the git provider. It returns the remote the repo would have, and what would be created for it
+func dryRunGitOpsRepo(cmd *cobra.Command, clusterName string, workdir string) (string, string, error) {
+	if repoPath, _ := cmd.Flags().GetString("repo-path"); repoPath != "" {
+		gitutils.RepoPath = path.Clean(repoPath)
+	}
+	if monorepo, _ := cmd.Flags().GetBool("monorepo"); monorepo {
+		gitutils.RepoPath = "clusters/" + clusterName
+	}
+	gitutils.RemoteName, _ = cmd.Flags().GetString("git-remote-name")
+	gitutils.Branch, _ = cmd.Flags().GetString("git-branch")
+	err := setKnownHosts(cmd)
+	if err != nil {
+		return "", "", err
+	}
+
+	gitProvider, _ := cmd.Flags().GetString("git-provider")
+	gitURL, _ := cmd.Flags().GetString("git-url")
+	existingRepo, _ := cmd.Flags().GetString("existing-repo")
+	privateRepo, _ := cmd.Flags().GetBool("private-repo")
+
+	var gitopsrepo, repoName string
+	switch {
+	case gitURL != "":
+		gitopsrepo = gitURL
+		repoName = gitURL + " (existing)"
+		if gitToken, _ := cmd.Flags().GetString("git-token"); gitToken != "" {
+			gitUsername, _ := cmd.Flags().GetString("git-username")
+			gitutils.SetHTTPCredentials(gitURL, gitUsername, gitToken)
+		}
+	case gitProvider == "github" && existingRepo != "":
+		gitopsrepo = "git@github.com:" + existingRepo + ".git"
+		repoName = "github.com/" + existingRepo + " (existing, gets a deploy key)"
+	case gitProvider == "github":
+		// Who the token belongs to can't be known without asking GitHub
+		owner, _ := cmd.Flags().GetString("github-org")
+		if owner == "" {
+			owner = "GITHUB_USER"
+		}
+		visibility := "public"
+		if privateRepo {
+			visibility = "private"
+		}
+		gitopsrepo = "git@github.com:" + owner + "/" + clusterName + ".git"
+		repoName = "github.com/" + owner + "/" + clusterName + " (new, " + visibility + ", with a deploy key)"
+	default:
+		return "", "", errors.New("--dry-run only knows what the github git provider or --git-url would use, not " + gitProvider)
+	}
+
+	// The deploy key is generated here, it's only uploaded by a real install
+	if _, _, isHttps := gitutils.GetHTTPCredentials(gitopsrepo); !isHttps {
+		gitSSHKey, _ := cmd.Flags().GetString("git-ssh-key")
+		if gitURL != "" && gitSSHKey != "" {
+			err := gitutils.ImportSSHKey(gitSSHKey, clusterName, workdir)
+			if err != nil {
+				return "", "", err
+			}
+		} else {
+			_, err := gitutils.GenerateSSHKeypair(clusterName, workdir)
+			if err != nil {
+				return "", "", err
+			}
+		}
+	}
+
+	err = os.MkdirAll(workdir+"/"+clusterName, 0755)
+	if err != nil {
+		return "", "", err
+	}
+
+	return gitopsrepo, repoName, nil
+}
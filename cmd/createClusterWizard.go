@@ -0,0 +1,315 @@
+package cmd
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/christianh814/gokp/cmd/wizard"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// wizardProviderFlags are the flags the wizard asks for on each provider, on top of the required ones
+var wizardProviderFlags = map[string][]string{
+	"aws":      {"aws-region", "aws-access-key", "aws-secret-key", "aws-ssh-key"},
+	"azure":    {"azure-region", "azure-app-id", "azure-app-secret", "azure-tenant-id", "azure-subscription-id", "azure-resource-group", "azure-ssh-key"},
+	"oci":      {"oci-region", "oci-tenancy-id", "oci-user-id", "oci-fingerprint", "oci-private-key", "oci-compartment-id", "oci-image-id", "oci-ssh-key"},
+	"ibmcloud": {"ibmcloud-api-key", "ibmcloud-region", "ibmcloud-zone", "ibmcloud-resource-group", "ibmcloud-image-id", "ibmcloud-ssh-key-id"},
+	"linode":   {"linode-token", "linode-region", "linode-ssh-key"},
+	"proxmox":  {"proxmox-url", "proxmox-token", "proxmox-secret", "proxmox-source-node", "proxmox-template-vmid"},
+}
+
+// wizardGitProviderFlags are the flags the wizard asks for on each git provider. none is an existing remote
+var wizardGitProviderFlags = map[string][]string{
+	"github":      {"github-token", "github-org"},
+	"gitea":       {"gitea-url", "gitea-token"},
+	"bitbucket":   {"bitbucket-username", "bitbucket-app-password", "bitbucket-workspace"},
+	"azuredevops": {"azuredevops-org", "azuredevops-project", "azuredevops-pat"},
+	"none":        {"git-url"},
+}
+
+// wizardOptional are flags the wizard asks for that can be left empty
+var wizardOptional = []string{"github-org", "bitbucket-workspace", "ibmcloud-zone", "oci-ssh-key", "linode-ssh-key"}
+
+// runClusterWizard asks for what's needed to create a cluster, shows what it's going to do, and creates it with the
+// create-cluster command of the provider that was picked
+func runClusterWizard(cmd *cobra.Command) error {
+	p := wizard.New()
+
+	providers := []string{}
+	for _, c := range cmd.Commands() {
+		if c.Runnable() && c.Name() != "help" {
+			providers = append(providers, c.Name())
+		}
+	}
+	sort.Strings(providers)
+	provider, err := p.Choose("Provider", providers, "aws")
+	if err != nil {
+		return err
+	}
+	var sub *cobra.Command
+	for _, c := range cmd.Commands() {
+		if c.Name() == provider {
+			sub = c
+		}
+	}
+
+	// The config file and the secret store fill in what they can, and that's what's offered as the defaults
+	err = sub.ParseFlags([]string{})
+	if err != nil {
+		return err
+	}
+	err = applyClusterConfig(sub)
+	if err != nil {
+		return err
+	}
+	err = checkResultOutputFlag(sub)
+	if err != nil {
+		return err
+	}
+	err = checkCreateAddOnFlags(sub)
+	if err != nil {
+		return err
+	}
+	err = loadSecretFlags(sub)
+	if err != nil {
+		return err
+	}
+
+	err = askFlag(p, sub, "cluster-name", func(v string) error {
+		if errs := validation.IsDNS1123Label(v); len(errs) > 0 {
+			return errors.New(strings.Join(errs, ", "))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// What the provider needs, including its credentials
+	names := append([]string{}, wizardProviderFlags[provider]...)
+	sub.Flags().VisitAll(func(f *pflag.Flag) {
+		if isRequiredFlag(f) && f.Name != "cluster-name" && !containsString(names, f.Name) {
+			names = append(names, f.Name)
+		}
+	})
+	for _, name := range names {
+		err = askFlag(p, sub, name, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Machine sizes, starting from a profile
+	if sub.Flags().Lookup("profile") != nil {
+		err = askSizing(p, sub, provider)
+	} else if sub.Flags().Lookup("ha") != nil {
+		err = askBool(p, sub, "ha", "HA control plane")
+	}
+	if err != nil {
+		return err
+	}
+
+	// Where the GitOps repo goes
+	err = askGitRepo(p, sub)
+	if err != nil {
+		return err
+	}
+
+	// Show what's going to happen before it does
+	p.Println()
+	p.Println("Creating the cluster on " + provider + " with:")
+	sub.Flags().Visit(func(f *pflag.Flag) {
+		value := flagValue(f)
+		if containsString(secretFlags, f.Name) {
+			value = "********"
+		}
+		p.Println("  --" + f.Name + "=" + value)
+	})
+	ok, err := p.Confirm("Create the cluster?", false)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		log.Info("Nothing was created")
+		return nil
+	}
+
+	sub.Run(sub, []string{})
+	return nil
+}
+
+// askSizing asks for a sizing profile, and then for the machine sizes it sets so they can be changed
+func askSizing(p *wizard.Prompter, c *cobra.Command, provider string) error {
+	name, err := p.Choose("Sizing profile", sizingProfileNames, "medium")
+	if err != nil {
+		return err
+	}
+	err = c.Flags().Set("profile", name)
+	if err != nil {
+		return err
+	}
+
+	// Only what's changed is set, the profile sets the rest
+	flags := []string{}
+	for flag := range sizingProfiles[name].Flags[provider] {
+		flags = append(flags, flag)
+	}
+	sort.Strings(flags)
+	for _, flag := range flags {
+		if c.Flags().Changed(flag) {
+			continue
+		}
+		def := sizingProfiles[name].Flags[provider][flag]
+		for {
+			answer, err := p.Ask(strings.TrimSuffix(c.Flags().Lookup(flag).Usage, ".")+" (--"+flag+")", def, nil)
+			if err != nil {
+				return err
+			}
+			if answer == def {
+				break
+			}
+			// Typed flags validate what they're set to
+			err = c.Flags().Set(flag, answer)
+			if err == nil {
+				break
+			}
+			p.Println("  " + err.Error())
+		}
+	}
+
+	return nil
+}
+
+// askGitRepo asks where the GitOps repo goes and which GitOps controller to use
+func askGitRepo(p *wizard.Prompter, c *cobra.Command) error {
+	gitProviders := []string{"github", "gitea", "bitbucket", "azuredevops", "none"}
+	current, _ := c.Flags().GetString("git-provider")
+	gitProvider, err := p.Choose("Git provider (none for an existing remote)", gitProviders, current)
+	if err != nil {
+		return err
+	}
+	if gitProvider != "none" {
+		err = c.Flags().Set("git-provider", gitProvider)
+		if err != nil {
+			return err
+		}
+	}
+	for _, name := range wizardGitProviderFlags[gitProvider] {
+		err = askFlag(p, c, name, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	if gitProvider == "none" {
+		gitURL, _ := c.Flags().GetString("git-url")
+		if strings.HasPrefix(gitURL, "https://") || strings.HasPrefix(gitURL, "http://") {
+			return askFlag(p, c, "git-token", nil)
+		}
+		return askFlag(p, c, "git-ssh-key", nil)
+	}
+
+	err = askBool(p, c, "private-repo", "Private repo")
+	if err != nil {
+		return err
+	}
+	current, _ = c.Flags().GetString("gitops-controller")
+	controller, err := p.Choose("GitOps controller", []string{"argocd", "fluxcd"}, current)
+	if err != nil {
+		return err
+	}
+	return c.Flags().Set("gitops-controller", controller)
+}
+
+// askFlag asks for the value of a flag, offering the one it has. Secrets that are set already aren't asked for
+// again, and only the flags in wizardOptional can be left empty
+func askFlag(p *wizard.Prompter, c *cobra.Command, name string, validate func(string) error) error {
+	flag := c.Flags().Lookup(name)
+	if flag == nil {
+		return nil
+	}
+	check := func(v string) error {
+		if v == "" && !containsString(wizardOptional, name) {
+			return errors.New("a value is needed")
+		}
+		if v != "" && validate != nil {
+			if err := validate(v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	question := strings.TrimSuffix(flag.Usage, ".") + " (--" + name + ")"
+	if containsString(secretFlags, name) {
+		if flag.Value.String() != "" {
+			p.Println(question + ": using the one that was found")
+			return nil
+		}
+		answer, err := p.AskSecret(question, check)
+		if err != nil {
+			return err
+		}
+		return c.Flags().Set(name, answer)
+	}
+
+	for {
+		answer, err := p.Ask(question, flagValue(flag), check)
+		if err != nil {
+			return err
+		}
+		if answer == "" {
+			return nil
+		}
+		// Typed flags validate what they're set to
+		err = c.Flags().Set(name, answer)
+		if err == nil {
+			return nil
+		}
+		p.Println("  " + err.Error())
+	}
+}
+
+// askBool asks a yes or no question for a bool flag, offering the value it has
+func askBool(p *wizard.Prompter, c *cobra.Command, name string, question string) error {
+	current, _ := c.Flags().GetBool(name)
+	answer, err := p.Confirm(question, current)
+	if err != nil {
+		return err
+	}
+	if answer == current && !c.Flags().Changed(name) {
+		return nil
+	}
+	if answer {
+		return c.Flags().Set(name, "true")
+	}
+	return c.Flags().Set(name, "false")
+}
+
+// flagValue returns the value of the flag the way it's given on the command line
+func flagValue(f *pflag.Flag) string {
+	if s, ok := f.Value.(pflag.SliceValue); ok {
+		return strings.Join(s.GetSlice(), ",")
+	}
+	return f.Value.String()
+}
+
+// isRequiredFlag returns if the flag was marked as required
+func isRequiredFlag(f *pflag.Flag) bool {
+	v, ok := f.Annotations[cobra.BashCompOneRequiredFlag]
+	return ok && len(v) > 0 && v[0] == "true"
+}
+
+// containsString returns if s is in list
+func containsString(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
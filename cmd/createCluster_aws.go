@@ -1,17 +1,13 @@
 package cmd
 
 import (
-	"os"
+	"errors"
 
-	"github.com/christianh814/gokp/cmd/argo"
 	"github.com/christianh814/gokp/cmd/capi"
-	"github.com/christianh814/gokp/cmd/export"
-	"github.com/christianh814/gokp/cmd/flux"
-
-	"github.com/christianh814/gokp/cmd/github"
-	"github.com/christianh814/gokp/cmd/kind"
-	"github.com/christianh814/gokp/cmd/templates"
-	"github.com/christianh814/gokp/cmd/utils"
+	"github.com/christianh814/gokp/cmd/ebscsi"
+	"github.com/christianh814/gokp/cmd/externaldns"
+	"github.com/christianh814/gokp/cmd/state"
+	"github.com/christianh814/gokp/cmd/velero"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
@@ -30,172 +26,266 @@ gokp create-cluster --cluster-name=mycluster \
 --aws-secret-key=awssecretaccesskey \
 --private-repo=true
 
-The aws ssh key must already exist on your account (the installer
-doesn't create one for you).`,
+The aws ssh key must already exist on your account, unless
+--aws-create-ssh-key is given. It's created then, and its private key is
+kept in the secret store (as aws-ssh-key-<region>-<key>.pem). Key pairs are
+tagged with the clusters that use them, and one GOKP created is deleted
+along with the last of them.
+
+Volumes come from the EBS CSI driver, kept in the GitOps repo under
+cluster/core/ebs-csi with the rest of the core components, and the gp3
+StorageClass it comes with (encrypted, and the default). Its controller runs
+on the control plane, which the CloudFormation stack allows to manage EBS
+volumes. With --skip-cloud-formation, the stack that's there has to allow it
+too (enableCSIPolicy of clusterawsadm).
+
+With --enable-external-dns, external-dns is deployed from the GitOps repo
+to manage the records of the Route53 hosted zone of --dns-zone, for Services
+and Ingresses. It uses an IAM user of its own (gokp-<cluster-name>-external-dns)
+that can only change that zone. Its access key is put in a Secret on the
+cluster, not in the repo, and the user is deleted with the cluster:
+
+gokp create-cluster aws --cluster-name=mycluster ... \
+--enable-external-dns --dns-zone=example.com
+
+With --enable-backups, Velero is deployed from the GitOps repo to back the
+cluster (its resources and EBS volumes) up on --backup-schedule, keeping
+each backup for --backup-ttl. The backups go to the S3 bucket of
+--backup-bucket under the name of the cluster, so a bucket can be shared.
+It's created (private and encrypted) in the region of the cluster if it
+isn't there. Velero uses an IAM user of its own (gokp-<cluster-name>-velero)
+that can only use that bucket and take snapshots. Its access key is put in
+a Secret on the cluster. The user is deleted with the cluster, the backups
+are kept:
+
+gokp create-cluster aws --cluster-name=mycluster ... \
+--enable-backups --backup-bucket=mycompany-cluster-backups --backup-schedule="0 */6 * * *"
+
+CAPA opens the API server to anyone and doesn't let SSH in to the nodes.
+--aws-ssh-cidr turns on a bastion host that only the CIDRs given can SSH to,
+the nodes are reached from there. In an existing VPC (--aws-vpc-id),
+--aws-api-server-cidr has GOKP create the security group of the API server
+load balancer (gokp-<cluster-name>-apiserver-lb) letting in only the CIDRs
+given and the NAT gateways of the VPC. Include where gokp runs from, it
+talks to the API server while installing. --aws-security-group and
+--aws-lb-security-group attach existing security groups of the VPC to the
+machines and the load balancer. They can be kept as lists under
+"createCluster" in the config file:
+
+createCluster:
+  aws-vpc-id: vpc-0123456789abcdef0
+  aws-api-server-cidr:
+  - 203.0.113.0/24
+  aws-ssh-cidr:
+  - 203.0.113.10/32
+  aws-security-group:
+  - sg-0123456789abcdef0
+
+With --dry-run nothing is created. The cluster YAML and the GitOps repo
+(with its Argo CD or Flux CD overlay) are rendered under
+~/.gokp/.gokpdryrun-<cluster-name> instead, and what would be created on AWS
+and GitHub is printed. No credentials are needed, only the CAPA cluster
+template is downloaded. To check the credentials, the region, the machines,
+and the SSH key instead, run "gokp validate aws" with the same flags.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		// create home dir
-		err := os.MkdirAll(os.Getenv("HOME")+"/.gokp", 0775)
-		if err != nil {
-			log.Fatal(err)
-		}
-		// Create workdir and set variables based on that
-		WorkDir, _ = utils.CreateWorkDir()
-		KindCfg = WorkDir + "/" + "kind.kubeconfig"
-		// cleanup workdir at the end
-		defer os.RemoveAll(WorkDir)
-
-		// Grab repo related flags
-		ghToken, _ := cmd.Flags().GetString("github-token")
-		clusterName, _ := cmd.Flags().GetString("cluster-name")
-		privateRepo, _ := cmd.Flags().GetBool("private-repo")
-
-		// Set GitOps Controller
-		gitOpsController, _ := cmd.Flags().GetString("gitops-controller")
-
-		// Grab AWS related flags
-		awsRegion, _ := cmd.Flags().GetString("aws-region")
-		awsAccessKey, _ := cmd.Flags().GetString("aws-access-key")
-		awsSecretKey, _ := cmd.Flags().GetString("aws-secret-key")
-		awsSSHKey, _ := cmd.Flags().GetString("aws-ssh-key")
-		awsCPMachine, _ := cmd.Flags().GetString("aws-control-plane-machine")
-		awsWMachine, _ := cmd.Flags().GetString("aws-node-machine")
-		skipCloudFormation, _ := cmd.Flags().GetBool("skip-cloud-formation")
-
-		CapiCfg := WorkDir + "/" + clusterName + ".kubeconfig"
-		gokpartifacts := os.Getenv("HOME") + "/.gokp/" + clusterName
-
-		tcpName := "gokp-bootstrapper"
-
-		// Run PreReq Checks
-		_, err = utils.CheckPreReqs(gokpartifacts, gitOpsController)
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		// Create KIND instance
-		log.Info("Creating temporary control plane")
-		err = kind.CreateKindCluster(tcpName, KindCfg)
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		// Create CAPI instance on AWS
-		awsCredsMap := map[string]string{
-			"AWS_REGION":                     awsRegion,
-			"AWS_ACCESS_KEY_ID":              awsAccessKey,
-			"AWS_SECRET_ACCESS_KEY":          awsSecretKey,
-			"AWS_SSH_KEY_NAME":               awsSSHKey,
-			"AWS_CONTROL_PLANE_MACHINE_TYPE": awsCPMachine,
-			"AWS_NODE_MACHINE_TYPE":          awsWMachine,
-		}
-
-		// By default, create an HA Cluster
-		haCluster := true
-		_, err = capi.CreateAwsK8sInstance(KindCfg, &clusterName, WorkDir, awsCredsMap, CapiCfg, haCluster, skipCloudFormation)
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		// Create the GitOps repo
-		_, gitopsrepo, err := github.CreateRepo(&clusterName, ghToken, &privateRepo, WorkDir)
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		// Create repo dir structure based on which gitops controller that was chosen
-		if gitOpsController == "argocd" {
-			// Create repo dir structure. Including Argo CD install YAMLs and base YAMLs. Push initial dir structure out
-			_, err = templates.CreateArgoRepoSkel(&clusterName, WorkDir, ghToken, gitopsrepo, &privateRepo)
-			if err != nil {
-				log.Fatal(err)
-			}
-		} else if gitOpsController == "fluxcd" || gitOpsController == "flux" {
-			// Create repo dir structure. Including Flux CD install YAMLs and base YAMLs. Push initial dir structure out
-			_, err = templates.CreateFluxRepoSkel(&clusterName, WorkDir, ghToken, gitopsrepo, &privateRepo)
-			if err != nil {
-				log.Fatal(err)
-			}
-		} else {
-			log.Fatal("unknown gitops controller")
-		}
-
-		// Export/Create Cluster YAML to the Repo, Make sure kustomize is used for the core components
-		log.Info("Exporting Cluster YAML")
-		_, err = export.ExportClusterYaml(CapiCfg, WorkDir+"/"+clusterName, gitOpsController)
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		// Git push newly exported YAML to GitOps repo
-		privateKeyFile := WorkDir + "/" + clusterName + "_rsa"
-		_, err = github.CommitAndPush(WorkDir+"/"+clusterName, privateKeyFile, "exporting existing YAML")
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		// Deplopy the GitOps controller that was chosen
-		if gitOpsController == "argocd" {
-			// Install Argo CD on the newly created cluster with applications/applicationsets
-			log.Info("Deploying Argo CD GitOps Controller")
-			_, err = argo.BootstrapArgoCD(&clusterName, WorkDir, CapiCfg)
-			if err != nil {
-				log.Fatal(err)
-			}
-		} else if gitOpsController == "fluxcd" || gitOpsController == "flux" {
-			// Install Flux CD on the newly created cluster with all it's components
-			log.Info("Deploying Flux CD GitOps Controller")
-			_, err = flux.BootstrapFluxCD(&clusterName, WorkDir, CapiCfg)
-			if err != nil {
-				log.Fatal(err)
-			}
-		} else {
-			log.Fatal("unknown gitops controller")
-		}
-
-		// MOVE from kind to capi instance
-		log.Info("Moving CAPI Artifacts to: " + clusterName)
-		_, err = capi.MoveMgmtCluster(KindCfg, CapiCfg, "capa")
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		// Delete local Kind Cluster
-		log.Info("Deleting temporary control plane")
-		err = kind.DeleteKindCluster(tcpName, KindCfg)
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		// Move components to ~/.gokp/<clustername> and remove stuff you don't need to know.
-		// 	TODO: this is ugly and will refactor this later
-		///err = utils.CopyDir(WorkDir, gokpartifacts)
-		err = os.Rename(WorkDir, gokpartifacts)
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		notNeeded := []string{
-			"argocd-install-output",
-			"capi-install-yamls-output",
-			"cni-output",
-			"fluxcd-install-output",
-			"argocd-install.yaml",
-			"flux-install.yaml",
-			"cni.yaml",
-			"install-cluster.yaml",
-			"kind.kubeconfig",
-		}
-
-		for _, notNeededthing := range notNeeded {
-			err = os.RemoveAll(gokpartifacts + "/" + notNeededthing)
+		// Render everything without creating anything if asked to
+		if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+			clusterName, _ := cmd.Flags().GetString("cluster-name")
+			err := dryRunAwsCluster(cmd, clusterName)
 			if err != nil {
 				log.Fatal(err)
 			}
+			return
 		}
 
-		// Give info
-		log.Info("Cluster Successfully installed! Everything you need is under: ~/.gokp/", clusterName)
-
+		var awsCredsMap map[string]string
+		var awsSSHKey, awsVPCID, awsWMachine, awsSecurityGroup string
+		var skipCloudFormation bool
+		var dnsZone, dnsZoneID string
+		var backups *velero.Backups
+		runInstall(cmd, installHooks{
+			Provider:       "aws",
+			Credentials:    []string{"aws-access-key", "aws-secret-key"},
+			SizingProfiles: true,
+			MoveProvider:   "capa",
+			Configure: func(in *clusterInstall) error {
+				// Have external-dns manage a Route53 zone if requested
+				var err error
+				dnsZone, err = externalDNSZone(cmd)
+				if err != nil {
+					return err
+				}
+
+				// Grab AWS related flags, the template variables are looked up in the same account
+				in.Region, _ = cmd.Flags().GetString("aws-region")
+				in.AWSRegion = in.Region
+				in.AWSAccessKey, _ = cmd.Flags().GetString("aws-access-key")
+				in.AWSSecretKey, _ = cmd.Flags().GetString("aws-secret-key")
+
+				// Back the cluster up to S3 with Velero if requested
+				backups, err = clusterBackups(cmd, in.Region)
+				if err != nil {
+					return err
+				}
+
+				awsSSHKey, _ = cmd.Flags().GetString("aws-ssh-key")
+				awsCPMachine, _ := cmd.Flags().GetString("aws-control-plane-machine")
+				awsWMachine, _ = cmd.Flags().GetString("aws-node-machine")
+				skipCloudFormation, _ = cmd.Flags().GetBool("skip-cloud-formation")
+				capi.RootVolumeSize, _ = cmd.Flags().GetInt64("aws-root-volume-size")
+				capi.RootVolumeType, _ = cmd.Flags().GetString("aws-root-volume-type")
+				awsVPCID, _ = cmd.Flags().GetString("aws-vpc-id")
+
+				awsCredsMap = map[string]string{
+					"AWS_REGION":                     in.Region,
+					"AWS_ACCESS_KEY_ID":              in.AWSAccessKey,
+					"AWS_SECRET_ACCESS_KEY":          in.AWSSecretKey,
+					"AWS_SSH_KEY_NAME":               awsSSHKey,
+					"AWS_CONTROL_PLANE_MACHINE_TYPE": awsCPMachine,
+					"AWS_NODE_MACHINE_TYPE":          awsWMachine,
+				}
+				return nil
+			},
+			Prepare: func(in *clusterInstall) error {
+				// Check where the nodes go before anything is created
+				var err error
+				capi.AWSPlacement, err = awsPlacementConfig(cmd)
+				if err != nil {
+					return err
+				}
+				if capi.AWSPlacement != nil {
+					err = capi.ValidateAWSPlacement(capi.AWSPlacement, in.Region, in.AWSAccessKey, in.AWSSecretKey, awsWMachine)
+					if err != nil {
+						return err
+					}
+				}
+
+				// Check who can reach the machines, the security groups have to be in the VPC
+				capi.AWSSecurity, err = awsSecurityConfig(cmd)
+				if err != nil {
+					return err
+				}
+				if capi.AWSSecurity != nil {
+					err = capi.ValidateAWSSecurity(capi.AWSSecurity, awsVPCID, in.Region, in.AWSAccessKey, in.AWSSecretKey)
+					if err != nil {
+						return err
+					}
+				}
+
+				// Make sure the SSH key is there before anything is created, instead of failing once the machines are
+				err = ensureAWSSSHKey(cmd, in.ClusterName, in.Region, in.AWSAccessKey, in.AWSSecretKey, awsSSHKey)
+				if err != nil {
+					return err
+				}
+
+				// Make sure the zone is there before anything is created
+				if dnsZone != "" {
+					dnsZoneID, err = externaldns.HostedZoneID(dnsZone, in.AWSAccessKey, in.AWSSecretKey)
+					if err != nil {
+						return err
+					}
+				}
+
+				// And the backup bucket, which is created if it isn't there
+				if backups != nil {
+					err = velero.EnsureBucket(*backups, in.ClusterName, in.AWSAccessKey, in.AWSSecretKey)
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Infrastructure: func(in *clusterInstall) error {
+				// The load balancer only lets in the CIDRs given with a security group of our own. It's kept in the
+				// checkpoint so it's deleted along with the cluster if the install fails
+				if capi.AWSSecurity == nil || len(capi.AWSSecurity.APIServerCIDRs) == 0 {
+					return nil
+				}
+				err := capi.EnsureAWSAPIServerSecurityGroup(capi.AWSSecurity, awsVPCID, in.ClusterName, in.Region, in.AWSAccessKey, in.AWSSecretKey)
+				if err != nil {
+					return err
+				}
+				awsSecurityGroup = capi.AWSSecurity.APIServerSecurityGroup
+				in.Checkpoint.AWSSecurityGroup = awsSecurityGroup
+				in.Checkpoint.AWSRegion = in.Region
+				return in.Checkpoint.Save()
+			},
+			CreateCluster: func(in *clusterInstall) error {
+				// The stack is shared by the clusters of the account, remember if it's this one that created it
+				cp := in.Checkpoint
+				if !skipCloudFormation && !cp.AWSStackCreated {
+					exists, err := capi.AWSBootstrapStackExists(in.Region, in.AWSAccessKey, in.AWSSecretKey)
+					if err != nil {
+						return err
+					}
+					cp.AWSStackCreated = !exists
+					err = cp.Save()
+					if err != nil {
+						return err
+					}
+				}
+
+				// Create CAPI instance on AWS
+				_, err := capi.CreateAwsK8sInstance(in.MgmtCfg, &in.ClusterName, WorkDir, awsCredsMap, in.CapiCfg, in.HA, skipCloudFormation)
+				return err
+			},
+			WriteRepo: func(in *clusterInstall, baseDir string) error {
+				// Volumes come from the EBS CSI driver, so the cluster has storage out of the box
+				err := ebscsi.WriteManifests(baseDir, in.Region)
+				if err != nil {
+					return err
+				}
+
+				if dnsZone != "" {
+					err = externaldns.WriteManifests(baseDir, in.ClusterName, dnsZone)
+					if err != nil {
+						return err
+					}
+				}
+				if backups != nil {
+					err = velero.WriteManifests(baseDir, in.ClusterName, *backups)
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Bootstrap: func(in *clusterInstall) error {
+				// external-dns needs AWS credentials, which never go into the repo
+				if dnsZone != "" {
+					err := setupExternalDNSCredentials(in.ClusterName, dnsZoneID, in.CapiCfg, in.AWSAccessKey, in.AWSSecretKey)
+					if err != nil {
+						return err
+					}
+				}
+
+				// So does Velero
+				if backups != nil {
+					err := setupBackupCredentials(in.ClusterName, *backups, in.CapiCfg, in.AWSAccessKey, in.AWSSecretKey)
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Save: func(in *clusterInstall, st *state.ClusterState) error {
+				// Record what's in the CloudFormation stack, so it can be cleaned up later
+				if !skipCloudFormation {
+					awsStack, err := capi.DescribeAWSBootstrapStack(in.Region, in.AWSAccessKey, in.AWSSecretKey)
+					if err != nil {
+						return err
+					}
+					awsStack.Created = in.Checkpoint.AWSStackCreated
+					st.AWSStack = awsStack
+				}
+
+				st.AWSSSHKey = awsSSHKey
+				st.ExternalDNSZone = dnsZone
+				st.BackupBucket = backupBucket(backups)
+				st.AWSSecurityGroup = awsSecurityGroup
+				return nil
+			},
+		})
 	},
 }
 
@@ -203,10 +293,25 @@ func init() {
 	createClusterCmd.AddCommand(awscreateCmd)
 
 	// GitOps Controller Flag
-	awscreateCmd.Flags().String("gitops-controller", "argocd", "The GitOps Controller to use for this cluster.")
+	addGitOpsEngineFlags(awscreateCmd)
+	addBootstrapResourceFlags(awscreateCmd)
+	addCreateAddOnFlags(awscreateCmd)
+	addExternalDNSFlags(awscreateCmd)
+	addBackupFlags(awscreateCmd)
+	addRolloutStrategyFlags(awscreateCmd)
+	addCNIFlag(awscreateCmd)
+	addFeatureGatesFlag(awscreateCmd)
+	addKonnectivityFlags(awscreateCmd)
+	awscreateCmd.Flags().Bool("encrypt-secrets", false, "Encrypt secrets at rest with a key that's kept on the cluster, see rotate-encryption-key.")
+	addSizingProfileFlag(awscreateCmd)
+	addNamedProfileFlag(awscreateCmd)
+	awscreateCmd.Flags().StringToString("labels", nil, "Labels to record for the cluster (key=value), for selecting it with list-clusters.")
+	awscreateCmd.Flags().BoolP("helm-addons", "", false, "Install the CAPI Helm add-on provider (CAAPH) and install the CNI with it.")
+	awscreateCmd.Flags().Bool("dry-run", false, "Render the cluster YAML and the GitOps repo, and show what would be created, without creating anything.")
+	awscreateCmd.Flags().BoolP("exec-kubeconfig", "", false, "Also write a kubeconfig that gets short lived credentials from gokp instead of using the client certificate.")
 
 	// Repo specific flags
-	awscreateCmd.Flags().String("github-token", "", "GitHub token to use.")
+	addGitProviderFlags(awscreateCmd)
 	awscreateCmd.Flags().String("cluster-name", "", "Name of your cluster.")
 	awscreateCmd.Flags().BoolP("private-repo", "", true, "Create a private repo.")
 
@@ -215,13 +320,58 @@ func init() {
 	awscreateCmd.Flags().String("aws-access-key", "", "Your AWS Access Key.")
 	awscreateCmd.Flags().String("aws-secret-key", "", "Your AWS Secret Key.")
 	awscreateCmd.Flags().String("aws-ssh-key", "default", "The SSH key in AWS that you want to use for the instances.")
+	awscreateCmd.Flags().Bool("aws-create-ssh-key", false, "Create the SSH key if it doesn't exist, keeping its private key in the secret store.")
 	awscreateCmd.Flags().String("aws-control-plane-machine", "m4.xlarge", "The AWS instance type for the Control Plane")
 	awscreateCmd.Flags().String("aws-node-machine", "m4.xlarge", "The AWS instance type for the Worker instances")
+	awscreateCmd.Flags().Int64("aws-root-volume-size", 0, "The size of the root volume of the instances in GB (defaults to the one of the AMI).")
+	awscreateCmd.Flags().String("aws-root-volume-type", "", "The EBS volume type of the root volume of the instances (e.g. gp3), used with --aws-root-volume-size.")
 	awscreateCmd.Flags().BoolP("skip-cloud-formation", "", false, "Skip the creation of the CloudFormation Template.")
+	awscreateCmd.Flags().String("aws-vpc-id", "", "Existing VPC to install the cluster into, instead of letting CAPA create one.")
+	awscreateCmd.Flags().StringArray("aws-subnet", []string{}, "Subnet of --aws-vpc-id for the control plane and load balancer. Can be repeated.")
+	awscreateCmd.Flags().String("aws-node-subnet", "", "Subnet of --aws-vpc-id for the worker nodes, like one in a Local Zone or on an Outpost.")
+	awscreateCmd.Flags().String("aws-node-zone", "", "Zone of --aws-node-subnet (e.g. us-west-2-lax-1a). Defaults to the zone of the subnet.")
+	awscreateCmd.Flags().StringArray("aws-api-server-cidr", []string{}, "CIDR allowed to reach the API server, instead of anyone. Needs --aws-vpc-id. Can be repeated.")
+	awscreateCmd.Flags().StringArray("aws-ssh-cidr", []string{}, "CIDR allowed to SSH to the nodes, through a bastion host. Can be repeated.")
+	awscreateCmd.Flags().StringArray("aws-security-group", []string{}, "Existing security group of --aws-vpc-id to attach to every machine. Can be repeated.")
+	awscreateCmd.Flags().StringArray("aws-lb-security-group", []string{}, "Existing security group of --aws-vpc-id to attach to the API server load balancer. Can be repeated.")
 
 	// require the following flags
-	awscreateCmd.MarkFlagRequired("github-token")
 	awscreateCmd.MarkFlagRequired("cluster-name")
-	awscreateCmd.MarkFlagRequired("aws-access-key")
-	awscreateCmd.MarkFlagRequired("aws-secret-key")
+}
+
+// awsPlacementConfig returns where the cluster and its worker nodes go from the flags, or nil if CAPA decides
+func awsPlacementConfig(cmd *cobra.Command) (*capi.AWSPlacementConfig, error) {
+	p := &capi.AWSPlacementConfig{}
+	p.VPCID, _ = cmd.Flags().GetString("aws-vpc-id")
+	p.Subnets, _ = cmd.Flags().GetStringArray("aws-subnet")
+	p.NodeSubnet, _ = cmd.Flags().GetString("aws-node-subnet")
+	p.NodeZone, _ = cmd.Flags().GetString("aws-node-zone")
+
+	if p.VPCID == "" && len(p.Subnets) == 0 && p.NodeSubnet == "" && p.NodeZone == "" {
+		return nil, nil
+	}
+
+	// CAPA only uses the subnets we give it in a VPC it doesn't manage
+	if p.VPCID == "" || len(p.Subnets) == 0 || p.NodeSubnet == "" {
+		return nil, errors.New("placing nodes needs --aws-vpc-id, --aws-subnet, and --aws-node-subnet")
+	}
+
+	return p, nil
+}
+
+// awsSecurityConfig returns who can reach the machines from the flags, or nil if the defaults of CAPA are kept
+func awsSecurityConfig(cmd *cobra.Command) (*capi.AWSSecurityConfig, error) {
+	s := &capi.AWSSecurityConfig{}
+	s.APIServerCIDRs, _ = cmd.Flags().GetStringArray("aws-api-server-cidr")
+	s.SSHCIDRs, _ = cmd.Flags().GetStringArray("aws-ssh-cidr")
+	s.SecurityGroups, _ = cmd.Flags().GetStringArray("aws-security-group")
+	s.LoadBalancerSecurityGroups, _ = cmd.Flags().GetStringArray("aws-lb-security-group")
+
+	if len(s.APIServerCIDRs) == 0 && len(s.SSHCIDRs) == 0 && len(s.SecurityGroups) == 0 && len(s.LoadBalancerSecurityGroups) == 0 {
+		return nil, nil
+	}
+
+	// The CIDRs can be checked without AWS
+	vpcID, _ := cmd.Flags().GetString("aws-vpc-id")
+	return s, capi.ValidateAWSSecurity(s, vpcID, "", "", "")
 }
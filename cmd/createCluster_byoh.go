@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/christianh814/gokp/cmd/byoh"
+	"github.com/christianh814/gokp/cmd/capi"
+	"github.com/christianh814/gokp/cmd/kind"
+	"github.com/christianh814/gokp/cmd/state"
+	"github.com/spf13/cobra"
+)
+
+// byohcreateCmd represents the byoh create command
+var byohcreateCmd = &cobra.Command{
+	Use:   "byoh",
+	Short: "Creates a GOKP Cluster on existing hosts",
+	Long: `Create a GOKP Cluster on machines that already exist, with the Bring Your
+Own Host (BYOH) provider. No cloud API is used: the BYOH host agent is
+installed on each host over SSH and registers it with the temporary control
+plane, which listens on the given address of this machine so the hosts can
+reach it. Every host is used, the control plane is HA if there are 6 or more.
+The control plane endpoint is a virtual IP (with kube-vip), so it can't be the
+IP of any of the hosts. For example:
+
+gokp create-cluster byoh --cluster-name=mycluster \
+--github-token=githubtoken \
+--hosts=10.10.10.11,10.10.10.12,10.10.10.13 \
+--ssh-user=ubuntu \
+--ssh-key=~/.ssh/id_rsa \
+--bootstrap-address=10.10.10.5 \
+--control-plane-endpoint-ip=10.10.10.10 \
+--private-repo=true
+
+The hosts have to be in ~/.ssh/known_hosts, unless --ssh-insecure-ignore-host-key
+is given, and the user has to be able to use sudo without a password.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		var byohVarsMap map[string]string
+		var hosts *byoh.Hosts
+		var bootstrapAddress string
+		runInstall(cmd, installHooks{
+			Provider:     "byoh",
+			MoveProvider: "byoh",
+			Leftovers:    []string{"kindconfig.yaml"},
+			Configure: func(in *clusterInstall) error {
+				// Grab BYOH related flags
+				hostAddresses, _ := cmd.Flags().GetStringSlice("hosts")
+				sshUser, _ := cmd.Flags().GetString("ssh-user")
+				sshPort, _ := cmd.Flags().GetInt("ssh-port")
+				sshKey, _ := cmd.Flags().GetString("ssh-key")
+				sshInsecure, _ := cmd.Flags().GetBool("ssh-insecure-ignore-host-key")
+				bootstrapAddress, _ = cmd.Flags().GetString("bootstrap-address")
+				cpEndpointIP, _ := cmd.Flags().GetString("control-plane-endpoint-ip")
+				bundleLookupTag, _ := cmd.Flags().GetString("bundle-lookup-tag")
+
+				// There has to be a worker left over after the control plane
+				if len(hostAddresses) < 2 {
+					return errors.New("at least 2 hosts are needed, one for the control plane and one worker")
+				}
+				sshKey, err := filepath.Abs(sshKey)
+				if err != nil {
+					return err
+				}
+				hosts = &byoh.Hosts{
+					Addresses:             hostAddresses,
+					User:                  sshUser,
+					Port:                  sshPort,
+					SSHKey:                sshKey,
+					InsecureIgnoreHostKey: sshInsecure,
+				}
+
+				// The bundle of the Kubernetes packages is tagged with the version
+				if bundleLookupTag == "" {
+					bundleLookupTag = capi.KubernetesVersion
+				}
+
+				byohVarsMap = map[string]string{
+					"CONTROL_PLANE_ENDPOINT_IP": cpEndpointIP,
+					"BUNDLE_LOOKUP_TAG":         bundleLookupTag,
+				}
+				return nil
+			},
+			TemporaryControlPlane: func(in *clusterInstall) error {
+				return kind.CreateBYOHKindCluster(in.TCPName, in.MgmtCfg, WorkDir, bootstrapAddress)
+			},
+			CreateCluster: func(in *clusterInstall) error {
+				// Create CAPI instance on the hosts
+				_, err := capi.CreateBYOHK8sInstance(in.MgmtCfg, &in.ClusterName, WorkDir, byohVarsMap, in.CapiCfg, hosts)
+				return err
+			},
+			Moved: func(in *clusterInstall) error {
+				// The hosts have to talk to the cluster now, the temporary control plane is going away
+				return hosts.InstallAgent(in.CapiCfg)
+			},
+			Save: func(in *clusterInstall, st *state.ClusterState) error {
+				// The hosts are needed to delete the cluster
+				return hosts.Save(in.Artifacts)
+			},
+		})
+	},
+}
+
+func init() {
+	createClusterCmd.AddCommand(byohcreateCmd)
+
+	// GitOps Controller Flag
+	addGitOpsEngineFlags(byohcreateCmd)
+	addBootstrapResourceFlags(byohcreateCmd)
+	addCreateAddOnFlags(byohcreateCmd)
+	addRolloutStrategyFlags(byohcreateCmd)
+	addCNIFlag(byohcreateCmd)
+	addFeatureGatesFlag(byohcreateCmd)
+	addKonnectivityFlags(byohcreateCmd)
+	byohcreateCmd.Flags().Bool("encrypt-secrets", false, "Encrypt secrets at rest with a key that's kept on the cluster, see rotate-encryption-key.")
+	addNamedProfileFlag(byohcreateCmd)
+	byohcreateCmd.Flags().StringToString("labels", nil, "Labels to record for the cluster (key=value), for selecting it with list-clusters.")
+	byohcreateCmd.Flags().BoolP("helm-addons", "", false, "Install the CAPI Helm add-on provider (CAAPH) and install the CNI with it.")
+	byohcreateCmd.Flags().BoolP("exec-kubeconfig", "", false, "Also write a kubeconfig that gets short lived credentials from gokp instead of using the client certificate.")
+
+	// Repo specific flags
+	addGitProviderFlags(byohcreateCmd)
+	byohcreateCmd.Flags().String("cluster-name", "", "Name of your cluster.")
+	byohcreateCmd.Flags().BoolP("private-repo", "", true, "Create a private repo.")
+
+	// BYOH Specific flags
+	byohcreateCmd.Flags().StringSlice("hosts", []string{}, "The addresses of the hosts to install the cluster on.")
+	byohcreateCmd.Flags().String("ssh-user", "ubuntu", "The user to SSH into the hosts as.")
+	byohcreateCmd.Flags().Int("ssh-port", 22, "The port to SSH into the hosts on.")
+	byohcreateCmd.Flags().String("ssh-key", os.Getenv("HOME")+"/.ssh/id_rsa", "Path to the SSH private key for the hosts.")
+	byohcreateCmd.Flags().Bool("ssh-insecure-ignore-host-key", false, "Don't check the host keys of the hosts against ~/.ssh/known_hosts.")
+	byohcreateCmd.Flags().String("bootstrap-address", "", "The IP of this machine the hosts can reach the temporary control plane on.")
+	byohcreateCmd.Flags().String("control-plane-endpoint-ip", "", "The virtual IP of the control plane.")
+	byohcreateCmd.Flags().String("bundle-lookup-tag", "", "The tag of the BYOH bundle with the Kubernetes packages (defaults to the Kubernetes version).")
+
+	// require the following flags
+	byohcreateCmd.MarkFlagRequired("cluster-name")
+	byohcreateCmd.MarkFlagRequired("hosts")
+	byohcreateCmd.MarkFlagRequired("bootstrap-address")
+	byohcreateCmd.MarkFlagRequired("control-plane-endpoint-ip")
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"github.com/christianh814/gokp/cmd/capi"
+	"github.com/spf13/cobra"
+)
+
+// ibmcloudcreateCmd represents the ibmcloud create command
+var ibmcloudcreateCmd = &cobra.Command{
+	Use:   "ibmcloud",
+	Short: "Creates a GOKP Cluster on IBM Cloud",
+	Long: `Create a GOKP Cluster on IBM Cloud VPC (Gen2) with CAPIBM. This will build
+a VPC in the given resource group using the given API key. The image has to be
+one built for Cluster API (with image-builder). For example:
+
+gokp create-cluster ibmcloud --cluster-name=mycluster \
+--github-token=githubtoken \
+--ibmcloud-api-key=apikey \
+--ibmcloud-resource-group=resourcegroupid \
+--ibmcloud-image-id=imageid \
+--ibmcloud-ssh-key-id=sshkeyid \
+--private-repo=true`,
+	Run: func(cmd *cobra.Command, args []string) {
+		var ibmCredsMap map[string]string
+		runInstall(cmd, installHooks{
+			Provider:       "ibmcloud",
+			Credentials:    []string{"ibmcloud-api-key"},
+			SizingProfiles: true,
+			MoveProvider:   "capibm",
+			Configure: func(in *clusterInstall) error {
+				// Grab IBM Cloud related flags
+				ibmAPIKey, _ := cmd.Flags().GetString("ibmcloud-api-key")
+				in.Region, _ = cmd.Flags().GetString("ibmcloud-region")
+				ibmZone, _ := cmd.Flags().GetString("ibmcloud-zone")
+				ibmResourceGroup, _ := cmd.Flags().GetString("ibmcloud-resource-group")
+				ibmVPCName, _ := cmd.Flags().GetString("ibmcloud-vpc-name")
+				ibmImageId, _ := cmd.Flags().GetString("ibmcloud-image-id")
+				ibmSSHKeyId, _ := cmd.Flags().GetString("ibmcloud-ssh-key-id")
+				ibmCPProfile, _ := cmd.Flags().GetString("ibmcloud-control-plane-profile")
+				capi.IBMCloudNodeProfile, _ = cmd.Flags().GetString("ibmcloud-node-profile")
+
+				// Default to the first zone of the region and a VPC named after the cluster
+				if ibmZone == "" {
+					ibmZone = in.Region + "-1"
+				}
+				if ibmVPCName == "" {
+					ibmVPCName = in.ClusterName + "-vpc"
+				}
+
+				ibmCredsMap = map[string]string{
+					"IBMCLOUD_API_KEY":     ibmAPIKey,
+					"IBMVPC_REGION":        in.Region,
+					"IBMVPC_ZONE":          ibmZone,
+					"IBMVPC_RESOURCEGROUP": ibmResourceGroup,
+					"IBMVPC_NAME":          ibmVPCName,
+					"IBMVPC_IMAGE_ID":      ibmImageId,
+					"IBMVPC_SSHKEY_ID":     ibmSSHKeyId,
+					"IBMVPC_PROFILE":       ibmCPProfile,
+				}
+				return nil
+			},
+			CreateCluster: func(in *clusterInstall) error {
+				// Create CAPI instance on IBM Cloud
+				_, err := capi.CreateIBMCloudK8sInstance(in.MgmtCfg, &in.ClusterName, WorkDir, ibmCredsMap, in.CapiCfg, in.HA)
+				return err
+			},
+		})
+	},
+}
+
+func init() {
+	createClusterCmd.AddCommand(ibmcloudcreateCmd)
+
+	// GitOps Controller Flag
+	addGitOpsEngineFlags(ibmcloudcreateCmd)
+	addBootstrapResourceFlags(ibmcloudcreateCmd)
+	addCreateAddOnFlags(ibmcloudcreateCmd)
+	addRolloutStrategyFlags(ibmcloudcreateCmd)
+	addCNIFlag(ibmcloudcreateCmd)
+	addFeatureGatesFlag(ibmcloudcreateCmd)
+	addKonnectivityFlags(ibmcloudcreateCmd)
+	ibmcloudcreateCmd.Flags().Bool("encrypt-secrets", false, "Encrypt secrets at rest with a key that's kept on the cluster, see rotate-encryption-key.")
+	addSizingProfileFlag(ibmcloudcreateCmd)
+	addNamedProfileFlag(ibmcloudcreateCmd)
+	ibmcloudcreateCmd.Flags().StringToString("labels", nil, "Labels to record for the cluster (key=value), for selecting it with list-clusters.")
+	ibmcloudcreateCmd.Flags().BoolP("helm-addons", "", false, "Install the CAPI Helm add-on provider (CAAPH) and install the CNI with it.")
+	ibmcloudcreateCmd.Flags().BoolP("exec-kubeconfig", "", false, "Also write a kubeconfig that gets short lived credentials from gokp instead of using the client certificate.")
+
+	// Repo specific flags
+	addGitProviderFlags(ibmcloudcreateCmd)
+	ibmcloudcreateCmd.Flags().String("cluster-name", "", "Name of your cluster.")
+	ibmcloudcreateCmd.Flags().BoolP("private-repo", "", true, "Create a private repo.")
+
+	// IBM Cloud Specific flags
+	ibmcloudcreateCmd.Flags().String("ibmcloud-api-key", "", "Your IBM Cloud API key.")
+	ibmcloudcreateCmd.Flags().String("ibmcloud-region", "us-south", "Which region to deploy to.")
+	ibmcloudcreateCmd.Flags().String("ibmcloud-zone", "", "Which zone of the region to deploy to (defaults to <region>-1).")
+	ibmcloudcreateCmd.Flags().String("ibmcloud-resource-group", "", "ID of the resource group to create the cluster in.")
+	ibmcloudcreateCmd.Flags().String("ibmcloud-vpc-name", "", "Name of the VPC to create (defaults to <clustername>-vpc).")
+	ibmcloudcreateCmd.Flags().String("ibmcloud-image-id", "", "ID of the Cluster API image for the instances.")
+	ibmcloudcreateCmd.Flags().String("ibmcloud-ssh-key-id", "", "ID of the SSH key to put on the instances.")
+	ibmcloudcreateCmd.Flags().String("ibmcloud-control-plane-profile", "bx2-4x16", "The IBM Cloud profile for the Control Plane")
+	ibmcloudcreateCmd.Flags().String("ibmcloud-node-profile", "", "The IBM Cloud profile for the Worker instances (defaults to the Control Plane one)")
+
+	// require the following flags
+	ibmcloudcreateCmd.MarkFlagRequired("cluster-name")
+	ibmcloudcreateCmd.MarkFlagRequired("ibmcloud-resource-group")
+	ibmcloudcreateCmd.MarkFlagRequired("ibmcloud-image-id")
+	ibmcloudcreateCmd.MarkFlagRequired("ibmcloud-ssh-key-id")
+}
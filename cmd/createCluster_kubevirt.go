@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"errors"
+	"path/filepath"
+
+	"github.com/christianh814/gokp/cmd/capi"
+	"github.com/christianh814/gokp/cmd/checkpoint"
+	"github.com/christianh814/gokp/cmd/state"
+	"github.com/spf13/cobra"
+)
+
+// kubevirtcreateCmd represents the kubevirt create command
+var kubevirtcreateCmd = &cobra.Command{
+	Use:   "kubevirt",
+	Short: "Creates a GOKP Cluster of KubeVirt VMs",
+	Long: `Create a GOKP Cluster of VMs on an existing cluster that has KubeVirt
+installed, with CAPK. That cluster is the management cluster: CAPK is
+installed on it (if it isn't already) and the CAPI objects of the new cluster
+stay there, so no temporary control plane is needed and many clusters can be
+managed from the same place. The API server is exposed with a LoadBalancer
+Service on the management cluster by default. For example:
+
+gokp create-cluster kubevirt --cluster-name=mycluster \
+--github-token=githubtoken \
+--management-kubeconfig=~/.kube/config \
+--private-repo=true
+
+Since the CAPI objects aren't on the cluster, they aren't exported to the
+GitOps repo and commands that change the machines of the cluster through the
+repo (like scale or nodepool) don't work on it.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		var kubevirtVarsMap map[string]string
+		runInstall(cmd, installHooks{
+			Provider: "kubevirt",
+			Configure: func(in *clusterInstall) error {
+				// Grab KubeVirt related flags
+				mgmtKubeconfig, _ := cmd.Flags().GetString("management-kubeconfig")
+				nodeVMImage, _ := cmd.Flags().GetString("node-vm-image")
+				criPath, _ := cmd.Flags().GetString("cri-path")
+				capi.KubeVirtControlPlaneServiceType, _ = cmd.Flags().GetString("control-plane-service-type")
+
+				// The path is kept in the state, so it has to work from anywhere
+				mgmtKubeconfig, err := filepath.Abs(mgmtKubeconfig)
+				if err != nil {
+					return err
+				}
+
+				// CAPI is initialized on the management cluster, which may be one that matters
+				err = checkGuardrails(cmd, mgmtKubeconfig, "", "initialize CAPI and create "+in.ClusterName+" on it")
+				if err != nil {
+					return err
+				}
+
+				// The cluster is created from, and stays managed by, the management cluster. There's no temporary
+				// control plane
+				in.TCPName = ""
+				in.MgmtCfg = mgmtKubeconfig
+
+				// The container disk of the VMs is built for the Kubernetes version
+				if nodeVMImage == "" {
+					nodeVMImage = "quay.io/capk/ubuntu-2004-container-disk:" + capi.KubernetesVersion
+				}
+
+				kubevirtVarsMap = map[string]string{
+					"NODE_VM_IMAGE_TEMPLATE": nodeVMImage,
+					"CRI_PATH":               criPath,
+				}
+				return nil
+			},
+			Prepare: func(in *clusterInstall) error {
+				// A cluster with the name that's already there would be taken over, and deleted if the install failed
+				if in.Checkpoint.Done(checkpoint.ClusterCreated) {
+					return nil
+				}
+				exists, err := capi.ClusterExists(in.MgmtCfg, in.ClusterName)
+				if err != nil {
+					return err
+				}
+				if exists {
+					return errors.New("cluster " + in.ClusterName + " already exists on the management cluster")
+				}
+				return nil
+			},
+			CreateCluster: func(in *clusterInstall) error {
+				// Create CAPI instance on the management cluster
+				_, err := capi.CreateKubeVirtK8sInstance(in.MgmtCfg, &in.ClusterName, WorkDir, kubevirtVarsMap, in.CapiCfg, in.HA)
+				return err
+			},
+			Save: func(in *clusterInstall, st *state.ClusterState) error {
+				st.ManagementKubeconfig = in.MgmtCfg
+				return nil
+			},
+		})
+	},
+}
+
+func init() {
+	createClusterCmd.AddCommand(kubevirtcreateCmd)
+
+	// GitOps Controller Flag
+	addGitOpsEngineFlags(kubevirtcreateCmd)
+	addBootstrapResourceFlags(kubevirtcreateCmd)
+	addCreateAddOnFlags(kubevirtcreateCmd)
+	addRolloutStrategyFlags(kubevirtcreateCmd)
+	addCNIFlag(kubevirtcreateCmd)
+	addFeatureGatesFlag(kubevirtcreateCmd)
+	addKonnectivityFlags(kubevirtcreateCmd)
+	kubevirtcreateCmd.Flags().Bool("encrypt-secrets", false, "Encrypt secrets at rest with a key that's kept on the cluster, see rotate-encryption-key.")
+	addNamedProfileFlag(kubevirtcreateCmd)
+	kubevirtcreateCmd.Flags().StringToString("labels", nil, "Labels to record for the cluster (key=value), for selecting it with list-clusters.")
+	kubevirtcreateCmd.Flags().BoolP("helm-addons", "", false, "Install the CAPI Helm add-on provider (CAAPH) and install the CNI with it.")
+	kubevirtcreateCmd.Flags().BoolP("exec-kubeconfig", "", false, "Also write a kubeconfig that gets short lived credentials from gokp instead of using the client certificate.")
+
+	// Repo Specific Flags
+	addGitProviderFlags(kubevirtcreateCmd)
+	kubevirtcreateCmd.Flags().String("cluster-name", "", "Name of your cluster.")
+	kubevirtcreateCmd.Flags().BoolP("private-repo", "", true, "Create a private repo.")
+	kubevirtcreateCmd.Flags().BoolP("ha", "", false, "Create an HA cluster.")
+
+	// KubeVirt Specific flags
+	kubevirtcreateCmd.Flags().String("management-kubeconfig", "", "Path to the Kubeconfig file of the cluster with KubeVirt that the VMs are created on.")
+	addGuardrailFlags(kubevirtcreateCmd)
+	kubevirtcreateCmd.Flags().String("node-vm-image", "", "The container disk the VMs boot from (defaults to the CAPK Ubuntu image of the Kubernetes version).")
+	kubevirtcreateCmd.Flags().String("cri-path", "/var/run/containerd/containerd.sock", "The path of the CRI socket on the VMs.")
+	kubevirtcreateCmd.Flags().String("control-plane-service-type", "LoadBalancer", "The type of the Service the API server is exposed with on the management cluster.")
+
+	// required flags
+	kubevirtcreateCmd.MarkFlagRequired("cluster-name")
+	kubevirtcreateCmd.MarkFlagRequired("management-kubeconfig")
+}
@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"strings"
+
+	"github.com/christianh814/gokp/cmd/capi"
+	"github.com/spf13/cobra"
+)
+
+// linodecreateCmd represents the linode create command
+var linodecreateCmd = &cobra.Command{
+	Use:   "linode",
+	Short: "Creates a GOKP Cluster on Linode",
+	Long: `Create a GOKP Cluster on Linode (Akamai) with CAPL. This will build a
+cluster in the given region using the given API token, with the given plans
+for the instances. For example:
+
+gokp create-cluster linode --cluster-name=mycluster \
+--github-token=githubtoken \
+--linode-token=linodetoken \
+--linode-region=us-ord \
+--private-repo=true`,
+	Run: func(cmd *cobra.Command, args []string) {
+		var linodeCredsMap map[string]string
+		runInstall(cmd, installHooks{
+			Provider:       "linode",
+			Credentials:    []string{"linode-token"},
+			SizingProfiles: true,
+			MoveProvider:   "capl",
+			Configure: func(in *clusterInstall) error {
+				// Grab Linode related flags
+				linodeToken, _ := cmd.Flags().GetString("linode-token")
+				in.Region, _ = cmd.Flags().GetString("linode-region")
+				linodeCPPlan, _ := cmd.Flags().GetString("linode-control-plane-plan")
+				linodeWPlan, _ := cmd.Flags().GetString("linode-node-plan")
+				linodeSSHKey, _ := cmd.Flags().GetString("linode-ssh-key")
+
+				// CAPL takes the key itself, not the file it's in
+				linodeSSHPublicKey := []byte{}
+				if linodeSSHKey != "" {
+					var err error
+					linodeSSHPublicKey, err = ioutil.ReadFile(linodeSSHKey)
+					if err != nil {
+						return err
+					}
+				}
+
+				linodeCredsMap = map[string]string{
+					"LINODE_TOKEN":                      linodeToken,
+					"LINODE_REGION":                     in.Region,
+					"LINODE_CONTROL_PLANE_MACHINE_TYPE": linodeCPPlan,
+					"LINODE_MACHINE_TYPE":               linodeWPlan,
+					"LINODE_SSH_PUBKEY":                 strings.TrimSpace(string(linodeSSHPublicKey)),
+				}
+				return nil
+			},
+			CreateCluster: func(in *clusterInstall) error {
+				// Create CAPI instance on Linode
+				_, err := capi.CreateLinodeK8sInstance(in.MgmtCfg, &in.ClusterName, WorkDir, linodeCredsMap, in.CapiCfg, in.HA)
+				return err
+			},
+		})
+	},
+}
+
+func init() {
+	createClusterCmd.AddCommand(linodecreateCmd)
+
+	// GitOps Controller Flag
+	addGitOpsEngineFlags(linodecreateCmd)
+	addBootstrapResourceFlags(linodecreateCmd)
+	addCreateAddOnFlags(linodecreateCmd)
+	addRolloutStrategyFlags(linodecreateCmd)
+	addCNIFlag(linodecreateCmd)
+	addFeatureGatesFlag(linodecreateCmd)
+	addKonnectivityFlags(linodecreateCmd)
+	linodecreateCmd.Flags().Bool("encrypt-secrets", false, "Encrypt secrets at rest with a key that's kept on the cluster, see rotate-encryption-key.")
+	addSizingProfileFlag(linodecreateCmd)
+	addNamedProfileFlag(linodecreateCmd)
+	linodecreateCmd.Flags().StringToString("labels", nil, "Labels to record for the cluster (key=value), for selecting it with list-clusters.")
+	linodecreateCmd.Flags().BoolP("helm-addons", "", false, "Install the CAPI Helm add-on provider (CAAPH) and install the CNI with it.")
+	linodecreateCmd.Flags().BoolP("exec-kubeconfig", "", false, "Also write a kubeconfig that gets short lived credentials from gokp instead of using the client certificate.")
+
+	// Repo specific flags
+	addGitProviderFlags(linodecreateCmd)
+	linodecreateCmd.Flags().String("cluster-name", "", "Name of your cluster.")
+	linodecreateCmd.Flags().BoolP("private-repo", "", true, "Create a private repo.")
+
+	// Linode Specific flags
+	linodecreateCmd.Flags().String("linode-token", "", "Your Linode API token.")
+	linodecreateCmd.Flags().String("linode-region", "us-ord", "Which region to deploy to.")
+	linodecreateCmd.Flags().String("linode-control-plane-plan", "g6-standard-2", "The Linode plan for the Control Plane")
+	linodecreateCmd.Flags().String("linode-node-plan", "g6-standard-2", "The Linode plan for the Worker instances")
+	linodecreateCmd.Flags().String("linode-ssh-key", "", "Path to the SSH public key to put on the instances.")
+
+	// require the following flags
+	linodecreateCmd.MarkFlagRequired("cluster-name")
+}
@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"github.com/christianh814/gokp/cmd/capi"
+	"github.com/christianh814/gokp/cmd/cni"
+	"github.com/christianh814/gokp/cmd/metal3"
+	"github.com/spf13/cobra"
+)
+
+// metal3createCmd represents the metal3 create command
+var metal3createCmd = &cobra.Command{
+	Use:   "metal3",
+	Short: "Creates a GOKP Cluster on bare metal with Metal3",
+	Long: `Create a GOKP Cluster on bare metal hosts with CAPM3. The hosts are
+registered with the Bare Metal Operator from the inventory file, which has the
+BMC address and credentials of each of them, and are provisioned by the given
+Ironic with the image from the image server. Every host of the inventory is
+used, the control plane is HA if there are 6 or more. For example:
+
+gokp create-cluster metal3 --cluster-name=mycluster \
+--github-token=githubtoken \
+--inventory=hosts.yaml \
+--ironic-url=http://172.22.0.2:6385/v1/ \
+--deploy-kernel-url=http://172.22.0.1/images/ironic-python-agent.kernel \
+--deploy-ramdisk-url=http://172.22.0.1/images/ironic-python-agent.initramfs \
+--image-url=http://172.22.0.1/images/UBUNTU_22.04_NODE_IMAGE_K8S_v1.24.2.img \
+--image-checksum=http://172.22.0.1/images/UBUNTU_22.04_NODE_IMAGE_K8S_v1.24.2.img.sha256sum \
+--control-plane-endpoint=192.168.111.249 \
+--private-repo=true
+
+The inventory lists the hosts like so:
+
+hosts:
+- name: node-0
+  bootMACAddress: "00:5c:52:31:3a:9c"
+  bmc:
+    address: ipmi://192.168.111.1:6230
+    username: admin
+    password: password
+  rootDeviceHints:
+    deviceName: /dev/sda`,
+	Run: func(cmd *cobra.Command, args []string) {
+		var metal3VarsMap map[string]string
+		var inventory *metal3.Inventory
+		runInstall(cmd, installHooks{
+			Provider:     "metal3",
+			MoveProvider: "capm3",
+			Leftovers: []string{
+				"baremetalhosts-output",
+				"baremetalhosts.yaml",
+				"bmo-install.yaml",
+				"bmo-kustomize",
+				"bmo-output",
+			},
+			Configure: func(in *clusterInstall) error {
+				// The pods of metal3 clusters get their IPs from a smaller CIDR
+				cni.PodCIDR = "192.168.0.0/18"
+
+				// Grab Metal3 related flags
+				inventoryFile, _ := cmd.Flags().GetString("inventory")
+				capi.Metal3IronicURL, _ = cmd.Flags().GetString("ironic-url")
+				capi.Metal3DeployKernelURL, _ = cmd.Flags().GetString("deploy-kernel-url")
+				capi.Metal3DeployRamdiskURL, _ = cmd.Flags().GetString("deploy-ramdisk-url")
+				imageURL, _ := cmd.Flags().GetString("image-url")
+				imageChecksum, _ := cmd.Flags().GetString("image-checksum")
+				imageChecksumType, _ := cmd.Flags().GetString("image-checksum-type")
+				imageFormat, _ := cmd.Flags().GetString("image-format")
+				cpEndpoint, _ := cmd.Flags().GetString("control-plane-endpoint")
+				cpEndpointPort, _ := cmd.Flags().GetString("control-plane-endpoint-port")
+
+				// Make sure the hosts are usable before anything is created
+				var err error
+				inventory, err = metal3.LoadInventory(inventoryFile)
+				if err != nil {
+					return err
+				}
+
+				// The extra kubeadm config is left empty, the template needs it set
+				metal3VarsMap = map[string]string{
+					"CLUSTER_APIENDPOINT_HOST":      cpEndpoint,
+					"CLUSTER_APIENDPOINT_PORT":      cpEndpointPort,
+					"IMAGE_URL":                     imageURL,
+					"IMAGE_CHECKSUM":                imageChecksum,
+					"IMAGE_CHECKSUM_TYPE":           imageChecksumType,
+					"IMAGE_FORMAT":                  imageFormat,
+					"POD_CIDR":                      "192.168.0.0/18",
+					"SERVICE_CIDR":                  "10.96.0.0/12",
+					"CTLPLANE_KUBEADM_EXTRA_CONFIG": "",
+					"WORKERS_KUBEADM_EXTRA_CONFIG":  "",
+				}
+				return nil
+			},
+			CreateCluster: func(in *clusterInstall) error {
+				// Create CAPI instance on the hosts
+				_, err := capi.CreateMetal3K8sInstance(in.MgmtCfg, &in.ClusterName, WorkDir, metal3VarsMap, in.CapiCfg, inventory)
+				return err
+			},
+		})
+	},
+}
+
+func init() {
+	createClusterCmd.AddCommand(metal3createCmd)
+
+	// GitOps Controller Flag
+	addGitOpsEngineFlags(metal3createCmd)
+	addBootstrapResourceFlags(metal3createCmd)
+	addCreateAddOnFlags(metal3createCmd)
+	addRolloutStrategyFlags(metal3createCmd)
+	addCNIFlag(metal3createCmd)
+	addFeatureGatesFlag(metal3createCmd)
+	addKonnectivityFlags(metal3createCmd)
+	metal3createCmd.Flags().Bool("encrypt-secrets", false, "Encrypt secrets at rest with a key that's kept on the cluster, see rotate-encryption-key.")
+	addNamedProfileFlag(metal3createCmd)
+	metal3createCmd.Flags().StringToString("labels", nil, "Labels to record for the cluster (key=value), for selecting it with list-clusters.")
+	metal3createCmd.Flags().BoolP("helm-addons", "", false, "Install the CAPI Helm add-on provider (CAAPH) and install the CNI with it.")
+	metal3createCmd.Flags().BoolP("exec-kubeconfig", "", false, "Also write a kubeconfig that gets short lived credentials from gokp instead of using the client certificate.")
+
+	// Repo specific flags
+	addGitProviderFlags(metal3createCmd)
+	metal3createCmd.Flags().String("cluster-name", "", "Name of your cluster.")
+	metal3createCmd.Flags().BoolP("private-repo", "", true, "Create a private repo.")
+
+	// Metal3 Specific flags
+	metal3createCmd.Flags().String("inventory", "", "Path to the inventory file with the hosts and their BMC credentials.")
+	metal3createCmd.Flags().String("ironic-url", "", "URL of the Ironic API the hosts are provisioned with (e.g. http://172.22.0.2:6385/v1/).")
+	metal3createCmd.Flags().String("deploy-kernel-url", "", "URL of the Ironic Python Agent kernel the hosts are booted into to be provisioned.")
+	metal3createCmd.Flags().String("deploy-ramdisk-url", "", "URL of the Ironic Python Agent ramdisk the hosts are booted into to be provisioned.")
+	metal3createCmd.Flags().String("image-url", "", "URL of the node image on the image server.")
+	metal3createCmd.Flags().String("image-checksum", "", "The checksum of the node image, or the URL of it on the image server.")
+	metal3createCmd.Flags().String("image-checksum-type", "sha256", "The type of the checksum of the node image (md5, sha256, or sha512).")
+	metal3createCmd.Flags().String("image-format", "raw", "The format of the node image (raw or qcow2).")
+	metal3createCmd.Flags().String("control-plane-endpoint", "", "The IP of the control plane, it's not one of the hosts.")
+	metal3createCmd.Flags().String("control-plane-endpoint-port", "6443", "The port of the control plane.")
+
+	// require the following flags
+	metal3createCmd.MarkFlagRequired("cluster-name")
+	metal3createCmd.MarkFlagRequired("inventory")
+	metal3createCmd.MarkFlagRequired("ironic-url")
+	metal3createCmd.MarkFlagRequired("deploy-kernel-url")
+	metal3createCmd.MarkFlagRequired("deploy-ramdisk-url")
+	metal3createCmd.MarkFlagRequired("image-url")
+	metal3createCmd.MarkFlagRequired("image-checksum")
+	metal3createCmd.MarkFlagRequired("control-plane-endpoint")
+}
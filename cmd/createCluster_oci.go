@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/christianh814/gokp/cmd/capi"
+	"github.com/spf13/cobra"
+)
+
+// ocicreateCmd represents the oci create command
+var ocicreateCmd = &cobra.Command{
+	Use:   "oci",
+	Short: "Creates a GOKP Cluster on Oracle Cloud",
+	Long: `Create a GOKP Cluster on Oracle Cloud (OCI) with CAPOCI. This will build a
+cluster in the given compartment using the given API signing key. The image
+has to be one built for Cluster API (with image-builder). For example:
+
+gokp create-cluster oci --cluster-name=mycluster \
+--github-token=githubtoken \
+--oci-tenancy-id='ocid1.tenancy.oc1..xxx' \
+--oci-user-id='ocid1.user.oc1..xxx' \
+--oci-fingerprint='12:34:56:...' \
+--oci-private-key=$HOME/.oci/oci_api_key.pem \
+--oci-compartment-id='ocid1.compartment.oc1..xxx' \
+--oci-image-id='ocid1.image.oc1.iad.xxx' \
+--private-repo=true`,
+	Run: func(cmd *cobra.Command, args []string) {
+		var ociCredsMap map[string]string
+		runInstall(cmd, installHooks{
+			Provider:       "oci",
+			Credentials:    []string{"oci-fingerprint"},
+			SizingProfiles: true,
+			MoveProvider:   "capoci",
+			Configure: func(in *clusterInstall) error {
+				// Grab OCI related flags
+				in.Region, _ = cmd.Flags().GetString("oci-region")
+				ociTenancyId, _ := cmd.Flags().GetString("oci-tenancy-id")
+				ociUserId, _ := cmd.Flags().GetString("oci-user-id")
+				ociFingerprint, _ := cmd.Flags().GetString("oci-fingerprint")
+				ociPrivateKey, _ := cmd.Flags().GetString("oci-private-key")
+				ociPassphrase, _ := cmd.Flags().GetString("oci-private-key-passphrase")
+				ociCompartmentId, _ := cmd.Flags().GetString("oci-compartment-id")
+				ociImageId, _ := cmd.Flags().GetString("oci-image-id")
+				ociSSHKey, _ := cmd.Flags().GetString("oci-ssh-key")
+				ociCPShape, _ := cmd.Flags().GetString("oci-control-plane-shape")
+				ociCPOcpus, _ := cmd.Flags().GetString("oci-control-plane-ocpus")
+				ociWShape, _ := cmd.Flags().GetString("oci-node-shape")
+				ociWOcpus, _ := cmd.Flags().GetString("oci-node-ocpus")
+
+				// CAPOCI takes the keys themselves, not the files they're in
+				ociKey, err := ioutil.ReadFile(ociPrivateKey)
+				if err != nil {
+					return err
+				}
+				ociSSHPublicKey := []byte{}
+				if ociSSHKey != "" {
+					ociSSHPublicKey, err = ioutil.ReadFile(ociSSHKey)
+					if err != nil {
+						return err
+					}
+				}
+
+				ociCredsMap = map[string]string{
+					"OCI_REGION":                           in.Region,
+					"OCI_TENANCY_ID":                       ociTenancyId,
+					"OCI_USER_ID":                          ociUserId,
+					"OCI_CREDENTIALS_FINGERPRINT":          ociFingerprint,
+					"OCI_CREDENTIALS_KEY":                  string(ociKey),
+					"OCI_CREDENTIALS_PASSPHRASE":           ociPassphrase,
+					"OCI_COMPARTMENT_ID":                   ociCompartmentId,
+					"OCI_IMAGE_ID":                         ociImageId,
+					"OCI_SSH_KEY":                          strings.TrimSpace(string(ociSSHPublicKey)),
+					"OCI_CONTROL_PLANE_MACHINE_TYPE":       ociCPShape,
+					"OCI_CONTROL_PLANE_MACHINE_TYPE_OCPUS": ociCPOcpus,
+					"OCI_NODE_MACHINE_TYPE":                ociWShape,
+					"OCI_NODE_MACHINE_TYPE_OCPUS":          ociWOcpus,
+				}
+				return nil
+			},
+			CreateCluster: func(in *clusterInstall) error {
+				// Create CAPI instance on OCI
+				_, err := capi.CreateOCIK8sInstance(in.MgmtCfg, &in.ClusterName, WorkDir, ociCredsMap, in.CapiCfg, in.HA)
+				return err
+			},
+		})
+	},
+}
+
+func init() {
+	createClusterCmd.AddCommand(ocicreateCmd)
+
+	// GitOps Controller Flag
+	addGitOpsEngineFlags(ocicreateCmd)
+	addBootstrapResourceFlags(ocicreateCmd)
+	addCreateAddOnFlags(ocicreateCmd)
+	addRolloutStrategyFlags(ocicreateCmd)
+	addCNIFlag(ocicreateCmd)
+	addFeatureGatesFlag(ocicreateCmd)
+	addKonnectivityFlags(ocicreateCmd)
+	ocicreateCmd.Flags().Bool("encrypt-secrets", false, "Encrypt secrets at rest with a key that's kept on the cluster, see rotate-encryption-key.")
+	addSizingProfileFlag(ocicreateCmd)
+	addNamedProfileFlag(ocicreateCmd)
+	ocicreateCmd.Flags().StringToString("labels", nil, "Labels to record for the cluster (key=value), for selecting it with list-clusters.")
+	ocicreateCmd.Flags().BoolP("helm-addons", "", false, "Install the CAPI Helm add-on provider (CAAPH) and install the CNI with it.")
+	ocicreateCmd.Flags().BoolP("exec-kubeconfig", "", false, "Also write a kubeconfig that gets short lived credentials from gokp instead of using the client certificate.")
+
+	// Repo specific flags
+	addGitProviderFlags(ocicreateCmd)
+	ocicreateCmd.Flags().String("cluster-name", "", "Name of your cluster.")
+	ocicreateCmd.Flags().BoolP("private-repo", "", true, "Create a private repo.")
+
+	// OCI Specific flags
+	ocicreateCmd.Flags().String("oci-region", "us-ashburn-1", "Which region to deploy to.")
+	ocicreateCmd.Flags().String("oci-tenancy-id", "", "OCID of your tenancy.")
+	ocicreateCmd.Flags().String("oci-user-id", "", "OCID of the user the API signing key belongs to.")
+	ocicreateCmd.Flags().String("oci-fingerprint", "", "Fingerprint of the API signing key.")
+	ocicreateCmd.Flags().String("oci-private-key", os.Getenv("HOME")+"/.oci/oci_api_key.pem", "Path to the private API signing key.")
+	ocicreateCmd.Flags().String("oci-private-key-passphrase", "", "Passphrase of the private API signing key, if it has one.")
+	ocicreateCmd.Flags().String("oci-compartment-id", "", "OCID of the compartment to create the cluster in.")
+	ocicreateCmd.Flags().String("oci-image-id", "", "OCID of the Cluster API image for the instances.")
+	ocicreateCmd.Flags().String("oci-ssh-key", "", "Path to the SSH public key to put on the instances.")
+	ocicreateCmd.Flags().String("oci-control-plane-shape", "VM.Standard.E4.Flex", "The OCI shape for the Control Plane")
+	ocicreateCmd.Flags().String("oci-control-plane-ocpus", "1", "The number of OCPUs of the Control Plane instances (for flexible shapes)")
+	ocicreateCmd.Flags().String("oci-node-shape", "VM.Standard.E4.Flex", "The OCI shape for the Worker instances")
+	ocicreateCmd.Flags().String("oci-node-ocpus", "1", "The number of OCPUs of the Worker instances (for flexible shapes)")
+
+	// require the following flags
+	ocicreateCmd.MarkFlagRequired("cluster-name")
+	ocicreateCmd.MarkFlagRequired("oci-tenancy-id")
+	ocicreateCmd.MarkFlagRequired("oci-user-id")
+	ocicreateCmd.MarkFlagRequired("oci-compartment-id")
+	ocicreateCmd.MarkFlagRequired("oci-image-id")
+}
@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"strings"
+
+	"github.com/christianh814/gokp/cmd/capi"
+	"github.com/spf13/cobra"
+)
+
+// proxmoxcreateCmd represents the proxmox create command
+var proxmoxcreateCmd = &cobra.Command{
+	Use:   "proxmox",
+	Short: "Creates a GOKP Cluster on Proxmox VE",
+	Long: `Create a GOKP Cluster on Proxmox VE with CAPMOX. The VMs are cloned from
+the given template (one built for Cluster API with image-builder) and get
+their IPs from the given range. The control plane endpoint is a virtual IP
+(with kube-vip), so it has to be outside of that range. For example:
+
+gokp create-cluster proxmox --cluster-name=mycluster \
+--github-token=githubtoken \
+--proxmox-url=https://pve.example.com:8006 \
+--proxmox-token='root@pam!capi' \
+--proxmox-secret=tokensecret \
+--proxmox-source-node=pve1 \
+--proxmox-template-vmid=9000 \
+--control-plane-endpoint-ip=10.10.10.9 \
+--node-ip-ranges=10.10.10.10-10.10.10.20 \
+--gateway=10.10.10.1 \
+--private-repo=true`,
+	Run: func(cmd *cobra.Command, args []string) {
+		var proxmoxCredsMap map[string]string
+		runInstall(cmd, installHooks{
+			Provider:       "proxmox",
+			Credentials:    []string{"proxmox-secret"},
+			SizingProfiles: true,
+			MoveProvider:   "capmox",
+			Configure: func(in *clusterInstall) error {
+				// Grab Proxmox related flags
+				proxmoxURL, _ := cmd.Flags().GetString("proxmox-url")
+				proxmoxToken, _ := cmd.Flags().GetString("proxmox-token")
+				proxmoxSecret, _ := cmd.Flags().GetString("proxmox-secret")
+				proxmoxSourceNode, _ := cmd.Flags().GetString("proxmox-source-node")
+				proxmoxTemplateVMID, _ := cmd.Flags().GetString("proxmox-template-vmid")
+				proxmoxAllowedNodes, _ := cmd.Flags().GetStringSlice("proxmox-allowed-nodes")
+				capi.ProxmoxStorage, _ = cmd.Flags().GetString("proxmox-storage")
+				proxmoxBridge, _ := cmd.Flags().GetString("proxmox-bridge")
+				proxmoxCores, _ := cmd.Flags().GetString("proxmox-cores")
+				proxmoxMemory, _ := cmd.Flags().GetString("proxmox-memory-mib")
+				proxmoxDiskSize, _ := cmd.Flags().GetString("proxmox-disk-size")
+				cpEndpointIP, _ := cmd.Flags().GetString("control-plane-endpoint-ip")
+				nodeIPRanges, _ := cmd.Flags().GetString("node-ip-ranges")
+				gateway, _ := cmd.Flags().GetString("gateway")
+				ipPrefix, _ := cmd.Flags().GetString("ip-prefix")
+				dnsServers, _ := cmd.Flags().GetStringSlice("dns-servers")
+				proxmoxSSHKey, _ := cmd.Flags().GetString("proxmox-ssh-key")
+
+				// The source node is what the state keeps as the region
+				in.Region = proxmoxSourceNode
+
+				// VMs are only put on the node the template is on, unless told otherwise
+				if len(proxmoxAllowedNodes) == 0 {
+					proxmoxAllowedNodes = []string{proxmoxSourceNode}
+				}
+
+				// CAPMOX takes the key itself, not the file it's in
+				proxmoxSSHPublicKey := []byte{}
+				if proxmoxSSHKey != "" {
+					var err error
+					proxmoxSSHPublicKey, err = ioutil.ReadFile(proxmoxSSHKey)
+					if err != nil {
+						return err
+					}
+				}
+
+				// Lists are given to the template as YAML flow sequences
+				proxmoxCredsMap = map[string]string{
+					"PROXMOX_URL":               proxmoxURL,
+					"PROXMOX_TOKEN":             proxmoxToken,
+					"PROXMOX_SECRET":            proxmoxSecret,
+					"PROXMOX_SOURCENODE":        proxmoxSourceNode,
+					"TEMPLATE_VMID":             proxmoxTemplateVMID,
+					"ALLOWED_NODES":             "[" + strings.Join(proxmoxAllowedNodes, ",") + "]",
+					"BRIDGE":                    proxmoxBridge,
+					"NUM_SOCKETS":               "1",
+					"NUM_CORES":                 proxmoxCores,
+					"MEMORY_MIB":                proxmoxMemory,
+					"BOOT_VOLUME_DEVICE":        "scsi0",
+					"BOOT_VOLUME_SIZE":          proxmoxDiskSize,
+					"CONTROL_PLANE_ENDPOINT_IP": cpEndpointIP,
+					"NODE_IP_RANGES":            "[" + nodeIPRanges + "]",
+					"GATEWAY":                   gateway,
+					"IP_PREFIX":                 ipPrefix,
+					"DNS_SERVERS":               "[" + strings.Join(dnsServers, ",") + "]",
+					"VM_SSH_KEYS":               strings.TrimSpace(string(proxmoxSSHPublicKey)),
+				}
+				return nil
+			},
+			CreateCluster: func(in *clusterInstall) error {
+				// Create CAPI instance on Proxmox
+				_, err := capi.CreateProxmoxK8sInstance(in.MgmtCfg, &in.ClusterName, WorkDir, proxmoxCredsMap, in.CapiCfg, in.HA)
+				return err
+			},
+		})
+	},
+}
+
+func init() {
+	createClusterCmd.AddCommand(proxmoxcreateCmd)
+
+	// GitOps Controller Flag
+	addGitOpsEngineFlags(proxmoxcreateCmd)
+	addBootstrapResourceFlags(proxmoxcreateCmd)
+	addCreateAddOnFlags(proxmoxcreateCmd)
+	addRolloutStrategyFlags(proxmoxcreateCmd)
+	addCNIFlag(proxmoxcreateCmd)
+	addFeatureGatesFlag(proxmoxcreateCmd)
+	addKonnectivityFlags(proxmoxcreateCmd)
+	proxmoxcreateCmd.Flags().Bool("encrypt-secrets", false, "Encrypt secrets at rest with a key that's kept on the cluster, see rotate-encryption-key.")
+	addSizingProfileFlag(proxmoxcreateCmd)
+	addNamedProfileFlag(proxmoxcreateCmd)
+	proxmoxcreateCmd.Flags().StringToString("labels", nil, "Labels to record for the cluster (key=value), for selecting it with list-clusters.")
+	proxmoxcreateCmd.Flags().BoolP("helm-addons", "", false, "Install the CAPI Helm add-on provider (CAAPH) and install the CNI with it.")
+	proxmoxcreateCmd.Flags().BoolP("exec-kubeconfig", "", false, "Also write a kubeconfig that gets short lived credentials from gokp instead of using the client certificate.")
+
+	// Repo specific flags
+	addGitProviderFlags(proxmoxcreateCmd)
+	proxmoxcreateCmd.Flags().String("cluster-name", "", "Name of your cluster.")
+	proxmoxcreateCmd.Flags().BoolP("private-repo", "", true, "Create a private repo.")
+
+	// Proxmox Specific flags
+	proxmoxcreateCmd.Flags().String("proxmox-url", "", "URL of the Proxmox VE API (e.g. https://pve.example.com:8006).")
+	proxmoxcreateCmd.Flags().String("proxmox-token", "", "ID of the Proxmox API token (e.g. root@pam!capi).")
+	proxmoxcreateCmd.Flags().String("proxmox-secret", "", "Secret of the Proxmox API token.")
+	proxmoxcreateCmd.Flags().String("proxmox-source-node", "", "The Proxmox node the template is on.")
+	proxmoxcreateCmd.Flags().String("proxmox-template-vmid", "", "VMID of the template the VMs are cloned from.")
+	proxmoxcreateCmd.Flags().StringSlice("proxmox-allowed-nodes", []string{}, "The Proxmox nodes the VMs can go on (defaults to the source node).")
+	proxmoxcreateCmd.Flags().String("proxmox-storage", "", "The storage the disks of the VMs are cloned to (defaults to the one of the template).")
+	proxmoxcreateCmd.Flags().String("proxmox-bridge", "vmbr0", "The bridge the VMs are connected to.")
+	proxmoxcreateCmd.Flags().String("proxmox-cores", "2", "The number of cores of the VMs")
+	proxmoxcreateCmd.Flags().String("proxmox-memory-mib", "4096", "The memory of the VMs in MiB")
+	proxmoxcreateCmd.Flags().String("proxmox-disk-size", "20", "The size of the disks of the VMs in GB")
+	proxmoxcreateCmd.Flags().String("control-plane-endpoint-ip", "", "The virtual IP of the control plane.")
+	proxmoxcreateCmd.Flags().String("node-ip-ranges", "", "The IPs the VMs get, as a range (e.g. 10.10.10.10-10.10.10.20) or CIDR.")
+	proxmoxcreateCmd.Flags().String("gateway", "", "The gateway of the network the VMs are on.")
+	proxmoxcreateCmd.Flags().String("ip-prefix", "24", "The prefix length of the network the VMs are on.")
+	proxmoxcreateCmd.Flags().StringSlice("dns-servers", []string{"8.8.8.8", "8.8.4.4"}, "The DNS servers of the VMs.")
+	proxmoxcreateCmd.Flags().String("proxmox-ssh-key", "", "Path to the SSH public key to put on the VMs.")
+
+	// require the following flags
+	proxmoxcreateCmd.MarkFlagRequired("cluster-name")
+	proxmoxcreateCmd.MarkFlagRequired("proxmox-url")
+	proxmoxcreateCmd.MarkFlagRequired("proxmox-token")
+	proxmoxcreateCmd.MarkFlagRequired("proxmox-source-node")
+	proxmoxcreateCmd.MarkFlagRequired("proxmox-template-vmid")
+	proxmoxcreateCmd.MarkFlagRequired("control-plane-endpoint-ip")
+	proxmoxcreateCmd.MarkFlagRequired("node-ip-ranges")
+	proxmoxcreateCmd.MarkFlagRequired("gateway")
+}
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/christianh814/gokp/cmd/acceptance"
+	"github.com/christianh814/gokp/cmd/argo"
+	"github.com/christianh814/gokp/cmd/state"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// createResult is what's printed with --output=json once a cluster is created, for CI pipelines. Timings are in
+// seconds, for each phase of the install that ran
+type createResult struct {
+	ClusterName      string             `json:"clusterName"`
+	Provider         string             `json:"provider"`
+	ArtifactsDir     string             `json:"artifactsDir"`
+	Kubeconfig       string             `json:"kubeconfig"`
+	ExecKubeconfig   string             `json:"execKubeconfig,omitempty"`
+	GitOpsRepo       string             `json:"gitOpsRepo"`
+	GitOpsController string             `json:"gitOpsController"`
+	ArgoCDURL        string             `json:"argoCDURL,omitempty"`
+	ArgoCDPassword   string             `json:"argoCDPassword,omitempty"`
+	AcceptanceTests  string             `json:"acceptanceTests,omitempty"`
+	PhaseSeconds     map[string]float64 `json:"phaseSeconds,omitempty"`
+	DurationSeconds  float64            `json:"durationSeconds"`
+}
+
+// installStarted is when the install (or adoption) of the cluster started
+var installStarted time.Time = time.Now()
+
+// phaseSeconds is how long each phase of the install that ran took
+var phaseSeconds = map[string]float64{}
+
+// addResultOutputFlag adds the flag that picks how the result of a command is printed
+func addResultOutputFlag(c *cobra.Command) {
+	c.PersistentFlags().StringP("output", "o", "text", "How to print the result (text, or json on stdout with the logs on stderr).")
+}
+
+// checkResultOutputFlag makes sure the output format is known before anything is done
+func checkResultOutputFlag(cmd *cobra.Command) error {
+	output, _ := cmd.Flags().GetString("output")
+	if output != "text" && output != "json" {
+		return errors.New("unrecognized output format " + output + " (use text or json)")
+	}
+	return nil
+}
+
+// reportClusterCreated says what was created for the cluster, as log messages or as JSON on stdout. What it reports
+// comes from the state that was saved for the cluster
+func reportClusterCreated(cmd *cobra.Command, clusterName string, verb string, argocdPassword string) error {
+	output, _ := cmd.Flags().GetString("output")
+	if output != "json" {
+		log.Info("Cluster Successfully ", verb, "! Everything you need is under: ~/.gokp/", clusterName)
+		if argocdPassword != "" {
+			log.Info("Argo CD admin password: ", argocdPassword)
+		}
+		return nil
+	}
+
+	st, err := state.Load(state.ArtifactsDir(clusterName))
+	if err != nil {
+		return err
+	}
+	r := &createResult{
+		ClusterName:      clusterName,
+		Provider:         st.Provider,
+		ArtifactsDir:     state.ArtifactsDir(clusterName),
+		Kubeconfig:       state.ArtifactsDir(clusterName) + "/" + clusterName + ".kubeconfig",
+		GitOpsRepo:       st.GitOpsRepo,
+		GitOpsController: st.GitOpsController,
+		ArgoCDPassword:   argocdPassword,
+		PhaseSeconds:     phaseSeconds,
+		DurationSeconds:  time.Since(installStarted).Round(time.Second).Seconds(),
+	}
+	if _, err := os.Stat(state.ArtifactsDir(clusterName) + "/" + clusterName + "-exec.kubeconfig"); err == nil {
+		r.ExecKubeconfig = state.ArtifactsDir(clusterName) + "/" + clusterName + "-exec.kubeconfig"
+	}
+	if dir, _ := cmd.Flags().GetString("acceptance-tests"); dir != "" {
+		r.AcceptanceTests = state.ArtifactsDir(clusterName) + "/" + acceptance.ResultsFile
+	}
+	if st.GitOpsController == "argocd" {
+		// Not knowing the URL is no reason to fail a cluster that's up
+		r.ArgoCDURL, err = argo.ServerURL(r.Kubeconfig)
+		if err != nil {
+			log.Warn("Unable to find the URL of Argo CD: ", err)
+		}
+	}
+
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(b))
+	return nil
+}
@@ -1,19 +1,59 @@
 package cmd
 
 import (
+	"errors"
 	"os"
 
+	"github.com/christianh814/gokp/cmd/capi"
+	"github.com/christianh814/gokp/cmd/externaldns"
+	"github.com/christianh814/gokp/cmd/kind"
+	"github.com/christianh814/gokp/cmd/state"
+	"github.com/christianh814/gokp/cmd/utils"
+	"github.com/christianh814/gokp/cmd/velero"
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
+// capiImplementations maps the providers GOKP installs on to the CAPI implementation that manages them
+var capiImplementations = map[string]string{
+	"aws":      "capa",
+	"azure":    "capz",
+	"oci":      "capoci",
+	"ibmcloud": "capibm",
+	"linode":   "capl",
+	"proxmox":  "capmox",
+	"metal3":   "capm3",
+}
+
 // deleteClusterCmd represents the deleteCluster command
 var deleteClusterCmd = &cobra.Command{
 	Use:     "delete-cluster",
 	Aliases: []string{"deleteCluster"},
 	Short:   "Deletes a gokp cluster",
 	Long: `This will delete your cluster based on the kubeconfig file
-and name you pass it. This only deletes the cluster and not the git repo.`,
+and name you pass it. This only deletes the cluster and not the git repo.
+
+With just the name of the cluster, the provider and kubeconfig are taken
+from what was saved under ~/.gokp at install time. The CAPI resources are
+moved to a temporary control plane, the cluster is deleted (waiting for its
+cloud resources to be removed), and ~/.gokp/<cluster> is cleaned up. On AWS,
+the CloudFormation stack with the IAM resources of CAPA, and the SSH key, are
+deleted too if the install created them and no other cluster uses them. For
+example:
+
+gokp delete-cluster --cluster-name=mycluster
+gokp delete-cluster --cluster-name=mycluster --keep-artifacts`,
+	Annotations: map[string]string{stateLockAnnotation: "true"},
 	Run: func(cmd *cobra.Command, args []string) {
+		clusterName, _ := cmd.Flags().GetString("cluster-name")
+		if clusterName != "" {
+			err := deleteClusterFromState(cmd, clusterName)
+			if err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+
 		// Show help if a subcommand isn't supplied
 		if len(args) == 0 {
 			cmd.Help()
@@ -36,4 +76,160 @@ and name you pass it. This only deletes the cluster and not the git repo.`,
 
 func init() {
 	rootCmd.AddCommand(deleteClusterCmd)
+
+	deleteClusterCmd.Flags().String("cluster-name", "", "Name of the gokp cluster.")
+	deleteClusterCmd.Flags().String("kubeconfig", "", "Path to the Kubeconfig file of the gokp cluster (defaults to the one under ~/.gokp).")
+	deleteClusterCmd.Flags().Bool("keep-artifacts", false, "Keep ~/.gokp/<cluster> after the cluster is deleted.")
+	deleteClusterCmd.Flags().String("aws-access-key", "", "Your AWS Access Key, to delete the IAM resources of the cluster (defaults to the secret store, then the AWS credential chain).")
+	deleteClusterCmd.Flags().String("aws-secret-key", "", "Your AWS Secret Key, to delete the IAM resources of the cluster (defaults to the secret store, then the AWS credential chain).")
+}
+
+// deleteClusterFromState deletes the cluster on the provider recorded in its state and cleans up its artifacts
+func deleteClusterFromState(cmd *cobra.Command, clusterName string) error {
+	CapiCfg, _ := cmd.Flags().GetString("kubeconfig")
+	keepArtifacts, _ := cmd.Flags().GetBool("keep-artifacts")
+
+	err := loadSecretFlags(cmd)
+	if err != nil {
+		return err
+	}
+
+	st, err := state.Load(state.ArtifactsDir(clusterName))
+	if os.IsNotExist(err) {
+		return errors.New("no state found for " + clusterName + ", use \"gokp delete-cluster <provider>\" instead")
+	}
+	if err != nil {
+		return err
+	}
+	if len(st.StoppedInstances) > 0 {
+		return errors.New("the control plane of " + clusterName + " is stopped, run \"gokp resume\" first")
+	}
+
+	// Default to the kubeconfig that was saved at install time
+	if CapiCfg == "" {
+		CapiCfg, err = clusterSecretFile(clusterName, clusterName+".kubeconfig")
+		if err != nil {
+			return err
+		}
+	}
+
+	if st.Provider == "development" {
+		log.Info("Deleting development cluster " + clusterName)
+		err = kind.DeleteKindCluster(clusterName, CapiCfg)
+	} else if st.Provider == "byoh" {
+		err = deleteBYOHCluster(clusterName)
+	} else if st.ManagementKubeconfig != "" {
+		// Clusters managed from elsewhere are deleted there, there's nothing to move
+		log.Info("Deleteing cluster: " + clusterName)
+		_, err = capi.DeleteCluster(st.ManagementKubeconfig, clusterName)
+	} else if capiImplementation, ok := capiImplementations[st.Provider]; ok {
+		err = deleteCAPICluster(clusterName, CapiCfg, capiImplementation)
+	} else {
+		err = errors.New("unknown provider " + st.Provider + " for " + clusterName)
+	}
+	if err != nil {
+		return err
+	}
+
+	// The IAM user of external-dns outlives the cluster otherwise
+	awsAccessKey, _ := cmd.Flags().GetString("aws-access-key")
+	awsSecretKey, _ := cmd.Flags().GetString("aws-secret-key")
+	if st.ExternalDNSZone != "" {
+		err = externaldns.DeleteAWSCredentials(clusterName, awsAccessKey, awsSecretKey)
+		if err != nil {
+			log.Warn("Unable to delete IAM user ", externaldns.UserName(clusterName), ", delete it by hand: ", err)
+		}
+	}
+
+	// So does the one of Velero. The backups are kept, they're what the cluster would be restored from
+	if st.BackupBucket != "" {
+		err = velero.DeleteAWSCredentials(clusterName, st.Region, awsAccessKey, awsSecretKey)
+		if err != nil {
+			log.Warn("Unable to delete IAM user ", velero.UserName(clusterName), ", delete it by hand: ", err)
+		}
+		log.Info("The backups of ", clusterName, " are kept in s3://", st.BackupBucket, "/", clusterName)
+	}
+
+	// And the security group of the API server, now that its load balancer is gone
+	if st.AWSSecurityGroup != "" {
+		err = capi.DeleteAWSAPIServerSecurityGroup(st.Region, awsAccessKey, awsSecretKey, st.AWSSecurityGroup)
+		if err != nil {
+			log.Warn("Unable to delete security group ", st.AWSSecurityGroup, ", delete it by hand: ", err)
+		}
+	}
+
+	// And the SSH key, if GOKP created it and no other cluster uses it
+	if st.AWSSSHKey != "" {
+		err = capi.ReleaseAWSSSHKey(st.Region, awsAccessKey, awsSecretKey, st.AWSSSHKey, clusterName)
+		if err != nil {
+			log.Warn("Unable to release SSH key ", st.AWSSSHKey, ": ", err)
+		}
+	}
+
+	// So does the CloudFormation stack the install created, unless other clusters use it
+	if st.AWSStack != nil && st.AWSStack.Created {
+		err = releaseAWSStack(clusterName, st.AWSStack, awsAccessKey, awsSecretKey)
+		if err != nil {
+			log.Warn("Unable to delete CloudFormation stack ", st.AWSStack.Name, ", delete it with \"gokp aws cleanup-iam\": ", err)
+		}
+	}
+
+	// The rest of the team shouldn't see the cluster anymore
+	if state.Shared != nil && state.ReadOnly {
+		log.Warn("The shared state is read only, ", clusterName, " is still in it")
+	}
+	err = state.Remove(clusterName)
+	if err != nil {
+		return err
+	}
+
+	// Everything that was saved for the cluster is of no use anymore
+	if !keepArtifacts {
+		log.Info("Removing ~/.gokp/" + clusterName)
+		err = os.RemoveAll(state.ArtifactsDir(clusterName))
+		if err != nil {
+			return err
+		}
+	}
+
+	// If we're here, the cluster should be deleted
+	log.Info("Cluster " + clusterName + " successfully deleted")
+	return nil
+}
+
+// deleteCAPICluster moves the CAPI resources of the cluster to a temporary control plane and deletes the cluster
+// from there, waiting for its cloud resources to be removed
+func deleteCAPICluster(clusterName string, CapiCfg string, capiImplementation string) error {
+	// Create workdir and set variables
+	WorkDir, _ = utils.CreateWorkDir()
+	KindCfg = WorkDir + "/" + "kind.kubeconfig"
+	tcpName := "gokp-bootstrapper"
+
+	// cleanup workdir at the end
+	defer os.RemoveAll(WorkDir)
+
+	// Create KIND cluster
+	log.Info("Creating temporary control plane")
+	err := kind.CreateKindCluster(tcpName, KindCfg)
+	if err != nil {
+		return err
+	}
+
+	// Move Capi components to the KIND cluster
+	log.Info("Moving CAPI Artifacts to the tempoary control plane")
+	_, err = capi.MoveMgmtCluster(CapiCfg, KindCfg, capiImplementation)
+	if err != nil {
+		return err
+	}
+
+	// Delete cluster
+	log.Info("Deleteing cluster: " + clusterName)
+	_, err = capi.DeleteCluster(KindCfg, clusterName)
+	if err != nil {
+		return err
+	}
+
+	// Delete local Kind Cluster
+	log.Info("Deleting temporary control plane")
+	return kind.DeleteKindCluster(tcpName, KindCfg)
 }
@@ -1,11 +1,6 @@
 package cmd
 
 import (
-	"os"
-
-	"github.com/christianh814/gokp/cmd/capi"
-	"github.com/christianh814/gokp/cmd/kind"
-	"github.com/christianh814/gokp/cmd/utils"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
@@ -18,44 +13,13 @@ var azureDeleteCmd = &cobra.Command{
 based on the kubeconfig file and name you pass it.
 
 This only deletes the cluster and not the git repo.`,
+	Annotations: map[string]string{stateLockAnnotation: "true"},
 	Run: func(cmd *cobra.Command, args []string) {
-		// Create workdir and set variables
-		WorkDir, _ = utils.CreateWorkDir()
-		KindCfg = WorkDir + "/" + "kind.kubeconfig"
-		tcpName := "gokp-bootstrapper"
-
-		// cleanup workdir at the end
-		defer os.RemoveAll(WorkDir)
-
 		// Grab flags
 		clusterName, _ := cmd.Flags().GetString("cluster-name")
 		CapiCfg, _ := cmd.Flags().GetString("kubeconfig")
 
-		// Create KIND cluster
-		log.Info("Creating temporary control plane")
-		err := kind.CreateKindCluster(tcpName, KindCfg)
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		// Move Capi components to the KIND cluster
-		log.Info("Moving CAPI Artifacts to the tempoary control plane")
-		_, err = capi.MoveMgmtCluster(CapiCfg, KindCfg, "capz")
-		if err != nil {
-			log.Fatal(err)
-
-		}
-
-		// Delete cluster
-		log.Info("Deleteing cluster: " + clusterName)
-		_, err = capi.DeleteCluster(KindCfg, clusterName)
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		// Delete local Kind Cluster
-		log.Info("Deleting temporary control plane")
-		err = kind.DeleteKindCluster(tcpName, KindCfg)
+		err := deleteCAPICluster(clusterName, CapiCfg, "capz")
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"github.com/christianh814/gokp/cmd/byoh"
+	"github.com/christianh814/gokp/cmd/state"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// byohDeleteCmd represents the byoh delete command
+var byohDeleteCmd = &cobra.Command{
+	Use:   "byoh",
+	Short: "Deletes a GOKP cluster running on existing hosts",
+	Long: `This will delete your cluster that is running on existing hosts with
+BYOH, based on the name you pass it. There's nothing to give the hosts back
+to, so kubeadm and the host agent are removed from each of them over SSH,
+using the hosts and SSH settings saved under ~/.gokp at install time.
+
+This only deletes the cluster and not the git repo.`,
+	Annotations: map[string]string{stateLockAnnotation: "true"},
+	Run: func(cmd *cobra.Command, args []string) {
+		// Grab flags
+		clusterName, _ := cmd.Flags().GetString("cluster-name")
+
+		err := deleteBYOHCluster(clusterName)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// If we're here, the cluster should be deleted
+		log.Info("Cluster " + clusterName + " successfully deleted")
+
+	},
+}
+
+func init() {
+	deleteClusterCmd.AddCommand(byohDeleteCmd)
+
+	// Define flags for delete-cluster
+	byohDeleteCmd.Flags().String("cluster-name", "", "Name of the gokp cluster.")
+
+	// all flags required
+	byohDeleteCmd.MarkFlagRequired("cluster-name")
+
+}
+
+// deleteBYOHCluster resets the hosts of the cluster that were saved at install time
+func deleteBYOHCluster(clusterName string) error {
+	hosts, err := byoh.LoadHosts(state.ArtifactsDir(clusterName))
+	if err != nil {
+		return err
+	}
+
+	log.Info("Deleteing cluster: " + clusterName)
+	return hosts.Reset()
+}
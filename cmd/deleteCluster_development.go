@@ -16,6 +16,7 @@ var developmentDeleteCmd = &cobra.Command{
 	Short:   "Deletes the gokp development cluster",
 	Long: `This will delete your development cluster based on the kubeconfig file
 and name you pass it. This only deletes the local development cluster and not the git repo.`,
+	Annotations: map[string]string{stateLockAnnotation: "true"},
 	Run: func(cmd *cobra.Command, args []string) {
 		// Create workdir and set variables
 		WorkDir, _ = utils.CreateWorkDir()
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"github.com/christianh814/gokp/cmd/capi"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// kubevirtDeleteCmd represents the kubevirt delete command
+var kubevirtDeleteCmd = &cobra.Command{
+	Use:   "kubevirt",
+	Short: "Deletes a GOKP cluster of KubeVirt VMs",
+	Long: `This will delete your cluster of KubeVirt VMs from the management
+cluster it was created on, based on the kubeconfig file of that cluster and
+the name you pass it.
+
+This only deletes the cluster and not the git repo.`,
+	Annotations: map[string]string{stateLockAnnotation: "true"},
+	Run: func(cmd *cobra.Command, args []string) {
+		// Grab flags
+		clusterName, _ := cmd.Flags().GetString("cluster-name")
+		mgmtKubeconfig, _ := cmd.Flags().GetString("management-kubeconfig")
+
+		// Make sure it's the management cluster that was meant
+		err := checkGuardrails(cmd, mgmtKubeconfig, "", "delete "+clusterName+" from it")
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// The CAPI objects never left the management cluster, so there's nothing to move
+		log.Info("Deleteing cluster: " + clusterName)
+		_, err = capi.DeleteCluster(mgmtKubeconfig, clusterName)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// If we're here, the cluster should be deleted
+		log.Info("Cluster " + clusterName + " successfully deleted")
+
+	},
+}
+
+func init() {
+	deleteClusterCmd.AddCommand(kubevirtDeleteCmd)
+
+	// Define flags for delete-cluster
+	kubevirtDeleteCmd.Flags().String("management-kubeconfig", "", "Path to the Kubeconfig file of the cluster the VMs are on")
+	kubevirtDeleteCmd.Flags().String("cluster-name", "", "Name of the gokp cluster.")
+	addGuardrailFlags(kubevirtDeleteCmd)
+
+	// all flags required
+	kubevirtDeleteCmd.MarkFlagRequired("management-kubeconfig")
+	kubevirtDeleteCmd.MarkFlagRequired("cluster-name")
+
+}
@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// metal3DeleteCmd represents the metal3 delete command
+var metal3DeleteCmd = &cobra.Command{
+	Use:   "metal3",
+	Short: "Deletes a GOKP cluster running on bare metal with Metal3",
+	Long: `This will delete your cluster that is running on bare metal with Metal3
+based on the kubeconfig file and name you pass it.
+
+The hosts are deprovisioned, but stay registered with the Bare Metal Operator.
+This only deletes the cluster and not the git repo.`,
+	Annotations: map[string]string{stateLockAnnotation: "true"},
+	Run: func(cmd *cobra.Command, args []string) {
+		// Grab flags
+		clusterName, _ := cmd.Flags().GetString("cluster-name")
+		CapiCfg, _ := cmd.Flags().GetString("kubeconfig")
+
+		err := deleteCAPICluster(clusterName, CapiCfg, "capm3")
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// If we're here, the cluster should be deleted
+		log.Info("Cluster " + clusterName + " successfully deleted")
+
+	},
+}
+
+func init() {
+	deleteClusterCmd.AddCommand(metal3DeleteCmd)
+
+	// Define flags for delete-cluster
+	metal3DeleteCmd.Flags().String("kubeconfig", "", "Path to the Kubeconfig file of the gokp cluster")
+	metal3DeleteCmd.Flags().String("cluster-name", "", "Name of the gokp cluster.")
+
+	// all flags required
+	metal3DeleteCmd.MarkFlagRequired("kubeconfig")
+	metal3DeleteCmd.MarkFlagRequired("cluster-name")
+
+}
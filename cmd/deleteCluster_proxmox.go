@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// proxmoxDeleteCmd represents the proxmox delete command
+var proxmoxDeleteCmd = &cobra.Command{
+	Use:   "proxmox",
+	Short: "Deletes a GOKP cluster running on Proxmox VE",
+	Long: `This will delete your cluster that is running on Proxmox VE
+based on the kubeconfig file and name you pass it.
+
+This only deletes the cluster and not the git repo.`,
+	Annotations: map[string]string{stateLockAnnotation: "true"},
+	Run: func(cmd *cobra.Command, args []string) {
+		// Grab flags
+		clusterName, _ := cmd.Flags().GetString("cluster-name")
+		CapiCfg, _ := cmd.Flags().GetString("kubeconfig")
+
+		err := deleteCAPICluster(clusterName, CapiCfg, "capmox")
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// If we're here, the cluster should be deleted
+		log.Info("Cluster " + clusterName + " successfully deleted")
+
+	},
+}
+
+func init() {
+	deleteClusterCmd.AddCommand(proxmoxDeleteCmd)
+
+	// Define flags for delete-cluster
+	proxmoxDeleteCmd.Flags().String("kubeconfig", "", "Path to the Kubeconfig file of the gokp cluster")
+	proxmoxDeleteCmd.Flags().String("cluster-name", "", "Name of the gokp cluster.")
+
+	// all flags required
+	proxmoxDeleteCmd.MarkFlagRequired("kubeconfig")
+	proxmoxDeleteCmd.MarkFlagRequired("cluster-name")
+
+}
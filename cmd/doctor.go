@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"os/exec"
+
+	"github.com/christianh814/gokp/cmd/kind"
+	"github.com/christianh814/gokp/cmd/prereqs"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// doctorCmd represents the doctor command
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Checks that this machine has what gokp needs",
+	Long: `Checks that the CLI tools gokp uses are installed and that Docker is running,
+then runs the prereq checks that were added, which create-cluster also runs
+before anything is created.
+
+Checks can be added under "prereqChecks" in the config file. They either run
+a command, which passes if it exits with 0, or GET a URL, which passes with a
+2xx (or expectStatus). With match, the output (or the body) has to match the
+regexp too. Optional checks only warn:
+
+prereqChecks:
+  - name: terraform
+    exec: ["terraform", "version"]
+    match: 'v1\.[5-9]'
+  - name: vpn
+    http: https://intranet.example.com/healthz
+    timeout: 5s
+  - name: artifactory
+    http: https://artifactory.example.com/api/system/ping
+    expectStatus: 200
+    optional: true
+
+Every executable in ~/.gokp/checks.d is a check too, named after the file.
+Checks get the name of the cluster and the GitOps controller in
+GOKP_CLUSTER_NAME and GOKP_GITOPS_CONTROLLER when a cluster is created. For
+example:
+
+gokp doctor`,
+	Run: func(cmd *cobra.Command, args []string) {
+		checks := []preflightCheck{}
+		for _, cli := range []string{"kubectl", "docker", "git"} {
+			cli := cli
+			checks = append(checks, preflightCheck{Name: cli, Run: func() (string, error) {
+				return exec.LookPath(cli)
+			}})
+		}
+		checks = append(checks, preflightCheck{Name: "Docker Daemon", Run: kind.CheckDocker})
+		checks = append(checks, customPreflightChecks(map[string]string{})...)
+
+		err := runPreflightChecks(checks)
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+}
+
+// customPreflightChecks returns the prereq checks that were added, to run with the environment variables given
+func customPreflightChecks(env map[string]string) []preflightCheck {
+	checks := []preflightCheck{}
+	for _, c := range prereqs.Custom {
+		c := c
+		checks = append(checks, preflightCheck{Name: c.Name, Optional: c.Optional, Run: func() (string, error) {
+			return c.Run(env)
+		}})
+	}
+	return checks
+}
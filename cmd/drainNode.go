@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"errors"
+	"time"
+
+	"github.com/christianh814/gokp/cmd/machine"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// drainNodeCmd represents the drain-node command
+var drainNodeCmd = &cobra.Command{
+	Use:     "drain-node",
+	Aliases: []string{"drainNode"},
+	Short:   "Drains the node of a machine of a gokp cluster",
+	Long: `Cordons and drains the node of a CAPI machine of a gokp cluster, then marks
+the machine to be the first one removed when its MachineDeployment scales
+down. With --replace the machine is deleted instead, and CAPI creates a new
+one in its place. For example:
+
+gokp drain-node --cluster-name=mycluster --machine=mycluster-md-0-7c9d8f-x2x4q
+gokp drain-node --cluster-name=mycluster --machine=mycluster-md-0-7c9d8f-x2x4q --replace
+
+Only workers can be drained this way, use renew-certs to replace the
+control plane.`,
+	Annotations: map[string]string{stateLockAnnotation: "true"},
+	Run: func(cmd *cobra.Command, args []string) {
+		// Grab flags
+		clusterName, _ := cmd.Flags().GetString("cluster-name")
+		CapiCfg, _ := cmd.Flags().GetString("kubeconfig")
+		machineName, _ := cmd.Flags().GetString("machine")
+		namespace, _ := cmd.Flags().GetString("namespace")
+		replace, _ := cmd.Flags().GetBool("replace")
+		force, _ := cmd.Flags().GetBool("force")
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+
+		// Default to the kubeconfig that was saved at install time
+		var err error
+		if CapiCfg == "" {
+			CapiCfg, err = clusterSecretFile(clusterName, clusterName+".kubeconfig")
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		// The cluster manages itself, so the machine and its node are on the same cluster
+		m, err := machine.Get(CapiCfg, namespace, machineName, clusterName)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if machine.IsControlPlane(m) {
+			log.Fatal(errors.New("machine " + machineName + " is part of the control plane, which can't be drained this way"))
+		}
+		node, err := machine.NodeName(m)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		err = machine.Drain(CapiCfg, node, force, timeout)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if replace {
+			err = machine.Replace(CapiCfg, m)
+			if err != nil {
+				log.Fatal(err)
+			}
+			log.Info("Machine ", machineName, " successfully replaced")
+			return
+		}
+
+		err = machine.MarkForDeletion(CapiCfg, m)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Info("Node ", node, " drained, machine ", machineName, " goes first when its MachineDeployment scales down")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(drainNodeCmd)
+
+	drainNodeCmd.Flags().String("cluster-name", "", "Name of the gokp cluster.")
+	drainNodeCmd.Flags().String("kubeconfig", "", "Path to the Kubeconfig file of the gokp cluster (defaults to the one under ~/.gokp).")
+	drainNodeCmd.Flags().String("machine", "", "Name of the CAPI machine to drain.")
+	drainNodeCmd.Flags().String("namespace", "default", "Namespace of the CAPI machine.")
+	drainNodeCmd.Flags().Bool("replace", false, "Delete the machine once it's drained, so CAPI replaces it.")
+	drainNodeCmd.Flags().Bool("force", false, "Also delete pods that aren't managed by anything, which won't come back.")
+	drainNodeCmd.Flags().Duration("timeout", 10*time.Minute, "How long to wait for the drain before giving up.")
+
+	drainNodeCmd.MarkFlagRequired("cluster-name")
+	drainNodeCmd.MarkFlagRequired("machine")
+}
@@ -0,0 +1,45 @@
+package ebscsi
+
+import (
+	"os"
+
+	"github.com/christianh814/gokp/cmd/templates"
+	"github.com/christianh814/gokp/cmd/utils"
+)
+
+// Version is the version of the AWS EBS CSI driver that's installed
+var Version string = "v1.11.4"
+
+// StorageClassName is the name of the default StorageClass, which gives gp3 volumes
+var StorageClassName string = "gp3"
+
+// repoDir is the dir under cluster/core the EBS CSI driver is kept in
+var repoDir string = "ebs-csi"
+
+// WriteManifests writes the EBS CSI driver, with a default StorageClass of encrypted gp3 volumes, under the
+// cluster/core dir of baseDir so the GitOps controller deploys it. The controller runs on the control plane, whose
+// IAM role is allowed to manage the volumes by the CloudFormation stack CAPA is bootstrapped with
+func WriteManifests(baseDir string, region string) error {
+	dir := baseDir + "/cluster/core/" + repoDir
+	os.MkdirAll(dir, 0755)
+
+	ebsCSIVars := struct {
+		Version          string
+		Region           string
+		StorageClassName string
+	}{
+		Version:          Version,
+		Region:           region,
+		StorageClassName: StorageClassName,
+	}
+	_, err := utils.WriteTemplate(templates.EBSCSIControllerPatch, dir+"/"+"controller.yaml", ebsCSIVars)
+	if err != nil {
+		return err
+	}
+	_, err = utils.WriteTemplate(templates.EBSCSIStorageClass, dir+"/"+"storageclass.yaml", ebsCSIVars)
+	if err != nil {
+		return err
+	}
+	_, err = utils.WriteTemplate(templates.EBSCSIKustomize, dir+"/"+"kustomization.yaml", ebsCSIVars)
+	return err
+}
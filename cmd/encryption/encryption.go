@@ -0,0 +1,334 @@
+package encryption
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/yaml"
+)
+
+// Label is put on the Secrets that hold the encryption configuration, so the export of the cluster leaves them out
+// of the GitOps repo. The keys are never committed
+var Label string = "gokp.io/encryption-config"
+
+// ConfigDir is where the encryption configuration is written on the control plane nodes, and ConfigFile the file
+// the API server reads it from
+var (
+	ConfigDir  string = "/etc/kubernetes/encryption"
+	ConfigFile string = ConfigDir + "/config.yaml"
+)
+
+var kcpGVR = schema.GroupVersionResource{Group: "controlplane.cluster.x-k8s.io", Version: "v1beta1", Resource: "kubeadmcontrolplanes"}
+
+// SecretKey is the key of the Secret the encryption configuration is kept under
+var SecretKey string = "config.yaml"
+
+// Key is an AES-CBC key the secrets are encrypted with
+type Key struct {
+	Name   string `json:"name"`
+	Secret string `json:"secret"`
+}
+
+// config is the EncryptionConfiguration of the API server, with only what we use of it
+type config struct {
+	APIVersion string     `json:"apiVersion"`
+	Kind       string     `json:"kind"`
+	Resources  []resource `json:"resources"`
+}
+
+type resource struct {
+	Resources []string   `json:"resources"`
+	Providers []provider `json:"providers"`
+}
+
+type provider struct {
+	AESCBC   *aescbc                `json:"aescbc,omitempty"`
+	Identity map[string]interface{} `json:"identity,omitempty"`
+}
+
+type aescbc struct {
+	Keys []Key `json:"keys"`
+}
+
+// NewKey returns a new random 32 byte key, named after when it was made
+func NewKey() (Key, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return Key{}, err
+	}
+	return Key{Name: "key-" + strconv.FormatInt(time.Now().UnixNano(), 36), Secret: base64.StdEncoding.EncodeToString(b)}, nil
+}
+
+// Render returns the EncryptionConfiguration that encrypts new secrets with the first key and can read secrets
+// encrypted with any of them. Secrets that were stored before encryption was turned on can still be read
+func Render(keys []Key) ([]byte, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("the encryption configuration needs a key")
+	}
+	return yaml.Marshal(config{
+		APIVersion: "apiserver.config.k8s.io/v1",
+		Kind:       "EncryptionConfiguration",
+		Resources: []resource{{
+			Resources: []string{"secrets"},
+			Providers: []provider{
+				{AESCBC: &aescbc{Keys: keys}},
+				{Identity: map[string]interface{}{}},
+			},
+		}},
+	})
+}
+
+// ParseKeys returns the keys of the EncryptionConfiguration, in order
+func ParseKeys(b []byte) ([]Key, error) {
+	c := config{}
+	err := yaml.Unmarshal(b, &c)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range c.Resources {
+		for _, p := range r.Providers {
+			if p.AESCBC != nil && len(p.AESCBC.Keys) > 0 {
+				return p.AESCBC.Keys, nil
+			}
+		}
+	}
+	return nil, errors.New("no aescbc keys in the encryption configuration")
+}
+
+// NewSecret returns the Secret that holds the encryption configuration with the keys. Each one gets a new name,
+// which is what makes the KubeadmControlPlane roll out the control plane with it. The name starts with the name of
+// the cluster so "clusterctl move" takes it along with the cluster
+func NewSecret(clusterName string, namespace string, keys []Key) (*corev1.Secret, error) {
+	b, err := Render(keys)
+	if err != nil {
+		return nil, err
+	}
+	return &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterName + "-encryption-" + strconv.FormatInt(time.Now().UnixNano(), 36),
+			Namespace: namespace,
+			Labels: map[string]string{
+				"cluster.x-k8s.io/cluster-name": clusterName,
+				Label:                           "true",
+			},
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{SecretKey: b},
+	}, nil
+}
+
+// SetSecret changes the KubeadmControlPlane so the API server encrypts secrets with the encryption configuration in
+// the Secret, replacing the one it had
+func SetSecret(kcp *unstructured.Unstructured, secretName string) error {
+	extraArgs, _, err := unstructured.NestedStringMap(kcp.Object, "spec", "kubeadmConfigSpec", "clusterConfiguration", "apiServer", "extraArgs")
+	if err != nil {
+		return err
+	}
+	if extraArgs == nil {
+		extraArgs = map[string]string{}
+	}
+	extraArgs["encryption-provider-config"] = ConfigFile
+	err = unstructured.SetNestedStringMap(kcp.Object, extraArgs, "spec", "kubeadmConfigSpec", "clusterConfiguration", "apiServer", "extraArgs")
+	if err != nil {
+		return err
+	}
+
+	volume := map[string]interface{}{
+		"name":      "encryption-config",
+		"hostPath":  ConfigDir,
+		"mountPath": ConfigDir,
+		"readOnly":  true,
+		"pathType":  "DirectoryOrCreate",
+	}
+	err = setListItem(kcp, []string{"spec", "kubeadmConfigSpec", "clusterConfiguration", "apiServer", "extraVolumes"}, "name", volume)
+	if err != nil {
+		return err
+	}
+
+	file := map[string]interface{}{
+		"path":        ConfigFile,
+		"owner":       "root:root",
+		"permissions": "0600",
+		"contentFrom": map[string]interface{}{
+			"secret": map[string]interface{}{
+				"name": secretName,
+				"key":  SecretKey,
+			},
+		},
+	}
+	return setListItem(kcp, []string{"spec", "kubeadmConfigSpec", "files"}, "path", file)
+}
+
+// SecretName returns the name of the Secret the KubeadmControlPlane has the encryption configuration from, or ""
+// if secrets aren't encrypted at rest
+func SecretName(kcp *unstructured.Unstructured) string {
+	files, _, _ := unstructured.NestedSlice(kcp.Object, "spec", "kubeadmConfigSpec", "files")
+	for _, f := range files {
+		file, ok := f.(map[string]interface{})
+		if !ok || file["path"] != ConfigFile {
+			continue
+		}
+		name, _, _ := unstructured.NestedString(file, "contentFrom", "secret", "name")
+		return name
+	}
+	return ""
+}
+
+// setListItem replaces the item of the list at the fields of the object that has the same value for key, or adds
+// it to the end if there's none
+func setListItem(obj *unstructured.Unstructured, fields []string, key string, item map[string]interface{}) error {
+	list, _, err := unstructured.NestedSlice(obj.Object, fields...)
+	if err != nil {
+		return err
+	}
+	for i, l := range list {
+		if m, ok := l.(map[string]interface{}); ok && m[key] == item[key] {
+			list[i] = item
+			return unstructured.SetNestedSlice(obj.Object, list, fields...)
+		}
+	}
+	return unstructured.SetNestedSlice(obj.Object, append(list, item), fields...)
+}
+
+// ReadKeys returns the keys of the encryption configuration in the Secret on the cluster of the kubeconfig
+func ReadKeys(kubeconfig string, namespace string, name string) ([]Key, error) {
+	clientset, err := newClientset(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := clientset.CoreV1().Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return ParseKeys(secret.Data[SecretKey])
+}
+
+// CreateSecret creates the Secret on the cluster of the kubeconfig
+func CreateSecret(kubeconfig string, secret *corev1.Secret) error {
+	clientset, err := newClientset(kubeconfig)
+	if err != nil {
+		return err
+	}
+	_, err = clientset.CoreV1().Secrets(secret.Namespace).Create(context.TODO(), secret, metav1.CreateOptions{})
+	return err
+}
+
+// DeleteSecretsExcept deletes the Secrets with encryption configurations of the cluster on the cluster of the
+// kubeconfig, except the one named, and returns how many there were
+func DeleteSecretsExcept(kubeconfig string, clusterName string, namespace string, keep string) (int, error) {
+	clientset, err := newClientset(kubeconfig)
+	if err != nil {
+		return 0, err
+	}
+	secrets, err := clientset.CoreV1().Secrets(namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: Label + ",cluster.x-k8s.io/cluster-name=" + clusterName,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, s := range secrets.Items {
+		if s.Name == keep {
+			continue
+		}
+		err = clientset.CoreV1().Secrets(namespace).Delete(context.TODO(), s.Name, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// Reencrypt writes every secret of the cluster of the kubeconfig back as it is, which has the API server store it
+// encrypted with the first key. progress is told how far along it is after each one
+func Reencrypt(kubeconfig string, progress func(done int, total int)) error {
+	clientset, err := newClientset(kubeconfig)
+	if err != nil {
+		return err
+	}
+	secrets, err := clientset.CoreV1().Secrets("").List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	for i := range secrets.Items {
+		s := &secrets.Items[i]
+		_, err = clientset.CoreV1().Secrets(s.Namespace).Update(context.TODO(), s, metav1.UpdateOptions{})
+		// Secrets that were changed or deleted since they were listed were written with the first key already
+		if err != nil && !apierrors.IsConflict(err) && !apierrors.IsNotFound(err) {
+			return errors.New("unable to re-encrypt secret " + s.Namespace + "/" + s.Name + ": " + err.Error())
+		}
+		progress(i+1, len(secrets.Items))
+	}
+
+	// If we're here, we should be okay
+	return nil
+}
+
+// newClientset returns a clientset for the kubeconfig
+func newClientset(kubeconfig string) (*kubernetes.Clientset, error) {
+	cfg, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	return kubernetes.NewForConfig(cfg)
+}
+
+// PatchCluster sets the encryption configuration of the KubeadmControlPlanes on the cluster of the kubeconfig to
+// the one they have in the repo, which has them roll out their machines with it
+func PatchCluster(kubeconfig string, kcps []*unstructured.Unstructured) error {
+	cfg, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return err
+	}
+	dyn, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	for _, kcp := range kcps {
+		files, _, _ := unstructured.NestedSlice(kcp.Object, "spec", "kubeadmConfigSpec", "files")
+		apiServer, _, _ := unstructured.NestedMap(kcp.Object, "spec", "kubeadmConfigSpec", "clusterConfiguration", "apiServer")
+		patch, err := json.Marshal(map[string]interface{}{
+			"spec": map[string]interface{}{
+				"kubeadmConfigSpec": map[string]interface{}{
+					"files": files,
+					"clusterConfiguration": map[string]interface{}{
+						"apiServer": apiServer,
+					},
+				},
+			},
+		})
+		if err != nil {
+			return err
+		}
+
+		log.Info("Rolling out KubeadmControlPlane ", kcp.GetNamespace(), "/", kcp.GetName(), " with encryption configuration ", SecretName(kcp))
+		_, err = dyn.Resource(kcpGVR).Namespace(kcp.GetNamespace()).Patch(context.TODO(), kcp.GetName(), types.MergePatchType, patch, metav1.PatchOptions{})
+		if err != nil {
+			return err
+		}
+	}
+
+	// If we're here, we should be okay
+	return nil
+}
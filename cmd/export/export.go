@@ -9,6 +9,10 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/christianh814/gokp/cmd/cni"
+	"github.com/christianh814/gokp/cmd/encryption"
+	"github.com/christianh814/gokp/cmd/konnectivity"
+	"github.com/christianh814/gokp/cmd/utils"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -111,6 +115,10 @@ func ExportClusterYaml(capicfg string, repodir string, gitOpsController string)
 
 	// range through every namespace and extract the YAML
 	for _, ns := range namespaces.Items {
+		// The namespace of the CNI is in the copy of its manifest
+		if ns.Labels[cni.Label] != "" {
+			continue
+		}
 		outdir := repodir + "/cluster/core/" + ns.Name
 		// Get each namespaced api component
 		for _, nc := range namespacedApis {
@@ -224,10 +232,14 @@ func exportClusterScopedYaml(client dynamic.Interface, gr GroupResource, e *json
 
 		itemName := listItem.GetName()
 
-		// We will skip certian objects as they are managed by something else
+		// We will skip certian objects as they are managed by something else, like the CNI and konnectivity manifests.
+		// The keys secrets are encrypted with are never committed
 		if strings.Contains(itemName, "bootstrap-token") ||
 			itemName == "cluster-info" ||
-			itemName == "calico-config" {
+			itemName == "calico-config" ||
+			listItem.GetLabels()[cni.Label] != "" ||
+			listItem.GetLabels()[konnectivity.Label] != "" ||
+			listItem.GetLabels()[encryption.Label] != "" {
 			continue
 		}
 
@@ -356,7 +368,15 @@ func Myfp(s string) string {
 
 // WriteTemplateWithFunc is a generic template writing mechanism that supports template.FuncMap
 func WriteTemplateWithFunc(tpl string, fileToCreate string, vars interface{}, fm template.FuncMap) (bool, error) {
-	tmpl := template.Must(template.New("").Funcs(fm).Parse(tpl))
+	// The functions of the config file can be used too, unless fm has one by the same name
+	funcs := template.FuncMap{}
+	for name, f := range utils.TemplateFuncs {
+		funcs[name] = f
+	}
+	for name, f := range fm {
+		funcs[name] = f
+	}
+	tmpl := template.Must(template.New("").Funcs(funcs).Parse(tpl))
 
 	file, err := os.Create(fileToCreate)
 	if err != nil {
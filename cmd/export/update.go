@@ -0,0 +1,179 @@
+package export
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// UpdateExported runs update on every object of the kind that was exported under the cluster/core dir of baseDir
+// and writes back the ones it changed, which are returned. It's an error if there are no objects of the kind
+func UpdateExported(baseDir string, kind string, update func(obj *unstructured.Unstructured) (bool, error)) ([]*unstructured.Unstructured, error) {
+	files, err := filepath.Glob(baseDir + "/cluster/core/*/" + strings.ToLower(kind) + "-*.yaml")
+	if err != nil {
+		return nil, err
+	}
+
+	updated := []*unstructured.Unstructured{}
+	found := false
+	for _, file := range files {
+		obj, err := readFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if obj.GetKind() != kind {
+			continue
+		}
+		found = true
+
+		changed, err := update(obj)
+		if err != nil {
+			return nil, err
+		}
+		if !changed {
+			continue
+		}
+
+		b, err := yaml.Marshal(obj.Object)
+		if err != nil {
+			return nil, err
+		}
+		err = ioutil.WriteFile(file, b, 0644)
+		if err != nil {
+			return nil, err
+		}
+		if obj.GetNamespace() == "" {
+			obj.SetNamespace("default")
+		}
+		updated = append(updated, obj)
+	}
+
+	if !found {
+		return nil, errors.New("no " + kind + " found under " + baseDir + "/cluster/core")
+	}
+
+	// If we're here, we should be okay
+	return updated, nil
+}
+
+// ReadExported returns the object of the kind with the name that was exported under the cluster/core dir of baseDir
+func ReadExported(baseDir string, namespace string, kind string, name string) (*unstructured.Unstructured, error) {
+	obj, err := readFile(exportedFile(baseDir, namespace, kind, name))
+	if os.IsNotExist(err) {
+		return nil, errors.New(kind + " " + namespace + "/" + name + " not found under " + baseDir + "/cluster/core")
+	}
+	return obj, err
+}
+
+// WriteExported writes the object under the cluster/core dir of baseDir the way it would have been exported, and
+// adds it to the kustomization of its namespace
+func WriteExported(baseDir string, obj *unstructured.Unstructured) error {
+	if obj.GetNamespace() == "" {
+		return errors.New(obj.GetKind() + " " + obj.GetName() + " has no namespace")
+	}
+	file := exportedFile(baseDir, obj.GetNamespace(), obj.GetKind(), obj.GetName())
+	b, err := yaml.Marshal(obj.Object)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(file, b, 0644)
+	if err != nil {
+		return err
+	}
+
+	return updateResources(filepath.Dir(file), func(resources []string) []string {
+		for _, r := range resources {
+			if r == filepath.Base(file) {
+				return resources
+			}
+		}
+		return append(resources, filepath.Base(file))
+	})
+}
+
+// RemoveExported removes the object of the kind with the name from under the cluster/core dir of baseDir, and from
+// the kustomization of its namespace, so the GitOps controller prunes it
+func RemoveExported(baseDir string, namespace string, kind string, name string) error {
+	file := exportedFile(baseDir, namespace, kind, name)
+	err := os.Remove(file)
+	if err != nil {
+		return err
+	}
+
+	return updateResources(filepath.Dir(file), func(resources []string) []string {
+		kept := []string{}
+		for _, r := range resources {
+			if r != filepath.Base(file) {
+				kept = append(kept, r)
+			}
+		}
+		return kept
+	})
+}
+
+// exportedFile returns the file the object would have been exported to
+func exportedFile(baseDir string, namespace string, kind string, name string) string {
+	return baseDir + "/cluster/core/" + namespace + "/" + strings.ToLower(kind) + "-" + strings.ToLower(name) + ".yaml"
+}
+
+// readFile reads an exported object
+func readFile(file string) (*unstructured.Unstructured, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	// Numbers have to come out as int64, which only the unstructured decoder does
+	j, err := yaml.YAMLToJSON(b)
+	if err != nil {
+		return nil, errors.New("unable to read " + file + ": " + err.Error())
+	}
+	obj := &unstructured.Unstructured{}
+	err = obj.UnmarshalJSON(j)
+	if err != nil {
+		return nil, errors.New("unable to read " + file + ": " + err.Error())
+	}
+
+	return obj, nil
+}
+
+// updateResources lets update change the resources listed in the kustomization.yaml of dir
+func updateResources(dir string, update func(resources []string) []string) error {
+	file := dir + "/kustomization.yaml"
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	k := map[string]interface{}{}
+	err = yaml.Unmarshal(b, &k)
+	if err != nil {
+		return errors.New("unable to read " + file + ": " + err.Error())
+	}
+	resources := []string{}
+	if list, ok := k["resources"].([]interface{}); ok {
+		for _, r := range list {
+			if s, ok := r.(string); ok {
+				resources = append(resources, s)
+			}
+		}
+	}
+	k["resources"] = update(resources)
+
+	b, err = yaml.Marshal(k)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, b, 0644)
+}
+
+// IsExported returns if the object of the kind with the name was exported under the cluster/core dir of baseDir
+func IsExported(baseDir string, namespace string, kind string, name string) bool {
+	_, err := os.Stat(exportedFile(baseDir, namespace, kind, name))
+	return err == nil
+}
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"errors"
+
+	"github.com/christianh814/gokp/cmd/externaldns"
+	"github.com/spf13/cobra"
+)
+
+// addExternalDNSFlags adds the flags for having external-dns manage the records of a Route53 zone
+func addExternalDNSFlags(c *cobra.Command) {
+	c.Flags().Bool("enable-external-dns", false, "Install external-dns, deployed from the GitOps repo, to manage the records of the Route53 zone of --dns-zone.")
+	c.Flags().String("dns-zone", "", "Public Route53 hosted zone external-dns manages records in (e.g. example.com).")
+}
+
+// externalDNSZone returns the zone external-dns manages, or "" if it's not installed
+func externalDNSZone(cmd *cobra.Command) (string, error) {
+	enabled, _ := cmd.Flags().GetBool("enable-external-dns")
+	zone, _ := cmd.Flags().GetString("dns-zone")
+	if enabled && zone == "" {
+		return "", errors.New("--enable-external-dns needs the --dns-zone it manages the records of")
+	}
+	if !enabled && zone != "" {
+		return "", errors.New("--dns-zone needs --enable-external-dns")
+	}
+	return zone, nil
+}
+
+// setupExternalDNSCredentials creates the IAM user external-dns uses, allowed to change the records of the hosted
+// zone only, and puts its access key in a Secret on the cluster of the kubeconfig. The key isn't kept anywhere else
+func setupExternalDNSCredentials(clusterName string, zoneID string, kubeconfig string, accessKey string, secretKey string) error {
+	keyID, secret, err := externaldns.CreateAWSCredentials(clusterName, zoneID, accessKey, secretKey)
+	if err != nil {
+		return err
+	}
+	return externaldns.CreateSecret(kubeconfig, keyID, secret)
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"errors"
+
+	"github.com/christianh814/gokp/cmd/externalsecrets"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// addExternalSecretsFlags adds the flags for the ClusterSecretStore the External Secrets Operator reads from
+func addExternalSecretsFlags(c *cobra.Command) {
+	c.Flags().String("external-secrets-provider", "", "Create a ClusterSecretStore for the External Secrets Operator reading from AWS Secrets Manager (aws) or Vault (vault).")
+	c.Flags().String("external-secrets-aws-region", "", "Region of AWS Secrets Manager (defaults to --aws-region for AWS clusters).")
+	c.Flags().String("external-secrets-aws-access-key", "", "Access key the operator reads AWS Secrets Manager with (the IAM role of the nodes if empty).")
+	c.Flags().String("external-secrets-aws-secret-key", "", "Secret key the operator reads AWS Secrets Manager with.")
+	c.Flags().String("external-secrets-vault-server", "", "URL of Vault (e.g. https://vault.example.com:8200).")
+	c.Flags().String("external-secrets-vault-path", "secret", "Path of the KV (v2) secrets engine of Vault.")
+	c.Flags().String("external-secrets-vault-token", "", "Token the operator logs in to Vault with.")
+	c.Flags().String("external-secrets-vault-role", "", "Role of the Kubernetes auth method of Vault the operator logs in with, instead of a token.")
+}
+
+// externalSecretsStore returns the ClusterSecretStore the flags ask for, or nil if there's none
+func externalSecretsStore(cmd *cobra.Command) *externalsecrets.Store {
+	s := &externalsecrets.Store{}
+	s.Provider, _ = cmd.Flags().GetString("external-secrets-provider")
+	if s.Provider == "" {
+		return nil
+	}
+	s.AWSRegion, _ = cmd.Flags().GetString("external-secrets-aws-region")
+	if s.AWSRegion == "" && s.Provider == "aws" {
+		// AWS clusters read from Secrets Manager in their own region
+		s.AWSRegion, _ = cmd.Flags().GetString("aws-region")
+	}
+	s.AWSAccessKey, _ = cmd.Flags().GetString("external-secrets-aws-access-key")
+	s.AWSSecretKey, _ = cmd.Flags().GetString("external-secrets-aws-secret-key")
+	s.VaultServer, _ = cmd.Flags().GetString("external-secrets-vault-server")
+	s.VaultPath, _ = cmd.Flags().GetString("external-secrets-vault-path")
+	s.VaultToken, _ = cmd.Flags().GetString("external-secrets-vault-token")
+	s.VaultRole, _ = cmd.Flags().GetString("external-secrets-vault-role")
+	return s
+}
+
+// checkExternalSecretsFlags makes sure the ClusterSecretStore goes with the operator and has what it needs
+func checkExternalSecretsFlags(cmd *cobra.Command) error {
+	version, _ := cmd.Flags().GetString("enable-external-secrets")
+	store := externalSecretsStore(cmd)
+	if store == nil {
+		for _, flag := range []string{"external-secrets-aws-region", "external-secrets-aws-access-key", "external-secrets-aws-secret-key", "external-secrets-vault-server", "external-secrets-vault-path", "external-secrets-vault-token", "external-secrets-vault-role"} {
+			if cmd.Flags().Changed(flag) {
+				return errors.New("--" + flag + " needs --external-secrets-provider")
+			}
+		}
+		return nil
+	}
+	if version == "" {
+		return errors.New("--external-secrets-provider needs --enable-external-secrets, the ClusterSecretStore is an External Secrets Operator resource")
+	}
+	return store.Validate()
+}
+
+// setupExternalSecrets creates the Secret the ClusterSecretStore logs in with on the cluster of the kubeconfig, if
+// there's a store and it needs one. The credentials never go into the repo
+func setupExternalSecrets(cmd *cobra.Command, kubeconfig string) error {
+	store := externalSecretsStore(cmd)
+	if store == nil || store.Credentials() == nil {
+		return nil
+	}
+
+	log.Info("Creating the credentials of the ClusterSecretStore ", externalsecrets.StoreName)
+	return externalsecrets.CreateSecret(kubeconfig, *store)
+}
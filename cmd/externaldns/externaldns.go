@@ -0,0 +1,246 @@
+package externaldns
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/christianh814/gokp/cmd/templates"
+	"github.com/christianh814/gokp/cmd/utils"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Version is the version of external-dns that's installed
+var Version string = "v0.12.2"
+
+// Namespace is where external-dns runs, and SecretName the Secret in it with the AWS credentials it uses. The
+// Secret is created on the cluster, it's never in the GitOps repo
+var (
+	Namespace  string = "external-dns"
+	SecretName string = "external-dns-aws"
+)
+
+// repoDir is the dir under cluster/core external-dns is kept in
+var repoDir string = "external-dns"
+
+// policyName is the name of the inline policy of the IAM user
+var policyName string = "gokp-external-dns"
+
+// UserName returns the name of the IAM user external-dns of the cluster uses
+func UserName(clusterName string) string {
+	return "gokp-" + clusterName + "-external-dns"
+}
+
+// HostedZoneID returns the ID of the public Route53 hosted zone for the domain. The default credential chain is used
+// if no keys are given
+func HostedZoneID(zone string, accessKey string, secretKey string) (string, error) {
+	sess, err := newSession(accessKey, secretKey)
+	if err != nil {
+		return "", err
+	}
+
+	name := strings.TrimSuffix(zone, ".") + "."
+	out, err := route53.New(sess).ListHostedZonesByName(&route53.ListHostedZonesByNameInput{DNSName: aws.String(name)})
+	if err != nil {
+		return "", err
+	}
+	for _, z := range out.HostedZones {
+		if aws.StringValue(z.Name) == name && (z.Config == nil || !aws.BoolValue(z.Config.PrivateZone)) {
+			return strings.TrimPrefix(aws.StringValue(z.Id), "/hostedzone/"), nil
+		}
+	}
+	return "", errors.New("no public Route53 hosted zone found for " + zone)
+}
+
+// CreateAWSCredentials creates the IAM user of the cluster, allowed to change the records of the hosted zone only,
+// and returns a new access key for it. Access keys it already had are deleted, so this can be run again
+func CreateAWSCredentials(clusterName string, zoneID string, accessKey string, secretKey string) (string, string, error) {
+	sess, err := newSession(accessKey, secretKey)
+	if err != nil {
+		return "", "", err
+	}
+	svc := iam.New(sess)
+	userName := UserName(clusterName)
+
+	_, err = svc.CreateUser(&iam.CreateUserInput{
+		UserName: aws.String(userName),
+		Tags:     []*iam.Tag{{Key: aws.String("gokp-cluster"), Value: aws.String(clusterName)}},
+	})
+	if err != nil && !isAWSError(err, iam.ErrCodeEntityAlreadyExistsException) {
+		return "", "", err
+	}
+
+	policy, err := json.Marshal(map[string]interface{}{
+		"Version": "2012-10-17",
+		"Statement": []map[string]interface{}{
+			{
+				"Effect":   "Allow",
+				"Action":   []string{"route53:ChangeResourceRecordSets"},
+				"Resource": []string{"arn:aws:route53:::hostedzone/" + zoneID},
+			},
+			{
+				"Effect":   "Allow",
+				"Action":   []string{"route53:ListHostedZones", "route53:ListResourceRecordSets", "route53:ListTagsForResource"},
+				"Resource": []string{"*"},
+			},
+		},
+	})
+	if err != nil {
+		return "", "", err
+	}
+	_, err = svc.PutUserPolicy(&iam.PutUserPolicyInput{
+		UserName:       aws.String(userName),
+		PolicyName:     aws.String(policyName),
+		PolicyDocument: aws.String(string(policy)),
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	err = deleteAccessKeys(svc, userName)
+	if err != nil {
+		return "", "", err
+	}
+	out, err := svc.CreateAccessKey(&iam.CreateAccessKeyInput{UserName: aws.String(userName)})
+	if err != nil {
+		return "", "", err
+	}
+
+	log.Info("Created IAM user ", userName, " for external-dns")
+	return aws.StringValue(out.AccessKey.AccessKeyId), aws.StringValue(out.AccessKey.SecretAccessKey), nil
+}
+
+// DeleteAWSCredentials deletes the IAM user of the cluster, along with its access keys and policy. It's not an
+// error if it's already gone
+func DeleteAWSCredentials(clusterName string, accessKey string, secretKey string) error {
+	sess, err := newSession(accessKey, secretKey)
+	if err != nil {
+		return err
+	}
+	svc := iam.New(sess)
+	userName := UserName(clusterName)
+
+	err = deleteAccessKeys(svc, userName)
+	if isAWSError(err, iam.ErrCodeNoSuchEntityException) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, err = svc.DeleteUserPolicy(&iam.DeleteUserPolicyInput{UserName: aws.String(userName), PolicyName: aws.String(policyName)})
+	if err != nil && !isAWSError(err, iam.ErrCodeNoSuchEntityException) {
+		return err
+	}
+	_, err = svc.DeleteUser(&iam.DeleteUserInput{UserName: aws.String(userName)})
+	if err != nil && !isAWSError(err, iam.ErrCodeNoSuchEntityException) {
+		return err
+	}
+
+	log.Info("Deleted IAM user ", userName)
+	return nil
+}
+
+// deleteAccessKeys deletes every access key of the IAM user
+func deleteAccessKeys(svc *iam.IAM, userName string) error {
+	out, err := svc.ListAccessKeys(&iam.ListAccessKeysInput{UserName: aws.String(userName)})
+	if err != nil {
+		return err
+	}
+	for _, k := range out.AccessKeyMetadata {
+		_, err = svc.DeleteAccessKey(&iam.DeleteAccessKeyInput{UserName: aws.String(userName), AccessKeyId: k.AccessKeyId})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateSecret creates (or replaces) the Secret with the access key external-dns uses on the cluster of the
+// kubeconfig, along with its namespace
+func CreateSecret(kubeconfig string, accessKeyID string, secretAccessKey string) error {
+	cfg, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return err
+	}
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	_, err = clientset.CoreV1().Namespaces().Create(context.TODO(), &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: Namespace},
+	}, metav1.CreateOptions{})
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: SecretName, Namespace: Namespace},
+		Type:       corev1.SecretTypeOpaque,
+		StringData: map[string]string{
+			"AWS_ACCESS_KEY_ID":     accessKeyID,
+			"AWS_SECRET_ACCESS_KEY": secretAccessKey,
+		},
+	}
+	_, err = clientset.CoreV1().Secrets(Namespace).Create(context.TODO(), secret, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		_, err = clientset.CoreV1().Secrets(Namespace).Update(context.TODO(), secret, metav1.UpdateOptions{})
+	}
+	return err
+}
+
+// WriteManifests writes external-dns under the cluster/core dir of baseDir, so the GitOps controller deploys it. It
+// only manages the records of the zone, and only the ones it created (they're owned by the cluster)
+func WriteManifests(baseDir string, clusterName string, zone string) error {
+	dir := baseDir + "/cluster/core/" + repoDir
+	os.MkdirAll(dir, 0755)
+
+	externalDNSVars := struct {
+		Version    string
+		Namespace  string
+		SecretName string
+		Zone       string
+		OwnerID    string
+	}{
+		Version:    Version,
+		Namespace:  Namespace,
+		SecretName: SecretName,
+		Zone:       strings.TrimSuffix(zone, "."),
+		OwnerID:    clusterName,
+	}
+	_, err := utils.WriteTemplate(templates.ExternalDNS, dir+"/"+"external-dns.yaml", externalDNSVars)
+	if err != nil {
+		return err
+	}
+	_, err = utils.WriteTemplate(templates.ExternalDNSKustomize, dir+"/"+"kustomization.yaml", externalDNSVars)
+	return err
+}
+
+// isAWSError returns true if err is an AWS error with the code
+func isAWSError(err error, code string) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == code
+}
+
+// newSession returns an AWS session, IAM and Route53 aren't regional. The default credential chain is used if no
+// keys are given
+func newSession(accessKey string, secretKey string) (*session.Session, error) {
+	cfg := &aws.Config{Region: aws.String("us-east-1")}
+	if accessKey != "" && secretKey != "" {
+		cfg.Credentials = credentials.NewStaticCredentials(accessKey, secretKey, "")
+	}
+	return session.NewSession(cfg)
+}
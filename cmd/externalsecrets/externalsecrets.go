@@ -0,0 +1,159 @@
+package externalsecrets
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"os"
+
+	"github.com/christianh814/gokp/cmd/templates"
+	"github.com/christianh814/gokp/cmd/utils"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// StoreName is the name of the ClusterSecretStore, which ExternalSecrets of every namespace point at
+var StoreName string = "cluster-secret-store"
+
+// Namespace is where the Secret with the credentials of the ClusterSecretStore is kept, and SecretName its name. The
+// Secret is created on the cluster, it's never in the GitOps repo
+var (
+	Namespace  string = "external-secrets"
+	SecretName string = "external-secrets-credentials"
+)
+
+// OperatorNamespace is where the operator runs, the static manifests of its releases run it in the default namespace.
+// Its ServiceAccount is what it logs in to Vault as with the Kubernetes auth method
+var OperatorNamespace string = "default"
+
+// repoDir is the dir under cluster/core the ClusterSecretStore is kept in, outside the dir of the add-on so the
+// add-on catalog leaves it alone
+var repoDir string = "external-secrets-store"
+
+// Store is the ClusterSecretStore the External Secrets Operator reads secrets from. Provider is either "aws" (AWS
+// Secrets Manager in AWSRegion) or "vault" (a KV secrets engine at VaultPath of VaultServer)
+type Store struct {
+	Provider string
+	// AWSAccessKey and AWSSecretKey are optional, without them the operator uses the IAM role of the node it runs on
+	AWSRegion    string
+	AWSAccessKey string
+	AWSSecretKey string
+	// VaultToken or VaultRole (of the Kubernetes auth method of Vault) is what the operator logs in to Vault with
+	VaultServer string
+	VaultPath   string
+	VaultToken  string
+	VaultRole   string
+}
+
+// Validate makes sure the store has what its provider needs
+func (s Store) Validate() error {
+	switch s.Provider {
+	case "aws":
+		if s.AWSRegion == "" {
+			return errors.New("an AWS Secrets Manager secret store needs a region")
+		}
+		if (s.AWSAccessKey == "") != (s.AWSSecretKey == "") {
+			return errors.New("an AWS Secrets Manager secret store needs both an access key and a secret key, or neither")
+		}
+	case "vault":
+		u, err := url.Parse(s.VaultServer)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return errors.New("invalid Vault server " + s.VaultServer + ", it should look like https://vault.example.com:8200")
+		}
+		if s.VaultPath == "" {
+			return errors.New("a Vault secret store needs the path of the KV secrets engine")
+		}
+		if (s.VaultToken == "") == (s.VaultRole == "") {
+			return errors.New("a Vault secret store needs either a token or a role to log in with, not both")
+		}
+	default:
+		return errors.New("unknown secret store provider " + s.Provider + " (use aws or vault)")
+	}
+	return nil
+}
+
+// Credentials returns what goes into the Secret the store logs in with, nothing if it doesn't need one
+func (s Store) Credentials() map[string]string {
+	switch {
+	case s.Provider == "aws" && s.AWSAccessKey != "":
+		return map[string]string{
+			"access-key-id":     s.AWSAccessKey,
+			"secret-access-key": s.AWSSecretKey,
+		}
+	case s.Provider == "vault" && s.VaultToken != "":
+		return map[string]string{"token": s.VaultToken}
+	}
+	return nil
+}
+
+// WriteStore writes the ClusterSecretStore under the cluster/core dir of baseDir, so the GitOps controller creates it
+// once the operator is up. Only where the credentials are is in the repo, not the credentials themselves
+func WriteStore(baseDir string, s Store) error {
+	err := s.Validate()
+	if err != nil {
+		return err
+	}
+
+	dir := baseDir + "/cluster/core/" + repoDir
+	os.MkdirAll(dir, 0755)
+	storeVars := struct {
+		Store
+		Name              string
+		Namespace         string
+		SecretName        string
+		OperatorNamespace string
+		HasCredentials    bool
+	}{
+		Store:             s,
+		Name:              StoreName,
+		Namespace:         Namespace,
+		SecretName:        SecretName,
+		OperatorNamespace: OperatorNamespace,
+		HasCredentials:    s.Credentials() != nil,
+	}
+	_, err = utils.WriteTemplate(templates.ClusterSecretStore, dir+"/"+"clustersecretstore.yaml", storeVars)
+	if err != nil {
+		return err
+	}
+	_, err = utils.WriteTemplate(templates.ClusterSecretStoreKustomize, dir+"/"+"kustomization.yaml", storeVars)
+	return err
+}
+
+// CreateSecret creates (or replaces) the Secret with the credentials of the store on the cluster of the kubeconfig,
+// along with its namespace. Nothing is done if the store doesn't need one
+func CreateSecret(kubeconfig string, s Store) error {
+	credentials := s.Credentials()
+	if credentials == nil {
+		return nil
+	}
+
+	cfg, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return err
+	}
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	_, err = clientset.CoreV1().Namespaces().Create(context.TODO(), &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: Namespace},
+	}, metav1.CreateOptions{})
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: SecretName, Namespace: Namespace},
+		Type:       corev1.SecretTypeOpaque,
+		StringData: credentials,
+	}
+	_, err = clientset.CoreV1().Secrets(Namespace).Create(context.TODO(), secret, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		_, err = clientset.CoreV1().Secrets(Namespace).Update(context.TODO(), secret, metav1.UpdateOptions{})
+	}
+	return err
+}
@@ -0,0 +1,23 @@
+package cmd
+
+import (
+	"github.com/christianh814/gokp/cmd/capi"
+	"github.com/spf13/cobra"
+)
+
+// addFeatureGatesFlag adds the flag for the Kubernetes feature gates of the cluster
+func addFeatureGatesFlag(c *cobra.Command) {
+	c.Flags().StringSlice("feature-gates", nil, "Kubernetes feature gates to set on the API server, controller manager, scheduler, and kubelets (e.g. EphemeralContainers=true,CSIMigration=false).")
+}
+
+// setFeatureGates sets the feature gates of the cluster from the flag
+func setFeatureGates(cmd *cobra.Command) error {
+	gates, _ := cmd.Flags().GetStringSlice("feature-gates")
+	fg, err := capi.ParseFeatureGates(gates)
+	if err != nil {
+		return err
+	}
+
+	capi.FeatureGates = fg
+	return nil
+}
@@ -8,16 +8,23 @@ import (
 	"time"
 
 	"github.com/christianh814/gokp/cmd/capi"
+	"github.com/christianh814/gokp/cmd/clock"
+	"github.com/christianh814/gokp/cmd/gitutils"
+	"github.com/christianh814/gokp/cmd/sops"
 	"github.com/christianh814/gokp/cmd/utils"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
+// ApplyWait is how often BootstrapFluxCD goes through the YAMLs again while some of them fail, and how long it keeps
+// at it
+var ApplyWait clock.Waiter = clock.Waiter{Interval: 5 * time.Second, Timeout: 5 * time.Minute}
+
 // BootstrapFluxCD installs FluxCD on a given cluster with the provided Kustomize-ed dir
 func BootstrapFluxCD(clustername *string, workdir string, capicfg string) (bool, error) {
 	// Set the repoDir path where things should be cloned.
 	// check if it exists
 	repoDir := workdir + "/" + *clustername
-	overlay := repoDir + "/cluster/core/flux-system"
+	overlay := gitutils.BaseDir(repoDir) + "/cluster/core/flux-system"
 	if _, err := os.Stat(repoDir); os.IsNotExist(err) {
 		return false, err
 	}
@@ -42,34 +49,51 @@ func BootstrapFluxCD(clustername *string, workdir string, capicfg string) (bool,
 		return false, err
 	}
 
+	// The secrets encrypted with SOPS are applied decrypted, Flux decrypts them itself from then on with the
+	// age key we give it
+	fluxInstallYamls, err = sops.WithoutEncrypted(fluxInstallYamls)
+	if err != nil {
+		return false, err
+	}
+	secretYamls, err := sops.DecryptDir(overlay, workdir, workdir+"/"+"sops-output")
+	if err != nil {
+		return false, err
+	}
+	defer os.RemoveAll(workdir + "/" + "sops-output")
+	fluxInstallYamls = append(fluxInstallYamls, secretYamls...)
+
 	// Set up a connection to the K8S cluster and apply these bad boys
 	capiInstallConfig, err := clientcmd.BuildConfigFromFlags("", capicfg)
 	if err != nil {
 		return false, err
 	}
 
-	// Loop until all are applied. Set a counter so we don't loop endlessly. Keep track of errors
-	counter := 0
-	for runs := 15; counter <= runs; counter++ {
-		// break if we've tried 15 times (aka 30 seconds)
-		if counter > runs {
-			return false, errors.New("failed to apply flux manifests")
+	if len(secretYamls) > 0 {
+		err = sops.CreateSecret(capicfg, "flux-system", workdir)
+		if err != nil {
+			return false, err
 		}
-		// set the error count
+	}
+
+	// Go through them until all are applied, the CRDs need time to be established before the CRs can be applied
+	var lastErr error
+	err = ApplyWait.Until(func() (bool, error) {
+		// Keep track of errors
 		errcount := 0
-		// loop through the YAMLS counting the errors
 		for _, fluxInstallYaml := range fluxInstallYamls {
-			err = capi.DoSSA(context.TODO(), capiInstallConfig, fluxInstallYaml)
+			err := capi.DoSSA(context.TODO(), capiInstallConfig, fluxInstallYaml)
 			if err != nil {
 				errcount++
+				lastErr = err
 			}
-			// sleep and wait to apply the next one
-			time.Sleep(2 * time.Second)
-		}
-		// If no errors were found, break out of the loop
-		if errcount == 0 {
-			break
 		}
+		return errcount == 0, nil
+	})
+	if err == clock.ErrTimeout {
+		return false, errors.New("failed to apply flux manifests: " + lastErr.Error())
+	}
+	if err != nil {
+		return false, err
 	}
 
 	return true, nil
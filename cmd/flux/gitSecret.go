@@ -0,0 +1,49 @@
+package flux
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// GitSecretName is the name of the secret the GitRepository of the cluster reads its credentials from, in the
+// flux-system namespace
+var GitSecretName string = "flux-system"
+
+// CreateGitSecret puts the credentials of a repo that's talked to over HTTPS on the cluster before Flux is deployed.
+// They aren't kept in the repo like the ssh key is, anyone who can read the repo could push to it with them
+func CreateGitSecret(capicfg string, username string, password string) error {
+	cfg, err := clientcmd.BuildConfigFromFlags("", capicfg)
+	if err != nil {
+		return err
+	}
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	_, err = clientset.CoreV1().Namespaces().Create(context.TODO(), &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: "flux-system"},
+	}, metav1.CreateOptions{})
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: GitSecretName, Namespace: "flux-system"},
+		Type:       corev1.SecretTypeOpaque,
+		StringData: map[string]string{
+			"username": username,
+			"password": password,
+		},
+	}
+	_, err = clientset.CoreV1().Secrets("flux-system").Create(context.TODO(), secret, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		_, err = clientset.CoreV1().Secrets("flux-system").Update(context.TODO(), secret, metav1.UpdateOptions{})
+	}
+	return err
+}
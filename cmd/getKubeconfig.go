@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/christianh814/gokp/cmd/kubeconfig"
+	"github.com/christianh814/gokp/cmd/state"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// getKubeconfigCmd represents the get-kubeconfig command
+var getKubeconfigCmd = &cobra.Command{
+	Use:   "get-kubeconfig",
+	Short: "Prints or merges the kubeconfig of a cluster",
+	Long: `Prints the kubeconfig GOKP saved for a cluster, or merges it into your
+kubeconfig (~/.kube/config, or the first file in $KUBECONFIG) as a context
+named gokp-<clustername>. A context that's there already is only replaced if
+it's for the same cluster, and the kubeconfig is backed up to
+<kubeconfig>.gokp-backup first. Use --exec for the kubeconfig written with
+--exec-kubeconfig, which doesn't carry the client certificate. For example:
+
+gokp get-kubeconfig --cluster-name=mycluster > mycluster.kubeconfig
+gokp get-kubeconfig --cluster-name=mycluster --merge
+gokp get-kubeconfig --cluster-name=mycluster --merge --exec --context=prod --use-context
+
+Use "gokp kubeconfig remove" to take it out again.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		// Grab flags
+		clusterName, _ := cmd.Flags().GetString("cluster-name")
+		merge, _ := cmd.Flags().GetBool("merge")
+		exec, _ := cmd.Flags().GetBool("exec")
+		contextName, _ := cmd.Flags().GetString("context")
+		useContext, _ := cmd.Flags().GetBool("use-context")
+		into, _ := cmd.Flags().GetString("merge-into")
+
+		// The exec kubeconfig isn't a secret, so it's only ever under ~/.gokp
+		var file string
+		var err error
+		if exec {
+			file = state.ArtifactsDir(clusterName) + "/" + clusterName + "-exec.kubeconfig"
+			if _, err := os.Stat(file); os.IsNotExist(err) {
+				log.Fatal(errors.New("there's no exec kubeconfig for " + clusterName + ", it was installed without --exec-kubeconfig"))
+			}
+		} else {
+			file, err = clusterSecretFile(clusterName, clusterName+".kubeconfig")
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		if !merge {
+			b, err := ioutil.ReadFile(file)
+			if err != nil {
+				log.Fatal(err)
+			}
+			fmt.Print(string(b))
+			return
+		}
+
+		if contextName == "" {
+			contextName = kubeconfig.ContextName(clusterName)
+		}
+		if into == "" {
+			into = clientcmd.NewDefaultPathOptions().GetDefaultFilename()
+		}
+		err = kubeconfig.Merge(file, contextName, into, useContext)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Info("Added context ", contextName, " to ", into)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(getKubeconfigCmd)
+
+	getKubeconfigCmd.Flags().String("cluster-name", "", "Name of the gokp cluster.")
+	getKubeconfigCmd.Flags().Bool("merge", false, "Merge the kubeconfig into yours instead of printing it.")
+	getKubeconfigCmd.Flags().Bool("exec", false, "Use the kubeconfig that gets short lived credentials from gokp (written with --exec-kubeconfig).")
+	getKubeconfigCmd.Flags().String("context", "", "Name of the context to merge in (defaults to gokp-<clustername>).")
+	getKubeconfigCmd.Flags().Bool("use-context", false, "Make the merged context the current one.")
+	getKubeconfigCmd.Flags().String("merge-into", "", "The kubeconfig to merge into (defaults to ~/.kube/config, or the first file in $KUBECONFIG).")
+
+	getKubeconfigCmd.MarkFlagRequired("cluster-name")
+}
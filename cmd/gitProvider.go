@@ -0,0 +1,432 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/christianh814/gokp/cmd/azuredevops"
+	"github.com/christianh814/gokp/cmd/bitbucket"
+	"github.com/christianh814/gokp/cmd/gitea"
+	"github.com/christianh814/gokp/cmd/github"
+	"github.com/christianh814/gokp/cmd/gitutils"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// addGitProviderFlags adds the flags needed to pick and configure the git provider the GitOps repo lives on
+func addGitProviderFlags(c *cobra.Command) {
+	c.Flags().String("git-provider", "github", "The git provider to create the GitOps repo on (github, gitea, bitbucket, or azuredevops).")
+	c.Flags().String("git-url", "", "Use this existing git remote for the GitOps repo instead of creating one on a git provider.")
+	c.Flags().String("git-ssh-key", "", "SSH private key to use with --git-url.")
+	c.Flags().String("git-token", "", "Token to use with an HTTPS --git-url.")
+	c.Flags().String("git-username", "git", "Username to use with --git-token.")
+	c.Flags().Bool("monorepo", false, "Write the cluster to clusters/<cluster-name>/ of a shared repo (given with --existing-repo or --git-url).")
+	c.Flags().String("repo-path", "", "Subdirectory of the GitOps repo to write the cluster dir to (defaults to the root of the repo).")
+	c.Flags().String("git-remote-name", "origin", "Name of the remote of the GitOps repo in the local clone.")
+	c.Flags().String("git-branch", "main", "Branch of the GitOps repo to push to and for the GitOps controller to follow.")
+	c.Flags().StringArray("git-mirror", []string{}, "Additional remote to push the GitOps repo to as name=url (can be repeated).")
+	c.Flags().StringArray("git-mirror-ssh-key", []string{}, "SSH private key to push to a mirror with as name=/path/to/key (can be repeated).")
+	c.Flags().String("git-known-hosts", "", "known_hosts file with the ssh host key of the git host (defaults to ~/.ssh/known_hosts).")
+	c.Flags().Bool("git-trust-host-key", false, "Trust the ssh host key the git host sends if it isn't in the known_hosts file.")
+	c.Flags().StringArray("git-mirror-credentials", []string{}, "Credentials to push to an HTTPS mirror with as name=username:password (can be repeated).")
+
+	// GitHub specific flags
+	c.Flags().String("github-token", "", "GitHub token to use.")
+	c.Flags().String("github-base-url", "", "Base URL of your GitHub Enterprise Server (e.g. https://github.example.com). Defaults to GitHub.com.")
+	c.Flags().String("github-org", "", "Create the repo in this GitHub organization instead of your user account.")
+	c.Flags().StringArray("github-team", []string{}, "Give an organization team access to the repo as slug=permission (pull, triage, push, maintain, or admin). Can be repeated.")
+	c.Flags().Int64("github-app-id", 0, "ID of the GitHub App to authenticate as instead of using --github-token.")
+	c.Flags().Int64("github-app-installation-id", 0, "ID of the installation of the GitHub App on the organization to create the repo in.")
+	c.Flags().String("github-app-private-key", "", "Path to the private key of the GitHub App.")
+	c.Flags().String("existing-repo", "", "Use this existing GitHub repo (as owner/name) instead of creating one.")
+	c.Flags().String("repo-name-collision", "fail", "What to do if the GitHub repo already exists ("+strings.Join(github.CollisionStrategies, ", ")+").")
+
+	// Gitea specific flags
+	c.Flags().String("gitea-url", "", "Base URL of your Gitea instance (e.g. https://gitea.example.com).")
+	c.Flags().String("gitea-token", "", "Gitea token to use.")
+
+	// Bitbucket specific flags
+	c.Flags().String("bitbucket-username", "", "Bitbucket username to use.")
+	c.Flags().String("bitbucket-app-password", "", "Bitbucket app password to use.")
+	c.Flags().String("bitbucket-workspace", "", "Bitbucket workspace to create the repo in (defaults to the username).")
+	c.Flags().String("bitbucket-project", "", "Bitbucket project key to create the repo under.")
+
+	// Azure DevOps specific flags
+	c.Flags().String("azuredevops-org", "", "Azure DevOps organization to create the repo in.")
+	c.Flags().String("azuredevops-project", "", "Azure DevOps project to create the repo in.")
+	c.Flags().String("azuredevops-pat", "", "Azure DevOps personal access token to use.")
+}
+
+// checkGitProviderFlags makes sure the flags needed for the chosen git provider were passed
+func checkGitProviderFlags(cmd *cobra.Command) error {
+	gitProvider, _ := cmd.Flags().GetString("git-provider")
+	gitURL, _ := cmd.Flags().GetString("git-url")
+
+	err := setKnownHosts(cmd)
+	if err != nil {
+		return err
+	}
+
+	// Bringing your own remote skips the git provider entirely
+	if gitURL != "" {
+		gitProvider = "none"
+	}
+
+	switch gitProvider {
+	case "none":
+		gitSSHKey, _ := cmd.Flags().GetString("git-ssh-key")
+		gitToken, _ := cmd.Flags().GetString("git-token")
+		isHttps := strings.HasPrefix(gitURL, "https://") || strings.HasPrefix(gitURL, "http://")
+		if isHttps && gitToken == "" {
+			return errors.New("--git-token is required with an HTTPS --git-url")
+		}
+		if !isHttps && gitSSHKey == "" {
+			return errors.New("--git-ssh-key is required with an SSH --git-url")
+		}
+	case "github":
+		// Point the github package at GitHub Enterprise Server if we were asked to
+		github.BaseURL, _ = cmd.Flags().GetString("github-base-url")
+
+		ghToken, err := githubToken(cmd)
+		if err != nil {
+			return err
+		}
+		if ghToken == "" {
+			return errors.New("--github-token (or --github-app-id) is required when using the github provider")
+		}
+
+		// Create the repo in an organization if we were asked to, making sure we're allowed to
+		githubOrg, _ := cmd.Flags().GetString("github-org")
+		if githubOrg != "" {
+			appID, _ := cmd.Flags().GetInt64("github-app-id")
+			if appID != 0 && !strings.EqualFold(github.Owner, githubOrg) {
+				return errors.New("the GitHub App is installed on " + github.Owner + ", not on " + githubOrg)
+			}
+			if appID == 0 {
+				privateRepo, _ := cmd.Flags().GetBool("private-repo")
+				err = github.CheckOrgAccess(ghToken, githubOrg, privateRepo)
+				if err != nil {
+					return err
+				}
+			}
+			github.Owner = githubOrg
+		}
+
+		// Teams only exist in organizations
+		githubTeams, _ := cmd.Flags().GetStringArray("github-team")
+		if len(githubTeams) > 0 && github.Owner == "" {
+			return errors.New("--github-team needs --github-org")
+		}
+		for _, t := range githubTeams {
+			slug, permission, err := splitKeyValue(t)
+			if err != nil {
+				return err
+			}
+			switch permission {
+			case "pull", "triage", "push", "maintain", "admin":
+				github.Teams[slug] = permission
+			default:
+				return errors.New("unknown permission for team " + slug + ": " + permission)
+			}
+		}
+
+		// Make sure the repo we were asked to use is there
+		existingRepo, _ := cmd.Flags().GetString("existing-repo")
+		if existingRepo != "" {
+			exists, err := github.ExistingRepoExists(ghToken, existingRepo)
+			if err != nil {
+				return err
+			}
+			if !exists {
+				return errors.New("existing repo " + existingRepo + " not found")
+			}
+		}
+
+		// Fail now instead of after the cluster has been created if we aren't going to handle a name collision
+		onCollision, _ := cmd.Flags().GetString("repo-name-collision")
+		if onCollision == "fail" && existingRepo == "" {
+			clusterName, _ := cmd.Flags().GetString("cluster-name")
+			exists, err := github.RepoExists(ghToken, clusterName)
+			if err != nil {
+				return err
+			}
+			if exists {
+				return errors.New("a GitHub repo named " + clusterName + " already exists, see --repo-name-collision")
+			}
+		}
+	case "gitea":
+		giteaURL, _ := cmd.Flags().GetString("gitea-url")
+		giteaToken, _ := cmd.Flags().GetString("gitea-token")
+		if giteaURL == "" || giteaToken == "" {
+			return errors.New("--gitea-url and --gitea-token are required when using the gitea provider")
+		}
+	case "bitbucket":
+		bbUsername, _ := cmd.Flags().GetString("bitbucket-username")
+		bbAppPassword, _ := cmd.Flags().GetString("bitbucket-app-password")
+		if bbUsername == "" || bbAppPassword == "" {
+			return errors.New("--bitbucket-username and --bitbucket-app-password are required when using the bitbucket provider")
+		}
+	case "azuredevops":
+		azdoOrg, _ := cmd.Flags().GetString("azuredevops-org")
+		azdoProject, _ := cmd.Flags().GetString("azuredevops-project")
+		azdoPat, _ := cmd.Flags().GetString("azuredevops-pat")
+		if azdoOrg == "" || azdoProject == "" || azdoPat == "" {
+			return errors.New("--azuredevops-org, --azuredevops-project, and --azuredevops-pat are required when using the azuredevops provider")
+		}
+	default:
+		return errors.New("unrecognized git provider: " + gitProvider)
+	}
+
+	// The repo path has to stay inside of the repo
+	repoPath, _ := cmd.Flags().GetString("repo-path")
+	if path.IsAbs(repoPath) || strings.HasPrefix(path.Clean(repoPath), "..") {
+		return errors.New("--repo-path must be relative to the root of the repo: " + repoPath)
+	}
+
+	// Monorepo mode writes into a shared repo, so that repo has to be there already
+	monorepo, _ := cmd.Flags().GetBool("monorepo")
+	if monorepo {
+		if repoPath != "" {
+			return errors.New("--monorepo and --repo-path can't be used together")
+		}
+		existingRepo, _ := cmd.Flags().GetString("existing-repo")
+		gitURL, _ := cmd.Flags().GetString("git-url")
+		if existingRepo == "" && gitURL == "" {
+			return errors.New("--monorepo needs the shared repo given with --existing-repo or --git-url")
+		}
+	}
+
+	// Make sure the mirrors are well formed
+	_, err = gitMirrors(cmd)
+	if err != nil {
+		return err
+	}
+
+	// If we're here, we should be okay
+	return nil
+}
+
+// setKnownHosts sets where the ssh host key of the git host the GitOps controller is told to trust comes from
+func setKnownHosts(cmd *cobra.Command) error {
+	gitutils.KnownHostsFile, _ = cmd.Flags().GetString("git-known-hosts")
+	gitutils.TrustHostKey, _ = cmd.Flags().GetBool("git-trust-host-key")
+	if gitutils.KnownHostsFile != "" {
+		if _, err := os.Stat(gitutils.KnownHostsFile); err != nil {
+			return errors.New("unable to read --git-known-hosts: " + err.Error())
+		}
+	}
+	return nil
+}
+
+// createGitOpsRepo creates the GitOps repo on the chosen git provider and returns the remote URL
+func createGitOpsRepo(cmd *cobra.Command, clusterName *string, privateRepo *bool, workdir string) (string, error) {
+	if repoPath, _ := cmd.Flags().GetString("repo-path"); repoPath != "" {
+		gitutils.RepoPath = path.Clean(repoPath)
+	}
+	// Every cluster gets its own dir in a shared repo in monorepo mode
+	if monorepo, _ := cmd.Flags().GetBool("monorepo"); monorepo {
+		gitutils.RepoPath = "clusters/" + *clusterName
+	}
+	gitopsrepo, err := createProviderRepo(cmd, clusterName, privateRepo, workdir)
+	if err != nil {
+		return "", err
+	}
+
+	// Don't clobber a cluster dir that is already in the repo
+	if _, err := os.Stat(gitutils.BaseDir(workdir+"/"+*clusterName) + "/cluster"); err == nil {
+		return "", errors.New("the GitOps repo already has a cluster dir at: " + gitutils.ClusterPath())
+	}
+
+	// Add any mirrors to the local clone so they get pushed to as well
+	mirrors, err := gitMirrors(cmd)
+	if err != nil {
+		return "", err
+	}
+	for _, mirror := range mirrors {
+		log.Info("Adding mirror ", mirror.Name, ": ", mirror.URL)
+		err = gitutils.AddRemote(workdir+"/"+*clusterName, mirror.Name, mirror.URL)
+		if err != nil {
+			return "", err
+		}
+		if mirror.SSHKey != "" {
+			gitutils.SetSSHKey(mirror.URL, mirror.SSHKey)
+		}
+		if mirror.Username != "" {
+			gitutils.SetHTTPCredentials(mirror.URL, mirror.Username, mirror.Password)
+		}
+	}
+
+	return gitopsrepo, nil
+}
+
+// createProviderRepo creates the GitOps repo on the chosen git provider and returns the remote URL
+func createProviderRepo(cmd *cobra.Command, clusterName *string, privateRepo *bool, workdir string) (string, error) {
+	gitProvider, _ := cmd.Flags().GetString("git-provider")
+	gitutils.RemoteName, _ = cmd.Flags().GetString("git-remote-name")
+	gitutils.Branch, _ = cmd.Flags().GetString("git-branch")
+
+	// Bringing your own remote skips the git provider entirely
+	if gitURL, _ := cmd.Flags().GetString("git-url"); gitURL != "" {
+		return useExistingRemote(cmd, *clusterName, gitURL, workdir)
+	}
+
+	switch gitProvider {
+	case "github":
+		ghToken, err := githubToken(cmd)
+		if err != nil {
+			return "", err
+		}
+		if existingRepo, _ := cmd.Flags().GetString("existing-repo"); existingRepo != "" {
+			_, gitopsrepo, err := github.UseExistingRepo(clusterName, ghToken, existingRepo, workdir)
+			return gitopsrepo, err
+		}
+		onCollision, _ := cmd.Flags().GetString("repo-name-collision")
+		_, gitopsrepo, err := github.CreateRepo(clusterName, ghToken, privateRepo, workdir, onCollision)
+		return gitopsrepo, err
+	case "gitea":
+		giteaURL, _ := cmd.Flags().GetString("gitea-url")
+		giteaToken, _ := cmd.Flags().GetString("gitea-token")
+		_, gitopsrepo, err := gitea.CreateRepo(clusterName, giteaToken, privateRepo, workdir, giteaURL)
+		return gitopsrepo, err
+	case "bitbucket":
+		bbUsername, _ := cmd.Flags().GetString("bitbucket-username")
+		bbAppPassword, _ := cmd.Flags().GetString("bitbucket-app-password")
+		bbWorkspace, _ := cmd.Flags().GetString("bitbucket-workspace")
+		bbProject, _ := cmd.Flags().GetString("bitbucket-project")
+		if bbWorkspace == "" {
+			bbWorkspace = bbUsername
+		}
+		_, gitopsrepo, err := bitbucket.CreateRepo(clusterName, bbUsername, bbAppPassword, bbWorkspace, bbProject, privateRepo, workdir)
+		return gitopsrepo, err
+	case "azuredevops":
+		azdoOrg, _ := cmd.Flags().GetString("azuredevops-org")
+		azdoProject, _ := cmd.Flags().GetString("azuredevops-project")
+		azdoPat, _ := cmd.Flags().GetString("azuredevops-pat")
+		_, gitopsrepo, err := azuredevops.CreateRepo(clusterName, azdoPat, azdoOrg, azdoProject, workdir)
+		return gitopsrepo, err
+	default:
+		return "", errors.New("unrecognized git provider: " + gitProvider)
+	}
+}
+
+// githubToken returns the token to talk to GitHub with. That's either --github-token or, if a GitHub App was
+// given, an installation token of the App. Repos created with the App go to the organization it's installed on
+func githubToken(cmd *cobra.Command) (string, error) {
+	appID, _ := cmd.Flags().GetInt64("github-app-id")
+	if appID == 0 {
+		ghToken, _ := cmd.Flags().GetString("github-token")
+		return ghToken, nil
+	}
+
+	installationID, _ := cmd.Flags().GetInt64("github-app-installation-id")
+	privateKey, _ := cmd.Flags().GetString("github-app-private-key")
+	if installationID == 0 || privateKey == "" {
+		return "", errors.New("--github-app-installation-id and --github-app-private-key are required with --github-app-id")
+	}
+
+	token, owner, err := github.AppInstallationToken(appID, installationID, privateKey)
+	if err != nil {
+		return "", err
+	}
+	github.Owner = owner
+
+	return token, nil
+}
+
+// useExistingRemote clones a pre-existing remote into the workdir with the credentials given instead of creating a repo
+func useExistingRemote(cmd *cobra.Command, clusterName string, gitURL string, workdir string) (string, error) {
+	log.Info("Using existing git remote: ", gitURL)
+	gitSSHKey, _ := cmd.Flags().GetString("git-ssh-key")
+	gitToken, _ := cmd.Flags().GetString("git-token")
+	gitUsername, _ := cmd.Flags().GetString("git-username")
+
+	// HTTPS remotes use the token, everything else uses the ssh key which we copy
+	// to the workdir so it's used just like one we generated
+	privateKeyFile := workdir + "/" + clusterName + "_rsa"
+	if gitToken != "" {
+		gitutils.SetHTTPCredentials(gitURL, gitUsername, gitToken)
+	}
+	if gitSSHKey != "" {
+		err := gitutils.ImportSSHKey(gitSSHKey, clusterName, workdir)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	// The remote might be brand new and empty
+	err := gitutils.CloneOrInitRepo(gitURL, workdir+"/"+clusterName, privateKeyFile)
+	if err != nil {
+		return "", err
+	}
+
+	return gitURL, nil
+}
+
+// gitMirror is an additional remote the GitOps repo gets pushed to
+type gitMirror struct {
+	Name     string
+	URL      string
+	SSHKey   string
+	Username string
+	Password string
+}
+
+// gitMirrors returns the mirrors passed in with their credentials
+func gitMirrors(cmd *cobra.Command) ([]gitMirror, error) {
+	mirrorFlags, _ := cmd.Flags().GetStringArray("git-mirror")
+	sshKeyFlags, _ := cmd.Flags().GetStringArray("git-mirror-ssh-key")
+	credentialFlags, _ := cmd.Flags().GetStringArray("git-mirror-credentials")
+
+	remoteName, _ := cmd.Flags().GetString("git-remote-name")
+	mirrors := []gitMirror{}
+	for _, m := range mirrorFlags {
+		name, url, err := splitKeyValue(m)
+		if err != nil {
+			return nil, err
+		}
+		if name == remoteName {
+			return nil, errors.New("mirror can't have the same name as the git remote: " + name)
+		}
+		mirror := gitMirror{Name: name, URL: url}
+
+		// find the credentials for this mirror (if any)
+		for _, k := range sshKeyFlags {
+			keyName, keyFile, err := splitKeyValue(k)
+			if err != nil {
+				return nil, err
+			}
+			if keyName == name {
+				mirror.SSHKey = keyFile
+			}
+		}
+		for _, c := range credentialFlags {
+			credName, creds, err := splitKeyValue(c)
+			if err != nil {
+				return nil, err
+			}
+			if credName == name {
+				userPass := strings.SplitN(creds, ":", 2)
+				if len(userPass) != 2 {
+					return nil, errors.New("mirror credentials must be in the form name=username:password")
+				}
+				mirror.Username = userPass[0]
+				mirror.Password = userPass[1]
+			}
+		}
+
+		mirrors = append(mirrors, mirror)
+	}
+
+	return mirrors, nil
+}
+
+// splitKeyValue splits a key=value flag
+func splitKeyValue(kv string) (string, string, error) {
+	parts := strings.SplitN(kv, "=", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", errors.New("expected key=value but got: " + kv)
+	}
+	return parts[0], parts[1], nil
+}
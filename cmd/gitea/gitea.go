@@ -0,0 +1,88 @@
+package gitea
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/christianh814/gokp/cmd/gitutils"
+	"github.com/christianh814/gokp/cmd/restapi"
+	log "github.com/sirupsen/logrus"
+)
+
+// giteaRepo is the subset of the Gitea repository object that we care about
+type giteaRepo struct {
+	Name     string `json:"name"`
+	SSHURL   string `json:"ssh_url"`
+	CloneURL string `json:"clone_url"`
+	Owner    struct {
+		Login string `json:"login"`
+	} `json:"owner"`
+}
+
+// CreateRepo takes a name, token, private request, and the base URL of a Gitea instance and creates a repository on it
+func CreateRepo(name *string, token string, private *bool, workdir string, baseurl string) (bool, string, error) {
+	log.Info("Creating Gitea repo for: ", *name)
+	baseurl = strings.TrimSuffix(baseurl, "/")
+
+	// display if a private repo was requested
+	if *private {
+		log.Info("Private repo requested")
+	}
+
+	// create the repo with the options passed. Gitea names the default branch
+	// based on the server config, so we make sure we get the branch we push to
+	r := map[string]interface{}{
+		"name":           *name,
+		"description":    "GitOps repo Cluster " + *name,
+		"private":        *private,
+		"auto_init":      true,
+		"default_branch": gitutils.Branch,
+	}
+	repo := &giteaRepo{}
+	err := doRequest(http.MethodPost, baseurl+"/api/v1/user/repos", token, r, repo)
+	if err != nil {
+		return false, "", err
+	}
+
+	// Create an SSHKeypair for the repo.
+	publicKeyBytes, err := gitutils.GenerateSSHKeypair(*name, workdir)
+	if err != nil {
+		return false, "", err
+	}
+
+	// upload public sshkey as a deploy key
+	err = uploadDeployKey(publicKeyBytes, repo.Owner.Login, *name, token, baseurl)
+	if err != nil {
+		return false, "", err
+	}
+
+	// Get the remote URL and set the name of the local copy
+	repoUrl := repo.SSHURL
+	localRepo := workdir + "/" + *name
+
+	// Clone the repo locally in the working dir (as localRepo)
+	privateKeyFile := workdir + "/" + *name + "_rsa"
+	err = gitutils.CloneRepo(repoUrl, localRepo, privateKeyFile)
+	if err != nil {
+		return false, "", err
+	}
+
+	log.Info("Successfully created new repo: ", repoUrl)
+	return true, repoUrl, nil
+}
+
+// uploadDeployKey uploads deploykey to Gitea with write access
+func uploadDeployKey(publicKeyBytes []byte, repoOwner string, name string, token string, baseurl string) error {
+	key := map[string]interface{}{
+		"title":     "gokp-" + name,
+		"key":       string(publicKeyBytes),
+		"read_only": false,
+	}
+
+	return doRequest(http.MethodPost, baseurl+"/api/v1/repos/"+repoOwner+"/"+name+"/keys", token, key, nil)
+}
+
+// doRequest sends the body as JSON to the Gitea API and decodes the response into out (if not nil)
+func doRequest(method string, url string, token string, body interface{}, out interface{}) error {
+	return restapi.Do("gitea", method, url, restapi.TokenAuth("token", token), body, out)
+}
@@ -0,0 +1,107 @@
+package github
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// AppInstallationToken authenticates as the GitHub App and returns a token for the installation given, along with
+// the account the App is installed on. The token is used in place of a personal access token
+func AppInstallationToken(appID int64, installationID int64, privateKeyFile string) (string, string, error) {
+	log.Info("Authenticating as GitHub App ", appID)
+	jwt, err := appJWT(appID, privateKeyFile)
+	if err != nil {
+		return "", "", err
+	}
+
+	// The App itself authenticates with the JWT
+	ctx := context.Background()
+	client, err := newClient(ctx, jwt)
+	if err != nil {
+		return "", "", err
+	}
+
+	installation, _, err := client.Apps.GetInstallation(ctx, installationID)
+	if err != nil {
+		return "", "", err
+	}
+
+	// Installation tokens can't create repos for a user, only for an organization
+	if installation.GetAccount().GetType() != "Organization" {
+		return "", "", errors.New("GitHub App installation " + strconv.FormatInt(installationID, 10) + " must be on an organization")
+	}
+
+	token, _, err := client.Apps.CreateInstallationToken(ctx, installationID, nil)
+	if err != nil {
+		return "", "", err
+	}
+
+	// If we're here, we should be okay
+	return token.GetToken(), installation.GetAccount().GetLogin(), nil
+}
+
+// appJWT returns the JWT (signed with the App's private key) that GitHub Apps authenticate with
+func appJWT(appID int64, privateKeyFile string) (string, error) {
+	keyBytes, err := ioutil.ReadFile(privateKeyFile)
+	if err != nil {
+		return "", err
+	}
+	key, err := parseRSAPrivateKey(keyBytes)
+	if err != nil {
+		return "", err
+	}
+
+	// Backdate the token a bit in case our clock is off. GitHub allows 10 minutes at most
+	now := time.Now()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]int64{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": appID,
+	})
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	hash := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", err
+	}
+
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// parseRSAPrivateKey parses the PEM encoded private key GitHub gives you for an App
+func parseRSAPrivateKey(keyBytes []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(keyBytes)
+	if block == nil {
+		return nil, errors.New("unable to decode the GitHub App private key")
+	}
+
+	// GitHub hands out PKCS1 keys, but a converted PKCS8 one is fine too
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("the GitHub App private key is not an RSA key")
+	}
+
+	return key, nil
+}
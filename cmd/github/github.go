@@ -1,26 +1,36 @@
 package github
 
 import (
+	"bufio"
 	"context"
-	"crypto/rand"
-	"crypto/rsa"
-	"crypto/x509"
-	"encoding/pem"
-	"io/ioutil"
+	"errors"
+	"fmt"
+	"net/http"
 	"os"
+	"strings"
 	"time"
 
-	"github.com/go-git/go-git/v5"
-	"github.com/go-git/go-git/v5/plumbing/object"
-	plumbingssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/christianh814/gokp/cmd/gitutils"
 	"github.com/google/go-github/v39/github"
 	log "github.com/sirupsen/logrus"
-	"golang.org/x/crypto/ssh"
 	"golang.org/x/oauth2"
 )
 
-// CreateRepo taks a name, token, and a private request and creates a repository on GitHub
-func CreateRepo(name *string, token string, private *bool, workdir string) (bool, string, error) {
+// BaseURL is the URL of the GitHub Enterprise Server to use. GitHub.com is used if empty
+var BaseURL string = ""
+
+// Owner is the organization the repo is created in. The repo is created for the user the token belongs to if empty
+var Owner string = ""
+
+// Teams are the organization teams (by slug) that get access to the repo, with the permission they get (pull, triage, push, maintain, or admin)
+var Teams = map[string]string{}
+
+// CollisionStrategies are the ways we can handle a repo name that is already taken
+var CollisionStrategies = []string{"fail", "suffix", "timestamp", "reuse", "prompt"}
+
+// CreateRepo taks a name, token, and a private request and creates a repository on GitHub.
+// If the repo name is already taken, onCollision decides what to do (see CollisionStrategies)
+func CreateRepo(name *string, token string, private *bool, workdir string, onCollision string) (bool, string, error) {
 	desc := "GitOps repo Cluster " + *name
 	description := &desc
 	autoInit := true
@@ -37,24 +47,47 @@ func CreateRepo(name *string, token string, private *bool, workdir string) (bool
 	//	Description: Description as it will appear on GitHub
 	//	AutoInit: Initialize the repo with the default Readme
 	ctx := context.Background()
-	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
-	tc := oauth2.NewClient(ctx, ts)
-	client := github.NewClient(tc)
+	client, err := newClient(ctx, token)
+	if err != nil {
+		return false, "", err
+	}
 
-	r := &github.Repository{Name: name, Private: private, Description: description, AutoInit: &autoInit}
-	repo, _, err := client.Repositories.Create(ctx, "", r)
+	// Figure out which name to use in case the one we want is taken
+	owner, err := resolveOwner(ctx, client)
+	if err != nil {
+		return false, "", err
+	}
+	repoName, reuse, err := resolveRepoName(ctx, client, owner, *name, onCollision)
+	if err != nil {
+		return false, "", err
+	}
+
+	var repo *github.Repository
+	if reuse {
+		log.Info("Reusing existing empty repo: ", repoName)
+		repo, _, err = client.Repositories.Get(ctx, owner, repoName)
+	} else {
+		r := &github.Repository{Name: &repoName, Private: private, Description: description, AutoInit: &autoInit}
+		repo, _, err = client.Repositories.Create(ctx, Owner, r)
+	}
+	if err != nil {
+		return false, "", err
+	}
+
+	// Give the organization teams access to the repo
+	err = addTeams(ctx, client, repo.GetOwner().GetLogin(), repoName)
 	if err != nil {
 		return false, "", err
 	}
 
 	// Create an SSHKeypair for the repo.
-	publicKeyBytes, err := generateSSHKeypair(*name, workdir)
+	publicKeyBytes, err := gitutils.GenerateSSHKeypair(*name, workdir)
 	if err != nil {
 		return false, "", err
 	}
 
 	// upload public sshkey as a deploy key
-	err = uploadDeployKey(publicKeyBytes, repo.GetOwner().GetLogin(), *name, client)
+	err = uploadDeployKey(publicKeyBytes, repo.GetOwner().GetLogin(), repoName, client)
 	if err != nil {
 		return false, "", err
 	}
@@ -64,28 +97,14 @@ func CreateRepo(name *string, token string, private *bool, workdir string) (bool
 	repoUrl := repo.GetSSHURL()
 	localRepo := workdir + "/" + *name
 
-	// Maksure the localRepo is there
-	os.MkdirAll(localRepo, 0755)
-
-	// Read sshkey to do the clone
+	// Clone the repo locally in the working dir (as localRepo). Empty repos can't be cloned
+	// so we initialize those locally instead
 	privateKeyFile := workdir + "/" + *name + "_rsa"
-	authKey, err := plumbingssh.NewPublicKeysFromFile("git", privateKeyFile, "")
-	if err != nil {
-		return false, "", err
+	if reuse {
+		err = gitutils.InitRepo(repoUrl, localRepo)
+	} else {
+		err = gitutils.CloneRepo(repoUrl, localRepo, privateKeyFile)
 	}
-
-	// Clone the repo locally in the working dir (as localRepo)
-	_, err = git.PlainClone(localRepo, false, &git.CloneOptions{
-		URL:  repoUrl,
-		Auth: authKey,
-		/*
-			Auth: &http.BasicAuth{
-				Username: "unused",
-				Password: token,
-			},
-		*/
-	})
-
 	if err != nil {
 		return false, "", err
 	}
@@ -94,174 +113,312 @@ func CreateRepo(name *string, token string, private *bool, workdir string) (bool
 	return true, repoUrl, nil
 }
 
-// CommitAndPush commits and pushes changes to a github repo that has been changed locally
-func CommitAndPush(dir string, privateKeyFile string, msg string) (bool, error) {
-	// Open the dir for commiting
-	repo, err := git.PlainOpen(dir)
+// UseExistingRepo uses a repo that was already created on GitHub (as owner/name) instead of creating one.
+// A deploy key is added to the repo and it is cloned into the workdir like a newly created one
+func UseExistingRepo(name *string, token string, existingRepo string, workdir string) (bool, string, error) {
+	log.Info("Using existing repo: ", existingRepo)
+	owner, repoName, err := splitRepo(existingRepo)
 	if err != nil {
-		return false, err
+		return false, "", err
 	}
 
-	// create worktree
-	worktree, err := repo.Worktree()
+	ctx := context.Background()
+	client, err := newClient(ctx, token)
 	if err != nil {
-		return false, err
+		return false, "", err
 	}
 
-	// Add all you did to the worktree
-	_, err = worktree.Add("cluster")
+	repo, _, err := client.Repositories.Get(ctx, owner, repoName)
 	if err != nil {
-		return false, err
+		return false, "", err
 	}
 
-	// verify status
-	_, err = worktree.Status()
+	// Create an SSHKeypair for the repo and upload it as a deploy key
+	publicKeyBytes, err := gitutils.GenerateSSHKeypair(*name, workdir)
 	if err != nil {
-		return false, err
+		return false, "", err
+	}
+	err = uploadDeployKey(publicKeyBytes, owner, repoName, client)
+	if err != nil {
+		return false, "", err
 	}
 
-	//Commit
-	_, err = worktree.Commit(msg, &git.CommitOptions{
-		Author: &object.Signature{
-			Name: "gokp-bootstrapper",
-			When: time.Now(),
-		},
-		All: true,
-	})
+	// Clone the repo locally in the working dir (as localRepo). It might still be empty
+	repoUrl := repo.GetSSHURL()
+	privateKeyFile := workdir + "/" + *name + "_rsa"
+	err = gitutils.CloneOrInitRepo(repoUrl, workdir+"/"+*name, privateKeyFile)
 	if err != nil {
-		return false, err
+		return false, "", err
 	}
 
-	// Read sshkey to do the clone
-	authKey, err := plumbingssh.NewPublicKeysFromFile("git", privateKeyFile, "")
+	log.Info("Successfully cloned existing repo: ", repoUrl)
+	return true, repoUrl, nil
+}
+
+// ExistingRepoExists checks that a repo given as owner/name is there
+func ExistingRepoExists(token string, existingRepo string) (bool, error) {
+	owner, repoName, err := splitRepo(existingRepo)
 	if err != nil {
 		return false, err
 	}
 
-	//Push to repo
-	err = repo.Push(&git.PushOptions{
-		RemoteName: "origin",
-		Auth:       authKey,
-		/*
-			Auth: &http.BasicAuth{
-				Username: "unused",
-				Password: token,
-			},
-		*/
-	})
-
+	ctx := context.Background()
+	client, err := newClient(ctx, token)
 	if err != nil {
 		return false, err
 	}
 
-	// If we're here, we should be good
-	log.Info("Successfully pushed commit")
+	return repoExists(ctx, client, owner, repoName)
+}
 
-	return true, nil
+// newClient returns a GitHub client for the token given, pointed at BaseURL if we're talking to GitHub Enterprise Server
+func newClient(ctx context.Context, token string) (*github.Client, error) {
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
+	tc := oauth2.NewClient(ctx, ts)
+	if BaseURL == "" {
+		return github.NewClient(tc), nil
+	}
+
+	// The API (and upload) endpoints live under /api/v3/ of the server, NewEnterpriseClient takes care of that
+	return github.NewEnterpriseClient(BaseURL, BaseURL, tc)
 }
 
-// generateSSHKeypair generates an sshkeypair to use as a deploykey on Github
-func generateSSHKeypair(clustername string, workdir string) ([]byte, error) {
-	key := workdir + "/" + clustername + "_rsa"
-	savePrivateFileTo := key
-	savePublicFileTo := key + ".pub"
-	bitSize := 4096
+// splitRepo splits owner/name into its parts
+func splitRepo(ownerRepo string) (string, string, error) {
+	parts := strings.Split(ownerRepo, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", errors.New("repo must be in the form owner/name: " + ownerRepo)
+	}
+	return parts[0], parts[1], nil
+}
 
-	privateKey, err := generatePrivateKey(bitSize)
+// CheckOrgAccess makes sure the user the token belongs to is allowed to create repos in the organization
+func CheckOrgAccess(token string, org string, private bool) error {
+	ctx := context.Background()
+	client, err := newClient(ctx, token)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	publicKeyBytes, err := generatePublicKey(&privateKey.PublicKey)
+	membership, _, err := client.Organizations.GetOrgMembership(ctx, "", org)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("unable to get your membership of the %s organization: %w", org, err)
+	}
+	if membership.GetState() != "active" {
+		return errors.New("your membership of the " + org + " organization is not active")
 	}
 
-	privateKeyBytes := encodePrivateKeyToPEM(privateKey)
-
-	err = writeKeyToFile(privateKeyBytes, savePrivateFileTo)
+	// Admins can always create repos, members only if the organization allows it
+	if membership.GetRole() == "admin" {
+		return nil
+	}
+	o, _, err := client.Organizations.Get(ctx, org)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if private && !o.GetMembersCanCreatePrivateRepos() {
+		return errors.New("members of the " + org + " organization are not allowed to create private repos")
+	}
+	if !private && !o.GetMembersCanCreatePublicRepos() {
+		return errors.New("members of the " + org + " organization are not allowed to create public repos")
 	}
 
-	err = writeKeyToFile([]byte(publicKeyBytes), savePublicFileTo)
-	if err != nil {
-		return nil, err
+	// If we're here, we should be okay
+	return nil
+}
+
+// addTeams gives the Teams access to the repo
+func addTeams(ctx context.Context, client *github.Client, owner string, name string) error {
+	for slug, permission := range Teams {
+		log.Info("Giving team " + slug + " " + permission + " access to " + owner + "/" + name)
+		_, err := client.Teams.AddTeamRepoBySlug(ctx, owner, slug, owner, name, &github.TeamAddTeamRepoOptions{Permission: permission})
+		if err != nil {
+			return err
+		}
 	}
-	return publicKeyBytes, nil
+	return nil
 }
 
-// generatePrivateKey creates a RSA Private Key of specified byte size
-func generatePrivateKey(bitSize int) (*rsa.PrivateKey, error) {
-	// Private Key generation
-	privateKey, err := rsa.GenerateKey(rand.Reader, bitSize)
-	if err != nil {
-		return nil, err
+// uploadDeployKey uploads deploykey to GitHub
+func uploadDeployKey(publicKeyBytes []byte, repoOwner string, name string, client *github.Client) error {
+	// Set up the github key object based on the key given to use as a []byte
+	mykey := string(publicKeyBytes)
+	key := &github.Key{
+		Key: &mykey,
 	}
 
-	// Validate Private Key
-	err = privateKey.Validate()
+	// upload the deploykey to the repo
+	_, _, err := client.Repositories.CreateKey(context.TODO(), repoOwner, name, key)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return privateKey, nil
+	// if we're here we should be okay
+	return nil
 }
 
-// encodePrivateKeyToPEM encodes Private Key from RSA to PEM format
-func encodePrivateKeyToPEM(privateKey *rsa.PrivateKey) []byte {
-	// Get ASN.1 DER format
-	privDER := x509.MarshalPKCS1PrivateKey(privateKey)
-
-	// pem.Block
-	privBlock := pem.Block{
-		Type:    "RSA PRIVATE KEY",
-		Headers: nil,
-		Bytes:   privDER,
+// resolveOwner returns the account the repo is created under, which is the user the token belongs to unless Owner is set
+func resolveOwner(ctx context.Context, client *github.Client) (string, error) {
+	if Owner != "" {
+		return Owner, nil
 	}
 
-	// Private key in PEM format
-	privatePEM := pem.EncodeToMemory(&privBlock)
-
-	return privatePEM
+	user, _, err := client.Users.Get(ctx, "")
+	if err != nil {
+		return "", err
+	}
+	return user.GetLogin(), nil
 }
 
-// generatePublicKey take a rsa.PublicKey and return bytes suitable for writing to .pub file. Returns in the format "ssh-rsa ..."
-func generatePublicKey(privatekey *rsa.PublicKey) ([]byte, error) {
-	publicRsaKey, err := ssh.NewPublicKey(privatekey)
+// CheckTokenScopes makes sure a classic token has the scope creating the repo and its deploy key needs, which is
+// repo for a private repo or public_repo for a public one. It returns the user the token belongs to. Fine-grained
+// and App tokens don't list scopes, so only that they work is checked
+func CheckTokenScopes(token string, private bool) (string, error) {
+	ctx := context.Background()
+	client, err := newClient(ctx, token)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 
-	pubKeyBytes := ssh.MarshalAuthorizedKey(publicRsaKey)
+	user, resp, err := client.Users.Get(ctx, "")
+	if resp != nil && resp.StatusCode == http.StatusUnauthorized {
+		return "", errors.New("GitHub doesn't take the token, it may have expired")
+	}
+	if err != nil {
+		return "", err
+	}
+	header, ok := resp.Header["X-Oauth-Scopes"]
+	if !ok {
+		return user.GetLogin(), nil
+	}
 
-	return pubKeyBytes, nil
+	scopes := map[string]bool{}
+	for _, h := range header {
+		for _, scope := range strings.Split(h, ",") {
+			scopes[strings.TrimSpace(scope)] = true
+		}
+	}
+	if scopes["repo"] || (!private && scopes["public_repo"]) {
+		return user.GetLogin(), nil
+	}
+	if private {
+		return "", errors.New("the token needs the repo scope to create a private repo")
+	}
+	return "", errors.New("the token needs the repo or public_repo scope to create a repo")
 }
 
-// writePemToFile writes keys to a file
-func writeKeyToFile(keyBytes []byte, saveFileTo string) error {
-	err := ioutil.WriteFile(saveFileTo, keyBytes, 0600)
+// RepoExists returns true if the owner already has a repo with the given name
+func RepoExists(token string, name string) (bool, error) {
+	ctx := context.Background()
+	client, err := newClient(ctx, token)
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	return nil
+	owner, err := resolveOwner(ctx, client)
+	if err != nil {
+		return false, err
+	}
+	return repoExists(ctx, client, owner, name)
 }
 
-// uploadDeployKey uploads deploykey to GitHub
-func uploadDeployKey(publicKeyBytes []byte, repoOwner string, name string, client *github.Client) error {
-	// Set up the github key object based on the key given to use as a []byte
-	mykey := string(publicKeyBytes)
-	key := &github.Key{
-		Key: &mykey,
+// repoExists checks if the repo is already there
+func repoExists(ctx context.Context, client *github.Client, owner string, name string) (bool, error) {
+	_, resp, err := client.Repositories.Get(ctx, owner, name)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return false, nil
 	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
 
-	// upload the deploykey to the repo
-	_, _, err := client.Repositories.CreateKey(context.TODO(), repoOwner, name, key)
+// repoIsEmpty checks if the repo has no commits. GitHub returns a 409 when listing commits of an empty repo
+func repoIsEmpty(ctx context.Context, client *github.Client, owner string, name string) (bool, error) {
+	_, resp, err := client.Repositories.ListCommits(ctx, owner, name, &github.CommitsListOptions{ListOptions: github.ListOptions{PerPage: 1}})
+	if resp != nil && resp.StatusCode == http.StatusConflict {
+		return true, nil
+	}
 	if err != nil {
-		return err
+		return false, err
 	}
+	return false, nil
+}
 
-	// if we're here we should be okay
-	return nil
+// resolveRepoName returns the repo name to use based on the collision strategy, and if an existing repo should be reused
+func resolveRepoName(ctx context.Context, client *github.Client, owner string, name string, onCollision string) (string, bool, error) {
+	exists, err := repoExists(ctx, client, owner, name)
+	if err != nil {
+		return "", false, err
+	}
+	if !exists {
+		return name, false, nil
+	}
+
+	log.Warn("Repo " + owner + "/" + name + " already exists")
+
+	// Ask what to do if we're in interactive mode
+	if onCollision == "prompt" {
+		onCollision, err = promptForCollisionStrategy()
+		if err != nil {
+			return "", false, err
+		}
+	}
+
+	switch onCollision {
+	case "suffix":
+		// try <name>-2, <name>-3, ... until we find one that isn't taken
+		for i := 2; i <= 10; i++ {
+			candidate := fmt.Sprintf("%s-%d", name, i)
+			exists, err := repoExists(ctx, client, owner, candidate)
+			if err != nil {
+				return "", false, err
+			}
+			if !exists {
+				log.Info("Using repo name: ", candidate)
+				return candidate, false, nil
+			}
+		}
+		return "", false, errors.New("unable to find a free repo name for: " + name)
+	case "timestamp":
+		candidate := name + "-" + time.Now().Format("20060102150405")
+		log.Info("Using repo name: ", candidate)
+		return candidate, false, nil
+	case "reuse":
+		empty, err := repoIsEmpty(ctx, client, owner, name)
+		if err != nil {
+			return "", false, err
+		}
+		if !empty {
+			return "", false, errors.New("repo " + owner + "/" + name + " is not empty and can't be reused")
+		}
+		return name, true, nil
+	case "fail":
+		return "", false, errors.New("repo " + owner + "/" + name + " already exists")
+	default:
+		return "", false, errors.New("unknown repo name collision strategy: " + onCollision)
+	}
+}
+
+// promptForCollisionStrategy asks the user what to do with a repo name that is taken
+func promptForCollisionStrategy() (string, error) {
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Print("Repo name is taken. [s]uffix, [t]imestamp, [r]euse (if empty), or [a]bort? ")
+		answer, err := reader.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "s", "suffix":
+			return "suffix", nil
+		case "t", "timestamp":
+			return "timestamp", nil
+		case "r", "reuse":
+			return "reuse", nil
+		case "a", "abort":
+			return "fail", nil
+		}
+	}
 }
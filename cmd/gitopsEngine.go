@@ -0,0 +1,211 @@
+package cmd
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/christianh814/gokp/cmd/argo"
+	"github.com/christianh814/gokp/cmd/templates"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// addGitOpsEngineFlags adds the flags to pick the GitOps controller that gets bootstrapped on the cluster
+func addGitOpsEngineFlags(c *cobra.Command) {
+	c.Flags().String("gitops-engine", "", "The GitOps engine to bootstrap on this cluster (argocd or flux). Takes precedence over --gitops-controller.")
+	c.Flags().String("gitops-controller", "argocd", "The GitOps Controller to use for this cluster.")
+	c.Flags().Bool("sops", false, "Encrypt the secrets written into the GitOps repo with SOPS, for an age key generated for the cluster.")
+	c.Flags().String("argocd-version", "stable", "The Argo CD release to install (e.g. v2.4.7).")
+	c.Flags().Bool("argocd-ha", false, "Install the HA manifests of Argo CD (needs at least 3 worker nodes).")
+	c.Flags().String("argocd-namespace", "", "Namespace to install Argo CD into (defaults to argocd, or argocd-<instance> with --argocd-instance).")
+	c.Flags().String("argocd-instance", "", "Name of this Argo CD instance, for clusters that will host more than one.")
+	c.Flags().String("argocd-expose", "", "Expose the Argo CD UI outside of the cluster with an ingress or a loadbalancer Service.")
+	c.Flags().String("argocd-ingress-host", "", "Hostname of the Argo CD Ingress (needed with --argocd-expose=ingress).")
+	c.Flags().String("argocd-ingress-class", "", "IngressClass of the Argo CD Ingress (defaults to the default IngressClass of the cluster).")
+	c.Flags().String("argocd-ingress-tls-secret", "", "Secret with the TLS certificate for the Argo CD Ingress.")
+	c.Flags().String("argocd-url", "", "External URL of Argo CD, needed for SSO (e.g. https://argocd.example.com). Defaults to the Ingress host.")
+	c.Flags().String("argocd-oidc-issuer", "", "Issuer URL of the OIDC provider Argo CD logs in with.")
+	c.Flags().String("argocd-oidc-client-id", "", "Client ID of Argo CD at the OIDC provider.")
+	c.Flags().String("argocd-oidc-client-secret", "", "Client secret of Argo CD at the OIDC provider.")
+	c.Flags().String("argocd-oidc-groups-claim", "groups", "Claim of the ID token that has the groups of the user.")
+	c.Flags().StringArray("argocd-admin-group", []string{}, "Group (from the OIDC groups claim) that gets the admin role in Argo CD. Can be repeated.")
+	c.Flags().String("argocd-notifications-slack-token", "", "Slack bot token argocd-notifications posts with.")
+	c.Flags().String("argocd-notifications-slack-channel", "", "Slack channel argocd-notifications posts to (needed with --argocd-notifications-slack-token).")
+	c.Flags().String("argocd-notifications-webhook-url", "", "URL argocd-notifications POSTs a JSON message to.")
+	c.Flags().StringArray("argocd-notifications-trigger", []string{"on-sync-failed", "on-health-degraded"}, "Trigger every app is subscribed to (on-sync-failed, on-health-degraded, on-sync-status-unknown, or on-sync-succeeded). Can be repeated.")
+	c.Flags().Bool("rotate-argocd-password", false, "Replace the generated Argo CD admin password with --argocd-password (or a random one).")
+	c.Flags().String("argocd-password", "", "Admin password to set with --rotate-argocd-password.")
+	c.Flags().Bool("skip-argocd-bootstrap-apps", false, "Install only Argo CD, without the Applications/ApplicationSets for the repo (apply them later with \"gokp argocd enable-apps\").")
+}
+
+// gitOpsEngine returns the GitOps controller that was chosen ("argocd" or "fluxcd"). For Argo CD, the options
+// for it (version, HA, SSO) are checked and set for the templates
+func gitOpsEngine(cmd *cobra.Command) (string, error) {
+	engine, _ := cmd.Flags().GetString("gitops-engine")
+	if engine == "" {
+		engine, _ = cmd.Flags().GetString("gitops-controller")
+	}
+
+	templates.SOPS, _ = cmd.Flags().GetBool("sops")
+
+	switch engine {
+	case "argocd", "argo":
+		argocdVersion, _ := cmd.Flags().GetString("argocd-version")
+		argocdHA, _ := cmd.Flags().GetBool("argocd-ha")
+		err := argo.CheckVersion(argocdVersion, argocdHA)
+		if err != nil {
+			return "", err
+		}
+		templates.ArgoCDVersion = argocdVersion
+		templates.ArgoCDHA = argocdHA
+		err = setArgoCDNamespace(cmd)
+		if err != nil {
+			return "", err
+		}
+		argo.SkipBootstrapApps, _ = cmd.Flags().GetBool("skip-argocd-bootstrap-apps")
+		templates.ArgoCDExpose, err = argoCDExposeConfig(cmd)
+		if err != nil {
+			return "", err
+		}
+		templates.ArgoCDOIDC, err = argoCDOIDCConfig(cmd)
+		if err != nil {
+			return "", err
+		}
+		templates.ArgoCDNotifications, err = argoCDNotificationsConfig(cmd)
+		if err != nil {
+			return "", err
+		}
+		return "argocd", nil
+	case "fluxcd", "flux":
+		return "fluxcd", nil
+	}
+
+	return "", errors.New("unrecognized gitops engine: " + engine + " (use argocd or flux)")
+}
+
+// argoCDNamespace returns the namespace Argo CD was installed into, if Argo CD was installed at all
+func argoCDNamespace(gitOpsController string) string {
+	if gitOpsController != "argocd" {
+		return ""
+	}
+	return templates.ArgoCDNamespace
+}
+
+// argoCDVersion returns the Argo CD version that was installed, if Argo CD was installed at all
+func argoCDVersion(gitOpsController string) string {
+	if gitOpsController != "argocd" {
+		return ""
+	}
+	return templates.ArgoCDVersion
+}
+
+// setArgoCDNamespace sets the namespace and instance name of Argo CD from the flags
+func setArgoCDNamespace(cmd *cobra.Command) error {
+	namespace, _ := cmd.Flags().GetString("argocd-namespace")
+	instance, _ := cmd.Flags().GetString("argocd-instance")
+	if namespace == "" {
+		namespace = "argocd"
+		if instance != "" {
+			namespace = "argocd-" + instance
+		}
+	}
+
+	// Both end up in the names of Kubernetes resources
+	for flag, v := range map[string]string{"argocd-namespace": namespace, "argocd-instance": instance} {
+		if v == "" {
+			continue
+		}
+		if errs := validation.IsDNS1123Label(v); len(errs) > 0 {
+			return errors.New("invalid --" + flag + " " + v + ": " + strings.Join(errs, ", "))
+		}
+	}
+
+	templates.ArgoCDNamespace = namespace
+	templates.ArgoCDInstance = instance
+	return nil
+}
+
+// argoCDExposeConfig returns how the Argo CD UI is exposed from the flags, or nil if it isn't
+func argoCDExposeConfig(cmd *cobra.Command) (*templates.ExposeConfig, error) {
+	exposeType, _ := cmd.Flags().GetString("argocd-expose")
+	expose := &templates.ExposeConfig{Type: exposeType}
+	expose.Host, _ = cmd.Flags().GetString("argocd-ingress-host")
+	expose.IngressClass, _ = cmd.Flags().GetString("argocd-ingress-class")
+	expose.TLSSecret, _ = cmd.Flags().GetString("argocd-ingress-tls-secret")
+
+	switch exposeType {
+	case "":
+		return nil, nil
+	case "loadbalancer":
+		return expose, nil
+	case "ingress":
+		if expose.Host == "" {
+			return nil, errors.New("--argocd-expose=ingress requires --argocd-ingress-host")
+		}
+		return expose, nil
+	}
+
+	return nil, errors.New("unrecognized --argocd-expose " + exposeType + " (use ingress or loadbalancer)")
+}
+
+// argoCDOIDCConfig returns the OIDC config for Argo CD from the flags, or nil if no issuer was given
+func argoCDOIDCConfig(cmd *cobra.Command) (*templates.OIDCConfig, error) {
+	issuer, _ := cmd.Flags().GetString("argocd-oidc-issuer")
+	if issuer == "" {
+		return nil, nil
+	}
+
+	oidc := &templates.OIDCConfig{Issuer: issuer}
+	oidc.URL, _ = cmd.Flags().GetString("argocd-url")
+	oidc.ClientID, _ = cmd.Flags().GetString("argocd-oidc-client-id")
+	oidc.ClientSecret, _ = cmd.Flags().GetString("argocd-oidc-client-secret")
+	oidc.GroupsClaim, _ = cmd.Flags().GetString("argocd-oidc-groups-claim")
+	oidc.AdminGroups, _ = cmd.Flags().GetStringArray("argocd-admin-group")
+
+	// The Ingress host is where Argo CD is reached, unless told otherwise
+	if oidc.URL == "" && templates.ArgoCDExpose != nil && templates.ArgoCDExpose.Host != "" {
+		oidc.URL = "http://" + templates.ArgoCDExpose.Host
+		if templates.ArgoCDExpose.TLSSecret != "" {
+			oidc.URL = "https://" + templates.ArgoCDExpose.Host
+		}
+	}
+
+	if oidc.URL == "" || oidc.ClientID == "" || oidc.ClientSecret == "" {
+		return nil, errors.New("--argocd-oidc-issuer requires --argocd-url, --argocd-oidc-client-id, and --argocd-oidc-client-secret")
+	}
+	if len(oidc.AdminGroups) == 0 {
+		log.Warn("No --argocd-admin-group given, everyone logging in with SSO will only be able to read")
+	}
+
+	return oidc, nil
+}
+
+// argoCDNotificationsConfig returns the argocd-notifications config from the flags, or nil if there's nowhere to send to
+func argoCDNotificationsConfig(cmd *cobra.Command) (*templates.NotificationsConfig, error) {
+	notifications := &templates.NotificationsConfig{}
+	notifications.SlackToken, _ = cmd.Flags().GetString("argocd-notifications-slack-token")
+	notifications.SlackChannel, _ = cmd.Flags().GetString("argocd-notifications-slack-channel")
+	notifications.WebhookURL, _ = cmd.Flags().GetString("argocd-notifications-webhook-url")
+	triggers, _ := cmd.Flags().GetStringArray("argocd-notifications-trigger")
+
+	if notifications.SlackToken == "" && notifications.WebhookURL == "" {
+		return nil, nil
+	}
+	if notifications.SlackToken != "" && notifications.SlackChannel == "" {
+		return nil, errors.New("--argocd-notifications-slack-token requires --argocd-notifications-slack-channel")
+	}
+
+	for _, name := range triggers {
+		trigger, ok := templates.NotificationTriggers[name]
+		if !ok {
+			return nil, errors.New("unrecognized --argocd-notifications-trigger " + name)
+		}
+		notifications.Triggers = append(notifications.Triggers, trigger)
+	}
+	if len(notifications.Triggers) == 0 {
+		return nil, errors.New("at least one --argocd-notifications-trigger is needed")
+	}
+
+	return notifications, nil
+}
@@ -0,0 +1,612 @@
+package gitutils
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	plumbingssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// githubKnownHosts is the known_hosts entry for github.com
+var githubKnownHosts string = "github.com ecdsa-sha2-nistp256 AAAAE2VjZHNhLXNoYTItbmlzdHAyNTYAAAAIbmlzdHAyNTYAAABBBEmKSENjQEezOmxkZMy7opKgwFB9nkt5YRrYMjNuG5N87uRgg6CLrbo5wAdT/y6v0mKV0U2w0WZ2YB/++Tpockg="
+
+// RemoteName is the name of the remote the GitOps repo is cloned from
+var RemoteName string = "origin"
+
+// Branch is the branch of the GitOps repo that GOKP pushes to and that the GitOps controller follows
+var Branch string = "main"
+
+// RepoPath is the subdirectory of the GitOps repo that GOKP writes to (the root of the repo if empty)
+var RepoPath string = ""
+
+// KnownHostsFile is the known_hosts file the host keys of the git host are taken from (~/.ssh/known_hosts if empty)
+var KnownHostsFile string = ""
+
+// TrustHostKey lets the host keys of a git host that isn't in the known_hosts file be taken from the host itself
+var TrustHostKey bool = false
+
+// sshKeys holds the private key file to use for remotes that don't use the default key, keyed by the remote URL
+var sshKeys = map[string]string{}
+
+// httpCredentials holds the username/password to use for remotes we talk to over HTTPS, keyed by the remote URL
+var httpCredentials = map[string]*http.BasicAuth{}
+
+// BaseDir returns the directory of the local clone (repoDir) that the "cluster" dir is written to
+func BaseDir(repoDir string) string {
+	if RepoPath == "" {
+		return repoDir
+	}
+	return repoDir + "/" + RepoPath
+}
+
+// ClusterPath returns the path of the "cluster" dir relative to the root of the GitOps repo
+func ClusterPath() string {
+	return path.Join(RepoPath, "cluster")
+}
+
+// SetHTTPCredentials sets the username/password used when talking to the given remote over HTTPS
+func SetHTTPCredentials(repoUrl string, username string, password string) {
+	httpCredentials[repoUrl] = &http.BasicAuth{
+		Username: username,
+		Password: password,
+	}
+}
+
+// SetSSHKey sets the private key file used when talking to the given remote over SSH
+func SetSSHKey(repoUrl string, privateKeyFile string) {
+	sshKeys[repoUrl] = privateKeyFile
+}
+
+// GetHTTPCredentials returns the username/password set for the given remote (if any)
+func GetHTTPCredentials(repoUrl string) (string, string, bool) {
+	creds, ok := httpCredentials[repoUrl]
+	if !ok {
+		return "", "", false
+	}
+	return creds.Username, creds.Password, true
+}
+
+// CloneRepo clones the given remote into the localRepo dir using the private key provided
+func CloneRepo(repoUrl string, localRepo string, privateKeyFile string) error {
+	// Maksure the localRepo is there
+	os.MkdirAll(localRepo, 0755)
+
+	// Read sshkey (or credentials) to do the clone
+	authKey, err := authForRemote(repoUrl, privateKeyFile)
+	if err != nil {
+		return err
+	}
+
+	// Clone the repo locally in the working dir (as localRepo)
+	repo, err := git.PlainClone(localRepo, false, &git.CloneOptions{
+		URL:        repoUrl,
+		Auth:       authKey,
+		RemoteName: RemoteName,
+	})
+	if err != nil {
+		return err
+	}
+
+	return checkoutBranch(repo)
+}
+
+// checkoutBranch makes sure the local repo is on Branch, creating it if the remote doesn't have it yet
+func checkoutBranch(repo *git.Repository) error {
+	head, err := repo.Head()
+	if err != nil {
+		return err
+	}
+	branchRef := plumbing.NewBranchReferenceName(Branch)
+	if head.Name() == branchRef {
+		return nil
+	}
+
+	// Start from the branch on the remote if it's there, otherwise branch off of what we cloned
+	hash := head.Hash()
+	if ref, err := repo.Reference(plumbing.NewRemoteReferenceName(RemoteName, Branch), true); err == nil {
+		hash = ref.Hash()
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+	return worktree.Checkout(&git.CheckoutOptions{
+		Branch: branchRef,
+		Hash:   hash,
+		Create: true,
+	})
+}
+
+// CloneOrInitRepo clones the given remote into the localRepo dir, or initializes the localRepo if the remote is empty
+func CloneOrInitRepo(repoUrl string, localRepo string, privateKeyFile string) error {
+	err := CloneRepo(repoUrl, localRepo, privateKeyFile)
+	if err == transport.ErrEmptyRemoteRepository {
+		// Clean up what the failed clone left behind before starting over
+		os.RemoveAll(localRepo)
+		return InitRepo(repoUrl, localRepo)
+	}
+	return err
+}
+
+// InitRepo initializes an empty local repo in the localRepo dir with the given remote as "origin".
+// This is used for providers that don't support initializing the repo on creation
+func InitRepo(repoUrl string, localRepo string) error {
+	// Maksure the localRepo is there
+	os.MkdirAll(localRepo, 0755)
+
+	repo, err := git.PlainInit(localRepo, false)
+	if err != nil {
+		return err
+	}
+
+	// Make sure we are on Branch since that's what the GitOps controllers are pointed at
+	err = repo.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, plumbing.NewBranchReferenceName(Branch)))
+	if err != nil {
+		return err
+	}
+
+	// Add the remote
+	_, err = repo.CreateRemote(&config.RemoteConfig{
+		Name: RemoteName,
+		URLs: []string{repoUrl},
+	})
+
+	return err
+}
+
+// AddRemote adds an additional remote (e.g. a mirror) to the local repo. Every remote gets pushed to on CommitAndPush
+func AddRemote(dir string, name string, repoUrl string) error {
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return err
+	}
+
+	_, err = repo.CreateRemote(&config.RemoteConfig{
+		Name: name,
+		URLs: []string{repoUrl},
+	})
+
+	return err
+}
+
+// RemoteURLs returns the URLs of every remote the local repo in dir has
+func RemoteURLs(dir string) ([]string, error) {
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	remotes, err := repo.Remotes()
+	if err != nil {
+		return nil, err
+	}
+
+	urls := []string{}
+	for _, remote := range remotes {
+		urls = append(urls, remote.Config().URLs...)
+	}
+
+	return urls, nil
+}
+
+// Commit is a commit of the GitOps repo
+type Commit struct {
+	Hash    string    `json:"hash"`
+	Author  string    `json:"author"`
+	Message string    `json:"message"`
+	When    time.Time `json:"when"`
+}
+
+// LastCommit returns the commit the local repo in dir is on
+func LastCommit(dir string) (*Commit, error) {
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return nil, err
+	}
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil, err
+	}
+
+	return &Commit{
+		Hash:    commit.Hash.String(),
+		Author:  commit.Author.Name,
+		Message: strings.TrimSpace(commit.Message),
+		When:    commit.Author.When,
+	}, nil
+}
+
+// HasChanges returns true if the local repo in dir has changes that haven't been committed yet
+func HasChanges(dir string) (bool, error) {
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return false, err
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return false, err
+	}
+
+	status, err := worktree.Status()
+	if err != nil {
+		return false, err
+	}
+
+	return !status.IsClean(), nil
+}
+
+// CommitAndPush commits and pushes changes to a git repo that has been changed locally
+func CommitAndPush(dir string, privateKeyFile string, msg string) (bool, error) {
+	// Open the dir for commiting
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return false, err
+	}
+
+	// create worktree
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return false, err
+	}
+
+	// Add all you did to the worktree (everything under the part of the repo GOKP manages)
+	managed := RepoPath
+	if managed == "" {
+		managed = "."
+	}
+	_, err = worktree.Add(managed)
+	if err != nil {
+		return false, err
+	}
+
+	// verify status
+	_, err = worktree.Status()
+	if err != nil {
+		return false, err
+	}
+
+	//Commit
+	_, err = worktree.Commit(msg, &git.CommitOptions{
+		Author: &object.Signature{
+			Name: "gokp-bootstrapper",
+			When: time.Now(),
+		},
+		All: true,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	// Push to every remote the repo has (the GitOps repo plus any mirrors)
+	remotes, err := repo.Remotes()
+	if err != nil {
+		return false, err
+	}
+	for _, remote := range remotes {
+		// Read sshkey (or credentials) of the remote to do the push
+		authKey, err := authForRemote(remote.Config().URLs[0], privateKeyFile)
+		if err != nil {
+			return false, err
+		}
+
+		//Push to repo
+		err = repo.Push(&git.PushOptions{
+			RemoteName: remote.Config().Name,
+			Auth:       authKey,
+			RefSpecs:   []config.RefSpec{config.RefSpec("refs/heads/" + Branch + ":refs/heads/" + Branch)},
+		})
+
+		if err != nil && err != git.NoErrAlreadyUpToDate {
+			return false, err
+		}
+
+		// If we're here, we should be good
+		log.Info("Successfully pushed commit to ", remote.Config().Name)
+	}
+
+	return true, nil
+}
+
+// authForRemote returns the auth method to use for the remote. HTTPS remotes use the credentials that were set
+// with SetHTTPCredentials (or none at all), everything else uses the key set with SetSSHKey or the private key file
+func authForRemote(repoUrl string, privateKeyFile string) (transport.AuthMethod, error) {
+	if strings.HasPrefix(repoUrl, "https://") || strings.HasPrefix(repoUrl, "http://") {
+		if creds, ok := httpCredentials[repoUrl]; ok {
+			return creds, nil
+		}
+		return nil, nil
+	}
+	if keyFile, ok := sshKeys[repoUrl]; ok {
+		privateKeyFile = keyFile
+	}
+	return plumbingssh.NewPublicKeysFromFile("git", privateKeyFile, "")
+}
+
+// ImportSSHKey copies an existing private key into the workdir (as <clustername>_rsa) and writes out its public key.
+// This lets an existing key be used the same way as one we generated
+func ImportSSHKey(keyFile string, clustername string, workdir string) error {
+	privateKeyBytes, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return err
+	}
+
+	signer, err := ssh.ParsePrivateKey(privateKeyBytes)
+	if err != nil {
+		return err
+	}
+
+	key := workdir + "/" + clustername + "_rsa"
+	err = writeKeyToFile(privateKeyBytes, key)
+	if err != nil {
+		return err
+	}
+
+	return writeKeyToFile(ssh.MarshalAuthorizedKey(signer.PublicKey()), key+".pub")
+}
+
+// KnownHosts returns the known_hosts entries for the host of the given ssh remote URL (e.g. git@host:org/repo.git).
+// They're taken from KnownHostsFile, or from the host itself if it isn't in there and TrustHostKey is set
+func KnownHosts(repoUrl string) (string, error) {
+	host, err := sshHost(repoUrl)
+	if err != nil {
+		return "", err
+	}
+
+	// We know GitHub's
+	if host == "github.com:22" {
+		return githubKnownHosts, nil
+	}
+
+	lines, err := knownHostsFromFile(host)
+	if err != nil {
+		return "", err
+	}
+	if len(lines) != 0 {
+		return strings.Join(lines, "\n"), nil
+	}
+
+	// Whatever answers is who we end up trusting, so only do this if we were told to
+	if !TrustHostKey {
+		return "", errors.New("the ssh host key of " + host + " isn't in " + knownHostsPath() + ", add it there, pass a known_hosts file with --git-known-hosts, or trust the key the host sends with --git-trust-host-key")
+	}
+
+	// Grab the keys the server has so the GitOps controller can verify it no matter which it negotiates
+	for _, algo := range []string{ssh.KeyAlgoED25519, ssh.KeyAlgoECDSA256, ssh.KeyAlgoRSASHA256} {
+		var hostKey ssh.PublicKey
+		config := &ssh.ClientConfig{
+			User:              "git",
+			HostKeyAlgorithms: []string{algo},
+			HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+				hostKey = key
+				return nil
+			},
+			Timeout: 10 * time.Second,
+		}
+		// The handshake fails after the host key is received since we don't authenticate, that's okay
+		conn, err := ssh.Dial("tcp", host, config)
+		if err == nil {
+			conn.Close()
+		}
+		if hostKey != nil {
+			log.Warn("Trusting the ", hostKey.Type(), " host key of ", host, ": ", ssh.FingerprintSHA256(hostKey))
+			lines = append(lines, knownhosts.Line([]string{knownhosts.Normalize(host)}, hostKey))
+		}
+	}
+
+	if len(lines) == 0 {
+		return "", errors.New("unable to get the ssh host keys of " + host)
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// knownHostsPath returns the path of the known_hosts file to use
+func knownHostsPath() string {
+	if KnownHostsFile != "" {
+		return KnownHostsFile
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".ssh/known_hosts"
+	}
+	return home + "/.ssh/known_hosts"
+}
+
+// knownHostsFromFile returns the known_hosts entries the known_hosts file has for the host (as host:port). A missing
+// ~/.ssh/known_hosts just means there are none
+func knownHostsFromFile(host string) ([]string, error) {
+	file := knownHostsPath()
+	if _, err := os.Stat(file); os.IsNotExist(err) && KnownHostsFile == "" {
+		return nil, nil
+	}
+
+	// Let the knownhosts package do the matching so hashed hostnames and patterns work too
+	check, err := knownhosts.New(file)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := []string{}
+	seen := map[string]bool{}
+	for len(data) > 0 {
+		marker, _, key, _, rest, err := ssh.ParseKnownHosts(data)
+		// Nothing left but comments and blank lines
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		data = rest
+
+		// Skip revoked keys and certificate authorities
+		if marker != "" {
+			continue
+		}
+		// The same key can be in there more than once (e.g. for the name and the IP of the host)
+		line := knownhosts.Line([]string{knownhosts.Normalize(host)}, key)
+		if check(host, &net.TCPAddr{}, key) == nil && !seen[line] {
+			seen[line] = true
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
+
+// IsGitHub returns true if the ssh remote URL points at github.com, whose host keys everyone already knows
+func IsGitHub(repoUrl string) bool {
+	host, err := sshHost(repoUrl)
+	return err == nil && host == "github.com:22"
+}
+
+// SSHURL returns the ssh remote URL as an ssh:// URL (e.g. git@host:org/repo.git becomes ssh://git@host/org/repo.git),
+// which is the only kind Flux takes. ssh:// URLs, which can have a port, are returned as is
+func SSHURL(repoUrl string) string {
+	if strings.HasPrefix(repoUrl, "ssh://") {
+		return repoUrl
+	}
+	return "ssh://" + strings.Replace(repoUrl, ":", "/", 1)
+}
+
+// sshHost returns the host:port of an ssh remote URL
+func sshHost(repoUrl string) (string, error) {
+	// ssh://git@host:port/org/repo.git
+	if strings.HasPrefix(repoUrl, "ssh://") {
+		u, err := url.Parse(repoUrl)
+		if err != nil {
+			return "", err
+		}
+		if u.Port() == "" {
+			return u.Hostname() + ":22", nil
+		}
+		return u.Host, nil
+	}
+
+	// git@host:org/repo.git
+	hostPart := strings.SplitN(repoUrl, ":", 2)[0]
+	if at := strings.LastIndex(hostPart, "@"); at != -1 {
+		hostPart = hostPart[at+1:]
+	}
+	if hostPart == "" || hostPart == repoUrl {
+		return "", errors.New("unable to find the host of: " + repoUrl)
+	}
+	return hostPart + ":22", nil
+}
+
+// GenerateSSHKeypair generates an sshkeypair to use as a deploykey on the git provider
+func GenerateSSHKeypair(clustername string, workdir string) ([]byte, error) {
+	key := workdir + "/" + clustername + "_rsa"
+	savePrivateFileTo := key
+	savePublicFileTo := key + ".pub"
+	bitSize := 4096
+
+	privateKey, err := generatePrivateKey(bitSize)
+	if err != nil {
+		return nil, err
+	}
+
+	publicKeyBytes, err := generatePublicKey(&privateKey.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKeyBytes := encodePrivateKeyToPEM(privateKey)
+
+	err = writeKeyToFile(privateKeyBytes, savePrivateFileTo)
+	if err != nil {
+		return nil, err
+	}
+
+	err = writeKeyToFile([]byte(publicKeyBytes), savePublicFileTo)
+	if err != nil {
+		return nil, err
+	}
+	return publicKeyBytes, nil
+}
+
+// generatePrivateKey creates a RSA Private Key of specified byte size
+func generatePrivateKey(bitSize int) (*rsa.PrivateKey, error) {
+	// Private Key generation
+	privateKey, err := rsa.GenerateKey(rand.Reader, bitSize)
+	if err != nil {
+		return nil, err
+	}
+
+	// Validate Private Key
+	err = privateKey.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return privateKey, nil
+}
+
+// encodePrivateKeyToPEM encodes Private Key from RSA to PEM format
+func encodePrivateKeyToPEM(privateKey *rsa.PrivateKey) []byte {
+	// Get ASN.1 DER format
+	privDER := x509.MarshalPKCS1PrivateKey(privateKey)
+
+	// pem.Block
+	privBlock := pem.Block{
+		Type:    "RSA PRIVATE KEY",
+		Headers: nil,
+		Bytes:   privDER,
+	}
+
+	// Private key in PEM format
+	privatePEM := pem.EncodeToMemory(&privBlock)
+
+	return privatePEM
+}
+
+// generatePublicKey take a rsa.PublicKey and return bytes suitable for writing to .pub file. Returns in the format "ssh-rsa ..."
+func generatePublicKey(privatekey *rsa.PublicKey) ([]byte, error) {
+	publicRsaKey, err := ssh.NewPublicKey(privatekey)
+	if err != nil {
+		return nil, err
+	}
+
+	pubKeyBytes := ssh.MarshalAuthorizedKey(publicRsaKey)
+
+	return pubKeyBytes, nil
+}
+
+// writePemToFile writes keys to a file
+func writeKeyToFile(keyBytes []byte, saveFileTo string) error {
+	err := ioutil.WriteFile(saveFileTo, keyBytes, 0600)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
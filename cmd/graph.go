@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/christianh814/gokp/cmd/graph"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// graphCmd represents the graph command
+var graphCmd = &cobra.Command{
+	Use:   "graph",
+	Short: "Renders a graph of what GOKP created on a cluster",
+	Long: `Renders the Argo CD Application/ApplicationSet dependency graph together
+with the CAPI object tree of a GOKP cluster in DOT or SVG format. Applications
+point to the Applications and objects they manage (from the tracking label or
+annotation of Argo CD), and objects are shown as kind/namespace/name. For
+example:
+
+gokp graph --cluster-name=mycluster > mycluster.dot
+gokp graph --cluster-name=mycluster --format=svg --output=mycluster.svg
+
+Rendering SVG requires graphviz (the "dot" command) to be installed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		// Grab flags
+		clusterName, _ := cmd.Flags().GetString("cluster-name")
+		CapiCfg, _ := cmd.Flags().GetString("kubeconfig")
+		format, _ := cmd.Flags().GetString("format")
+		output, _ := cmd.Flags().GetString("output")
+
+		// Default to the kubeconfig that was saved at install time
+		if CapiCfg == "" {
+			var err error
+			CapiCfg, err = clusterSecretFile(clusterName, clusterName+".kubeconfig")
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		dot, err := graph.GenerateGraph(CapiCfg)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// DOT can just go to stdout if no file was given
+		if output == "" {
+			if format != "dot" {
+				log.Fatal("--output is required for the " + format + " format")
+			}
+			fmt.Print(dot)
+			return
+		}
+
+		err = graph.WriteGraph(dot, output, format)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Info("Graph written to: " + output)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(graphCmd)
+
+	graphCmd.Flags().String("cluster-name", "", "Name of the gokp cluster.")
+	graphCmd.Flags().String("kubeconfig", "", "Path to the Kubeconfig file of the gokp cluster (defaults to the one under ~/.gokp).")
+	graphCmd.Flags().String("format", "dot", "Format of the graph (dot or svg).")
+	graphCmd.Flags().String("output", "", "File to write the graph to (defaults to stdout for dot).")
+
+	graphCmd.MarkFlagRequired("cluster-name")
+}
@@ -0,0 +1,251 @@
+package graph
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"sort"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// GraphResources are the resources that make up the graph, in the order they are listed
+var GraphResources = []schema.GroupVersionResource{
+	{Group: "argoproj.io", Version: "v1alpha1", Resource: "appprojects"},
+	{Group: "argoproj.io", Version: "v1alpha1", Resource: "applicationsets"},
+	{Group: "argoproj.io", Version: "v1alpha1", Resource: "applications"},
+	{Group: "cluster.x-k8s.io", Version: "v1beta1", Resource: "clusters"},
+	{Group: "controlplane.cluster.x-k8s.io", Version: "v1beta1", Resource: "kubeadmcontrolplanes"},
+	{Group: "cluster.x-k8s.io", Version: "v1beta1", Resource: "machinedeployments"},
+	{Group: "cluster.x-k8s.io", Version: "v1beta1", Resource: "machinesets"},
+	{Group: "cluster.x-k8s.io", Version: "v1beta1", Resource: "machines"},
+}
+
+// TrackingLabel and TrackingAnnotation are how Argo CD marks the objects an Application manages, depending on its
+// resourceTrackingMethod. The label is the name of the Application, the annotation is
+// <application>:<group>/<kind>:<namespace>/<name>. An Application in another namespace than Argo CD's is named
+// <namespace>_<name>
+var (
+	TrackingLabel      string = "app.kubernetes.io/instance"
+	TrackingAnnotation string = "argocd.argoproj.io/tracking-id"
+)
+
+// refPaths are where CAPI objects reference the objects they're made of, under spec
+var refPaths = [][]string{
+	{"infrastructureRef"},
+	{"controlPlaneRef"},
+	{"machineTemplate", "infrastructureRef"},
+	{"template", "spec", "infrastructureRef"},
+}
+
+// Graph is a simple directed graph of Kubernetes objects, keyed by kind/namespace/name (kind/name if they're
+// cluster wide)
+type Graph struct {
+	Nodes map[string]bool
+	Edges map[string]bool
+}
+
+// GenerateGraph queries the cluster for the Argo CD and CAPI objects GOKP created and returns the graph in DOT format
+func GenerateGraph(capicfg string) (string, error) {
+	kubeConfig, err := clientcmd.BuildConfigFromFlags("", capicfg)
+	if err != nil {
+		return "", err
+	}
+	dyn, err := dynamic.NewForConfig(kubeConfig)
+	if err != nil {
+		return "", err
+	}
+
+	g := &Graph{
+		Nodes: map[string]bool{},
+		Edges: map[string]bool{},
+	}
+
+	objs := []unstructured.Unstructured{}
+	for _, gvr := range GraphResources {
+		list, err := dyn.Resource(gvr).List(context.TODO(), metav1.ListOptions{})
+		if err != nil {
+			// Not every cluster has every CRD (e.g. Flux instead of Argo CD)
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return "", err
+		}
+		objs = append(objs, list.Items...)
+	}
+	g.addObjects(objs)
+
+	return g.Dot(), nil
+}
+
+// addObjects adds the objects and the relationships they have to the graph. Every Application has to be known
+// before the objects it manages are added, so they're linked to it
+func (g *Graph) addObjects(objs []unstructured.Unstructured) {
+	apps := map[string][]string{}
+	for _, obj := range objs {
+		if obj.GetKind() == "Application" {
+			apps[obj.GetName()] = append(apps[obj.GetName()], nodeName("Application", obj.GetNamespace(), obj.GetName()))
+		}
+	}
+
+	for _, obj := range objs {
+		g.addObject(obj, apps)
+	}
+}
+
+// addObject adds the object and the relationships it has to the graph
+func (g *Graph) addObject(obj unstructured.Unstructured, apps map[string][]string) {
+	namespace := obj.GetNamespace()
+	node := nodeName(obj.GetKind(), namespace, obj.GetName())
+	g.Nodes[node] = true
+
+	// Owners point to the object they own (e.g. ApplicationSet -> Application, MachineSet -> Machine). They're
+	// always in the same namespace
+	for _, owner := range obj.GetOwnerReferences() {
+		g.addEdge(nodeName(owner.Kind, namespace, owner.Name), node)
+	}
+
+	// Applications point to what they manage (e.g. the app of apps -> its Applications)
+	if app := trackedBy(obj, apps); app != "" {
+		g.addEdge(app, node)
+	}
+
+	// Follow the references CAPI and Argo CD objects have to other objects. Unless they say otherwise, they're in
+	// the same namespace
+	for _, path := range refPaths {
+		ref, ok, _ := unstructured.NestedMap(obj.Object, append([]string{"spec"}, path...)...)
+		if !ok {
+			continue
+		}
+		kind, _, _ := unstructured.NestedString(ref, "kind")
+		name, _, _ := unstructured.NestedString(ref, "name")
+		refNamespace, _, _ := unstructured.NestedString(ref, "namespace")
+		if refNamespace == "" {
+			refNamespace = namespace
+		}
+		if kind != "" && name != "" {
+			g.addEdge(node, nodeName(kind, refNamespace, name))
+		}
+	}
+	if obj.GetKind() == "Application" {
+		if project, _, _ := unstructured.NestedString(obj.Object, "spec", "project"); project != "" {
+			g.addEdge(nodeName("AppProject", namespace, project), node)
+		}
+	}
+}
+
+// trackedBy returns the node of the Application that manages the object, from the tracking annotation or label
+// Argo CD put on it, or empty if none of the apps (by name) do. The label is only a name, which Helm charts set
+// too, so it only counts if there's an Application by that name
+func trackedBy(obj unstructured.Unstructured, apps map[string][]string) string {
+	name := ""
+	if id := obj.GetAnnotations()[TrackingAnnotation]; id != "" {
+		name = strings.SplitN(id, ":", 2)[0]
+	} else {
+		name = obj.GetLabels()[TrackingLabel]
+	}
+	if name == "" {
+		return ""
+	}
+
+	// An Application outside of the namespace of Argo CD says which one it's in. Otherwise the one in the same
+	// namespace as the object is picked if there's more than one by that name
+	app := ""
+	if parts := strings.SplitN(name, "_", 2); len(parts) == 2 {
+		app = nodeName("Application", parts[0], parts[1])
+		if !contains(apps[parts[1]], app) {
+			return ""
+		}
+	} else if len(apps[name]) == 1 {
+		app = apps[name][0]
+	} else if contains(apps[name], nodeName("Application", obj.GetNamespace(), name)) {
+		app = nodeName("Application", obj.GetNamespace(), name)
+	}
+
+	// Argo CD tracks the Application it created itself with, which isn't a child of it
+	if app == nodeName(obj.GetKind(), obj.GetNamespace(), obj.GetName()) {
+		return ""
+	}
+	return app
+}
+
+// contains returns true if the node is one of the nodes
+func contains(nodes []string, node string) bool {
+	for _, n := range nodes {
+		if n == node {
+			return true
+		}
+	}
+	return false
+}
+
+// addEdge adds an edge (and the nodes on both ends) to the graph
+func (g *Graph) addEdge(from string, to string) {
+	g.Nodes[from] = true
+	g.Nodes[to] = true
+	g.Edges[fmt.Sprintf("%q -> %q", from, to)] = true
+}
+
+// Dot renders the graph in the DOT language
+func (g *Graph) Dot() string {
+	var b bytes.Buffer
+	b.WriteString("digraph gokp {\n")
+	b.WriteString("  rankdir=LR;\n")
+	b.WriteString("  node [shape=box];\n")
+	for _, n := range sortedKeys(g.Nodes) {
+		b.WriteString(fmt.Sprintf("  %q;\n", n))
+	}
+	for _, e := range sortedKeys(g.Edges) {
+		b.WriteString("  " + e + ";\n")
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// WriteGraph writes the DOT graph to the given file in the requested format. SVG needs graphviz' "dot" in your PATH
+func WriteGraph(dot string, file string, format string) error {
+	switch format {
+	case "dot":
+		return ioutil.WriteFile(file, []byte(dot), 0644)
+	case "svg":
+		if _, err := exec.LookPath("dot"); err != nil {
+			return fmt.Errorf("graphviz is needed to render svg: %w", err)
+		}
+		c := exec.Command("dot", "-Tsvg", "-o", file)
+		c.Stdin = strings.NewReader(dot)
+		out, err := c.CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("unable to render svg: %s: %w", string(out), err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown graph format: %s", format)
+	}
+}
+
+// nodeName returns the name of the node as displayed in the graph, which tells apart objects with the same name in
+// different namespaces
+func nodeName(kind string, namespace string, name string) string {
+	if namespace == "" {
+		return kind + "/" + name
+	}
+	return kind + "/" + namespace + "/" + name
+}
+
+// sortedKeys returns the keys of the map sorted so the output is stable
+func sortedKeys(m map[string]bool) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/christianh814/gokp/cmd/wizard"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/term"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// guardrailsConfig is the guardrails section of the config file
+type guardrailsConfig struct {
+	// ProtectedContexts are the patterns of the kube-contexts (or the clusters they point at) that GOKP asks about
+	// before changing anything on. * matches anything, and ? any one character
+	ProtectedContexts []string `mapstructure:"protectedContexts"`
+
+	// AllowedContexts are the patterns of the ones that are never asked about, even if they're protected
+	AllowedContexts []string `mapstructure:"allowedContexts"`
+}
+
+// guardrails are the patterns kube-contexts are checked against, anything with prod in its name is protected unless
+// the config file says otherwise
+var guardrails = guardrailsConfig{
+	ProtectedContexts: []string{"*prod*"},
+	AllowedContexts:   []string{},
+}
+
+// setGuardrails sets the patterns of the guardrails section of the config file, if it has one:
+//
+//	guardrails:
+//	  protectedContexts:
+//	  - "*prod*"
+//	  - "arn:aws:eks:*:123456789012:cluster/*"
+//	  allowedContexts:
+//	  - prod-sandbox
+func setGuardrails() error {
+	if !viper.IsSet("guardrails") {
+		return nil
+	}
+	cfg := guardrailsConfig{}
+	err := viper.UnmarshalKey("guardrails", &cfg)
+	if err != nil {
+		return err
+	}
+
+	for _, pattern := range append(append([]string{}, cfg.ProtectedContexts...), cfg.AllowedContexts...) {
+		if strings.TrimSpace(pattern) == "" {
+			return errors.New("empty pattern under guardrails in the config file")
+		}
+	}
+	guardrails = cfg
+	return nil
+}
+
+// addGuardrailFlags adds the flag that skips the question asked before running against a protected kube-context
+func addGuardrailFlags(c *cobra.Command) {
+	c.Flags().Bool("yes", false, "Don't ask before running against a kube-context that matches a protected pattern under guardrails in the config file.")
+}
+
+// checkGuardrails makes sure GOKP isn't about to change a cluster it shouldn't by accident. If the context of the
+// kubeconfig (its current one if contextName is empty), or the cluster it points at, matches a protected pattern
+// and no allowed one, what's about to be done has to be confirmed, or --yes given when there's no terminal to ask on
+func checkGuardrails(cmd *cobra.Command, kubeconfigFile string, contextName string, what string) error {
+	cfg, err := clientcmd.LoadFromFile(kubeconfigFile)
+	if err != nil {
+		return err
+	}
+	if contextName == "" {
+		contextName = cfg.CurrentContext
+	}
+	names := []string{contextName}
+	if ctx, ok := cfg.Contexts[contextName]; ok {
+		names = append(names, ctx.Cluster)
+	}
+
+	protected := ""
+	for _, name := range names {
+		if matchesAny(guardrails.AllowedContexts, name) != "" {
+			return nil
+		}
+		if pattern := matchesAny(guardrails.ProtectedContexts, name); pattern != "" && protected == "" {
+			protected = pattern
+		}
+	}
+	if protected == "" {
+		return nil
+	}
+
+	msg := "context " + contextName + " of " + kubeconfigFile + " matches the protected pattern " + protected
+	if yes, _ := cmd.Flags().GetBool("yes"); yes {
+		log.Warn("The ", msg, ", going ahead with --yes")
+		return nil
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return errors.New("the " + msg + ", give --yes to " + what + " anyway")
+	}
+
+	ok, err := wizard.New().Confirm("The "+msg+". Really "+what+"?", false)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("not going ahead, the " + msg)
+	}
+
+	// If we're here, we should be okay
+	return nil
+}
+
+// matchesAny returns the first pattern the name matches, empty if none of them do
+func matchesAny(patterns []string, name string) string {
+	for _, pattern := range patterns {
+		re := "^" + strings.NewReplacer(`\*`, ".*", `\?`, ".").Replace(regexp.QuoteMeta(pattern)) + "$"
+		if regexp.MustCompile(re).MatchString(name) {
+			return pattern
+		}
+	}
+	return ""
+}
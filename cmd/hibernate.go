@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+
+	"github.com/christianh814/gokp/cmd/gitutils"
+	"github.com/christianh814/gokp/cmd/hibernate"
+	"github.com/christianh814/gokp/cmd/state"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// hibernateCmd represents the hibernate command
+var hibernateCmd = &cobra.Command{
+	Use:   "hibernate",
+	Short: "Scales the workers of a cluster down to zero",
+	Long: `Scales every MachineDeployment of a cluster down to zero by committing the
+change to the GitOps repo, remembering how many replicas each one had so
+"gokp resume" can bring them back. The change is also made on the cluster
+directly, so it doesn't depend on the GitOps controller having somewhere to
+run. On AWS, the control plane instances can be stopped too. For example:
+
+gokp hibernate --cluster-name=mycluster
+gokp hibernate --cluster-name=mycluster --stop-control-plane
+
+Use "gokp hibernate schedule" to do this on a schedule.`,
+	Annotations: map[string]string{stateLockAnnotation: "true"},
+	Run: func(cmd *cobra.Command, args []string) {
+		// Grab flags
+		clusterName, _ := cmd.Flags().GetString("cluster-name")
+		CapiCfg, _ := cmd.Flags().GetString("kubeconfig")
+		stopControlPlane, _ := cmd.Flags().GetBool("stop-control-plane")
+
+		st, err := state.Load(state.ArtifactsDir(clusterName))
+		if err != nil && !os.IsNotExist(err) {
+			log.Fatal(err)
+		}
+		if stopControlPlane && (st == nil || st.Provider != "aws") {
+			log.Fatal(errors.New("--stop-control-plane is only supported for AWS clusters"))
+		}
+
+		// Default to the kubeconfig that was saved at install time
+		if CapiCfg == "" {
+			CapiCfg, err = clusterSecretFile(clusterName, clusterName+".kubeconfig")
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		mds, err := scaleMachineDeployments(cmd, clusterName, CapiCfg, "hibernating "+clusterName, hibernate.Hibernate)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// The workers have to be gone before the control plane that removes them is stopped
+		if stopControlPlane {
+			log.Info("Waiting for the workers to be removed")
+			err = hibernate.WaitForScale(CapiCfg, mds)
+			if err != nil {
+				log.Fatal(err)
+			}
+			awsAccessKey, _ := cmd.Flags().GetString("aws-access-key")
+			awsSecretKey, _ := cmd.Flags().GetString("aws-secret-key")
+			stopped, err := hibernate.StopAWSControlPlane(clusterName, st.Region, awsAccessKey, awsSecretKey)
+			if err != nil {
+				log.Fatal(err)
+			}
+			st.StoppedInstances = append(st.StoppedInstances, stopped...)
+		}
+
+		if st != nil {
+			st.Hibernated = true
+			err = state.Save(state.ArtifactsDir(clusterName), st)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		log.Info("Cluster ", clusterName, " is hibernated, use \"gokp resume\" to bring it back")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(hibernateCmd)
+
+	hibernateCmd.Flags().String("cluster-name", "", "Name of the gokp cluster.")
+	hibernateCmd.Flags().String("kubeconfig", "", "Path to the Kubeconfig file of the gokp cluster (defaults to the one under ~/.gokp).")
+	hibernateCmd.Flags().Bool("stop-control-plane", false, "Also stop the control plane instances (AWS only).")
+	hibernateCmd.Flags().String("aws-access-key", "", "Your AWS Access Key, for --stop-control-plane (defaults to the AWS credential chain).")
+	hibernateCmd.Flags().String("aws-secret-key", "", "Your AWS Secret Key, for --stop-control-plane (defaults to the AWS credential chain).")
+	addRepoAuthFlags(hibernateCmd)
+
+	hibernateCmd.MarkFlagRequired("cluster-name")
+}
+
+// scaleMachineDeployments lets scale change the MachineDeployments in the GitOps repo of the cluster, pushes the
+// change out, and makes the same change on the cluster
+func scaleMachineDeployments(cmd *cobra.Command, clusterName string, kubeconfig string, msg string, scale func(baseDir string) ([]hibernate.MachineDeployment, error)) ([]hibernate.MachineDeployment, error) {
+	// Find the local clone of the repo
+	repoDir, privateKeyFile, err := openClusterRepo(clusterName)
+	if err != nil {
+		return nil, err
+	}
+
+	mds, err := scale(gitutils.BaseDir(repoDir))
+	if err != nil {
+		return nil, err
+	}
+	if len(mds) == 0 {
+		log.Info("Nothing to scale for ", clusterName)
+		return mds, nil
+	}
+
+	// HTTPS remotes use the token, everything else uses the stored key
+	err = setRepoCredentials(cmd, repoDir)
+	if err != nil {
+		return nil, err
+	}
+	_, err = commitAndPush(repoDir, privateKeyFile, clusterName, msg)
+	if err != nil {
+		return nil, err
+	}
+
+	// If we're here, we should be okay
+	return mds, hibernate.ScaleCluster(kubeconfig, mds)
+}
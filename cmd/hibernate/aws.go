@@ -0,0 +1,81 @@
+package hibernate
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	log "github.com/sirupsen/logrus"
+)
+
+// StopAWSControlPlane stops the running control plane instances CAPA created for the cluster and returns their
+// IDs, so they can be started again by StartAWSInstances. The default credential chain is used if no keys are given
+func StopAWSControlPlane(clusterName string, region string, accessKey string, secretKey string) ([]string, error) {
+	svc, err := newEC2(region, accessKey, secretKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// CAPA tags everything it owns with the name of the cluster and the role of the instance
+	out, err := svc.DescribeInstances(&ec2.DescribeInstancesInput{
+		Filters: []*ec2.Filter{
+			{Name: aws.String("tag:sigs.k8s.io/cluster-api-provider-aws/cluster/" + clusterName), Values: aws.StringSlice([]string{"owned"})},
+			{Name: aws.String("tag:sigs.k8s.io/cluster-api-provider-aws/role"), Values: aws.StringSlice([]string{"control-plane"})},
+			{Name: aws.String("instance-state-name"), Values: aws.StringSlice([]string{"running"})},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []string{}
+	for _, r := range out.Reservations {
+		for _, i := range r.Instances {
+			ids = append(ids, aws.StringValue(i.InstanceId))
+		}
+	}
+	if len(ids) == 0 {
+		return ids, nil
+	}
+
+	log.Info("Stopping control plane instances: ", ids)
+	_, err = svc.StopInstances(&ec2.StopInstancesInput{InstanceIds: aws.StringSlice(ids)})
+	if err != nil {
+		return nil, err
+	}
+
+	// If we're here, we should be okay
+	return ids, nil
+}
+
+// StartAWSInstances starts the instances stopped by StopAWSControlPlane and waits for them to be running
+func StartAWSInstances(ids []string, region string, accessKey string, secretKey string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	svc, err := newEC2(region, accessKey, secretKey)
+	if err != nil {
+		return err
+	}
+
+	log.Info("Starting control plane instances: ", ids)
+	_, err = svc.StartInstances(&ec2.StartInstancesInput{InstanceIds: aws.StringSlice(ids)})
+	if err != nil {
+		return err
+	}
+
+	return svc.WaitUntilInstanceRunning(&ec2.DescribeInstancesInput{InstanceIds: aws.StringSlice(ids)})
+}
+
+// newEC2 returns an EC2 client for the region
+func newEC2(region string, accessKey string, secretKey string) (*ec2.EC2, error) {
+	cfg := &aws.Config{Region: aws.String(region)}
+	if accessKey != "" && secretKey != "" {
+		cfg.Credentials = credentials.NewStaticCredentials(accessKey, secretKey, "")
+	}
+	sess, err := session.NewSession(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return ec2.New(sess), nil
+}
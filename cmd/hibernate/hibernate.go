@@ -0,0 +1,265 @@
+package hibernate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/christianh814/gokp/cmd/clock"
+	"github.com/christianh814/gokp/cmd/export"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// ReplicasAnnotation is where the number of replicas a MachineDeployment had before it was hibernated is kept
+var ReplicasAnnotation string = "gokp.io/hibernated-replicas"
+
+// Wait is how often WaitForScale and WaitForAPIServer check on the cluster, and how long they wait for it
+var Wait clock.Waiter = clock.Waiter{Interval: 10 * time.Second, Timeout: 10 * time.Minute}
+
+// machineDeploymentGVR is the MachineDeployment resource of CAPI
+var machineDeploymentGVR = schema.GroupVersionResource{Group: "cluster.x-k8s.io", Version: "v1beta1", Resource: "machinedeployments"}
+
+// MachineDeployment is a MachineDeployment in the GitOps repo that was scaled by Hibernate or Resume
+type MachineDeployment struct {
+	Name      string
+	Namespace string
+	Replicas  int64
+	// Annotation is the value of ReplicasAnnotation after the change, empty if it was removed
+	Annotation string
+}
+
+// Hibernate scales every MachineDeployment exported under the cluster/core dir of baseDir to zero, keeping the
+// number of replicas it had in an annotation. MachineDeployments that are already hibernated are left alone
+func Hibernate(baseDir string) ([]MachineDeployment, error) {
+	return scaleFiles(baseDir, func(obj *unstructured.Unstructured) (bool, error) {
+		annotations := obj.GetAnnotations()
+		if _, ok := annotations[ReplicasAnnotation]; ok {
+			return false, nil
+		}
+
+		replicas, found, err := unstructured.NestedInt64(obj.Object, "spec", "replicas")
+		if err != nil {
+			return false, err
+		}
+		if !found {
+			replicas = 1
+		}
+
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[ReplicasAnnotation] = strconv.FormatInt(replicas, 10)
+		obj.SetAnnotations(annotations)
+		return true, unstructured.SetNestedField(obj.Object, int64(0), "spec", "replicas")
+	})
+}
+
+// Resume scales every MachineDeployment Hibernate scaled down under the cluster/core dir of baseDir back up to
+// the number of replicas it had
+func Resume(baseDir string) ([]MachineDeployment, error) {
+	return scaleFiles(baseDir, func(obj *unstructured.Unstructured) (bool, error) {
+		annotations := obj.GetAnnotations()
+		value, ok := annotations[ReplicasAnnotation]
+		if !ok {
+			return false, nil
+		}
+
+		replicas, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return false, errors.New("bad " + ReplicasAnnotation + " annotation on " + obj.GetName() + ": " + value)
+		}
+
+		delete(annotations, ReplicasAnnotation)
+		if len(annotations) == 0 {
+			annotations = nil
+		}
+		obj.SetAnnotations(annotations)
+		return true, unstructured.SetNestedField(obj.Object, replicas, "spec", "replicas")
+	})
+}
+
+// Scale sets the replicas of the MachineDeployment named under the cluster/core dir of baseDir. The name can be
+// left empty if there's only one MachineDeployment. Nothing is returned if it already has that many replicas
+func Scale(baseDir string, name string, replicas int64) ([]MachineDeployment, error) {
+	if replicas < 0 {
+		return nil, errors.New("the number of replicas can't be negative")
+	}
+
+	// Find out which MachineDeployments there are, without changing any
+	names := []string{}
+	_, err := export.UpdateExported(baseDir, "MachineDeployment", func(obj *unstructured.Unstructured) (bool, error) {
+		names = append(names, obj.GetName())
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		if len(names) != 1 {
+			return nil, errors.New("there's more than one MachineDeployment, so one has to be picked: " + strings.Join(names, ", "))
+		}
+		name = names[0]
+	}
+
+	found := false
+	scaled, err := scaleFiles(baseDir, func(obj *unstructured.Unstructured) (bool, error) {
+		if obj.GetName() != name {
+			return false, nil
+		}
+		found = true
+
+		// Resume would undo the change
+		if _, ok := obj.GetAnnotations()[ReplicasAnnotation]; ok {
+			return false, errors.New("MachineDeployment " + name + " is hibernated, resume it first")
+		}
+
+		current, _, err := unstructured.NestedInt64(obj.Object, "spec", "replicas")
+		if err != nil {
+			return false, err
+		}
+		if current == replicas {
+			return false, nil
+		}
+		return true, unstructured.SetNestedField(obj.Object, replicas, "spec", "replicas")
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, errors.New("MachineDeployment " + name + " not found, the MachineDeployments are " + strings.Join(names, ", "))
+	}
+
+	return scaled, nil
+}
+
+// scaleFiles runs scale on every MachineDeployment in the repo and writes back the ones it changed
+func scaleFiles(baseDir string, scale func(obj *unstructured.Unstructured) (bool, error)) ([]MachineDeployment, error) {
+	objs, err := export.UpdateExported(baseDir, "MachineDeployment", scale)
+	if err != nil {
+		return nil, err
+	}
+
+	scaled := []MachineDeployment{}
+	for _, obj := range objs {
+		replicas, _, _ := unstructured.NestedInt64(obj.Object, "spec", "replicas")
+		scaled = append(scaled, MachineDeployment{
+			Name:       obj.GetName(),
+			Namespace:  obj.GetNamespace(),
+			Replicas:   replicas,
+			Annotation: obj.GetAnnotations()[ReplicasAnnotation],
+		})
+	}
+
+	// If we're here, we should be okay
+	return scaled, nil
+}
+
+// ScaleCluster makes the MachineDeployments on the cluster of the kubeconfig match what was written to the repo.
+// This doesn't wait on the GitOps controller, which may not have anywhere to run while the cluster is hibernated
+func ScaleCluster(kubeconfig string, mds []MachineDeployment) error {
+	cfg, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return err
+	}
+	dyn, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	for _, md := range mds {
+		// A null annotation removes it
+		var annotation interface{}
+		if md.Annotation != "" {
+			annotation = md.Annotation
+		}
+		patch, err := json.Marshal(map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"annotations": map[string]interface{}{ReplicasAnnotation: annotation},
+			},
+			"spec": map[string]interface{}{
+				"replicas": md.Replicas,
+			},
+		})
+		if err != nil {
+			return err
+		}
+
+		log.Info("Scaling MachineDeployment ", md.Namespace, "/", md.Name, " to ", md.Replicas)
+		_, err = dyn.Resource(machineDeploymentGVR).Namespace(md.Namespace).Patch(context.TODO(), md.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+		if err != nil {
+			return err
+		}
+	}
+
+	// If we're here, we should be okay
+	return nil
+}
+
+// WaitForScale waits for the MachineDeployments on the cluster of the kubeconfig to have as many replicas as asked for
+func WaitForScale(kubeconfig string, mds []MachineDeployment) error {
+	cfg, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return err
+	}
+	dyn, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	for _, md := range mds {
+		err = Wait.Until(func() (bool, error) {
+			obj, err := dyn.Resource(machineDeploymentGVR).Namespace(md.Namespace).Get(context.TODO(), md.Name, metav1.GetOptions{})
+			if err != nil {
+				return false, nil
+			}
+			replicas, _, _ := unstructured.NestedInt64(obj.Object, "status", "replicas")
+			return replicas == md.Replicas, nil
+		})
+		if err == clock.ErrTimeout {
+			return errors.New("MachineDeployment " + md.Namespace + "/" + md.Name + " took too long to scale")
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// If we're here, we should be okay
+	return nil
+}
+
+// WaitForAPIServer waits for the API server of the cluster of the kubeconfig to answer, like after the control
+// plane instances were started again
+func WaitForAPIServer(kubeconfig string) error {
+	cfg, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return err
+	}
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	err = Wait.Until(func() (bool, error) {
+		_, err := clientset.Discovery().ServerVersion()
+		return err == nil, nil
+	})
+	if err == clock.ErrTimeout {
+		return errors.New("API server took too long to come back")
+	}
+	if err != nil {
+		return err
+	}
+
+	// If we're here, we should be okay
+	return nil
+}
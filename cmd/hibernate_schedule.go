@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// hibernateScheduleCmd represents the hibernate schedule command
+var hibernateScheduleCmd = &cobra.Command{
+	Use:   "schedule",
+	Short: "Prints the crontab entries to hibernate and resume a cluster on a schedule",
+	Long: `Prints the crontab entries that hibernate and resume a cluster on a
+schedule, like only during business hours. Add them with "crontab -e" on a
+machine that has the ~/.gokp dir of the cluster. For example:
+
+gokp hibernate schedule --cluster-name=mycluster \
+	--hibernate-at="0 19 * * 1-5" --resume-at="0 7 * * 1-5"`,
+	Run: func(cmd *cobra.Command, args []string) {
+		// Grab flags
+		clusterName, _ := cmd.Flags().GetString("cluster-name")
+		hibernateAt, _ := cmd.Flags().GetString("hibernate-at")
+		resumeAt, _ := cmd.Flags().GetString("resume-at")
+		stopControlPlane, _ := cmd.Flags().GetBool("stop-control-plane")
+
+		for flag, schedule := range map[string]string{"hibernate-at": hibernateAt, "resume-at": resumeAt} {
+			if len(strings.Fields(schedule)) != 5 {
+				log.Fatal(errors.New("--" + flag + " must be a cron schedule with 5 fields, got: " + schedule))
+			}
+		}
+
+		hibernateArgs := "--cluster-name=" + clusterName
+		if stopControlPlane {
+			hibernateArgs += " --stop-control-plane"
+		}
+		fmt.Printf("%s gokp hibernate %s\n", hibernateAt, hibernateArgs)
+		fmt.Printf("%s gokp resume --cluster-name=%s\n", resumeAt, clusterName)
+	},
+}
+
+func init() {
+	hibernateCmd.AddCommand(hibernateScheduleCmd)
+
+	hibernateScheduleCmd.Flags().String("cluster-name", "", "Name of the gokp cluster.")
+	hibernateScheduleCmd.Flags().String("hibernate-at", "0 19 * * 1-5", "Cron schedule to hibernate the cluster at.")
+	hibernateScheduleCmd.Flags().String("resume-at", "0 7 * * 1-5", "Cron schedule to resume the cluster at.")
+	hibernateScheduleCmd.Flags().Bool("stop-control-plane", false, "Also stop the control plane instances when hibernating (AWS only).")
+
+	hibernateScheduleCmd.MarkFlagRequired("cluster-name")
+}
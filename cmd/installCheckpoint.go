@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/christianh814/gokp/cmd/checkpoint"
+	"github.com/christianh814/gokp/cmd/gitutils"
+	"github.com/christianh814/gokp/cmd/logging"
+	"github.com/christianh814/gokp/cmd/templates"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// installWorkDir returns the workdir of the install of the cluster along with its checkpoint. With --resume it's the
+// one a failed install left behind, otherwise a new one is created. The name is always the same so it can be found again
+func installWorkDir(cmd *cobra.Command, clusterName string, provider string) (string, *checkpoint.Checkpoint, error) {
+	logging.SetCluster(clusterName)
+	resume, _ := cmd.Flags().GetBool("resume")
+	dir := os.Getenv("HOME") + "/.gokp/.gokpinstall-" + clusterName
+
+	if resume {
+		cp, err := checkpoint.Load(dir)
+		if os.IsNotExist(err) {
+			return "", nil, errors.New("there is no install of " + clusterName + " to resume")
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		if cp.Provider != provider {
+			return "", nil, errors.New("the install of " + clusterName + " was started with the " + cp.Provider + " provider")
+		}
+		log.Info("Resuming the install of ", clusterName, " from ", dir)
+		return dir, cp, nil
+	}
+
+	// Don't clobber what a failed install left behind, it might be needed to clean up
+	if _, err := os.Stat(dir); err == nil {
+		return "", nil, errors.New("a failed install of " + clusterName + " was left at " + dir + ", use --resume to pick it up or remove it")
+	}
+	err := os.Mkdir(dir, 0700)
+	if err != nil {
+		return "", nil, err
+	}
+
+	cp := checkpoint.New(dir, clusterName, provider)
+	err = cp.Save()
+	if err != nil {
+		return "", nil, err
+	}
+
+	return dir, cp, nil
+}
+
+// runPhase runs the phase of the install and records that it's done. Phases a resumed install already did are skipped
+func runPhase(cp *checkpoint.Checkpoint, phase string, run func() error) error {
+	if cp.Done(phase) {
+		log.Info("Skipping ", phase, ", it was done before")
+		return nil
+	}
+
+	// Tag what the phase logs with it
+	logging.SetPhase(phase)
+	defer logging.SetPhase("")
+
+	started := time.Now()
+	err := run()
+	if err != nil {
+		return err
+	}
+	phaseSeconds[phase] = time.Since(started).Round(time.Second).Seconds()
+
+	return cp.Mark(phase)
+}
+
+// createGitOpsRepoPhase creates the GitOps repo with the dir structure of the gitops controller, and returns the
+// remote URL. If a resumed install already created it, what's needed to push to it is set up again instead
+func createGitOpsRepoPhase(cmd *cobra.Command, cp *checkpoint.Checkpoint, clusterName *string, privateRepo *bool, workdir string, gitOpsController string) (string, error) {
+	if cp.Done(checkpoint.RepoCreated) {
+		log.Info("Using the GitOps repo that was created before: ", cp.GitOpsRepo)
+		gitutils.RepoPath = cp.RepoPath
+		gitutils.RemoteName = cp.RemoteName
+		gitutils.Branch = cp.Branch
+		return cp.GitOpsRepo, restoreRepoCredentials(cmd, workdir+"/"+*clusterName)
+	}
+
+	gitopsrepo, err := createGitOpsRepo(cmd, clusterName, privateRepo, workdir)
+	if err != nil {
+		return "", err
+	}
+
+	// Create repo dir structure based on which gitops controller that was chosen
+	ghToken, _ := cmd.Flags().GetString("github-token")
+	if gitOpsController == "argocd" {
+		// Create repo dir structure. Including Argo CD install YAMLs and base YAMLs. Push initial dir structure out
+		_, err = templates.CreateArgoRepoSkel(clusterName, workdir, ghToken, gitopsrepo, privateRepo)
+	} else if gitOpsController == "fluxcd" {
+		// Create repo dir structure. Including Flux CD install YAMLs and base YAMLs. Push initial dir structure out
+		_, err = templates.CreateFluxRepoSkel(clusterName, workdir, ghToken, gitopsrepo, privateRepo)
+	} else {
+		err = errors.New("unknown gitops controller")
+	}
+	if err != nil {
+		return "", err
+	}
+
+	cp.GitOpsRepo = gitopsrepo
+	cp.RepoPath = gitutils.RepoPath
+	cp.RemoteName = gitutils.RemoteName
+	cp.Branch = gitutils.Branch
+	err = cp.Mark(checkpoint.RepoCreated)
+	if err != nil {
+		return "", err
+	}
+
+	return gitopsrepo, nil
+}
+
+// restoreRepoCredentials sets the credentials for the HTTPS remotes of the repo again, since they're only kept in
+// memory by the install that created the repo
+func restoreRepoCredentials(cmd *cobra.Command, repoDir string) error {
+	err := setRepoCredentials(cmd, repoDir)
+	if err != nil {
+		return err
+	}
+
+	// Bitbucket and Azure DevOps repos are pushed to with the credentials of the provider
+	remotes, err := gitutils.RemoteURLs(repoDir)
+	if err != nil {
+		return err
+	}
+	gitProvider, _ := cmd.Flags().GetString("git-provider")
+	for _, remote := range remotes {
+		if !strings.HasPrefix(remote, "https://") {
+			continue
+		}
+		switch gitProvider {
+		case "bitbucket":
+			bbUsername, _ := cmd.Flags().GetString("bitbucket-username")
+			bbAppPassword, _ := cmd.Flags().GetString("bitbucket-app-password")
+			gitutils.SetHTTPCredentials(remote, bbUsername, bbAppPassword)
+		case "azuredevops":
+			azdoOrg, _ := cmd.Flags().GetString("azuredevops-org")
+			azdoPat, _ := cmd.Flags().GetString("azuredevops-pat")
+			gitutils.SetHTTPCredentials(remote, azdoOrg, azdoPat)
+		}
+	}
+
+	// The mirrors are already remotes of the repo, they just need their credentials
+	mirrors, err := gitMirrors(cmd)
+	if err != nil {
+		return err
+	}
+	for _, mirror := range mirrors {
+		if mirror.SSHKey != "" {
+			gitutils.SetSSHKey(mirror.URL, mirror.SSHKey)
+		}
+		if mirror.Username != "" {
+			gitutils.SetHTTPCredentials(mirror.URL, mirror.Username, mirror.Password)
+		}
+	}
+
+	// If we're here, we should be okay
+	return nil
+}
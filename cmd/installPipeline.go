@@ -0,0 +1,545 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"github.com/christianh814/gokp/cmd/argo"
+	"github.com/christianh814/gokp/cmd/capi"
+	"github.com/christianh814/gokp/cmd/checkpoint"
+	"github.com/christianh814/gokp/cmd/export"
+	"github.com/christianh814/gokp/cmd/flux"
+	"github.com/christianh814/gokp/cmd/gitutils"
+	"github.com/christianh814/gokp/cmd/kind"
+	"github.com/christianh814/gokp/cmd/kubeconfig"
+	"github.com/christianh814/gokp/cmd/state"
+	"github.com/christianh814/gokp/cmd/templates"
+	"github.com/christianh814/gokp/cmd/utils"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// installLeftovers are what the install leaves in the workdir that nobody needs once the cluster is up
+var installLeftovers []string = []string{
+	"argocd-install-output",
+	"capi-install-yamls-output",
+	"cni-output",
+	"caaph-output",
+	"fluxcd-install-output",
+	"argocd-install.yaml",
+	"caaph-components.yaml",
+	"cni-helmchartproxy.yaml",
+	"flux-install.yaml",
+	"cni.yaml",
+	"install-cluster.yaml",
+	"kind.kubeconfig",
+}
+
+// clusterInstall is what the hooks of a provider get to know about the install of a cluster
+type clusterInstall struct {
+	Cmd         *cobra.Command
+	ClusterName string
+	Checkpoint  *checkpoint.Checkpoint
+
+	// HA is set from the sizing profile, or --ha for the providers without one
+	HA bool
+
+	// TCPName is the name of the temporary control plane, empty if the cluster is created from a management
+	// cluster that's already there. MgmtCfg is the kubeconfig of the cluster the cluster is created from
+	TCPName string
+	MgmtCfg string
+
+	// CapiCfg is the kubeconfig of the cluster, and Artifacts where everything about it is kept once it's up
+	CapiCfg   string
+	Artifacts string
+
+	// Region is recorded in the state, if the provider has one
+	Region string
+
+	// The AWS account the references to SSM and Secrets Manager in the template variables are looked up in, if any
+	AWSRegion    string
+	AWSAccessKey string
+	AWSSecretKey string
+}
+
+// installHooks are what a provider adds to the install that's the same for all of them. Hooks that aren't set are
+// skipped, an error from any of them fails the install
+type installHooks struct {
+	// Provider is the name of the provider, as it's kept in the state
+	Provider string
+
+	// Credentials are the flags that have to be set, from the command line or the secret store
+	Credentials []string
+
+	// SizingProfiles is set for the providers that have sizing profiles, the others take --ha
+	SizingProfiles bool
+
+	// MoveProvider is the CAPI provider that's moved to the cluster once it's up. Empty if the cluster isn't
+	// pivoted, it stays managed from where it was created
+	MoveProvider string
+
+	// Leftovers are what the provider leaves in the workdir on top of installLeftovers
+	Leftovers []string
+
+	// Configure reads the flags of the provider, before anything is checked or created
+	Configure func(in *clusterInstall) error
+
+	// Prepare checks, or creates, what the provider needs before the temporary control plane is created
+	Prepare func(in *clusterInstall) error
+
+	// TemporaryControlPlane creates the temporary control plane, a plain kind cluster if not set
+	TemporaryControlPlane func(in *clusterInstall) error
+
+	// Infrastructure creates what the cluster needs outside of it, once a failed install cleans up after itself.
+	// What it creates has to be kept in the checkpoint to be cleaned up
+	Infrastructure func(in *clusterInstall) error
+
+	// CreateCluster creates the cluster from the management cluster
+	CreateCluster func(in *clusterInstall) error
+
+	// WriteRepo adds the components of the provider to the GitOps repo in baseDir, before it's pushed
+	WriteRepo func(in *clusterInstall, baseDir string) error
+
+	// Bootstrap puts what never goes into the repo, like credentials, on the cluster before the GitOps controller
+	// is deployed
+	Bootstrap func(in *clusterInstall) error
+
+	// Moved runs once the cluster manages itself
+	Moved func(in *clusterInstall) error
+
+	// Save adds what the provider keeps about the cluster to its state, before it's saved
+	Save func(in *clusterInstall, st *state.ClusterState) error
+}
+
+// runInstall installs a cluster with the hooks of its provider. The workdir is created (or picked up with --resume),
+// the cluster is created from a temporary control plane, its YAML is pushed to the GitOps repo, the GitOps controller
+// is bootstrapped on it, and it's pivoted to manage itself. Anything that fails is fatal
+func runInstall(cmd *cobra.Command, hooks installHooks) {
+	// Everything that was given is checked before the workdir is created, so a typo doesn't leave behind an
+	// install to resume that never started
+	in := &clusterInstall{Cmd: cmd}
+	in.ClusterName, _ = cmd.Flags().GetString("cluster-name")
+	clusterName := in.ClusterName
+
+	// Credentials that weren't given as flags come from the secret store
+	err := loadSecretFlags(cmd)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(hooks.Credentials) > 0 {
+		err = requireFlags(cmd, hooks.Credentials...)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Fill in the sizes of the profile that was asked for, flags that were given win
+	if hooks.SizingProfiles {
+		in.HA, err = applySizingProfile(cmd, hooks.Provider)
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		// HA request
+		in.HA, _ = cmd.Flags().GetBool("ha")
+	}
+
+	// Grab repo related flags
+	privateRepo, _ := cmd.Flags().GetBool("private-repo")
+
+	// Set GitOps Controller
+	gitOpsController, err := gitOpsEngine(cmd)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Labels are recorded in the state so the cluster can be selected later
+	clusterLabels, _ := cmd.Flags().GetStringToString("labels")
+	err = state.ValidateLabels(clusterLabels)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Set the requests/limits and PriorityClasses of the bootstrap components
+	err = setBootstrapResources(cmd)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Set how the workers are replaced, like during upgrades
+	capi.RolloutStrategy, err = rolloutStrategyConfig(cmd)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Use CAAPH for the CNI if requested
+	capi.HelmAddons, _ = cmd.Flags().GetBool("helm-addons")
+
+	// Pick the CNI that's installed
+	err = setCNI(cmd)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Turn on the feature gates that were asked for
+	err = setFeatureGates(cmd)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Reach the nodes through konnectivity if requested
+	err = setKonnectivity(cmd)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Encrypt secrets at rest if requested
+	capi.EncryptSecrets, _ = cmd.Flags().GetBool("encrypt-secrets")
+
+	// Write an exec based kubeconfig if requested
+	execKubeconfig, _ := cmd.Flags().GetBool("exec-kubeconfig")
+
+	// Set up cluster artifacts
+	in.Artifacts = os.Getenv("HOME") + "/.gokp/" + clusterName
+	gokpartifacts := in.Artifacts
+
+	// set the bootstrapper name, the provider clears it if there's no temporary control plane
+	in.TCPName = "gokp-bootstrapper"
+
+	// Grab the flags of the provider
+	err = runHook(hooks.Configure, in)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Run PreReq Checks
+	_, err = utils.CheckPreReqs(gokpartifacts, gitOpsController)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Make sure we have what we need for the git provider
+	err = checkGitProviderFlags(cmd)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Resolve the template variables of the config file
+	err = setTemplateVariables(in.AWSRegion, in.AWSAccessKey, in.AWSSecretKey)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// create home dir
+	err = os.MkdirAll(os.Getenv("HOME")+"/.gokp", 0775)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Create workdir (or pick up the one of the install being resumed) and set variables based on that
+	WorkDir, in.Checkpoint, err = installWorkDir(cmd, clusterName, hooks.Provider)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cp := in.Checkpoint
+	KindCfg = WorkDir + "/" + "kind.kubeconfig"
+	in.CapiCfg = WorkDir + "/" + clusterName + ".kubeconfig"
+	CapiCfg := in.CapiCfg
+	if in.MgmtCfg == "" {
+		in.MgmtCfg = KindCfg
+	}
+
+	// An install that fails before it created anything has nothing to resume, so its workdir goes. Once the
+	// rollback is armed it's up to that
+	rollbackArmed := false
+	workdir := WorkDir
+	log.RegisterExitHandler(func() {
+		if !rollbackArmed && len(cp.Phases) == 0 {
+			os.RemoveAll(workdir)
+		}
+	})
+
+	// Record what gets applied to the clusters
+	capi.AuditDir = WorkDir + "/audit"
+
+	err = runHook(hooks.Prepare, in)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Create KIND instance
+	if in.TCPName != "" {
+		err = runPhase(cp, checkpoint.KindCreated, func() error {
+			log.Info("Creating temporary control plane")
+			if hooks.TemporaryControlPlane != nil {
+				return hooks.TemporaryControlPlane(in)
+			}
+			return kind.CreateKindCluster(in.TCPName, KindCfg)
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Clean up if anything fails from here on, unless asked not to
+	rollbackArmed = true
+	disarmRollback := armRollback(cmd, cp, in.TCPName, in.MgmtCfg, CapiCfg)
+
+	err = runHook(hooks.Infrastructure, in)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Create CAPI instance
+	err = runPhase(cp, checkpoint.ClusterCreated, func() error {
+		return hooks.CreateCluster(in)
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Create the GitOps repo with the dir structure of the gitops controller that was chosen
+	gitopsrepo, err := createGitOpsRepoPhase(cmd, cp, &clusterName, &privateRepo, WorkDir, gitOpsController)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Export the cluster YAML, along with what goes with it, and push it to the GitOps repo
+	err = runPhase(cp, checkpoint.RepoPushed, func() error {
+		baseDir := gitutils.BaseDir(WorkDir + "/" + clusterName)
+
+		// Export/Create Cluster YAML to the Repo, Make sure kustomize is used for the core components
+		log.Info("Exporting Cluster YAML")
+		_, err = export.ExportClusterYaml(CapiCfg, baseDir, gitOpsController)
+		if err != nil {
+			return err
+		}
+
+		// Keep the CNI HelmChartProxy in the repo so CAAPH keeps managing the CNI once the cluster manages itself
+		if capi.HelmAddons && hooks.MoveProvider != "" {
+			helmAddonsDir := baseDir + "/cluster/core/helm-addons"
+			os.MkdirAll(helmAddonsDir, 0755)
+			err = utils.CopyFile(WorkDir+"/"+capi.CNIHelmChartProxyFile, helmAddonsDir+"/"+capi.CNIHelmChartProxyFile)
+			if err != nil {
+				return err
+			}
+		}
+
+		// Keep the CNI and the konnectivity agents in the repo with the rest of the core components
+		err = addCNIToRepo(WorkDir, baseDir)
+		if err != nil {
+			return err
+		}
+		err = addKonnectivityToRepo(WorkDir, baseDir)
+		if err != nil {
+			return err
+		}
+
+		// Along with the components of the provider
+		if hooks.WriteRepo != nil {
+			err = hooks.WriteRepo(in, baseDir)
+			if err != nil {
+				return err
+			}
+		}
+
+		// Add the add-ons that were asked for, they're deployed from the repo like everything else
+		err = enableCreateAddOns(cmd, baseDir)
+		if err != nil {
+			return err
+		}
+
+		// Git push newly exported YAML to GitOps repo
+		privateKeyFile := WorkDir + "/" + clusterName + "_rsa"
+		_, err = commitAndPush(WorkDir+"/"+clusterName, privateKeyFile, clusterName, "exporting existing YAML")
+		return err
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Make sure the cluster is up before bootstrapping anything on it
+	err = capi.WaitForClusterReady(CapiCfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Create the sealing key before Sealed Secrets is deployed, so secrets can be sealed right away
+	err = setupSealedSecrets(cmd, clusterName, CapiCfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// The credentials of the ClusterSecretStore never go into the repo either
+	err = setupExternalSecrets(cmd, CapiCfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Neither do the credentials of a repo that's talked to over HTTPS
+	err = setupRepoCredentials(gitOpsController, gitopsrepo, CapiCfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = runHook(hooks.Bootstrap, in)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Deplopy the GitOps controller that was chosen
+	err = runPhase(cp, checkpoint.GitOpsBootstrapped, func() error {
+		if gitOpsController == "argocd" {
+			// Install Argo CD on the newly created cluster with applications/applicationsets
+			log.Info("Deploying Argo CD GitOps Controller")
+			_, err = argo.BootstrapArgoCD(&clusterName, WorkDir, CapiCfg)
+			if err != nil {
+				return err
+			}
+		} else if gitOpsController == "fluxcd" {
+			// Install Flux CD on the newly created cluster with all it's components
+			log.Info("Deploying Flux CD GitOps Controller")
+			_, err = flux.BootstrapFluxCD(&clusterName, WorkDir, CapiCfg)
+			if err != nil {
+				return err
+			}
+		} else {
+			return errors.New("unknown gitops controller")
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Get the admin password of Argo CD (rotating it if asked to)
+	argocdPassword := ""
+	if gitOpsController == "argocd" {
+		argocdPassword, err = argoCDAdminPassword(cmd, CapiCfg)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// MOVE from kind to capi instance
+	if hooks.MoveProvider != "" {
+		err = runPhase(cp, checkpoint.Pivoted, func() error {
+			log.Info("Moving CAPI Artifacts to: " + clusterName)
+			_, err = capi.MoveMgmtCluster(in.MgmtCfg, CapiCfg, hooks.MoveProvider)
+			if err != nil {
+				return err
+			}
+
+			err = runHook(hooks.Moved, in)
+			if err != nil {
+				return err
+			}
+
+			// The cluster manages itself now, so it needs CAAPH too
+			if capi.HelmAddons {
+				err = capi.InstallHelmAddonProvider(CapiCfg, WorkDir)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Delete local Kind Cluster
+	if in.TCPName != "" {
+		log.Info("Deleting temporary control plane")
+		err = kind.DeleteKindCluster(in.TCPName, KindCfg)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Everything is in place, a failure from here on is no reason to delete the cluster
+	disarmRollback()
+
+	// Move components to ~/.gokp/<clustername> and remove stuff you don't need to know.
+	// 	TODO: this is ugly and will refactor this later
+	///err = utils.CopyDir(WorkDir, gokpartifacts)
+	err = os.Rename(WorkDir, gokpartifacts)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, notNeededthing := range append(installLeftovers, hooks.Leftovers...) {
+		err = os.RemoveAll(gokpartifacts + "/" + notNeededthing)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Save what we know about the cluster for later commands
+	st := &state.ClusterState{
+		Name:              clusterName,
+		Provider:          hooks.Provider,
+		Region:            in.Region,
+		Labels:            clusterLabels,
+		KubernetesVersion: capi.KubernetesVersion,
+		GitOpsController:  gitOpsController,
+		ArgoCDVersion:     argoCDVersion(gitOpsController),
+		ArgoCDHA:          templates.ArgoCDHA,
+		ArgoCDNamespace:   argoCDNamespace(gitOpsController),
+		GitOpsRepo:        gitopsrepo,
+		RepoPath:          gitutils.RepoPath,
+		RemoteName:        gitutils.RemoteName,
+		Branch:            gitutils.Branch,
+		CreatedAt:         time.Now(),
+	}
+	if hooks.Save != nil {
+		err = hooks.Save(in, st)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	err = state.Save(gokpartifacts, st)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Keep the deploy key and kubeconfig in the secret store too
+	err = saveClusterSecrets(clusterName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Set up a kubeconfig that gets short lived credentials from gokp instead of carrying the client certificate
+	if execKubeconfig {
+		log.Info("Writing exec based kubeconfig")
+		err = kubeconfig.EnableExecAuth(gokpartifacts + "/" + clusterName + ".kubeconfig")
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = kubeconfig.WriteExecKubeconfig(gokpartifacts+"/"+clusterName+".kubeconfig", clusterName, gokpartifacts+"/"+clusterName+"-exec.kubeconfig")
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// The cluster is only a success once the acceptance tests of the organization pass
+	err = runAcceptanceTests(cmd, clusterName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Give info
+	err = reportClusterCreated(cmd, clusterName, "installed", argocdPassword)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// runHook runs the hook of the provider, if it has one
+func runHook(hook func(in *clusterInstall) error, in *clusterInstall) error {
+	if hook == nil {
+		return nil
+	}
+	return hook(in)
+}
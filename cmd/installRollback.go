@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+
+	"github.com/christianh814/gokp/cmd/capi"
+	"github.com/christianh814/gokp/cmd/checkpoint"
+	"github.com/christianh814/gokp/cmd/kind"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// armRollback makes a failed install clean up after itself. The cluster, the temporary control plane (tcpName, if
+// there is one), and the workdir are deleted when the install exits with log.Fatal. The cluster is deleted from
+// mgmtCfg until it's pivoted, and from capiCfg after. What the install made outside of the cluster, and kept in the
+// checkpoint, goes once the cluster is gone. With --keep-on-failure everything is left for --resume instead. The
+// func returned disarms it once there's nothing left to clean up
+func armRollback(cmd *cobra.Command, cp *checkpoint.Checkpoint, tcpName string, mgmtCfg string, capiCfg string) func() {
+	keepOnFailure, _ := cmd.Flags().GetBool("keep-on-failure")
+	awsAccessKey, _ := cmd.Flags().GetString("aws-access-key")
+	awsSecretKey, _ := cmd.Flags().GetString("aws-secret-key")
+	workdir := WorkDir
+	kindCfg := KindCfg
+	armed := true
+
+	log.RegisterExitHandler(func() {
+		// A log.Fatal while cleaning up runs the handlers again
+		if !armed {
+			return
+		}
+		armed = false
+
+		if keepOnFailure {
+			log.Info("Keeping what was created for ", cp.ClusterName, ", run the same command with --resume to pick up where it stopped")
+			return
+		}
+
+		err := rollbackInstall(cp, tcpName, kindCfg, mgmtCfg, capiCfg)
+		if err != nil {
+			log.Error("Unable to clean up after the failed install of ", cp.ClusterName, ", pick it up with --resume or remove what's left by hand: ", err)
+			return
+		}
+
+		// The load balancer that used the security group went with the cluster
+		if cp.AWSSecurityGroup != "" {
+			err = capi.DeleteAWSAPIServerSecurityGroup(cp.AWSRegion, awsAccessKey, awsSecretKey, cp.AWSSecurityGroup)
+			if err != nil {
+				log.Warn("Unable to delete security group ", cp.AWSSecurityGroup, ", delete it by hand: ", err)
+			}
+		}
+		os.RemoveAll(workdir)
+		if cp.GitOpsRepo != "" {
+			log.Info("The GitOps repo ", cp.GitOpsRepo, " was left as it is")
+		}
+	})
+
+	return func() {
+		armed = false
+	}
+}
+
+// rollbackInstall deletes the cluster of the failed install and its temporary control plane
+func rollbackInstall(cp *checkpoint.Checkpoint, tcpName string, kindCfg string, mgmtCfg string, capiCfg string) error {
+	log.Info("Cleaning up after the failed install of ", cp.ClusterName)
+
+	// Once pivoted the cluster manages itself, so it's deleted the way delete-cluster does it. That needs a
+	// temporary control plane of its own, so ours goes first
+	if cp.Done(checkpoint.Pivoted) {
+		capiImplementation, ok := capiImplementations[cp.Provider]
+		if !ok {
+			return errors.New("clusters on " + cp.Provider + " can't be deleted once they manage themselves")
+		}
+		if tcpName != "" {
+			log.Info("Deleting temporary control plane")
+			err := kind.DeleteKindCluster(tcpName, kindCfg)
+			if err != nil {
+				return err
+			}
+		}
+		return deleteCAPICluster(cp.ClusterName, capiCfg, capiImplementation)
+	}
+
+	err := capi.DeletePartialCluster(mgmtCfg, cp.ClusterName)
+	if err != nil {
+		return err
+	}
+
+	if tcpName != "" {
+		log.Info("Deleting temporary control plane")
+		return kind.DeleteKindCluster(tcpName, kindCfg)
+	}
+
+	// If we're here, we should be okay
+	return nil
+}
@@ -0,0 +1,203 @@
+package inventory
+
+import (
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/christianh814/gokp/cmd/addons"
+	"github.com/christianh814/gokp/cmd/export"
+	"github.com/christianh814/gokp/cmd/nodepool"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// File is the name of the inventory that lives at the root of the GitOps repo, next to the add-on catalog
+var File string = "cluster-info.yaml"
+
+// providers are the GOKP providers of the infrastructure cluster kinds of CAPI
+var providers = map[string]string{
+	"AWSCluster":        "aws",
+	"AzureCluster":      "azure",
+	"ByoCluster":        "byoh",
+	"DockerCluster":     "development",
+	"IBMVPCCluster":     "ibmcloud",
+	"IBMPowerVSCluster": "ibmcloud",
+	"KubevirtCluster":   "kubevirt",
+	"LinodeCluster":     "linode",
+	"Metal3Cluster":     "metal3",
+	"OCICluster":        "oci",
+	"ProxmoxCluster":    "proxmox",
+}
+
+// regionFields is where the region is set in the infrastructure cluster of the providers that have one
+var regionFields = map[string][]string{
+	"AWSCluster":    {"spec", "region"},
+	"AzureCluster":  {"spec", "location"},
+	"IBMVPCCluster": {"spec", "region"},
+	"LinodeCluster": {"spec", "region"},
+	"OCICluster":    {"spec", "region"},
+}
+
+// Inventory is what's in the GitOps repo of a cluster, in a form that's easy to index: where the cluster runs,
+// how it's reached, its machines, and its add-ons
+type Inventory struct {
+	Name              string     `json:"name"`
+	Provider          string     `json:"provider"`
+	Region            string     `json:"region,omitempty"`
+	KubernetesVersion string     `json:"kubernetesVersion,omitempty"`
+	GitOpsController  string     `json:"gitOpsController"`
+	Endpoints         Endpoints  `json:"endpoints"`
+	ControlPlane      *NodePool  `json:"controlPlane,omitempty"`
+	NodePools         []NodePool `json:"nodePools"`
+	AddOns            []AddOn    `json:"addOns"`
+}
+
+// Endpoints are the endpoints of the cluster
+type Endpoints struct {
+	APIServer string `json:"apiServer,omitempty"`
+}
+
+// NodePool is a set of machines of the cluster, the control plane or a MachineDeployment
+type NodePool struct {
+	Name              string `json:"name"`
+	Replicas          int64  `json:"replicas"`
+	KubernetesVersion string `json:"kubernetesVersion,omitempty"`
+	InstanceType      string `json:"instanceType,omitempty"`
+}
+
+// AddOn is an add-on of the catalog
+type AddOn struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// Get returns the inventory of the cluster from what's under baseDir. Clusters that GOKP didn't install with CAPI
+// (like adopted ones) only have what isn't read from the CAPI objects
+func Get(baseDir string, clusterName string) (*Inventory, error) {
+	inv := &Inventory{
+		Name:             clusterName,
+		Provider:         "adopted",
+		GitOpsController: "argocd",
+		NodePools:        []NodePool{},
+		AddOns:           []AddOn{},
+	}
+	if _, err := os.Stat(baseDir + "/cluster/core/flux-system"); err == nil {
+		inv.GitOpsController = "fluxcd"
+	}
+
+	catalog, err := addons.LoadCatalog(baseDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range catalog.AddOns {
+		inv.AddOns = append(inv.AddOns, AddOn{Name: a.Name, Version: a.Version})
+	}
+	sort.Slice(inv.AddOns, func(i, j int) bool { return inv.AddOns[i].Name < inv.AddOns[j].Name })
+
+	cluster := exported(baseDir, "Cluster", func(obj *unstructured.Unstructured) bool {
+		return obj.GetName() == clusterName
+	})
+	if cluster == nil {
+		return inv, nil
+	}
+	namespace := cluster.GetNamespace()
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	// The endpoint is filled in by CAPI, so it's in what was exported
+	host, _, _ := unstructured.NestedString(cluster.Object, "spec", "controlPlaneEndpoint", "host")
+	port, _, _ := unstructured.NestedInt64(cluster.Object, "spec", "controlPlaneEndpoint", "port")
+	if host != "" {
+		if port == 0 {
+			port = 6443
+		}
+		inv.Endpoints.APIServer = "https://" + host + ":" + strconv.FormatInt(port, 10)
+	}
+
+	// The infrastructure cluster says what the cluster runs on and where
+	infraKind, _, _ := unstructured.NestedString(cluster.Object, "spec", "infrastructureRef", "kind")
+	infraName, _, _ := unstructured.NestedString(cluster.Object, "spec", "infrastructureRef", "name")
+	if provider, ok := providers[infraKind]; ok {
+		inv.Provider = provider
+	}
+	if field, ok := regionFields[infraKind]; ok {
+		if infra, err := export.ReadExported(baseDir, namespace, infraKind, infraName); err == nil {
+			inv.Region, _, _ = unstructured.NestedString(infra.Object, field...)
+		}
+	}
+
+	// The control plane has the version of the cluster
+	kcpName, _, _ := unstructured.NestedString(cluster.Object, "spec", "controlPlaneRef", "name")
+	if kcp, err := export.ReadExported(baseDir, namespace, "KubeadmControlPlane", kcpName); err == nil {
+		cp := NodePool{Name: kcp.GetName()}
+		cp.Replicas, _, _ = unstructured.NestedInt64(kcp.Object, "spec", "replicas")
+		cp.KubernetesVersion, _, _ = unstructured.NestedString(kcp.Object, "spec", "version")
+		cp.InstanceType = instanceType(baseDir, namespace, kcp, "spec", "machineTemplate", "infrastructureRef")
+		inv.ControlPlane = &cp
+		inv.KubernetesVersion = cp.KubernetesVersion
+	}
+
+	// Every MachineDeployment of the cluster is a node pool, the one it was installed with included
+	exported(baseDir, "MachineDeployment", func(obj *unstructured.Unstructured) bool {
+		if name, _, _ := unstructured.NestedString(obj.Object, "spec", "clusterName"); name != clusterName {
+			return false
+		}
+		pool := NodePool{Name: obj.GetName()}
+		pool.Replicas, _, _ = unstructured.NestedInt64(obj.Object, "spec", "replicas")
+		pool.KubernetesVersion, _, _ = unstructured.NestedString(obj.Object, "spec", "template", "spec", "version")
+		pool.InstanceType = instanceType(baseDir, namespace, obj, "spec", "template", "spec", "infrastructureRef")
+		inv.NodePools = append(inv.NodePools, pool)
+		return false
+	})
+	sort.Slice(inv.NodePools, func(i, j int) bool { return inv.NodePools[i].Name < inv.NodePools[j].Name })
+
+	// If we're here, we should be okay
+	return inv, nil
+}
+
+// Write writes the inventory of the cluster to the root of baseDir, where fleet dashboards can pick it up. It's
+// written whenever GOKP changes the repo, so it's always in step with the rest of it
+func Write(baseDir string, clusterName string) error {
+	inv, err := Get(baseDir, clusterName)
+	if err != nil {
+		return err
+	}
+
+	b, err := yaml.Marshal(inv)
+	if err != nil {
+		return err
+	}
+	header := "# Written by gokp whenever it changes this repo, don't edit it by hand\n"
+	return ioutil.WriteFile(baseDir+"/"+File, append([]byte(header), b...), 0644)
+}
+
+// exported returns the first object of the kind exported under baseDir that match returns true for, nil if there's
+// none
+func exported(baseDir string, kind string, match func(obj *unstructured.Unstructured) bool) *unstructured.Unstructured {
+	var found *unstructured.Unstructured
+	export.UpdateExported(baseDir, kind, func(obj *unstructured.Unstructured) (bool, error) {
+		if found == nil && match(obj) {
+			found = obj
+		}
+		return false, nil
+	})
+	return found
+}
+
+// instanceType returns the instance type of the machine template that obj references at ref, empty if it's not known
+func instanceType(baseDir string, namespace string, obj *unstructured.Unstructured, ref ...string) string {
+	kind, _, _ := unstructured.NestedString(obj.Object, append(ref, "kind")...)
+	name, _, _ := unstructured.NestedString(obj.Object, append(ref, "name")...)
+	if !strings.HasSuffix(kind, "MachineTemplate") {
+		return ""
+	}
+	template, err := export.ReadExported(baseDir, namespace, kind, name)
+	if err != nil {
+		return ""
+	}
+	return nodepool.InstanceType(template)
+}
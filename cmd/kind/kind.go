@@ -1,6 +1,10 @@
 package kind
 
 import (
+	"errors"
+	"os/exec"
+	"strings"
+
 	"github.com/christianh814/gokp/cmd/utils"
 	"sigs.k8s.io/kind/pkg/cluster"
 )
@@ -14,6 +18,23 @@ nodes:
       containerPath: /var/run/docker.sock
 `
 
+// BYOHKindConfig has the API server listen on an address the BYOH hosts can reach, so they can register with it
+var BYOHKindConfig string = `kind: Cluster
+apiVersion: kind.x-k8s.io/v1alpha4
+networking:
+  apiServerAddress: "{{.Address}}"
+`
+
+// CheckDocker makes sure the Docker daemon KIND runs the temp cluster manager on can be reached, and returns its
+// version
+func CheckDocker() (string, error) {
+	out, err := exec.Command("docker", "info", "--format", "{{.ServerVersion}}").CombinedOutput()
+	if err != nil {
+		return "", errors.New("unable to reach the Docker daemon: " + strings.TrimSpace(string(out)+" "+err.Error()))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
 // CreateKindCluster creates KIND cluster to use as the temp cluster manager
 func CreateKindCluster(name string, cfg string) error {
 	/* trying to quiet down KIND*/
@@ -101,6 +122,36 @@ func CreateCAPDKindCluster(name string, cfg string, dir string) error {
 	return nil
 }
 
+// CreateBYOHKindCluster creates KIND cluster to use as the temp cluster manager for a BYOH deployment, listening
+// on the given address of this machine
+func CreateBYOHKindCluster(name string, cfg string, dir string, address string) error {
+	// Writeout the KIND config for BYOH
+	kindcfg := dir + "/kindconfig.yaml"
+	addressVars := struct {
+		Address string
+	}{
+		Address: address,
+	}
+
+	// Write out the Kind file based on the vars and the template
+	_, err := utils.WriteTemplate(BYOHKindConfig, kindcfg, addressVars)
+	if err != nil {
+		return err
+	}
+
+	//create a new KIND provider
+	provider := cluster.NewProvider()
+
+	// Create a KIND instance and write out the kubeconfig in the specified location
+	return provider.Create(
+		name,
+		cluster.CreateWithKubeconfigPath(cfg),
+		cluster.CreateWithConfigFile(kindcfg),
+		cluster.CreateWithDisplayUsage(false),
+		cluster.CreateWithDisplaySalutation(false),
+	)
+}
+
 // GetKindKubeconfig returns the Kubeconfig of the named KIND cluster
 func GetKindKubeconfig(name string, internal bool) (string, error) {
 	// Create a provider and return the named kubeconfig file as a string
@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+
+	"github.com/christianh814/gokp/cmd/capi"
+	"github.com/christianh814/gokp/cmd/konnectivity"
+	"github.com/christianh814/gokp/cmd/templates"
+	"github.com/christianh814/gokp/cmd/utils"
+	"github.com/spf13/cobra"
+)
+
+// addKonnectivityFlags adds the flags for reaching the nodes through konnectivity
+func addKonnectivityFlags(c *cobra.Command) {
+	c.Flags().Bool("konnectivity", false, "Have the API server reach the nodes through konnectivity agents, for when the control plane can't reach them directly.")
+	c.Flags().String("konnectivity-server-host", "", "Host the konnectivity agents connect to the control plane on (port 8132). Defaults to the control plane endpoint.")
+}
+
+// setKonnectivity sets if konnectivity is used, and where the agents connect to, from the flags
+func setKonnectivity(cmd *cobra.Command) error {
+	capi.Konnectivity, _ = cmd.Flags().GetBool("konnectivity")
+	capi.KonnectivityServerHost, _ = cmd.Flags().GetString("konnectivity-server-host")
+	if capi.KonnectivityServerHost != "" && !capi.Konnectivity {
+		return errors.New("--konnectivity-server-host needs --konnectivity")
+	}
+	return nil
+}
+
+// addKonnectivityToRepo keeps the konnectivity agents that were applied to the cluster under the cluster/core dir of
+// baseDir, so they're managed from the GitOps repo like the rest of the core components
+func addKonnectivityToRepo(workdir string, baseDir string) error {
+	if !capi.Konnectivity {
+		return nil
+	}
+
+	konnectivityDir := baseDir + "/cluster/core/konnectivity"
+	os.MkdirAll(konnectivityDir, 0755)
+	err := utils.CopyFile(workdir+"/"+konnectivity.AgentFile, konnectivityDir+"/"+konnectivity.AgentFile)
+	if err != nil {
+		return err
+	}
+	_, err = utils.WriteTemplate(templates.KonnectivityRepoKustomize, konnectivityDir+"/"+"kustomization.yaml", struct{}{})
+	return err
+}
@@ -0,0 +1,122 @@
+package konnectivity
+
+import (
+	"bytes"
+	"net/url"
+	"text/template"
+
+	"github.com/christianh814/gokp/cmd/templates"
+	"github.com/christianh814/gokp/cmd/utils"
+)
+
+// Label is put on every object of the konnectivity agents, so the export of the cluster leaves them to the copy of
+// the manifest that's in the GitOps repo
+var Label string = "gokp.io/konnectivity"
+
+// Version is the version of the apiserver-network-proxy images the server and the agents run
+var Version string = "v0.0.33"
+
+// Dir is where the files of the konnectivity server are kept on the control plane nodes, including the socket the
+// API server talks to it on
+var Dir string = "/etc/kubernetes/konnectivity-server"
+
+// AgentPort is the port the agents connect to the konnectivity server on. It has to be reachable from the nodes on
+// the control plane endpoint (or the host the agents are given)
+var AgentPort int = 8132
+
+// AgentFile is the name of the manifest of the agents written to the workdir
+var AgentFile string = "konnectivity-agent.yaml"
+
+// EgressSelectorConfigFile is the egress selector configuration the API server is started with
+var EgressSelectorConfigFile string = Dir + "/egress-selector-configuration.yaml"
+
+// File is a file kubeadm writes to the control plane nodes before it runs
+type File struct {
+	Path        string
+	Permissions string
+	Content     string
+}
+
+// vars are the values the templates are filled in with
+type vars struct {
+	Dir        string
+	Kubeconfig string
+	Version    string
+	AgentPort  int
+	ServerHost string
+	Label      string
+}
+
+// newVars returns the values the templates are filled in with, with the agents connecting to serverHost
+func newVars(serverHost string) vars {
+	return vars{
+		Dir:        Dir,
+		Kubeconfig: Dir + "/konnectivity-server.conf",
+		Version:    Version,
+		AgentPort:  AgentPort,
+		ServerHost: serverHost,
+		Label:      Label,
+	}
+}
+
+// ControlPlaneFiles returns the files that run the konnectivity server on a control plane node, next to the API
+// server. SetupCommand has to be run once kubeadm is done, since it needs the cluster CA
+func ControlPlaneFiles() ([]File, error) {
+	files := []File{}
+	for _, f := range []struct {
+		path        string
+		permissions string
+		tpl         string
+	}{
+		{EgressSelectorConfigFile, "0644", templates.KonnectivityEgressSelectorConfig},
+		{Dir + "/konnectivity-server.yaml", "0600", templates.KonnectivityServerPod},
+		{SetupCommand(), "0700", templates.KonnectivityServerSetup},
+	} {
+		content, err := render(f.tpl, newVars(""))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, File{Path: f.path, Permissions: f.permissions, Content: content})
+	}
+
+	return files, nil
+}
+
+// SetupCommand is what gives the konnectivity server its kubeconfig and starts it as a static pod
+func SetupCommand() string {
+	return Dir + "/setup.sh"
+}
+
+// WriteAgentManifest writes the manifest of the agents to the workdir, and returns the file. The agents connect to
+// the server on serverHost, or on the host of the API server if it's empty
+func WriteAgentManifest(workdir string, apiServer string, serverHost string) (string, error) {
+	if serverHost == "" {
+		u, err := url.Parse(apiServer)
+		if err != nil {
+			return "", err
+		}
+		serverHost = u.Hostname()
+	}
+
+	agentYaml := workdir + "/" + AgentFile
+	_, err := utils.WriteTemplate(templates.KonnectivityAgent, agentYaml, newVars(serverHost))
+	if err != nil {
+		return "", err
+	}
+	return agentYaml, nil
+}
+
+// render returns the template filled in with the values
+func render(tpl string, v vars) (string, error) {
+	tmpl, err := template.New("konnectivity").Funcs(utils.TemplateFuncs).Parse(tpl)
+	if err != nil {
+		return "", err
+	}
+
+	var b bytes.Buffer
+	err = tmpl.Execute(&b, v)
+	if err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
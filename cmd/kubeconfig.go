@@ -0,0 +1,22 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// kubeconfigCmd represents the kubeconfig command
+var kubeconfigCmd = &cobra.Command{
+	Use:   "kubeconfig",
+	Short: "Manages the contexts of gokp clusters in your kubeconfig",
+	Long: `Manages the contexts of gokp clusters in your kubeconfig. They're merged in
+with "gokp get-kubeconfig --merge". For example:
+
+gokp kubeconfig remove --cluster-name=mycluster`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(kubeconfigCmd)
+}
@@ -0,0 +1,279 @@
+package kubeconfig
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	clientauthv1 "k8s.io/client-go/pkg/apis/clientauthentication/v1"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// ServiceAccount is the account (in ServiceAccountNamespace) that exec credentials are issued for
+var ServiceAccount string = "gokp-admin"
+
+// ServiceAccountNamespace is the namespace of the ServiceAccount
+var ServiceAccountNamespace string = "kube-system"
+
+// TokenExpiration is how long (in seconds) the tokens handed out by ExecCredential are good for
+var TokenExpiration int64 = 3600
+
+// EnableExecAuth creates the ServiceAccount that exec credentials are issued for and makes it a cluster admin.
+// The kubeconfig given is the admin (client certificate) kubeconfig of the cluster
+func EnableExecAuth(kubeconfig string) error {
+	clientset, err := newClientset(kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	sa := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      ServiceAccount,
+			Namespace: ServiceAccountNamespace,
+		},
+	}
+	_, err = clientset.CoreV1().ServiceAccounts(ServiceAccountNamespace).Create(context.TODO(), sa, metav1.CreateOptions{})
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+
+	crb := &rbacv1.ClusterRoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: ServiceAccount,
+		},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: "rbac.authorization.k8s.io",
+			Kind:     "ClusterRole",
+			Name:     "cluster-admin",
+		},
+		Subjects: []rbacv1.Subject{
+			{
+				Kind:      "ServiceAccount",
+				Name:      ServiceAccount,
+				Namespace: ServiceAccountNamespace,
+			},
+		},
+	}
+	_, err = clientset.RbacV1().ClusterRoleBindings().Create(context.TODO(), crb, metav1.CreateOptions{})
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+
+	// If we're here, we should be okay
+	return nil
+}
+
+// WriteExecKubeconfig writes out a copy of the kubeconfig that gets its credentials from "gokp kubeconfig-credential"
+// instead of carrying the client certificate, so there's nothing in it worth stealing
+func WriteExecKubeconfig(kubeconfig string, clusterName string, out string) error {
+	cfg, err := clientcmd.LoadFromFile(kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	execAuth := &clientcmdapi.AuthInfo{
+		Exec: &clientcmdapi.ExecConfig{
+			APIVersion:      "client.authentication.k8s.io/v1",
+			Command:         "gokp",
+			Args:            []string{"kubeconfig-credential", "--cluster-name=" + clusterName},
+			InteractiveMode: clientcmdapi.NeverExecInteractiveMode,
+		},
+	}
+	for name := range cfg.AuthInfos {
+		cfg.AuthInfos[name] = execAuth
+	}
+
+	return clientcmd.WriteToFile(*cfg, out)
+}
+
+// ExecCredential returns the ExecCredential (as JSON) with a short lived token for the ServiceAccount. The
+// kubeconfig given is the admin (client certificate) kubeconfig of the cluster
+func ExecCredential(kubeconfig string) ([]byte, error) {
+	clientset, err := newClientset(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	tr := &authenticationv1.TokenRequest{
+		Spec: authenticationv1.TokenRequestSpec{
+			ExpirationSeconds: &TokenExpiration,
+		},
+	}
+	tr, err = clientset.CoreV1().ServiceAccounts(ServiceAccountNamespace).CreateToken(context.TODO(), ServiceAccount, tr, metav1.CreateOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	cred := &clientauthv1.ExecCredential{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "client.authentication.k8s.io/v1",
+			Kind:       "ExecCredential",
+		},
+		Status: &clientauthv1.ExecCredentialStatus{
+			Token:               tr.Status.Token,
+			ExpirationTimestamp: &tr.Status.ExpirationTimestamp,
+		},
+	}
+
+	return json.Marshal(cred)
+}
+
+// ContextName returns the name of the context the kubeconfig of the cluster is merged in as by default
+func ContextName(clusterName string) string {
+	return "gokp-" + clusterName
+}
+
+// Merge adds the cluster and credentials of the kubeconfig to the kubeconfig file into (creating it if it's not
+// there) under a context with the given name. A context with the name is only replaced if it's for the same API
+// server, so refreshing the credentials works but nothing else is clobbered. into is backed up before it's
+// changed, and the context is made the current one if asked for
+func Merge(kubeconfig string, contextName string, into string, useContext bool) error {
+	src, err := clientcmd.LoadFromFile(kubeconfig)
+	if err != nil {
+		return err
+	}
+	srcContext, ok := src.Contexts[src.CurrentContext]
+	if !ok {
+		return errors.New(kubeconfig + " has no current context")
+	}
+	cluster, ok := src.Clusters[srcContext.Cluster]
+	if !ok {
+		return errors.New(kubeconfig + " has no cluster " + srcContext.Cluster)
+	}
+	authInfo, ok := src.AuthInfos[srcContext.AuthInfo]
+	if !ok {
+		return errors.New(kubeconfig + " has no user " + srcContext.AuthInfo)
+	}
+
+	dest := clientcmdapi.NewConfig()
+	if _, err := os.Stat(into); err == nil {
+		dest, err = clientcmd.LoadFromFile(into)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Everything is named after the context, so it's clear what belongs together
+	if existing, ok := dest.Contexts[contextName]; ok {
+		if c, ok := dest.Clusters[existing.Cluster]; !ok || c.Server != cluster.Server {
+			return errors.New("context " + contextName + " in " + into + " is for another cluster, use another name or remove it first")
+		}
+	}
+	if c, ok := dest.Clusters[contextName]; ok && c.Server != cluster.Server {
+		return errors.New("cluster " + contextName + " in " + into + " is another cluster, use another name or remove it first")
+	}
+	if _, ok := dest.AuthInfos[contextName]; ok && dest.Contexts[contextName] == nil {
+		return errors.New("user " + contextName + " in " + into + " belongs to something else, use another name or remove it first")
+	}
+	dest.Clusters[contextName] = cluster
+	dest.AuthInfos[contextName] = authInfo
+	dest.Contexts[contextName] = &clientcmdapi.Context{
+		Cluster:   contextName,
+		AuthInfo:  contextName,
+		Namespace: srcContext.Namespace,
+	}
+	if useContext || dest.CurrentContext == "" {
+		dest.CurrentContext = contextName
+	}
+
+	err = Backup(into)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(into), 0700)
+	if err != nil {
+		return err
+	}
+	return clientcmd.WriteToFile(*dest, into)
+}
+
+// Remove takes the context out of the kubeconfig file from, along with its cluster and user if no other context
+// uses them. from is backed up before it's changed
+func Remove(contextName string, from string) error {
+	cfg, err := clientcmd.LoadFromFile(from)
+	if err != nil {
+		return err
+	}
+	ctx, ok := cfg.Contexts[contextName]
+	if !ok {
+		return errors.New(from + " has no context " + contextName)
+	}
+
+	delete(cfg.Contexts, contextName)
+	clusterUsed, authInfoUsed := false, false
+	for _, c := range cfg.Contexts {
+		clusterUsed = clusterUsed || c.Cluster == ctx.Cluster
+		authInfoUsed = authInfoUsed || c.AuthInfo == ctx.AuthInfo
+	}
+	if !clusterUsed {
+		delete(cfg.Clusters, ctx.Cluster)
+	}
+	if !authInfoUsed {
+		delete(cfg.AuthInfos, ctx.AuthInfo)
+	}
+	if cfg.CurrentContext == contextName {
+		cfg.CurrentContext = ""
+	}
+
+	err = Backup(from)
+	if err != nil {
+		return err
+	}
+	return clientcmd.WriteToFile(*cfg, from)
+}
+
+// Backup copies the kubeconfig file to <file>.gokp-backup, if it's there, so a change can be undone
+func Backup(file string) error {
+	b, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file+".gokp-backup", b, 0600)
+}
+
+// Extract writes out the context of the kubeconfig (the current one if empty) to out on its own, with the
+// certificates it points to inlined, so it still works once the original is gone
+func Extract(kubeconfig string, contextName string, out string) error {
+	cfg, err := clientcmd.LoadFromFile(kubeconfig)
+	if err != nil {
+		return err
+	}
+	if contextName != "" {
+		if _, ok := cfg.Contexts[contextName]; !ok {
+			return errors.New(kubeconfig + " has no context " + contextName)
+		}
+		cfg.CurrentContext = contextName
+	}
+
+	err = clientcmdapi.MinifyConfig(cfg)
+	if err != nil {
+		return err
+	}
+	err = clientcmdapi.FlattenConfig(cfg)
+	if err != nil {
+		return err
+	}
+	return clientcmd.WriteToFile(*cfg, out)
+}
+
+// newClientset returns a clientset for the kubeconfig
+func newClientset(kubeconfig string) (*kubernetes.Clientset, error) {
+	restConfig, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	return kubernetes.NewForConfig(restConfig)
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/christianh814/gokp/cmd/kubeconfig"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// kubeconfigCredentialCmd represents the kubeconfig-credential command
+var kubeconfigCredentialCmd = &cobra.Command{
+	Use:   "kubeconfig-credential",
+	Short: "Prints a short lived credential for a gokp cluster",
+	Long: `Prints an ExecCredential with a short lived token for a gokp cluster.
+This is called by kubectl when using the exec based kubeconfig that
+gets written with --exec-kubeconfig, and isn't meant to be run by hand.
+For example:
+
+gokp kubeconfig-credential --cluster-name=mycluster`,
+	Run: func(cmd *cobra.Command, args []string) {
+		clusterName, _ := cmd.Flags().GetString("cluster-name")
+		adminKubeconfig, _ := cmd.Flags().GetString("kubeconfig")
+
+		// Default to the admin kubeconfig that was saved at install time
+		if adminKubeconfig == "" {
+			var err error
+			adminKubeconfig, err = clusterSecretFile(clusterName, clusterName+".kubeconfig")
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		cred, err := kubeconfig.ExecCredential(adminKubeconfig)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(string(cred))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(kubeconfigCredentialCmd)
+
+	kubeconfigCredentialCmd.Flags().String("cluster-name", "", "Name of the gokp cluster.")
+	kubeconfigCredentialCmd.Flags().String("kubeconfig", "", "Path to the admin Kubeconfig file of the gokp cluster (defaults to the one under ~/.gokp).")
+
+	kubeconfigCredentialCmd.MarkFlagRequired("cluster-name")
+}
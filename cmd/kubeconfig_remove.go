@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"github.com/christianh814/gokp/cmd/kubeconfig"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// kubeconfigRemoveCmd represents the kubeconfig remove command
+var kubeconfigRemoveCmd = &cobra.Command{
+	Use:   "remove",
+	Short: "Removes the context of a cluster from your kubeconfig",
+	Long: `Removes the context of a cluster from your kubeconfig (~/.kube/config, or
+the first file in $KUBECONFIG), along with its cluster and user if nothing
+else uses them. The kubeconfig is backed up to <kubeconfig>.gokp-backup
+first. For example:
+
+gokp kubeconfig remove --cluster-name=mycluster
+gokp kubeconfig remove --cluster-name=mycluster --context=prod`,
+	Annotations: map[string]string{clusterNameAnnotation: "any"},
+	Run: func(cmd *cobra.Command, args []string) {
+		clusterName, _ := cmd.Flags().GetString("cluster-name")
+		contextName, _ := cmd.Flags().GetString("context")
+		from, _ := cmd.Flags().GetString("remove-from")
+
+		if contextName == "" {
+			contextName = kubeconfig.ContextName(clusterName)
+		}
+		if from == "" {
+			from = clientcmd.NewDefaultPathOptions().GetDefaultFilename()
+		}
+		err := kubeconfig.Remove(contextName, from)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Info("Removed context ", contextName, " from ", from)
+	},
+}
+
+func init() {
+	kubeconfigCmd.AddCommand(kubeconfigRemoveCmd)
+
+	kubeconfigRemoveCmd.Flags().String("cluster-name", "", "Name of the gokp cluster.")
+	kubeconfigRemoveCmd.Flags().String("context", "", "Name of the context to remove (defaults to gokp-<clustername>).")
+	kubeconfigRemoveCmd.Flags().String("remove-from", "", "The kubeconfig to remove it from (defaults to ~/.kube/config, or the first file in $KUBECONFIG).")
+
+	kubeconfigRemoveCmd.MarkFlagRequired("cluster-name")
+}
@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/christianh814/gokp/cmd/logging"
+	"github.com/christianh814/gokp/cmd/state"
+	"github.com/christianh814/gokp/cmd/status"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/yaml"
+)
+
+// listClustersCmd represents the list-clusters command
+var listClustersCmd = &cobra.Command{
+	Use:     "list-clusters",
+	Aliases: []string{"listClusters"},
+	Short:   "Lists the clusters GOKP installed",
+	Long: `Lists the clusters that have state under ~/.gokp (or in the shared state set up
+under "stateBackend" in the config file), along with their Kubernetes version,
+node counts, and health according to the CAPI objects on each cluster.
+Clusters can be narrowed down by the labels given at install time (with
+--labels), the provider, and the region. For example:
+
+gokp list-clusters
+gokp list-clusters --selector env=prod --provider aws -o json
+gokp list-clusters -l 'env in (prod,staging),team!=infra' --region us-east-1
+gokp list-clusters --no-status`,
+	Run: func(cmd *cobra.Command, args []string) {
+		// Grab flags
+		selectorFlag, _ := cmd.Flags().GetString("selector")
+		provider, _ := cmd.Flags().GetString("provider")
+		region, _ := cmd.Flags().GetString("region")
+		output, _ := cmd.Flags().GetString("output")
+		noStatus, _ := cmd.Flags().GetBool("no-status")
+
+		selector, err := labels.Parse(selectorFlag)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		states, err := state.List()
+		if err != nil {
+			log.Fatal(err)
+		}
+		states = state.Filter(states, selector, provider, region)
+
+		entries := []*clusterEntry{}
+		for _, s := range states {
+			entries = append(entries, &clusterEntry{ClusterState: s})
+		}
+		if !noStatus {
+			getClusterStatuses(entries)
+		}
+
+		err = printClusters(entries, output)
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(listClustersCmd)
+
+	listClustersCmd.Flags().StringP("selector", "l", "", "Label selector to filter the clusters on (e.g. env=prod,team!=infra).")
+	listClustersCmd.Flags().String("provider", "", "Only list clusters on this provider (aws, azure, oci, ibmcloud, linode, proxmox, metal3, kubevirt, byoh, development, or adopted).")
+	listClustersCmd.Flags().String("region", "", "Only list clusters in this region (the source node on Proxmox).")
+	listClustersCmd.Flags().StringP("output", "o", "table", "Output format (table, json, or yaml).")
+	listClustersCmd.Flags().Bool("no-status", false, "Only list what was recorded at install time, without asking the clusters how they're doing.")
+}
+
+// clusterEntry is a cluster in the list, its status is nil if it wasn't asked for
+type clusterEntry struct {
+	*state.ClusterState
+	Status *status.ClusterStatus `json:"status,omitempty"`
+}
+
+// getClusterStatuses asks every cluster for its status at the same time, so unreachable ones don't add up
+func getClusterStatuses(entries []*clusterEntry) {
+	var wg sync.WaitGroup
+	for _, e := range entries {
+		// The CAPI objects of clusters managed from elsewhere aren't on the cluster itself
+		if e.ManagementKubeconfig != "" {
+			wg.Add(1)
+			go func(e *clusterEntry) {
+				defer wg.Done()
+				getClusterStatus(e, e.ManagementKubeconfig)
+			}(e)
+			continue
+		}
+		kubeconfig, err := clusterSecretFile(e.Name, e.Name+".kubeconfig")
+		if err != nil {
+			e.Status = &status.ClusterStatus{Health: status.Unreachable, Error: err.Error()}
+			continue
+		}
+		wg.Add(1)
+		go func(e *clusterEntry, kubeconfig string) {
+			defer wg.Done()
+			getClusterStatus(e, kubeconfig)
+		}(e, kubeconfig)
+	}
+	wg.Wait()
+}
+
+// getClusterStatus asks the cluster for its status. It runs alongside the others, so what it logs is tagged with
+// its own cluster
+func getClusterStatus(e *clusterEntry, kubeconfig string) {
+	logger := logging.For(e.Name, "")
+	logger.Debug("Getting the status of ", e.Name)
+	e.Status = status.Get(kubeconfig, e.Name)
+	if e.Status.Error != "" {
+		logger.Debug("Unable to get the status of ", e.Name, ": ", e.Status.Error)
+	}
+}
+
+// printClusters writes the clusters to stdout in the given format
+func printClusters(entries []*clusterEntry, output string) error {
+	switch output {
+	case "json":
+		b, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+	case "yaml":
+		b, err := yaml.Marshal(entries)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(b))
+	case "table":
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(w, "NAME\tPROVIDER\tREGION\tVERSION\tCONTROL PLANE\tWORKERS\tHEALTH\tGITOPS\tLABELS\tCREATED")
+		for _, e := range entries {
+			version, controlPlane, workers, health := valueOrNone(e.KubernetesVersion), "<unknown>", "<unknown>", "<unknown>"
+			if e.Status != nil {
+				health = e.Status.Health
+				if e.Status.Health != status.Unreachable && e.Status.Health != status.Unmanaged {
+					version = valueOrNone(e.Status.KubernetesVersion)
+					controlPlane = fmt.Sprintf("%d/%d", e.Status.ControlPlaneReady, e.Status.ControlPlaneReplicas)
+					workers = fmt.Sprintf("%d/%d", e.Status.WorkersReady, e.Status.WorkersReplicas)
+				}
+			}
+			if e.Hibernated {
+				health += " (hibernated)"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", e.Name, e.Provider, valueOrNone(e.Region), version, controlPlane, workers, health, e.GitOpsController, valueOrNone(formatLabels(e.Labels)), e.CreatedAt.Format("2006-01-02 15:04"))
+		}
+		return w.Flush()
+	default:
+		return fmt.Errorf("unknown output format %s, must be table, json, or yaml", output)
+	}
+
+	// If we're here, we should be okay
+	return nil
+}
+
+// formatLabels returns the labels as a sorted key=value list
+func formatLabels(l map[string]string) string {
+	pairs := []string{}
+	for k, v := range l {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// valueOrNone returns the value, or <none> if it's empty, like kubectl does in tables
+func valueOrNone(v string) string {
+	if v == "" {
+		return "<none>"
+	}
+	return v
+}
@@ -0,0 +1,104 @@
+package logging
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ClusterField and PhaseField are the fields a line is tagged with, which the Formatter puts in front of the message
+var (
+	ClusterField string = "cluster"
+	PhaseField   string = "phase"
+)
+
+// current is the cluster and phase lines are tagged with when they don't say, for commands that work on one
+// cluster at a time. It's shared by every goroutine, so operations running in parallel use For instead
+var current = struct {
+	sync.Mutex
+	cluster string
+	phase   string
+}{}
+
+// SetCluster sets the cluster lines are tagged with from here on, "" for none
+func SetCluster(cluster string) {
+	current.Lock()
+	defer current.Unlock()
+	current.cluster = cluster
+}
+
+// SetPhase sets the phase lines are tagged with from here on, "" for none
+func SetPhase(phase string) {
+	current.Lock()
+	defer current.Unlock()
+	current.phase = phase
+}
+
+// For returns a logger whose lines are tagged with the cluster and phase given, whatever the current ones are. It's
+// what goroutines working on different clusters (or phases) at the same time log with
+func For(cluster string, phase string) *logrus.Entry {
+	fields := logrus.Fields{}
+	if cluster != "" {
+		fields[ClusterField] = cluster
+	}
+	if phase != "" {
+		fields[PhaseField] = phase
+	}
+	return logrus.WithFields(fields)
+}
+
+// Hook tags the lines that aren't tagged yet with the current cluster and phase
+type Hook struct{}
+
+// Levels are all of them
+func (Hook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire adds the current cluster and phase to the line, unless it has them already
+func (Hook) Fire(entry *logrus.Entry) error {
+	current.Lock()
+	defer current.Unlock()
+	if _, ok := entry.Data[ClusterField]; !ok && current.cluster != "" {
+		entry.Data[ClusterField] = current.cluster
+	}
+	if _, ok := entry.Data[PhaseField]; !ok && current.phase != "" {
+		entry.Data[PhaseField] = current.phase
+	}
+	return nil
+}
+
+// Formatter formats lines like the TextFormatter, with the cluster and phase they're tagged with in front of the
+// message (like "[mycluster/ClusterCreated] Creating cluster"), so lines of operations running in parallel can be
+// told apart when they're interleaved
+type Formatter struct {
+	logrus.TextFormatter
+}
+
+// Format moves the cluster and phase of the line into its message. Every line is formatted from its own copy of the
+// entry, so it can be changed
+func (f *Formatter) Format(entry *logrus.Entry) ([]byte, error) {
+	prefix := ""
+	if cluster, ok := entry.Data[ClusterField]; ok {
+		prefix = fmt.Sprint(cluster)
+		delete(entry.Data, ClusterField)
+	}
+	if phase, ok := entry.Data[PhaseField]; ok {
+		if prefix != "" {
+			prefix += "/"
+		}
+		prefix += fmt.Sprint(phase)
+		delete(entry.Data, PhaseField)
+	}
+	if prefix != "" {
+		entry.Message = "[" + prefix + "] " + entry.Message
+	}
+	return f.TextFormatter.Format(entry)
+}
+
+// Setup has the standard logger, which every package logs with, tag its lines and put the tags in front of them
+func Setup() {
+	logrus.SetFormatter(&Formatter{})
+	logrus.AddHook(Hook{})
+}
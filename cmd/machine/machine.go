@@ -0,0 +1,178 @@
+package machine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/christianh814/gokp/cmd/clock"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/kubectl/pkg/drain"
+)
+
+// DeleteAnnotation marks a machine as the one to remove first when its MachineSet scales down
+var DeleteAnnotation string = "cluster.x-k8s.io/delete-machine"
+
+var machineGVR = schema.GroupVersionResource{Group: "cluster.x-k8s.io", Version: "v1beta1", Resource: "machines"}
+
+// ReplaceWait is how often Replace checks for the replacement of the machine, and how long it has to come up
+var ReplaceWait clock.Waiter = clock.Waiter{Interval: 30 * time.Second, Timeout: 30 * time.Minute}
+
+// Get returns the machine in the namespace of the cluster of the kubeconfig. It's an error if it isn't a machine of
+// clusterName
+func Get(kubeconfig string, namespace string, name string, clusterName string) (*unstructured.Unstructured, error) {
+	dyn, err := newDynamicClient(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	m, err := dyn.Resource(machineGVR).Namespace(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if m.GetLabels()["cluster.x-k8s.io/cluster-name"] != clusterName {
+		return nil, errors.New("machine " + namespace + "/" + name + " isn't part of " + clusterName)
+	}
+	return m, nil
+}
+
+// IsControlPlane returns true if the machine is part of the control plane
+func IsControlPlane(m *unstructured.Unstructured) bool {
+	_, ok := m.GetLabels()["cluster.x-k8s.io/control-plane"]
+	return ok
+}
+
+// NodeName returns the name of the node of the machine
+func NodeName(m *unstructured.Unstructured) (string, error) {
+	node, _, _ := unstructured.NestedString(m.Object, "status", "nodeRef", "name")
+	if node == "" {
+		return "", errors.New("machine " + m.GetName() + " has no node")
+	}
+	return node, nil
+}
+
+// Drain cordons the node on the cluster of the kubeconfig and evicts its pods, leaving the ones of DaemonSets. Pods
+// that aren't managed by anything are only deleted with force, and the drain gives up after timeout
+func Drain(kubeconfig string, node string, force bool, timeout time.Duration) error {
+	cfg, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return err
+	}
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	n, err := clientset.CoreV1().Nodes().Get(context.TODO(), node, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	helper := &drain.Helper{
+		Ctx:                 context.TODO(),
+		Client:              clientset,
+		Force:               force,
+		GracePeriodSeconds:  -1,
+		IgnoreAllDaemonSets: true,
+		DeleteEmptyDirData:  true,
+		Timeout:             timeout,
+		Out:                 log.StandardLogger().Writer(),
+		ErrOut:              log.StandardLogger().WriterLevel(log.WarnLevel),
+	}
+
+	log.Info("Cordoning node ", node)
+	err = drain.RunCordonOrUncordon(helper, n, true)
+	if err != nil {
+		return err
+	}
+
+	log.Info("Draining node ", node)
+	return drain.RunNodeDrain(helper, node)
+}
+
+// MarkForDeletion annotates the machine so it's the first to go when its MachineSet scales down
+func MarkForDeletion(kubeconfig string, m *unstructured.Unstructured) error {
+	dyn, err := newDynamicClient(kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				DeleteAnnotation: time.Now().UTC().Format(time.RFC3339),
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = dyn.Resource(machineGVR).Namespace(m.GetNamespace()).Patch(context.TODO(), m.GetName(), types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
+
+// Replace deletes the machine so its MachineSet creates a new one in its place, and waits for the new one to be
+// running. The machine is only replaced if it belongs to a MachineSet
+func Replace(kubeconfig string, m *unstructured.Unstructured) error {
+	dyn, err := newDynamicClient(kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	ms := m.GetLabels()["cluster.x-k8s.io/set-name"]
+	if ms == "" {
+		return errors.New("machine " + m.GetName() + " isn't part of a MachineSet, so nothing would replace it")
+	}
+
+	log.Info("Deleting machine ", m.GetNamespace(), "/", m.GetName())
+	err = dyn.Resource(machineGVR).Namespace(m.GetNamespace()).Delete(context.TODO(), m.GetName(), metav1.DeleteOptions{})
+	if err != nil {
+		return err
+	}
+
+	log.Info("Waiting for the replacement of ", m.GetName(), " to be running")
+	err = ReplaceWait.Until(func() (bool, error) {
+		machines, err := dyn.Resource(machineGVR).Namespace(m.GetNamespace()).List(context.TODO(), metav1.ListOptions{LabelSelector: "cluster.x-k8s.io/set-name=" + ms})
+		return err == nil && replaced(machines.Items, m), nil
+	})
+	if err == clock.ErrTimeout {
+		return errors.New("the replacement of " + m.GetName() + " took too long to come up")
+	}
+	if err != nil {
+		return err
+	}
+
+	// If we're here, we should be okay
+	return nil
+}
+
+// replaced returns true when the machine is gone from the machines of its MachineSet and a newer one is running
+func replaced(machines []unstructured.Unstructured, old *unstructured.Unstructured) bool {
+	found := false
+	for _, m := range machines {
+		if m.GetName() == old.GetName() {
+			return false
+		}
+		phase, _, _ := unstructured.NestedString(m.Object, "status", "phase")
+		if phase == "Running" && m.GetCreationTimestamp().After(old.GetCreationTimestamp().Time) {
+			found = true
+		}
+	}
+	return found
+}
+
+// newDynamicClient returns a dynamic client for the kubeconfig
+func newDynamicClient(kubeconfig string) (dynamic.Interface, error) {
+	cfg, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	return dynamic.NewForConfig(cfg)
+}
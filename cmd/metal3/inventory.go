@@ -0,0 +1,141 @@
+package metal3
+
+import (
+	"errors"
+	"io/ioutil"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/yaml"
+)
+
+// Inventory is the bare metal hosts a cluster is installed on, and how to reach their BMCs. For example:
+//
+//	hosts:
+//	- name: node-0
+//	  bootMACAddress: "00:5c:52:31:3a:9c"
+//	  bmc:
+//	    address: ipmi://192.168.111.1:6230
+//	    username: admin
+//	    password: password
+type Inventory struct {
+	Hosts []Host `json:"hosts"`
+}
+
+// Host is a bare metal host of the inventory
+type Host struct {
+	Name           string `json:"name"`
+	BootMACAddress string `json:"bootMACAddress"`
+	BMC            BMC    `json:"bmc"`
+	// RootDeviceHints tell Ironic which disk to put the image on, like deviceName: /dev/sda
+	RootDeviceHints map[string]interface{} `json:"rootDeviceHints,omitempty"`
+}
+
+// BMC is how Ironic reaches the management controller of a host. The address is one Ironic understands, like
+// ipmi://, redfish://, or idrac://
+type BMC struct {
+	Address                        string `json:"address"`
+	Username                       string `json:"username"`
+	Password                       string `json:"password"`
+	DisableCertificateVerification bool   `json:"disableCertificateVerification,omitempty"`
+}
+
+// LoadInventory reads the inventory from the file, and makes sure every host has what it needs
+func LoadInventory(file string) (*Inventory, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	inv := &Inventory{}
+	err = yaml.UnmarshalStrict(b, inv)
+	if err != nil {
+		return nil, errors.New("unable to read the inventory " + file + ": " + err.Error())
+	}
+	if len(inv.Hosts) < 2 {
+		return nil, errors.New("the inventory needs at least 2 hosts, one for the control plane and one worker")
+	}
+
+	seen := map[string]bool{}
+	for _, h := range inv.Hosts {
+		if errs := validation.IsDNS1123Subdomain(h.Name); len(errs) > 0 {
+			return nil, errors.New("invalid host name " + h.Name + ": " + strings.Join(errs, ", "))
+		}
+		if seen[h.Name] {
+			return nil, errors.New("host " + h.Name + " is in the inventory more than once")
+		}
+		seen[h.Name] = true
+		if h.BootMACAddress == "" || h.BMC.Address == "" || h.BMC.Username == "" || h.BMC.Password == "" {
+			return nil, errors.New("host " + h.Name + " needs a bootMACAddress and a BMC address, username, and password")
+		}
+	}
+
+	return inv, nil
+}
+
+// ControlPlaneCount returns how many of the hosts are used for the control plane. It's HA if there are enough
+// hosts left over for 3 workers
+func (inv *Inventory) ControlPlaneCount() int64 {
+	if len(inv.Hosts) >= 6 {
+		return 3
+	}
+	return 1
+}
+
+// WriteHosts writes the BareMetalHosts of the inventory, along with the Secrets with their BMC credentials, to the
+// file. The hosts are put in the namespace the cluster is in
+func (inv *Inventory) WriteHosts(file string, namespace string) error {
+	docs := []string{}
+	for _, h := range inv.Hosts {
+		// The Bare Metal Operator only watches secrets with the label
+		secretName := h.Name + "-bmc-secret"
+		secret := map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Secret",
+			"metadata": map[string]interface{}{
+				"name":      secretName,
+				"namespace": namespace,
+				"labels": map[string]interface{}{
+					"environment.metal3.io": "baremetal",
+				},
+			},
+			"type": "Opaque",
+			"stringData": map[string]interface{}{
+				"username": h.BMC.Username,
+				"password": h.BMC.Password,
+			},
+		}
+
+		spec := map[string]interface{}{
+			"online":         true,
+			"bootMACAddress": h.BootMACAddress,
+			"bmc": map[string]interface{}{
+				"address":                        h.BMC.Address,
+				"credentialsName":                secretName,
+				"disableCertificateVerification": h.BMC.DisableCertificateVerification,
+			},
+		}
+		if len(h.RootDeviceHints) > 0 {
+			spec["rootDeviceHints"] = h.RootDeviceHints
+		}
+		bmh := map[string]interface{}{
+			"apiVersion": "metal3.io/v1alpha1",
+			"kind":       "BareMetalHost",
+			"metadata": map[string]interface{}{
+				"name":      h.Name,
+				"namespace": namespace,
+			},
+			"spec": spec,
+		}
+
+		for _, obj := range []map[string]interface{}{secret, bmh} {
+			b, err := yaml.Marshal(obj)
+			if err != nil {
+				return err
+			}
+			docs = append(docs, string(b))
+		}
+	}
+
+	return ioutil.WriteFile(file, []byte(strings.Join(docs, "---\n")), 0600)
+}
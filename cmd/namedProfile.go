@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// namedProfileEnv picks the named profile when --config-profile isn't given
+var namedProfileEnv string = "GOKP_PROFILE"
+
+// namedProfilesFile returns the file that holds the named profiles, which is kept apart from the config file as it
+// holds credentials
+func namedProfilesFile() string {
+	return os.Getenv("HOME") + "/.gokp/config"
+}
+
+// addNamedProfileFlag adds the flag to pick a named profile. It's apart from --profile, which picks a sizing profile
+func addNamedProfileFlag(c *cobra.Command) {
+	c.Flags().String("config-profile", "", "Use a named profile from ~/.gokp/config (or "+namedProfileEnv+"). Flags that are given override it.")
+}
+
+// namedProfiles reads the named profiles, by name. There are none if the file isn't there
+func namedProfiles() (map[string]interface{}, error) {
+	file := namedProfilesFile()
+	info, err := os.Stat(file)
+	if os.IsNotExist(err) {
+		return map[string]interface{}{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		log.Warn(file, " can be read by others, it should only be readable by you (chmod 600 ", file, ")")
+	}
+
+	v := viper.New()
+	v.SetConfigFile(file)
+	v.SetConfigType("yaml")
+	err = v.ReadInConfig()
+	if err != nil {
+		return nil, errors.New("unable to read " + file + ": " + err.Error())
+	}
+
+	return v.AllSettings(), nil
+}
+
+// applyNamedProfile sets the flags of the command from the named profile given with --config-profile (or
+// GOKP_PROFILE, or the one named default if there is one), except the ones given on the command line. Keys are flag
+// names, like the createCluster section of the config file, and a profile can pick a sizing profile with its own
+// profile key
+func applyNamedProfile(cmd *cobra.Command) error {
+	if cmd.Flags().Lookup("config-profile") == nil {
+		return nil
+	}
+
+	profiles, err := namedProfiles()
+	if err != nil {
+		return err
+	}
+
+	name, _ := cmd.Flags().GetString("config-profile")
+	if name == "" {
+		name = os.Getenv(namedProfileEnv)
+	}
+	// The names are read lowercased
+	name = strings.ToLower(name)
+	if name == "" {
+		if _, ok := profiles["default"]; !ok {
+			return nil
+		}
+		name = "default"
+	}
+	profile, ok := profiles[name].(map[string]interface{})
+	if !ok {
+		names := []string{}
+		for n := range profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return errors.New("unknown profile " + name + " in " + namedProfilesFile() + ", it should be one of: " + strings.Join(names, ", "))
+	}
+
+	log.Info("Using the ", name, " profile from ", namedProfilesFile())
+	settings := []string{}
+	for setting := range profile {
+		settings = append(settings, setting)
+	}
+	sort.Strings(settings)
+	for _, setting := range settings {
+		flag := cmd.Flags().Lookup(setting)
+		if flag == nil && isProviderFlag(cmd, setting) {
+			// It's for another provider, a profile can hold the credentials of more than one
+			continue
+		}
+		if flag == nil {
+			return errors.New("unknown setting " + setting + " in the " + name + " profile, it should be a flag of \"" + cmd.CommandPath() + "\"")
+		}
+		if cmd.Flags().Changed(setting) {
+			continue
+		}
+
+		values, err := clusterConfigValues(profile[setting])
+		if err != nil {
+			return errors.New("invalid setting " + setting + " in the " + name + " profile: " + err.Error())
+		}
+		for _, value := range values {
+			err = cmd.Flags().Set(setting, value)
+			if err != nil {
+				return errors.New("invalid setting " + setting + " in the " + name + " profile: " + err.Error())
+			}
+		}
+	}
+
+	return nil
+}
+
+// isProviderFlag returns if a provider of create-cluster has the flag
+func isProviderFlag(cmd *cobra.Command, name string) bool {
+	createCluster, _, err := cmd.Root().Find([]string{"create-cluster"})
+	if err != nil || createCluster.Name() != "create-cluster" {
+		return false
+	}
+	for _, c := range createCluster.Commands() {
+		if c.Flags().Lookup(name) != nil {
+			return true
+		}
+	}
+	return false
+}
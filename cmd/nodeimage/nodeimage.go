@@ -0,0 +1,233 @@
+package nodeimage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/christianh814/gokp/cmd/export"
+	log "github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// AMIOwner is the AWS account the CAPA project publishes its AMIs from
+var AMIOwner string = "258751437250"
+
+// Kinds are the kinds that point at a machine template, in the order their machines have to be replaced in. The
+// control plane goes before the workers
+var Kinds = []string{"KubeadmControlPlane", "MachineDeployment"}
+
+// infrastructureRefPaths is where the reference to the machine template is in each of the Kinds
+var infrastructureRefPaths = map[string][]string{
+	"KubeadmControlPlane": {"spec", "machineTemplate", "infrastructureRef"},
+	"MachineDeployment":   {"spec", "template", "spec", "infrastructureRef"},
+}
+
+// amiPath is where the AMI is in an AWSMachineTemplate
+var amiPath = []string{"spec", "template", "spec", "ami", "id"}
+
+// amiSuffix is what TemplateName adds to the name of a machine template
+var amiSuffix = regexp.MustCompile(`-ami-[0-9a-f]+$`)
+
+// Rotation is what SetAMI changed. Machine templates can't be changed once they're created, so the AMI goes into
+// new ones that the owners are pointed at. The old ones are kept until the machines are replaced
+type Rotation struct {
+	Templates    []*unstructured.Unstructured
+	Owners       []*unstructured.Unstructured
+	OldTemplates []*unstructured.Unstructured
+}
+
+// LatestAMI returns the newest AMI CAPA published for the Kubernetes version and OS (e.g. ubuntu-20.04) in the
+// region. The default credential chain is used if no keys are given
+func LatestAMI(region string, accessKey string, secretKey string, kubernetesVersion string, baseOS string) (string, error) {
+	cfg := &aws.Config{Region: aws.String(region)}
+	if accessKey != "" && secretKey != "" {
+		cfg.Credentials = credentials.NewStaticCredentials(accessKey, secretKey, "")
+	}
+	sess, err := session.NewSession(cfg)
+	if err != nil {
+		return "", err
+	}
+
+	// This is the name CAPA looks its AMIs up with, the ? is the v of the version that some have and some don't
+	name := "capa-ami-" + baseOS + "-?" + strings.TrimPrefix(kubernetesVersion, "v") + "-*"
+	out, err := ec2.New(sess).DescribeImages(&ec2.DescribeImagesInput{
+		Owners: aws.StringSlice([]string{AMIOwner}),
+		Filters: []*ec2.Filter{
+			{Name: aws.String("name"), Values: aws.StringSlice([]string{name})},
+			{Name: aws.String("architecture"), Values: aws.StringSlice([]string{"x86_64"})},
+			{Name: aws.String("state"), Values: aws.StringSlice([]string{"available"})},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(out.Images) == 0 {
+		return "", errors.New("no AMI found for " + baseOS + " and Kubernetes " + kubernetesVersion + " in " + region)
+	}
+
+	// The creation dates are RFC 3339, so they sort as strings
+	sort.Slice(out.Images, func(i, j int) bool {
+		return aws.StringValue(out.Images[i].CreationDate) > aws.StringValue(out.Images[j].CreationDate)
+	})
+	log.Info("Latest AMI for Kubernetes ", kubernetesVersion, " is ", aws.StringValue(out.Images[0].ImageId), " (", aws.StringValue(out.Images[0].Name), ")")
+	return aws.StringValue(out.Images[0].ImageId), nil
+}
+
+// KubernetesVersion returns the Kubernetes version of the control plane exported under baseDir
+func KubernetesVersion(baseDir string) (string, error) {
+	version := ""
+	_, err := export.UpdateExported(baseDir, "KubeadmControlPlane", func(obj *unstructured.Unstructured) (bool, error) {
+		version, _, _ = unstructured.NestedString(obj.Object, "spec", "version")
+		return false, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if version == "" {
+		return "", errors.New("the KubeadmControlPlane under " + baseDir + " has no version")
+	}
+	return version, nil
+}
+
+// SetAMI writes out a copy of every AWSMachineTemplate exported under baseDir that doesn't use the AMI yet with the
+// AMI set, and points the objects of the Kinds that use it at the copy
+func SetAMI(baseDir string, ami string) (*Rotation, error) {
+	r := &Rotation{}
+	copies := map[string]*unstructured.Unstructured{}
+
+	for _, kind := range Kinds {
+		path := infrastructureRefPaths[kind]
+		owners, err := export.UpdateExported(baseDir, kind, func(obj *unstructured.Unstructured) (bool, error) {
+			refKind, _, _ := unstructured.NestedString(obj.Object, append(path, "kind")...)
+			refName, _, _ := unstructured.NestedString(obj.Object, append(path, "name")...)
+			if refKind != "AWSMachineTemplate" {
+				return false, nil
+			}
+			namespace := obj.GetNamespace()
+			if namespace == "" {
+				namespace = "default"
+			}
+
+			c, ok := copies[namespace+"/"+refName]
+			if !ok {
+				old, err := export.ReadExported(baseDir, namespace, refKind, refName)
+				if err != nil {
+					return false, err
+				}
+				current, _, _ := unstructured.NestedString(old.Object, amiPath...)
+				if current == ami {
+					return false, nil
+				}
+
+				c = old.DeepCopy()
+				c.SetName(TemplateName(refName, ami))
+				c.SetNamespace(namespace)
+				c.SetAnnotations(nil)
+				err = unstructured.SetNestedField(c.Object, ami, amiPath...)
+				if err != nil {
+					return false, err
+				}
+				log.Info("Writing AWSMachineTemplate ", c.GetName(), " in place of ", refName)
+				err = export.WriteExported(baseDir, c)
+				if err != nil {
+					return false, err
+				}
+				copies[namespace+"/"+refName] = c
+				r.Templates = append(r.Templates, c)
+				r.OldTemplates = append(r.OldTemplates, old)
+			}
+
+			return true, unstructured.SetNestedField(obj.Object, c.GetName(), append(path, "name")...)
+		})
+		if err != nil {
+			return nil, err
+		}
+		r.Owners = append(r.Owners, owners...)
+	}
+
+	// If we're here, we should be okay
+	return r, nil
+}
+
+// TemplateName returns the name of the copy of the machine template for the AMI. Copies of copies are named after
+// the original
+func TemplateName(name string, ami string) string {
+	return amiSuffix.ReplaceAllString(name, "") + "-" + ami
+}
+
+// RemoveOld removes the machine templates that were replaced from under baseDir, once nothing uses them
+func RemoveOld(baseDir string, r *Rotation) error {
+	for _, old := range r.OldTemplates {
+		err := export.RemoveExported(baseDir, old.GetNamespace(), old.GetKind(), old.GetName())
+		if err != nil {
+			return err
+		}
+	}
+
+	// If we're here, we should be okay
+	return nil
+}
+
+// PatchCluster creates the new machine templates on the cluster of the kubeconfig and points the owners at them,
+// which starts the rolling replacement of their machines
+func PatchCluster(kubeconfig string, r *Rotation) error {
+	cfg, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return err
+	}
+	dyn, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	for _, t := range r.Templates {
+		_, err = dyn.Resource(gvr(t)).Namespace(t.GetNamespace()).Create(context.TODO(), t, metav1.CreateOptions{})
+		if err != nil && !apierrors.IsAlreadyExists(err) {
+			return err
+		}
+	}
+
+	for _, obj := range r.Owners {
+		path := infrastructureRefPaths[obj.GetKind()]
+		name, _, _ := unstructured.NestedString(obj.Object, append(path, "name")...)
+
+		// Build the patch from the inside out
+		var patch interface{} = map[string]interface{}{"name": name}
+		for i := len(path) - 1; i >= 0; i-- {
+			patch = map[string]interface{}{path[i]: patch}
+		}
+		b, err := json.Marshal(patch)
+		if err != nil {
+			return err
+		}
+
+		log.Info("Pointing ", obj.GetKind(), " ", obj.GetNamespace(), "/", obj.GetName(), " at ", name)
+		_, err = dyn.Resource(gvr(obj)).Namespace(obj.GetNamespace()).Patch(context.TODO(), obj.GetName(), types.MergePatchType, b, metav1.PatchOptions{})
+		if err != nil {
+			return err
+		}
+	}
+
+	// If we're here, we should be okay
+	return nil
+}
+
+// gvr returns the resource of the object
+func gvr(obj *unstructured.Unstructured) schema.GroupVersionResource {
+	gv, _ := schema.ParseGroupVersion(obj.GetAPIVersion())
+	return gv.WithResource(strings.ToLower(obj.GetKind()) + "s")
+}
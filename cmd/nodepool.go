@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"github.com/christianh814/gokp/cmd/gitutils"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// nodepoolCmd represents the nodepool command
+var nodepoolCmd = &cobra.Command{
+	Use:   "nodepool",
+	Short: "Manages the node pools of a cluster",
+	Long: `Manages the extra node pools of a cluster. A node pool is a MachineDeployment
+(with its own machine template and KubeadmConfigTemplate) that is committed to
+the GitOps repo, so the GitOps controller creates or prunes it. For example:
+
+gokp nodepool add --cluster-name=mycluster --name=gpu --workers=2 \
+	--instance-type=g4dn.xlarge --labels=gpu=true --taints=nvidia.com/gpu=true:NoSchedule
+gokp nodepool delete --cluster-name=mycluster --name=gpu`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(nodepoolCmd)
+}
+
+// updateNodePools lets update change the node pools in the GitOps repo of the cluster and pushes the change out
+func updateNodePools(cmd *cobra.Command, clusterName string, msg string, update func(baseDir string) error) error {
+	// Find the local clone of the repo
+	repoDir, privateKeyFile, err := openClusterRepo(clusterName)
+	if err != nil {
+		return err
+	}
+
+	err = update(gitutils.BaseDir(repoDir))
+	if err != nil {
+		return err
+	}
+
+	// HTTPS remotes use the token, everything else uses the stored key
+	err = setRepoCredentials(cmd, repoDir)
+	if err != nil {
+		return err
+	}
+	_, err = commitAndPush(repoDir, privateKeyFile, clusterName, msg)
+	if err != nil {
+		return err
+	}
+
+	// If we're here, we should be okay
+	log.Info("Node pools of ", clusterName, " pushed out, the GitOps controller will apply them")
+	return nil
+}
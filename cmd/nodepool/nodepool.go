@@ -0,0 +1,280 @@
+package nodepool
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/christianh814/gokp/cmd/export"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// PoolLabel is the label on the MachineDeployments of node pools, so we only ever delete what we added
+var PoolLabel string = "gokp.io/nodepool"
+
+// instanceTypeFields is where the instance type is set in the machine template of each infrastructure provider
+var instanceTypeFields = map[string][]string{
+	"AWSMachineTemplate":   {"spec", "template", "spec", "instanceType"},
+	"AzureMachineTemplate": {"spec", "template", "spec", "vmSize"},
+	"OCIMachineTemplate":   {"spec", "template", "spec", "shape"},
+}
+
+// nodeRegistrationPath is where the kubelet settings of the nodes are in a KubeadmConfigTemplate
+var nodeRegistrationPath = []string{"spec", "template", "spec", "joinConfiguration", "nodeRegistration"}
+
+// NodePool is a set of workers added to a cluster after it was installed. The instance type is left as it is in
+// the MachineDeployment the pool is copied from if it's empty
+type NodePool struct {
+	Name         string
+	Replicas     int64
+	InstanceType string
+	Labels       map[string]string
+	Taints       []corev1.Taint
+}
+
+// Add writes out a MachineDeployment, along with its machine template and KubeadmConfigTemplate, for the pool under
+// the cluster/core dir of baseDir. They're copies of the ones of the MachineDeployment named from, named
+// <clustername>-<pool>
+func Add(baseDir string, clusterName string, from string, pool NodePool) error {
+	if errs := validation.IsDNS1123Label(pool.Name); len(errs) > 0 {
+		return errors.New("invalid node pool name " + pool.Name + ": " + strings.Join(errs, ", "))
+	}
+	if pool.Replicas < 0 {
+		return errors.New("the number of replicas can't be negative")
+	}
+	name := clusterName + "-" + pool.Name
+
+	// Find the MachineDeployment to copy, and make sure the pool isn't there already
+	var source *unstructured.Unstructured
+	_, err := export.UpdateExported(baseDir, "MachineDeployment", func(obj *unstructured.Unstructured) (bool, error) {
+		if obj.GetName() == name {
+			return false, errors.New("MachineDeployment " + name + " already exists")
+		}
+		if obj.GetName() == from {
+			source = obj
+		}
+		return false, nil
+	})
+	if err != nil {
+		return err
+	}
+	if source == nil {
+		return errors.New("MachineDeployment " + from + " not found, it's needed to copy the node pool from")
+	}
+	namespace := source.GetNamespace()
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	// The machine template is what has the instance type
+	infraKind, _, _ := unstructured.NestedString(source.Object, "spec", "template", "spec", "infrastructureRef", "kind")
+	infraName, _, _ := unstructured.NestedString(source.Object, "spec", "template", "spec", "infrastructureRef", "name")
+	infra, err := export.ReadExported(baseDir, namespace, infraKind, infraName)
+	if err != nil {
+		return err
+	}
+	infra = copyObject(infra, name)
+	if pool.InstanceType != "" {
+		field, ok := instanceTypeFields[infraKind]
+		if !ok {
+			return errors.New("the instance type can't be set on a " + infraKind)
+		}
+		err = unstructured.SetNestedField(infra.Object, pool.InstanceType, field...)
+		if err != nil {
+			return err
+		}
+	}
+
+	// The KubeadmConfigTemplate is what has the kubelet settings
+	bootstrapKind, _, _ := unstructured.NestedString(source.Object, "spec", "template", "spec", "bootstrap", "configRef", "kind")
+	bootstrapName, _, _ := unstructured.NestedString(source.Object, "spec", "template", "spec", "bootstrap", "configRef", "name")
+	bootstrap, err := export.ReadExported(baseDir, namespace, bootstrapKind, bootstrapName)
+	if err != nil {
+		return err
+	}
+	bootstrap = copyObject(bootstrap, name)
+	err = setNodeRegistration(bootstrap, pool.Labels, pool.Taints)
+	if err != nil {
+		return err
+	}
+
+	// The MachineDeployment points at both, and selects its own Machines
+	md := copyObject(source, name)
+	labels := md.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[PoolLabel] = pool.Name
+	md.SetLabels(labels)
+	for _, path := range [][]string{
+		{"spec", "template", "spec", "infrastructureRef", "name"},
+		{"spec", "template", "spec", "bootstrap", "configRef", "name"},
+		{"spec", "selector", "matchLabels", "cluster.x-k8s.io/deployment-name"},
+		{"spec", "template", "metadata", "labels", "cluster.x-k8s.io/deployment-name"},
+	} {
+		err = unstructured.SetNestedField(md.Object, name, path...)
+		if err != nil {
+			return err
+		}
+	}
+	err = unstructured.SetNestedField(md.Object, pool.Replicas, "spec", "replicas")
+	if err != nil {
+		return err
+	}
+
+	log.Info("Adding node pool ", name, " with ", pool.Replicas, " workers")
+	for _, obj := range []*unstructured.Unstructured{infra, bootstrap, md} {
+		err = export.WriteExported(baseDir, obj)
+		if err != nil {
+			return err
+		}
+	}
+
+	// If we're here, we should be okay
+	return nil
+}
+
+// Delete removes the MachineDeployment of the pool, along with its machine template and KubeadmConfigTemplate, from
+// under the cluster/core dir of baseDir. Only pools that were added with Add can be deleted
+func Delete(baseDir string, poolName string) error {
+	var md *unstructured.Unstructured
+	_, err := export.UpdateExported(baseDir, "MachineDeployment", func(obj *unstructured.Unstructured) (bool, error) {
+		if obj.GetLabels()[PoolLabel] == poolName {
+			md = obj
+		}
+		return false, nil
+	})
+	if err != nil {
+		return err
+	}
+	if md == nil {
+		return errors.New("node pool " + poolName + " not found")
+	}
+	namespace := md.GetNamespace()
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	log.Info("Deleting node pool ", md.GetName())
+	err = export.RemoveExported(baseDir, namespace, "MachineDeployment", md.GetName())
+	if err != nil {
+		return err
+	}
+
+	// The templates were made for the pool, so nothing else uses them
+	for _, ref := range [][]string{
+		{"spec", "template", "spec", "infrastructureRef"},
+		{"spec", "template", "spec", "bootstrap", "configRef"},
+	} {
+		kind, _, _ := unstructured.NestedString(md.Object, append(ref, "kind")...)
+		name, _, _ := unstructured.NestedString(md.Object, append(ref, "name")...)
+		if name != md.GetName() {
+			continue
+		}
+		err = export.RemoveExported(baseDir, namespace, kind, name)
+		if err != nil {
+			return err
+		}
+	}
+
+	// If we're here, we should be okay
+	return nil
+}
+
+// InstanceType returns the instance type set in the machine template, empty if its provider doesn't have one
+func InstanceType(template *unstructured.Unstructured) string {
+	field, ok := instanceTypeFields[template.GetKind()]
+	if !ok {
+		return ""
+	}
+	instanceType, _, _ := unstructured.NestedString(template.Object, field...)
+	return instanceType
+}
+
+// ParseTaint parses a taint given as key=value:effect, or key:effect
+func ParseTaint(s string) (corev1.Taint, error) {
+	taint := corev1.Taint{}
+	i := strings.LastIndex(s, ":")
+	if i == -1 {
+		return taint, errors.New("taint " + s + " has no effect, it should be key=value:effect")
+	}
+	taint.Effect = corev1.TaintEffect(s[i+1:])
+	switch taint.Effect {
+	case corev1.TaintEffectNoSchedule, corev1.TaintEffectPreferNoSchedule, corev1.TaintEffectNoExecute:
+	default:
+		return taint, errors.New("taint " + s + " has an invalid effect, it should be NoSchedule, PreferNoSchedule, or NoExecute")
+	}
+
+	taint.Key = s[:i]
+	if j := strings.Index(taint.Key, "="); j != -1 {
+		taint.Key, taint.Value = taint.Key[:j], taint.Key[j+1:]
+	}
+	if errs := validation.IsQualifiedName(taint.Key); len(errs) > 0 {
+		return taint, errors.New("invalid taint key " + taint.Key + ": " + strings.Join(errs, ", "))
+	}
+
+	return taint, nil
+}
+
+// copyObject returns a copy of the exported object with the new name
+func copyObject(obj *unstructured.Unstructured, name string) *unstructured.Unstructured {
+	c := obj.DeepCopy()
+	c.SetName(name)
+	c.SetAnnotations(nil)
+	if c.GetNamespace() == "" {
+		c.SetNamespace("default")
+	}
+	return c
+}
+
+// setNodeRegistration adds the labels and taints to the nodes the KubeadmConfigTemplate joins
+func setNodeRegistration(bootstrap *unstructured.Unstructured, labels map[string]string, taints []corev1.Taint) error {
+	if len(labels) > 0 {
+		args, _, err := unstructured.NestedStringMap(bootstrap.Object, append(nodeRegistrationPath, "kubeletExtraArgs")...)
+		if err != nil {
+			return err
+		}
+		if args == nil {
+			args = map[string]string{}
+		}
+
+		nodeLabels := []string{}
+		if args["node-labels"] != "" {
+			nodeLabels = strings.Split(args["node-labels"], ",")
+		}
+		for k, v := range labels {
+			nodeLabels = append(nodeLabels, k+"="+v)
+		}
+		sort.Strings(nodeLabels)
+		args["node-labels"] = strings.Join(nodeLabels, ",")
+
+		err = unstructured.SetNestedStringMap(bootstrap.Object, args, append(nodeRegistrationPath, "kubeletExtraArgs")...)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(taints) > 0 {
+		list := []interface{}{}
+		for _, t := range taints {
+			taint := map[string]interface{}{
+				"key":    t.Key,
+				"effect": string(t.Effect),
+			}
+			if t.Value != "" {
+				taint["value"] = t.Value
+			}
+			list = append(list, taint)
+		}
+		err := unstructured.SetNestedSlice(bootstrap.Object, list, append(nodeRegistrationPath, "taints")...)
+		if err != nil {
+			return err
+		}
+	}
+
+	// If we're here, we should be okay
+	return nil
+}
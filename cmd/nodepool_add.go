@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"github.com/christianh814/gokp/cmd/nodepool"
+	"github.com/christianh814/gokp/cmd/state"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// nodepoolAddCmd represents the nodepool add command
+var nodepoolAddCmd = &cobra.Command{
+	Use:   "add",
+	Short: "Adds a node pool to a cluster",
+	Long: `Adds a node pool to a cluster. The pool is a copy of the workers of the
+cluster (the <clustername>-md-0 MachineDeployment by default), named
+<clustername>-<name>, with the given number of workers, instance type, node
+labels, and taints. The instance type is the instanceType on AWS, the vmSize
+on Azure, and the shape on OCI. For example:
+
+gokp nodepool add --cluster-name=mycluster --name=gpu --workers=2 \
+	--instance-type=g4dn.xlarge --labels=gpu=true --taints=nvidia.com/gpu=true:NoSchedule`,
+	Annotations: map[string]string{stateLockAnnotation: "true"},
+	Run: func(cmd *cobra.Command, args []string) {
+		// Grab flags
+		clusterName, _ := cmd.Flags().GetString("cluster-name")
+		name, _ := cmd.Flags().GetString("name")
+		workers, _ := cmd.Flags().GetInt64("workers")
+		instanceType, _ := cmd.Flags().GetString("instance-type")
+		nodeLabels, _ := cmd.Flags().GetStringToString("labels")
+		taintFlags, _ := cmd.Flags().GetStringArray("taints")
+		from, _ := cmd.Flags().GetString("from")
+		if from == "" {
+			from = clusterName + "-md-0"
+		}
+
+		// Catch bad labels and taints before anything is written
+		err := state.ValidateLabels(nodeLabels)
+		if err != nil {
+			log.Fatal(err)
+		}
+		taints := []corev1.Taint{}
+		for _, t := range taintFlags {
+			taint, err := nodepool.ParseTaint(t)
+			if err != nil {
+				log.Fatal(err)
+			}
+			taints = append(taints, taint)
+		}
+
+		pool := nodepool.NodePool{
+			Name:         name,
+			Replicas:     workers,
+			InstanceType: instanceType,
+			Labels:       nodeLabels,
+			Taints:       taints,
+		}
+		err = updateNodePools(cmd, clusterName, "adding node pool "+name, func(baseDir string) error {
+			return nodepool.Add(baseDir, clusterName, from, pool)
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	nodepoolCmd.AddCommand(nodepoolAddCmd)
+
+	nodepoolAddCmd.Flags().String("cluster-name", "", "Name of the gokp cluster.")
+	nodepoolAddCmd.Flags().String("name", "", "Name of the node pool.")
+	nodepoolAddCmd.Flags().Int64("workers", 1, "The number of workers in the node pool.")
+	nodepoolAddCmd.Flags().String("instance-type", "", "The instance type of the workers (defaults to the one of the MachineDeployment copied).")
+	nodepoolAddCmd.Flags().StringToString("labels", nil, "Labels to put on the nodes (key=value).")
+	nodepoolAddCmd.Flags().StringArray("taints", []string{}, "Taints to put on the nodes (key=value:effect), can be given more than once.")
+	nodepoolAddCmd.Flags().String("from", "", "The MachineDeployment to copy (defaults to <clustername>-md-0).")
+	addRepoAuthFlags(nodepoolAddCmd)
+
+	nodepoolAddCmd.MarkFlagRequired("cluster-name")
+	nodepoolAddCmd.MarkFlagRequired("name")
+}
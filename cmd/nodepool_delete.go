@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"github.com/christianh814/gokp/cmd/nodepool"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// nodepoolDeleteCmd represents the nodepool delete command
+var nodepoolDeleteCmd = &cobra.Command{
+	Use:   "delete",
+	Short: "Deletes a node pool from a cluster",
+	Long: `Deletes a node pool that was added with "gokp nodepool add" from the GitOps
+repo, so the GitOps controller prunes it and its workers are removed. The
+workers the cluster was installed with can't be deleted this way. For example:
+
+gokp nodepool delete --cluster-name=mycluster --name=gpu`,
+	Annotations: map[string]string{stateLockAnnotation: "true"},
+	Run: func(cmd *cobra.Command, args []string) {
+		// Grab flags
+		clusterName, _ := cmd.Flags().GetString("cluster-name")
+		name, _ := cmd.Flags().GetString("name")
+
+		err := updateNodePools(cmd, clusterName, "deleting node pool "+name, func(baseDir string) error {
+			return nodepool.Delete(baseDir, name)
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	nodepoolCmd.AddCommand(nodepoolDeleteCmd)
+
+	nodepoolDeleteCmd.Flags().String("cluster-name", "", "Name of the gokp cluster.")
+	nodepoolDeleteCmd.Flags().String("name", "", "Name of the node pool.")
+	addRepoAuthFlags(nodepoolDeleteCmd)
+
+	nodepoolDeleteCmd.MarkFlagRequired("cluster-name")
+	nodepoolDeleteCmd.MarkFlagRequired("name")
+}
@@ -0,0 +1,19 @@
+package cmd
+
+import (
+	"github.com/christianh814/gokp/cmd/prereqs"
+	"github.com/spf13/viper"
+)
+
+// setPreReqChecks adds the prereq checks of the prereqChecks section of the config file, and the ones in
+// ~/.gokp/checks.d, to the ones that are run before a cluster is created
+func setPreReqChecks() error {
+	cfgs := []prereqs.Check{}
+	err := viper.UnmarshalKey("prereqChecks", &cfgs)
+	if err != nil {
+		return err
+	}
+
+	prereqs.Custom, err = prereqs.Load(cfgs, prereqs.Dir())
+	return err
+}
@@ -0,0 +1,149 @@
+package prereqs
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Check is a prereq check an organization adds on top of the built in ones, like the version of a binary, being on
+// the VPN, or reaching an internal endpoint. It either runs a command (Exec) or makes a GET request (HTTP)
+type Check struct {
+	Name string `mapstructure:"name"`
+
+	// Exec is the command and its arguments. It passes if it exits with 0
+	Exec []string `mapstructure:"exec"`
+
+	// HTTP is the URL to GET. It passes with ExpectStatus, or any 2xx if that's not set
+	HTTP         string `mapstructure:"http"`
+	ExpectStatus int    `mapstructure:"expectStatus"`
+
+	// Match is a regexp the output of the command, or the body of the response, has to match
+	Match string `mapstructure:"match"`
+
+	// Timeout is how long the check can take, 10s by default
+	Timeout string `mapstructure:"timeout"`
+
+	// Optional only warns when the check fails
+	Optional bool `mapstructure:"optional"`
+}
+
+// Custom are the checks that CheckPreReqs runs, and doctor shows, on top of the built in ones
+var Custom []Check
+
+// Dir returns the checks.d dir, where every executable is a check named after the file
+func Dir() string {
+	return os.Getenv("HOME") + "/.gokp/checks.d"
+}
+
+// Load returns the checks of the config file, checked, followed by the ones in dir
+func Load(checks []Check, dir string) ([]Check, error) {
+	for i, c := range checks {
+		if c.Name == "" {
+			return nil, errors.New("prereq check " + strconv.Itoa(i+1) + " has no name")
+		}
+		if (len(c.Exec) == 0) == (c.HTTP == "") {
+			return nil, errors.New("prereq check " + c.Name + " needs either exec or http")
+		}
+		if c.Match != "" {
+			if _, err := regexp.Compile(c.Match); err != nil {
+				return nil, errors.New("invalid match of prereq check " + c.Name + ": " + err.Error())
+			}
+		}
+		if c.Timeout != "" {
+			if _, err := time.ParseDuration(c.Timeout); err != nil {
+				return nil, errors.New("invalid timeout of prereq check " + c.Name + ": " + err.Error())
+			}
+		}
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return checks, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name() < files[j].Name() })
+	for _, f := range files {
+		// Only executables are checks, so a README can sit next to them
+		if f.IsDir() || strings.HasPrefix(f.Name(), ".") || f.Mode().Perm()&0111 == 0 {
+			continue
+		}
+		checks = append(checks, Check{Name: f.Name(), Exec: []string{filepath.Join(dir, f.Name())}})
+	}
+
+	return checks, nil
+}
+
+// Run runs the check with the environment variables given on top of the ones gokp has. It returns the first line
+// of what it printed, or the status of the response
+func (c Check) Run(env map[string]string) (string, error) {
+	timeout := 10 * time.Second
+	if c.Timeout != "" {
+		timeout, _ = time.ParseDuration(c.Timeout)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var out []byte
+	var details string
+	if len(c.Exec) > 0 {
+		cmd := exec.CommandContext(ctx, c.Exec[0], c.Exec[1:]...)
+		cmd.Env = os.Environ()
+		for k, v := range env {
+			cmd.Env = append(cmd.Env, k+"="+v)
+		}
+		var err error
+		out, err = cmd.CombinedOutput()
+		details = firstLine(string(out))
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", errors.New("timed out after " + timeout.String())
+		}
+		if err != nil {
+			return "", errors.New(strings.TrimSpace(err.Error() + ": " + details))
+		}
+	} else {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.HTTP, nil)
+		if err != nil {
+			return "", err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		out, err = ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return "", err
+		}
+		details = resp.Status
+		if (c.ExpectStatus != 0 && resp.StatusCode != c.ExpectStatus) || (c.ExpectStatus == 0 && resp.StatusCode/100 != 2) {
+			return "", errors.New(c.HTTP + " returned " + resp.Status)
+		}
+	}
+
+	if c.Match != "" && !regexp.MustCompile(c.Match).Match(out) {
+		return "", errors.New("the output doesn't match " + c.Match + ": " + details)
+	}
+	return details, nil
+}
+
+// firstLine returns the first line that isn't blank
+func firstLine(s string) string {
+	for _, line := range strings.Split(s, "\n") {
+		if strings.TrimSpace(line) != "" {
+			return strings.TrimSpace(line)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/christianh814/gokp/cmd/certs"
+	"github.com/christianh814/gokp/cmd/state"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// renewCertsCmd represents the renew-certs command
+var renewCertsCmd = &cobra.Command{
+	Use:     "renew-certs",
+	Aliases: []string{"renewCerts"},
+	Short:   "Renews the certificates of a gokp cluster",
+	Long: `Renews the certificates of a gokp cluster, which kubeadm only makes good for
+a year. Every control plane machine is replaced by a new one with new
+certificates, one at a time. The kubeconfig saved under ~/.gokp (and in the
+secret store, if one is set up) is then replaced with the one CAPI renewed.
+For example:
+
+gokp renew-certs --cluster-name=mycluster
+
+If the saved kubeconfig already expired, use --kubeconfig with one that works.`,
+	Annotations: map[string]string{stateLockAnnotation: "true"},
+	Run: func(cmd *cobra.Command, args []string) {
+		// Grab flags
+		clusterName, _ := cmd.Flags().GetString("cluster-name")
+		CapiCfg, _ := cmd.Flags().GetString("kubeconfig")
+
+		// Default to the kubeconfig that was saved at install time
+		var err error
+		if CapiCfg == "" {
+			CapiCfg, err = clusterSecretFile(clusterName, clusterName+".kubeconfig")
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		if expiry, err := certs.Expiry(CapiCfg); err == nil {
+			log.Info("The client certificate of ", CapiCfg, " expires on ", expiry.Format("2006-01-02"))
+		}
+
+		kcps, since, err := certs.Rotate(CapiCfg, clusterName)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = certs.WaitForRotation(CapiCfg, kcps, since)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// Save the kubeconfig CAPI keeps for the cluster in place of the old one
+		kcfg, err := certs.Kubeconfig(CapiCfg, clusterName, kcps[0].GetNamespace())
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = os.MkdirAll(state.ArtifactsDir(clusterName), 0700)
+		if err != nil {
+			log.Fatal(err)
+		}
+		kcfgFile := state.ArtifactsDir(clusterName) + "/" + clusterName + ".kubeconfig"
+		err = ioutil.WriteFile(kcfgFile, []byte(kcfg), 0600)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = saveClusterSecrets(clusterName)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if expiry, err := certs.Expiry(kcfgFile); err == nil {
+			log.Info("The client certificate of ", kcfgFile, " now expires on ", expiry.Format("2006-01-02"))
+		}
+
+		log.Info("Certificates of ", clusterName, " successfully renewed")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(renewCertsCmd)
+
+	renewCertsCmd.Flags().String("cluster-name", "", "Name of the gokp cluster.")
+	renewCertsCmd.Flags().String("kubeconfig", "", "Path to the Kubeconfig file of the gokp cluster (defaults to the one under ~/.gokp).")
+
+	renewCertsCmd.MarkFlagRequired("cluster-name")
+}
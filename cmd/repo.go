@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/christianh814/gokp/cmd/gitutils"
+	"github.com/christianh814/gokp/cmd/inventory"
+	"github.com/christianh814/gokp/cmd/state"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// repoCmd represents the repo command
+var repoCmd = &cobra.Command{
+	Use:   "repo",
+	Short: "Manages the GitOps repo of a cluster",
+	Long: `Manages the GitOps repo of a cluster that was created with gokp.
+For example:
+
+gokp repo sync --cluster-name=mycluster`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(repoCmd)
+}
+
+// openClusterRepo returns the local clone of the GitOps repo of the cluster and the key to push it with.
+// The repo settings that were used at install time are restored from the state file, and the repo is cloned if
+// the cluster was created somewhere else
+func openClusterRepo(clusterName string) (string, string, error) {
+	// Everything for the cluster was saved under ~/.gokp at install time
+	gokpartifacts := state.ArtifactsDir(clusterName)
+	repoDir := gokpartifacts + "/" + clusterName
+
+	// The deploy key may only be in the secret store. Repos pushed to over HTTPS don't have one
+	privateKeyFile := gokpartifacts + "/" + clusterName + "_rsa"
+	if keyFile, err := clusterSecretFile(clusterName, clusterName+"_rsa"); err == nil {
+		privateKeyFile = keyFile
+	}
+
+	// Clusters installed before the state file existed use the defaults
+	st, err := state.Load(gokpartifacts)
+	if err == nil {
+		gitutils.RepoPath = st.RepoPath
+		gitutils.RemoteName = st.RemoteName
+		if st.Branch != "" {
+			gitutils.Branch = st.Branch
+		}
+	} else if !os.IsNotExist(err) {
+		return "", "", err
+	}
+
+	if _, err := os.Stat(repoDir); os.IsNotExist(err) {
+		if st == nil || st.GitOpsRepo == "" {
+			return "", "", errors.New("Unable to find the GitOps repo of " + clusterName + " under " + repoDir)
+		}
+		// The state came from the shared state, so the repo is cloned from where it says
+		log.Info("Cloning the GitOps repo of ", clusterName, " from ", st.GitOpsRepo)
+		err = gitutils.CloneRepo(st.GitOpsRepo, repoDir, privateKeyFile)
+		if err != nil {
+			os.RemoveAll(repoDir)
+			return "", "", errors.New("unable to clone the GitOps repo of " + clusterName + ": " + err.Error())
+		}
+	}
+
+	return repoDir, privateKeyFile, nil
+}
+
+// addRepoAuthFlags adds the flags needed to push to remotes that use HTTPS
+func addRepoAuthFlags(c *cobra.Command) {
+	c.Flags().String("git-token", "", "Token (or password) used for remotes that are pushed to over HTTPS.")
+	c.Flags().String("git-username", "git", "Username that goes with --git-token.")
+}
+
+// setRepoCredentials sets the credentials from the flags for every HTTPS remote of the repo. Everything else uses the stored key
+func setRepoCredentials(cmd *cobra.Command, repoDir string) error {
+	err := loadSecretFlags(cmd)
+	if err != nil {
+		return err
+	}
+	gitToken, _ := cmd.Flags().GetString("git-token")
+	gitUsername, _ := cmd.Flags().GetString("git-username")
+	if gitToken == "" {
+		return nil
+	}
+
+	remotes, err := gitutils.RemoteURLs(repoDir)
+	if err != nil {
+		return err
+	}
+	for _, remote := range remotes {
+		if strings.HasPrefix(remote, "https://") || strings.HasPrefix(remote, "http://") {
+			gitutils.SetHTTPCredentials(remote, gitUsername, gitToken)
+		}
+	}
+
+	return nil
+}
+
+// commitAndPush writes the inventory of the cluster to the repo and commits and pushes it along with everything
+// else that changed
+func commitAndPush(repoDir string, privateKeyFile string, clusterName string, msg string) (bool, error) {
+	err := inventory.Write(gitutils.BaseDir(repoDir), clusterName)
+	if err != nil {
+		return false, errors.New("unable to write the inventory of " + clusterName + ": " + err.Error())
+	}
+	return gitutils.CommitAndPush(repoDir, privateKeyFile, msg)
+}
@@ -0,0 +1,24 @@
+package cmd
+
+import (
+	"github.com/christianh814/gokp/cmd/argo"
+	"github.com/christianh814/gokp/cmd/flux"
+	"github.com/christianh814/gokp/cmd/gitutils"
+	"github.com/christianh814/gokp/cmd/templates"
+	log "github.com/sirupsen/logrus"
+)
+
+// setupRepoCredentials puts the credentials of a GitOps repo that's talked to over HTTPS on the cluster, for the
+// GitOps controller to read it with. They never go into the repo, the ssh key of the other repos does
+func setupRepoCredentials(gitOpsController string, gitopsrepo string, kubeconfig string) error {
+	username, password, isHttps := gitutils.GetHTTPCredentials(gitopsrepo)
+	if !isHttps {
+		return nil
+	}
+
+	log.Info("Creating the credentials of the GitOps repo")
+	if gitOpsController == "fluxcd" {
+		return flux.CreateGitSecret(kubeconfig, username, password)
+	}
+	return argo.CreateRepoSecret(kubeconfig, templates.ArgoCDNamespace, gitopsrepo, username, password)
+}
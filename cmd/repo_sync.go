@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"github.com/christianh814/gokp/cmd/gitutils"
+	"github.com/christianh814/gokp/cmd/utils"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// repoSyncCmd represents the repo sync command
+var repoSyncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Pushes local changes of the GitOps repo",
+	Long: `Validates, commits, and pushes the changes made to the local clone
+of the GitOps repo under ~/.gokp/<cluster>/<cluster> using the key that was
+stored at install time. For example:
+
+gokp repo sync --cluster-name=mycluster --message="scale up workers"
+
+Remotes that are pushed to over HTTPS need the --git-token flag.`,
+	Annotations: map[string]string{stateLockAnnotation: "true"},
+	Run: func(cmd *cobra.Command, args []string) {
+		// Grab flags
+		clusterName, _ := cmd.Flags().GetString("cluster-name")
+		msg, _ := cmd.Flags().GetString("message")
+		skipValidation, _ := cmd.Flags().GetBool("skip-validation")
+
+		// Find the local clone of the repo
+		repoDir, privateKeyFile, err := openClusterRepo(clusterName)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// See if there's anything to sync
+		changed, err := gitutils.HasChanges(repoDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !changed {
+			log.Info("No local changes to sync for ", clusterName)
+			return
+		}
+
+		// Make sure what we push still builds
+		if !skipValidation {
+			log.Info("Validating local changes")
+			err = utils.ValidateKustomizations(gitutils.BaseDir(repoDir) + "/cluster")
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		// HTTPS remotes use the token, everything else uses the stored key
+		err = setRepoCredentials(cmd, repoDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// Commit and push
+		_, err = commitAndPush(repoDir, privateKeyFile, clusterName, msg)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		log.Info("Successfully synced local changes for ", clusterName)
+	},
+}
+
+func init() {
+	repoCmd.AddCommand(repoSyncCmd)
+
+	repoSyncCmd.Flags().String("cluster-name", "", "Name of the gokp cluster.")
+	repoSyncCmd.Flags().String("message", "syncing local changes", "The commit message to use.")
+	repoSyncCmd.Flags().Bool("skip-validation", false, "Don't run kustomize on the repo before pushing.")
+	addRepoAuthFlags(repoSyncCmd)
+
+	repoSyncCmd.MarkFlagRequired("cluster-name")
+}
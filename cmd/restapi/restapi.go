@@ -0,0 +1,68 @@
+package restapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// Auth adds the credentials of the API to a request
+type Auth func(req *http.Request)
+
+// TokenAuth sends the token in the Authorization header, after the scheme (like "token" for Gitea)
+func TokenAuth(scheme string, token string) Auth {
+	return func(req *http.Request) {
+		req.Header.Set("Authorization", scheme+" "+token)
+	}
+}
+
+// BasicAuth sends the username and password with HTTP basic auth
+func BasicAuth(username string, password string) Auth {
+	return func(req *http.Request) {
+		req.SetBasicAuth(username, password)
+	}
+}
+
+// Do sends the body (if not nil) as JSON to the API named name, and decodes the response into out (if not nil).
+// Anything other than a 2xx is an error, with what the API said
+func Do(name string, method string, url string, auth Auth, body interface{}, out interface{}) error {
+	var b []byte
+	if body != nil {
+		var err error
+		b, err = json.Marshal(body)
+		if err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	auth(req)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	// Anything other than a 2xx is an error
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s api returned %d: %s", name, resp.StatusCode, string(respBody))
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(respBody, out)
+}
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/christianh814/gokp/cmd/hibernate"
+	"github.com/christianh814/gokp/cmd/state"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// resumeCmd represents the resume command
+var resumeCmd = &cobra.Command{
+	Use:   "resume",
+	Short: "Brings back a hibernated cluster",
+	Long: `Starts the control plane instances "gokp hibernate" stopped (if any) and
+scales every MachineDeployment back to the number of replicas it had by
+committing the change to the GitOps repo and making it on the cluster.
+For example:
+
+gokp resume --cluster-name=mycluster`,
+	Annotations: map[string]string{stateLockAnnotation: "true"},
+	Run: func(cmd *cobra.Command, args []string) {
+		// Grab flags
+		clusterName, _ := cmd.Flags().GetString("cluster-name")
+		CapiCfg, _ := cmd.Flags().GetString("kubeconfig")
+
+		st, err := state.Load(state.ArtifactsDir(clusterName))
+		if err != nil && !os.IsNotExist(err) {
+			log.Fatal(err)
+		}
+
+		// Default to the kubeconfig that was saved at install time
+		if CapiCfg == "" {
+			CapiCfg, err = clusterSecretFile(clusterName, clusterName+".kubeconfig")
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		// The control plane has to be up to scale anything
+		if st != nil && len(st.StoppedInstances) > 0 {
+			err = loadSecretFlags(cmd)
+			if err != nil {
+				log.Fatal(err)
+			}
+			awsAccessKey, _ := cmd.Flags().GetString("aws-access-key")
+			awsSecretKey, _ := cmd.Flags().GetString("aws-secret-key")
+			err = hibernate.StartAWSInstances(st.StoppedInstances, st.Region, awsAccessKey, awsSecretKey)
+			if err != nil {
+				log.Fatal(err)
+			}
+			st.StoppedInstances = nil
+			err = state.Save(state.ArtifactsDir(clusterName), st)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			log.Info("Waiting for the API server of ", clusterName)
+			err = hibernate.WaitForAPIServer(CapiCfg)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		_, err = scaleMachineDeployments(cmd, clusterName, CapiCfg, "resuming "+clusterName, hibernate.Resume)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if st != nil {
+			st.Hibernated = false
+			err = state.Save(state.ArtifactsDir(clusterName), st)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		log.Info("Cluster ", clusterName, " is resuming")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(resumeCmd)
+
+	resumeCmd.Flags().String("cluster-name", "", "Name of the gokp cluster.")
+	resumeCmd.Flags().String("kubeconfig", "", "Path to the Kubeconfig file of the gokp cluster (defaults to the one under ~/.gokp).")
+	resumeCmd.Flags().String("aws-access-key", "", "Your AWS Access Key, for starting stopped control plane instances (defaults to the AWS credential chain).")
+	resumeCmd.Flags().String("aws-secret-key", "", "Your AWS Secret Key, for starting stopped control plane instances (defaults to the AWS credential chain).")
+	addRepoAuthFlags(resumeCmd)
+
+	resumeCmd.MarkFlagRequired("cluster-name")
+}
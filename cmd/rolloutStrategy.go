@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"github.com/christianh814/gokp/cmd/capi"
+	"github.com/spf13/cobra"
+)
+
+// addRolloutStrategyFlags adds the flags for how the workers are replaced
+func addRolloutStrategyFlags(c *cobra.Command) {
+	c.Flags().String("worker-max-surge", "", "How many workers (or what percentage) can be added over the desired number during a rollout.")
+	c.Flags().String("worker-max-unavailable", "", "How many workers (or what percentage) can be unavailable during a rollout.")
+	c.Flags().String("worker-node-drain-timeout", "", "How long a worker is drained for before its machine is deleted anyway (e.g. 10m). Drains forever by default.")
+}
+
+// rolloutStrategyConfig returns the rollout strategy of the workers from the flags, or nil if the CAPI defaults are used
+func rolloutStrategyConfig(cmd *cobra.Command) (*capi.RolloutStrategyConfig, error) {
+	s := &capi.RolloutStrategyConfig{}
+	s.MaxSurge, _ = cmd.Flags().GetString("worker-max-surge")
+	s.MaxUnavailable, _ = cmd.Flags().GetString("worker-max-unavailable")
+	s.NodeDrainTimeout, _ = cmd.Flags().GetString("worker-node-drain-timeout")
+
+	if s.MaxSurge == "" && s.MaxUnavailable == "" && s.NodeDrainTimeout == "" {
+		return nil, nil
+	}
+
+	err := capi.ValidateRolloutStrategy(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
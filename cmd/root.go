@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/christianh814/gokp/cmd/logging"
+	"github.com/christianh814/gokp/cmd/state"
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 
 	"github.com/spf13/viper"
@@ -25,6 +28,27 @@ meant to be a GitOps native Kubernetes cluster ready to use.
 At day 0, GOKP is meant to be GitOps enabled at install.
 This utility is a "Proof of Concept" build and shoud not
 be used at all.`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		// Clusters are looked for in the shared state too, so one created by someone else can be given
+		err := checkClusterName(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// Tag what's logged with the cluster the command works on
+		if flag := cmd.Flags().Lookup("cluster-name"); flag != nil {
+			logging.SetCluster(flag.Value.String())
+		}
+
+		// Nobody else can change the cluster until the command is done
+		err = lockClusterState(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+	PersistentPostRun: func(cmd *cobra.Command, args []string) {
+		unlockClusterState()
+	},
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	// Run: func(cmd *cobra.Command, args []string) { },
@@ -33,12 +57,16 @@ be used at all.`,
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
+	registerClusterNameCompletion(rootCmd)
 	cobra.CheckErr(rootCmd.Execute())
 }
 
 func init() {
 	cobra.OnInitialize(initConfig)
 
+	// Lines of operations running in parallel are told apart by the cluster and phase they're tagged with
+	logging.Setup()
+
 	// Here you will define your flags and configuration settings.
 	// Cobra supports persistent flags, which, if defined here,
 	// will be global for your application.
@@ -73,4 +101,24 @@ func initConfig() {
 	if err := viper.ReadInConfig(); err == nil {
 		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
 	}
+
+	// Have what GOKP writes follow the naming conventions of the organization
+	cobra.CheckErr(setTemplateFunctions())
+
+	// Give slow infrastructure more time to come up
+	cobra.CheckErr(setTimeouts())
+
+	// Ask before changing the clusters that have to be protected from accidents
+	cobra.CheckErr(setGuardrails())
+
+	// Run the prereq checks the organization added
+	cobra.CheckErr(setPreReqChecks())
+
+	// Share the state of the clusters if a backend was set up for it
+	cobra.CheckErr(setStateBackend())
+	if state.Shared != nil && state.ReadOnly {
+		fmt.Fprintln(os.Stderr, "Using the shared state in", state.Shared.String(), "(read only)")
+	} else if state.Shared != nil {
+		fmt.Fprintln(os.Stderr, "Using the shared state in", state.Shared.String())
+	}
 }
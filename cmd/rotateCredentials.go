@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"errors"
+	"os"
+
+	"github.com/christianh814/gokp/cmd/capi"
+	"github.com/christianh814/gokp/cmd/export"
+	"github.com/christianh814/gokp/cmd/gitutils"
+	"github.com/christianh814/gokp/cmd/state"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	creds "sigs.k8s.io/cluster-api-provider-aws/cmd/clusterawsadm/credentials"
+)
+
+// rotateCredentialsCmd represents the rotate-credentials command
+var rotateCredentialsCmd = &cobra.Command{
+	Use:     "rotate-credentials",
+	Aliases: []string{"rotateCredentials"},
+	Short:   "Replaces the AWS credentials of a gokp cluster",
+	Long: `Replaces the AWS credentials that CAPA uses on a gokp cluster that manages
+itself, so leaked keys can be replaced without rebuilding the cluster. The new
+keys are checked with AWS first, then written to the CAPA secret and CAPA is
+restarted to pick them up. If the secret was exported into the GitOps repo,
+it's updated there too so the GitOps controller doesn't put the old keys back.
+For example:
+
+gokp rotate-credentials --cluster-name=mycluster \
+--aws-access-key=awsaccesskeyid \
+--aws-secret-key=awssecretkey
+
+If a secret store is set up, the new keys are saved in it. Deactivate the old
+keys in AWS once this is done.`,
+	Annotations: map[string]string{stateLockAnnotation: "true"},
+	Run: func(cmd *cobra.Command, args []string) {
+		// Grab flags
+		clusterName, _ := cmd.Flags().GetString("cluster-name")
+		CapiCfg, _ := cmd.Flags().GetString("kubeconfig")
+
+		st, err := state.Load(state.ArtifactsDir(clusterName))
+		if err != nil && !os.IsNotExist(err) {
+			log.Fatal(err)
+		}
+		if st != nil && st.Provider != "aws" {
+			log.Fatal(errors.New("only the credentials of AWS clusters can be rotated, " + clusterName + " is on " + st.Provider))
+		}
+
+		// The keys aren't looked up in the secret store, those are the ones being replaced
+		awsAccessKey, _ := cmd.Flags().GetString("aws-access-key")
+		awsSecretKey, _ := cmd.Flags().GetString("aws-secret-key")
+		awsSessionToken, _ := cmd.Flags().GetString("aws-session-token")
+
+		// Default to the region the cluster was installed in
+		awsRegion, _ := cmd.Flags().GetString("aws-region")
+		if awsRegion == "" && st != nil {
+			awsRegion = st.Region
+		}
+		if awsRegion == "" {
+			log.Fatal(errors.New("unable to find the region of " + clusterName + ", set it with --aws-region"))
+		}
+
+		// Default to the kubeconfig that was saved at install time
+		if CapiCfg == "" {
+			CapiCfg, err = clusterSecretFile(clusterName, clusterName+".kubeconfig")
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		awscreds := creds.AWSCredentials{
+			AccessKeyID:     awsAccessKey,
+			SecretAccessKey: awsSecretKey,
+			SessionToken:    awsSessionToken,
+			Region:          awsRegion,
+		}
+
+		// Don't hand CAPA keys that don't work
+		arn, err := capi.ValidateAWSCredentials(awscreds)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Info("The new credentials belong to ", arn)
+
+		profile, err := capi.RotateAWSCredentials(CapiCfg, awscreds)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// Update the secret in the repo if it was exported there
+		repoDir, privateKeyFile, err := openClusterRepo(clusterName)
+		if err != nil {
+			log.Warn("Unable to update the GitOps repo: ", err)
+		} else if baseDir := gitutils.BaseDir(repoDir); export.IsExported(baseDir, capi.AWSCredentialsNamespace, "Secret", capi.AWSCredentialsSecret) {
+			secret, err := export.ReadExported(baseDir, capi.AWSCredentialsNamespace, "Secret", capi.AWSCredentialsSecret)
+			if err != nil {
+				log.Fatal(err)
+			}
+			err = setRepoCredentials(cmd, repoDir)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			log.Info("Updating the secret in the GitOps repo")
+			err = unstructured.SetNestedField(secret.Object, base64.StdEncoding.EncodeToString(profile), "data", "credentials")
+			if err == nil {
+				err = export.WriteExported(baseDir, secret)
+			}
+			if err != nil {
+				log.Fatal(err)
+			}
+			_, err = commitAndPush(repoDir, privateKeyFile, clusterName, "rotating the AWS credentials of "+clusterName)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		// Keep the secret store in step, so the old keys aren't used again
+		if viper.IsSet("secretStore") {
+			store, err := secretStore()
+			if err != nil {
+				log.Fatal(err)
+			}
+			err = store.Set("aws-access-key", awsAccessKey)
+			if err == nil {
+				err = store.Set("aws-secret-key", awsSecretKey)
+			}
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		log.Info("Credentials of ", clusterName, " successfully rotated, the old keys can be deactivated")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(rotateCredentialsCmd)
+
+	rotateCredentialsCmd.Flags().String("cluster-name", "", "Name of the gokp cluster.")
+	rotateCredentialsCmd.Flags().String("kubeconfig", "", "Path to the Kubeconfig file of the gokp cluster (defaults to the one under ~/.gokp).")
+	rotateCredentialsCmd.Flags().String("aws-access-key", "", "The new AWS Access Key.")
+	rotateCredentialsCmd.Flags().String("aws-secret-key", "", "The new AWS Secret Key.")
+	rotateCredentialsCmd.Flags().String("aws-session-token", "", "The AWS Session Token, if the new keys are temporary.")
+	rotateCredentialsCmd.Flags().String("aws-region", "", "Region of the cluster (defaults to the one it was installed in).")
+	addRepoAuthFlags(rotateCredentialsCmd)
+
+	rotateCredentialsCmd.MarkFlagRequired("cluster-name")
+	rotateCredentialsCmd.MarkFlagRequired("aws-access-key")
+	rotateCredentialsCmd.MarkFlagRequired("aws-secret-key")
+}
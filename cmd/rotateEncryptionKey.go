@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/christianh814/gokp/cmd/certs"
+	"github.com/christianh814/gokp/cmd/encryption"
+	"github.com/christianh814/gokp/cmd/export"
+	"github.com/christianh814/gokp/cmd/gitutils"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// rotateEncryptionKeyCmd represents the rotate-encryption-key command
+var rotateEncryptionKeyCmd = &cobra.Command{
+	Use:     "rotate-encryption-key",
+	Aliases: []string{"rotateEncryptionKey"},
+	Short:   "Replaces the key secrets are encrypted at rest with",
+	Long: `Replaces the key the secrets of a gokp cluster are encrypted at rest with,
+for clusters created with --encrypt-secrets. A new key is generated and the
+control plane is rolled out three times, the way Kubernetes needs keys to be
+rotated:
+
+  1. The new key is added, so every API server can read secrets written with it
+  2. The new key is used to write secrets, and every secret is written again
+     so it's encrypted with it (how far along it is is logged as it goes)
+  3. The old key is removed
+
+The encryption configuration is kept in a Secret next to the cluster and the
+KubeadmControlPlane in the GitOps repo points at it, so each step is
+committed to the repo and the keys themselves never are. For example:
+
+gokp rotate-encryption-key --cluster-name=mycluster`,
+	Annotations: map[string]string{stateLockAnnotation: "true"},
+	Run: func(cmd *cobra.Command, args []string) {
+		// Grab flags
+		clusterName, _ := cmd.Flags().GetString("cluster-name")
+		CapiCfg, _ := cmd.Flags().GetString("kubeconfig")
+
+		// Default to the kubeconfig that was saved at install time
+		var err error
+		if CapiCfg == "" {
+			CapiCfg, err = clusterSecretFile(clusterName, clusterName+".kubeconfig")
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		// Find the local clone of the repo
+		repoDir, privateKeyFile, err := openClusterRepo(clusterName)
+		if err != nil {
+			log.Fatal(err)
+		}
+		baseDir := gitutils.BaseDir(repoDir)
+
+		// HTTPS remotes use the token, everything else uses the stored key
+		err = setRepoCredentials(cmd, repoDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// Find the keys the cluster is using now
+		current, namespace := "", "default"
+		_, err = export.UpdateExported(baseDir, "KubeadmControlPlane", func(obj *unstructured.Unstructured) (bool, error) {
+			current = encryption.SecretName(obj)
+			if obj.GetNamespace() != "" {
+				namespace = obj.GetNamespace()
+			}
+			return false, nil
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		if current == "" {
+			log.Fatal(errors.New("secrets of " + clusterName + " aren't encrypted at rest, that's turned on with --encrypt-secrets when the cluster is created"))
+		}
+		oldKeys, err := encryption.ReadKeys(CapiCfg, namespace, current)
+		if err != nil {
+			log.Fatal(err)
+		}
+		newKey, err := encryption.NewKey()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// 1. Every API server has to be able to read with the new key before any of them writes with it
+		log.Info("Adding the new encryption key ", newKey.Name)
+		_, err = rollOutEncryptionKeys(clusterName, namespace, CapiCfg, repoDir, privateKeyFile, append(oldKeys, newKey), "adding encryption key "+newKey.Name)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// 2. Write with the new key, and write every secret again so it's encrypted with it
+		log.Info("Encrypting secrets with the new encryption key ", newKey.Name)
+		_, err = rollOutEncryptionKeys(clusterName, namespace, CapiCfg, repoDir, privateKeyFile, append([]encryption.Key{newKey}, oldKeys...), "encrypting with key "+newKey.Name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = encryption.Reencrypt(CapiCfg, func(done int, total int) {
+			if done == total || done%50 == 0 {
+				log.Info("Re-encrypted ", done, " of ", total, " secrets (", strconv.Itoa(done*100/total), "%)")
+			}
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// 3. Nothing needs the old keys anymore
+		log.Info("Removing the old encryption keys")
+		final, err := rollOutEncryptionKeys(clusterName, namespace, CapiCfg, repoDir, privateKeyFile, []encryption.Key{newKey}, "removing old encryption keys")
+		if err != nil {
+			log.Fatal(err)
+		}
+		_, err = encryption.DeleteSecretsExcept(CapiCfg, clusterName, namespace, final)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		log.Info("Encryption key of ", clusterName, " successfully rotated to ", newKey.Name)
+	},
+}
+
+// rollOutEncryptionKeys creates a Secret with the encryption configuration for the keys, points the
+// KubeadmControlPlane at it in the repo and on the cluster, and waits for the control plane to roll out with it.
+// It returns the name of the Secret
+func rollOutEncryptionKeys(clusterName string, namespace string, kubeconfig string, repoDir string, privateKeyFile string, keys []encryption.Key, msg string) (string, error) {
+	secret, err := encryption.NewSecret(clusterName, namespace, keys)
+	if err != nil {
+		return "", err
+	}
+	err = encryption.CreateSecret(kubeconfig, secret)
+	if err != nil {
+		return "", err
+	}
+
+	kcps, err := export.UpdateExported(gitutils.BaseDir(repoDir), "KubeadmControlPlane", func(obj *unstructured.Unstructured) (bool, error) {
+		return true, encryption.SetSecret(obj, secret.Name)
+	})
+	if err != nil {
+		return "", err
+	}
+	_, err = commitAndPush(repoDir, privateKeyFile, clusterName, msg+" of "+clusterName)
+	if err != nil {
+		return "", err
+	}
+
+	// Machines created after this have the new configuration
+	since := time.Now().Truncate(time.Second)
+	err = encryption.PatchCluster(kubeconfig, kcps)
+	if err != nil {
+		return "", err
+	}
+	err = certs.WaitForRotation(kubeconfig, kcps, since)
+	if err != nil {
+		return "", err
+	}
+
+	return secret.Name, nil
+}
+
+func init() {
+	rootCmd.AddCommand(rotateEncryptionKeyCmd)
+
+	rotateEncryptionKeyCmd.Flags().String("cluster-name", "", "Name of the gokp cluster.")
+	rotateEncryptionKeyCmd.Flags().String("kubeconfig", "", "Path to the Kubeconfig file of the gokp cluster (defaults to the one under ~/.gokp).")
+	addRepoAuthFlags(rotateEncryptionKeyCmd)
+
+	rotateEncryptionKeyCmd.MarkFlagRequired("cluster-name")
+}
@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+
+	"github.com/christianh814/gokp/cmd/gitutils"
+	"github.com/christianh814/gokp/cmd/nodeimage"
+	"github.com/christianh814/gokp/cmd/state"
+	"github.com/christianh814/gokp/cmd/upgrade"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// rotateNodesCmd represents the rotate-nodes command
+var rotateNodesCmd = &cobra.Command{
+	Use:     "rotate-nodes",
+	Aliases: []string{"rotateNodes"},
+	Short:   "Replaces the nodes of a gokp cluster with ones on the latest AMI",
+	Long: `Replaces the nodes of a gokp cluster on AWS with ones that run the latest
+AMI CAPA published for its Kubernetes version, for the monthly patching. Machine
+templates can't be changed, so copies with the new AMI are committed to the
+GitOps repo and the control plane and workers are pointed at them. The
+machines are then replaced one by one, control plane first. The old machine
+templates are removed from the repo once that's done. For example:
+
+gokp rotate-nodes --cluster-name=mycluster
+gokp rotate-nodes --cluster-name=mycluster --ami=ami-0123456789abcdef0`,
+	Annotations: map[string]string{stateLockAnnotation: "true"},
+	Run: func(cmd *cobra.Command, args []string) {
+		// Grab flags
+		clusterName, _ := cmd.Flags().GetString("cluster-name")
+		CapiCfg, _ := cmd.Flags().GetString("kubeconfig")
+		ami, _ := cmd.Flags().GetString("ami")
+		baseOS, _ := cmd.Flags().GetString("base-os")
+
+		st, err := state.Load(state.ArtifactsDir(clusterName))
+		if err != nil && !os.IsNotExist(err) {
+			log.Fatal(err)
+		}
+		if st != nil && st.Provider != "aws" {
+			log.Fatal(errors.New("only the nodes of AWS clusters can be rotated, " + clusterName + " is on " + st.Provider))
+		}
+
+		// Default to the kubeconfig that was saved at install time
+		if CapiCfg == "" {
+			CapiCfg, err = clusterSecretFile(clusterName, clusterName+".kubeconfig")
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		// Find the local clone of the repo
+		repoDir, privateKeyFile, err := openClusterRepo(clusterName)
+		if err != nil {
+			log.Fatal(err)
+		}
+		baseDir := gitutils.BaseDir(repoDir)
+
+		// Look up the latest AMI for the version the cluster runs
+		if ami == "" {
+			awsRegion, _ := cmd.Flags().GetString("aws-region")
+			if awsRegion == "" && st != nil {
+				awsRegion = st.Region
+			}
+			if awsRegion == "" {
+				log.Fatal(errors.New("unable to find the region of " + clusterName + ", set it with --aws-region"))
+			}
+			err = loadSecretFlags(cmd)
+			if err != nil {
+				log.Fatal(err)
+			}
+			awsAccessKey, _ := cmd.Flags().GetString("aws-access-key")
+			awsSecretKey, _ := cmd.Flags().GetString("aws-secret-key")
+
+			kubernetesVersion, err := nodeimage.KubernetesVersion(baseDir)
+			if err != nil {
+				log.Fatal(err)
+			}
+			ami, err = nodeimage.LatestAMI(awsRegion, awsAccessKey, awsSecretKey, kubernetesVersion, baseOS)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		rotation, err := nodeimage.SetAMI(baseDir, ami)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(rotation.Owners) == 0 {
+			log.Info("The nodes of ", clusterName, " already run ", ami)
+			return
+		}
+
+		// HTTPS remotes use the token, everything else uses the stored key
+		err = setRepoCredentials(cmd, repoDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		_, err = commitAndPush(repoDir, privateKeyFile, clusterName, "rotating the nodes of "+clusterName+" to "+ami)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// Don't wait on the GitOps controller to start the replacement
+		err = nodeimage.PatchCluster(CapiCfg, rotation)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = upgrade.WaitForRollout(CapiCfg, rotation.Owners)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// Nothing uses the old templates anymore
+		err = nodeimage.RemoveOld(baseDir, rotation)
+		if err != nil {
+			log.Fatal(err)
+		}
+		_, err = commitAndPush(repoDir, privateKeyFile, clusterName, "removing the machine templates "+clusterName+" no longer uses")
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		log.Info("Nodes of ", clusterName, " successfully rotated to ", ami)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(rotateNodesCmd)
+
+	rotateNodesCmd.Flags().String("cluster-name", "", "Name of the gokp cluster.")
+	rotateNodesCmd.Flags().String("kubeconfig", "", "Path to the Kubeconfig file of the gokp cluster (defaults to the one under ~/.gokp).")
+	rotateNodesCmd.Flags().String("ami", "", "The AMI to rotate to (defaults to the latest one for the Kubernetes version of the cluster).")
+	rotateNodesCmd.Flags().String("base-os", "ubuntu-20.04", "The OS of the AMI to look up.")
+	rotateNodesCmd.Flags().String("aws-region", "", "Region of the cluster (defaults to the one it was installed in).")
+	rotateNodesCmd.Flags().String("aws-access-key", "", "Your AWS Access Key, to look up the AMI (defaults to the AWS credential chain).")
+	rotateNodesCmd.Flags().String("aws-secret-key", "", "Your AWS Secret Key, to look up the AMI (defaults to the AWS credential chain).")
+	addRepoAuthFlags(rotateNodesCmd)
+
+	rotateNodesCmd.MarkFlagRequired("cluster-name")
+}
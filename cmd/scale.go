@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"strconv"
+
+	"github.com/christianh814/gokp/cmd/hibernate"
+	"github.com/christianh814/gokp/cmd/state"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// scaleCmd represents the scale command
+var scaleCmd = &cobra.Command{
+	Use:   "scale",
+	Short: "Sets the number of workers of a cluster",
+	Long: `Sets the number of replicas of a MachineDeployment of the cluster by
+committing the change to the exported YAML in the GitOps repo. The change is
+also made on the cluster directly, so it takes effect right away. If the
+cluster has more than one MachineDeployment, the one to scale has to be given.
+For example:
+
+gokp scale --cluster-name=mycluster --workers=5
+gokp scale --cluster-name=mycluster --workers=2 --machine-deployment=mycluster-md-1`,
+	Annotations: map[string]string{stateLockAnnotation: "true"},
+	Run: func(cmd *cobra.Command, args []string) {
+		// Grab flags
+		clusterName, _ := cmd.Flags().GetString("cluster-name")
+		CapiCfg, _ := cmd.Flags().GetString("kubeconfig")
+		workers, _ := cmd.Flags().GetInt64("workers")
+		mdName, _ := cmd.Flags().GetString("machine-deployment")
+		wait, _ := cmd.Flags().GetBool("wait")
+
+		// Resume would undo the change
+		st, err := state.Load(state.ArtifactsDir(clusterName))
+		if err != nil && !os.IsNotExist(err) {
+			log.Fatal(err)
+		}
+		if st != nil && st.Hibernated {
+			log.Fatal(errors.New("cluster " + clusterName + " is hibernated, use \"gokp resume\" first"))
+		}
+
+		// Default to the kubeconfig that was saved at install time
+		if CapiCfg == "" {
+			CapiCfg, err = clusterSecretFile(clusterName, clusterName+".kubeconfig")
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		scale := func(baseDir string) ([]hibernate.MachineDeployment, error) {
+			return hibernate.Scale(baseDir, mdName, workers)
+		}
+		mds, err := scaleMachineDeployments(cmd, clusterName, CapiCfg, "scaling "+clusterName+" to "+strconv.FormatInt(workers, 10)+" workers", scale)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if wait && len(mds) > 0 {
+			log.Info("Waiting for the workers to scale")
+			err = hibernate.WaitForScale(CapiCfg, mds)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		log.Info("Cluster ", clusterName, " is scaled to ", workers, " workers")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(scaleCmd)
+
+	scaleCmd.Flags().String("cluster-name", "", "Name of the gokp cluster.")
+	scaleCmd.Flags().String("kubeconfig", "", "Path to the Kubeconfig file of the gokp cluster (defaults to the one under ~/.gokp).")
+	scaleCmd.Flags().Int64("workers", 0, "The number of workers to scale to.")
+	scaleCmd.Flags().String("machine-deployment", "", "The MachineDeployment to scale, if the cluster has more than one.")
+	scaleCmd.Flags().Bool("wait", false, "Wait for the workers to be added or removed.")
+	addRepoAuthFlags(scaleCmd)
+
+	scaleCmd.MarkFlagRequired("cluster-name")
+	scaleCmd.MarkFlagRequired("workers")
+}
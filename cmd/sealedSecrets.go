@@ -0,0 +1,24 @@
+package cmd
+
+import (
+	"github.com/christianh814/gokp/cmd/sealedsecrets"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// setupSealedSecrets creates the sealing key of Sealed Secrets on the cluster of the kubeconfig if it's enabled,
+// before the GitOps controller deploys it. The certificate secrets are sealed with, and the key to restore it with,
+// are kept under WorkDir, which becomes the artifact dir of the cluster
+func setupSealedSecrets(cmd *cobra.Command, clusterName string, kubeconfig string) error {
+	if version, _ := cmd.Flags().GetString("enable-sealed-secrets"); version == "" {
+		return nil
+	}
+
+	log.Info("Creating the sealing key of Sealed Secrets")
+	err := sealedsecrets.CreateKey(kubeconfig, WorkDir)
+	if err != nil {
+		return err
+	}
+	log.Info("Seal secrets for ", clusterName, " with: kubeseal --cert ~/.gokp/", clusterName, "/", sealedsecrets.CertFile)
+	return nil
+}
@@ -0,0 +1,127 @@
+package sealedsecrets
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/yaml"
+)
+
+// Namespace is where the controller runs and keeps its sealing keys
+var Namespace string = "kube-system"
+
+// CertFile is the certificate secrets are sealed with (kubeseal --cert), and KeyFile the Secret with the sealing key,
+// to restore it on another cluster. They're kept in the artifact dir of the cluster
+var (
+	CertFile string = "sealed-secrets.pem"
+	KeyFile  string = "sealed-secrets-key.yaml"
+)
+
+// keyLabel is the label the controller finds its sealing keys by
+var keyLabel string = "sealedsecrets.bitnami.com/sealed-secrets-key"
+
+// keyValidity is how long the certificate is good for, like the ones the controller creates
+var keyValidity time.Duration = 10 * 365 * 24 * time.Hour
+
+// CreateKey creates the sealing key on the cluster of the kubeconfig, before the controller is deployed so it uses it
+// instead of creating its own, and writes the certificate and the key into dir. A key that's already there is used
+func CreateKey(kubeconfig string, dir string) error {
+	cfg, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return err
+	}
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	keys, err := clientset.CoreV1().Secrets(Namespace).List(context.TODO(), metav1.ListOptions{LabelSelector: keyLabel + "=active"})
+	if err != nil {
+		return err
+	}
+	var secret *corev1.Secret
+	if len(keys.Items) > 0 {
+		secret = &keys.Items[0]
+	} else {
+		cert, key, err := generateKey()
+		if err != nil {
+			return err
+		}
+		secret, err = clientset.CoreV1().Secrets(Namespace).Create(context.TODO(), &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				GenerateName: "sealed-secrets-key",
+				Namespace:    Namespace,
+				Labels:       map[string]string{keyLabel: "active"},
+			},
+			Type: corev1.SecretTypeTLS,
+			Data: map[string][]byte{
+				corev1.TLSCertKey:       cert,
+				corev1.TLSPrivateKeyKey: key,
+			},
+		}, metav1.CreateOptions{})
+		if err != nil {
+			return err
+		}
+	}
+
+	err = ioutil.WriteFile(dir+"/"+CertFile, secret.Data[corev1.TLSCertKey], 0644)
+	if err != nil {
+		return err
+	}
+	b, err := yaml.Marshal(&corev1.Secret{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      secret.Name,
+			Namespace: Namespace,
+			Labels:    map[string]string{keyLabel: "active"},
+		},
+		Type: corev1.SecretTypeTLS,
+		Data: secret.Data,
+	})
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(dir+"/"+KeyFile, b, 0600)
+}
+
+// generateKey returns a new self signed certificate and its RSA key, PEM encoded
+func generateKey() ([]byte, []byte, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 4096)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "sealed-secret", Organization: []string{"sealed-secret"}},
+		NotBefore:             now,
+		NotAfter:              now.Add(keyValidity),
+		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert}),
+		pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}),
+		nil
+}
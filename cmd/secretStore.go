@@ -0,0 +1,190 @@
+package cmd
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/christianh814/gokp/cmd/sealedsecrets"
+	"github.com/christianh814/gokp/cmd/secrets"
+	"github.com/christianh814/gokp/cmd/sops"
+	"github.com/christianh814/gokp/cmd/state"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// secretFlags are the flags that hold credentials. If one isn't given, it's looked up in the secret store under
+// the name of the flag
+var secretFlags = []string{
+	"github-token",
+	"gitea-token",
+	"bitbucket-app-password",
+	"azuredevops-pat",
+	"git-token",
+	"aws-access-key",
+	"aws-secret-key",
+	"azure-app-secret",
+	"oci-fingerprint",
+	"oci-private-key-passphrase",
+	"ibmcloud-api-key",
+	"linode-token",
+	"proxmox-secret",
+	"argocd-notifications-slack-token",
+	"argocd-notifications-webhook-url",
+	"external-secrets-aws-secret-key",
+	"external-secrets-vault-token",
+}
+
+// secretStore returns the secret store set up in the secretStore section of the config file. It's the file store
+// under ~/.gokp if there's none
+func secretStore() (secrets.SecretStore, error) {
+	cfg := secrets.Config{}
+	err := viper.UnmarshalKey("secretStore", &cfg)
+	if err != nil {
+		return nil, err
+	}
+	return secrets.New(cfg)
+}
+
+// loadSecretFlags fills in the credential flags of the command that weren't given from the secret store
+func loadSecretFlags(cmd *cobra.Command) error {
+	store, err := secretStore()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range secretFlags {
+		flag := cmd.Flags().Lookup(name)
+		if flag == nil || flag.Value.String() != "" {
+			continue
+		}
+
+		value, err := store.Get(name)
+		if errors.Is(err, secrets.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			// Not every credential is needed every time, so this isn't fatal
+			log.Warn("Unable to read ", name, " from the secret store: ", err)
+			continue
+		}
+		err = cmd.Flags().Set(name, strings.TrimSpace(value))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// requireFlags fails if any of the flags are still empty, after they had a chance to come from the secret store
+func requireFlags(cmd *cobra.Command, names ...string) error {
+	missing := []string{}
+	for _, name := range names {
+		v, _ := cmd.Flags().GetString(name)
+		if v == "" {
+			missing = append(missing, `"`+name+`"`)
+		}
+	}
+	if len(missing) > 0 {
+		return errors.New("required flag(s) " + strings.Join(missing, ", ") + " not set (and not found in the secret store)")
+	}
+	return nil
+}
+
+// saveClusterSecrets puts the deploy key and kubeconfig of the cluster in the secret store, if one was set up, and
+// in the shared state, if there's one, so they can be restored on another machine
+func saveClusterSecrets(clusterName string) error {
+	var store secrets.SecretStore
+	if viper.IsSet("secretStore") {
+		var err error
+		store, err = secretStore()
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, name := range clusterSecretNames(clusterName) {
+		b, err := ioutil.ReadFile(state.ArtifactsDir(clusterName) + "/" + name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if store != nil {
+			err = store.Set(clusterName+"/"+name, string(b))
+			if err != nil {
+				return err
+			}
+		}
+		err = state.SaveFile(clusterName, name, b)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// clusterSecretFile returns the path of a secret file of the cluster (like its kubeconfig) under ~/.gokp. If it's not
+// there, it's restored from the shared state or the secret store
+func clusterSecretFile(clusterName string, name string) (string, error) {
+	file := state.ArtifactsDir(clusterName) + "/" + name
+	if _, err := os.Stat(file); err == nil {
+		return file, nil
+	}
+
+	value, from, err := findClusterSecret(clusterName, name)
+	if err != nil {
+		return "", err
+	}
+
+	log.Info("Restoring ", name, " from ", from)
+	err = os.MkdirAll(state.ArtifactsDir(clusterName), 0700)
+	if err != nil {
+		return "", err
+	}
+	err = ioutil.WriteFile(file, value, 0600)
+	if err != nil {
+		return "", err
+	}
+	return file, nil
+}
+
+// findClusterSecret returns a secret file of the cluster from the shared state, or else from the secret store, and
+// where it was found
+func findClusterSecret(clusterName string, name string) ([]byte, string, error) {
+	b, err := state.LoadFile(clusterName, name)
+	if err == nil {
+		return b, state.Shared.String(), nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, "", errors.New("unable to read " + name + " from " + state.Shared.String() + ": " + err.Error())
+	}
+
+	store, err := secretStore()
+	if err != nil {
+		return nil, "", err
+	}
+	value, err := store.Get(clusterName + "/" + name)
+	if errors.Is(err, secrets.ErrNotFound) {
+		return nil, "", errors.New("unable to find " + name + " under " + state.ArtifactsDir(clusterName) + ", in the shared state, or in the secret store")
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return []byte(value), "the secret store", nil
+}
+
+// clusterSecretNames returns the names of the files under ~/.gokp/<cluster> that are secrets
+func clusterSecretNames(clusterName string) []string {
+	return []string{
+		clusterName + "_rsa",
+		clusterName + ".kubeconfig",
+		sealedsecrets.KeyFile,
+		sops.KeyFile,
+	}
+}
@@ -0,0 +1,69 @@
+package secrets
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+)
+
+// AWSStore keeps secrets in AWS Secrets Manager, each named Prefix + key. It uses the default AWS credential chain
+type AWSStore struct {
+	Prefix string
+	client *secretsmanager.SecretsManager
+}
+
+// newAWSStore returns the AWSStore for the config
+func newAWSStore(cfg Config) (*AWSStore, error) {
+	awsCfg := &aws.Config{}
+	if cfg.AWSRegion != "" {
+		awsCfg.Region = aws.String(cfg.AWSRegion)
+	}
+	sess, err := session.NewSession(awsCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := cfg.AWSPrefix
+	if prefix == "" {
+		prefix = "gokp/"
+	}
+	return &AWSStore{Prefix: prefix, client: secretsmanager.New(sess)}, nil
+}
+
+// Get returns the string value of the secret
+func (a *AWSStore) Get(key string) (string, error) {
+	out, err := a.client.GetSecretValue(&secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(a.Prefix + key),
+	})
+	if isAWSNotFound(err) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(out.SecretString), nil
+}
+
+// Set puts a new value in the secret, creating it if it's not there yet
+func (a *AWSStore) Set(key string, value string) error {
+	_, err := a.client.PutSecretValue(&secretsmanager.PutSecretValueInput{
+		SecretId:     aws.String(a.Prefix + key),
+		SecretString: aws.String(value),
+	})
+	if !isAWSNotFound(err) {
+		return err
+	}
+
+	_, err = a.client.CreateSecret(&secretsmanager.CreateSecretInput{
+		Name:         aws.String(a.Prefix + key),
+		SecretString: aws.String(value),
+	})
+	return err
+}
+
+// isAWSNotFound returns true if the error is because the secret doesn't exist
+func isAWSNotFound(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == secretsmanager.ErrCodeResourceNotFoundException
+}
@@ -0,0 +1,36 @@
+package secrets
+
+import (
+	"errors"
+	"os"
+	"strings"
+)
+
+// EnvStore reads secrets from GOKP_ environment variables, so "github-token" is read from GOKP_GITHUB_TOKEN.
+// It's read only
+type EnvStore struct{}
+
+// Get returns the value of the environment variable of the secret
+func (e *EnvStore) Get(key string) (string, error) {
+	v, ok := os.LookupEnv(EnvName(key))
+	if !ok {
+		return "", ErrNotFound
+	}
+	return v, nil
+}
+
+// Set always fails, since there's nowhere to keep the secret
+func (e *EnvStore) Set(key string, value string) error {
+	return errors.New("the env secret store is read only, unable to store " + key)
+}
+
+// EnvName returns the environment variable a secret is read from
+func EnvName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, key)
+	return "GOKP_" + strings.ToUpper(name)
+}
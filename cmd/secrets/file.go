@@ -0,0 +1,34 @@
+package secrets
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// FileStore keeps every secret in its own file under Dir
+type FileStore struct {
+	Dir string
+}
+
+// Get returns the contents of the file of the secret
+func (f *FileStore) Get(key string) (string, error) {
+	b, err := ioutil.ReadFile(filepath.Join(f.Dir, key))
+	if os.IsNotExist(err) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// Set writes the secret to its file, readable only by the user
+func (f *FileStore) Set(key string, value string) error {
+	file := filepath.Join(f.Dir, key)
+	err := os.MkdirAll(filepath.Dir(file), 0700)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, []byte(value), 0600)
+}
@@ -0,0 +1,81 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// KeychainStore keeps secrets in the keychain of the OS, using the "security" command on macOS and "secret-tool"
+// (libsecret) on Linux. Every secret is an item of Service with the key as the account
+type KeychainStore struct {
+	Service string
+}
+
+// keychainEncoding marks a value that was base64 encoded before it went into the macOS keychain. "security" prints a
+// value with a newline in it (like a kubeconfig or a private key) as hex, so they're kept encoded. Values without
+// it were stored as they are
+var keychainEncoding string = "base64:"
+
+// Get returns the secret from the keychain
+func (k *KeychainStore) Get(key string) (string, error) {
+	var c *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		c = exec.Command("security", "find-generic-password", "-s", k.Service, "-a", key, "-w")
+	case "linux":
+		c = exec.Command("secret-tool", "lookup", "service", k.Service, "account", key)
+	default:
+		return "", errors.New("the keychain secret store is not supported on " + runtime.GOOS)
+	}
+
+	// Both tools exit non zero when there's no such item
+	out, err := c.Output()
+	if _, ok := err.(*exec.ExitError); ok {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	value := strings.TrimSuffix(string(out), "\n")
+	if runtime.GOOS == "darwin" && strings.HasPrefix(value, keychainEncoding) {
+		b, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, keychainEncoding))
+		if err != nil {
+			return "", errors.New("unable to decode " + key + " from the keychain: " + err.Error())
+		}
+		return string(b), nil
+	}
+	return value, nil
+}
+
+// Set creates or updates the secret in the keychain
+func (k *KeychainStore) Set(key string, value string) error {
+	var c *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		// The command is given on stdin, so the value isn't in the arguments other users can see with ps
+		c = exec.Command("security", "-i")
+		encoded := keychainEncoding + base64.StdEncoding.EncodeToString([]byte(value))
+		c.Stdin = bytes.NewBufferString("add-generic-password -U -s " + securityQuote(k.Service) + " -a " + securityQuote(key) + " -w " + securityQuote(encoded) + "\n")
+	case "linux":
+		c = exec.Command("secret-tool", "store", "--label="+k.Service+" "+key, "service", k.Service, "account", key)
+		c.Stdin = bytes.NewBufferString(value)
+	default:
+		return errors.New("the keychain secret store is not supported on " + runtime.GOOS)
+	}
+
+	// "security -i" doesn't always exit non zero when the command fails, but it says why
+	out, err := c.CombinedOutput()
+	if err != nil || (runtime.GOOS == "darwin" && strings.TrimSpace(string(out)) != "") {
+		return errors.New("unable to store " + key + " in the keychain: " + strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// securityQuote quotes an argument of a command given to "security -i"
+func securityQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
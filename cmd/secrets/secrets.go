@@ -0,0 +1,66 @@
+package secrets
+
+import (
+	"errors"
+	"os"
+)
+
+// ErrNotFound is returned by a SecretStore that doesn't have the secret asked for
+var ErrNotFound = errors.New("secret not found")
+
+// SecretStore is where GOKP reads and writes credentials (tokens, cloud keys, deploy keys, and kubeconfigs). Keys
+// are paths like "github-token" or "mycluster/mycluster.kubeconfig"
+type SecretStore interface {
+	// Get returns the secret, or ErrNotFound if there's no such secret
+	Get(key string) (string, error)
+	// Set creates or replaces the secret
+	Set(key string, value string) error
+}
+
+// Config is the secretStore section of the GOKP config file
+type Config struct {
+	// Type is one of file, env, vault, aws-secrets-manager, or keychain
+	Type string `mapstructure:"type"`
+
+	// Dir is where the file store keeps secrets (defaults to ~/.gokp)
+	Dir string `mapstructure:"dir"`
+
+	// Address and Mount of the Vault KV v2 engine, and the Path under it that GOKP keeps secrets in. The token
+	// is taken from VAULT_TOKEN
+	VaultAddress string `mapstructure:"vaultAddress"`
+	VaultMount   string `mapstructure:"vaultMount"`
+	VaultPath    string `mapstructure:"vaultPath"`
+
+	// Region and name Prefix of the AWS Secrets Manager secrets
+	AWSRegion string `mapstructure:"awsRegion"`
+	AWSPrefix string `mapstructure:"awsPrefix"`
+
+	// Service the keychain items are filed under
+	KeychainService string `mapstructure:"keychainService"`
+}
+
+// New returns the SecretStore for the config
+func New(cfg Config) (SecretStore, error) {
+	switch cfg.Type {
+	case "", "file":
+		dir := cfg.Dir
+		if dir == "" {
+			dir = os.Getenv("HOME") + "/.gokp"
+		}
+		return &FileStore{Dir: dir}, nil
+	case "env":
+		return &EnvStore{}, nil
+	case "vault":
+		return newVaultStore(cfg)
+	case "aws-secrets-manager":
+		return newAWSStore(cfg)
+	case "keychain":
+		service := cfg.KeychainService
+		if service == "" {
+			service = "gokp"
+		}
+		return &KeychainStore{Service: service}, nil
+	}
+
+	return nil, errors.New("unknown secret store type: " + cfg.Type)
+}
@@ -0,0 +1,105 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// VaultStore keeps secrets in a Vault KV v2 engine, each under Path/<key> as the "value" field
+type VaultStore struct {
+	Address string
+	Mount   string
+	Path    string
+	Token   string
+}
+
+// newVaultStore returns the VaultStore for the config, falling back to the usual Vault environment variables
+func newVaultStore(cfg Config) (*VaultStore, error) {
+	v := &VaultStore{
+		Address: cfg.VaultAddress,
+		Mount:   cfg.VaultMount,
+		Path:    cfg.VaultPath,
+		Token:   os.Getenv("VAULT_TOKEN"),
+	}
+	if v.Address == "" {
+		v.Address = os.Getenv("VAULT_ADDR")
+	}
+	if v.Mount == "" {
+		v.Mount = "secret"
+	}
+	if v.Path == "" {
+		v.Path = "gokp"
+	}
+	if v.Address == "" || v.Token == "" {
+		return nil, errors.New("the vault secret store needs vaultAddress (or VAULT_ADDR) and VAULT_TOKEN")
+	}
+	return v, nil
+}
+
+// Get returns the "value" field of the secret
+func (v *VaultStore) Get(key string) (string, error) {
+	resp, err := v.do(http.MethodGet, key, nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return "", ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.New("unable to read " + key + " from vault: " + resp.Status)
+	}
+
+	secret := struct {
+		Data struct {
+			Data map[string]string `json:"data"`
+		} `json:"data"`
+	}{}
+	err = json.NewDecoder(resp.Body).Decode(&secret)
+	if err != nil {
+		return "", err
+	}
+	value, ok := secret.Data.Data["value"]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+// Set writes a new version of the secret
+func (v *VaultStore) Set(key string, value string) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"data": map[string]string{"value": value},
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := v.do(http.MethodPost, key, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return errors.New("unable to write " + key + " to vault: " + resp.Status)
+	}
+	return nil
+}
+
+// do sends the request for the secret to the KV v2 API
+func (v *VaultStore) do(method string, key string, body []byte) (*http.Response, error) {
+	url := strings.TrimSuffix(v.Address, "/") + "/v1/" + v.Mount + "/data/" + v.Path + "/" + key
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", v.Token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return http.DefaultClient.Do(req)
+}
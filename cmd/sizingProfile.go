@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/christianh814/gokp/cmd/capi"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// sizingProfile is a vetted size of cluster. Flags are what it sets for each provider, which are the sizes of the
+// machines and their volumes
+type sizingProfile struct {
+	HA      bool
+	Workers int64
+	Flags   map[string]map[string]string
+}
+
+// sizingProfileNames are the profiles that can be given with --profile, from the smallest up
+var sizingProfileNames = []string{"small", "medium", "production"}
+
+// sizingProfiles are the profiles by name
+var sizingProfiles = map[string]sizingProfile{
+	"small": {
+		HA:      false,
+		Workers: 2,
+		Flags: map[string]map[string]string{
+			"aws":      {"aws-control-plane-machine": "t3.large", "aws-node-machine": "t3.large", "aws-root-volume-size": "50", "aws-root-volume-type": "gp3"},
+			"azure":    {"azure-control-plane-machine": "Standard_D2s_v3", "azure-node-machine": "Standard_D2s_v3", "azure-os-disk-size": "64"},
+			"oci":      {"oci-control-plane-shape": "VM.Standard.E4.Flex", "oci-control-plane-ocpus": "1", "oci-node-shape": "VM.Standard.E4.Flex", "oci-node-ocpus": "1"},
+			"ibmcloud": {"ibmcloud-control-plane-profile": "bx2-2x8", "ibmcloud-node-profile": "bx2-2x8"},
+			"linode":   {"linode-control-plane-plan": "g6-standard-2", "linode-node-plan": "g6-standard-2"},
+			"proxmox":  {"proxmox-cores": "2", "proxmox-memory-mib": "4096", "proxmox-disk-size": "20"},
+		},
+	},
+	"medium": {
+		HA:      true,
+		Workers: 3,
+		Flags: map[string]map[string]string{
+			"aws":      {"aws-control-plane-machine": "m5.large", "aws-node-machine": "m5.xlarge", "aws-root-volume-size": "80", "aws-root-volume-type": "gp3"},
+			"azure":    {"azure-control-plane-machine": "Standard_D2s_v3", "azure-node-machine": "Standard_D4s_v3", "azure-os-disk-size": "128"},
+			"oci":      {"oci-control-plane-shape": "VM.Standard.E4.Flex", "oci-control-plane-ocpus": "2", "oci-node-shape": "VM.Standard.E4.Flex", "oci-node-ocpus": "2"},
+			"ibmcloud": {"ibmcloud-control-plane-profile": "bx2-4x16", "ibmcloud-node-profile": "bx2-4x16"},
+			"linode":   {"linode-control-plane-plan": "g6-standard-2", "linode-node-plan": "g6-standard-4"},
+			"proxmox":  {"proxmox-cores": "4", "proxmox-memory-mib": "8192", "proxmox-disk-size": "40"},
+		},
+	},
+	"production": {
+		HA:      true,
+		Workers: 3,
+		Flags: map[string]map[string]string{
+			"aws":      {"aws-control-plane-machine": "m5.xlarge", "aws-node-machine": "m5.2xlarge", "aws-root-volume-size": "100", "aws-root-volume-type": "gp3"},
+			"azure":    {"azure-control-plane-machine": "Standard_D4s_v3", "azure-node-machine": "Standard_D8s_v3", "azure-os-disk-size": "256"},
+			"oci":      {"oci-control-plane-shape": "VM.Standard.E4.Flex", "oci-control-plane-ocpus": "2", "oci-node-shape": "VM.Standard.E4.Flex", "oci-node-ocpus": "4"},
+			"ibmcloud": {"ibmcloud-control-plane-profile": "bx2-4x16", "ibmcloud-node-profile": "bx2-8x32"},
+			"linode":   {"linode-control-plane-plan": "g6-standard-4", "linode-node-plan": "g6-standard-8"},
+			"proxmox":  {"proxmox-cores": "4", "proxmox-memory-mib": "16384", "proxmox-disk-size": "80"},
+		},
+	},
+}
+
+// addSizingProfileFlag adds the flag to pick a sizing profile
+func addSizingProfileFlag(c *cobra.Command) {
+	c.Flags().String("profile", "", "Size the cluster with a profile ("+strings.Join(sizingProfileNames, ", ")+"). Flags that are given override it.")
+}
+
+// applySizingProfile sets the flags of the profile given with --profile for the provider, except the ones that were
+// given on the command line, and the number of workers. It returns if the cluster should be HA, which it is by
+// default when there's no profile
+func applySizingProfile(cmd *cobra.Command, provider string) (bool, error) {
+	name, _ := cmd.Flags().GetString("profile")
+	if name == "" {
+		return true, nil
+	}
+	profile, ok := sizingProfiles[name]
+	if !ok {
+		return false, errors.New("unknown profile " + name + ", it should be one of: " + strings.Join(sizingProfileNames, ", "))
+	}
+
+	log.Info("Using the ", name, " profile")
+	for flag, value := range profile.Flags[provider] {
+		if cmd.Flags().Changed(flag) {
+			continue
+		}
+		err := cmd.Flags().Set(flag, value)
+		if err != nil {
+			return false, err
+		}
+	}
+	capi.WorkerMachineCount = profile.Workers
+
+	return profile.HA, nil
+}
@@ -0,0 +1,230 @@
+package sops
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"filippo.io/age"
+	gosops "go.mozilla.org/sops/v3"
+	"go.mozilla.org/sops/v3/aes"
+	sopsage "go.mozilla.org/sops/v3/age"
+	"go.mozilla.org/sops/v3/cmd/sops/common"
+	"go.mozilla.org/sops/v3/decrypt"
+	"go.mozilla.org/sops/v3/keys"
+	"go.mozilla.org/sops/v3/keyservice"
+	sopsyaml "go.mozilla.org/sops/v3/stores/yaml"
+	"go.mozilla.org/sops/v3/version"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/yaml"
+)
+
+// KeyFile is the age key of the cluster the secrets in its GitOps repo are encrypted with. It's kept in the workdir
+// of the install, which becomes the artifact dir of the cluster
+var KeyFile string = "age.agekey"
+
+// SecretName is the Secret the GitOps controller decrypts with, holding the age key under KeyFile
+var SecretName string = "sops-age"
+
+// ConfigFile is the SOPS config at the root of the repo, so "sops --encrypt" picks the key of the cluster
+var ConfigFile string = ".sops.yaml"
+
+// encryptedRegex are the fields of a Secret that are encrypted, the rest of it stays readable
+var encryptedRegex string = "^(data|stringData)$"
+
+// EnsureKey makes sure there's an age key in dir, creating it if there isn't one, and returns its recipient (the
+// public key files are encrypted for)
+func EnsureKey(dir string) (string, error) {
+	b, err := ioutil.ReadFile(dir + "/" + KeyFile)
+	if err == nil {
+		identities, err := age.ParseIdentities(bytes.NewReader(b))
+		if err != nil {
+			return "", err
+		}
+		identity, ok := identities[0].(*age.X25519Identity)
+		if !ok {
+			return "", errors.New("the age key in " + dir + "/" + KeyFile + " is not an X25519 key")
+		}
+		return identity.Recipient().String(), nil
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		return "", err
+	}
+	key := "# public key: " + identity.Recipient().String() + "\n" + identity.String() + "\n"
+	err = ioutil.WriteFile(dir+"/"+KeyFile, []byte(key), 0600)
+	if err != nil {
+		return "", err
+	}
+	return identity.Recipient().String(), nil
+}
+
+// EncryptFile encrypts the data (and stringData) of the Secret in the YAML file for the recipient, in place
+func EncryptFile(file string, recipient string) error {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	store := &sopsyaml.Store{}
+	branches, err := store.LoadPlainFile(b)
+	if err != nil {
+		return err
+	}
+	masterKeys, err := sopsage.MasterKeysFromRecipients(recipient)
+	if err != nil {
+		return err
+	}
+	group := gosops.KeyGroup{}
+	for _, k := range masterKeys {
+		group = append(group, keys.MasterKey(k))
+	}
+	tree := gosops.Tree{
+		Branches: branches,
+		Metadata: gosops.Metadata{
+			KeyGroups:      []gosops.KeyGroup{group},
+			EncryptedRegex: encryptedRegex,
+			Version:        version.Version,
+		},
+	}
+	dataKey, errs := tree.GenerateDataKeyWithKeyServices([]keyservice.KeyServiceClient{keyservice.NewLocalClient()})
+	if len(errs) > 0 {
+		return errors.New("unable to encrypt " + file + ": " + errs[0].Error())
+	}
+	err = common.EncryptTree(common.EncryptTreeOpts{DataKey: dataKey, Tree: &tree, Cipher: aes.NewCipher()})
+	if err != nil {
+		return err
+	}
+
+	out, err := store.EmitEncryptedFile(tree)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, out, 0644)
+}
+
+// WriteConfig writes the SOPS config into the root of the repo, so secrets added to it later are encrypted the same
+// way with "sops --encrypt --in-place"
+func WriteConfig(repoDir string, recipient string) error {
+	b, err := yaml.Marshal(map[string]interface{}{
+		"creation_rules": []map[string]string{
+			{"encrypted_regex": encryptedRegex, "age": recipient},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(repoDir+"/"+ConfigFile, b, 0644)
+}
+
+// IsEncrypted returns true if the YAML was encrypted with SOPS
+func IsEncrypted(b []byte) bool {
+	m := map[string]interface{}{}
+	err := yaml.Unmarshal(b, &m)
+	if err != nil {
+		return false
+	}
+	_, ok := m["sops"]
+	return ok
+}
+
+// WithoutEncrypted returns the YAML files that weren't encrypted with SOPS
+func WithoutEncrypted(files []string) ([]string, error) {
+	plain := []string{}
+	for _, f := range files {
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		if !IsEncrypted(b) {
+			plain = append(plain, f)
+		}
+	}
+	return plain, nil
+}
+
+// DecryptDir decrypts the YAML files in dir that were encrypted with SOPS into outDir, with the age key in keyDir,
+// and returns the decrypted files. Nothing is done if none of them were
+func DecryptDir(dir string, keyDir string, outDir string) ([]string, error) {
+	files, err := filepath.Glob(dir + "/*.yaml")
+	if err != nil {
+		return nil, err
+	}
+
+	decrypted := []string{}
+	for _, f := range files {
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		if !IsEncrypted(b) {
+			continue
+		}
+
+		// SOPS only reads age keys from a file it's told about
+		if _, err := os.Stat(keyDir + "/" + KeyFile); err != nil {
+			return nil, errors.New(f + " is encrypted with SOPS, but there's no age key in " + keyDir)
+		}
+		os.Setenv(sopsage.SopsAgeKeyFileEnv, keyDir+"/"+KeyFile)
+		plain, err := decrypt.Data(b, "yaml")
+		if err != nil {
+			return nil, errors.New("unable to decrypt " + f + ": " + err.Error())
+		}
+
+		os.MkdirAll(outDir, 0700)
+		out := outDir + "/" + filepath.Base(f)
+		err = ioutil.WriteFile(out, plain, 0600)
+		if err != nil {
+			return nil, err
+		}
+		decrypted = append(decrypted, out)
+	}
+	return decrypted, nil
+}
+
+// CreateSecret creates (or replaces) the Secret with the age key in keyDir in the namespace of the cluster of the
+// kubeconfig, along with the namespace
+func CreateSecret(kubeconfig string, namespace string, keyDir string) error {
+	key, err := ioutil.ReadFile(keyDir + "/" + KeyFile)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return err
+	}
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	_, err = clientset.CoreV1().Namespaces().Create(context.TODO(), &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: namespace},
+	}, metav1.CreateOptions{})
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: SecretName, Namespace: namespace},
+		Type:       corev1.SecretTypeOpaque,
+		Data:       map[string][]byte{KeyFile: key},
+	}
+	_, err = clientset.CoreV1().Secrets(namespace).Create(context.TODO(), secret, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		_, err = clientset.CoreV1().Secrets(namespace).Update(context.TODO(), secret, metav1.UpdateOptions{})
+	}
+	return err
+}
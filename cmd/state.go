@@ -0,0 +1,24 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// stateCmd represents the state command
+var stateCmd = &cobra.Command{
+	Use:   "state",
+	Short: "Manages the shared state of gokp clusters",
+	Long: `Manages the state of gokp clusters that's shared with a team, set up under
+"stateBackend" in the config file (see "gokp create-cluster --help"). For
+example:
+
+gokp state push --cluster-name=mycluster
+gokp state force-unlock --cluster-name=mycluster`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(stateCmd)
+}
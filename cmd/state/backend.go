@@ -0,0 +1,82 @@
+package state
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Backend is where the state of the clusters is shared from, so a team can manage the clusters and not just the
+// machine that created them. It keeps files for each cluster, like its state file and its kubeconfig. Get returns
+// os.ErrNotExist for a file it doesn't have
+type Backend interface {
+	// Get returns a file of the cluster
+	Get(clusterName string, name string) ([]byte, error)
+	// Put creates or replaces a file of the cluster, taking the lock for the write if it's not held already
+	Put(clusterName string, name string, b []byte) error
+	// Delete removes every file of the cluster, taking the lock for it if it's not held already
+	Delete(clusterName string) error
+	// Lock takes the lock of the state of the cluster, and holds it until Unlock, so only one gokp changes the
+	// cluster at a time. Someone else holding it is an error
+	Lock(clusterName string) error
+	// Unlock releases the lock Lock took
+	Unlock(clusterName string) error
+	// ForceUnlock releases the lock of the state of the cluster, whoever holds it, for one left behind by a gokp
+	// that was killed. It returns who held it, empty if nobody did
+	ForceUnlock(clusterName string) (string, error)
+	// List returns the names of the clusters that have files
+	List() ([]string, error)
+	// String says where the state is, for messages
+	String() string
+}
+
+// Shared is the backend the state is shared from. If nil, the state is only kept under ~/.gokp
+var Shared Backend
+
+// ReadOnly keeps the shared state from being changed. Changes are only saved under ~/.gokp, where they take
+// precedence over the shared state
+var ReadOnly bool = false
+
+// Config is the stateBackend section of the GOKP config file
+type Config struct {
+	// Type is local (the default), s3, or gcs
+	Type string `mapstructure:"type"`
+
+	// Bucket and key Prefix of the S3 or GCS backend, and Region of the S3 one. The default AWS credential
+	// chain, or the Google application default credentials, are used
+	Bucket string `mapstructure:"bucket"`
+	Prefix string `mapstructure:"prefix"`
+	Region string `mapstructure:"region"`
+
+	// DynamoDBTable is the table used to lock the state in S3 while a cluster is changed, with a LockID string
+	// partition key like the one of Terraform. Nothing is locked if empty
+	DynamoDBTable string `mapstructure:"dynamoDBTable"`
+
+	// ReadOnly only reads the shared state, see ReadOnly
+	ReadOnly bool `mapstructure:"readOnly"`
+}
+
+// NewBackend returns the Backend for the config, or nil if the state is only kept locally
+func NewBackend(cfg Config) (Backend, error) {
+	switch cfg.Type {
+	case "", "local":
+		return nil, nil
+	case "s3", "gcs":
+		if cfg.Bucket == "" {
+			return nil, errors.New("the " + cfg.Type + " state backend needs a bucket")
+		}
+		if cfg.Type == "gcs" {
+			return newGCSBackend(cfg)
+		}
+		return newS3Backend(cfg)
+	}
+
+	return nil, errors.New("unknown state backend type: " + cfg.Type)
+}
+
+// lockInfo says who is taking a lock, so whoever finds it taken knows who to ask
+func lockInfo() string {
+	host, _ := os.Hostname()
+	return "gokp on " + host + " (pid " + strconv.Itoa(os.Getpid()) + ") at " + time.Now().Format(time.RFC3339)
+}
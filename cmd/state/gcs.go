@@ -0,0 +1,266 @@
+package state
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"golang.org/x/oauth2/google"
+)
+
+// gcsAPI is the JSON API of Google Cloud Storage
+var gcsAPI string = "https://storage.googleapis.com"
+
+// gcsLockFile is the object, next to the files of a cluster, that's there while someone changes the cluster
+var gcsLockFile string = ".gokp.lock"
+
+// GCSBackend keeps the files of each cluster in a Google Cloud Storage bucket, as Prefix + <cluster>/<file>. The
+// state of a cluster is locked with an object that can only be created if it's not there
+type GCSBackend struct {
+	Bucket string
+	Prefix string
+	client *http.Client
+
+	// held are the locks this gokp holds, by cluster, with the generation of their object
+	held map[string]string
+}
+
+// newGCSBackend returns the GCSBackend for the config, with the application default credentials
+func newGCSBackend(cfg Config) (*GCSBackend, error) {
+	client, err := google.DefaultClient(context.Background(), "https://www.googleapis.com/auth/devstorage.read_write")
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := cfg.Prefix
+	if prefix == "" {
+		prefix = "gokp/"
+	}
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return &GCSBackend{Bucket: cfg.Bucket, Prefix: prefix, client: client, held: map[string]string{}}, nil
+}
+
+// object returns the name of the object of a file of the cluster
+func (b *GCSBackend) object(clusterName string, name string) string {
+	return b.Prefix + clusterName + "/" + name
+}
+
+// objectURL returns the URL of the metadata of an object, or its content with ?alt=media
+func (b *GCSBackend) objectURL(object string) string {
+	return gcsAPI + "/storage/v1/b/" + url.PathEscape(b.Bucket) + "/o/" + url.PathEscape(object)
+}
+
+// do sends the request and returns the body of the response. A 404 is os.ErrNotExist
+func (b *GCSBackend) do(method string, u string, body []byte) ([]byte, int, error) {
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, err
+	}
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	out, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, resp.StatusCode, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, resp.StatusCode, os.ErrNotExist
+	}
+	if resp.StatusCode >= 300 {
+		return nil, resp.StatusCode, errors.New(method + " " + u + ": " + resp.Status + ": " + strings.TrimSpace(string(out)))
+	}
+	return out, resp.StatusCode, nil
+}
+
+// upload creates or replaces the object, and returns its metadata. With onlyIfMissing, it fails with a 412 if the
+// object is there
+func (b *GCSBackend) upload(object string, content []byte, onlyIfMissing bool) ([]byte, int, error) {
+	u := gcsAPI + "/upload/storage/v1/b/" + url.PathEscape(b.Bucket) + "/o?uploadType=media&name=" + url.QueryEscape(object)
+	if onlyIfMissing {
+		u += "&ifGenerationMatch=0"
+	}
+	return b.do(http.MethodPost, u, content)
+}
+
+// Get returns a file of the cluster
+func (b *GCSBackend) Get(clusterName string, name string) ([]byte, error) {
+	out, _, err := b.do(http.MethodGet, b.objectURL(b.object(clusterName, name))+"?alt=media", nil)
+	return out, err
+}
+
+// Put creates or replaces a file of the cluster, holding the lock while it does
+func (b *GCSBackend) Put(clusterName string, name string, content []byte) error {
+	if _, ok := b.held[clusterName]; !ok {
+		err := b.Lock(clusterName)
+		if err != nil {
+			return err
+		}
+		defer b.Unlock(clusterName)
+	}
+
+	_, _, err := b.upload(b.object(clusterName, name), content, false)
+	return err
+}
+
+// Delete removes every file of the cluster, holding the lock while it does
+func (b *GCSBackend) Delete(clusterName string) error {
+	if _, ok := b.held[clusterName]; !ok {
+		err := b.Lock(clusterName)
+		if err != nil {
+			return err
+		}
+		defer b.Unlock(clusterName)
+	}
+
+	objects, _, err := b.list(b.object(clusterName, ""), "")
+	if err != nil {
+		return err
+	}
+	for _, object := range objects {
+		if strings.HasSuffix(object, "/"+gcsLockFile) {
+			continue
+		}
+		_, _, err = b.do(http.MethodDelete, b.objectURL(object), nil)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// List returns the names of the clusters that have files under the prefix
+func (b *GCSBackend) List() ([]string, error) {
+	_, prefixes, err := b.list(b.Prefix, "/")
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, p := range prefixes {
+		names = append(names, strings.TrimSuffix(strings.TrimPrefix(p, b.Prefix), "/"))
+	}
+	return names, nil
+}
+
+// list returns the objects under the prefix and, with a delimiter, the prefixes one level down
+func (b *GCSBackend) list(prefix string, delimiter string) ([]string, []string, error) {
+	objects := []string{}
+	prefixes := []string{}
+	pageToken := ""
+	for {
+		q := url.Values{}
+		q.Set("prefix", prefix)
+		if delimiter != "" {
+			q.Set("delimiter", delimiter)
+		}
+		if pageToken != "" {
+			q.Set("pageToken", pageToken)
+		}
+		out, _, err := b.do(http.MethodGet, gcsAPI+"/storage/v1/b/"+url.PathEscape(b.Bucket)+"/o?"+q.Encode(), nil)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		page := struct {
+			Items []struct {
+				Name string `json:"name"`
+			} `json:"items"`
+			Prefixes      []string `json:"prefixes"`
+			NextPageToken string   `json:"nextPageToken"`
+		}{}
+		err = json.Unmarshal(out, &page)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, item := range page.Items {
+			objects = append(objects, item.Name)
+		}
+		prefixes = append(prefixes, page.Prefixes...)
+
+		if page.NextPageToken == "" {
+			return objects, prefixes, nil
+		}
+		pageToken = page.NextPageToken
+	}
+}
+
+// String returns the GCS URL of the prefix
+func (b *GCSBackend) String() string {
+	return "gs://" + b.Bucket + "/" + b.Prefix
+}
+
+// Lock takes the lock of the state of the cluster until Unlock. Someone else holding it is an error
+func (b *GCSBackend) Lock(clusterName string) error {
+	object := b.object(clusterName, gcsLockFile)
+	out, status, err := b.upload(object, []byte(lockInfo()), true)
+	if status == http.StatusPreconditionFailed {
+		return errors.New("the state of " + clusterName + " is locked by " + b.lockHolder(clusterName) + ", try again later or run \"gokp state force-unlock\" if that gokp is gone")
+	}
+	if err != nil {
+		return err
+	}
+
+	meta := struct {
+		Generation string `json:"generation"`
+	}{}
+	err = json.Unmarshal(out, &meta)
+	if err != nil {
+		return err
+	}
+	b.held[clusterName] = meta.Generation
+	return nil
+}
+
+// Unlock releases the lock Lock took, as long as it's still ours and wasn't forced open in the meantime
+func (b *GCSBackend) Unlock(clusterName string) error {
+	generation, ok := b.held[clusterName]
+	if !ok {
+		return nil
+	}
+	delete(b.held, clusterName)
+
+	_, status, err := b.do(http.MethodDelete, b.objectURL(b.object(clusterName, gcsLockFile))+"?ifGenerationMatch="+url.QueryEscape(generation), nil)
+	if status == http.StatusPreconditionFailed || os.IsNotExist(err) {
+		return errors.New("the lock of the state of " + clusterName + " was forced open while it was held")
+	}
+	return err
+}
+
+// ForceUnlock deletes the lock object of the cluster, whoever holds it, and returns who did
+func (b *GCSBackend) ForceUnlock(clusterName string) (string, error) {
+	object := b.object(clusterName, gcsLockFile)
+	holder, _, err := b.do(http.MethodGet, b.objectURL(object)+"?alt=media", nil)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	_, _, err = b.do(http.MethodDelete, b.objectURL(object), nil)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	delete(b.held, clusterName)
+	return string(holder), nil
+}
+
+// lockHolder says who holds the lock, as far as the lock object tells
+func (b *GCSBackend) lockHolder(clusterName string) string {
+	holder, _, err := b.do(http.MethodGet, b.objectURL(b.object(clusterName, gcsLockFile))+"?alt=media", nil)
+	if err != nil || len(holder) == 0 {
+		return "someone else"
+	}
+	return string(holder)
+}
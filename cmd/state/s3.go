@@ -0,0 +1,239 @@
+package state
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// S3Backend keeps the files of each cluster in an S3 bucket, as Prefix + <cluster>/<file>, encrypted at rest.
+// The state of a cluster is locked with an item in LockTable, if it's set
+type S3Backend struct {
+	Bucket    string
+	Prefix    string
+	LockTable string
+	s3        *s3.S3
+	dynamodb  *dynamodb.DynamoDB
+
+	// held are the locks this gokp holds, by cluster, with the info of their item
+	held map[string]string
+}
+
+// newS3Backend returns the S3Backend for the config
+func newS3Backend(cfg Config) (*S3Backend, error) {
+	awsCfg := &aws.Config{}
+	if cfg.Region != "" {
+		awsCfg.Region = aws.String(cfg.Region)
+	}
+	sess, err := session.NewSession(awsCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := cfg.Prefix
+	if prefix == "" {
+		prefix = "gokp/"
+	}
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return &S3Backend{
+		Bucket:    cfg.Bucket,
+		Prefix:    prefix,
+		LockTable: cfg.DynamoDBTable,
+		s3:        s3.New(sess),
+		dynamodb:  dynamodb.New(sess),
+		held:      map[string]string{},
+	}, nil
+}
+
+// key returns the key of a file of the cluster
+func (b *S3Backend) key(clusterName string, name string) string {
+	return b.Prefix + clusterName + "/" + name
+}
+
+// Get returns a file of the cluster
+func (b *S3Backend) Get(clusterName string, name string) ([]byte, error) {
+	out, err := b.s3.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(b.Bucket),
+		Key:    aws.String(b.key(clusterName, name)),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+		return nil, os.ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+
+	return ioutil.ReadAll(out.Body)
+}
+
+// Put creates or replaces a file of the cluster, holding the lock while it does
+func (b *S3Backend) Put(clusterName string, name string, content []byte) error {
+	if _, ok := b.held[clusterName]; !ok {
+		err := b.Lock(clusterName)
+		if err != nil {
+			return err
+		}
+		defer b.Unlock(clusterName)
+	}
+
+	_, err := b.s3.PutObject(&s3.PutObjectInput{
+		Bucket:               aws.String(b.Bucket),
+		Key:                  aws.String(b.key(clusterName, name)),
+		Body:                 bytes.NewReader(content),
+		ServerSideEncryption: aws.String(s3.ServerSideEncryptionAes256),
+	})
+	return err
+}
+
+// Delete removes every file of the cluster, holding the lock while it does
+func (b *S3Backend) Delete(clusterName string) error {
+	if _, ok := b.held[clusterName]; !ok {
+		err := b.Lock(clusterName)
+		if err != nil {
+			return err
+		}
+		defer b.Unlock(clusterName)
+	}
+
+	keys := []*s3.ObjectIdentifier{}
+	err := b.s3.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(b.Bucket),
+		Prefix: aws.String(b.key(clusterName, "")),
+	}, func(out *s3.ListObjectsV2Output, last bool) bool {
+		for _, o := range out.Contents {
+			keys = append(keys, &s3.ObjectIdentifier{Key: o.Key})
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+
+	_, err = b.s3.DeleteObjects(&s3.DeleteObjectsInput{
+		Bucket: aws.String(b.Bucket),
+		Delete: &s3.Delete{Objects: keys},
+	})
+	return err
+}
+
+// List returns the names of the clusters that have files under the prefix
+func (b *S3Backend) List() ([]string, error) {
+	names := []string{}
+	err := b.s3.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket:    aws.String(b.Bucket),
+		Prefix:    aws.String(b.Prefix),
+		Delimiter: aws.String("/"),
+	}, func(out *s3.ListObjectsV2Output, last bool) bool {
+		for _, p := range out.CommonPrefixes {
+			names = append(names, strings.TrimSuffix(strings.TrimPrefix(aws.StringValue(p.Prefix), b.Prefix), "/"))
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// String returns the S3 URL of the prefix
+func (b *S3Backend) String() string {
+	return "s3://" + b.Bucket + "/" + b.Prefix
+}
+
+// lockID is the partition key of the lock item of the cluster
+func (b *S3Backend) lockID(clusterName string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{"LockID": {S: aws.String(b.Bucket + "/" + b.key(clusterName, StateFile))}}
+}
+
+// Lock takes the lock of the state of the cluster until Unlock. Someone else holding it is an error. Nothing is
+// locked without a LockTable
+func (b *S3Backend) Lock(clusterName string) error {
+	if b.LockTable == "" {
+		return nil
+	}
+
+	info := lockInfo()
+	item := b.lockID(clusterName)
+	item["Info"] = &dynamodb.AttributeValue{S: aws.String(info)}
+	_, err := b.dynamodb.PutItem(&dynamodb.PutItemInput{
+		TableName:           aws.String(b.LockTable),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(LockID)"),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return errors.New("the state of " + clusterName + " is locked by " + b.lockHolder(clusterName) + ", try again later or run \"gokp state force-unlock\" if that gokp is gone")
+	}
+	if err != nil {
+		return err
+	}
+
+	b.held[clusterName] = info
+	return nil
+}
+
+// Unlock releases the lock Lock took, as long as it's still ours and wasn't forced open in the meantime
+func (b *S3Backend) Unlock(clusterName string) error {
+	info, ok := b.held[clusterName]
+	if !ok {
+		return nil
+	}
+	delete(b.held, clusterName)
+
+	_, err := b.dynamodb.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName:                 aws.String(b.LockTable),
+		Key:                       b.lockID(clusterName),
+		ConditionExpression:       aws.String("Info = :info"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":info": {S: aws.String(info)}},
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return errors.New("the lock of the state of " + clusterName + " was forced open while it was held")
+	}
+	return err
+}
+
+// ForceUnlock deletes the lock item of the cluster, whoever holds it, and returns who did
+func (b *S3Backend) ForceUnlock(clusterName string) (string, error) {
+	if b.LockTable == "" {
+		return "", errors.New("the state in " + b.String() + " isn't locked, there's no dynamodbTable")
+	}
+
+	out, err := b.dynamodb.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName:    aws.String(b.LockTable),
+		Key:          b.lockID(clusterName),
+		ReturnValues: aws.String(dynamodb.ReturnValueAllOld),
+	})
+	if err != nil {
+		return "", err
+	}
+	delete(b.held, clusterName)
+	if out.Attributes["Info"] == nil {
+		return "", nil
+	}
+	return aws.StringValue(out.Attributes["Info"].S), nil
+}
+
+// lockHolder says who holds the lock, as far as the lock item tells
+func (b *S3Backend) lockHolder(clusterName string) string {
+	out, err := b.dynamodb.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(b.LockTable),
+		Key:       b.lockID(clusterName),
+	})
+	if err != nil || out.Item["Info"] == nil {
+		return "someone else"
+	}
+	return aws.StringValue(out.Item["Info"].S)
+}
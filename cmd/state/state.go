@@ -0,0 +1,271 @@
+package state
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/yaml"
+)
+
+// StateFile is the name of the file, under the cluster's artifact dir, that GOKP keeps its state in
+var StateFile string = "gokp-state.yaml"
+
+// ClusterState is what GOKP remembers about a cluster it installed
+type ClusterState struct {
+	Name                 string            `json:"name"`
+	Provider             string            `json:"provider"`
+	Region               string            `json:"region,omitempty"`
+	ManagementKubeconfig string            `json:"managementKubeconfig,omitempty"`
+	Labels               map[string]string `json:"labels,omitempty"`
+	KubernetesVersion    string            `json:"kubernetesVersion,omitempty"`
+	GitOpsController     string            `json:"gitOpsController"`
+	ArgoCDVersion        string            `json:"argoCDVersion,omitempty"`
+	ArgoCDHA             bool              `json:"argoCDHA,omitempty"`
+	ArgoCDNamespace      string            `json:"argoCDNamespace,omitempty"`
+	GitOpsRepo           string            `json:"gitOpsRepo"`
+	RepoPath             string            `json:"repoPath,omitempty"`
+	RemoteName           string            `json:"remoteName"`
+	Branch               string            `json:"branch,omitempty"`
+	CreatedAt            time.Time         `json:"createdAt"`
+	Hibernated           bool              `json:"hibernated,omitempty"`
+	StoppedInstances     []string          `json:"stoppedInstances,omitempty"`
+	AWSSSHKey            string            `json:"awsSSHKey,omitempty"`
+	ExternalDNSZone      string            `json:"externalDNSZone,omitempty"`
+	BackupBucket         string            `json:"backupBucket,omitempty"`
+	AWSStack             *AWSStack         `json:"awsStack,omitempty"`
+	AWSSecurityGroup     string            `json:"awsSecurityGroup,omitempty"`
+}
+
+// AWSStack is the CloudFormation stack with the IAM roles, instance profiles, and policies CAPA uses on AWS. It's
+// shared by the clusters of an account, Created is set on the one whose install created it (or the one it was
+// handed over to when that one was deleted)
+type AWSStack struct {
+	Name             string            `json:"name"`
+	ID               string            `json:"id"`
+	Region           string            `json:"region"`
+	Created          bool              `json:"created,omitempty"`
+	Roles            []string          `json:"roles,omitempty"`
+	InstanceProfiles []string          `json:"instanceProfiles,omitempty"`
+	Policies         []string          `json:"policies,omitempty"`
+	Outputs          map[string]string `json:"outputs,omitempty"`
+}
+
+// BaseDir returns the dir the artifact dirs of all clusters are under (~/.gokp)
+func BaseDir() string {
+	return os.Getenv("HOME") + "/.gokp"
+}
+
+// ArtifactsDir returns the dir where everything for the given cluster is stored (~/.gokp/<clustername>)
+func ArtifactsDir(clusterName string) string {
+	return BaseDir() + "/" + clusterName
+}
+
+// Save writes the state of the cluster into its artifact dir, and into the shared state unless it's read only
+func Save(dir string, s *ClusterState) error {
+	b, err := yaml.Marshal(s)
+	if err != nil {
+		return err
+	}
+	// The artifact dir isn't there yet for clusters that came from the shared state
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(dir+"/"+StateFile, b, 0644)
+	if err != nil {
+		return err
+	}
+
+	if Shared == nil || ReadOnly {
+		return nil
+	}
+	return Shared.Put(s.Name, StateFile, b)
+}
+
+// Load reads the state of a cluster. The shared state wins over the one in its artifact dir, unless the shared
+// state is read only and there's one in the artifact dir
+func Load(dir string) (*ClusterState, error) {
+	b, err := ioutil.ReadFile(dir + "/" + StateFile)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if Shared != nil && (err != nil || !ReadOnly) {
+		shared, serr := Shared.Get(filepath.Base(dir), StateFile)
+		if serr == nil {
+			b, err = shared, nil
+		} else if !os.IsNotExist(serr) {
+			return nil, errors.New("unable to read the state from " + Shared.String() + ": " + serr.Error())
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s := &ClusterState{}
+	err = yaml.Unmarshal(b, s)
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// SaveFile puts a file of the cluster, like its kubeconfig, in the shared state unless it's read only
+func SaveFile(clusterName string, name string, b []byte) error {
+	if Shared == nil || ReadOnly {
+		return nil
+	}
+	return Shared.Put(clusterName, name, b)
+}
+
+// LoadFile returns a file of the cluster from the shared state, or os.ErrNotExist if it's not there (or there's no
+// shared state)
+func LoadFile(clusterName string, name string) ([]byte, error) {
+	if Shared == nil {
+		return nil, os.ErrNotExist
+	}
+	return Shared.Get(clusterName, name)
+}
+
+// Remove deletes the shared state of the cluster, along with its files, unless it's read only. The artifact dir
+// is left alone
+func Remove(clusterName string) error {
+	if Shared == nil || ReadOnly {
+		return nil
+	}
+	err := Shared.Delete(clusterName)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Lock takes the lock of the shared state of the cluster, unless there's none or it's read only, so nobody else
+// changes the cluster until Unlock
+func Lock(clusterName string) error {
+	if Shared == nil || ReadOnly {
+		return nil
+	}
+	return Shared.Lock(clusterName)
+}
+
+// Unlock releases the lock Lock took
+func Unlock(clusterName string) error {
+	if Shared == nil || ReadOnly {
+		return nil
+	}
+	return Shared.Unlock(clusterName)
+}
+
+// Names returns the names of the clusters that have an artifact dir, or that are in the shared state, sorted. It
+// doesn't read their state, so it's cheap enough for shell completion
+func Names() ([]string, error) {
+	found := map[string]bool{}
+	dirs, err := ioutil.ReadDir(BaseDir())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, d := range dirs {
+		// Installs in progress and dry runs are in hidden dirs
+		if d.IsDir() && !strings.HasPrefix(d.Name(), ".") {
+			found[d.Name()] = true
+		}
+	}
+	if Shared != nil {
+		shared, err := Shared.List()
+		if err != nil {
+			return nil, errors.New("unable to list the clusters in " + Shared.String() + ": " + err.Error())
+		}
+		for _, name := range shared {
+			found[name] = true
+		}
+	}
+
+	names := []string{}
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Exists returns if the cluster has an artifact dir, or is in the shared state
+func Exists(clusterName string) (bool, error) {
+	if info, err := os.Stat(ArtifactsDir(clusterName)); err == nil && info.IsDir() {
+		return true, nil
+	}
+	if Shared == nil {
+		return false, nil
+	}
+	_, err := Shared.Get(clusterName, StateFile)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.New("unable to read the state from " + Shared.String() + ": " + err.Error())
+	}
+
+	// If we're here, we should be okay
+	return true, nil
+}
+
+// List returns the state of every cluster that has an artifact dir with a state file in it, or that is in the
+// shared state, sorted by name
+func List() ([]*ClusterState, error) {
+	names, err := Names()
+	if err != nil {
+		return nil, err
+	}
+
+	states := []*ClusterState{}
+	for _, name := range names {
+		s, err := Load(ArtifactsDir(name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, errors.New("unable to load the state of " + name + ": " + err.Error())
+		}
+		states = append(states, s)
+	}
+
+	return states, nil
+}
+
+// Filter returns the clusters whose labels match the selector and, if given, that are on the provider and in the region
+func Filter(states []*ClusterState, selector labels.Selector, provider string, region string) []*ClusterState {
+	filtered := []*ClusterState{}
+	for _, s := range states {
+		if provider != "" && s.Provider != provider {
+			continue
+		}
+		if region != "" && s.Region != region {
+			continue
+		}
+		if selector != nil && !selector.Matches(labels.Set(s.Labels)) {
+			continue
+		}
+		filtered = append(filtered, s)
+	}
+	return filtered
+}
+
+// ValidateLabels makes sure the labels of a cluster are valid Kubernetes labels, so they can be selected on
+func ValidateLabels(l map[string]string) error {
+	for k, v := range l {
+		if errs := validation.IsQualifiedName(k); len(errs) > 0 {
+			return errors.New("invalid label key " + k + ": " + strings.Join(errs, ", "))
+		}
+		if errs := validation.IsValidLabelValue(v); len(errs) > 0 {
+			return errors.New("invalid value for label " + k + ": " + strings.Join(errs, ", "))
+		}
+	}
+	return nil
+}
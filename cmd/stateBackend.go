@@ -0,0 +1,23 @@
+package cmd
+
+import (
+	"github.com/christianh814/gokp/cmd/state"
+	"github.com/spf13/viper"
+)
+
+// setStateBackend shares the state of the clusters from the backend set up in the stateBackend section of the config
+// file. The state is only kept under ~/.gokp if there's none
+func setStateBackend() error {
+	cfg := state.Config{}
+	err := viper.UnmarshalKey("stateBackend", &cfg)
+	if err != nil {
+		return err
+	}
+
+	state.Shared, err = state.NewBackend(cfg)
+	if err != nil {
+		return err
+	}
+	state.ReadOnly = cfg.ReadOnly
+	return nil
+}
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"github.com/christianh814/gokp/cmd/state"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// stateLockAnnotation is on the commands that change a cluster. The shared state of the cluster is locked for the
+// whole command, from reading the state to saving it, so two people can't change the same cluster at once
+var stateLockAnnotation string = "gokp.io/state-lock"
+
+// lockedCluster is the cluster whose state this command holds the lock of, empty if none
+var lockedCluster string
+
+// lockClusterState takes the lock of the state of the cluster given with --cluster-name, if the command changes it.
+// The lock is released when the command is done, or when it fails with log.Fatal
+func lockClusterState(cmd *cobra.Command) error {
+	if cmd.Annotations[stateLockAnnotation] == "" {
+		return nil
+	}
+	flag := cmd.Flags().Lookup("cluster-name")
+	if flag == nil || flag.Value.String() == "" {
+		return nil
+	}
+
+	clusterName := flag.Value.String()
+	err := state.Lock(clusterName)
+	if err != nil {
+		return err
+	}
+	lockedCluster = clusterName
+	log.RegisterExitHandler(unlockClusterState)
+
+	// If we're here, we should be okay
+	return nil
+}
+
+// unlockClusterState releases the lock lockClusterState took. Not being able to is only a warning, the command is
+// done either way
+func unlockClusterState() {
+	if lockedCluster == "" {
+		return
+	}
+	clusterName := lockedCluster
+	lockedCluster = ""
+
+	err := state.Unlock(clusterName)
+	if err != nil {
+		log.Warn("Unable to unlock the state of ", clusterName, ": ", err)
+	}
+}
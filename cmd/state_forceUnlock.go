@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"errors"
+
+	"github.com/christianh814/gokp/cmd/state"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// stateForceUnlockCmd represents the state force-unlock command
+var stateForceUnlockCmd = &cobra.Command{
+	Use:   "force-unlock",
+	Short: "Releases the lock of the shared state of a cluster",
+	Long: `Releases the lock of the shared state of a cluster, whoever holds it. Commands
+that change a cluster (like scale, upgrade-cluster, hibernate, or
+delete-cluster) hold the lock until they're done, so a gokp that was killed
+leaves it behind. Only force it open if the gokp that holds it is gone, or two
+of them could change the cluster at once. For example:
+
+gokp state force-unlock --cluster-name=mycluster`,
+	Annotations: map[string]string{clusterNameAnnotation: "any"},
+	Run: func(cmd *cobra.Command, args []string) {
+		// Grab flags
+		clusterName, _ := cmd.Flags().GetString("cluster-name")
+
+		if state.Shared == nil {
+			log.Fatal(errors.New("there's no shared state, set it up under stateBackend in the config file"))
+		}
+		if state.ReadOnly {
+			log.Fatal(errors.New("the shared state in " + state.Shared.String() + " is read only"))
+		}
+
+		holder, err := state.Shared.ForceUnlock(clusterName)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if holder == "" {
+			log.Info("The state of ", clusterName, " wasn't locked")
+			return
+		}
+		log.Info("Released the lock of the state of ", clusterName, ", held by ", holder)
+	},
+}
+
+func init() {
+	stateCmd.AddCommand(stateForceUnlockCmd)
+
+	stateForceUnlockCmd.Flags().String("cluster-name", "", "Name of the gokp cluster to unlock.")
+
+	stateForceUnlockCmd.MarkFlagRequired("cluster-name")
+}
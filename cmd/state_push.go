@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/christianh814/gokp/cmd/state"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// statePushCmd represents the state push command
+var statePushCmd = &cobra.Command{
+	Use:   "push",
+	Short: "Copies the state of clusters under ~/.gokp to the shared state",
+	Long: `Copies the state of clusters under ~/.gokp, along with their kubeconfig and
+deploy key, to the shared state. Clusters created before the shared state was
+set up are only under ~/.gokp until they're pushed. What's in the shared state
+is replaced. For example:
+
+gokp state push --cluster-name=mycluster
+gokp state push --all`,
+	Run: func(cmd *cobra.Command, args []string) {
+		// Grab flags
+		clusterName, _ := cmd.Flags().GetString("cluster-name")
+		all, _ := cmd.Flags().GetBool("all")
+
+		if state.Shared == nil {
+			log.Fatal(errors.New("there's no shared state, set it up under stateBackend in the config file"))
+		}
+		if state.ReadOnly {
+			log.Fatal(errors.New("the shared state in " + state.Shared.String() + " is read only"))
+		}
+		if clusterName == "" && !all {
+			log.Fatal(errors.New("give either --cluster-name or --all"))
+		}
+
+		names := []string{clusterName}
+		if all {
+			dirs, err := ioutil.ReadDir(state.BaseDir())
+			if err != nil {
+				log.Fatal(err)
+			}
+			names = []string{}
+			for _, d := range dirs {
+				if d.IsDir() && !strings.HasPrefix(d.Name(), ".") {
+					names = append(names, d.Name())
+				}
+			}
+		}
+
+		for _, name := range names {
+			b, err := ioutil.ReadFile(state.ArtifactsDir(name) + "/" + state.StateFile)
+			if os.IsNotExist(err) && all {
+				continue
+			}
+			if err != nil {
+				log.Fatal(errors.New("unable to read the state of " + name + ": " + err.Error()))
+			}
+
+			log.Info("Pushing the state of ", name, " to ", state.Shared.String())
+			err = state.SaveFile(name, state.StateFile, b)
+			if err != nil {
+				log.Fatal(err)
+			}
+			err = saveClusterSecrets(name)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+	},
+}
+
+func init() {
+	stateCmd.AddCommand(statePushCmd)
+
+	statePushCmd.Flags().String("cluster-name", "", "Name of the gokp cluster to push.")
+	statePushCmd.Flags().Bool("all", false, "Push every cluster under ~/.gokp.")
+}
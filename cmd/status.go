@@ -0,0 +1,195 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/christianh814/gokp/cmd/gitutils"
+	"github.com/christianh814/gokp/cmd/state"
+	"github.com/christianh814/gokp/cmd/status"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+// statusCmd represents the status command
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Shows the health of a cluster",
+	Long: `Shows the health of a cluster in detail: the conditions of the Cluster and
+its control plane, the state of every Machine, the sync and health status of
+the Argo CD Applications, and the last commit of the local clone of the GitOps
+repo. For example:
+
+gokp status --cluster-name=mycluster
+gokp status --cluster-name=mycluster -o json`,
+	Run: func(cmd *cobra.Command, args []string) {
+		// Grab flags
+		clusterName, _ := cmd.Flags().GetString("cluster-name")
+		CapiCfg, _ := cmd.Flags().GetString("kubeconfig")
+		output, _ := cmd.Flags().GetString("output")
+
+		// Clusters installed before the state file existed use Argo CD in the default namespace
+		st, err := state.Load(state.ArtifactsDir(clusterName))
+		if os.IsNotExist(err) {
+			st = &state.ClusterState{Name: clusterName, GitOpsController: "argocd", ArgoCDNamespace: "argocd"}
+		} else if err != nil {
+			log.Fatal(err)
+		}
+
+		// Default to the kubeconfig that was saved at install time
+		if CapiCfg == "" {
+			CapiCfg, err = clusterSecretFile(clusterName, clusterName+".kubeconfig")
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		report := &clusterReport{ClusterState: st}
+		argoNamespace := ""
+		if st.GitOpsController == "argocd" {
+			argoNamespace = st.ArgoCDNamespace
+			if argoNamespace == "" {
+				argoNamespace = "argocd"
+			}
+		}
+		// The CAPI objects of clusters managed from elsewhere aren't on the cluster itself
+		capiObjectsCfg := CapiCfg
+		if st.ManagementKubeconfig != "" {
+			capiObjectsCfg = st.ManagementKubeconfig
+		}
+		report.Status = status.Describe(capiObjectsCfg, CapiCfg, clusterName, argoNamespace)
+
+		// The repo is only there if the cluster was installed from here
+		repoDir, _, err := openClusterRepo(clusterName)
+		if err == nil {
+			report.LastCommit, err = gitutils.LastCommit(repoDir)
+		}
+		if err != nil {
+			log.Warn("Unable to get the last commit of the GitOps repo: ", err)
+		}
+
+		err = printReport(report, output)
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+
+	statusCmd.Flags().String("cluster-name", "", "Name of the gokp cluster.")
+	statusCmd.Flags().String("kubeconfig", "", "Path to the Kubeconfig file of the gokp cluster (defaults to the one under ~/.gokp).")
+	statusCmd.Flags().StringP("output", "o", "table", "Output format (table, json, or yaml).")
+
+	statusCmd.MarkFlagRequired("cluster-name")
+}
+
+// clusterReport is everything the status command reports on a cluster
+type clusterReport struct {
+	*state.ClusterState
+	Status     *status.Description `json:"status"`
+	LastCommit *gitutils.Commit    `json:"lastCommit,omitempty"`
+}
+
+// printReport writes the report to stdout in the given format
+func printReport(r *clusterReport, output string) error {
+	switch output {
+	case "json":
+		b, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+		return nil
+	case "yaml":
+		b, err := yaml.Marshal(r)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(b))
+		return nil
+	case "table":
+	default:
+		return fmt.Errorf("unknown output format %s, must be table, json, or yaml", output)
+	}
+
+	s := r.Status
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	health := s.Health
+	if r.Hibernated {
+		health += " (hibernated)"
+	}
+	fmt.Fprintf(w, "Cluster:\t%s\n", r.Name)
+	fmt.Fprintf(w, "Provider:\t%s\n", valueOrNone(r.Provider))
+	fmt.Fprintf(w, "Health:\t%s\n", health)
+	if s.Health == status.Unreachable {
+		fmt.Fprintf(w, "Error:\t%s\n", s.Error)
+	} else if s.Health != status.Unmanaged {
+		fmt.Fprintf(w, "Phase:\t%s\n", valueOrNone(s.Phase))
+		fmt.Fprintf(w, "Version:\t%s\n", valueOrNone(s.KubernetesVersion))
+		fmt.Fprintf(w, "Control Plane:\t%d/%d ready\n", s.ControlPlaneReady, s.ControlPlaneReplicas)
+		fmt.Fprintf(w, "Workers:\t%d/%d ready\n", s.WorkersReady, s.WorkersReplicas)
+	}
+	if r.LastCommit != nil {
+		fmt.Fprintf(w, "Last Commit:\t%.7s %s (%s, %s)\n", r.LastCommit.Hash, firstLine(r.LastCommit.Message), r.LastCommit.Author, r.LastCommit.When.Format("2006-01-02 15:04"))
+	}
+	err := w.Flush()
+	if err != nil {
+		return err
+	}
+
+	if len(s.Conditions) > 0 {
+		fmt.Println()
+		w = tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(w, "OBJECT\tCONDITION\tSTATUS\tSEVERITY\tREASON\tMESSAGE")
+		for _, c := range s.Conditions {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", c.Object, c.Type, c.Status, c.Severity, c.Reason, firstLine(c.Message))
+		}
+		err = w.Flush()
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(s.Machines) > 0 {
+		fmt.Println()
+		w = tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(w, "MACHINE\tROLE\tPHASE\tNODE\tVERSION\tREADY\tREASON")
+		for _, m := range s.Machines {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%t\t%s\n", m.Name, m.Role, valueOrNone(m.Phase), valueOrNone(m.NodeName), valueOrNone(m.Version), m.Ready, m.Reason)
+		}
+		err = w.Flush()
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.ApplicationsError != "" {
+		fmt.Println()
+		fmt.Println("Unable to get the Argo CD Applications: " + s.ApplicationsError)
+	} else if len(s.Applications) > 0 {
+		fmt.Println()
+		w = tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(w, "APPLICATION\tSYNC\tHEALTH\tREVISION")
+		for _, a := range s.Applications {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%.7s\n", a.Name, valueOrNone(a.Sync), valueOrNone(a.Health), a.Revision)
+		}
+		err = w.Flush()
+		if err != nil {
+			return err
+		}
+	}
+
+	// If we're here, we should be okay
+	return nil
+}
+
+// firstLine returns the first line of a multi-line message, so it fits in a table
+func firstLine(msg string) string {
+	return strings.SplitN(msg, "\n", 2)[0]
+}
@@ -0,0 +1,208 @@
+package status
+
+import (
+	"context"
+	"sort"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// Resources the description is made up from, on top of the ones of the status
+var (
+	machineGVR     = schema.GroupVersionResource{Group: "cluster.x-k8s.io", Version: "v1beta1", Resource: "machines"}
+	applicationGVR = schema.GroupVersionResource{Group: "argoproj.io", Version: "v1alpha1", Resource: "applications"}
+)
+
+// Condition is a condition of a CAPI object
+type Condition struct {
+	Object   string `json:"object"`
+	Type     string `json:"type"`
+	Status   string `json:"status"`
+	Severity string `json:"severity,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+	Message  string `json:"message,omitempty"`
+}
+
+// Machine is a CAPI Machine of the cluster, Reason is why it's not ready if it isn't
+type Machine struct {
+	Name       string      `json:"name"`
+	Role       string      `json:"role"`
+	Phase      string      `json:"phase,omitempty"`
+	NodeName   string      `json:"nodeName,omitempty"`
+	Version    string      `json:"version,omitempty"`
+	Ready      bool        `json:"ready"`
+	Reason     string      `json:"reason,omitempty"`
+	Conditions []Condition `json:"conditions,omitempty"`
+}
+
+// Application is an Argo CD Application on the cluster
+type Application struct {
+	Name     string `json:"name"`
+	Sync     string `json:"sync"`
+	Health   string `json:"health"`
+	Revision string `json:"revision,omitempty"`
+}
+
+// Description is the status of a cluster along with everything it's made up from: the conditions of the Cluster
+// and its control plane, the Machines, and the Argo CD Applications
+type Description struct {
+	*ClusterStatus
+	Conditions        []Condition   `json:"conditions,omitempty"`
+	Machines          []Machine     `json:"machines,omitempty"`
+	Applications      []Application `json:"applications,omitempty"`
+	ApplicationsError string        `json:"applicationsError,omitempty"`
+}
+
+// Describe returns the description of the cluster with the name from the CAPI objects on the cluster of
+// capiKubeconfig, which is the cluster itself unless it's managed from elsewhere. The Applications are only looked
+// for, on the cluster of kubeconfig, if the Argo CD namespace is given. Like with Get, a cluster that can't be
+// reached isn't an error
+func Describe(capiKubeconfig string, kubeconfig string, clusterName string, argoCDNamespace string) *Description {
+	d := &Description{ClusterStatus: Get(capiKubeconfig, clusterName)}
+	if d.Health == Unreachable {
+		return d
+	}
+
+	// There's nothing of CAPI to describe, but Argo CD may still be there
+	if d.Health == Unmanaged {
+		d.getApplications(kubeconfig, argoCDNamespace)
+		return d
+	}
+
+	err := d.load(capiKubeconfig, clusterName)
+	if err != nil {
+		d.Health = Unreachable
+		d.Error = err.Error()
+		return d
+	}
+
+	d.getApplications(kubeconfig, argoCDNamespace)
+	return d
+}
+
+// getApplications fills in the Argo CD Applications if the namespace is given. Argo CD may not be there yet, which
+// says nothing about the cluster itself
+func (d *Description) getApplications(kubeconfig string, argoCDNamespace string) {
+	if argoCDNamespace == "" {
+		return
+	}
+	apps, err := getApplications(kubeconfig, argoCDNamespace)
+	if err != nil {
+		d.ApplicationsError = err.Error()
+		return
+	}
+	d.Applications = apps
+}
+
+// load fills in the conditions and Machines from the CAPI objects
+func (d *Description) load(kubeconfig string, clusterName string) error {
+	dyn, err := newDynamicClient(kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	cluster, err := dyn.Resource(clusterGVR).Namespace("default").Get(context.TODO(), clusterName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	d.Conditions = conditions(cluster)
+
+	// The control plane is what the cluster is ready on
+	kcpName, _, _ := unstructured.NestedString(cluster.Object, "spec", "controlPlaneRef", "name")
+	if kcpName != "" {
+		kcp, err := dyn.Resource(kubeadmControlPlaneGVR).Namespace("default").Get(context.TODO(), kcpName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		d.Conditions = append(d.Conditions, conditions(kcp)...)
+	}
+
+	d.Machines, err = getMachines(dyn, clusterName)
+	return err
+}
+
+// getMachines returns the Machines of the cluster, control plane ones first
+func getMachines(dyn dynamic.Interface, clusterName string) ([]Machine, error) {
+	list, err := dyn.Resource(machineGVR).Namespace("default").List(context.TODO(), metav1.ListOptions{
+		LabelSelector: "cluster.x-k8s.io/cluster-name=" + clusterName,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	machines := []Machine{}
+	for _, obj := range list.Items {
+		m := Machine{Name: obj.GetName(), Role: "worker", Conditions: conditions(&obj)}
+		if _, ok := obj.GetLabels()["cluster.x-k8s.io/control-plane"]; ok {
+			m.Role = "control-plane"
+		}
+		m.Phase, _, _ = unstructured.NestedString(obj.Object, "status", "phase")
+		m.NodeName, _, _ = unstructured.NestedString(obj.Object, "status", "nodeRef", "name")
+		m.Version, _, _ = unstructured.NestedString(obj.Object, "spec", "version")
+
+		// The reason of the Ready condition is the one of the condition holding it back
+		for _, c := range m.Conditions {
+			if c.Type != "Ready" {
+				continue
+			}
+			m.Ready = c.Status == "True"
+			m.Reason = c.Reason
+		}
+		machines = append(machines, m)
+	}
+
+	sort.Slice(machines, func(i, j int) bool {
+		if machines[i].Role != machines[j].Role {
+			return machines[i].Role == "control-plane"
+		}
+		return machines[i].Name < machines[j].Name
+	})
+	return machines, nil
+}
+
+// getApplications returns the Argo CD Applications in the namespace, sorted by name
+func getApplications(kubeconfig string, namespace string) ([]Application, error) {
+	dyn, err := newDynamicClient(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	list, err := dyn.Resource(applicationGVR).Namespace(namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	apps := []Application{}
+	for _, obj := range list.Items {
+		a := Application{Name: obj.GetName()}
+		a.Sync, _, _ = unstructured.NestedString(obj.Object, "status", "sync", "status")
+		a.Health, _, _ = unstructured.NestedString(obj.Object, "status", "health", "status")
+		a.Revision, _, _ = unstructured.NestedString(obj.Object, "status", "sync", "revision")
+		apps = append(apps, a)
+	}
+
+	sort.Slice(apps, func(i, j int) bool { return apps[i].Name < apps[j].Name })
+	return apps, nil
+}
+
+// conditions returns the conditions in the status of the CAPI object
+func conditions(obj *unstructured.Unstructured) []Condition {
+	list, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	conds := []Condition{}
+	for _, item := range list {
+		c, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		cond := Condition{Object: obj.GetKind() + "/" + obj.GetName()}
+		cond.Type, _, _ = unstructured.NestedString(c, "type")
+		cond.Status, _, _ = unstructured.NestedString(c, "status")
+		cond.Severity, _, _ = unstructured.NestedString(c, "severity")
+		cond.Reason, _, _ = unstructured.NestedString(c, "reason")
+		cond.Message, _, _ = unstructured.NestedString(c, "message")
+		conds = append(conds, cond)
+	}
+	return conds
+}
@@ -0,0 +1,123 @@
+package status
+
+import (
+	"context"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Timeout is how long we wait on the API server of a cluster before calling it unreachable
+var Timeout time.Duration = 10 * time.Second
+
+// The health of a cluster. Clusters that aren't managed by CAPI, like adopted ones, are Unmanaged
+const (
+	Healthy     = "Healthy"
+	Degraded    = "Degraded"
+	Unreachable = "Unreachable"
+	Unmanaged   = "Unmanaged"
+)
+
+// CAPI resources the status is made up from
+var (
+	clusterGVR             = schema.GroupVersionResource{Group: "cluster.x-k8s.io", Version: "v1beta1", Resource: "clusters"}
+	kubeadmControlPlaneGVR = schema.GroupVersionResource{Group: "controlplane.cluster.x-k8s.io", Version: "v1beta1", Resource: "kubeadmcontrolplanes"}
+	machineDeploymentGVR   = schema.GroupVersionResource{Group: "cluster.x-k8s.io", Version: "v1beta1", Resource: "machinedeployments"}
+)
+
+// ClusterStatus is the state of a cluster according to its CAPI objects, which live on the cluster itself once
+// it's self-managed
+type ClusterStatus struct {
+	KubernetesVersion    string `json:"kubernetesVersion,omitempty"`
+	Phase                string `json:"phase,omitempty"`
+	ControlPlaneReady    int64  `json:"controlPlaneReady"`
+	ControlPlaneReplicas int64  `json:"controlPlaneReplicas"`
+	WorkersReady         int64  `json:"workersReady"`
+	WorkersReplicas      int64  `json:"workersReplicas"`
+	Health               string `json:"health"`
+	Error                string `json:"error,omitempty"`
+}
+
+// Get returns the status of the cluster with the name from the CAPI objects on the cluster of the kubeconfig. A
+// cluster that can't be reached isn't an error, its Health says so instead
+func Get(kubeconfig string, clusterName string) *ClusterStatus {
+	s := &ClusterStatus{Health: Unreachable}
+	err := s.load(kubeconfig, clusterName)
+	if apierrors.IsNotFound(err) {
+		s.Health = Unmanaged
+		return s
+	}
+	if err != nil {
+		s.Error = err.Error()
+		return s
+	}
+
+	// If we're here, we could see it
+	s.Health = Healthy
+	if s.Phase != "Provisioned" || s.ControlPlaneReady < s.ControlPlaneReplicas || s.WorkersReady < s.WorkersReplicas {
+		s.Health = Degraded
+	}
+	return s
+}
+
+// load fills in the status from the CAPI objects
+func (s *ClusterStatus) load(kubeconfig string, clusterName string) error {
+	dyn, err := newDynamicClient(kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	cluster, err := dyn.Resource(clusterGVR).Namespace("default").Get(context.TODO(), clusterName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	s.Phase, _, _ = unstructured.NestedString(cluster.Object, "status", "phase")
+
+	// The control plane has the version the cluster is on
+	kcpName, _, _ := unstructured.NestedString(cluster.Object, "spec", "controlPlaneRef", "name")
+	if kcpName != "" {
+		kcp, err := dyn.Resource(kubeadmControlPlaneGVR).Namespace("default").Get(context.TODO(), kcpName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		s.KubernetesVersion, _, _ = unstructured.NestedString(kcp.Object, "spec", "version")
+		s.ControlPlaneReplicas = nestedInt64(kcp.Object, "spec", "replicas")
+		s.ControlPlaneReady = nestedInt64(kcp.Object, "status", "readyReplicas")
+	}
+
+	mds, err := dyn.Resource(machineDeploymentGVR).Namespace("default").List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	for _, md := range mds.Items {
+		if name, _, _ := unstructured.NestedString(md.Object, "spec", "clusterName"); name != clusterName {
+			continue
+		}
+		s.WorkersReplicas += nestedInt64(md.Object, "spec", "replicas")
+		s.WorkersReady += nestedInt64(md.Object, "status", "readyReplicas")
+	}
+
+	// If we're here, we should be okay
+	return nil
+}
+
+// newDynamicClient returns a client for the cluster of the kubeconfig that gives up after the Timeout
+func newDynamicClient(kubeconfig string) (dynamic.Interface, error) {
+	cfg, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Timeout = Timeout
+	return dynamic.NewForConfig(cfg)
+}
+
+// nestedInt64 returns the number at the path, or 0 if it's not there
+func nestedInt64(obj map[string]interface{}, fields ...string) int64 {
+	n, _, _ := unstructured.NestedInt64(obj, fields...)
+	return n
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/christianh814/gokp/cmd/templatevars"
+	"github.com/christianh814/gokp/cmd/utils"
+	"github.com/spf13/viper"
+)
+
+// setTemplateFunctions registers the "templateFunctions" of the config file, so the templates GOKP writes and the
+// templateVariables can follow the naming conventions of the organization
+func setTemplateFunctions() error {
+	if !viper.IsSet("templateFunctions") {
+		return nil
+	}
+	err := utils.SetTemplateFuncs(viper.GetStringMapString("templateFunctions"))
+	if err != nil {
+		return errors.New("templateFunctions in the config file: " + err.Error())
+	}
+
+	// If we're here, we should be okay
+	return nil
+}
+
+// setTemplateVariables exports the "templateVariables" of the config file so clusterctl uses them when
+// rendering the cluster template. Values can use the templateFunctions of the config file, and reference SSM
+// Parameter Store ("ssm:/path/to/param") or Secrets Manager ("secretsmanager:name" or "secretsmanager:name#key"),
+// which are resolved here
+func setTemplateVariables(region string, accessKey string, secretKey string) error {
+	vars := map[string]string{}
+	for k, v := range viper.GetStringMapString("templateVariables") {
+		rendered, err := utils.RenderTemplate(v, nil)
+		if err != nil {
+			return errors.New("bad template variable " + strings.ToUpper(k) + ": " + err.Error())
+		}
+		// viper lowercases keys but clusterctl variables are uppercase
+		vars[strings.ToUpper(k)] = rendered
+	}
+	if len(vars) == 0 {
+		return nil
+	}
+
+	resolved, err := templatevars.Resolve(vars, region, accessKey, secretKey)
+	if err != nil {
+		return err
+	}
+	for k, v := range resolved {
+		os.Setenv(k, v)
+	}
+
+	return nil
+}
@@ -7,22 +7,142 @@ import (
 
 	log "github.com/sirupsen/logrus"
 
-	"github.com/christianh814/gokp/cmd/github"
+	"github.com/christianh814/gokp/cmd/gitutils"
+	"github.com/christianh814/gokp/cmd/sops"
 	"github.com/christianh814/gokp/cmd/utils"
 )
 
+// ArgoCDVersion is the Argo CD release (a tag like v2.4.7, or "stable") that gets installed
+var ArgoCDVersion string = "stable"
+
+// ArgoCDHA installs the HA manifests of Argo CD (redis-ha, and more than one of each controller)
+var ArgoCDHA bool = false
+
+// ArgoCDNamespace is the namespace Argo CD is installed into
+var ArgoCDNamespace string = "argocd"
+
+// ArgoCDInstance is the name of the Argo CD instance, for clusters that will have more than one. If set, the
+// cluster scoped resources of Argo CD get it as a suffix so they don't clash with those of other instances
+var ArgoCDInstance string = ""
+
+// SOPS encrypts the secrets written into the repo (the credentials of the repo, and the OIDC and notifications
+// secrets of Argo CD) with SOPS, for an age key generated in the workdir, instead of leaving them base64 encoded
+var SOPS bool = false
+
+// SkipPush leaves the skeleton repo structure in the local clone instead of pushing it, for a dry run
+var SkipPush bool = false
+
+// BootstrapResources are the requests/limits and PriorityClass given to the Argo CD workloads so they aren't
+// evicted under pressure on small clusters. If nil, the upstream manifests are left as is
+var BootstrapResources *ResourceConfig = &ResourceConfig{
+	CPURequest:    "100m",
+	MemoryRequest: "128Mi",
+	MemoryLimit:   "1Gi",
+	PriorityClass: "system-cluster-critical",
+}
+
+// ResourceConfig is the requests/limits and PriorityClass patched into the workloads
+type ResourceConfig struct {
+	CPURequest    string
+	MemoryRequest string
+	// MemoryLimit is left off if empty. There's no CPU limit so nothing gets throttled
+	MemoryLimit string
+	// PriorityClass is left off if empty
+	PriorityClass string
+}
+
+// ArgoCDExpose is how the Argo CD UI is exposed outside of the cluster. If nil, it's only reachable with a port-forward
+var ArgoCDExpose *ExposeConfig
+
+// ExposeConfig is how the Argo CD UI is exposed
+type ExposeConfig struct {
+	// Type is either "ingress" or "loadbalancer"
+	Type string
+	// Host, IngressClass, and TLSSecret are for the Ingress. TLS is terminated at the Ingress controller, so
+	// argocd-server runs without TLS
+	Host         string
+	IngressClass string
+	TLSSecret    string
+}
+
+// ArgoCDOIDC is the OIDC provider Argo CD logs in with. If nil, Argo CD is left with only the admin user
+var ArgoCDOIDC *OIDCConfig
+
+// OIDCConfig is how Argo CD logs in with an OIDC provider
+type OIDCConfig struct {
+	// URL is the external URL of Argo CD, which the provider redirects back to
+	URL          string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// GroupsClaim is the claim of the ID token that has the groups of the user in it
+	GroupsClaim string
+	// AdminGroups are the groups that get the admin role, everyone else gets read only
+	AdminGroups []string
+}
+
+// ArgoCDNotifications is where argocd-notifications sends word about the apps. If nil, it's left unconfigured
+var ArgoCDNotifications *NotificationsConfig
+
+// NotificationsConfig is how argocd-notifications is set up. Every app is subscribed to the triggers
+type NotificationsConfig struct {
+	SlackToken   string
+	SlackChannel string
+	// WebhookURL gets a JSON POST for every notification
+	WebhookURL string
+	Triggers   []NotificationTrigger
+}
+
+// NotificationTrigger is an argocd-notifications trigger along with the message it sends. The When and Message
+// are expressions/templates of argocd-notifications itself, so they're written out as is
+type NotificationTrigger struct {
+	Name        string
+	Description string
+	When        string
+	Message     string
+}
+
+// NotificationTriggers are the triggers that can be turned on for ArgoCDNotifications
+var NotificationTriggers = map[string]NotificationTrigger{
+	"on-sync-failed": {
+		Name:        "on-sync-failed",
+		Description: "Application syncing has failed",
+		When:        "app.status.operationState.phase in ['Error', 'Failed']",
+		Message:     "Sync of application {{.app.metadata.name}} has failed: {{.app.status.operationState.message}}",
+	},
+	"on-health-degraded": {
+		Name:        "on-health-degraded",
+		Description: "Application has degraded",
+		When:        "app.status.health.status == 'Degraded'",
+		Message:     "Application {{.app.metadata.name}} has degraded.",
+	},
+	"on-sync-status-unknown": {
+		Name:        "on-sync-status-unknown",
+		Description: "Application status is 'Unknown'",
+		When:        "app.status.sync.status == 'Unknown'",
+		Message:     "Sync status of application {{.app.metadata.name}} is unknown.",
+	},
+	"on-sync-succeeded": {
+		Name:        "on-sync-succeeded",
+		Description: "Application syncing has succeeded",
+		When:        "app.status.operationState.phase in ['Succeeded']",
+		Message:     "Application {{.app.metadata.name}} has been successfully synced.",
+	},
+}
+
 // CreateArgoRepoSkel creates the skeleton repo structure at the given place
 func CreateArgoRepoSkel(name *string, workdir string, ghtoken string, gitopsrepo string, private *bool) (bool, error) {
 	// Repo Dir should be our workdir + the name of our cluster
 	repoDir := workdir + "/" + *name
 	directories := []string{
-		repoDir + "/" + "cluster/bootstrap/base/",
-		repoDir + "/" + "cluster/bootstrap/overlays/",
-		repoDir + "/" + "cluster/bootstrap/overlays/default",
-		repoDir + "/" + "cluster/components/applicationsets/",
-		repoDir + "/" + "cluster/components/argocdproj/",
-		repoDir + "/" + "cluster/core/argocd/",
-		repoDir + "/" + "cluster/tenants/kuard/",
+		"cluster/bootstrap/base/",
+		"cluster/bootstrap/overlays/",
+		"cluster/bootstrap/overlays/default",
+		"cluster/components/applicationsets/",
+		"cluster/components/argocdproj/",
+		"cluster/core/argocd/",
+		"cluster/tenants/kuard/",
+		"cluster/fleet/",
 	}
 
 	// check if the dir is there. If not, error out
@@ -32,17 +152,25 @@ func CreateArgoRepoSkel(name *string, workdir string, ghtoken string, gitopsrepo
 
 	// Create directories
 	log.Info("Creating skeleton repo structure")
-	for _, dir := range directories {
+	for _, reldir := range directories {
+		// directories are relative to where the "cluster" dir lives in the repo
+		dir := gitutils.BaseDir(repoDir) + "/" + reldir
 		os.MkdirAll(dir, 0755)
 
 		// Lot's of ifs coming your way
 		//	Check to see if I need to install argocd install kustomization
-		if strings.Contains(dir, "bootstrap") && strings.Contains(dir, "base") {
+		if strings.Contains(reldir, "bootstrap") && strings.Contains(reldir, "base") {
 			// Set up the vars to go into the template
 			argocdinstall := struct {
-				ArgocdVer string
+				ArgocdVer     string
+				HA            bool
+				ArgoNamespace string
+				Instance      string
 			}{
-				ArgocdVer: "stable",
+				ArgocdVer:     ArgoCDVersion,
+				HA:            ArgoCDHA,
+				ArgoNamespace: ArgoCDNamespace,
+				Instance:      ArgoCDInstance,
 			}
 
 			// Write out the kustomization file based on the vars and the template
@@ -58,52 +186,175 @@ func CreateArgoRepoSkel(name *string, workdir string, ghtoken string, gitopsrepo
 				return false, err
 			}
 
+			// Keep the cluster scoped resources of this instance apart from those of other instances
+			if ArgoCDInstance != "" {
+				_, err = utils.WriteTemplate(ArgoCdInstanceSuffixTransformer, dir+"/"+"instance-suffix.yaml", argocdinstall)
+				if err != nil {
+					return false, err
+				}
+			}
+
 		}
 
 		//	Check to see if I need to install the ArgoCD Overlays
-		if strings.Contains(dir, "bootstrap") && strings.Contains(dir, "overlays") && strings.Contains(dir, "default") {
-			// setup dummy values because the func needs it
-			dummyVars := struct {
-				Dummykey string
+		if strings.Contains(reldir, "bootstrap") && strings.Contains(reldir, "overlays") && strings.Contains(reldir, "default") {
+			// Argo CD only knows the host keys of the big git providers, so we give it the ones
+			// of the host the repo is on (e.g. GitHub Enterprise Server) when it's talked to over SSH
+			_, _, isHttps := gitutils.GetHTTPCredentials(gitopsrepo)
+			overlayVars := struct {
+				SSHKnownHosts []string
+				ArgocdVer     string
+				OIDC          *OIDCConfig
+				Resources     *ResourceConfig
+				Expose        *ExposeConfig
+				Notifications *NotificationsConfig
+				ArgoNamespace string
+				Instance      string
+				SOPS          bool
+				RepoSecret    bool
 			}{
-				Dummykey: "unused",
+				ArgocdVer:     ArgoCDVersion,
+				OIDC:          ArgoCDOIDC,
+				Resources:     BootstrapResources,
+				Expose:        ArgoCDExpose,
+				Notifications: ArgoCDNotifications,
+				ArgoNamespace: ArgoCDNamespace,
+				Instance:      ArgoCDInstance,
+				SOPS:          SOPS,
+				// The secret of the repo is applied by us when it's encrypted, and isn't there for HTTPS repos
+				RepoSecret: !SOPS && !isHttps,
+			}
+			if !isHttps && !gitutils.IsGitHub(gitopsrepo) {
+				knownHosts, err := gitutils.KnownHosts(gitopsrepo)
+				if err != nil {
+					return false, err
+				}
+				overlayVars.SSHKnownHosts = strings.Split(knownHosts, "\n")
+
+				_, err = utils.WriteTemplate(ArgoCdOverlayDefaultKnownHosts, dir+"/"+"argocd-ssh-known-hosts-cm.yaml", overlayVars)
+				if err != nil {
+					return false, err
+				}
 			}
 
 			// Write out the kustomization file based on the vars and the template
-			_, err := utils.WriteTemplate(ArgoCdOverlayDefaultKustomize, dir+"/"+"kustomization.yaml", dummyVars)
+			_, err := utils.WriteTemplate(ArgoCdOverlayDefaultKustomize, dir+"/"+"kustomization.yaml", overlayVars)
 			if err != nil {
 				return false, err
 			}
 
 			// Write out the argocd configmap based on the vars and template
-			_, err = utils.WriteTemplate(ArgoCdOverlayDefaultConfigMap, dir+"/"+"argocd-cm.yaml", dummyVars)
+			_, err = utils.WriteTemplate(ArgoCdOverlayDefaultConfigMap, dir+"/"+"argocd-cm.yaml", overlayVars)
 			if err != nil {
 				return false, err
 			}
 
-			// Write out the argocd secret of the repo based on the vars and template
-			sshKeyFile, err := utils.B64EncodeFile(workdir + "/" + *name + "_rsa")
-			if err != nil {
-				return false, err
-			}
-			githubInfo := struct {
-				ClusterGitOpsRepo string
-				SSHPrivateKey     string
-				//IsPrivate         bool
-			}{
-				ClusterGitOpsRepo: base64.StdEncoding.EncodeToString([]byte(gitopsrepo)),
-				SSHPrivateKey:     sshKeyFile,
-				//GitHubToken:       ghtoken,
-				//IsPrivate:         *private,
-			}
-			_, err = utils.WriteTemplate(ArgoCdOverlayDefaultRepoSecret, dir+"/"+"repo-secret.yaml", githubInfo)
-			if err != nil {
-				return false, err
+			// Write out what's needed to reach the UI from outside of the cluster if it was asked for
+			if ArgoCDExpose != nil && ArgoCDExpose.Type == "ingress" {
+				_, err = utils.WriteTemplate(ArgoCdOverlayDefaultIngress, dir+"/"+"argocd-server-ingress.yaml", overlayVars)
+				if err != nil {
+					return false, err
+				}
+				_, err = utils.WriteTemplate(ArgoCdOverlayDefaultCmdParams, dir+"/"+"argocd-cmd-params-cm.yaml", overlayVars)
+				if err != nil {
+					return false, err
+				}
+			} else if ArgoCDExpose != nil {
+				_, err = utils.WriteTemplate(ArgoCdOverlayDefaultServerService, dir+"/"+"argocd-server-svc.yaml", overlayVars)
+				if err != nil {
+					return false, err
+				}
+			}
+
+			// Write out the RBAC policy and client secret for SSO if it was asked for
+			if ArgoCDOIDC != nil {
+				rbacVars := struct {
+					*OIDCConfig
+					ArgoNamespace string
+				}{
+					OIDCConfig:    ArgoCDOIDC,
+					ArgoNamespace: ArgoCDNamespace,
+				}
+				_, err = utils.WriteTemplate(ArgoCdOverlayDefaultRbacConfigMap, dir+"/"+"argocd-rbac-cm.yaml", rbacVars)
+				if err != nil {
+					return false, err
+				}
+
+				oidcSecret := struct {
+					ClientSecret  string
+					ArgoNamespace string
+				}{
+					ClientSecret:  base64.StdEncoding.EncodeToString([]byte(ArgoCDOIDC.ClientSecret)),
+					ArgoNamespace: ArgoCDNamespace,
+				}
+				_, err = utils.WriteTemplate(ArgoCdOverlayDefaultOIDCSecret, dir+"/"+"argocd-secret.yaml", oidcSecret)
+				if err != nil {
+					return false, err
+				}
+			}
+
+			// Write out where argocd-notifications sends to if it was asked for
+			if ArgoCDNotifications != nil {
+				notificationsVars := struct {
+					*NotificationsConfig
+					ArgoNamespace string
+				}{
+					NotificationsConfig: ArgoCDNotifications,
+					ArgoNamespace:       ArgoCDNamespace,
+				}
+				_, err = utils.WriteTemplate(ArgoCdOverlayDefaultNotificationsConfigMap, dir+"/"+"argocd-notifications-cm.yaml", notificationsVars)
+				if err != nil {
+					return false, err
+				}
+
+				notificationsSecret := struct {
+					SlackToken    string
+					WebhookURL    string
+					ArgoNamespace string
+				}{
+					ArgoNamespace: ArgoCDNamespace,
+				}
+				if ArgoCDNotifications.SlackToken != "" {
+					notificationsSecret.SlackToken = base64.StdEncoding.EncodeToString([]byte(ArgoCDNotifications.SlackToken))
+				}
+				if ArgoCDNotifications.WebhookURL != "" {
+					notificationsSecret.WebhookURL = base64.StdEncoding.EncodeToString([]byte(ArgoCDNotifications.WebhookURL))
+				}
+				_, err = utils.WriteTemplate(ArgoCdOverlayDefaultNotificationsSecret, dir+"/"+"argocd-notifications-secret.yaml", notificationsSecret)
+				if err != nil {
+					return false, err
+				}
+			}
+
+			// Write out the argocd secret of the repo based on the vars and template. The credentials of repos we
+			// talk to over HTTPS would let anyone who can read the repo push to it, so they never go into it, they're
+			// put on the cluster before Argo CD is deployed
+			if _, _, isHttps := gitutils.GetHTTPCredentials(gitopsrepo); !isHttps {
+				sshKeyFile, err := utils.B64EncodeFile(workdir + "/" + *name + "_rsa")
+				if err != nil {
+					return false, err
+				}
+				githubInfo := struct {
+					ClusterGitOpsRepo string
+					SSHPrivateKey     string
+					ArgoNamespace     string
+					//IsPrivate         bool
+				}{
+					ClusterGitOpsRepo: base64.StdEncoding.EncodeToString([]byte(gitopsrepo)),
+					SSHPrivateKey:     sshKeyFile,
+					ArgoNamespace:     ArgoCDNamespace,
+					//GitHubToken:       ghtoken,
+					//IsPrivate:         *private,
+				}
+				_, err = utils.WriteTemplate(ArgoCdOverlayDefaultRepoSecret, dir+"/"+"repo-secret.yaml", githubInfo)
+				if err != nil {
+					return false, err
+				}
 			}
 
 		}
 		//	Now we move on to the components with appsets
-		if strings.Contains(dir, "components") && strings.Contains(dir, "applicationsets") {
+		if strings.Contains(reldir, "components") && strings.Contains(reldir, "applicationsets") {
 			// setup dummy values because the func needs it
 			dummyVars := struct {
 				Dummykey string
@@ -120,12 +371,22 @@ func CreateArgoRepoSkel(name *string, workdir string, ghtoken string, gitopsrepo
 			// Write out the application set based on the vars and template
 			githubInfo := struct {
 				ClusterGitOpsRepo string
+				ClusterPath       string
+				GitBranch         string
 				RawPathBasename   string
 				RawPath           string
+				RawFleetAppName   string
+				RawServer         string
+				ArgoNamespace     string
 			}{
 				ClusterGitOpsRepo: gitopsrepo,
+				ClusterPath:       gitutils.ClusterPath(),
+				GitBranch:         gitutils.Branch,
 				RawPathBasename:   `'{{path.basename}}'`,
 				RawPath:           `'{{path}}'`,
+				RawFleetAppName:   `'{{path.basename}}-{{name}}'`,
+				RawServer:         `'{{server}}'`,
+				ArgoNamespace:     ArgoCDNamespace,
 			}
 
 			_, err = utils.WriteTemplate(ArgoCdClusterComponentApplicationSet, dir+"/"+"cluster-components.yaml", githubInfo)
@@ -138,25 +399,31 @@ func CreateArgoRepoSkel(name *string, workdir string, ghtoken string, gitopsrepo
 				return false, err
 			}
 
+			// Apps under fleet/ go out to every cluster Argo CD manages, not just this one
+			_, err = utils.WriteTemplate(ArgoCdFleetApplicationSet, dir+"/"+"fleet.yaml", githubInfo)
+			if err != nil {
+				return false, err
+			}
+
 		}
 
 		//	Components  with argo projects
-		if strings.Contains(dir, "components") && strings.Contains(dir, "argocdproj") {
+		if strings.Contains(reldir, "components") && strings.Contains(reldir, "argocdproj") {
 
-			dummyVars := struct {
-				Dummykey string
+			projectVars := struct {
+				ArgoNamespace string
 			}{
-				Dummykey: "unused",
+				ArgoNamespace: ArgoCDNamespace,
 			}
 
 			// Write out the kustomization file based on the vars and the template
-			_, err := utils.WriteTemplate(ArgoCdComponentsArgoProjKustomize, dir+"/"+"kustomization.yaml", dummyVars)
+			_, err := utils.WriteTemplate(ArgoCdComponentsArgoProjKustomize, dir+"/"+"kustomization.yaml", projectVars)
 			if err != nil {
 				return false, err
 			}
 
 			// Write out the cluster argocd project file based on the vars and the template
-			_, err = utils.WriteTemplate(ArgoCdComponentsArgoProjProject, dir+"/"+"cluster.yaml", dummyVars)
+			_, err = utils.WriteTemplate(ArgoCdComponentsArgoProjProject, dir+"/"+"cluster.yaml", projectVars)
 			if err != nil {
 				return false, err
 			}
@@ -164,7 +431,7 @@ func CreateArgoRepoSkel(name *string, workdir string, ghtoken string, gitopsrepo
 		}
 
 		//	Core
-		if strings.Contains(dir, "core") && strings.Contains(dir, "argocd") {
+		if strings.Contains(reldir, "core") && strings.Contains(reldir, "argocd") {
 
 			// dummy vars for now
 			dummyVars := struct {
@@ -180,7 +447,24 @@ func CreateArgoRepoSkel(name *string, workdir string, ghtoken string, gitopsrepo
 			}
 
 		}
-		if strings.Contains(dir, "kuard") {
+		//	Apps for every cluster
+		if strings.Contains(reldir, "fleet") {
+
+			// dummy vars for now
+			dummyVars := struct {
+				Dummykey string
+			}{
+				Dummykey: "unused",
+			}
+
+			// Git doesn't keep empty dirs, so say what the dir is for
+			_, err := utils.WriteTemplate(ArgoCdFleetReadme, dir+"/"+"README.md", dummyVars)
+			if err != nil {
+				return false, err
+			}
+
+		}
+		if strings.Contains(reldir, "kuard") {
 
 			// dummy vars for now
 			dummyVars := struct {
@@ -211,10 +495,27 @@ func CreateArgoRepoSkel(name *string, workdir string, ghtoken string, gitopsrepo
 
 	}
 
+	// Encrypt the secrets before they go anywhere
+	if SOPS {
+		overlay := gitutils.BaseDir(repoDir) + "/cluster/bootstrap/overlays/default/"
+		err := encryptRepoSecrets(workdir, repoDir, []string{
+			overlay + "repo-secret.yaml",
+			overlay + "argocd-secret.yaml",
+			overlay + "argocd-notifications-secret.yaml",
+		})
+		if err != nil {
+			return false, err
+		}
+	}
+
 	// Commit and push initialize skel
+	if SkipPush {
+		log.Info("Not pushing the skel repo structure")
+		return true, nil
+	}
 	log.Info("Pushing initial skel repo structure")
 	privateKeyFile := workdir + "/" + *name + "_rsa"
-	_, err := github.CommitAndPush(repoDir, privateKeyFile, "initializing skel repo structure")
+	_, err := gitutils.CommitAndPush(repoDir, privateKeyFile, "initializing skel repo structure")
 	if err != nil {
 		return false, err
 	}
@@ -227,9 +528,9 @@ func CreateFluxRepoSkel(name *string, workdir string, ghtoken string, gitopsrepo
 	// Repo Dir should be our workdir + the name of our cluster
 	repoDir := workdir + "/" + *name
 	directories := []string{
-		repoDir + "/" + "cluster/core/flux-system/",
-		repoDir + "/" + "cluster/core/cluster-extras/",
-		repoDir + "/" + "cluster/tenants/kuard/",
+		"cluster/core/flux-system/",
+		"cluster/core/cluster-extras/",
+		"cluster/tenants/kuard/",
 	}
 
 	// check if the dir is there. If not, error out
@@ -239,19 +540,26 @@ func CreateFluxRepoSkel(name *string, workdir string, ghtoken string, gitopsrepo
 
 	// Create directories
 	log.Info("Creating skeleton repo structure")
-	for _, dir := range directories {
+	for _, reldir := range directories {
+		// directories are relative to where the "cluster" dir lives in the repo
+		dir := gitutils.BaseDir(repoDir) + "/" + reldir
 		os.MkdirAll(dir, 0755)
 
 		// Lot's of ifs coming your way
 
 		//	flux-system
-		if strings.Contains(dir, "core") && strings.Contains(dir, "flux-system") {
+		if strings.Contains(reldir, "core") && strings.Contains(reldir, "flux-system") {
 
-			// Set the version of Flux we want to install
+			// Set the version of Flux we want to install. The credentials of repos we talk to over HTTPS would let
+			// anyone who can read the repo push to it, so there's no secret of the repo in it then, it's put on the
+			// cluster before Flux is deployed
+			_, _, isHttps := gitutils.GetHTTPCredentials(gitopsrepo)
 			FluxInstallVars := struct {
 				FluxcdVersion string
+				RepoSecret    bool
 			}{
 				FluxcdVersion: "v0.23.0",
+				RepoSecret:    !isHttps,
 			}
 
 			// Write out the flux-system kustomization file based on the vars and the template
@@ -260,28 +568,46 @@ func CreateFluxRepoSkel(name *string, workdir string, ghtoken string, gitopsrepo
 				return false, err
 			}
 
-			// Set the Vars for the git ssh secret
-			privateKeyB64, _ := utils.B64EncodeFile(workdir + "/" + *name + "_rsa")
-			publicKeyB64, _ := utils.B64EncodeFile(workdir + "/" + *name + "_rsa.pub")
-			SshSecretVars := struct {
-				ClusterGitPrivateKey string
-				ClusterGitPublicKey  string
-			}{
-				ClusterGitPrivateKey: privateKeyB64,
-				ClusterGitPublicKey:  publicKeyB64,
-			}
-
-			// Write out the GitRepository file based on the vars and the template
-			_, err = utils.WriteTemplate(FluxGitSshSecret, dir+"/"+"cluster-sshsecret.yaml", SshSecretVars)
-			if err != nil {
-				return false, err
-			}
-
 			// Set the GitRepoURI
 			GitRepoURIVars := struct {
-				GitRepoURI string
+				GitRepoURI        string
+				GitImplementation string
+				GitBranch         string
 			}{
-				GitRepoURI: "ssh://" + strings.ReplaceAll(gitopsrepo, ":", "/"),
+				GitRepoURI: gitutils.SSHURL(gitopsrepo),
+				GitBranch:  gitutils.Branch,
+			}
+
+			// Repos we talk to over HTTPS use the credentials, everything else uses the ssh key
+			if isHttps {
+				// Azure DevOps only works with the libgit2 implementation
+				GitRepoURIVars.GitRepoURI = gitopsrepo
+				if strings.Contains(gitopsrepo, "dev.azure.com") {
+					GitRepoURIVars.GitImplementation = "libgit2"
+				}
+			} else {
+				// Set the Vars for the git ssh secret
+				privateKeyB64, _ := utils.B64EncodeFile(workdir + "/" + *name + "_rsa")
+				publicKeyB64, _ := utils.B64EncodeFile(workdir + "/" + *name + "_rsa.pub")
+				knownHosts, err := gitutils.KnownHosts(gitopsrepo)
+				if err != nil {
+					return false, err
+				}
+				SshSecretVars := struct {
+					ClusterGitPrivateKey string
+					ClusterGitPublicKey  string
+					ClusterGitKnownHosts string
+				}{
+					ClusterGitPrivateKey: privateKeyB64,
+					ClusterGitPublicKey:  publicKeyB64,
+					ClusterGitKnownHosts: base64.StdEncoding.EncodeToString([]byte(knownHosts)),
+				}
+
+				// Write out the GitRepository file based on the vars and the template
+				_, err = utils.WriteTemplate(FluxGitSshSecret, dir+"/"+"cluster-sshsecret.yaml", SshSecretVars)
+				if err != nil {
+					return false, err
+				}
 			}
 
 			// Write out the GitRepository file based on the vars and the template
@@ -297,8 +623,15 @@ func CreateFluxRepoSkel(name *string, workdir string, ghtoken string, gitopsrepo
 				Dummykey: "unused",
 			}
 
-			// Write out the Kustomization file. No vars needed so we dummy them
-			_, err = utils.WriteTemplate(FluxGotkKustomizationFile, dir+"/"+"cluster-kustomization.yaml", dummyVars)
+			// Write out the Kustomization file pointed at where the cluster dir lives in the repo
+			clusterPathVars := struct {
+				ClusterPath string
+				SOPS        bool
+			}{
+				ClusterPath: gitutils.ClusterPath(),
+				SOPS:        SOPS,
+			}
+			_, err = utils.WriteTemplate(FluxGotkKustomizationFile, dir+"/"+"cluster-kustomization.yaml", clusterPathVars)
 			if err != nil {
 				return false, err
 			}
@@ -311,13 +644,17 @@ func CreateFluxRepoSkel(name *string, workdir string, ghtoken string, gitopsrepo
 
 		}
 		//	cluster-extras
-		if strings.Contains(dir, "core") && strings.Contains(dir, "cluster-extras") {
+		if strings.Contains(reldir, "core") && strings.Contains(reldir, "cluster-extras") {
 
 			// Set the version of Flux we want to install
 			FluxInstallVars := struct {
 				FluxcdVersion string
+				ClusterPath   string
+				SOPS          bool
 			}{
 				FluxcdVersion: "v0.23.0",
+				ClusterPath:   gitutils.ClusterPath(),
+				SOPS:          SOPS,
 			}
 
 			// Write out the flux-system kustomization file based on the vars and the template
@@ -329,7 +666,7 @@ func CreateFluxRepoSkel(name *string, workdir string, ghtoken string, gitopsrepo
 		}
 
 		//	Sample workload based on kuard
-		if strings.Contains(dir, "kuard") {
+		if strings.Contains(reldir, "kuard") {
 
 			// dummy vars for now
 			dummyVars := struct {
@@ -360,13 +697,47 @@ func CreateFluxRepoSkel(name *string, workdir string, ghtoken string, gitopsrepo
 
 	}
 
+	// Encrypt the secrets before they go anywhere
+	if SOPS {
+		err := encryptRepoSecrets(workdir, repoDir, []string{
+			gitutils.BaseDir(repoDir) + "/cluster/core/flux-system/cluster-sshsecret.yaml",
+		})
+		if err != nil {
+			return false, err
+		}
+	}
+
 	// Commit and push initialize skel
+	if SkipPush {
+		log.Info("Not pushing the skel repo structure")
+		return true, nil
+	}
 	log.Info("Pushing initial skel repo structure")
 	privateKeyFile := workdir + "/" + *name + "_rsa"
-	_, err := github.CommitAndPush(repoDir, privateKeyFile, "initializing skel repo structure")
+	_, err := gitutils.CommitAndPush(repoDir, privateKeyFile, "initializing skel repo structure")
 	if err != nil {
 		return false, err
 	}
 	// If we're here, everything should be okay
 	return true, nil
 }
+
+// encryptRepoSecrets encrypts the secret files that were written with SOPS, for the age key of the cluster in the
+// workdir, and writes the SOPS config into the repo so secrets added later are encrypted for the same key
+func encryptRepoSecrets(workdir string, repoDir string, files []string) error {
+	log.Info("Encrypting the secrets of the repo with SOPS")
+	recipient, err := sops.EnsureKey(workdir)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if _, err := os.Stat(f); os.IsNotExist(err) {
+			continue
+		}
+		err = sops.EncryptFile(f, recipient)
+		if err != nil {
+			return err
+		}
+	}
+	return sops.WriteConfig(repoDir, recipient)
+}
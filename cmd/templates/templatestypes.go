@@ -4129,7 +4129,9 @@ kind: Kustomization
 resources:
 # - https://github.com/fluxcd/flux2/releases/download/{{.FluxcdVersion}}/install.yaml
 - flux-system.yaml
+{{- if .RepoSecret }}
 - cluster-sshsecret.yaml
+{{- end }}
 - cluster-gitrepo.yaml
 - cluster-kustomization.yaml
 `
@@ -4143,7 +4145,7 @@ metadata:
 data:
   identity: {{.ClusterGitPrivateKey}}
   identity.pub: {{.ClusterGitPublicKey}}
-  known_hosts: Z2l0aHViLmNvbSBlY2RzYS1zaGEyLW5pc3RwMjU2IEFBQUFFMlZqWkhOaExYTm9ZVEl0Ym1semRIQXlOVFlBQUFBSWJtbHpkSEF5TlRZQUFBQkJCRW1LU0VOalFFZXpPbXhrWk15N29wS2d3RkI5bmt0NVlScllNak51RzVOODd1UmdnNkNMcmJvNXdBZFQveTZ2MG1LVjBVMncwV1oyWUIvKytUcG9ja2c9
+  known_hosts: {{.ClusterGitKnownHosts}}
 type: Opaque
 `
 
@@ -4154,8 +4156,11 @@ metadata:
   namespace: flux-system
 spec:
   interval: 1m0s
+{{- if .GitImplementation }}
+  gitImplementation: {{.GitImplementation}}
+{{- end }}
   ref:
-    branch: main
+    branch: {{.GitBranch}}
   secretRef:
     name: flux-system
   url: {{.GitRepoURI}}
@@ -4168,11 +4173,17 @@ metadata:
   namespace: flux-system
 spec:
   interval: 5m0s
-  path: ./cluster/core
+  path: ./{{.ClusterPath}}/core
   prune: true
   sourceRef:
     kind: GitRepository
     name: flux-system
+{{- if .SOPS }}
+  decryption:
+    provider: sops
+    secretRef:
+      name: sops-age
+{{- end }}
 `
 
 var FluxGotkTenantsFile string = `apiVersion: kustomize.toolkit.fluxcd.io/v1beta2
@@ -4182,27 +4193,58 @@ metadata:
   namespace: flux-system
 spec:
   interval: 5m0s
-  path: ./cluster/tenants
+  path: ./{{.ClusterPath}}/tenants
   prune: false
   sourceRef:
     kind: GitRepository
     name: flux-system
+{{- if .SOPS }}
+  decryption:
+    provider: sops
+    secretRef:
+      name: sops-age
+{{- end }}
 `
 
 // ArgoCD Specifc Vars
 var ArgoKustomizeFile string = `apiVersion: kustomize.config.k8s.io/v1beta1
 kind: Kustomization
-namespace: argocd
+namespace: {{.ArgoNamespace}}
 
 resources:
 - argocd-ns.yaml
-- https://raw.githubusercontent.com/argoproj/argo-cd/{{.ArgocdVer}}/manifests/install.yaml
+- https://raw.githubusercontent.com/argoproj/argo-cd/{{.ArgocdVer}}/manifests/{{if .HA}}ha/{{end}}install.yaml
+{{- if ne .ArgoNamespace "argocd" }}
+patches:
+- target:
+    kind: ClusterRoleBinding
+  patch: |-
+    - op: replace
+      path: /subjects/0/namespace
+      value: {{.ArgoNamespace}}
+{{- end }}
+{{- if .Instance }}
+transformers:
+- instance-suffix.yaml
+{{- end }}
+`
+
+var ArgoCdInstanceSuffixTransformer string = `apiVersion: builtin
+kind: PrefixSuffixTransformer
+metadata:
+  name: argocd-instance-suffix
+suffix: -{{.Instance}}
+fieldSpecs:
+- kind: ClusterRole
+  path: metadata/name
+- kind: ClusterRoleBinding
+  path: metadata/name
 `
 
 var ArgoCdNameSpaceFile string = `apiVersion: v1
 kind: Namespace
 metadata:
-  name: argocd
+  name: {{.ArgoNamespace}}
 spec: {}
 status: {}
 `
@@ -4210,10 +4252,80 @@ status: {}
 var ArgoCdOverlayDefaultKustomize string = `apiVersion: kustomize.config.k8s.io/v1beta1
 kind: Kustomization
 
+commonAnnotations:
+  gokp.io/argocd-version: "{{.ArgocdVer}}"
 patchesStrategicMerge:
 - argocd-cm.yaml
+{{- if .SSHKnownHosts }}
+- argocd-ssh-known-hosts-cm.yaml
+{{- end }}
+{{- if .OIDC }}
+- argocd-rbac-cm.yaml
+{{- if not .SOPS }}
+- argocd-secret.yaml
+{{- end }}
+{{- end }}
+{{- if .Notifications }}
+- argocd-notifications-cm.yaml
+{{- if not .SOPS }}
+- argocd-notifications-secret.yaml
+{{- end }}
+{{- end }}
+{{- if .Expose }}
+{{- if eq .Expose.Type "ingress" }}
+- argocd-cmd-params-cm.yaml
+{{- else }}
+- argocd-server-svc.yaml
+{{- end }}
+{{- end }}
+{{- if .Resources }}
+patches:
+- target:
+    kind: Deployment
+  patch: |-
+{{- if .Resources.PriorityClass }}
+    - op: add
+      path: /spec/template/spec/priorityClassName
+      value: {{ .Resources.PriorityClass }}
+{{- end }}
+    - op: add
+      path: /spec/template/spec/containers/0/resources
+      value:
+        requests:
+          cpu: {{ .Resources.CPURequest }}
+          memory: {{ .Resources.MemoryRequest }}
+{{- if .Resources.MemoryLimit }}
+        limits:
+          memory: {{ .Resources.MemoryLimit }}
+{{- end }}
+- target:
+    kind: StatefulSet
+  patch: |-
+{{- if .Resources.PriorityClass }}
+    - op: add
+      path: /spec/template/spec/priorityClassName
+      value: {{ .Resources.PriorityClass }}
+{{- end }}
+    - op: add
+      path: /spec/template/spec/containers/0/resources
+      value:
+        requests:
+          cpu: {{ .Resources.CPURequest }}
+          memory: {{ .Resources.MemoryRequest }}
+{{- if .Resources.MemoryLimit }}
+        limits:
+          memory: {{ .Resources.MemoryLimit }}
+{{- end }}
+{{- end }}
 resources:
+{{- if .RepoSecret }}
 - repo-secret.yaml
+{{- end }}
+{{- if .Expose }}
+{{- if eq .Expose.Type "ingress" }}
+- argocd-server-ingress.yaml
+{{- end }}
+{{- end }}
 bases:
 - ../../base
 - ../../../components/argocdproj
@@ -4227,7 +4339,7 @@ metadata:
     app.kubernetes.io/name: argocd-cm
     app.kubernetes.io/part-of: argocd
   name: argocd-cm
-  namespace: argocd
+  namespace: {{.ArgoNamespace}}
 data:
   resource.customizations: |
     storage.k8s.io/CSINode:
@@ -4238,6 +4350,180 @@ data:
       ignoreDifferences: |
         jsonPointers:
         - /spec/allocations
+{{- if .Instance }}
+  application.instanceLabelKey: argocd.argoproj.io/instance-{{.Instance}}
+{{- end }}
+{{- if .OIDC }}
+  url: {{.OIDC.URL}}
+  oidc.config: |
+    name: SSO
+    issuer: {{.OIDC.Issuer}}
+    clientID: {{.OIDC.ClientID}}
+    clientSecret: $oidc.clientSecret
+    requestedScopes: ["openid", "profile", "email", "{{.OIDC.GroupsClaim}}"]
+    requestedIDTokenClaims: {"{{.OIDC.GroupsClaim}}": {"essential": true}}
+{{- end }}
+`
+
+var ArgoCdOverlayDefaultRbacConfigMap string = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  labels:
+    app.kubernetes.io/name: argocd-rbac-cm
+    app.kubernetes.io/part-of: argocd
+  name: argocd-rbac-cm
+  namespace: {{.ArgoNamespace}}
+data:
+  policy.default: role:readonly
+  policy.csv: |
+{{- range .AdminGroups }}
+    g, {{ . }}, role:admin
+{{- end }}
+  scopes: '[{{.GroupsClaim}}]'
+`
+
+var ArgoCdOverlayDefaultOIDCSecret string = `apiVersion: v1
+kind: Secret
+metadata:
+  labels:
+    app.kubernetes.io/name: argocd-secret
+    app.kubernetes.io/part-of: argocd
+  name: argocd-secret
+  namespace: {{.ArgoNamespace}}
+type: Opaque
+data:
+  oidc.clientSecret: {{.ClientSecret}}
+`
+
+var ArgoCdOverlayDefaultNotificationsConfigMap string = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  labels:
+    app.kubernetes.io/name: argocd-notifications-cm
+    app.kubernetes.io/part-of: argocd
+  name: argocd-notifications-cm
+  namespace: {{.ArgoNamespace}}
+data:
+{{- if .SlackToken }}
+  service.slack: |
+    token: $slack-token
+{{- end }}
+{{- if .WebhookURL }}
+  service.webhook.gokp: |
+    url: $webhook-url
+    headers:
+    - name: Content-Type
+      value: application/json
+{{- end }}
+{{- range .Triggers }}
+  trigger.{{ .Name }}: |
+    - description: {{ .Description }}
+      send:
+      - {{ .Name }}
+      when: {{ .When }}
+  template.{{ .Name }}: |
+    message: |
+      {{ .Message }}
+    webhook:
+      gokp:
+        method: POST
+        body: |
+          {"app": "{{"{{"}}.app.metadata.name{{"}}"}}", "trigger": "{{ .Name }}", "sync": "{{"{{"}}.app.status.sync.status{{"}}"}}", "health": "{{"{{"}}.app.status.health.status{{"}}"}}"}
+{{- end }}
+  subscriptions: |
+    - recipients:
+{{- if .SlackToken }}
+      - slack:{{ .SlackChannel }}
+{{- end }}
+{{- if .WebhookURL }}
+      - gokp
+{{- end }}
+      triggers:
+{{- range .Triggers }}
+      - {{ .Name }}
+{{- end }}
+`
+
+var ArgoCdOverlayDefaultNotificationsSecret string = `apiVersion: v1
+kind: Secret
+metadata:
+  labels:
+    app.kubernetes.io/name: argocd-notifications-secret
+    app.kubernetes.io/part-of: argocd
+  name: argocd-notifications-secret
+  namespace: {{.ArgoNamespace}}
+type: Opaque
+data:
+{{- if .SlackToken }}
+  slack-token: {{.SlackToken}}
+{{- end }}
+{{- if .WebhookURL }}
+  webhook-url: {{.WebhookURL}}
+{{- end }}
+`
+
+var ArgoCdOverlayDefaultCmdParams string = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  labels:
+    app.kubernetes.io/name: argocd-cmd-params-cm
+    app.kubernetes.io/part-of: argocd
+  name: argocd-cmd-params-cm
+  namespace: {{.ArgoNamespace}}
+data:
+  server.insecure: "true"
+`
+
+var ArgoCdOverlayDefaultIngress string = `apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: argocd-server
+  namespace: {{.ArgoNamespace}}
+spec:
+{{- if .Expose.IngressClass }}
+  ingressClassName: {{.Expose.IngressClass}}
+{{- end }}
+  rules:
+  - host: {{.Expose.Host}}
+    http:
+      paths:
+      - path: /
+        pathType: Prefix
+        backend:
+          service:
+            name: argocd-server
+            port:
+              name: http
+{{- if .Expose.TLSSecret }}
+  tls:
+  - hosts:
+    - {{.Expose.Host}}
+    secretName: {{.Expose.TLSSecret}}
+{{- end }}
+`
+
+var ArgoCdOverlayDefaultServerService string = `apiVersion: v1
+kind: Service
+metadata:
+  name: argocd-server
+  namespace: {{.ArgoNamespace}}
+spec:
+  type: LoadBalancer
+`
+
+var ArgoCdOverlayDefaultKnownHosts string = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  labels:
+    app.kubernetes.io/name: argocd-ssh-known-hosts-cm
+    app.kubernetes.io/part-of: argocd
+  name: argocd-ssh-known-hosts-cm
+  namespace: {{.ArgoNamespace}}
+data:
+  ssh_known_hosts: |
+{{- range .SSHKnownHosts }}
+    {{ . }}
+{{- end }}
 `
 
 /*
@@ -4245,7 +4531,7 @@ var ArgoCdOverlayDefaultRepoSecret string = `apiVersion: v1
 kind: Secret
 metadata:
   name: cluster-repo
-  namespace: argocd
+  namespace: {{.ArgoNamespace}}
   labels:
     argocd.argoproj.io/secret-type: repository
 stringData:
@@ -4261,7 +4547,7 @@ var ArgoCdOverlayDefaultRepoSecret string = `apiVersion: v1
 kind: Secret
 metadata:
   name: cluster-repo
-  namespace: argocd
+  namespace: {{.ArgoNamespace}}
   labels:
     argocd.argoproj.io/secret-type: repository
 type: Opaque
@@ -4274,6 +4560,7 @@ data:
 var ArgoCdComponetnsApplicationSetKustomize string = `resources:
 - cluster-components.yaml
 - tenants.yaml
+- fleet.yaml
 `
 var ArgoCdComponentsArgoProjKustomize string = `resources:
 - cluster.yaml
@@ -4284,14 +4571,14 @@ apiVersion: argoproj.io/v1alpha1
 kind: ApplicationSet
 metadata:
   name: cluster
-  namespace: argocd
+  namespace: {{.ArgoNamespace}}
 spec:
   generators:
   - git:
       repoURL: {{.ClusterGitOpsRepo}}
-      revision: main
+      revision: {{.GitBranch}}
       directories:
-      - path: cluster/core/*
+      - path: {{.ClusterPath}}/core/*
   template:
     metadata:
       name: {{.RawPathBasename}}
@@ -4309,7 +4596,7 @@ spec:
             maxDuration: 5m
       source:
         repoURL: {{.ClusterGitOpsRepo}}
-        targetRevision: main
+        targetRevision: {{.GitBranch}}
         path: {{.RawPath}}
       destination:
         server: https://kubernetes.default.svc
@@ -4320,14 +4607,14 @@ apiVersion: argoproj.io/v1alpha1
 kind: ApplicationSet
 metadata:
   name: tenants
-  namespace: argocd
+  namespace: {{.ArgoNamespace}}
 spec:
   generators:
   - git:
       repoURL: {{.ClusterGitOpsRepo}}
-      revision: main
+      revision: {{.GitBranch}}
       directories:
-      - path: cluster/tenants/*
+      - path: {{.ClusterPath}}/tenants/*
   template:
     metadata:
       name: {{.RawPathBasename}}
@@ -4345,17 +4632,63 @@ spec:
             maxDuration: 5m
       source:
         repoURL: {{.ClusterGitOpsRepo}}
-        targetRevision: main
+        targetRevision: {{.GitBranch}}
         path: {{.RawPath}}
       destination:
         server: https://kubernetes.default.svc
 `
 
+var ArgoCdFleetApplicationSet string = `
+apiVersion: argoproj.io/v1alpha1
+kind: ApplicationSet
+metadata:
+  name: fleet
+  namespace: {{.ArgoNamespace}}
+spec:
+  generators:
+  - matrix:
+      generators:
+      - clusters: {}
+      - git:
+          repoURL: {{.ClusterGitOpsRepo}}
+          revision: {{.GitBranch}}
+          directories:
+          - path: {{.ClusterPath}}/fleet/*
+  template:
+    metadata:
+      name: {{.RawFleetAppName}}
+    spec:
+      project: cluster
+      syncPolicy:
+        automated:
+          prune: true
+          selfHeal: true
+        retry:
+          limit: 15
+          backoff:
+            duration: 15s
+            factor: 2
+            maxDuration: 5m
+      source:
+        repoURL: {{.ClusterGitOpsRepo}}
+        targetRevision: {{.GitBranch}}
+        path: {{.RawPath}}
+      destination:
+        server: {{.RawServer}}
+`
+
+var ArgoCdFleetReadme string = `# Fleet
+
+Every directory in here is an app that Argo CD deploys to every cluster it
+manages, including clusters that are registered with it later on (for example
+with "argocd cluster add"). The apps are named <directory>-<cluster>.
+`
+
 var ArgoCdComponentsArgoProjProject string = `apiVersion: argoproj.io/v1alpha1
 kind: AppProject
 metadata:
   name: cluster
-  namespace: argocd
+  namespace: {{.ArgoNamespace}}
 spec:
   clusterResourceWhitelist:
   - group: '*'
@@ -4434,3 +4767,1283 @@ metadata:
   name: kuard
 spec: {}
 `
+
+// Add-ons from the add-on catalog
+var AddOnKustomizeFile string = `apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+{{- if .Namespace}}
+namespace: {{.Namespace}}
+{{- end}}
+resources:
+{{- if .Namespace}}
+- namespace.yaml
+{{- end}}
+- {{.URL}}
+{{- if .Patches}}
+patchesStrategicMerge:
+{{- range .Patches}}
+- {{.}}
+{{- end}}
+{{- end}}
+{{- if .ServerSideApply}}
+patches:
+- target:
+    kind: CustomResourceDefinition
+  patch: |-
+    apiVersion: apiextensions.k8s.io/v1
+    kind: CustomResourceDefinition
+    metadata:
+      name: all
+      annotations:
+        argocd.argoproj.io/sync-options: ServerSideApply=true
+{{- end}}
+`
+
+var AddOnNamespaceFile string = `apiVersion: v1
+kind: Namespace
+metadata:
+  name: {{.Namespace}}
+`
+
+var AddOnResourcesPatchFile string = `{{range .}}---
+apiVersion: {{.APIVersion}}
+kind: {{.Kind}}
+metadata:
+  name: {{.Name}}
+  namespace: {{.Namespace}}
+spec:
+{{- if .Container}}
+  template:
+    spec:
+      containers:
+      - name: {{.Container}}
+        resources:
+{{- if .Requests}}
+          requests:
+{{- range $k, $v := .Requests}}
+            {{$k}}: {{$v}}
+{{- end}}
+{{- end}}
+{{- if .Limits}}
+          limits:
+{{- range $k, $v := .Limits}}
+            {{$k}}: {{$v}}
+{{- end}}
+{{- end}}
+{{- else}}
+  resources:
+{{- if .Requests}}
+    requests:
+{{- range $k, $v := .Requests}}
+      {{$k}}: {{$v}}
+{{- end}}
+{{- end}}
+{{- if .Limits}}
+    limits:
+{{- range $k, $v := .Limits}}
+      {{$k}}: {{$v}}
+{{- end}}
+{{- end}}
+{{- end}}
+{{end}}`
+
+var AddOnServicePatchFile string = `apiVersion: v1
+kind: Service
+metadata:
+  name: {{.Name}}
+  namespace: {{.Namespace}}
+{{- if .Annotations}}
+  annotations:
+{{- range $k, $v := .Annotations}}
+    {{$k}}: {{printf "%q" $v}}
+{{- end}}
+{{- end}}
+{{- if .Type}}
+spec:
+  type: {{.Type}}
+{{- end}}
+`
+
+var ACMEClusterIssuer string = `apiVersion: cert-manager.io/v1
+kind: ClusterIssuer
+metadata:
+  name: {{.Name}}
+  annotations:
+    argocd.argoproj.io/sync-options: SkipDryRunOnMissingResource=true
+spec:
+  acme:
+    server: {{.Server}}
+    email: {{.Email}}
+    privateKeySecretRef:
+      name: {{.Name}}-account-key
+    solvers:
+    - http01:
+        ingress:
+{{- if .IngressClass }}
+          class: {{.IngressClass}}
+{{- else }}
+          {}
+{{- end }}
+`
+
+var ACMEClusterIssuerKustomize string = `apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+
+resources:
+- clusterissuer.yaml
+`
+
+var ClusterSecretStore string = `apiVersion: external-secrets.io/v1beta1
+kind: ClusterSecretStore
+metadata:
+  name: {{.Name}}
+  annotations:
+    argocd.argoproj.io/sync-options: SkipDryRunOnMissingResource=true
+spec:
+  provider:
+{{- if eq .Provider "aws" }}
+    aws:
+      service: SecretsManager
+      region: {{.AWSRegion}}
+{{- if .HasCredentials }}
+      auth:
+        secretRef:
+          accessKeyIDSecretRef:
+            name: {{.SecretName}}
+            namespace: {{.Namespace}}
+            key: access-key-id
+          secretAccessKeySecretRef:
+            name: {{.SecretName}}
+            namespace: {{.Namespace}}
+            key: secret-access-key
+{{- end }}
+{{- else }}
+    vault:
+      server: {{.VaultServer}}
+      path: {{.VaultPath}}
+      version: v2
+      auth:
+{{- if .HasCredentials }}
+        tokenSecretRef:
+          name: {{.SecretName}}
+          namespace: {{.Namespace}}
+          key: token
+{{- else }}
+        kubernetes:
+          mountPath: kubernetes
+          role: {{.VaultRole}}
+          serviceAccountRef:
+            name: external-secrets
+            namespace: {{.OperatorNamespace}}
+{{- end }}
+{{- end }}
+`
+
+var ClusterSecretStoreKustomize string = `apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+
+resources:
+- clustersecretstore.yaml
+`
+
+var KyvernoBaselinePolicies string = `apiVersion: kyverno.io/v1
+kind: ClusterPolicy
+metadata:
+  name: disallow-privileged-containers
+  annotations:
+    argocd.argoproj.io/sync-options: SkipDryRunOnMissingResource=true
+    policies.kyverno.io/title: Disallow Privileged Containers
+spec:
+  validationFailureAction: {{ if .Enforce }}enforce{{ else }}audit{{ end }}
+  background: true
+  rules:
+  - name: privileged-containers
+    match:
+      any:
+      - resources:
+          kinds:
+          - Pod
+    exclude:
+      any:
+      - resources:
+          namespaces:
+{{- range .ExemptNamespaces }}
+          - {{ . }}
+{{- end }}
+    validate:
+      message: Privileged containers are not allowed, securityContext.privileged must be unset or false.
+      pattern:
+        spec:
+          =(ephemeralContainers):
+          - =(securityContext):
+              =(privileged): "false"
+          =(initContainers):
+          - =(securityContext):
+              =(privileged): "false"
+          containers:
+          - =(securityContext):
+              =(privileged): "false"
+---
+apiVersion: kyverno.io/v1
+kind: ClusterPolicy
+metadata:
+  name: require-requests-limits
+  annotations:
+    argocd.argoproj.io/sync-options: SkipDryRunOnMissingResource=true
+    policies.kyverno.io/title: Require Requests and Limits
+spec:
+  validationFailureAction: {{ if .Enforce }}enforce{{ else }}audit{{ end }}
+  background: true
+  rules:
+  - name: requests-limits
+    match:
+      any:
+      - resources:
+          kinds:
+          - Pod
+    exclude:
+      any:
+      - resources:
+          namespaces:
+{{- range .ExemptNamespaces }}
+          - {{ . }}
+{{- end }}
+    validate:
+      message: Containers need CPU and memory requests, and a memory limit.
+      pattern:
+        spec:
+          containers:
+          - resources:
+              requests:
+                cpu: "?*"
+                memory: "?*"
+              limits:
+                memory: "?*"
+`
+
+var GatekeeperBaselineTemplates string = `apiVersion: templates.gatekeeper.sh/v1
+kind: ConstraintTemplate
+metadata:
+  name: k8sdisallowprivileged
+  annotations:
+    argocd.argoproj.io/sync-options: SkipDryRunOnMissingResource=true
+spec:
+  crd:
+    spec:
+      names:
+        kind: K8sDisallowPrivileged
+  targets:
+  - target: admission.k8s.gatekeeper.sh
+    rego: |
+      package k8sdisallowprivileged
+
+      violation[{"msg": msg}] {
+        c := input_containers[_]
+        c.securityContext.privileged
+        msg := sprintf("privileged container %v is not allowed", [c.name])
+      }
+
+      input_containers[c] {
+        c := input.review.object.spec.containers[_]
+      }
+
+      input_containers[c] {
+        c := input.review.object.spec.initContainers[_]
+      }
+
+      input_containers[c] {
+        c := input.review.object.spec.ephemeralContainers[_]
+      }
+---
+apiVersion: templates.gatekeeper.sh/v1
+kind: ConstraintTemplate
+metadata:
+  name: k8srequiredresources
+  annotations:
+    argocd.argoproj.io/sync-options: SkipDryRunOnMissingResource=true
+spec:
+  crd:
+    spec:
+      names:
+        kind: K8sRequiredResources
+      validation:
+        openAPIV3Schema:
+          type: object
+          properties:
+            requests:
+              type: array
+              items:
+                type: string
+            limits:
+              type: array
+              items:
+                type: string
+  targets:
+  - target: admission.k8s.gatekeeper.sh
+    rego: |
+      package k8srequiredresources
+
+      violation[{"msg": msg}] {
+        c := input_containers[_]
+        r := input.parameters.requests[_]
+        not c.resources.requests[r]
+        msg := sprintf("container %v has no %v request", [c.name, r])
+      }
+
+      violation[{"msg": msg}] {
+        c := input_containers[_]
+        l := input.parameters.limits[_]
+        not c.resources.limits[l]
+        msg := sprintf("container %v has no %v limit", [c.name, l])
+      }
+
+      input_containers[c] {
+        c := input.review.object.spec.containers[_]
+      }
+`
+
+var GatekeeperBaselineConstraints string = `apiVersion: constraints.gatekeeper.sh/v1beta1
+kind: K8sDisallowPrivileged
+metadata:
+  name: disallow-privileged-containers
+  annotations:
+    argocd.argoproj.io/sync-options: SkipDryRunOnMissingResource=true
+spec:
+  enforcementAction: {{ if .Enforce }}deny{{ else }}dryrun{{ end }}
+  match:
+    kinds:
+    - apiGroups: [""]
+      kinds: ["Pod"]
+    excludedNamespaces:
+{{- range .ExemptNamespaces }}
+    - {{ . }}
+{{- end }}
+---
+apiVersion: constraints.gatekeeper.sh/v1beta1
+kind: K8sRequiredResources
+metadata:
+  name: require-requests-limits
+  annotations:
+    argocd.argoproj.io/sync-options: SkipDryRunOnMissingResource=true
+spec:
+  enforcementAction: {{ if .Enforce }}deny{{ else }}dryrun{{ end }}
+  match:
+    kinds:
+    - apiGroups: [""]
+      kinds: ["Pod"]
+    excludedNamespaces:
+{{- range .ExemptNamespaces }}
+    - {{ . }}
+{{- end }}
+  parameters:
+    requests:
+    - cpu
+    - memory
+    limits:
+    - memory
+`
+
+var BaselinePoliciesKustomize string = `apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+
+resources:
+{{- range .Files }}
+- {{ . }}
+{{- end }}
+`
+
+// Logging stack, Loki and Promtail
+var Loki string = `apiVersion: v1
+kind: Namespace
+metadata:
+  name: logging
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: loki
+  namespace: logging
+data:
+  loki.yaml: |
+    auth_enabled: false
+    server:
+      http_listen_port: 3100
+    common:
+      path_prefix: /var/loki
+      storage:
+        filesystem:
+          chunks_directory: /var/loki/chunks
+          rules_directory: /var/loki/rules
+      replication_factor: 1
+      ring:
+        kvstore:
+          store: inmemory
+    schema_config:
+      configs:
+      - from: 2022-01-01
+        store: boltdb-shipper
+        object_store: filesystem
+        schema: v12
+        index:
+          prefix: index_
+          period: 24h
+    compactor:
+      working_directory: /var/loki/compactor
+      shared_store: filesystem
+      retention_enabled: true
+    limits_config:
+      retention_period: {{.Retention}}
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: loki
+  namespace: logging
+spec:
+  selector:
+    app.kubernetes.io/name: loki
+  ports:
+  - name: http
+    port: 3100
+    targetPort: http
+---
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: loki
+  namespace: logging
+spec:
+  replicas: 1
+  serviceName: loki
+  selector:
+    matchLabels:
+      app.kubernetes.io/name: loki
+  template:
+    metadata:
+      labels:
+        app.kubernetes.io/name: loki
+    spec:
+      securityContext:
+        runAsNonRoot: true
+        runAsUser: 10001
+        runAsGroup: 10001
+        fsGroup: 10001
+      containers:
+      - name: loki
+        image: grafana/loki:{{.Version}}
+        args:
+        - -config.file=/etc/loki/loki.yaml
+        ports:
+        - name: http
+          containerPort: 3100
+        readinessProbe:
+          httpGet:
+            path: /ready
+            port: http
+          initialDelaySeconds: 15
+        resources:
+          requests:
+            cpu: 100m
+            memory: 256Mi
+          limits:
+            memory: 1Gi
+        volumeMounts:
+        - name: config
+          mountPath: /etc/loki
+        - name: storage
+          mountPath: /var/loki
+      volumes:
+      - name: config
+        configMap:
+          name: loki
+  volumeClaimTemplates:
+  - metadata:
+      name: storage
+    spec:
+      accessModes:
+      - ReadWriteOnce
+      resources:
+        requests:
+          storage: {{.StorageSize}}
+`
+
+var Promtail string = `apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: promtail
+  namespace: logging
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: promtail
+rules:
+- apiGroups: [""]
+  resources: ["nodes", "nodes/proxy", "services", "endpoints", "pods"]
+  verbs: ["get", "watch", "list"]
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: promtail
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: promtail
+subjects:
+- kind: ServiceAccount
+  name: promtail
+  namespace: logging
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: promtail
+  namespace: logging
+data:
+  promtail.yaml: |
+    server:
+      http_listen_port: 3101
+    positions:
+      filename: /run/promtail/positions.yaml
+    clients:
+    - url: http://loki.logging.svc:3100/loki/api/v1/push
+    scrape_configs:
+    - job_name: kubernetes-pods
+      pipeline_stages:
+      - cri: {}
+      kubernetes_sd_configs:
+      - role: pod
+        selectors:
+        - role: pod
+          field: spec.nodeName=${HOSTNAME}
+      relabel_configs:
+      - source_labels: [__meta_kubernetes_pod_node_name]
+        target_label: node
+      - source_labels: [__meta_kubernetes_namespace]
+        target_label: namespace
+      - source_labels: [__meta_kubernetes_pod_name]
+        target_label: pod
+      - source_labels: [__meta_kubernetes_pod_container_name]
+        target_label: container
+      - source_labels: [__meta_kubernetes_pod_uid, __meta_kubernetes_pod_container_name]
+        separator: /
+        replacement: /var/log/pods/*$1/*.log
+        target_label: __path__
+---
+apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: promtail
+  namespace: logging
+spec:
+  selector:
+    matchLabels:
+      app.kubernetes.io/name: promtail
+  template:
+    metadata:
+      labels:
+        app.kubernetes.io/name: promtail
+    spec:
+      serviceAccountName: promtail
+      tolerations:
+      - operator: Exists
+      containers:
+      - name: promtail
+        image: grafana/promtail:{{.Version}}
+        args:
+        - -config.file=/etc/promtail/promtail.yaml
+        - -config.expand-env=true
+        env:
+        - name: HOSTNAME
+          valueFrom:
+            fieldRef:
+              fieldPath: spec.nodeName
+        securityContext:
+          runAsUser: 0
+          readOnlyRootFilesystem: true
+        resources:
+          requests:
+            cpu: 50m
+            memory: 64Mi
+          limits:
+            memory: 256Mi
+        volumeMounts:
+        - name: config
+          mountPath: /etc/promtail
+        - name: run
+          mountPath: /run/promtail
+        - name: pods
+          mountPath: /var/log/pods
+          readOnly: true
+      volumes:
+      - name: config
+        configMap:
+          name: promtail
+      - name: run
+        hostPath:
+          path: /run/promtail
+      - name: pods
+        hostPath:
+          path: /var/log/pods
+`
+
+var LoggingKustomize string = `apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+
+resources:
+- loki.yaml
+- promtail.yaml
+`
+
+// cluster-autoscaler in Cluster API mode, scaling the MachineDeployments of the cluster it runs on
+var ClusterAutoscaler string = `apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: cluster-autoscaler
+  namespace: kube-system
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: cluster-autoscaler
+rules:
+- apiGroups: [""]
+  resources: ["namespaces", "persistentvolumeclaims", "persistentvolumes", "pods", "replicationcontrollers", "services"]
+  verbs: ["get", "list", "watch"]
+- apiGroups: [""]
+  resources: ["nodes"]
+  verbs: ["get", "list", "update", "watch"]
+- apiGroups: [""]
+  resources: ["pods/eviction"]
+  verbs: ["create"]
+- apiGroups: [""]
+  resources: ["events"]
+  verbs: ["create", "patch"]
+- apiGroups: [""]
+  resources: ["configmaps"]
+  verbs: ["create", "delete", "get", "update"]
+- apiGroups: ["policy"]
+  resources: ["poddisruptionbudgets"]
+  verbs: ["list", "watch"]
+- apiGroups: ["storage.k8s.io"]
+  resources: ["csidrivers", "csinodes", "csistoragecapacities", "storageclasses"]
+  verbs: ["get", "list", "watch"]
+- apiGroups: ["batch"]
+  resources: ["jobs"]
+  verbs: ["list", "watch"]
+- apiGroups: ["apps"]
+  resources: ["daemonsets", "replicasets", "statefulsets"]
+  verbs: ["list", "watch"]
+- apiGroups: ["coordination.k8s.io"]
+  resources: ["leases"]
+  verbs: ["create", "get", "update"]
+- apiGroups: ["cluster.x-k8s.io"]
+  resources: ["machinedeployments", "machinedeployments/scale", "machinepools", "machinepools/scale", "machines", "machinesets"]
+  verbs: ["get", "list", "update", "watch"]
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: cluster-autoscaler
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: cluster-autoscaler
+subjects:
+- kind: ServiceAccount
+  name: cluster-autoscaler
+  namespace: kube-system
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: cluster-autoscaler
+  namespace: kube-system
+  labels:
+    app: cluster-autoscaler
+spec:
+  replicas: 1
+  selector:
+    matchLabels:
+      app: cluster-autoscaler
+  template:
+    metadata:
+      labels:
+        app: cluster-autoscaler
+    spec:
+      serviceAccountName: cluster-autoscaler
+      priorityClassName: system-cluster-critical
+      tolerations:
+      - key: node-role.kubernetes.io/control-plane
+        effect: NoSchedule
+      - key: node-role.kubernetes.io/master
+        effect: NoSchedule
+      containers:
+      - name: cluster-autoscaler
+        image: registry.k8s.io/autoscaling/cluster-autoscaler:{{.Version}}
+        command:
+        - /cluster-autoscaler
+        args:
+        - --cloud-provider=clusterapi
+        - --node-group-auto-discovery=clusterapi:clusterName={{.ClusterName}}
+        - --balance-similar-node-groups
+        - --skip-nodes-with-local-storage=false
+        resources:
+          requests:
+            cpu: 100m
+            memory: 300Mi
+          limits:
+            memory: 600Mi
+`
+
+var ClusterAutoscalerKustomize string = `apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+
+resources:
+- cluster-autoscaler.yaml
+`
+
+// AWS EBS CSI driver, with its controller on the control plane and a default gp3 StorageClass
+var EBSCSIKustomize string = `apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+
+resources:
+- github.com/kubernetes-sigs/aws-ebs-csi-driver/deploy/kubernetes/overlays/stable/?ref={{.Version}}
+- storageclass.yaml
+
+patchesStrategicMerge:
+- controller.yaml
+`
+
+var EBSCSIControllerPatch string = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: ebs-csi-controller
+  namespace: kube-system
+spec:
+  template:
+    spec:
+      nodeSelector:
+        node-role.kubernetes.io/control-plane: ""
+      tolerations:
+      - key: node-role.kubernetes.io/control-plane
+        effect: NoSchedule
+      - key: node-role.kubernetes.io/master
+        effect: NoSchedule
+      - key: CriticalAddonsOnly
+        operator: Exists
+      containers:
+      - name: ebs-plugin
+        env:
+        - name: AWS_REGION
+          value: {{.Region}}
+`
+
+var EBSCSIStorageClass string = `apiVersion: storage.k8s.io/v1
+kind: StorageClass
+metadata:
+  name: {{.StorageClassName}}
+  annotations:
+    storageclass.kubernetes.io/is-default-class: "true"
+provisioner: ebs.csi.aws.com
+parameters:
+  type: gp3
+  encrypted: "true"
+  csi.storage.k8s.io/fstype: ext4
+reclaimPolicy: Delete
+volumeBindingMode: WaitForFirstConsumer
+allowVolumeExpansion: true
+`
+
+// external-dns, with the records of one Route53 zone
+var ExternalDNS string = `apiVersion: v1
+kind: Namespace
+metadata:
+  name: {{.Namespace}}
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: external-dns
+  namespace: {{.Namespace}}
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: external-dns
+rules:
+- apiGroups: [""]
+  resources: ["services", "endpoints", "pods", "nodes"]
+  verbs: ["get", "watch", "list"]
+- apiGroups: ["extensions", "networking.k8s.io"]
+  resources: ["ingresses"]
+  verbs: ["get", "watch", "list"]
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: external-dns
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: external-dns
+subjects:
+- kind: ServiceAccount
+  name: external-dns
+  namespace: {{.Namespace}}
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: external-dns
+  namespace: {{.Namespace}}
+spec:
+  replicas: 1
+  strategy:
+    type: Recreate
+  selector:
+    matchLabels:
+      app.kubernetes.io/name: external-dns
+  template:
+    metadata:
+      labels:
+        app.kubernetes.io/name: external-dns
+    spec:
+      serviceAccountName: external-dns
+      securityContext:
+        fsGroup: 65534
+      containers:
+      - name: external-dns
+        image: registry.k8s.io/external-dns/external-dns:{{.Version}}
+        args:
+        - --source=service
+        - --source=ingress
+        - --domain-filter={{.Zone}}
+        - --provider=aws
+        - --aws-zone-type=public
+        - --policy=upsert-only
+        - --registry=txt
+        - --txt-owner-id={{.OwnerID}}
+        envFrom:
+        - secretRef:
+            name: {{.SecretName}}
+        securityContext:
+          runAsNonRoot: true
+          runAsUser: 65534
+          readOnlyRootFilesystem: true
+          allowPrivilegeEscalation: false
+`
+
+var ExternalDNSKustomize string = `apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+
+resources:
+- external-dns.yaml
+`
+
+var Velero string = `apiVersion: v1
+kind: Namespace
+metadata:
+  name: {{.Namespace}}
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: velero
+  namespace: {{.Namespace}}
+  labels:
+    component: velero
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: velero
+  labels:
+    component: velero
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: cluster-admin
+subjects:
+- kind: ServiceAccount
+  name: velero
+  namespace: {{.Namespace}}
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: velero
+  namespace: {{.Namespace}}
+  labels:
+    component: velero
+spec:
+  selector:
+    matchLabels:
+      deploy: velero
+  template:
+    metadata:
+      labels:
+        component: velero
+        deploy: velero
+      annotations:
+        prometheus.io/scrape: "true"
+        prometheus.io/port: "8085"
+        prometheus.io/path: /metrics
+    spec:
+      serviceAccountName: velero
+      initContainers:
+      - name: velero-plugin-for-aws
+        image: velero/velero-plugin-for-aws:{{.AWSPluginVersion}}
+        volumeMounts:
+        - name: plugins
+          mountPath: /target
+      containers:
+      - name: velero
+        image: velero/velero:{{.Version}}
+        command:
+        - /velero
+        args:
+        - server
+        ports:
+        - name: metrics
+          containerPort: 8085
+        resources:
+          requests:
+            cpu: 500m
+            memory: 128Mi
+          limits:
+            cpu: "1"
+            memory: 512Mi
+        env:
+        - name: VELERO_SCRATCH_DIR
+          value: /scratch
+        - name: VELERO_NAMESPACE
+          valueFrom:
+            fieldRef:
+              fieldPath: metadata.namespace
+        - name: LD_LIBRARY_PATH
+          value: /plugins
+        - name: AWS_SHARED_CREDENTIALS_FILE
+          value: /credentials/cloud
+        volumeMounts:
+        - name: plugins
+          mountPath: /plugins
+        - name: scratch
+          mountPath: /scratch
+        - name: cloud-credentials
+          mountPath: /credentials
+      volumes:
+      - name: plugins
+        emptyDir: {}
+      - name: scratch
+        emptyDir: {}
+      - name: cloud-credentials
+        secret:
+          secretName: {{.SecretName}}
+---
+apiVersion: velero.io/v1
+kind: BackupStorageLocation
+metadata:
+  name: default
+  namespace: {{.Namespace}}
+  annotations:
+    argocd.argoproj.io/sync-options: SkipDryRunOnMissingResource=true
+spec:
+  provider: aws
+  default: true
+  objectStorage:
+    bucket: {{.Bucket}}
+    prefix: {{.Prefix}}
+  config:
+    region: {{.Region}}
+---
+apiVersion: velero.io/v1
+kind: VolumeSnapshotLocation
+metadata:
+  name: default
+  namespace: {{.Namespace}}
+  annotations:
+    argocd.argoproj.io/sync-options: SkipDryRunOnMissingResource=true
+spec:
+  provider: aws
+  config:
+    region: {{.Region}}
+---
+apiVersion: velero.io/v1
+kind: Schedule
+metadata:
+  name: default
+  namespace: {{.Namespace}}
+  annotations:
+    argocd.argoproj.io/sync-options: SkipDryRunOnMissingResource=true
+spec:
+  schedule: "{{.Schedule}}"
+  template:
+    ttl: {{.TTL}}
+    includedNamespaces:
+    - "*"
+`
+
+var VeleroKustomize string = `apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+
+resources:
+{{- range .CRDs }}
+- https://raw.githubusercontent.com/vmware-tanzu/velero/{{$.Version}}/config/crd/v1/bases/velero.io_{{.}}.yaml
+{{- end }}
+- velero.yaml
+`
+
+// CAPI Helm add-on provider (CAAPH)
+var CalicoHelmChartProxy string = `apiVersion: addons.cluster.x-k8s.io/v1alpha1
+kind: HelmChartProxy
+metadata:
+  name: calico-cni
+  namespace: default
+spec:
+  clusterSelector:
+    matchLabels:
+      gokp.io/cni: calico
+  repoURL: https://projectcalico.docs.tigera.io/charts
+  chartName: tigera-operator
+  version: {{.CalicoVersion}}
+  releaseName: calico
+  namespace: tigera-operator
+  valuesTemplate: |
+    installation:
+      cni:
+        type: Calico
+      calicoNetwork:
+        bgp: Disabled
+        ipPools:
+        - cidr: 192.168.0.0/16
+          encapsulation: VXLAN
+`
+
+var CNIKustomize string = `apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+
+resources:
+- cni.yaml
+labels:
+- pairs:
+    {{.Label}}: {{.Name}}
+{{- if .Version }}
+commonAnnotations:
+  {{.VersionAnnotation}}: {{.Version}}
+{{- end }}
+{{- if .PriorityClasses }}
+patches:
+- target:
+    kind: DaemonSet
+  patch: |-
+    - op: add
+      path: /spec/template/spec/priorityClassName
+      value: system-node-critical
+- target:
+    kind: Deployment
+  patch: |-
+    - op: add
+      path: /spec/template/spec/priorityClassName
+      value: system-cluster-critical
+{{- end }}
+`
+
+var CNIRepoKustomize string = `apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+
+resources:
+- cni.yaml
+`
+
+var KonnectivityEgressSelectorConfig string = `apiVersion: apiserver.k8s.io/v1beta1
+kind: EgressSelectorConfiguration
+egressSelections:
+- name: cluster
+  connection:
+    proxyProtocol: GRPC
+    transport:
+      uds:
+        udsName: {{.Dir}}/konnectivity-server.socket
+`
+
+var KonnectivityServerSetup string = `#!/bin/sh
+# Gives the konnectivity server a kubeconfig with a client certificate signed by the cluster CA
+set -e
+cd {{.Dir}}
+openssl req -subj "/CN=system:konnectivity-server" -new -newkey rsa:2048 -nodes -out konnectivity.csr -keyout konnectivity.key
+openssl x509 -req -in konnectivity.csr -CA /etc/kubernetes/pki/ca.crt -CAkey /etc/kubernetes/pki/ca.key -CAcreateserial -out konnectivity.crt -days 375 -sha256
+SERVER=$(kubectl config view --kubeconfig=/etc/kubernetes/admin.conf -o jsonpath='{.clusters..server}')
+kubectl --kubeconfig {{.Kubeconfig}} config set-credentials system:konnectivity-server --client-certificate konnectivity.crt --client-key konnectivity.key --embed-certs=true
+kubectl --kubeconfig {{.Kubeconfig}} config set-cluster kubernetes --server "$SERVER" --certificate-authority /etc/kubernetes/pki/ca.crt --embed-certs=true
+kubectl --kubeconfig {{.Kubeconfig}} config set-context system:konnectivity-server@kubernetes --cluster kubernetes --user system:konnectivity-server
+kubectl --kubeconfig {{.Kubeconfig}} config use-context system:konnectivity-server@kubernetes
+rm -f konnectivity.csr konnectivity.crt konnectivity.key
+cp konnectivity-server.yaml /etc/kubernetes/manifests/konnectivity-server.yaml
+`
+
+var KonnectivityServerPod string = `apiVersion: v1
+kind: Pod
+metadata:
+  name: konnectivity-server
+  namespace: kube-system
+spec:
+  priorityClassName: system-cluster-critical
+  hostNetwork: true
+  containers:
+  - name: konnectivity-server-container
+    image: registry.k8s.io/kas-network-proxy/proxy-server:{{.Version}}
+    command: ["/proxy-server"]
+    args:
+    - --logtostderr=true
+    - --uds-name={{.Dir}}/konnectivity-server.socket
+    - --delete-existing-uds-file
+    - --cluster-cert=/etc/kubernetes/pki/apiserver.crt
+    - --cluster-key=/etc/kubernetes/pki/apiserver.key
+    - --mode=grpc
+    - --server-port=0
+    - --agent-port={{.AgentPort}}
+    - --admin-port=8133
+    - --health-port=8134
+    - --agent-namespace=kube-system
+    - --agent-service-account=konnectivity-agent
+    - --kubeconfig={{.Kubeconfig}}
+    - --authentication-audience=system:konnectivity-server
+    livenessProbe:
+      httpGet:
+        scheme: HTTP
+        host: 127.0.0.1
+        port: 8134
+        path: /healthz
+      initialDelaySeconds: 30
+      timeoutSeconds: 60
+    ports:
+    - name: agentport
+      containerPort: {{.AgentPort}}
+      hostPort: {{.AgentPort}}
+    - name: adminport
+      containerPort: 8133
+      hostPort: 8133
+    - name: healthport
+      containerPort: 8134
+      hostPort: 8134
+    volumeMounts:
+    - name: k8s-certs
+      mountPath: /etc/kubernetes/pki
+      readOnly: true
+    - name: konnectivity-uds
+      mountPath: {{.Dir}}
+      readOnly: false
+  volumes:
+  - name: k8s-certs
+    hostPath:
+      path: /etc/kubernetes/pki
+  - name: konnectivity-uds
+    hostPath:
+      path: {{.Dir}}
+      type: DirectoryOrCreate
+`
+
+var KonnectivityAgent string = `apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: konnectivity-agent
+  namespace: kube-system
+  labels:
+    {{.Label}}: agent
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: system:konnectivity-server
+  labels:
+    {{.Label}}: agent
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: system:auth-delegator
+subjects:
+- apiGroup: rbac.authorization.k8s.io
+  kind: User
+  name: system:konnectivity-server
+---
+apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: konnectivity-agent
+  namespace: kube-system
+  labels:
+    k8s-app: konnectivity-agent
+    {{.Label}}: agent
+spec:
+  selector:
+    matchLabels:
+      k8s-app: konnectivity-agent
+  template:
+    metadata:
+      labels:
+        k8s-app: konnectivity-agent
+    spec:
+      priorityClassName: system-cluster-critical
+      tolerations:
+      - key: CriticalAddonsOnly
+        operator: Exists
+      containers:
+      - name: konnectivity-agent
+        image: registry.k8s.io/kas-network-proxy/proxy-agent:{{.Version}}
+        command: ["/proxy-agent"]
+        args:
+        - --logtostderr=true
+        - --ca-cert=/var/run/secrets/kubernetes.io/serviceaccount/ca.crt
+        - --proxy-server-host={{.ServerHost}}
+        - --proxy-server-port={{.AgentPort}}
+        - --admin-server-port=8133
+        - --health-server-port=8134
+        - --service-account-token-path=/var/run/secrets/tokens/konnectivity-agent-token
+        volumeMounts:
+        - mountPath: /var/run/secrets/tokens
+          name: konnectivity-agent-token
+        livenessProbe:
+          httpGet:
+            port: 8134
+            path: /healthz
+          initialDelaySeconds: 15
+          timeoutSeconds: 15
+      serviceAccountName: konnectivity-agent
+      volumes:
+      - name: konnectivity-agent-token
+        projected:
+          sources:
+          - serviceAccountToken:
+              path: konnectivity-agent-token
+              audience: system:konnectivity-server
+`
+
+var KonnectivityRepoKustomize string = `apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+
+resources:
+- konnectivity-agent.yaml
+`
+
+var BMOKustomizeFile string = `apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+
+resources:
+- https://github.com/metal3-io/baremetal-operator//config/default?ref={{.Version}}
+patches:
+- target:
+    kind: ConfigMap
+    name: .*ironic
+  patch: |-
+    - op: add
+      path: /data/IRONIC_ENDPOINT
+      value: {{.IronicURL}}
+    - op: add
+      path: /data/DEPLOY_KERNEL_URL
+      value: {{.DeployKernelURL}}
+    - op: add
+      path: /data/DEPLOY_RAMDISK_URL
+      value: {{.DeployRamdiskURL}}
+`
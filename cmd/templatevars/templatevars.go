@@ -0,0 +1,119 @@
+package templatevars
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	log "github.com/sirupsen/logrus"
+)
+
+// SSMPrefix marks a value that is the name of an SSM Parameter Store parameter
+var SSMPrefix string = "ssm:"
+
+// SecretsManagerPrefix marks a value that is the name of an AWS Secrets Manager secret. A "#key"
+// at the end picks a key out of a JSON secret
+var SecretsManagerPrefix string = "secretsmanager:"
+
+// Resolve returns the template variables with every SSM Parameter Store and Secrets Manager reference
+// replaced by its value. Anything else is returned as is
+func Resolve(vars map[string]string, region string, accessKey string, secretKey string) (map[string]string, error) {
+	resolved := map[string]string{}
+	var sess *session.Session
+
+	for k, v := range vars {
+		if !strings.HasPrefix(v, SSMPrefix) && !strings.HasPrefix(v, SecretsManagerPrefix) {
+			resolved[k] = v
+			continue
+		}
+
+		// Only talk to AWS if we have to
+		if sess == nil {
+			var err error
+			sess, err = newSession(region, accessKey, secretKey)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		var err error
+		if strings.HasPrefix(v, SSMPrefix) {
+			resolved[k], err = getParameter(sess, strings.TrimPrefix(v, SSMPrefix))
+		} else {
+			resolved[k], err = getSecret(sess, strings.TrimPrefix(v, SecretsManagerPrefix))
+		}
+		if err != nil {
+			return nil, errors.New("unable to resolve " + k + ": " + err.Error())
+		}
+		log.Info("Resolved template variable ", k, " from ", strings.SplitN(v, ":", 2)[0])
+	}
+
+	return resolved, nil
+}
+
+// newSession returns an AWS session for the region. The default credential chain is used if no keys are given
+func newSession(region string, accessKey string, secretKey string) (*session.Session, error) {
+	cfg := &aws.Config{}
+	if region != "" {
+		cfg.Region = aws.String(region)
+	} else if os.Getenv("AWS_REGION") == "" {
+		cfg.Region = aws.String("us-east-1")
+	}
+	if accessKey != "" && secretKey != "" {
+		cfg.Credentials = credentials.NewStaticCredentials(accessKey, secretKey, "")
+	}
+	return session.NewSession(cfg)
+}
+
+// getParameter returns the (decrypted) value of the SSM parameter
+func getParameter(sess *session.Session, name string) (string, error) {
+	out, err := ssm.New(sess).GetParameter(&ssm.GetParameterInput{
+		Name:           aws.String(name),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(out.Parameter.Value), nil
+}
+
+// getSecret returns the value of the secret, or of a key in it if given as name#key
+func getSecret(sess *session.Session, ref string) (string, error) {
+	name, key := ref, ""
+	if i := strings.LastIndex(ref, "#"); i != -1 {
+		name, key = ref[:i], ref[i+1:]
+	}
+
+	out, err := secretsmanager.New(sess).GetSecretValue(&secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(name),
+	})
+	if err != nil {
+		return "", err
+	}
+	value := aws.StringValue(out.SecretString)
+	if key == "" {
+		return value, nil
+	}
+
+	// Pick the key out of the JSON secret
+	fields := map[string]interface{}{}
+	err = json.Unmarshal([]byte(value), &fields)
+	if err != nil {
+		return "", errors.New("secret " + name + " is not JSON, so key " + key + " can't be used")
+	}
+	field, ok := fields[key]
+	if !ok {
+		return "", errors.New("secret " + name + " has no key " + key)
+	}
+	if s, ok := field.(string); ok {
+		return s, nil
+	}
+	b, err := json.Marshal(field)
+	return string(b), err
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// testClusterCmd represents the test-cluster command
+var testClusterCmd = &cobra.Command{
+	Use:   "test-cluster",
+	Short: "Runs acceptance tests on a gokp cluster",
+	Long: `Runs acceptance tests on a gokp cluster, like --acceptance-tests of
+create-cluster does once a cluster is up. The tests are the Jobs in the YAML
+files of the dir given. Anything else in the files, like the ServiceAccounts
+and RBAC they need, is applied before them. Jobs without a namespace run in
+gokp-acceptance, and the Jobs of an earlier run are replaced. A test passes
+when its Job completes, and fails when the Job fails or hasn't finished
+once the acceptanceTests timeout (30m, see "timeouts" in the config file)
+is up. The results, with the logs of what failed, are kept as
+~/.gokp/<clustername>/acceptance-results.yaml, and the command fails if any
+test did. For example:
+
+gokp test-cluster --cluster-name=mycluster --tests=./acceptance`,
+	Run: func(cmd *cobra.Command, args []string) {
+		// Grab flags
+		clusterName, _ := cmd.Flags().GetString("cluster-name")
+		CapiCfg, _ := cmd.Flags().GetString("kubeconfig")
+		dir, _ := cmd.Flags().GetString("tests")
+
+		// Default to the kubeconfig that was saved at install time
+		var err error
+		if CapiCfg == "" {
+			CapiCfg, err = clusterSecretFile(clusterName, clusterName+".kubeconfig")
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		err = acceptanceTests(clusterName, CapiCfg, dir)
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(testClusterCmd)
+
+	testClusterCmd.Flags().String("cluster-name", "", "Name of the gokp cluster.")
+	testClusterCmd.Flags().String("kubeconfig", "", "Path to the Kubeconfig file of the gokp cluster (defaults to the one under ~/.gokp).")
+	testClusterCmd.Flags().String("tests", "", "Dir of the YAML files of the acceptance tests.")
+
+	testClusterCmd.MarkFlagRequired("cluster-name")
+	testClusterCmd.MarkFlagRequired("tests")
+}
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/christianh814/gokp/cmd/acceptance"
+	"github.com/christianh814/gokp/cmd/argo"
+	"github.com/christianh814/gokp/cmd/capi"
+	"github.com/christianh814/gokp/cmd/certs"
+	"github.com/christianh814/gokp/cmd/clock"
+	"github.com/christianh814/gokp/cmd/cni"
+	"github.com/christianh814/gokp/cmd/flux"
+	"github.com/christianh814/gokp/cmd/hibernate"
+	"github.com/christianh814/gokp/cmd/machine"
+	"github.com/christianh814/gokp/cmd/upgrade"
+	"github.com/spf13/viper"
+)
+
+// waits are the waits whose timeout can be changed in the timeouts section of the config file, by name
+var waits = map[string]*clock.Waiter{
+	"clusterReady":      &capi.ReadyWait,
+	"controllerRollout": &capi.ControllerWait,
+	"infrastructure":    &capi.InfrastructureWait,
+	"controlPlane":      &capi.ControlPlaneWait,
+	"nodes":             &capi.NodeWait,
+	"crdEstablished":    &capi.CRDWait,
+	"hostRegistration":  &capi.HostRegistrationWait,
+	"cloudFormation":    &capi.StackWait,
+	"cniRollout":        &cni.RolloutWait,
+	"argoCDApply":       &argo.ApplyWait,
+	"argoCDPassword":    &argo.PasswordWait,
+	"fluxApply":         &flux.ApplyWait,
+	"upgradeRollout":    &upgrade.RolloutWait,
+	"certRotation":      &certs.RotationWait,
+	"machineReplace":    &machine.ReplaceWait,
+	"hibernate":         &hibernate.Wait,
+	"acceptanceTests":   &acceptance.Wait,
+}
+
+// setTimeouts changes the timeouts of the waits set in the timeouts section of the config file, for infrastructure
+// that's slower (or faster) than the defaults allow for:
+//
+//	timeouts:
+//	  clusterReady: 40m
+//	  cloudFormation: 1h
+func setTimeouts() error {
+	timeouts := map[string]string{}
+	err := viper.UnmarshalKey("timeouts", &timeouts)
+	if err != nil {
+		return err
+	}
+
+	for name, value := range timeouts {
+		w := lookupWait(name)
+		if w == nil {
+			return errors.New("unknown timeout " + name + " in the config file (use " + strings.Join(waitNames(), ", ") + ")")
+		}
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			return errors.New("invalid timeout " + value + " for " + name + ", it should look like 20m")
+		}
+		w.Timeout = timeout
+	}
+	return nil
+}
+
+// lookupWait returns the wait with the name, whatever its case is (viper lowercases the keys of the config file)
+func lookupWait(name string) *clock.Waiter {
+	for n, w := range waits {
+		if strings.EqualFold(n, name) {
+			return w
+		}
+	}
+	return nil
+}
+
+// waitNames returns the names of the waits, sorted
+func waitNames() []string {
+	names := []string{}
+	for name := range waits {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
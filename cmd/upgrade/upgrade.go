@@ -0,0 +1,179 @@
+package upgrade
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/christianh814/gokp/cmd/clock"
+	"github.com/christianh814/gokp/cmd/export"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// RolloutWait is how often WaitForRollout checks on the machines, and how long a rollout of the new version can take
+var RolloutWait clock.Waiter = clock.Waiter{Interval: 30 * time.Second, Timeout: time.Hour}
+
+// Kinds are the kinds that carry the Kubernetes version, in the order they have to be upgraded in. The control
+// plane has to be upgraded before the workers
+var Kinds = []string{"KubeadmControlPlane", "MachineDeployment"}
+
+// versionPaths is where the Kubernetes version is in each of the Kinds
+var versionPaths = map[string][]string{
+	"KubeadmControlPlane": {"spec", "version"},
+	"MachineDeployment":   {"spec", "template", "spec", "version"},
+}
+
+// Check makes sure the version is a Kubernetes version that every object of the Kinds exported under baseDir can
+// be upgraded to. Only one minor version can be skipped at a time, and there's no downgrading
+func Check(baseDir string, target string) error {
+	to, err := version.ParseSemantic(target)
+	if err != nil || !strings.HasPrefix(target, "v") {
+		return errors.New("invalid Kubernetes version " + target + " (e.g. v1.24.3)")
+	}
+
+	for _, kind := range Kinds {
+		_, err = export.UpdateExported(baseDir, kind, func(obj *unstructured.Unstructured) (bool, error) {
+			current, _, err := unstructured.NestedString(obj.Object, versionPaths[kind]...)
+			if err != nil {
+				return false, err
+			}
+			from, err := version.ParseSemantic(current)
+			if err != nil {
+				return false, errors.New(kind + " " + obj.GetName() + " has an invalid version " + current)
+			}
+			if to.LessThan(from) {
+				return false, errors.New(kind + " " + obj.GetName() + " is at " + current + ", which is newer than " + target)
+			}
+			if to.Major() != from.Major() || to.Minor() > from.Minor()+1 {
+				return false, errors.New(kind + " " + obj.GetName() + " is at " + current + " and can only be upgraded one minor version at a time")
+			}
+			return false, nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// If we're here, we should be okay
+	return nil
+}
+
+// SetVersion sets the Kubernetes version of every object of the kind exported under baseDir and returns the ones
+// that changed
+func SetVersion(baseDir string, kind string, target string) ([]*unstructured.Unstructured, error) {
+	return export.UpdateExported(baseDir, kind, func(obj *unstructured.Unstructured) (bool, error) {
+		current, _, _ := unstructured.NestedString(obj.Object, versionPaths[kind]...)
+		if current == target {
+			return false, nil
+		}
+		return true, unstructured.SetNestedField(obj.Object, target, versionPaths[kind]...)
+	})
+}
+
+// PatchCluster sets the Kubernetes version of the objects on the cluster of the kubeconfig to the one they have
+// in the repo, which starts the rolling upgrade
+func PatchCluster(kubeconfig string, objs []*unstructured.Unstructured) error {
+	dyn, err := newDynamicClient(kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	for _, obj := range objs {
+		path := versionPaths[obj.GetKind()]
+		target, _, _ := unstructured.NestedString(obj.Object, path...)
+
+		// Build the patch from the inside out
+		var patch interface{} = target
+		for i := len(path) - 1; i >= 0; i-- {
+			patch = map[string]interface{}{path[i]: patch}
+		}
+		b, err := json.Marshal(patch)
+		if err != nil {
+			return err
+		}
+
+		log.Info("Upgrading ", obj.GetKind(), " ", obj.GetNamespace(), "/", obj.GetName(), " to ", target)
+		_, err = dyn.Resource(gvr(obj)).Namespace(obj.GetNamespace()).Patch(context.TODO(), obj.GetName(), types.MergePatchType, b, metav1.PatchOptions{})
+		if err != nil {
+			return err
+		}
+	}
+
+	// If we're here, we should be okay
+	return nil
+}
+
+// WaitForRollout waits for every machine of the objects on the cluster of the kubeconfig to be replaced by one
+// that runs the version they have in the repo
+func WaitForRollout(kubeconfig string, objs []*unstructured.Unstructured) error {
+	dyn, err := newDynamicClient(kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	for _, obj := range objs {
+		target, _, _ := unstructured.NestedString(obj.Object, versionPaths[obj.GetKind()]...)
+		log.Info("Waiting for ", obj.GetKind(), " ", obj.GetName(), " to roll out ", target)
+
+		err = RolloutWait.Until(func() (bool, error) {
+			live, err := dyn.Resource(gvr(obj)).Namespace(obj.GetNamespace()).Get(context.TODO(), obj.GetName(), metav1.GetOptions{})
+			return err == nil && rolledOut(live, target), nil
+		})
+		if err == clock.ErrTimeout {
+			return errors.New(obj.GetKind() + " " + obj.GetName() + " took too long to roll out " + target)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// If we're here, we should be okay
+	return nil
+}
+
+// rolledOut returns true when the status of the object says all of its machines are up to date and ready
+func rolledOut(obj *unstructured.Unstructured, target string) bool {
+	observed, _, _ := unstructured.NestedInt64(obj.Object, "status", "observedGeneration")
+	if observed < obj.GetGeneration() {
+		return false
+	}
+
+	wanted, _, _ := unstructured.NestedInt64(obj.Object, "spec", "replicas")
+	replicas, _, _ := unstructured.NestedInt64(obj.Object, "status", "replicas")
+	updated, _, _ := unstructured.NestedInt64(obj.Object, "status", "updatedReplicas")
+	ready, _, _ := unstructured.NestedInt64(obj.Object, "status", "readyReplicas")
+	if replicas != wanted || updated != wanted || ready != wanted {
+		return false
+	}
+
+	// The control plane also reports the oldest version its machines run
+	if obj.GetKind() == "KubeadmControlPlane" {
+		current, _, _ := unstructured.NestedString(obj.Object, "status", "version")
+		return current == target
+	}
+	return true
+}
+
+// gvr returns the resource of the object
+func gvr(obj *unstructured.Unstructured) schema.GroupVersionResource {
+	gv, _ := schema.ParseGroupVersion(obj.GetAPIVersion())
+	return gv.WithResource(strings.ToLower(obj.GetKind()) + "s")
+}
+
+// newDynamicClient returns a dynamic client for the kubeconfig
+func newDynamicClient(kubeconfig string) (dynamic.Interface, error) {
+	cfg, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	return dynamic.NewForConfig(cfg)
+}
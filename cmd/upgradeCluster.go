@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/christianh814/gokp/cmd/gitutils"
+	"github.com/christianh814/gokp/cmd/state"
+	"github.com/christianh814/gokp/cmd/upgrade"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// upgradeClusterCmd represents the upgrade-cluster command
+var upgradeClusterCmd = &cobra.Command{
+	Use:     "upgrade-cluster",
+	Aliases: []string{"upgradeCluster"},
+	Short:   "Upgrades the Kubernetes version of a gokp cluster",
+	Long: `Upgrades the Kubernetes version of a gokp cluster with a rolling upgrade.
+The control plane is upgraded first and then the workers. For each, the new
+version is committed to the GitOps repo (so the GitOps controller doesn't
+undo it), set on the cluster, and waited on until every machine runs it.
+For example:
+
+gokp upgrade-cluster --cluster-name=mycluster --kubernetes-version=v1.24.3
+
+Only one minor version can be upgraded at a time.`,
+	Annotations: map[string]string{stateLockAnnotation: "true"},
+	Run: func(cmd *cobra.Command, args []string) {
+		// Grab flags
+		clusterName, _ := cmd.Flags().GetString("cluster-name")
+		CapiCfg, _ := cmd.Flags().GetString("kubeconfig")
+		kubernetesVersion, _ := cmd.Flags().GetString("kubernetes-version")
+
+		// Default to the kubeconfig that was saved at install time
+		var err error
+		if CapiCfg == "" {
+			CapiCfg, err = clusterSecretFile(clusterName, clusterName+".kubeconfig")
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		// Find the local clone of the repo
+		repoDir, privateKeyFile, err := openClusterRepo(clusterName)
+		if err != nil {
+			log.Fatal(err)
+		}
+		baseDir := gitutils.BaseDir(repoDir)
+
+		// Make sure it's an upgrade we can do before anything is changed
+		err = upgrade.Check(baseDir, kubernetesVersion)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// HTTPS remotes use the token, everything else uses the stored key
+		err = setRepoCredentials(cmd, repoDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		for _, kind := range upgrade.Kinds {
+			objs, err := upgrade.SetVersion(baseDir, kind, kubernetesVersion)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if len(objs) == 0 {
+				continue
+			}
+
+			_, err = commitAndPush(repoDir, privateKeyFile, clusterName, "upgrading "+kind+"s of "+clusterName+" to "+kubernetesVersion)
+			if err != nil {
+				log.Fatal(err)
+			}
+			err = upgrade.PatchCluster(CapiCfg, objs)
+			if err != nil {
+				log.Fatal(err)
+			}
+			err = upgrade.WaitForRollout(CapiCfg, objs)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		// Remember the version for later commands
+		st, err := state.Load(state.ArtifactsDir(clusterName))
+		if err == nil {
+			st.KubernetesVersion = kubernetesVersion
+			err = state.Save(state.ArtifactsDir(clusterName), st)
+		}
+		if err != nil && !os.IsNotExist(err) {
+			log.Fatal(err)
+		}
+
+		log.Info("Cluster ", clusterName, " successfully upgraded to ", kubernetesVersion)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(upgradeClusterCmd)
+
+	upgradeClusterCmd.Flags().String("cluster-name", "", "Name of the gokp cluster.")
+	upgradeClusterCmd.Flags().String("kubeconfig", "", "Path to the Kubeconfig file of the gokp cluster (defaults to the one under ~/.gokp).")
+	upgradeClusterCmd.Flags().String("kubernetes-version", "", "Kubernetes version to upgrade to (e.g. v1.24.3).")
+	addRepoAuthFlags(upgradeClusterCmd)
+
+	upgradeClusterCmd.MarkFlagRequired("cluster-name")
+	upgradeClusterCmd.MarkFlagRequired("kubernetes-version")
+}
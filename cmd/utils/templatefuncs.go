@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"text/template"
+)
+
+// TemplateFuncs are the functions the organization added under "templateFunctions" in the config file, like naming
+// prefixes or cost-center codes. Every template GOKP writes into the GitOps repo can use them, along with the
+// templateVariables of the cluster template and the URLs of the add-ons
+var TemplateFuncs = template.FuncMap{}
+
+// maxTemplateFuncDepth is how deep the functions can call each other before it's taken as a loop
+var maxTemplateFuncDepth = 32
+
+// templateFuncName is what a function can be named, so it can be called from a template
+var templateFuncName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// templateFuncArgs is what the template of a function is rendered with
+type templateFuncArgs struct {
+	// Arg is the first argument the function was called with, empty if there were none
+	Arg string
+
+	// Args are all the arguments the function was called with
+	Args []string
+}
+
+// SetTemplateFuncs makes a function out of each template, called by its name with any number of arguments. The
+// templates can call each other, and {{ .Arg }} (or {{ .Args }}) is what the function was called with:
+//
+//	templateFunctions:
+//	  prefix: acme
+//	  costcenter: cc-1234
+//	  name: "{{ prefix }}-{{ .Arg }}"
+func SetTemplateFuncs(funcs map[string]string) error {
+	fm := template.FuncMap{}
+	root := template.New("templateFunctions").Funcs(fm)
+	depth := 0
+
+	for name := range funcs {
+		if !templateFuncName.MatchString(name) {
+			return errors.New("template function " + name + " can only have letters, digits, and underscores in its name")
+		}
+		name := name
+		fm[name] = func(args ...interface{}) (string, error) {
+			if depth >= maxTemplateFuncDepth {
+				return "", errors.New("template function " + name + " calls itself")
+			}
+			depth++
+			defer func() { depth-- }()
+
+			data := templateFuncArgs{Args: []string{}}
+			for _, arg := range args {
+				data.Args = append(data.Args, fmt.Sprint(arg))
+			}
+			if len(data.Args) > 0 {
+				data.Arg = data.Args[0]
+			}
+
+			var b bytes.Buffer
+			err := root.ExecuteTemplate(&b, name, data)
+			if err != nil {
+				return "", err
+			}
+			return b.String(), nil
+		}
+	}
+
+	// Every function has to be known before any of them are parsed, since they can call each other
+	root.Funcs(fm)
+	for name, tpl := range funcs {
+		_, err := root.New(name).Parse(tpl)
+		if err != nil {
+			return errors.New("bad template function " + name + ": " + err.Error())
+		}
+	}
+
+	TemplateFuncs = fm
+
+	// If we're here, we should be okay
+	return nil
+}
+
+// RenderTemplate returns the template rendered with the vars, and the functions of the config file
+func RenderTemplate(tpl string, vars interface{}) (string, error) {
+	tmpl, err := template.New("").Funcs(TemplateFuncs).Parse(tpl)
+	if err != nil {
+		return "", err
+	}
+
+	var b bytes.Buffer
+	err = tmpl.Execute(&b, vars)
+	if err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
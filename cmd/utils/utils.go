@@ -11,9 +11,11 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"text/template"
 
+	"github.com/christianh814/gokp/cmd/prereqs"
 	log "github.com/sirupsen/logrus"
 	"sigs.k8s.io/cluster-api/cmd/clusterctl/client"
 	"sigs.k8s.io/kustomize/api/krusty"
@@ -43,6 +45,19 @@ func CheckPreReqs(lastinstalldir string, gitOpsController string) (bool, error)
 
 	}
 
+	// Then the checks that were added in the config file or in ~/.gokp/checks.d
+	env := map[string]string{"GOKP_CLUSTER_NAME": filepath.Base(lastinstalldir), "GOKP_GITOPS_CONTROLLER": gitOpsController}
+	for _, c := range prereqs.Custom {
+		_, err := c.Run(env)
+		if err != nil && c.Optional {
+			log.Warn("Nonfatal: prereq check ", c.Name, " failed: ", err)
+			continue
+		}
+		if err != nil {
+			return false, errors.New("prereq check " + c.Name + " failed: " + err.Error())
+		}
+	}
+
 	// If we're here, we should be okay
 	return true, nil
 }
@@ -65,7 +80,7 @@ func CreateWorkDir() (string, error) {
 
 // WriteTemplate is a generic template writing mechanism
 func WriteTemplate(tpl string, fileToCreate string, vars interface{}) (bool, error) {
-	tmpl := template.Must(template.New("").Parse(tpl))
+	tmpl := template.Must(template.New("").Funcs(TemplateFuncs).Parse(tpl))
 	file, err := os.Create(fileToCreate)
 	if err != nil {
 		return false, err
@@ -146,6 +161,11 @@ func DownloadFile(file string, url string) (bool, error) {
 	}
 	defer r.Body.Close()
 
+	// Don't write out an error page as if it was the file
+	if r.StatusCode != http.StatusOK {
+		return false, errors.New("GET " + url + ": " + r.Status)
+	}
+
 	// Create the file to the specific path
 	out, err := os.Create(file)
 	if err != nil {
@@ -158,6 +178,20 @@ func DownloadFile(file string, url string) (bool, error) {
 	return false, err
 }
 
+// OpenBrowser opens the URL in the default browser of the desktop
+func OpenBrowser(url string) error {
+	var c *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		c = exec.Command("open", url)
+	case "windows":
+		c = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		c = exec.Command("xdg-open", url)
+	}
+	return c.Start()
+}
+
 // CopyFile copies one file to another
 func CopyFile(source string, dest string) error {
 	sourcefile, err := os.Open(source)
@@ -291,3 +325,25 @@ func RunKustomize(dir string, outfile string) (bool, error) {
 	// If we're here, we should be okay
 	return false, nil
 }
+
+// ValidateKustomizations runs kustomize on every dir under dir that has a kustomization file, so broken YAML is caught before it's pushed
+func ValidateKustomizations(dir string) error {
+	fSys := filesys.MakeFsOnDisk()
+	k := krusty.MakeKustomizer(krusty.MakeDefaultOptions())
+
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || info.Name() != "kustomization.yaml" {
+			return nil
+		}
+
+		// Run Kustomize on the dir the kustomization file is in
+		_, err = k.Run(fSys, filepath.Dir(path))
+		if err != nil {
+			return fmt.Errorf("%s: %w", filepath.Dir(path), err)
+		}
+		return nil
+	})
+}
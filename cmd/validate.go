@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// validateCmd represents the validate command
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Checks that a cluster can be created, without creating anything",
+	Long: `Runs the pre-flight checks of creating a cluster, so problems with the
+credentials, the region, the machines, the SSH key, the git provider, or Docker
+show up before any resources are created. It takes the same flags, and reads
+the same config file and profiles, as create-cluster. For example:
+
+gokp validate aws --cluster-name=mycluster \
+--github-token=githubtoken \
+--aws-ssh-key=sshkeynameonaws \
+--aws-access-key=awsaccesskeyid \
+--aws-secret-key=awssecretaccesskey`,
+	Annotations: map[string]string{clusterNameAnnotation: "new"},
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		// Only the providers have the flags the config file sets
+		if cmd.HasSubCommands() {
+			return
+		}
+		err := applyClusterConfig(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+}
+
+// preflightCheck is one of the checks validate runs. Run returns what was found, or why it failed. An Optional
+// check only warns when it fails
+type preflightCheck struct {
+	Name     string
+	Run      func() (string, error)
+	Optional bool
+}
+
+// runPreflightChecks runs the checks in order and prints a table of how they went. Checks after a failed one that
+// needs it still run, they're expected to fail on their own. It returns an error if any failed
+func runPreflightChecks(checks []preflightCheck) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "CHECK\tRESULT\tDETAILS")
+	failed := 0
+	for _, c := range checks {
+		details, err := c.Run()
+		if err != nil && c.Optional {
+			fmt.Fprintf(w, "%s\twarning\t%s\n", c.Name, strings.Join(strings.Fields(err.Error()), " "))
+			continue
+		}
+		if err != nil {
+			failed++
+			// AWS errors span lines, which the table can't
+			fmt.Fprintf(w, "%s\tFAILED\t%s\n", c.Name, strings.Join(strings.Fields(err.Error()), " "))
+			continue
+		}
+		fmt.Fprintf(w, "%s\tok\t%s\n", c.Name, details)
+	}
+	err := w.Flush()
+	if err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return errors.New(strconv.Itoa(failed) + " of " + strconv.Itoa(len(checks)) + " check(s) failed")
+	}
+
+	// If we're here, we should be okay
+	return nil
+}
@@ -0,0 +1,165 @@
+package cmd
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/christianh814/gokp/cmd/capi"
+	"github.com/christianh814/gokp/cmd/github"
+	"github.com/christianh814/gokp/cmd/kind"
+	"github.com/christianh814/gokp/cmd/state"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	creds "sigs.k8s.io/cluster-api-provider-aws/cmd/clusterawsadm/credentials"
+)
+
+// validateAwsCmd represents the validate aws command
+var validateAwsCmd = &cobra.Command{
+	Use:   "aws",
+	Short: "Checks that a GOKP Cluster can be created on AWS",
+	Long: `Checks that the flags given to create-cluster aws would work, without
+creating anything: that Docker is running, that AWS takes the credentials,
+that the region can be used, that the instance types are offered there, that
+the SSH key exists (unless it's going to be created), and that the git
+provider token can create the repo. For example:
+
+gokp validate aws --cluster-name=mycluster \
+--github-token=githubtoken \
+--aws-ssh-key=sshkeynameonaws \
+--aws-access-key=awsaccesskeyid \
+--aws-secret-key=awssecretaccesskey \
+--profile=medium`,
+	Run: func(cmd *cobra.Command, args []string) {
+		clusterName, _ := cmd.Flags().GetString("cluster-name")
+
+		// Credentials that weren't given as flags come from the secret store, just like they do for create-cluster
+		err := loadSecretFlags(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+		_, err = applySizingProfile(cmd, "aws")
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		awsRegion, _ := cmd.Flags().GetString("aws-region")
+		awsAccessKey, _ := cmd.Flags().GetString("aws-access-key")
+		awsSecretKey, _ := cmd.Flags().GetString("aws-secret-key")
+		awsSSHKey, _ := cmd.Flags().GetString("aws-ssh-key")
+		awsCPMachine, _ := cmd.Flags().GetString("aws-control-plane-machine")
+		awsWMachine, _ := cmd.Flags().GetString("aws-node-machine")
+
+		checks := []preflightCheck{
+			{Name: "Docker", Run: kind.CheckDocker},
+			{Name: "Cluster Name", Run: func() (string, error) {
+				exists, err := state.Exists(clusterName)
+				if err != nil {
+					return "", err
+				}
+				if exists {
+					return "", errors.New(clusterName + " already exists, delete it or pick another name")
+				}
+				return clusterName, nil
+			}},
+			{Name: "AWS Credentials", Run: func() (string, error) {
+				err := requireFlags(cmd, "aws-access-key", "aws-secret-key")
+				if err != nil {
+					return "", err
+				}
+				return capi.ValidateAWSCredentials(creds.AWSCredentials{
+					Region:          awsRegion,
+					AccessKeyID:     awsAccessKey,
+					SecretAccessKey: awsSecretKey,
+				})
+			}},
+			{Name: "AWS Region", Run: func() (string, error) {
+				return awsRegion, capi.CheckAWSRegion(awsRegion, awsAccessKey, awsSecretKey)
+			}},
+			{Name: "Instance Types", Run: func() (string, error) {
+				return awsCPMachine + " (control plane), " + awsWMachine + " (workers)", capi.CheckAWSInstanceTypes(awsRegion, awsAccessKey, awsSecretKey, []string{awsCPMachine, awsWMachine})
+			}},
+			{Name: "SSH Key", Run: func() (string, error) {
+				createSSHKey, _ := cmd.Flags().GetBool("aws-create-ssh-key")
+				return awsSSHKey, capi.CheckAWSSSHKey(awsRegion, awsAccessKey, awsSecretKey, awsSSHKey, createSSHKey)
+			}},
+		}
+
+		// Only an existing VPC has anything to check
+		placement, err := awsPlacementConfig(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if placement != nil {
+			checks = append(checks, preflightCheck{Name: "Node Placement", Run: func() (string, error) {
+				err := capi.ValidateAWSPlacement(placement, awsRegion, awsAccessKey, awsSecretKey, awsWMachine)
+				return placement.VPCID + ", workers in " + placement.NodeSubnet + " (" + placement.NodeZone + ")", err
+			}})
+		}
+
+		// Neither does who can reach the machines, without security groups to look up
+		security, err := awsSecurityConfig(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if security != nil {
+			checks = append(checks, preflightCheck{Name: "Security Groups", Run: func() (string, error) {
+				vpcID, _ := cmd.Flags().GetString("aws-vpc-id")
+				groups := append(append([]string{}, security.SecurityGroups...), security.LoadBalancerSecurityGroups...)
+				return strings.Join(groups, ", "), capi.ValidateAWSSecurity(security, vpcID, awsRegion, awsAccessKey, awsSecretKey)
+			}})
+		}
+
+		checks = append(checks, gitPreflightChecks(cmd)...)
+		checks = append(checks, preflightCheck{Name: "GitOps Controller", Run: func() (string, error) {
+			return gitOpsEngine(cmd)
+		}})
+		gitOpsController, _ := cmd.Flags().GetString("gitops-controller")
+		checks = append(checks, customPreflightChecks(map[string]string{"GOKP_CLUSTER_NAME": clusterName, "GOKP_GITOPS_CONTROLLER": gitOpsController})...)
+
+		err = runPreflightChecks(checks)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Info("All checks passed, the cluster can be created with the same flags on create-cluster aws")
+	},
+}
+
+func init() {
+	validateCmd.AddCommand(validateAwsCmd)
+
+	// The same flags as create-cluster aws, so the same command line can be checked
+	validateAwsCmd.Flags().AddFlagSet(awscreateCmd.Flags())
+}
+
+// gitPreflightChecks returns the checks of the git provider flags, and of the scopes of the GitHub token
+func gitPreflightChecks(cmd *cobra.Command) []preflightCheck {
+	checks := []preflightCheck{
+		{Name: "Git Provider", Run: func() (string, error) {
+			gitProvider, _ := cmd.Flags().GetString("git-provider")
+			if gitURL, _ := cmd.Flags().GetString("git-url"); gitURL != "" {
+				gitProvider = gitURL
+			}
+			return gitProvider, checkGitProviderFlags(cmd)
+		}},
+	}
+
+	gitProvider, _ := cmd.Flags().GetString("git-provider")
+	gitURL, _ := cmd.Flags().GetString("git-url")
+	appID, _ := cmd.Flags().GetInt64("github-app-id")
+	if gitProvider != "github" || gitURL != "" || appID != 0 {
+		return checks
+	}
+
+	return append(checks, preflightCheck{Name: "GitHub Token", Run: func() (string, error) {
+		ghToken, _ := cmd.Flags().GetString("github-token")
+		if ghToken == "" {
+			return "", errors.New("--github-token is required when using the github provider")
+		}
+		privateRepo, _ := cmd.Flags().GetBool("private-repo")
+		user, err := github.CheckTokenScopes(ghToken, privateRepo)
+		if err != nil {
+			return "", err
+		}
+		return "belongs to " + user, nil
+	}})
+}
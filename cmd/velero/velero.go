@@ -0,0 +1,363 @@
+package velero
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/christianh814/gokp/cmd/templates"
+	"github.com/christianh814/gokp/cmd/utils"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Version is the version of Velero that's installed, and AWSPluginVersion the version of its AWS plugin
+var (
+	Version          string = "v1.9.2"
+	AWSPluginVersion string = "v1.5.1"
+)
+
+// Namespace is where Velero runs, and SecretName the Secret in it with the AWS credentials it uses. The Secret is
+// created on the cluster, it's never in the GitOps repo
+var (
+	Namespace  string = "velero"
+	SecretName string = "cloud-credentials"
+)
+
+// crds are the CustomResourceDefinitions of Velero, which are in its repo but not in a kustomization
+var crds = []string{
+	"backups",
+	"backupstoragelocations",
+	"deletebackuprequests",
+	"downloadrequests",
+	"podvolumebackups",
+	"podvolumerestores",
+	"resticrepositories",
+	"restores",
+	"schedules",
+	"serverstatusrequests",
+	"volumesnapshotlocations",
+}
+
+// repoDir is the dir under cluster/core Velero is kept in
+var repoDir string = "velero"
+
+// policyName is the name of the inline policy of the IAM user
+var policyName string = "gokp-velero"
+
+// bucketName is what the name of an S3 bucket can be
+var bucketName = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+
+// Backups are the scheduled backups of a cluster, kept under the name of the cluster in the S3 Bucket in Region.
+// Schedule is a cron expression, and TTL how long each backup is kept for
+type Backups struct {
+	Bucket   string
+	Region   string
+	Schedule string
+	TTL      string
+}
+
+// Validate makes sure the backups can be set up, before anything is created
+func (b Backups) Validate() error {
+	if !bucketName.MatchString(b.Bucket) || strings.Contains(b.Bucket, "..") {
+		return errors.New("invalid S3 bucket name " + b.Bucket + ", it should be 3 to 63 lowercase letters, numbers, dots, and hyphens")
+	}
+	if b.Region == "" {
+		return errors.New("the backup bucket needs a region")
+	}
+	if len(strings.Fields(b.Schedule)) != 5 {
+		return errors.New("invalid backup schedule " + b.Schedule + ", it should be a cron expression like \"0 3 * * *\"")
+	}
+	ttl, err := time.ParseDuration(b.TTL)
+	if err != nil || ttl <= 0 {
+		return errors.New("invalid backup TTL " + b.TTL + ", it should look like 720h")
+	}
+	return nil
+}
+
+// UserName returns the name of the IAM user Velero of the cluster uses
+func UserName(clusterName string) string {
+	return "gokp-" + clusterName + "-velero"
+}
+
+// EnsureBucket makes sure the bucket is there, in the region, and can be reached with the credentials. It's created
+// (private and encrypted) if it isn't there. The default credential chain is used if no keys are given
+func EnsureBucket(b Backups, clusterName string, accessKey string, secretKey string) error {
+	sess, err := newSession(b.Region, accessKey, secretKey)
+	if err != nil {
+		return err
+	}
+	svc := s3.New(sess)
+
+	_, err = svc.HeadBucket(&s3.HeadBucketInput{Bucket: aws.String(b.Bucket)})
+	if err == nil {
+		out, err := svc.GetBucketLocation(&s3.GetBucketLocationInput{Bucket: aws.String(b.Bucket)})
+		if err != nil {
+			return err
+		}
+		region := aws.StringValue(out.LocationConstraint)
+		if region == "" {
+			region = "us-east-1"
+		}
+		if region != b.Region {
+			return errors.New("the backup bucket " + b.Bucket + " is in " + region + ", not " + b.Region)
+		}
+		return nil
+	}
+	if isAWSError(err, "Forbidden") {
+		return errors.New("the backup bucket " + b.Bucket + " can't be reached with these credentials, it may belong to another account")
+	}
+	if !isAWSError(err, "NotFound") {
+		return err
+	}
+
+	// The backups are the cluster, nobody else should be able to read them
+	input := &s3.CreateBucketInput{Bucket: aws.String(b.Bucket)}
+	if b.Region != "us-east-1" {
+		input.CreateBucketConfiguration = &s3.CreateBucketConfiguration{LocationConstraint: aws.String(b.Region)}
+	}
+	_, err = svc.CreateBucket(input)
+	if err != nil {
+		return err
+	}
+	_, err = svc.PutPublicAccessBlock(&s3.PutPublicAccessBlockInput{
+		Bucket: aws.String(b.Bucket),
+		PublicAccessBlockConfiguration: &s3.PublicAccessBlockConfiguration{
+			BlockPublicAcls:       aws.Bool(true),
+			BlockPublicPolicy:     aws.Bool(true),
+			IgnorePublicAcls:      aws.Bool(true),
+			RestrictPublicBuckets: aws.Bool(true),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = svc.PutBucketEncryption(&s3.PutBucketEncryptionInput{
+		Bucket: aws.String(b.Bucket),
+		ServerSideEncryptionConfiguration: &s3.ServerSideEncryptionConfiguration{
+			Rules: []*s3.ServerSideEncryptionRule{{
+				ApplyServerSideEncryptionByDefault: &s3.ServerSideEncryptionByDefault{SSEAlgorithm: aws.String(s3.ServerSideEncryptionAes256)},
+			}},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = svc.PutBucketTagging(&s3.PutBucketTaggingInput{
+		Bucket:  aws.String(b.Bucket),
+		Tagging: &s3.Tagging{TagSet: []*s3.Tag{{Key: aws.String("gokp-cluster"), Value: aws.String(clusterName)}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Info("Created S3 bucket ", b.Bucket, " for the backups")
+	return nil
+}
+
+// CreateAWSCredentials creates the IAM user of the cluster, allowed to keep backups in the bucket and take EBS
+// snapshots only, and returns a new access key for it. Access keys it already had are deleted, so this can be run
+// again
+func CreateAWSCredentials(clusterName string, b Backups, accessKey string, secretKey string) (string, string, error) {
+	sess, err := newSession(b.Region, accessKey, secretKey)
+	if err != nil {
+		return "", "", err
+	}
+	svc := iam.New(sess)
+	userName := UserName(clusterName)
+
+	_, err = svc.CreateUser(&iam.CreateUserInput{
+		UserName: aws.String(userName),
+		Tags:     []*iam.Tag{{Key: aws.String("gokp-cluster"), Value: aws.String(clusterName)}},
+	})
+	if err != nil && !isAWSError(err, iam.ErrCodeEntityAlreadyExistsException) {
+		return "", "", err
+	}
+
+	policy, err := json.Marshal(map[string]interface{}{
+		"Version": "2012-10-17",
+		"Statement": []map[string]interface{}{
+			{
+				"Effect":   "Allow",
+				"Action":   []string{"ec2:DescribeVolumes", "ec2:DescribeSnapshots", "ec2:CreateTags", "ec2:CreateVolume", "ec2:CreateSnapshot", "ec2:DeleteSnapshot"},
+				"Resource": []string{"*"},
+			},
+			{
+				"Effect":   "Allow",
+				"Action":   []string{"s3:GetObject", "s3:DeleteObject", "s3:PutObject", "s3:AbortMultipartUpload", "s3:ListMultipartUploadParts"},
+				"Resource": []string{"arn:aws:s3:::" + b.Bucket + "/*"},
+			},
+			{
+				"Effect":   "Allow",
+				"Action":   []string{"s3:ListBucket"},
+				"Resource": []string{"arn:aws:s3:::" + b.Bucket},
+			},
+		},
+	})
+	if err != nil {
+		return "", "", err
+	}
+	_, err = svc.PutUserPolicy(&iam.PutUserPolicyInput{
+		UserName:       aws.String(userName),
+		PolicyName:     aws.String(policyName),
+		PolicyDocument: aws.String(string(policy)),
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	err = deleteAccessKeys(svc, userName)
+	if err != nil {
+		return "", "", err
+	}
+	out, err := svc.CreateAccessKey(&iam.CreateAccessKeyInput{UserName: aws.String(userName)})
+	if err != nil {
+		return "", "", err
+	}
+
+	log.Info("Created IAM user ", userName, " for Velero")
+	return aws.StringValue(out.AccessKey.AccessKeyId), aws.StringValue(out.AccessKey.SecretAccessKey), nil
+}
+
+// DeleteAWSCredentials deletes the IAM user of the cluster, along with its access keys and policy. It's not an
+// error if it's already gone. The bucket is left alone, the backups are what a lost cluster is restored from
+func DeleteAWSCredentials(clusterName string, region string, accessKey string, secretKey string) error {
+	sess, err := newSession(region, accessKey, secretKey)
+	if err != nil {
+		return err
+	}
+	svc := iam.New(sess)
+	userName := UserName(clusterName)
+
+	err = deleteAccessKeys(svc, userName)
+	if isAWSError(err, iam.ErrCodeNoSuchEntityException) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, err = svc.DeleteUserPolicy(&iam.DeleteUserPolicyInput{UserName: aws.String(userName), PolicyName: aws.String(policyName)})
+	if err != nil && !isAWSError(err, iam.ErrCodeNoSuchEntityException) {
+		return err
+	}
+	_, err = svc.DeleteUser(&iam.DeleteUserInput{UserName: aws.String(userName)})
+	if err != nil && !isAWSError(err, iam.ErrCodeNoSuchEntityException) {
+		return err
+	}
+
+	log.Info("Deleted IAM user ", userName)
+	return nil
+}
+
+// deleteAccessKeys deletes every access key of the IAM user
+func deleteAccessKeys(svc *iam.IAM, userName string) error {
+	out, err := svc.ListAccessKeys(&iam.ListAccessKeysInput{UserName: aws.String(userName)})
+	if err != nil {
+		return err
+	}
+	for _, k := range out.AccessKeyMetadata {
+		_, err = svc.DeleteAccessKey(&iam.DeleteAccessKeyInput{UserName: aws.String(userName), AccessKeyId: k.AccessKeyId})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateSecret creates (or replaces) the Secret with the access key Velero uses on the cluster of the kubeconfig,
+// along with its namespace. It's a credentials file, which is what the AWS plugin of Velero reads
+func CreateSecret(kubeconfig string, accessKeyID string, secretAccessKey string) error {
+	cfg, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return err
+	}
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	_, err = clientset.CoreV1().Namespaces().Create(context.TODO(), &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: Namespace},
+	}, metav1.CreateOptions{})
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: SecretName, Namespace: Namespace},
+		Type:       corev1.SecretTypeOpaque,
+		StringData: map[string]string{
+			"cloud": "[default]\naws_access_key_id=" + accessKeyID + "\naws_secret_access_key=" + secretAccessKey + "\n",
+		},
+	}
+	_, err = clientset.CoreV1().Secrets(Namespace).Create(context.TODO(), secret, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		_, err = clientset.CoreV1().Secrets(Namespace).Update(context.TODO(), secret, metav1.UpdateOptions{})
+	}
+	return err
+}
+
+// WriteManifests writes Velero under the cluster/core dir of baseDir, so the GitOps controller deploys it, with the
+// bucket as its default backup location and a Schedule for the backups
+func WriteManifests(baseDir string, clusterName string, b Backups) error {
+	err := b.Validate()
+	if err != nil {
+		return err
+	}
+
+	dir := baseDir + "/cluster/core/" + repoDir
+	os.MkdirAll(dir, 0755)
+
+	veleroVars := struct {
+		Backups
+		Version          string
+		AWSPluginVersion string
+		Namespace        string
+		SecretName       string
+		Prefix           string
+		CRDs             []string
+	}{
+		Backups:          b,
+		Version:          Version,
+		AWSPluginVersion: AWSPluginVersion,
+		Namespace:        Namespace,
+		SecretName:       SecretName,
+		Prefix:           clusterName,
+		CRDs:             crds,
+	}
+	_, err = utils.WriteTemplate(templates.Velero, dir+"/"+"velero.yaml", veleroVars)
+	if err != nil {
+		return err
+	}
+	_, err = utils.WriteTemplate(templates.VeleroKustomize, dir+"/"+"kustomization.yaml", veleroVars)
+	return err
+}
+
+// isAWSError returns true if err is an AWS error with the code
+func isAWSError(err error, code string) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == code
+}
+
+// newSession returns an AWS session for the region. The default credential chain is used if no keys are given
+func newSession(region string, accessKey string, secretKey string) (*session.Session, error) {
+	cfg := &aws.Config{Region: aws.String(region)}
+	if accessKey != "" && secretKey != "" {
+		cfg.Credentials = credentials.NewStaticCredentials(accessKey, secretKey, "")
+	}
+	return session.NewSession(cfg)
+}
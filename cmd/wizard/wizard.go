@@ -0,0 +1,137 @@
+package wizard
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// Prompter asks questions on out and reads the answers from in
+type Prompter struct {
+	in     *bufio.Reader
+	out    io.Writer
+	secret func() (string, error)
+}
+
+// New returns a Prompter for the terminal. Secrets aren't echoed when stdin is a terminal
+func New() *Prompter {
+	p := &Prompter{
+		in:  bufio.NewReader(os.Stdin),
+		out: os.Stdout,
+	}
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		p.secret = func() (string, error) {
+			b, err := term.ReadPassword(fd)
+			fmt.Fprintln(p.out)
+			return string(b), err
+		}
+	}
+	return p
+}
+
+// Ask asks the question until validate takes the answer, which is def if nothing is given. validate can be nil
+func (p *Prompter) Ask(question string, def string, validate func(string) error) (string, error) {
+	for {
+		if def != "" {
+			fmt.Fprint(p.out, question+" ["+def+"]: ")
+		} else {
+			fmt.Fprint(p.out, question+": ")
+		}
+		answer, err := p.readLine()
+		if err != nil {
+			return "", err
+		}
+		if answer == "" {
+			answer = def
+		}
+		if validate != nil {
+			if err := validate(answer); err != nil {
+				fmt.Fprintln(p.out, "  "+err.Error())
+				continue
+			}
+		}
+		return answer, nil
+	}
+}
+
+// AskSecret asks for a secret until validate takes it, without echoing it if it can. validate can be nil
+func (p *Prompter) AskSecret(question string, validate func(string) error) (string, error) {
+	for {
+		fmt.Fprint(p.out, question+": ")
+		var answer string
+		var err error
+		if p.secret != nil {
+			answer, err = p.secret()
+			answer = strings.TrimSpace(answer)
+		} else {
+			answer, err = p.readLine()
+		}
+		if err != nil {
+			return "", err
+		}
+		if validate != nil {
+			if err := validate(answer); err != nil {
+				fmt.Fprintln(p.out, "  "+err.Error())
+				continue
+			}
+		}
+		return answer, nil
+	}
+}
+
+// Choose asks for one of the options, def if nothing is given
+func (p *Prompter) Choose(question string, options []string, def string) (string, error) {
+	return p.Ask(question+" ("+strings.Join(options, ", ")+")", def, func(answer string) error {
+		for _, o := range options {
+			if answer == o {
+				return nil
+			}
+		}
+		return errors.New("it should be one of: " + strings.Join(options, ", "))
+	})
+}
+
+// Confirm asks a yes or no question, def if nothing is given
+func (p *Prompter) Confirm(question string, def bool) (bool, error) {
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+	for {
+		fmt.Fprint(p.out, question+" ["+hint+"]: ")
+		answer, err := p.readLine()
+		if err != nil {
+			return false, err
+		}
+		switch strings.ToLower(answer) {
+		case "":
+			return def, nil
+		case "y", "yes":
+			return true, nil
+		case "n", "no":
+			return false, nil
+		}
+	}
+}
+
+// Println writes a line out
+func (p *Prompter) Println(a ...interface{}) {
+	fmt.Fprintln(p.out, a...)
+}
+
+// readLine reads an answer. Running out of input ends the wizard
+func (p *Prompter) readLine() (string, error) {
+	line, err := p.in.ReadString('\n')
+	if err == io.EOF && line == "" {
+		return "", errors.New("no more answers, stopping")
+	}
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}